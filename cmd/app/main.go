@@ -3,20 +3,40 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"expvar"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sync"
 	"syscall"
 	"time"
 
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+
+	"pellets-tracker/internal/auth"
 	"pellets-tracker/internal/config"
+	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/core/events"
 	httpserver "pellets-tracker/internal/http"
+	"pellets-tracker/internal/jobs"
+	"pellets-tracker/internal/mail"
+	"pellets-tracker/internal/marketprice"
+	"pellets-tracker/internal/mdns"
+	"pellets-tracker/internal/notify"
+	"pellets-tracker/internal/ocr"
+	"pellets-tracker/internal/retention"
+	"pellets-tracker/internal/sheets"
 	"pellets-tracker/internal/store"
+	"pellets-tracker/internal/tlscert"
 	tsnetserver "pellets-tracker/internal/tsnet"
+	"pellets-tracker/internal/version"
 )
 
 func main() {
@@ -33,42 +53,346 @@ func main() {
 		}
 	}
 
-	dataStore, err := store.NewJSONStore(cfg.DataFile, cfg.BackupDir)
+	openStore := store.NewJSONStore
+	if cfg.LenientLoad {
+		openStore = store.NewLenientJSONStore
+	}
+	dataStore, err := openStore(cfg.DataFile, cfg.BackupDir, store.Format(cfg.DataFormat))
 	if err != nil {
 		log.Fatalf("failed to initialize datastore: %v", err)
 	}
+	dataStore.SetSlowSaveThreshold(cfg.SlowSaveThreshold)
+	if cfg.BackupRetention != nil {
+		retention := store.BackupRetention{
+			Last:    cfg.BackupRetention["last"],
+			Daily:   cfg.BackupRetention["daily"],
+			Weekly:  cfg.BackupRetention["weekly"],
+			Monthly: cfg.BackupRetention["monthly"],
+		}
+		dataStore.SetBackupRetention(retention)
+		log.Printf("keeping the rotated backups: %s", retention)
+	}
+	expvar.Publish("store", expvar.Func(func() any { return dataStore.Stats() }))
+
+	// The integrations subscribe to the domain events rather than each
+	// watching the datastore.
+	bus := events.NewBus()
+	dataStore.SetOnReplace(bus.Observe)
+	dataStore.SetOnSaveError(bus.ObserveSaveError)
+
+	var notifier *notify.Notifier
+	if len(cfg.WebhookURLs) > 0 {
+		notifier, err = notify.New(notify.Config{URLs: cfg.WebhookURLs, Digest: cfg.NotifyDigest, DigestHour: cfg.NotifyDigestHour})
+		if err != nil {
+			log.Fatalf("failed to configure webhooks: %v", err)
+		}
+		bus.Subscribe(notifier.Handle)
+	}
 
-	apiServer := httpserver.NewServer(dataStore, httpserver.Config{MaxBrandImageBytes: cfg.BrandImageMaxBytes})
+	var mailer *mail.Mailer
+	if cfg.SMTPAddr != "" {
+		mailer, err = mail.New(mail.Config{
+			Addr:     cfg.SMTPAddr,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+			To:       cfg.ReportEmailTo,
+		})
+		if err != nil {
+			log.Fatalf("failed to configure email: %v", err)
+		}
+	}
 
-	srv := &http.Server{
-		Addr:         cfg.ListenAddr,
-		Handler:      apiServer.Handler(),
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+	var exporter *sheets.Exporter
+	if cfg.SheetsWebhookURL != "" || cfg.SheetsSpreadsheetID != "" {
+		var credentials []byte
+		if cfg.SheetsCredentialsFile != "" {
+			credentials, err = os.ReadFile(cfg.SheetsCredentialsFile)
+			if err != nil {
+				log.Fatalf("failed to read spreadsheet credentials: %v", err)
+			}
+		}
+		exporter, err = sheets.New(sheets.Config{
+			WebhookURL:    cfg.SheetsWebhookURL,
+			SpreadsheetID: cfg.SheetsSpreadsheetID,
+			Credentials:   credentials,
+			Interval:      cfg.SheetsInterval,
+			StateFile:     filepath.Join(filepath.Dir(cfg.DataFile), "sheets-export.json"),
+		})
+		if err != nil {
+			log.Fatalf("failed to configure spreadsheet export: %v", err)
+		}
+	}
+
+	var purger *retention.Purger
+	if len(cfg.Retention) > 0 || cfg.CompactSeasons > 0 {
+		purger, err = retention.New(retention.Config{
+			Policy: core.RetentionPolicy{
+				Consumptions:   cfg.Retention["consumptions"],
+				Audit:          cfg.Retention["audit"],
+				Temperatures:   cfg.Retention["temperatures"],
+				Occupancy:      cfg.Retention["occupancy"],
+				SiloReadings:   cfg.Retention["silo_readings"],
+				CompactSeasons: cfg.CompactSeasons,
+			},
+			Interval: cfg.RetentionInterval,
+		})
+		if err != nil {
+			log.Fatalf("failed to configure retention: %v", err)
+		}
+	}
+
+	var marketPrices *marketprice.Fetcher
+	if cfg.MarketPriceURL != "" {
+		marketPrices, err = marketprice.New(marketprice.Config{
+			URL:        cfg.MarketPriceURL,
+			Format:     cfg.MarketPriceFormat,
+			Records:    cfg.MarketPriceRecords,
+			MonthField: cfg.MarketPriceMonthField,
+			PriceField: cfg.MarketPricePriceField,
+			Interval:   cfg.MarketPriceInterval,
+		})
+		if err != nil {
+			log.Fatalf("failed to configure market price index: %v", err)
+		}
+	}
+
+	var remoteBackup *store.RemoteBackup
+	if cfg.RemoteBackupURL != "" {
+		remoteBackup, err = newRemoteBackup(cfg, bus)
+		if err != nil {
+			log.Fatalf("failed to configure remote backups: %v", err)
+		}
+	}
+
+	var receipts httpserver.ReceiptReader
+	if cfg.OCRURL != "" || cfg.OCRCommand != "" {
+		reader, err := ocr.New(ocr.Config{URL: cfg.OCRURL, Command: cfg.OCRCommand, Timeout: cfg.OCRTimeout})
+		if err != nil {
+			log.Fatalf("failed to configure receipt ocr: %v", err)
+		}
+		receipts = reader
+	}
+
+	build := version.Current()
+	log.Printf("pellets tracker %s (commit %s, %s)", build.Version, build.Commit, build.GoVersion)
+
+	var updateChecker *version.UpdateChecker
+	var updates httpserver.UpdateNotifier
+	if cfg.UpdateCheck {
+		updateChecker, err = version.NewUpdateChecker(cfg.UpdateRepo, build.Version)
+		if err != nil {
+			log.Fatalf("failed to configure update check: %v", err)
+		}
+		updates = updateChecker
+	}
+
+	var errorPages map[int][]byte
+	if cfg.ErrorPagesDir != "" {
+		errorPages, err = httpserver.LoadErrorPages(cfg.ErrorPagesDir)
+		if err != nil {
+			log.Fatalf("failed to load error pages: %v", err)
+		}
+	}
+
+	var authManager *auth.Manager
+	if cfg.AuthEnabled {
+		authManager, err = auth.New(auth.Config{SessionTTL: cfg.SessionTTL})
+		if err != nil {
+			log.Fatalf("failed to configure authentication: %v", err)
+		}
 	}
+	logExposure(cfg)
 
-	listener, cleanup, listenAddr, err := prepareListener(cfg)
+	scheduler := jobs.NewScheduler()
+	connections := httpserver.NewConnTracker()
+	serverCfg := httpserver.Config{
+		MaxBrandImageBytes: cfg.BrandImageMaxBytes,
+		BrandImageWidth:    &cfg.BrandImageWidth,
+		BrandImageQuality:  cfg.BrandImageQuality,
+		BrandImageFormat:   cfg.BrandImageFormat,
+		AdminToken:         cfg.AdminToken,
+		WeightDecimals:     cfg.WeightDecimals,
+		ComputeTimeout:     cfg.ComputeTimeout,
+		Updates:            updates,
+		LogExclude:         cfg.LogExclude,
+		LogSampleEvery:     cfg.LogSampleEvery,
+		ErrorPages:         errorPages,
+		Auth:               authManager,
+		PrivateReads:       cfg.AuthPrivate,
+		CostingMethod:      core.CostingMethod(cfg.CostingMethod),
+		StoreStats:         dataStore,
+		CSVFormat:          cfg.CSVFormat,
+		ChartMonths:        cfg.ChartMonths,
+		ChartRollup:        core.ChartRollup(cfg.ChartRollup),
+		Receipts:           receipts,
+		SeparateAdmin:      cfg.AdminAddr != "",
+		ReadOnly:           dataStore,
+		Jobs:               scheduler,
+		ReportDir:          filepath.Join(filepath.Dir(cfg.DataFile), "reports"),
+		Connections:        connections,
+		ExportStallTimeout: cfg.ExportStallTimeout,
+	}
+	apiServer := httpserver.NewServer(dataStore, serverCfg)
+	if err := addJobs(scheduler, cfg, dataStore, apiServer, remoteBackup, mailer); err != nil {
+		log.Fatalf("failed to schedule jobs: %v", err)
+	}
+
+	listeners, err := prepareListeners(cfg)
 	if err != nil {
 		log.Fatalf("failed to prepare listener: %v", err)
 	}
 	defer func() {
-		if cleanup != nil {
-			if err := cleanup(); err != nil && !errors.Is(err, net.ErrClosed) {
-				log.Printf("listener cleanup error: %v", err)
+		for _, ln := range listeners {
+			if err := ln.cleanup(); err != nil && !errors.Is(err, net.ErrClosed) {
+				log.Printf("%s listener cleanup error: %v", ln.name, err)
 			}
 		}
 	}()
+	// The config only allows TLS and mDNS when the LAN listener is opened.
+	lan := findListener(listeners, "lan")
+	if lan == nil && (cfg.TLSEnabled() || cfg.MDNSEnabled) {
+		log.Fatalf("tls and mdns need the LAN listener on %s", cfg.ListenAddr)
+	}
+	for _, ln := range listeners {
+		ln.Listener = connections.Listener(ln.Listener, ln.name)
+	}
+
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	var acmeHandler http.Handler
+	if cfg.TLSEnabled() {
+		tlsConfig, challenges, err := prepareTLS(backgroundCtx, cfg)
+		if err != nil {
+			log.Fatalf("failed to prepare tls: %v", err)
+		}
+		// Only the LAN gets TLS: the tailnet is served as plain HTTP, already
+		// encrypted by WireGuard, and Funnel is wrapped in TLS by tsnet.
+		lan.Listener = tls.NewListener(lan.Listener, tlsConfig)
+		acmeHandler = challenges
+		if cfg.TLSCertFile != "" {
+			log.Printf("serving https with %s", cfg.TLSCertFile)
+		} else {
+			log.Printf("serving https for %s", cfg.TLSDomain)
+		}
+	}
+
+	if backup, readOnly := dataStore.ReadOnly(); readOnly {
+		go dataStore.RetryDataFile(backgroundCtx, 30*time.Second)
+		log.Printf("serving %s read-only until %s can be read again", backup, cfg.DataFile)
+	}
+	if updateChecker != nil {
+		go updateChecker.Run(backgroundCtx)
+	}
+	if notifier != nil {
+		go notifier.Run(backgroundCtx)
+		log.Printf("posting events to %d webhook(s)", len(cfg.WebhookURLs))
+		if cfg.NotifyDigest != "" {
+			log.Printf("batching webhook events into a %s digest at %02d:00", cfg.NotifyDigest, cfg.NotifyDigestHour)
+		}
+	}
+
+	if exporter != nil {
+		go exporter.Run(backgroundCtx, dataStore)
+		log.Printf("exporting new entries to the spreadsheet every %s", cfg.SheetsInterval)
+	}
+	if purger != nil {
+		go purger.Run(backgroundCtx, dataStore)
+		log.Printf("purging the entries past their retention every %s", cfg.RetentionInterval)
+	}
+	if marketPrices != nil {
+		go marketPrices.Run(backgroundCtx, dataStore)
+		log.Printf("fetching the market price index every %s", cfg.MarketPriceInterval)
+	}
+	go scheduler.Run(backgroundCtx)
+	for _, status := range scheduler.Statuses() {
+		log.Printf("running job %s on schedule %q", status.Name, status.Schedule)
+	}
+
+	var mdnsDone <-chan struct{}
+	if cfg.MDNSEnabled {
+		mdnsDone = startMDNS(backgroundCtx, cfg, lan.Addr())
+	}
+
+	var debugSrv *http.Server
+	if cfg.DebugAddr != "" {
+		debugSrv = &http.Server{
+			Addr:              cfg.DebugAddr,
+			Handler:           httpserver.DebugHandler(),
+			ReadHeaderTimeout: 15 * time.Second,
+		}
+		go func() {
+			log.Printf("debug endpoints listening on %s", cfg.DebugAddr)
+			if err := debugSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("debug server error: %v", err)
+			}
+		}()
+	}
+
+	var adminSrv *http.Server
+	if cfg.AdminAddr != "" {
+		adminSrv = &http.Server{
+			Addr:              cfg.AdminAddr,
+			Handler:           apiServer.AdminHandler(),
+			ReadHeaderTimeout: 15 * time.Second,
+		}
+		go func() {
+			log.Printf("admin endpoints listening on %s", cfg.AdminAddr)
+			if err := adminSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("admin server error: %v", err)
+			}
+		}()
+	}
+
+	var acmeSrv *http.Server
+	if acmeHandler != nil && cfg.ACMEHTTPAddr != "" {
+		acmeSrv = &http.Server{
+			Addr:              cfg.ACMEHTTPAddr,
+			Handler:           acmeHandler,
+			ReadHeaderTimeout: 15 * time.Second,
+		}
+		go func() {
+			log.Printf("acme challenges and https redirects listening on %s", cfg.ACMEHTTPAddr)
+			if err := acmeSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("acme http server error: %v", err)
+			}
+		}()
+	}
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 
-	go func() {
-		log.Printf("pellets tracker listening on %s (tsnet=%v)", listenAddr, cfg.TsnetEnabled)
-		if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Fatalf("http server error: %v", err)
+	// Each listener has a server of its own: with PELLETS_TSNET_LAN, the LAN
+	// keeps being served when the tailnet fails and the other way round.
+	handler := apiServer.Handler()
+	var readOnlyHandler http.Handler
+	if cfg.TsnetFunnel {
+		readOnlyHandler = httpserver.NewServer(dataStore, funnelServerConfig(serverCfg, cfg.TsnetFunnelToken)).Handler()
+	}
+	servers := make([]*http.Server, len(listeners))
+	for i, ln := range listeners {
+		lnHandler := handler
+		if ln.readOnly {
+			lnHandler = readOnlyHandler
 		}
-	}()
+		srv := &http.Server{
+			Addr:         ln.addr,
+			Handler:      lnHandler,
+			ReadTimeout:  15 * time.Second,
+			WriteTimeout: 15 * time.Second,
+			IdleTimeout:  60 * time.Second,
+		}
+		servers[i] = srv
+		go func() {
+			log.Printf("pellets tracker listening on %s (%s)", ln.addr, ln.name)
+			if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				if len(listeners) == 1 {
+					log.Fatalf("http server error: %v", err)
+				}
+				log.Printf("%s http server error: %v", ln.name, err)
+			}
+		}()
+	}
 
 	<-stop
 	log.Println("shutdown signal received")
@@ -76,22 +400,191 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	if err := srv.Shutdown(ctx); err != nil {
+	stopBackground()
+	if mdnsDone != nil {
+		select {
+		case <-mdnsDone:
+		case <-ctx.Done():
+		}
+	}
+	if debugSrv != nil {
+		if err := debugSrv.Shutdown(ctx); err != nil {
+			log.Printf("debug server shutdown: %v", err)
+		}
+	}
+	if adminSrv != nil {
+		if err := adminSrv.Shutdown(ctx); err != nil {
+			log.Printf("admin server shutdown: %v", err)
+		}
+	}
+	if acmeSrv != nil {
+		if err := acmeSrv.Shutdown(ctx); err != nil {
+			log.Printf("acme http server shutdown: %v", err)
+		}
+	}
+	var wg sync.WaitGroup
+	failed := make([]error, len(servers))
+	for i, srv := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				failed[i] = fmt.Errorf("%s: %w", listeners[i].name, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(failed...); err != nil {
 		log.Fatalf("graceful shutdown failed: %v", err)
 	}
 
 	log.Println("server stopped cleanly")
 }
 
-func prepareListener(cfg *config.Config) (net.Listener, func() error, string, error) {
-	if !cfg.TsnetEnabled {
+// newRemoteBackup builds the job pushing the datastore to
+// cfg.RemoteBackupURL.
+func newRemoteBackup(cfg *config.Config, publisher events.Publisher) (*store.RemoteBackup, error) {
+	var sshKey []byte
+	if cfg.RemoteBackupSSHKeyFile != "" {
+		var err error
+		sshKey, err = os.ReadFile(cfg.RemoteBackupSSHKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ssh key: %w", err)
+		}
+	}
+	target, err := store.NewRemoteTarget(store.RemoteTargetConfig{
+		URL:           cfg.RemoteBackupURL,
+		SSHKey:        sshKey,
+		SSHKnownHosts: cfg.RemoteBackupKnownHosts,
+		S3Endpoint:    cfg.RemoteBackupS3Endpoint,
+		S3Region:      cfg.RemoteBackupS3Region,
+		S3AccessKey:   cfg.RemoteBackupS3AccessKey,
+		S3SecretKey:   cfg.RemoteBackupS3SecretKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return store.NewRemoteBackup(store.RemoteBackupConfig{
+		Target: target,
+		Name:   filepath.Base(cfg.DataFile),
+		Events: publisher,
+	})
+}
+
+// addJobs schedules the jobs of cfg.Jobs, and the remote backups when
+// remoteBackup is set. The season reports are written next to the
+// datastore file, in a reports directory.
+func addJobs(scheduler *jobs.Scheduler, cfg *config.Config, dataStore *store.JSONStore, apiServer *httpserver.Server, remoteBackup *store.RemoteBackup, mailer *mail.Mailer) error {
+	funcs := map[string]jobs.Func{
+		"backup":    func(context.Context) error { return dataStore.Backup() },
+		"integrity": func(context.Context) error { return dataStore.CheckIntegrity() },
+		"forecast":  apiServer.RefreshForecast,
+		"report": func(ctx context.Context) error {
+			path, err := apiServer.WriteSeasonReport(ctx, core.SeasonStartYear(time.Now()))
+			if err == nil && path != "" {
+				log.Printf("season report written to %s", path)
+			}
+			return err
+		},
+		"season_end": func(ctx context.Context) error {
+			return endSeason(ctx, apiServer, mailer)
+		},
+	}
+	schedules := make(map[string]string, len(cfg.Jobs)+1)
+	for name, spec := range cfg.Jobs {
+		schedules[name] = spec
+	}
+	if remoteBackup != nil {
+		schedules["remote_backup"] = cfg.RemoteBackupSchedule
+		funcs["remote_backup"] = func(ctx context.Context) error { return remoteBackup.Backup(ctx, dataStore) }
+	}
+	for name, spec := range schedules {
+		schedule, err := jobs.ParseSchedule(spec)
+		if err != nil {
+			return fmt.Errorf("job %s: %w", name, err)
+		}
+		if err := scheduler.Add(name, schedule, funcs[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// endSeason archives the report of the season ended last and emails it when
+// a mailer is configured.
+func endSeason(ctx context.Context, apiServer *httpserver.Server, mailer *mail.Mailer) error {
+	year := core.SeasonStartYear(time.Now()) - 1
+	path, err := apiServer.WriteSeasonReport(ctx, year)
+	if err != nil || path == "" {
+		return err
+	}
+	log.Printf("season report written to %s", path)
+	if mailer == nil {
+		return nil
+	}
+	message, err := apiServer.SeasonReportEmail(ctx, year)
+	if err != nil {
+		return err
+	}
+	if err := mailer.Send(ctx, message); err != nil {
+		return fmt.Errorf("email season report: %w", err)
+	}
+	log.Printf("season report %s emailed", core.SeasonLabel(year))
+	return nil
+}
+
+// listener is one of the addresses the main server answers on.
+type listener struct {
+	net.Listener
+	// name is "lan", "tsnet" or "funnel", for the logs.
+	name    string
+	addr    string
+	cleanup func() error
+	// readOnly serves the read-only interface of funnelServerConfig.
+	readOnly bool
+}
+
+// findListener returns the listener named name, nil when it is not opened.
+func findListener(listeners []*listener, name string) *listener {
+	for _, ln := range listeners {
+		if ln.name == name {
+			return ln
+		}
+	}
+	return nil
+}
+
+// prepareListeners opens the LAN listener, the tsnet one or both with
+// cfg.TsnetLAN. Serving both, a tailnet that cannot be joined only leaves
+// the LAN served.
+func prepareListeners(cfg *config.Config) ([]*listener, error) {
+	var listeners []*listener
+	if cfg.ServesLAN() {
 		ln, err := net.Listen("tcp", cfg.ListenAddr)
 		if err != nil {
-			return nil, nil, "", err
+			return nil, err
+		}
+		listeners = append(listeners, &listener{Listener: ln, name: "lan", addr: cfg.ListenAddr, cleanup: ln.Close})
+	}
+	if !cfg.TsnetEnabled {
+		return listeners, nil
+	}
+
+	tsnetListeners, err := listenTsnet(cfg)
+	if err != nil {
+		if len(listeners) == 0 {
+			return nil, err
 		}
-		return ln, ln.Close, cfg.ListenAddr, nil
+		log.Printf("tsnet listener unavailable, serving %s only: %v", cfg.ListenAddr, err)
+		return listeners, nil
 	}
+	return append(listeners, tsnetListeners...), nil
+}
 
+// listenTsnet opens the tailnet listener and, with cfg.TsnetFunnel, the
+// Funnel one. Funnel failing, for instance when the tailnet policy does not
+// allow it, only leaves the tailnet served.
+func listenTsnet(cfg *config.Config) ([]*listener, error) {
 	tsServer, err := tsnetserver.New(tsnetserver.Config{
 		Hostname: cfg.TsnetHostname,
 		Dir:      cfg.TsnetDir,
@@ -99,14 +592,148 @@ func prepareListener(cfg *config.Config) (net.Listener, func() error, string, er
 		Listen:   cfg.TsnetListenAddr,
 	})
 	if err != nil {
-		return nil, nil, "", err
+		return nil, err
 	}
 	ln, err := tsServer.Listen()
 	if err != nil {
 		tsServer.Close()
-		return nil, nil, "", err
+		return nil, err
+	}
+	listeners := []*listener{{Listener: ln, name: "tsnet", addr: cfg.TsnetListenAddr, cleanup: tsServer.Close}}
+	if !cfg.TsnetFunnel {
+		return listeners, nil
+	}
+	funnel, err := tsServer.ListenFunnel(cfg.TsnetFunnelAddr)
+	if err != nil {
+		log.Printf("funnel listener unavailable, serving the tailnet only: %v", err)
+		return listeners, nil
+	}
+	return append(listeners, &listener{Listener: funnel, name: "funnel", addr: cfg.TsnetFunnelAddr, cleanup: funnel.Close, readOnly: true}), nil
+}
+
+// funnelServerConfig derives from cfg the server answering Funnel, which
+// the holders of the share link built on shareToken reach: the statistics
+// only, read-only, without the accounts, the management endpoints nor the
+// update notice.
+func funnelServerConfig(cfg httpserver.Config, shareToken string) httpserver.Config {
+	cfg.ReadOnlyAccess = true
+	cfg.ShareToken = shareToken
+	cfg.Auth = nil
+	cfg.AdminToken = ""
+	cfg.SeparateAdmin = true
+	cfg.Updates = nil
+	return cfg
+}
+
+// prepareTLS returns the configuration serving HTTPS on the listener. The
+// certificate files are reloaded once renewed; a DNS-01 certificate is
+// obtained before returning and renewed until ctx is cancelled. With
+// cfg.TLSAutocert, the handler returned answers the HTTP-01 challenges and
+// redirects the other requests to HTTPS.
+func prepareTLS(ctx context.Context, cfg *config.Config) (*tls.Config, http.Handler, error) {
+	if cfg.TLSCertFile != "" {
+		cert, err := tlscert.NewFileCertificate(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		go cert.Run(ctx)
+		return cert.TLSConfig(), nil, nil
+	}
+	if cfg.TLSAutocert {
+		// The certificate is obtained on the first handshake, through a
+		// TLS-ALPN-01 challenge on the listener or an HTTP-01 one on
+		// cfg.ACMEHTTPAddr.
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.TLSDomain),
+			Cache:      autocert.DirCache(cfg.TLSDir),
+			Email:      cfg.ACMEEmail,
+		}
+		if cfg.ACMEDirectory != "" {
+			manager.Client = &acme.Client{DirectoryURL: cfg.ACMEDirectory}
+		}
+		tlsConfig := manager.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		return tlsConfig, manager.HTTPHandler(nil), nil
+	}
+
+	provider, err := tlscert.NewDNSProvider(cfg.ACMEDNSProvider, cfg.ACMECloudflareToken, cfg.ACMEDNSExec)
+	if err != nil {
+		return nil, nil, err
+	}
+	manager, err := tlscert.New(tlscert.Config{
+		Domain:       cfg.TLSDomain,
+		Email:        cfg.ACMEEmail,
+		DirectoryURL: cfg.ACMEDirectory,
+		CacheDir:     cfg.TLSDir,
+		Provider:     provider,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	obtainCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+	if err := manager.Ensure(obtainCtx); err != nil {
+		return nil, nil, err
+	}
+	go manager.Run(ctx)
+	return manager.TLSConfig(), nil, nil
+}
+
+// startMDNS advertises the listener on the LAN until ctx is cancelled. The
+// returned channel is closed once the goodbye packet has been sent. Networks
+// that block multicast only produce a log line.
+func startMDNS(ctx context.Context, cfg *config.Config, addr net.Addr) <-chan struct{} {
+	done := make(chan struct{})
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		log.Printf("mdns disabled: unsupported listener address %s", addr)
+		close(done)
+		return done
+	}
+	if tcpAddr.IP.IsLoopback() {
+		log.Printf("mdns: listener bound to loopback %s, LAN clients will not be able to connect", tcpAddr)
+	}
+	service := "_http._tcp"
+	if cfg.TLSEnabled() {
+		service = "_https._tcp"
+	}
+	responder, err := mdns.New(mdns.Config{
+		Hostname: cfg.MDNSHostname,
+		Service:  service,
+		Port:     tcpAddr.Port,
+	})
+	if err != nil {
+		log.Printf("mdns disabled: %v", err)
+		close(done)
+		return done
+	}
+	go func() {
+		defer close(done)
+		log.Printf("advertising %s on port %d via mdns", responder.Host(), tcpAddr.Port)
+		if err := responder.Run(ctx); err != nil {
+			log.Printf("mdns advertisement stopped: %v", err)
+		}
+	}()
+	return done
+}
+
+// logExposure warns when the HTTP listener is reachable from other machines,
+// louder when nothing stops them from changing the data.
+func logExposure(cfg *config.Config) {
+	if cfg.TsnetFunnel {
+		log.Printf("PELLETS_TSNET_FUNNEL is set, the statistics are published on the internet on %s to the holders of the share link /partage/<PELLETS_TSNET_FUNNEL_TOKEN>", cfg.TsnetFunnelAddr)
+	}
+	if !cfg.Exposed() {
+		return
+	}
+	if !cfg.AuthEnabled {
+		log.Printf("WARNING: %s is reachable from the network and authentication is disabled, anyone reaching it can modify the data; set PELLETS_AUTH_ENABLED=1 to require a login", cfg.ListenAddr)
+	}
+	if !cfg.ListenAll {
+		log.Printf("PELLETS_LISTEN_ADDR=%s is not a loopback address, the service is exposed to the network", cfg.ListenAddr)
 	}
-	return ln, tsServer.Close, cfg.TsnetListenAddr, nil
+	log.Printf("requests are not rate limited, put a reverse proxy in front of %s before exposing it beyond a trusted network", cfg.ListenAddr)
 }
 
 func switchUser(uid, gid int) error {
@@ -0,0 +1,216 @@
+// Package auth authenticates the users of the pellets tracker: it checks
+// their bcrypt-hashed passwords and keeps the sessions opened by the login
+// form, identified by a cookie.
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"pellets-tracker/internal/core"
+)
+
+// CookieName is the cookie holding the session token.
+const CookieName = "pellets_session"
+
+const (
+	// MinPasswordLength is the shortest accepted password.
+	MinPasswordLength = 8
+	// maxPasswordLength is the bcrypt input limit, longer passwords would be
+	// silently truncated.
+	maxPasswordLength = 72
+	defaultSessionTTL = 30 * 24 * time.Hour
+	tokenBytes        = 32
+)
+
+var (
+	// ErrPasswordTooShort rejects passwords below MinPasswordLength.
+	ErrPasswordTooShort = fmt.Errorf("password must be at least %d characters long", MinPasswordLength)
+	// ErrPasswordTooLong rejects passwords bcrypt cannot hash whole.
+	ErrPasswordTooLong = fmt.Errorf("password must be at most %d bytes long", maxPasswordLength)
+)
+
+// Config tunes the sessions and password hashing.
+type Config struct {
+	// SessionTTL is how long a session stays valid after the login, 30 days
+	// by default.
+	SessionTTL time.Duration
+	// BcryptCost is the hashing cost of new passwords, bcrypt.DefaultCost by
+	// default.
+	BcryptCost int
+}
+
+// Session is an authenticated user of the interface.
+type Session struct {
+	Token     string
+	UserID    core.ID
+	Username  string
+	ExpiresAt time.Time
+}
+
+// Manager hashes passwords and keeps the open sessions in memory: they are
+// lost when the server restarts and the users sign in again.
+type Manager struct {
+	ttl  time.Duration
+	cost int
+	// dummyHash is checked when the username is unknown so that a failed
+	// login takes the same time whether the user exists or not.
+	dummyHash []byte
+
+	mu       sync.Mutex
+	sessions map[string]Session
+	now      func() time.Time
+}
+
+// New builds a Manager from cfg.
+func New(cfg Config) (*Manager, error) {
+	if cfg.SessionTTL <= 0 {
+		cfg.SessionTTL = defaultSessionTTL
+	}
+	if cfg.BcryptCost == 0 {
+		cfg.BcryptCost = bcrypt.DefaultCost
+	}
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("pellets-tracker"), cfg.BcryptCost)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bcrypt cost: %w", err)
+	}
+	return &Manager{
+		ttl:       cfg.SessionTTL,
+		cost:      cfg.BcryptCost,
+		dummyHash: dummyHash,
+		sessions:  make(map[string]Session),
+		now:       time.Now,
+	}, nil
+}
+
+// HashPassword returns the bcrypt hash stored for password.
+func (m *Manager) HashPassword(password string) (string, error) {
+	switch {
+	case len([]rune(password)) < MinPasswordLength:
+		return "", ErrPasswordTooShort
+	case len(password) > maxPasswordLength:
+		return "", ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), m.cost)
+	if err != nil {
+		return "", fmt.Errorf("hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// Authenticate returns the user of users matching the credentials.
+func (m *Manager) Authenticate(users []core.User, username, password string) (core.User, bool) {
+	user, ok := core.FindUserByName(users, username)
+	if !ok {
+		_ = bcrypt.CompareHashAndPassword(m.dummyHash, []byte(password))
+		return core.User{}, false
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return core.User{}, false
+	}
+	return user, true
+}
+
+// Login opens a session for user.
+func (m *Manager) Login(user core.User) (Session, error) {
+	buf := make([]byte, tokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return Session{}, fmt.Errorf("generate session token: %w", err)
+	}
+	now := m.now()
+	session := Session{
+		Token:     base64.RawURLEncoding.EncodeToString(buf),
+		UserID:    user.ID,
+		Username:  user.Username,
+		ExpiresAt: now.Add(m.ttl),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for token, existing := range m.sessions {
+		if !now.Before(existing.ExpiresAt) {
+			delete(m.sessions, token)
+		}
+	}
+	m.sessions[session.Token] = session
+	return session, nil
+}
+
+// Session returns the open session of the request cookie.
+func (m *Manager) Session(r *http.Request) (Session, bool) {
+	cookie, err := r.Cookie(CookieName)
+	if err != nil || cookie.Value == "" {
+		return Session{}, false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[cookie.Value]
+	if !ok {
+		return Session{}, false
+	}
+	if !m.now().Before(session.ExpiresAt) {
+		delete(m.sessions, cookie.Value)
+		return Session{}, false
+	}
+	return session, true
+}
+
+// Logout closes the session identified by token.
+func (m *Manager) Logout(token string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, token)
+}
+
+// Revoke closes every session of a user, after a password change or its
+// deletion.
+func (m *Manager) Revoke(userID core.ID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for token, session := range m.sessions {
+		if session.UserID == userID {
+			delete(m.sessions, token)
+		}
+	}
+}
+
+// Cookie returns the cookie carrying session. secure restricts it to HTTPS
+// and should be set when the request came over TLS.
+func Cookie(session Session, secure bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     CookieName,
+		Value:    session.Token,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// ExpiredCookie returns the cookie removing the session from the browser.
+func ExpiredCookie(secure bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     CookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// IsPasswordError reports whether err rejects the password itself, so that
+// it can be shown to the user.
+func IsPasswordError(err error) bool {
+	return errors.Is(err, ErrPasswordTooShort) || errors.Is(err, ErrPasswordTooLong)
+}
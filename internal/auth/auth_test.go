@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"pellets-tracker/internal/core"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	manager, err := New(Config{SessionTTL: time.Hour, BcryptCost: bcrypt.MinCost})
+	require.NoError(t, err)
+	return manager
+}
+
+func TestManager_HashPassword(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		password string
+	}
+	type want struct {
+		err error
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "hashes the password", params: params{password: "granulés2024"}},
+		{name: "rejects short passwords", params: params{password: "poêle"}, want: want{err: ErrPasswordTooShort}},
+		{name: "rejects passwords bcrypt would truncate", params: params{password: strings.Repeat("a", 73)}, want: want{err: ErrPasswordTooLong}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			hash, err := newTestManager(t).HashPassword(tc.params.password)
+
+			assert.ErrorIs(t, err, tc.want.err, tc.name)
+			if tc.want.err == nil {
+				assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(hash), []byte(tc.params.password)), tc.name)
+			}
+		})
+	}
+}
+
+func TestManager_Authenticate(t *testing.T) {
+	t.Parallel()
+
+	manager := newTestManager(t)
+	hash, err := manager.HashPassword("granulés2024")
+	require.NoError(t, err)
+	users := []core.User{{Meta: core.Meta{ID: "user-a"}, Username: "alice", PasswordHash: hash}}
+
+	type params struct {
+		username string
+		password string
+	}
+	type want struct {
+		ok     bool
+		userID core.ID
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "accepts the password", params: params{username: "alice", password: "granulés2024"}, want: want{ok: true, userID: "user-a"}},
+		{name: "ignores the username case", params: params{username: " Alice", password: "granulés2024"}, want: want{ok: true, userID: "user-a"}},
+		{name: "rejects a wrong password", params: params{username: "alice", password: "granules2024"}},
+		{name: "rejects unknown users", params: params{username: "bob", password: "granulés2024"}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			user, ok := manager.Authenticate(users, tc.params.username, tc.params.password)
+
+			assert.Equal(t, tc.want.ok, ok, tc.name)
+			assert.Equal(t, tc.want.userID, user.ID, tc.name)
+		})
+	}
+}
+
+func TestManager_Session(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		cookie bool
+		token  string
+		elapse time.Duration
+		logout bool
+		revoke core.ID
+	}
+	type want struct {
+		ok bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "finds the session", params: params{cookie: true}, want: want{ok: true}},
+		{name: "requires the cookie", params: params{}},
+		{name: "rejects unknown tokens", params: params{cookie: true, token: "forged"}},
+		{name: "expires", params: params{cookie: true, elapse: time.Hour}},
+		{name: "closes on logout", params: params{cookie: true, logout: true}},
+		{name: "closes when the user is revoked", params: params{cookie: true, revoke: "user-a"}},
+		{name: "survives the revocation of another user", params: params{cookie: true, revoke: "user-b"}, want: want{ok: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			manager := newTestManager(t)
+			now := time.Date(2024, time.January, 10, 8, 0, 0, 0, time.UTC)
+			manager.now = func() time.Time { return now }
+			session, err := manager.Login(core.User{Meta: core.Meta{ID: "user-a"}, Username: "alice"})
+			require.NoError(t, err, tc.name)
+			if tc.params.logout {
+				manager.Logout(session.Token)
+			}
+			if tc.params.revoke != "" {
+				manager.Revoke(tc.params.revoke)
+			}
+			now = now.Add(tc.params.elapse)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.params.cookie {
+				cookie := Cookie(session, false)
+				if tc.params.token != "" {
+					cookie.Value = tc.params.token
+				}
+				req.AddCookie(cookie)
+			}
+			got, ok := manager.Session(req)
+
+			assert.Equal(t, tc.want.ok, ok, tc.name)
+			if tc.want.ok {
+				assert.Equal(t, session, got, tc.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"pellets-tracker/internal/core"
+)
+
+// apiTokenPrefix marks the API tokens so they are recognizable in scripts and
+// secret scanners.
+const apiTokenPrefix = "pt_"
+
+// NewAPIToken generates an API token and the hash stored in its place. The
+// token is random enough for a single SHA-256 to protect it, unlike
+// passwords.
+func NewAPIToken() (token, hash string, err error) {
+	buf := make([]byte, tokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("generate api token: %w", err)
+	}
+	token = apiTokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashAPIToken(token), nil
+}
+
+// HashAPIToken returns the hash stored for token.
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// FindAPIToken returns the token of tokens matching the bearer token.
+func FindAPIToken(tokens []core.APIToken, token string) (core.APIToken, bool) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return core.APIToken{}, false
+	}
+	hash := []byte(HashAPIToken(token))
+	for _, candidate := range tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(candidate.Hash)) == 1 {
+			return candidate, true
+		}
+	}
+	return core.APIToken{}, false
+}
+
+// BearerToken returns the token of the Authorization header of r.
+func BearerToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	token = strings.TrimSpace(token)
+	return token, ok && token != ""
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestFindAPIToken(t *testing.T) {
+	t.Parallel()
+
+	secret, hash, err := NewAPIToken()
+	require.NoError(t, err)
+	tokens := []core.APIToken{{Meta: core.Meta{ID: "token-a"}, UserID: "user-a", Name: "Téléphone", Hash: hash}}
+
+	type params struct {
+		token string
+	}
+	type want struct {
+		ok      bool
+		tokenID core.ID
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "finds the token", params: params{token: secret}, want: want{ok: true, tokenID: "token-a"}},
+		{name: "rejects another token", params: params{token: secret + "x"}},
+		{name: "rejects the stored hash", params: params{token: hash}},
+		{name: "rejects an empty token", params: params{token: ""}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			token, ok := FindAPIToken(tokens, tc.params.token)
+
+			assert.Equal(t, tc.want.ok, ok, tc.name)
+			assert.Equal(t, tc.want.tokenID, token.ID, tc.name)
+		})
+	}
+}
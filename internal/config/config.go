@@ -5,33 +5,235 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
+	"net"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds runtime configuration for the application.
 type Config struct {
-	DataFile           string
-	BackupDir          string
-	ListenAddr         string
-	TsnetEnabled       bool
-	TsnetDir           string
-	TsnetHostname      string
-	TsnetAuthKey       string
-	TsnetListenAddr    string
+	DataFile   string
+	BackupDir  string
+	ListenAddr string
+	// ListenAll binds every network interface instead of the loopback
+	// default, acknowledging that other machines can reach the service.
+	ListenAll bool
+	// DataFormat is the datastore encoding: pretty, compact or sections.
+	DataFormat string
+	// LenientLoad repairs the legacy and malformed records of the datastore
+	// file when it is opened instead of refusing it.
+	LenientLoad bool
+	// DebugAddr enables the pprof/expvar listener when set.
+	DebugAddr string
+	// AdminAddr enables a listener serving the management endpoints, which
+	// then leave the main listener.
+	AdminAddr    string
+	TsnetEnabled bool
+	// TsnetLAN keeps serving ListenAddr next to the tsnet listener, for the
+	// devices of the LAN that are not on the tailnet.
+	TsnetLAN        bool
+	TsnetDir        string
+	TsnetHostname   string
+	TsnetAuthKey    string
+	TsnetListenAddr string
+	// TsnetFunnel publishes a read-only copy of the interface on the
+	// internet through Tailscale Funnel, on TsnetFunnelAddr, to the holders
+	// of the share link built on TsnetFunnelToken.
+	TsnetFunnel        bool
+	TsnetFunnelAddr    string
+	TsnetFunnelToken   string
 	BrandImageMaxBytes int64
-	RunUID             *int
-	RunGID             *int
+	// BrandImageWidth is the width uploaded brand images are scaled down to,
+	// zero keeps them at their size; BrandImageQuality is their JPEG
+	// quality, from 1 to 100.
+	BrandImageWidth   int
+	BrandImageQuality int
+	// BrandImageFormat is the format brand images are stored in: auto, jpeg
+	// or png.
+	BrandImageFormat string
+	// AdminToken enables the admin-only endpoints when set.
+	AdminToken string
+	// WeightDecimals is the display precision of weights, nil for the default.
+	WeightDecimals *int
+	// ComputeTimeout bounds the statistics computed for one request, zero
+	// disables the limit.
+	ComputeTimeout time.Duration
+	// SlowSaveThreshold is the datastore save duration above which a warning
+	// is logged, zero disables it.
+	SlowSaveThreshold time.Duration
+	// ExportStallTimeout disconnects the clients that stop reading an export
+	// for that long, zero leaves the exports to the server write timeout.
+	ExportStallTimeout time.Duration
+	// CostingMethod values the consumptions and the stock: fifo, lifo or
+	// average.
+	CostingMethod string
+	// CSVFormat is the default preset of the CSV exports: standard or
+	// excel-fr.
+	CSVFormat string
+	// ChartMonths is the number of months the monthly chart of the stats
+	// shows, nil for the default and 0 for every month; ChartRollup is how a
+	// longer history is shortened: none, quarter or season.
+	ChartMonths *int
+	ChartRollup string
+	// TLSDomain enables HTTPS on ListenAddr with a certificate obtained
+	// through ACME DNS-01 challenges, or TLS-ALPN-01 and HTTP-01 ones with
+	// TLSAutocert.
+	TLSDomain   string
+	TLSDir      string
+	TLSAutocert bool
+	// ACMEHTTPAddr serves the HTTP-01 challenges of TLSAutocert and redirects
+	// the other requests to HTTPS.
+	ACMEHTTPAddr string
+	// TLSCertFile and TLSKeyFile enable HTTPS on ListenAddr with a
+	// certificate managed outside the application, reloaded when renewed.
+	TLSCertFile         string
+	TLSKeyFile          string
+	ACMEEmail           string
+	ACMEDirectory       string
+	ACMEDNSProvider     string
+	ACMECloudflareToken string
+	ACMEDNSExec         string
+	// MDNSEnabled advertises the service on the LAN as <MDNSHostname>.local.
+	MDNSEnabled  bool
+	MDNSHostname string
+	// UpdateCheck polls the GitHub releases of UpdateRepo for a newer version.
+	UpdateCheck bool
+	UpdateRepo  string
+	// LogExclude lists the request paths left out of the access log, sampled
+	// once every LogSampleEvery requests.
+	LogExclude     []string
+	LogSampleEvery int
+	RunUID         *int
+	RunGID         *int
+	// ErrorPagesDir holds custom 404.html, 405.html and 500.html pages that
+	// replace the built-in error pages.
+	ErrorPagesDir string
+	// AuthEnabled requires a signed-in user for every change to the data,
+	// sessions lasting SessionTTL.
+	AuthEnabled bool
+	SessionTTL  time.Duration
+	// AuthPrivate also requires a signed-in user to read the pages and the
+	// API once an account exists.
+	AuthPrivate bool
+	// WebhookURLs receive the new purchases and consumptions and the stock
+	// alerts as JSON events.
+	WebhookURLs []string
+	// NotifyDigest batches the webhook events that are not critical into a
+	// "daily" or "weekly" digest posted at NotifyDigestHour; empty posts
+	// every event at once.
+	NotifyDigest     string
+	NotifyDigestHour int
+	// SheetsWebhookURL, or SheetsSpreadsheetID written with the service
+	// account key found at SheetsCredentialsFile, receives the new purchases
+	// and consumptions as spreadsheet rows every SheetsInterval.
+	SheetsWebhookURL      string
+	SheetsSpreadsheetID   string
+	SheetsCredentialsFile string
+	SheetsInterval        time.Duration
+	// OCRURL, an OCR service receiving the photo, or OCRCommand, a local
+	// program such as tesseract reading it on its standard input, reads the
+	// delivery receipts that pre-fill the purchase form, each within
+	// OCRTimeout.
+	OCRURL     string
+	OCRCommand string
+	OCRTimeout time.Duration
+	// MarketPriceURL publishes a public pellet price index, fetched every
+	// MarketPriceInterval and stored one price per month. MarketPriceFormat
+	// is "json" or "csv"; MarketPriceMonthField and MarketPricePriceField
+	// name the properties or columns holding the month and the price per
+	// tonne in euros, and MarketPriceRecords the dotted path of the array of
+	// records in a JSON document.
+	MarketPriceURL        string
+	MarketPriceFormat     string
+	MarketPriceRecords    string
+	MarketPriceMonthField string
+	MarketPricePriceField string
+	MarketPriceInterval   time.Duration
+	// Retention is the number of years each kind of entry is kept, keyed by
+	// consumptions, audit, temperatures, occupancy or silo_readings; the
+	// older ones are purged every RetentionInterval.
+	Retention         map[string]int
+	RetentionInterval time.Duration
+	// CompactSeasons, when set, collapses the emptied purchases of the
+	// seasons ended more than CompactSeasons seasons ago, and their
+	// consumptions, into season summaries every RetentionInterval.
+	CompactSeasons int
+	// BackupRetention is the number of rotated backups kept, keyed by last,
+	// daily, weekly or monthly, the tiers missing keeping none; nil keeps
+	// the default policy of the store.
+	BackupRetention map[string]int
+	// RemoteBackupURL, a directory, an sftp:// or an s3:// URL, receives a
+	// compressed snapshot of the datastore at every time of the cron
+	// expression RemoteBackupSchedule. The SSH fields authenticate on an
+	// SFTP server and check its key, the S3 ones on an S3-compatible
+	// service.
+	RemoteBackupURL         string
+	RemoteBackupSchedule    string
+	RemoteBackupSSHKeyFile  string
+	RemoteBackupKnownHosts  string
+	RemoteBackupS3Endpoint  string
+	RemoteBackupS3Region    string
+	RemoteBackupS3AccessKey string
+	RemoteBackupS3SecretKey string
+	// Jobs is the cron expression of each scheduled job, keyed by backup,
+	// integrity, forecast, report or season_end; the jobs missing do not
+	// run.
+	Jobs map[string]string
+	// SMTPAddr, the host:port of an SMTP relay, sends the end-of-season
+	// report to ReportEmailTo from SMTPFrom, authenticated when
+	// SMTPUsername is set.
+	SMTPAddr      string
+	SMTPUsername  string
+	SMTPPassword  string
+	SMTPFrom      string
+	ReportEmailTo []string
 }
 
 const (
 	defaultDataFile           = "data/pellets.json"
 	defaultBackupDir          = "data/backups"
 	defaultListenAddr         = "127.0.0.1:8080"
+	allInterfacesListenAddr   = "0.0.0.0:8080"
 	defaultTsnetDir           = "data/tsnet"
 	defaultTsnetListen        = ":443"
+	defaultTsnetFunnelListen  = ":8443"
+	defaultTLSDir             = "data/tls"
+	defaultUpdateRepo         = "kevynb/pellet-tracking"
+	defaultLogExclude         = "/healthz,/static/"
 	defaultBrandImageMaxBytes = 5 * 1024 * 1024
+	defaultBrandImageWidth    = 800
+	defaultBrandImageQuality  = 85
+	// defaultComputeTimeout stays below the HTTP server write timeout so the
+	// 503 still reaches the client.
+	defaultComputeTimeout = 10 * time.Second
+	defaultSessionTTL     = 30 * 24 * time.Hour
+	// defaultSlowSaveThreshold is far above a healthy save, which takes a few
+	// milliseconds even on an SD card.
+	defaultSlowSaveThreshold = time.Second
+	// defaultExportStallTimeout leaves a phone switching networks time to
+	// resume reading.
+	defaultExportStallTimeout = 30 * time.Second
+	defaultNotifyDigestHour   = 8
+	defaultSheetsInterval     = 15 * time.Minute
+	defaultOCRTimeout         = 30 * time.Second
+	defaultMarketPriceFormat  = "json"
+	// defaultMarketPriceInterval matches the indices, published monthly at
+	// most.
+	defaultMarketPriceInterval = 24 * time.Hour
+	defaultRetentionInterval   = 24 * time.Hour
+	// defaultRemoteBackupSchedule pushes the backups every night at 3 am.
+	defaultRemoteBackupSchedule = "0 3 * * *"
+	// jobOff disables a job in PELLETS_JOBS.
+	jobOff = "off"
+	// minConsumptionRetention keeps the year before, replayed by the
+	// forecast.
+	minConsumptionRetention = 2
+	// maxWeightDecimals matches the gram resolution of stored weights.
+	maxWeightDecimals = 3
 )
 
 // Load builds a Config from environment variables, falling back to defaults
@@ -50,16 +252,81 @@ func Load() (*Config, error) {
 	}
 
 	cfg := &Config{
-		DataFile:        getEnv("PELLETS_DATA_FILE", defaultDataFile),
-		BackupDir:       getEnv("PELLETS_BACKUP_DIR", defaultBackupDir),
-		ListenAddr:      getEnv("PELLETS_LISTEN_ADDR", defaultListenAddr),
-		TsnetDir:        getEnv("PELLETS_TSNET_DIR", defaultTsnetDir),
-		TsnetHostname:   getEnv("PELLETS_TSNET_HOSTNAME", "pellets"),
-		TsnetListenAddr: getEnv("PELLETS_TSNET_LISTEN_ADDR", defaultTsnetListen),
-		TsnetAuthKey:    os.Getenv("PELLETS_TSNET_AUTHKEY"),
-		RunUID:          runUID,
-		RunGID:          runGID,
+		DataFile:         getEnv("PELLETS_DATA_FILE", defaultDataFile),
+		BackupDir:        getEnv("PELLETS_BACKUP_DIR", defaultBackupDir),
+		DataFormat:       getEnv("PELLETS_DATA_FORMAT", "pretty"),
+		CostingMethod:    getEnv("PELLETS_COSTING_METHOD", "fifo"),
+		CSVFormat:        getEnv("PELLETS_CSV_FORMAT", "standard"),
+		BrandImageFormat: getEnv("PELLETS_BRAND_IMAGE_FORMAT", "auto"),
+		ChartRollup:      getEnv("PELLETS_CHART_ROLLUP", "quarter"),
+		DebugAddr:        os.Getenv("PELLETS_DEBUG_ADDR"),
+		AdminAddr:        os.Getenv("PELLETS_ADMIN_ADDR"),
+		TsnetDir:         getEnv("PELLETS_TSNET_DIR", defaultTsnetDir),
+		TsnetHostname:    getEnv("PELLETS_TSNET_HOSTNAME", "pellets"),
+		TsnetListenAddr:  getEnv("PELLETS_TSNET_LISTEN_ADDR", defaultTsnetListen),
+		TsnetFunnelAddr:  getEnv("PELLETS_TSNET_FUNNEL_ADDR", defaultTsnetFunnelListen),
+		TsnetFunnelToken: os.Getenv("PELLETS_TSNET_FUNNEL_TOKEN"),
+		TsnetAuthKey:     os.Getenv("PELLETS_TSNET_AUTHKEY"),
+		AdminToken:       os.Getenv("PELLETS_ADMIN_TOKEN"),
+		RunUID:           runUID,
+		RunGID:           runGID,
+
+		TLSDomain:           os.Getenv("PELLETS_TLS_DOMAIN"),
+		TLSDir:              getEnv("PELLETS_TLS_DIR", defaultTLSDir),
+		ACMEHTTPAddr:        os.Getenv("PELLETS_ACME_HTTP_ADDR"),
+		TLSCertFile:         os.Getenv("PELLETS_TLS_CERT"),
+		TLSKeyFile:          os.Getenv("PELLETS_TLS_KEY"),
+		ACMEEmail:           os.Getenv("PELLETS_ACME_EMAIL"),
+		ACMEDirectory:       os.Getenv("PELLETS_ACME_DIRECTORY"),
+		ACMEDNSProvider:     os.Getenv("PELLETS_ACME_DNS_PROVIDER"),
+		ACMECloudflareToken: os.Getenv("PELLETS_ACME_CLOUDFLARE_API_TOKEN"),
+		ACMEDNSExec:         os.Getenv("PELLETS_ACME_DNS_EXEC"),
+
+		MDNSHostname: getEnv("PELLETS_MDNS_HOSTNAME", "pellets"),
+		UpdateRepo:   getEnv("PELLETS_UPDATE_REPO", defaultUpdateRepo),
+
+		ErrorPagesDir: os.Getenv("PELLETS_ERROR_PAGES_DIR"),
+		WebhookURLs:   splitList(os.Getenv("PELLETS_WEBHOOK_URLS")),
+
+		SheetsWebhookURL:      os.Getenv("PELLETS_SHEETS_WEBHOOK_URL"),
+		SheetsSpreadsheetID:   os.Getenv("PELLETS_SHEETS_SPREADSHEET_ID"),
+		SheetsCredentialsFile: os.Getenv("PELLETS_SHEETS_CREDENTIALS_FILE"),
+
+		OCRURL:     os.Getenv("PELLETS_OCR_URL"),
+		OCRCommand: os.Getenv("PELLETS_OCR_COMMAND"),
+
+		MarketPriceURL:        os.Getenv("PELLETS_MARKET_PRICE_URL"),
+		MarketPriceFormat:     getEnv("PELLETS_MARKET_PRICE_FORMAT", defaultMarketPriceFormat),
+		MarketPriceRecords:    os.Getenv("PELLETS_MARKET_PRICE_RECORDS"),
+		MarketPriceMonthField: getEnv("PELLETS_MARKET_PRICE_MONTH_FIELD", "month"),
+		MarketPricePriceField: getEnv("PELLETS_MARKET_PRICE_PRICE_FIELD", "price"),
+
+		RemoteBackupURL:         os.Getenv("PELLETS_REMOTE_BACKUP_URL"),
+		RemoteBackupSchedule:    getEnv("PELLETS_REMOTE_BACKUP_SCHEDULE", defaultRemoteBackupSchedule),
+		RemoteBackupSSHKeyFile:  os.Getenv("PELLETS_REMOTE_BACKUP_SSH_KEY_FILE"),
+		RemoteBackupKnownHosts:  os.Getenv("PELLETS_REMOTE_BACKUP_KNOWN_HOSTS"),
+		RemoteBackupS3Endpoint:  os.Getenv("PELLETS_REMOTE_BACKUP_S3_ENDPOINT"),
+		RemoteBackupS3Region:    os.Getenv("PELLETS_REMOTE_BACKUP_S3_REGION"),
+		RemoteBackupS3AccessKey: os.Getenv("PELLETS_REMOTE_BACKUP_S3_ACCESS_KEY"),
+		RemoteBackupS3SecretKey: os.Getenv("PELLETS_REMOTE_BACKUP_S3_SECRET_KEY"),
+
+		SMTPAddr:      os.Getenv("PELLETS_SMTP_ADDR"),
+		SMTPUsername:  os.Getenv("PELLETS_SMTP_USERNAME"),
+		SMTPPassword:  os.Getenv("PELLETS_SMTP_PASSWORD"),
+		SMTPFrom:      os.Getenv("PELLETS_SMTP_FROM"),
+		ReportEmailTo: splitList(os.Getenv("PELLETS_REPORT_EMAIL_TO")),
+	}
+
+	listenAll, err := getEnvBool("PELLETS_LISTEN_ALL")
+	if err != nil {
+		return nil, err
+	}
+	cfg.ListenAll = listenAll
+	listenAddr, err := resolveListenAddr(os.Getenv("PELLETS_LISTEN_ADDR"), listenAll)
+	if err != nil {
+		return nil, err
 	}
+	cfg.ListenAddr = listenAddr
 
 	brandImageMaxBytes, err := getEnvInt64("PELLETS_BRAND_IMAGE_MAX_BYTES", defaultBrandImageMaxBytes)
 	if err != nil {
@@ -67,15 +334,251 @@ func Load() (*Config, error) {
 	}
 	cfg.BrandImageMaxBytes = brandImageMaxBytes
 
-	if env := os.Getenv("PELLETS_TSNET_ENABLED"); env != "" {
-		switch env {
-		case "1", "true", "TRUE", "True", "yes", "YES":
-			cfg.TsnetEnabled = true
-		case "0", "false", "FALSE", "False", "no", "NO":
-			cfg.TsnetEnabled = false
-		default:
-			return nil, fmt.Errorf("invalid value for PELLETS_TSNET_ENABLED: %q", env)
+	weightDecimals, err := getEnvInt("PELLETS_WEIGHT_DECIMALS")
+	if err != nil {
+		return nil, err
+	}
+	if weightDecimals != nil && *weightDecimals > maxWeightDecimals {
+		return nil, fmt.Errorf("invalid value for PELLETS_WEIGHT_DECIMALS: must be between 0 and %d", maxWeightDecimals)
+	}
+	cfg.WeightDecimals = weightDecimals
+
+	chartMonths, err := getEnvInt("PELLETS_CHART_MONTHS")
+	if err != nil {
+		return nil, err
+	}
+	cfg.ChartMonths = chartMonths
+
+	switch cfg.DataFormat {
+	case "pretty", "compact", "sections":
+	default:
+		return nil, fmt.Errorf("invalid value for PELLETS_DATA_FORMAT: %q", cfg.DataFormat)
+	}
+
+	switch cfg.CostingMethod {
+	case "fifo", "lifo", "average":
+	default:
+		return nil, fmt.Errorf("invalid value for PELLETS_COSTING_METHOD: %q", cfg.CostingMethod)
+	}
+
+	switch cfg.CSVFormat {
+	case "standard", "excel-fr":
+	default:
+		return nil, fmt.Errorf("invalid value for PELLETS_CSV_FORMAT: %q", cfg.CSVFormat)
+	}
+
+	switch cfg.ChartRollup {
+	case "none", "quarter", "season":
+	default:
+		return nil, fmt.Errorf("invalid value for PELLETS_CHART_ROLLUP: %q", cfg.ChartRollup)
+	}
+
+	switch cfg.BrandImageFormat {
+	case "auto", "jpeg", "png":
+	default:
+		return nil, fmt.Errorf("invalid value for PELLETS_BRAND_IMAGE_FORMAT: %q", cfg.BrandImageFormat)
+	}
+
+	computeTimeout, err := getEnvDuration("PELLETS_COMPUTE_TIMEOUT", defaultComputeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ComputeTimeout = computeTimeout
+
+	slowSaveThreshold, err := getEnvDuration("PELLETS_SLOW_SAVE_THRESHOLD", defaultSlowSaveThreshold)
+	if err != nil {
+		return nil, err
+	}
+	cfg.SlowSaveThreshold = slowSaveThreshold
+
+	exportStallTimeout, err := getEnvDuration("PELLETS_EXPORT_STALL_TIMEOUT", defaultExportStallTimeout)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ExportStallTimeout = exportStallTimeout
+
+	tsnetEnabled, err := getEnvBool("PELLETS_TSNET_ENABLED")
+	if err != nil {
+		return nil, err
+	}
+	cfg.TsnetEnabled = tsnetEnabled
+
+	tsnetLAN, err := getEnvBool("PELLETS_TSNET_LAN")
+	if err != nil {
+		return nil, err
+	}
+	if tsnetLAN && !cfg.TsnetEnabled {
+		return nil, errors.New("PELLETS_TSNET_LAN requires PELLETS_TSNET_ENABLED")
+	}
+	cfg.TsnetLAN = tsnetLAN
+
+	tsnetFunnel, err := getEnvBool("PELLETS_TSNET_FUNNEL")
+	if err != nil {
+		return nil, err
+	}
+	if tsnetFunnel {
+		if !cfg.TsnetEnabled {
+			return nil, errors.New("PELLETS_TSNET_FUNNEL requires PELLETS_TSNET_ENABLED")
+		}
+		if err := validateFunnelAddr(cfg.TsnetFunnelAddr, cfg.TsnetListenAddr); err != nil {
+			return nil, err
+		}
+		if err := validateFunnelToken(cfg.TsnetFunnelToken); err != nil {
+			return nil, err
+		}
+	}
+	cfg.TsnetFunnel = tsnetFunnel
+
+	tlsAutocert, err := getEnvBool("PELLETS_TLS_AUTOCERT")
+	if err != nil {
+		return nil, err
+	}
+	cfg.TLSAutocert = tlsAutocert
+
+	mdnsEnabled, err := getEnvBool("PELLETS_MDNS_ENABLED")
+	if err != nil {
+		return nil, err
+	}
+	if mdnsEnabled && !cfg.ServesLAN() {
+		return nil, errors.New("PELLETS_MDNS_ENABLED cannot be combined with PELLETS_TSNET_ENABLED unless PELLETS_TSNET_LAN is set, the tsnet listener is not reachable on the LAN")
+	}
+	cfg.MDNSEnabled = mdnsEnabled
+
+	authEnabled, err := getEnvBool("PELLETS_AUTH_ENABLED")
+	if err != nil {
+		return nil, err
+	}
+	cfg.AuthEnabled = authEnabled
+	authPrivate, err := getEnvBool("PELLETS_AUTH_PRIVATE")
+	if err != nil {
+		return nil, err
+	}
+	if authPrivate && !cfg.AuthEnabled {
+		return nil, errors.New("PELLETS_AUTH_PRIVATE requires PELLETS_AUTH_ENABLED")
+	}
+	cfg.AuthPrivate = authPrivate
+	sessionTTL, err := getEnvDuration("PELLETS_SESSION_TTL", defaultSessionTTL)
+	if err != nil {
+		return nil, err
+	}
+	if sessionTTL == 0 {
+		return nil, errors.New("invalid value for PELLETS_SESSION_TTL: must be positive")
+	}
+	cfg.SessionTTL = sessionTTL
+
+	lenientLoad, err := getEnvBool("PELLETS_LENIENT_LOAD")
+	if err != nil {
+		return nil, err
+	}
+	cfg.LenientLoad = lenientLoad
+
+	updateCheck, err := getEnvBool("PELLETS_UPDATE_CHECK")
+	if err != nil {
+		return nil, err
+	}
+	cfg.UpdateCheck = updateCheck
+
+	logExclude, err := parseLogExclude(getEnv("PELLETS_LOG_EXCLUDE", defaultLogExclude))
+	if err != nil {
+		return nil, err
+	}
+	cfg.LogExclude = logExclude
+	logSampleEvery, err := getEnvInt("PELLETS_LOG_SAMPLE_EVERY")
+	if err != nil {
+		return nil, err
+	}
+	if logSampleEvery != nil {
+		cfg.LogSampleEvery = *logSampleEvery
+	}
+
+	notifyDigest, notifyDigestHour, err := parseNotifyDigest(os.Getenv("PELLETS_NOTIFY_DIGEST"), os.Getenv("PELLETS_NOTIFY_DIGEST_HOUR"))
+	if err != nil {
+		return nil, err
+	}
+	cfg.NotifyDigest = notifyDigest
+	cfg.NotifyDigestHour = notifyDigestHour
+
+	brandImageWidth, brandImageQuality, err := parseBrandImage(os.Getenv("PELLETS_BRAND_IMAGE_WIDTH"), os.Getenv("PELLETS_BRAND_IMAGE_QUALITY"))
+	if err != nil {
+		return nil, err
+	}
+	cfg.BrandImageWidth = brandImageWidth
+	cfg.BrandImageQuality = brandImageQuality
+
+	sheetsInterval, err := getEnvDuration("PELLETS_SHEETS_INTERVAL", defaultSheetsInterval)
+	if err != nil {
+		return nil, err
+	}
+	cfg.SheetsInterval = sheetsInterval
+
+	ocrTimeout, err := getEnvDuration("PELLETS_OCR_TIMEOUT", defaultOCRTimeout)
+	if err != nil {
+		return nil, err
+	}
+	cfg.OCRTimeout = ocrTimeout
+
+	marketPriceInterval, err := getEnvDuration("PELLETS_MARKET_PRICE_INTERVAL", defaultMarketPriceInterval)
+	if err != nil {
+		return nil, err
+	}
+	cfg.MarketPriceInterval = marketPriceInterval
+
+	retention, err := parseRetention(os.Getenv("PELLETS_RETENTION"))
+	if err != nil {
+		return nil, err
+	}
+	cfg.Retention = retention
+	compactSeasons, err := getEnvInt("PELLETS_COMPACT_SEASONS")
+	if err != nil {
+		return nil, err
+	}
+	if compactSeasons != nil {
+		if *compactSeasons < 1 {
+			return nil, errors.New("invalid value for PELLETS_COMPACT_SEASONS: must be at least 1")
 		}
+		cfg.CompactSeasons = *compactSeasons
+	}
+	backupRetention, err := parseBackupRetention(os.Getenv("PELLETS_BACKUP_RETENTION"))
+	if err != nil {
+		return nil, err
+	}
+	cfg.BackupRetention = backupRetention
+	retentionInterval, err := getEnvDuration("PELLETS_RETENTION_INTERVAL", defaultRetentionInterval)
+	if err != nil {
+		return nil, err
+	}
+	if retentionInterval < time.Minute {
+		return nil, errors.New("invalid value for PELLETS_RETENTION_INTERVAL: must be at least 1m")
+	}
+	cfg.RetentionInterval = retentionInterval
+	jobs, err := parseJobs(os.Getenv("PELLETS_JOBS"))
+	if err != nil {
+		return nil, err
+	}
+	cfg.Jobs = jobs
+
+	if err := validateTLS(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := validateSheets(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := validateOCR(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := validateMarketPrice(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := validateAdminAddr(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := validateSMTP(cfg); err != nil {
+		return nil, err
 	}
 
 	if err := ensurePaths(cfg); err != nil {
@@ -91,6 +594,241 @@ func Load() (*Config, error) {
 	return cfg, nil
 }
 
+// resolveListenAddr picks the HTTP listen address: the explicit
+// PELLETS_LISTEN_ADDR, every interface with PELLETS_LISTEN_ALL, or loopback.
+func resolveListenAddr(addr string, all bool) (string, error) {
+	switch {
+	case addr != "" && all:
+		return "", errors.New("PELLETS_LISTEN_ALL cannot be combined with PELLETS_LISTEN_ADDR, set only one of them")
+	case addr != "":
+		return addr, nil
+	case all:
+		return allInterfacesListenAddr, nil
+	default:
+		return defaultListenAddr, nil
+	}
+}
+
+// funnelPorts are the ports Tailscale Funnel accepts.
+var funnelPorts = []string{"443", "8443", "10000"}
+
+// validateFunnelAddr checks that addr is a port Funnel accepts, other than
+// the one of the tailnet listener.
+func validateFunnelAddr(addr, tailnetAddr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid PELLETS_TSNET_FUNNEL_ADDR %q: %w", addr, err)
+	}
+	if !slices.Contains(funnelPorts, port) {
+		return fmt.Errorf("invalid PELLETS_TSNET_FUNNEL_ADDR %q: Funnel only serves ports %s", addr, strings.Join(funnelPorts, ", "))
+	}
+	if _, tailnetPort, err := net.SplitHostPort(tailnetAddr); err == nil && tailnetPort == port {
+		return fmt.Errorf("invalid PELLETS_TSNET_FUNNEL_ADDR %q: port already used by PELLETS_TSNET_LISTEN_ADDR", addr)
+	}
+	return nil
+}
+
+// minFunnelTokenLength keeps the share link out of reach of guessing.
+const minFunnelTokenLength = 24
+
+// validateFunnelToken checks that token, the secret of the share link, is
+// long enough and made of the letters, digits, "-" and "_" a URL path keeps
+// as is.
+func validateFunnelToken(token string) error {
+	if len(token) < minFunnelTokenLength {
+		return fmt.Errorf("PELLETS_TSNET_FUNNEL requires a PELLETS_TSNET_FUNNEL_TOKEN of at least %d characters", minFunnelTokenLength)
+	}
+	for _, r := range token {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return fmt.Errorf("invalid PELLETS_TSNET_FUNNEL_TOKEN: only letters, digits, \"-\" and \"_\" are allowed, got %q", r)
+		}
+	}
+	return nil
+}
+
+// ServesLAN reports whether the server listens on ListenAddr, which it does
+// unless tsnet replaces it.
+func (c *Config) ServesLAN() bool {
+	return !c.TsnetEnabled || c.TsnetLAN
+}
+
+// Exposed reports whether the HTTP listener accepts connections from other
+// machines. The tsnet listener only answers the tailnet and is not exposed.
+func (c *Config) Exposed() bool {
+	return c.ServesLAN() && !isLoopbackAddr(c.ListenAddr)
+}
+
+// isLoopbackAddr reports whether addr only accepts connections from this
+// machine.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func validateTLS(cfg *Config) error {
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return errors.New("PELLETS_TLS_CERT and PELLETS_TLS_KEY must be set together")
+	}
+	if cfg.TLSCertFile != "" {
+		if cfg.TLSDomain != "" {
+			return errors.New("PELLETS_TLS_CERT cannot be combined with PELLETS_TLS_DOMAIN, set either a certificate or a domain to obtain one for")
+		}
+		if !cfg.ServesLAN() {
+			return errors.New("PELLETS_TLS_CERT cannot be combined with PELLETS_TSNET_ENABLED unless PELLETS_TSNET_LAN is set, tsnet provides its own certificates")
+		}
+		return nil
+	}
+	if cfg.TLSDomain == "" {
+		if cfg.TLSAutocert {
+			return errors.New("PELLETS_TLS_DOMAIN is required with PELLETS_TLS_AUTOCERT")
+		}
+		if cfg.ACMEHTTPAddr != "" {
+			return errors.New("PELLETS_ACME_HTTP_ADDR requires PELLETS_TLS_AUTOCERT")
+		}
+		return nil
+	}
+	if !cfg.ServesLAN() {
+		return errors.New("PELLETS_TLS_DOMAIN cannot be combined with PELLETS_TSNET_ENABLED unless PELLETS_TSNET_LAN is set, tsnet provides its own certificates")
+	}
+	if cfg.TLSAutocert {
+		if cfg.ACMEDNSProvider != "" {
+			return errors.New("PELLETS_TLS_AUTOCERT cannot be combined with PELLETS_ACME_DNS_PROVIDER, set only one of them")
+		}
+		if strings.HasPrefix(cfg.TLSDomain, "*.") {
+			return errors.New("PELLETS_TLS_AUTOCERT cannot obtain a wildcard certificate, use a PELLETS_ACME_DNS_PROVIDER")
+		}
+		if cfg.ACMEHTTPAddr != "" && cfg.ACMEHTTPAddr == cfg.ListenAddr {
+			return errors.New("PELLETS_ACME_HTTP_ADDR must differ from PELLETS_LISTEN_ADDR")
+		}
+		return nil
+	}
+	if cfg.ACMEHTTPAddr != "" {
+		return errors.New("PELLETS_ACME_HTTP_ADDR requires PELLETS_TLS_AUTOCERT")
+	}
+	switch cfg.ACMEDNSProvider {
+	case "cloudflare":
+		if cfg.ACMECloudflareToken == "" {
+			return errors.New("PELLETS_ACME_CLOUDFLARE_API_TOKEN is required with the cloudflare dns provider")
+		}
+	case "exec":
+		if cfg.ACMEDNSExec == "" {
+			return errors.New("PELLETS_ACME_DNS_EXEC is required with the exec dns provider")
+		}
+	case "":
+		return errors.New("PELLETS_ACME_DNS_PROVIDER or PELLETS_TLS_AUTOCERT is required when PELLETS_TLS_DOMAIN is set")
+	default:
+		return fmt.Errorf("invalid value for PELLETS_ACME_DNS_PROVIDER: %q", cfg.ACMEDNSProvider)
+	}
+	return nil
+}
+
+// TLSEnabled reports whether ListenAddr serves HTTPS.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSDomain != "" || c.TLSCertFile != ""
+}
+
+// validateSheets checks the spreadsheet export targets a single spreadsheet,
+// with the credentials the Google Sheets API requires.
+func validateSheets(cfg *Config) error {
+	if cfg.SheetsWebhookURL == "" && cfg.SheetsSpreadsheetID == "" {
+		return nil
+	}
+	if cfg.SheetsWebhookURL != "" && cfg.SheetsSpreadsheetID != "" {
+		return errors.New("PELLETS_SHEETS_WEBHOOK_URL cannot be combined with PELLETS_SHEETS_SPREADSHEET_ID, set only one of them")
+	}
+	if cfg.SheetsSpreadsheetID != "" && cfg.SheetsCredentialsFile == "" {
+		return errors.New("PELLETS_SHEETS_CREDENTIALS_FILE is required with PELLETS_SHEETS_SPREADSHEET_ID")
+	}
+	if cfg.SheetsInterval < time.Minute {
+		return errors.New("invalid value for PELLETS_SHEETS_INTERVAL: must be at least 1m")
+	}
+	return nil
+}
+
+// validateOCR checks a single OCR engine reads the delivery receipts.
+func validateOCR(cfg *Config) error {
+	if cfg.OCRURL == "" && cfg.OCRCommand == "" {
+		return nil
+	}
+	if cfg.OCRURL != "" && cfg.OCRCommand != "" {
+		return errors.New("PELLETS_OCR_URL cannot be combined with PELLETS_OCR_COMMAND, set only one of them")
+	}
+	if cfg.OCRTimeout <= 0 {
+		return errors.New("invalid value for PELLETS_OCR_TIMEOUT: must be positive")
+	}
+	return nil
+}
+
+// validateMarketPrice checks the price index is fetched over HTTP and parsed
+// from a format the integration reads.
+func validateMarketPrice(cfg *Config) error {
+	if cfg.MarketPriceURL == "" {
+		return nil
+	}
+	if !strings.HasPrefix(cfg.MarketPriceURL, "http://") && !strings.HasPrefix(cfg.MarketPriceURL, "https://") {
+		return fmt.Errorf("invalid value for PELLETS_MARKET_PRICE_URL: %q is not an http(s) URL", cfg.MarketPriceURL)
+	}
+	if cfg.MarketPriceFormat != "json" && cfg.MarketPriceFormat != "csv" {
+		return fmt.Errorf("invalid value for PELLETS_MARKET_PRICE_FORMAT: %q, expected json or csv", cfg.MarketPriceFormat)
+	}
+	if cfg.MarketPriceRecords != "" && cfg.MarketPriceFormat != "json" {
+		return errors.New("PELLETS_MARKET_PRICE_RECORDS only applies to the json format")
+	}
+	if cfg.MarketPriceInterval < time.Minute {
+		return errors.New("invalid value for PELLETS_MARKET_PRICE_INTERVAL: must be at least 1m")
+	}
+	return nil
+}
+
+// validateSMTP checks the end-of-season report has a relay, a sender and
+// recipients, or none of them.
+func validateSMTP(cfg *Config) error {
+	if cfg.SMTPAddr == "" && len(cfg.ReportEmailTo) == 0 {
+		if cfg.SMTPFrom != "" || cfg.SMTPUsername != "" {
+			return errors.New("PELLETS_SMTP_ADDR is required with the other PELLETS_SMTP_* variables")
+		}
+		return nil
+	}
+	switch {
+	case cfg.SMTPAddr == "":
+		return errors.New("PELLETS_SMTP_ADDR is required with PELLETS_REPORT_EMAIL_TO")
+	case len(cfg.ReportEmailTo) == 0:
+		return errors.New("PELLETS_REPORT_EMAIL_TO is required with PELLETS_SMTP_ADDR")
+	case cfg.SMTPFrom == "":
+		return errors.New("PELLETS_SMTP_FROM is required with PELLETS_SMTP_ADDR")
+	case cfg.SMTPPassword != "" && cfg.SMTPUsername == "":
+		return errors.New("PELLETS_SMTP_USERNAME is required with PELLETS_SMTP_PASSWORD")
+	}
+	if _, _, err := net.SplitHostPort(cfg.SMTPAddr); err != nil {
+		return fmt.Errorf("invalid value for PELLETS_SMTP_ADDR: %w", err)
+	}
+	return nil
+}
+
+// validateAdminAddr checks the admin listener has an address of its own.
+func validateAdminAddr(cfg *Config) error {
+	if cfg.AdminAddr == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(cfg.AdminAddr); err != nil {
+		return fmt.Errorf("invalid value for PELLETS_ADMIN_ADDR: %w", err)
+	}
+	if cfg.AdminAddr == cfg.DebugAddr {
+		return errors.New("PELLETS_ADMIN_ADDR must differ from PELLETS_DEBUG_ADDR, the admin listener already serves the debug endpoints")
+	}
+	if cfg.ServesLAN() && cfg.AdminAddr == cfg.ListenAddr {
+		return errors.New("PELLETS_ADMIN_ADDR must differ from PELLETS_LISTEN_ADDR")
+	}
+	return nil
+}
+
 func ensurePaths(cfg *Config) error {
 	if err := os.MkdirAll(filepath.Dir(cfg.DataFile), 0o755); err != nil {
 		return fmt.Errorf("ensure data dir: %w", err)
@@ -103,9 +841,192 @@ func ensurePaths(cfg *Config) error {
 			return fmt.Errorf("ensure tsnet dir: %w", err)
 		}
 	}
+	if cfg.TLSDomain != "" {
+		if err := os.MkdirAll(cfg.TLSDir, 0o700); err != nil {
+			return fmt.Errorf("ensure tls dir: %w", err)
+		}
+	}
 	return nil
 }
 
+// parseLogExclude reads the comma separated PELLETS_LOG_EXCLUDE paths; "-"
+// keeps every request in the log.
+func parseLogExclude(value string) ([]string, error) {
+	var paths []string
+	for _, path := range strings.Split(value, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" || path == "-" {
+			continue
+		}
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("invalid value for PELLETS_LOG_EXCLUDE: %q must start with /", path)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// parseNotifyDigest reads PELLETS_NOTIFY_DIGEST, "daily", "weekly" or empty,
+// and the hour of the day PELLETS_NOTIFY_DIGEST_HOUR the digest is sent at.
+func parseNotifyDigest(mode, hour string) (string, int, error) {
+	switch mode {
+	case "", "daily", "weekly":
+	default:
+		return "", 0, fmt.Errorf("invalid value for PELLETS_NOTIFY_DIGEST: %q", mode)
+	}
+	if hour == "" {
+		return mode, defaultNotifyDigestHour, nil
+	}
+	parsed, err := strconv.Atoi(hour)
+	if err != nil || parsed < 0 || parsed > 23 {
+		return "", 0, fmt.Errorf("invalid value for PELLETS_NOTIFY_DIGEST_HOUR: %q must be between 0 and 23", hour)
+	}
+	return mode, parsed, nil
+}
+
+// parseBrandImage reads the width brand images are scaled down to,
+// PELLETS_BRAND_IMAGE_WIDTH with 0 to keep their size, and their JPEG
+// quality PELLETS_BRAND_IMAGE_QUALITY.
+func parseBrandImage(width, quality string) (int, int, error) {
+	parsedWidth, parsedQuality := defaultBrandImageWidth, defaultBrandImageQuality
+	if width != "" {
+		value, err := strconv.Atoi(width)
+		if err != nil || value < 0 {
+			return 0, 0, fmt.Errorf("invalid value for PELLETS_BRAND_IMAGE_WIDTH: %q must be a positive number of pixels or 0", width)
+		}
+		parsedWidth = value
+	}
+	if quality != "" {
+		value, err := strconv.Atoi(quality)
+		if err != nil || value < 1 || value > 100 {
+			return 0, 0, fmt.Errorf("invalid value for PELLETS_BRAND_IMAGE_QUALITY: %q must be between 1 and 100", quality)
+		}
+		parsedQuality = value
+	}
+	return parsedWidth, parsedQuality, nil
+}
+
+// parseRetention reads PELLETS_RETENTION, a comma separated list of
+// entity=years such as "consumptions=10,audit=2".
+func parseRetention(value string) (map[string]int, error) {
+	var retention map[string]int
+	for _, item := range splitList(value) {
+		entity, years, ok := strings.Cut(item, "=")
+		entity = strings.TrimSpace(entity)
+		switch entity {
+		case "consumptions", "audit", "temperatures", "occupancy", "silo_readings":
+		default:
+			return nil, fmt.Errorf("invalid value for PELLETS_RETENTION: unknown entity %q", entity)
+		}
+		parsed, err := strconv.Atoi(strings.TrimSpace(years))
+		if !ok || err != nil || parsed < 1 {
+			return nil, fmt.Errorf("invalid value for PELLETS_RETENTION: %q must be a number of years", item)
+		}
+		if entity == "consumptions" && parsed < minConsumptionRetention {
+			return nil, fmt.Errorf("invalid value for PELLETS_RETENTION: consumptions must be kept at least %d years", minConsumptionRetention)
+		}
+		if _, ok := retention[entity]; ok {
+			return nil, fmt.Errorf("invalid value for PELLETS_RETENTION: %s is set twice", entity)
+		}
+		if retention == nil {
+			retention = make(map[string]int)
+		}
+		retention[entity] = parsed
+	}
+	return retention, nil
+}
+
+// parseBackupRetention reads PELLETS_BACKUP_RETENTION, a comma separated list
+// of tier=count such as last=3,daily=7,weekly=4,monthly=12.
+func parseBackupRetention(value string) (map[string]int, error) {
+	var retention map[string]int
+	total := 0
+	for _, item := range splitList(value) {
+		tier, count, ok := strings.Cut(item, "=")
+		tier = strings.TrimSpace(tier)
+		switch tier {
+		case "last", "daily", "weekly", "monthly":
+		default:
+			return nil, fmt.Errorf("invalid value for PELLETS_BACKUP_RETENTION: unknown tier %q", tier)
+		}
+		parsed, err := strconv.Atoi(strings.TrimSpace(count))
+		if !ok || err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid value for PELLETS_BACKUP_RETENTION: %q must be a number of backups", item)
+		}
+		if _, ok := retention[tier]; ok {
+			return nil, fmt.Errorf("invalid value for PELLETS_BACKUP_RETENTION: %s is set twice", tier)
+		}
+		if retention == nil {
+			retention = make(map[string]int)
+		}
+		retention[tier] = parsed
+		total += parsed
+	}
+	// Keeping no backup would remove each one as soon as it is written.
+	if retention != nil && total == 0 {
+		return nil, errors.New("invalid value for PELLETS_BACKUP_RETENTION: at least one backup must be kept")
+	}
+	return retention, nil
+}
+
+// defaultJobs are the schedules of the jobs PELLETS_JOBS does not set. The
+// report of the current season is written on demand only, unless
+// scheduled; the one of the season ended is compiled on May 1 at 8 am.
+var defaultJobs = map[string]string{
+	"backup":     "30 2 * * *",
+	"integrity":  "0 4 * * *",
+	"forecast":   "@hourly",
+	"report":     jobOff,
+	"season_end": "0 8 1 5 *",
+}
+
+// parseJobs reads PELLETS_JOBS, a semicolon separated list of job=schedule
+// such as "backup=0 */6 * * *;report=0 7 1 * *", the cron expressions
+// holding commas. A schedule of "off" disables the job. The schedules are
+// only checked by the scheduler.
+func parseJobs(value string) (map[string]string, error) {
+	jobs := make(map[string]string, len(defaultJobs))
+	for job, schedule := range defaultJobs {
+		jobs[job] = schedule
+	}
+	set := map[string]bool{}
+	for _, item := range strings.Split(value, ";") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		job, schedule, ok := strings.Cut(item, "=")
+		job, schedule = strings.TrimSpace(job), strings.TrimSpace(schedule)
+		if _, known := defaultJobs[job]; !known {
+			return nil, fmt.Errorf("invalid value for PELLETS_JOBS: unknown job %q", job)
+		}
+		if !ok || schedule == "" {
+			return nil, fmt.Errorf("invalid value for PELLETS_JOBS: %q must be job=schedule", item)
+		}
+		if set[job] {
+			return nil, fmt.Errorf("invalid value for PELLETS_JOBS: %s is set twice", job)
+		}
+		set[job] = true
+		jobs[job] = schedule
+	}
+	for job, schedule := range jobs {
+		if schedule == jobOff {
+			delete(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+// splitList reads a comma separated list, dropping the empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func getEnv(key, fallback string) string {
 	if val := os.Getenv(key); val != "" {
 		return val
@@ -141,6 +1062,31 @@ func getEnvInt(key string) (*int, error) {
 	return nil, nil
 }
 
+func getEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	if val := os.Getenv(key); val != "" {
+		parsed, err := time.ParseDuration(val)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+		if parsed < 0 {
+			return 0, fmt.Errorf("invalid value for %s: must be non-negative", key)
+		}
+		return parsed, nil
+	}
+	return fallback, nil
+}
+
+func getEnvBool(key string) (bool, error) {
+	switch env := os.Getenv(key); env {
+	case "", "0", "false", "FALSE", "False", "no", "NO":
+		return false, nil
+	case "1", "true", "TRUE", "True", "yes", "YES":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid value for %s: %q", key, env)
+	}
+}
+
 func ensureOwnership(cfg *Config) error {
 	uid := *cfg.RunUID
 	gid := *cfg.RunGID
@@ -160,6 +1106,11 @@ func ensureOwnership(cfg *Config) error {
 			return fmt.Errorf("chown tsnet dir: %w", err)
 		}
 	}
+	if cfg.TLSDomain != "" {
+		if err := os.Chown(cfg.TLSDir, uid, gid); err != nil {
+			return fmt.Errorf("chown tls dir: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -8,6 +8,7 @@ import (
 	"sync"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -333,3 +334,985 @@ func TestLoadRunIdentityChown(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateTLS(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		cfg Config
+	}
+	type want struct {
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "disabled without domain",
+		},
+		{
+			name:   "requires a provider",
+			params: params{cfg: Config{TLSDomain: "pellets.home.example.com"}},
+			want:   want{expectErr: true},
+		},
+		{
+			name: "rejects unknown provider",
+			params: params{cfg: Config{
+				TLSDomain:       "pellets.home.example.com",
+				ACMEDNSProvider: "route53",
+			}},
+			want: want{expectErr: true},
+		},
+		{
+			name: "requires cloudflare token",
+			params: params{cfg: Config{
+				TLSDomain:       "pellets.home.example.com",
+				ACMEDNSProvider: "cloudflare",
+			}},
+			want: want{expectErr: true},
+		},
+		{
+			name: "accepts cloudflare with token",
+			params: params{cfg: Config{
+				TLSDomain:           "pellets.home.example.com",
+				ACMEDNSProvider:     "cloudflare",
+				ACMECloudflareToken: "secret",
+			}},
+		},
+		{
+			name: "accepts exec hook",
+			params: params{cfg: Config{
+				TLSDomain:       "*.home.example.com",
+				ACMEDNSProvider: "exec",
+				ACMEDNSExec:     "/usr/local/bin/dns-hook",
+			}},
+		},
+		{
+			name: "rejects tsnet",
+			params: params{cfg: Config{
+				TLSDomain:       "pellets.home.example.com",
+				ACMEDNSProvider: "exec",
+				ACMEDNSExec:     "/usr/local/bin/dns-hook",
+				TsnetEnabled:    true,
+			}},
+			want: want{expectErr: true},
+		},
+		{
+			name: "accepts tsnet serving the lan too",
+			params: params{cfg: Config{
+				TLSDomain:       "pellets.home.example.com",
+				ACMEDNSProvider: "exec",
+				ACMEDNSExec:     "/usr/local/bin/dns-hook",
+				TsnetEnabled:    true,
+				TsnetLAN:        true,
+			}},
+		},
+		{
+			name: "accepts autocert",
+			params: params{cfg: Config{
+				TLSDomain:    "pellets.example.com",
+				TLSAutocert:  true,
+				ListenAddr:   ":443",
+				ACMEHTTPAddr: ":80",
+			}},
+		},
+		{
+			name:   "requires a domain for autocert",
+			params: params{cfg: Config{TLSAutocert: true}},
+			want:   want{expectErr: true},
+		},
+		{
+			name: "rejects autocert with a dns provider",
+			params: params{cfg: Config{
+				TLSDomain:       "pellets.example.com",
+				TLSAutocert:     true,
+				ACMEDNSProvider: "exec",
+				ACMEDNSExec:     "/usr/local/bin/dns-hook",
+			}},
+			want: want{expectErr: true},
+		},
+		{
+			name: "rejects an autocert wildcard",
+			params: params{cfg: Config{
+				TLSDomain:   "*.example.com",
+				TLSAutocert: true,
+			}},
+			want: want{expectErr: true},
+		},
+		{
+			name: "rejects the challenge listener on the https address",
+			params: params{cfg: Config{
+				TLSDomain:    "pellets.example.com",
+				TLSAutocert:  true,
+				ListenAddr:   ":443",
+				ACMEHTTPAddr: ":443",
+			}},
+			want: want{expectErr: true},
+		},
+		{
+			name: "rejects the challenge listener without autocert",
+			params: params{cfg: Config{
+				TLSDomain:       "pellets.home.example.com",
+				ACMEDNSProvider: "exec",
+				ACMEDNSExec:     "/usr/local/bin/dns-hook",
+				ACMEHTTPAddr:    ":80",
+			}},
+			want: want{expectErr: true},
+		},
+		{
+			name: "accepts certificate files",
+			params: params{cfg: Config{
+				TLSCertFile: "/etc/ssl/pellets.crt",
+				TLSKeyFile:  "/etc/ssl/pellets.key",
+			}},
+		},
+		{
+			name:   "requires the key with the certificate",
+			params: params{cfg: Config{TLSCertFile: "/etc/ssl/pellets.crt"}},
+			want:   want{expectErr: true},
+		},
+		{
+			name: "rejects certificate files with a domain",
+			params: params{cfg: Config{
+				TLSCertFile: "/etc/ssl/pellets.crt",
+				TLSKeyFile:  "/etc/ssl/pellets.key",
+				TLSDomain:   "pellets.example.com",
+				TLSAutocert: true,
+			}},
+			want: want{expectErr: true},
+		},
+		{
+			name: "rejects certificate files with tsnet",
+			params: params{cfg: Config{
+				TLSCertFile:  "/etc/ssl/pellets.crt",
+				TLSKeyFile:   "/etc/ssl/pellets.key",
+				TsnetEnabled: true,
+			}},
+			want: want{expectErr: true},
+		},
+		{
+			name: "accepts certificate files with tsnet serving the lan too",
+			params: params{cfg: Config{
+				TLSCertFile:  "/etc/ssl/pellets.crt",
+				TLSKeyFile:   "/etc/ssl/pellets.key",
+				TsnetEnabled: true,
+				TsnetLAN:     true,
+			}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := validateTLS(&tc.params.cfg)
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			assert.NoError(t, err, tc.name)
+		})
+	}
+}
+
+func TestValidateSheets(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		cfg Config
+	}
+	type want struct {
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "disabled without target",
+		},
+		{
+			name:   "accepts a webhook",
+			params: params{cfg: Config{SheetsWebhookURL: "https://example.com/rows", SheetsInterval: 15 * time.Minute}},
+		},
+		{
+			name: "accepts a spreadsheet with credentials",
+			params: params{cfg: Config{
+				SheetsSpreadsheetID:   "1AbC",
+				SheetsCredentialsFile: "/etc/pellets/sheets.json",
+				SheetsInterval:        time.Hour,
+			}},
+		},
+		{
+			name: "rejects both targets",
+			params: params{cfg: Config{
+				SheetsWebhookURL:      "https://example.com/rows",
+				SheetsSpreadsheetID:   "1AbC",
+				SheetsCredentialsFile: "/etc/pellets/sheets.json",
+				SheetsInterval:        time.Hour,
+			}},
+			want: want{expectErr: true},
+		},
+		{
+			name:   "requires credentials for a spreadsheet",
+			params: params{cfg: Config{SheetsSpreadsheetID: "1AbC", SheetsInterval: time.Hour}},
+			want:   want{expectErr: true},
+		},
+		{
+			name:   "rejects a short interval",
+			params: params{cfg: Config{SheetsWebhookURL: "https://example.com/rows", SheetsInterval: 10 * time.Second}},
+			want:   want{expectErr: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := validateSheets(&tc.params.cfg)
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			assert.NoError(t, err, tc.name)
+		})
+	}
+}
+
+func TestValidateOCR(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		cfg Config
+	}
+	type want struct {
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "disabled without engine",
+		},
+		{
+			name:   "accepts a service",
+			params: params{cfg: Config{OCRURL: "http://127.0.0.1:8884/ocr", OCRTimeout: time.Minute}},
+		},
+		{
+			name:   "accepts a command",
+			params: params{cfg: Config{OCRCommand: "tesseract stdin stdout -l fra", OCRTimeout: time.Minute}},
+		},
+		{
+			name:   "rejects both engines",
+			params: params{cfg: Config{OCRURL: "http://127.0.0.1:8884/ocr", OCRCommand: "tesseract stdin stdout", OCRTimeout: time.Minute}},
+			want:   want{expectErr: true},
+		},
+		{
+			name:   "rejects a zero timeout",
+			params: params{cfg: Config{OCRCommand: "tesseract stdin stdout"}},
+			want:   want{expectErr: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := validateOCR(&tc.params.cfg)
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			assert.NoError(t, err, tc.name)
+		})
+	}
+}
+
+func TestValidateMarketPrice(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		cfg Config
+	}
+	type want struct {
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "disabled without URL",
+		},
+		{
+			name:   "accepts a JSON index",
+			params: params{cfg: Config{MarketPriceURL: "https://example.com/index.json", MarketPriceFormat: "json", MarketPriceRecords: "data.prices", MarketPriceInterval: 24 * time.Hour}},
+		},
+		{
+			name:   "accepts a CSV index",
+			params: params{cfg: Config{MarketPriceURL: "https://example.com/index.csv", MarketPriceFormat: "csv", MarketPriceInterval: 24 * time.Hour}},
+		},
+		{
+			name:   "rejects a URL that is not http",
+			params: params{cfg: Config{MarketPriceURL: "file:///etc/index.json", MarketPriceFormat: "json", MarketPriceInterval: 24 * time.Hour}},
+			want:   want{expectErr: true},
+		},
+		{
+			name:   "rejects an unknown format",
+			params: params{cfg: Config{MarketPriceURL: "https://example.com/index.xml", MarketPriceFormat: "xml", MarketPriceInterval: 24 * time.Hour}},
+			want:   want{expectErr: true},
+		},
+		{
+			name:   "rejects a records path on a CSV index",
+			params: params{cfg: Config{MarketPriceURL: "https://example.com/index.csv", MarketPriceFormat: "csv", MarketPriceRecords: "data", MarketPriceInterval: 24 * time.Hour}},
+			want:   want{expectErr: true},
+		},
+		{
+			name:   "rejects a short interval",
+			params: params{cfg: Config{MarketPriceURL: "https://example.com/index.json", MarketPriceFormat: "json", MarketPriceInterval: time.Second}},
+			want:   want{expectErr: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := validateMarketPrice(&tc.params.cfg)
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			assert.NoError(t, err, tc.name)
+		})
+	}
+}
+
+func TestValidateSMTP(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		cfg Config
+	}
+	type want struct {
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "disabled without relay",
+		},
+		{
+			name:   "accepts a relay with recipients",
+			params: params{cfg: Config{SMTPAddr: "smtp.example.com:587", SMTPFrom: "pellets@example.com", ReportEmailTo: []string{"me@example.com"}}},
+		},
+		{
+			name:   "accepts credentials",
+			params: params{cfg: Config{SMTPAddr: "smtp.example.com:465", SMTPUsername: "pellets", SMTPPassword: "secret", SMTPFrom: "pellets@example.com", ReportEmailTo: []string{"me@example.com"}}},
+		},
+		{
+			name:   "rejects recipients without relay",
+			params: params{cfg: Config{SMTPFrom: "pellets@example.com", ReportEmailTo: []string{"me@example.com"}}},
+			want:   want{expectErr: true},
+		},
+		{
+			name:   "rejects a sender without relay",
+			params: params{cfg: Config{SMTPFrom: "pellets@example.com"}},
+			want:   want{expectErr: true},
+		},
+		{
+			name:   "rejects a relay without recipient",
+			params: params{cfg: Config{SMTPAddr: "smtp.example.com:587", SMTPFrom: "pellets@example.com"}},
+			want:   want{expectErr: true},
+		},
+		{
+			name:   "rejects a relay without sender",
+			params: params{cfg: Config{SMTPAddr: "smtp.example.com:587", ReportEmailTo: []string{"me@example.com"}}},
+			want:   want{expectErr: true},
+		},
+		{
+			name:   "rejects a password without username",
+			params: params{cfg: Config{SMTPAddr: "smtp.example.com:587", SMTPPassword: "secret", SMTPFrom: "pellets@example.com", ReportEmailTo: []string{"me@example.com"}}},
+			want:   want{expectErr: true},
+		},
+		{
+			name:   "rejects a relay without port",
+			params: params{cfg: Config{SMTPAddr: "smtp.example.com", SMTPFrom: "pellets@example.com", ReportEmailTo: []string{"me@example.com"}}},
+			want:   want{expectErr: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := validateSMTP(&tc.params.cfg)
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			assert.NoError(t, err, tc.name)
+		})
+	}
+}
+
+func TestParseLogExclude(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		value string
+	}
+	type want struct {
+		paths     []string
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "default", params: params{value: defaultLogExclude}, want: want{paths: []string{"/healthz", "/static/"}}},
+		{name: "trims entries", params: params{value: " /healthz , ,/metrics"}, want: want{paths: []string{"/healthz", "/metrics"}}},
+		{name: "dash disables exclusions", params: params{value: "-"}},
+		{name: "rejects relative path", params: params{value: "/healthz,static/"}, want: want{expectErr: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			paths, err := parseLogExclude(tc.params.value)
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.paths, paths, tc.name)
+		})
+	}
+}
+
+func TestParseNotifyDigest(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		mode string
+		hour string
+	}
+	type want struct {
+		mode      string
+		hour      int
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "disabled by default", want: want{hour: defaultNotifyDigestHour}},
+		{name: "daily at the default hour", params: params{mode: "daily"}, want: want{mode: "daily", hour: defaultNotifyDigestHour}},
+		{name: "weekly at a custom hour", params: params{mode: "weekly", hour: "19"}, want: want{mode: "weekly", hour: 19}},
+		{name: "rejects unknown modes", params: params{mode: "hourly"}, want: want{expectErr: true}},
+		{name: "rejects hours past 23", params: params{mode: "daily", hour: "24"}, want: want{expectErr: true}},
+		{name: "rejects non numeric hours", params: params{mode: "daily", hour: "8h"}, want: want{expectErr: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			mode, hour, err := parseNotifyDigest(tc.params.mode, tc.params.hour)
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.mode, mode, tc.name)
+			assert.Equal(t, tc.want.hour, hour, tc.name)
+		})
+	}
+}
+
+func TestParseRetention(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		value string
+	}
+	type want struct {
+		retention map[string]int
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "keeps everything by default"},
+		{
+			name:   "reads the years of each entity",
+			params: params{value: "consumptions=10, audit=2,silo_readings=5"},
+			want:   want{retention: map[string]int{"consumptions": 10, "audit": 2, "silo_readings": 5}},
+		},
+		{name: "rejects unknown entities", params: params{value: "purchases=10"}, want: want{expectErr: true}},
+		{name: "rejects a missing number of years", params: params{value: "audit"}, want: want{expectErr: true}},
+		{name: "rejects zero years", params: params{value: "audit=0"}, want: want{expectErr: true}},
+		{name: "keeps the consumptions of the forecast", params: params{value: "consumptions=1"}, want: want{expectErr: true}},
+		{name: "rejects an entity set twice", params: params{value: "audit=2,audit=3"}, want: want{expectErr: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			retention, err := parseRetention(tc.params.value)
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.retention, retention, tc.name)
+		})
+	}
+}
+
+func TestParseBackupRetention(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		value string
+	}
+	type want struct {
+		retention map[string]int
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "keeps the default policy"},
+		{
+			name:   "reads the count of each tier",
+			params: params{value: "last=5, daily=14,monthly=24"},
+			want:   want{retention: map[string]int{"last": 5, "daily": 14, "monthly": 24}},
+		},
+		{name: "accepts an empty tier", params: params{value: "last=0,weekly=8"}, want: want{retention: map[string]int{"last": 0, "weekly": 8}}},
+		{name: "rejects unknown tiers", params: params{value: "yearly=2"}, want: want{expectErr: true}},
+		{name: "rejects negative counts", params: params{value: "daily=-1"}, want: want{expectErr: true}},
+		{name: "rejects a missing count", params: params{value: "daily"}, want: want{expectErr: true}},
+		{name: "rejects keeping no backup", params: params{value: "last=0,daily=0"}, want: want{expectErr: true}},
+		{name: "rejects a tier set twice", params: params{value: "daily=7,daily=3"}, want: want{expectErr: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			retention, err := parseBackupRetention(tc.params.value)
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.retention, retention, tc.name)
+		})
+	}
+}
+
+func TestParseJobs(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		value string
+	}
+	type want struct {
+		jobs      map[string]string
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "keeps the default schedules",
+			want: want{jobs: map[string]string{"backup": "30 2 * * *", "integrity": "0 4 * * *", "forecast": "@hourly", "season_end": "0 8 1 5 *"}},
+		},
+		{
+			name:   "reads schedules holding commas",
+			params: params{value: "backup=0 2,14 * * *; report=0 7 1 * *"},
+			want:   want{jobs: map[string]string{"backup": "0 2,14 * * *", "integrity": "0 4 * * *", "forecast": "@hourly", "report": "0 7 1 * *", "season_end": "0 8 1 5 *"}},
+		},
+		{
+			name:   "disables a job",
+			params: params{value: "integrity=off;forecast=off;season_end=off"},
+			want:   want{jobs: map[string]string{"backup": "30 2 * * *"}},
+		},
+		{name: "rejects unknown jobs", params: params{value: "purge=@daily"}, want: want{expectErr: true}},
+		{name: "rejects a missing schedule", params: params{value: "backup"}, want: want{expectErr: true}},
+		{name: "rejects a job set twice", params: params{value: "backup=@daily;backup=@weekly"}, want: want{expectErr: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			jobs, err := parseJobs(tc.params.value)
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.jobs, jobs, tc.name)
+		})
+	}
+}
+
+func TestParseBrandImage(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		width   string
+		quality string
+	}
+	type want struct {
+		width     int
+		quality   int
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "uses the defaults", want: want{width: defaultBrandImageWidth, quality: defaultBrandImageQuality}},
+		{name: "parses custom values", params: params{width: "1600", quality: "95"}, want: want{width: 1600, quality: 95}},
+		{name: "keeps the size with a width of 0", params: params{width: "0"}, want: want{quality: defaultBrandImageQuality}},
+		{name: "rejects negative widths", params: params{width: "-1"}, want: want{expectErr: true}},
+		{name: "rejects non numeric widths", params: params{width: "800px"}, want: want{expectErr: true}},
+		{name: "rejects qualities past 100", params: params{quality: "101"}, want: want{expectErr: true}},
+		{name: "rejects a quality of 0", params: params{quality: "0"}, want: want{expectErr: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			width, quality, err := parseBrandImage(tc.params.width, tc.params.quality)
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.width, width, tc.name)
+			assert.Equal(t, tc.want.quality, quality, tc.name)
+		})
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		value string
+	}
+	type want struct {
+		items []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "empty", params: params{value: ""}},
+		{name: "single", params: params{value: "http://ha.local:8123/api/webhook/pellets"}, want: want{items: []string{"http://ha.local:8123/api/webhook/pellets"}}},
+		{name: "trims and skips blanks", params: params{value: " http://a , ,http://b"}, want: want{items: []string{"http://a", "http://b"}}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.want.items, splitList(tc.params.value), tc.name)
+		})
+	}
+}
+
+func TestResolveListenAddr(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		addr string
+		all  bool
+	}
+	type want struct {
+		addr      string
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "defaults to loopback", want: want{addr: defaultListenAddr}},
+		{name: "listens on all interfaces", params: params{all: true}, want: want{addr: "0.0.0.0:8080"}},
+		{name: "keeps the explicit address", params: params{addr: "192.168.1.10:9000"}, want: want{addr: "192.168.1.10:9000"}},
+		{name: "rejects both settings", params: params{addr: "127.0.0.1:9000", all: true}, want: want{expectErr: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			addr, err := resolveListenAddr(tc.params.addr, tc.params.all)
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			assert.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.addr, addr, tc.name)
+		})
+	}
+}
+
+func TestConfig_Exposed(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		cfg Config
+	}
+	type want struct {
+		exposed bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "loopback address", params: params{cfg: Config{ListenAddr: "127.0.0.1:8080"}}},
+		{name: "localhost", params: params{cfg: Config{ListenAddr: "localhost:8080"}}},
+		{name: "ipv6 loopback", params: params{cfg: Config{ListenAddr: "[::1]:8080"}}},
+		{name: "all interfaces", params: params{cfg: Config{ListenAddr: "0.0.0.0:8080"}}, want: want{exposed: true}},
+		{name: "empty host", params: params{cfg: Config{ListenAddr: ":8080"}}, want: want{exposed: true}},
+		{name: "lan address", params: params{cfg: Config{ListenAddr: "192.168.1.10:8080"}}, want: want{exposed: true}},
+		{name: "tsnet only answers the tailnet", params: params{cfg: Config{ListenAddr: "0.0.0.0:8080", TsnetEnabled: true}}},
+		{name: "tsnet next to the lan", params: params{cfg: Config{ListenAddr: "0.0.0.0:8080", TsnetEnabled: true, TsnetLAN: true}}, want: want{exposed: true}},
+		{name: "tsnet next to loopback", params: params{cfg: Config{ListenAddr: "127.0.0.1:8080", TsnetEnabled: true, TsnetLAN: true}}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.want.exposed, tc.params.cfg.Exposed(), tc.name)
+		})
+	}
+}
+
+func TestValidateAdminAddr(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		cfg Config
+	}
+	type want struct {
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "disabled without address",
+			params: params{cfg: Config{ListenAddr: "127.0.0.1:8080"}},
+		},
+		{
+			name:   "accepts an address of its own",
+			params: params{cfg: Config{ListenAddr: "0.0.0.0:8080", AdminAddr: "127.0.0.1:9090"}},
+		},
+		{
+			name:   "accepts the listen address when tsnet serves the main listener",
+			params: params{cfg: Config{ListenAddr: "127.0.0.1:8080", AdminAddr: "127.0.0.1:8080", TsnetEnabled: true}},
+		},
+		{
+			name:   "rejects the listen address when tsnet serves the lan too",
+			params: params{cfg: Config{ListenAddr: "127.0.0.1:8080", AdminAddr: "127.0.0.1:8080", TsnetEnabled: true, TsnetLAN: true}},
+			want:   want{expectErr: true},
+		},
+		{
+			name:   "rejects an address without port",
+			params: params{cfg: Config{ListenAddr: "127.0.0.1:8080", AdminAddr: "127.0.0.1"}},
+			want:   want{expectErr: true},
+		},
+		{
+			name:   "rejects the listen address",
+			params: params{cfg: Config{ListenAddr: "127.0.0.1:8080", AdminAddr: "127.0.0.1:8080"}},
+			want:   want{expectErr: true},
+		},
+		{
+			name:   "rejects the debug address",
+			params: params{cfg: Config{ListenAddr: "127.0.0.1:8080", DebugAddr: "127.0.0.1:6060", AdminAddr: "127.0.0.1:6060"}},
+			want:   want{expectErr: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := validateAdminAddr(&tc.params.cfg)
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			assert.NoError(t, err, tc.name)
+		})
+	}
+}
+
+func TestValidateFunnelAddr(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		addr        string
+		tailnetAddr string
+	}
+	type want struct {
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "accepts the default",
+			params: params{addr: defaultTsnetFunnelListen, tailnetAddr: defaultTsnetListen},
+		},
+		{
+			name:   "accepts 443 when the tailnet listener moved",
+			params: params{addr: ":443", tailnetAddr: ":8443"},
+		},
+		{
+			name:   "rejects a port funnel does not serve",
+			params: params{addr: ":8080", tailnetAddr: defaultTsnetListen},
+			want:   want{expectErr: true},
+		},
+		{
+			name:   "rejects the port of the tailnet listener",
+			params: params{addr: ":443", tailnetAddr: ":443"},
+			want:   want{expectErr: true},
+		},
+		{
+			name:   "rejects an address without port",
+			params: params{addr: "8443", tailnetAddr: defaultTsnetListen},
+			want:   want{expectErr: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := validateFunnelAddr(tc.params.addr, tc.params.tailnetAddr)
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			assert.NoError(t, err, tc.name)
+		})
+	}
+}
+
+func TestValidateFunnelToken(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		token string
+	}
+	type want struct {
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "accepts a random token",
+			params: params{token: "Xk3_9fQ-2mZpR7vLw8YtN4bD"},
+		},
+		{
+			name: "requires a token",
+			want: want{expectErr: true},
+		},
+		{
+			name:   "rejects a short token",
+			params: params{token: "proprietaire"},
+			want:   want{expectErr: true},
+		},
+		{
+			name:   "rejects characters a path would escape",
+			params: params{token: "Xk3/9fQ?2mZpR7vLw8YtN4bD"},
+			want:   want{expectErr: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := validateFunnelToken(tc.params.token)
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			assert.NoError(t, err, tc.name)
+		})
+	}
+}
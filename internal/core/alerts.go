@@ -0,0 +1,65 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StockAlert reports a stock that fell below its minimum.
+type StockAlert struct {
+	// BrandID and BrandName are empty for the alert on the whole stock.
+	BrandID   ID     `json:"brand_id,omitempty"`
+	BrandName string `json:"brand_name,omitempty"`
+	Bags      int    `json:"bags"`
+	MinBags   int    `json:"min_bags"`
+}
+
+// ComputeAlertes lists the stocks below their minimum: the whole stock
+// against ds.MinStockBags first, then each brand against its own
+// MinStockBags, by name.
+func ComputeAlertes(ctx context.Context, ds *DataStore) ([]StockAlert, error) {
+	if ds == nil {
+		return nil, nil
+	}
+
+	inventory, err := ComputeInventaire(ctx, ds, CostingFIFO)
+	if err != nil {
+		return nil, err
+	}
+	bags := make(map[ID]int, len(inventory.Brands))
+	for _, brand := range inventory.Brands {
+		bags[brand.BrandID] = brand.Bags
+	}
+
+	alerts := []StockAlert{}
+	if ds.MinStockBags > 0 && inventory.TotalBags < ds.MinStockBags {
+		alerts = append(alerts, StockAlert{Bags: inventory.TotalBags, MinBags: ds.MinStockBags})
+	}
+	var brandAlerts []StockAlert
+	for _, brand := range ds.Brands {
+		if brand.MinStockBags > 0 && bags[brand.ID] < brand.MinStockBags {
+			brandAlerts = append(brandAlerts, StockAlert{BrandID: brand.ID, BrandName: brand.Name, Bags: bags[brand.ID], MinBags: brand.MinStockBags})
+		}
+	}
+	sort.Slice(brandAlerts, func(i, j int) bool {
+		return strings.ToLower(brandAlerts[i].BrandName) < strings.ToLower(brandAlerts[j].BrandName)
+	})
+	return append(alerts, brandAlerts...), nil
+}
+
+// SetMinStockBags changes the minimum of the whole stock, zero disabling
+// the alert.
+func SetMinStockBags(ds *DataStore, bags int) error {
+	if ds == nil {
+		return errors.New("nil datastore")
+	}
+	if bags < 0 {
+		return ValidationErrors{}.AppendIf(true, "min_stock_bags", "minimum stock cannot be negative")
+	}
+	ds.MinStockBags = bags
+	touchDatastore(ds, time.Now().UTC())
+	return nil
+}
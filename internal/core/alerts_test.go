@@ -0,0 +1,121 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestComputeAlertes(t *testing.T) {
+	t.Parallel()
+
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2024, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	dataStore := func(global, woodstock, premium int) core.DataStore {
+		return core.DataStore{
+			MinStockBags: global,
+			Brands: []core.Brand{
+				{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock", MinStockBags: woodstock},
+				{Meta: core.Meta{ID: "brand-p"}, Name: "Premium", MinStockBags: premium},
+			},
+			Purchases: []core.Purchase{
+				{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: day(time.September, 1), Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 600, TotalPriceCents: 6000},
+			},
+			Consumptions: []core.Consumption{
+				{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: day(time.December, 1), Bags: 6},
+			},
+		}
+	}
+
+	type params struct {
+		ds core.DataStore
+	}
+	type want struct {
+		alerts []core.StockAlert
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "no thresholds",
+			params: params{ds: dataStore(0, 0, 0)},
+			want:   want{alerts: []core.StockAlert{}},
+		},
+		{
+			name:   "stock above the thresholds",
+			params: params{ds: dataStore(4, 3, 0)},
+			want:   want{alerts: []core.StockAlert{}},
+		},
+		{
+			name:   "whole stock first then brands by name",
+			params: params{ds: dataStore(20, 5, 2)},
+			want: want{alerts: []core.StockAlert{
+				{Bags: 4, MinBags: 20},
+				{BrandID: "brand-p", BrandName: "Premium", Bags: 0, MinBags: 2},
+				{BrandID: "brand-w", BrandName: "Woodstock", Bags: 4, MinBags: 5},
+			}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			alerts, err := core.ComputeAlertes(context.Background(), &tc.params.ds)
+
+			assert.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.alerts, alerts, tc.name)
+		})
+	}
+}
+
+func TestSetMinStockBags(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		bags int
+	}
+	type want struct {
+		err     error
+		minBags int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "sets the threshold", params: params{bags: 15}, want: want{minBags: 15}},
+		{name: "zero disables the alert", params: params{bags: 0}},
+		{
+			name:   "rejects negative thresholds",
+			params: params{bags: -1},
+			want: want{
+				err:     core.ValidationErrors{{Field: "min_stock_bags", Message: "minimum stock cannot be negative"}},
+				minBags: 8,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := core.DataStore{MinStockBags: 8}
+			err := core.SetMinStockBags(&ds, tc.params.bags)
+
+			assert.Equal(t, tc.want.err, err, tc.name)
+			assert.Equal(t, tc.want.minBags, ds.MinStockBags, tc.name)
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"errors"
+	"time"
+)
+
+// CreateAPITokenParams contains the fields required to create an API token.
+// The token is generated and hashed by the caller.
+type CreateAPITokenParams struct {
+	UserID ID
+	Name   string
+	Hash   string
+}
+
+// AddAPIToken records a new API token of a user.
+func AddAPIToken(ds *DataStore, params CreateAPITokenParams) (APIToken, error) {
+	if ds == nil {
+		return APIToken{}, errors.New("nil datastore")
+	}
+	if findUserIndex(ds.Users, params.UserID) == -1 {
+		return APIToken{}, ErrUserNotFound
+	}
+
+	name := NormalizeName(params.Name)
+	errs := ValidationErrors{}
+	errs = errs.AppendIf(name == "", "name", "name is required")
+	errs = errs.AppendIf(len(name) > MaxAPITokenNameLength, "name", "name is too long")
+	errs = errs.AppendIf(params.Hash == "", "hash", "hash is required")
+	if len(errs) > 0 {
+		return APIToken{}, errs
+	}
+
+	now := time.Now().UTC()
+	token := APIToken{
+		Meta: Meta{
+			ID:        NewID(),
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		UserID: params.UserID,
+		Name:   name,
+		Hash:   params.Hash,
+	}
+	ds.APITokens = append(ds.APITokens, token)
+	touchDatastore(ds, now)
+
+	return token, nil
+}
+
+// DeleteAPIToken revokes a token of a user. The tokens of other users are
+// reported as not found.
+func DeleteAPIToken(ds *DataStore, id, userID ID) error {
+	if ds == nil {
+		return errors.New("nil datastore")
+	}
+
+	for i, token := range ds.APITokens {
+		if token.ID != id || token.UserID != userID {
+			continue
+		}
+		ds.APITokens = append(ds.APITokens[:i], ds.APITokens[i+1:]...)
+		touchDatastore(ds, time.Now().UTC())
+		return nil
+	}
+	return ErrAPITokenNotFound
+}
+
+// UserAPITokens returns the tokens of a user, oldest first.
+func UserAPITokens(tokens []APIToken, userID ID) []APIToken {
+	owned := []APIToken{}
+	for _, token := range tokens {
+		if token.UserID == userID {
+			owned = append(owned, token)
+		}
+	}
+	return owned
+}
+
+func removeUserAPITokens(tokens []APIToken, userID ID) []APIToken {
+	kept := make([]APIToken, 0, len(tokens))
+	for _, token := range tokens {
+		if token.UserID != userID {
+			kept = append(kept, token)
+		}
+	}
+	return kept
+}
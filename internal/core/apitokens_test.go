@@ -0,0 +1,123 @@
+package core_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestAddAPIToken(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		input core.CreateAPITokenParams
+	}
+	type want struct {
+		err             error
+		validationField string
+		name            string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "adds a token",
+			params: params{input: core.CreateAPITokenParams{UserID: "user-a", Name: " HTTP  Shortcuts ", Hash: "hash"}},
+			want:   want{name: "HTTP Shortcuts"},
+		},
+		{
+			name:   "requires a name",
+			params: params{input: core.CreateAPITokenParams{UserID: "user-a", Hash: "hash"}},
+			want:   want{validationField: "name"},
+		},
+		{
+			name:   "rejects unknown users",
+			params: params{input: core.CreateAPITokenParams{UserID: "user-b", Name: "Téléphone", Hash: "hash"}},
+			want:   want{err: core.ErrUserNotFound},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := core.DataStore{Users: []core.User{{Meta: core.Meta{ID: "user-a"}, Username: "alice"}}}
+
+			token, err := core.AddAPIToken(&ds, tc.params.input)
+
+			if tc.want.err != nil || tc.want.validationField != "" {
+				if tc.want.err != nil {
+					assert.ErrorIs(t, err, tc.want.err, tc.name)
+				}
+				if tc.want.validationField != "" {
+					var ve core.ValidationErrors
+					assert.True(t, errors.As(err, &ve), tc.name)
+					assert.True(t, ve.Has(tc.want.validationField), tc.name)
+				}
+				assert.Empty(t, ds.APITokens, tc.name)
+				return
+			}
+			assert.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.name, token.Name, tc.name)
+			assert.Equal(t, []core.APIToken{token}, ds.APITokens, tc.name)
+		})
+	}
+}
+
+func TestDeleteAPIToken(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		id     core.ID
+		userID core.ID
+	}
+	type want struct {
+		err    error
+		tokens []core.ID
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "deletes a token of the user",
+			params: params{id: "token-a", userID: "user-a"},
+			want:   want{tokens: []core.ID{"token-b"}},
+		},
+		{
+			name:   "hides the tokens of other users",
+			params: params{id: "token-b", userID: "user-a"},
+			want:   want{err: core.ErrAPITokenNotFound, tokens: []core.ID{"token-a", "token-b"}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := core.DataStore{APITokens: []core.APIToken{
+				{Meta: core.Meta{ID: "token-a"}, UserID: "user-a", Name: "Téléphone", Hash: "a"},
+				{Meta: core.Meta{ID: "token-b"}, UserID: "user-b", Name: "Téléphone", Hash: "b"},
+			}}
+
+			err := core.DeleteAPIToken(&ds, tc.params.id, tc.params.userID)
+
+			assert.ErrorIs(t, err, tc.want.err, tc.name)
+			ids := []core.ID{}
+			for _, token := range ds.APITokens {
+				ids = append(ids, token.ID)
+			}
+			assert.Equal(t, tc.want.tokens, ids, tc.name)
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"sort"
+	"time"
+)
+
+// Actions and entities recorded in DataStore.Audit and in the changes
+// listed by DiffChanges. AuditActionReassign moves a purchase or a
+// consumption to another brand, AuditActionUndo reverts a change.
+const (
+	AuditActionCreate      = "create"
+	AuditActionUpdate      = "update"
+	AuditActionDelete      = "delete"
+	AuditActionReassign    = "reassign"
+	AuditActionUndo        = "undo"
+	AuditEntityTransfer    = "transfer"
+	AuditEntityPurchase    = "purchase"
+	AuditEntityConsumption = "consumption"
+)
+
+// recordAudit adds an audit entry, keeping the log newest first.
+func recordAudit(ds *DataStore, at time.Time, action, entity string, entityID ID, summary string) {
+	ds.Audit = append(ds.Audit, AuditEntry{
+		ID:       NewID(),
+		At:       at,
+		Action:   action,
+		Entity:   entity,
+		EntityID: entityID,
+		Summary:  summary,
+	})
+	sort.SliceStable(ds.Audit, func(i, j int) bool { return ds.Audit[i].At.After(ds.Audit[j].At) })
+}
+
+func brandNameIndex(brands []Brand) map[ID]string {
+	names := make(map[ID]string, len(brands))
+	for _, brand := range brands {
+		names[brand.ID] = brand.Name
+	}
+	return names
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BrandComparison gathers the figures used to choose a brand before ordering:
+// what was bought and at which price within the range, how the price moved,
+// and what is left in stock today.
+type BrandComparison struct {
+	BrandID      ID     `json:"brand_id"`
+	BrandName    string `json:"brand_name"`
+	LeadTimeDays int    `json:"lead_time_days,omitempty"`
+	Purchases    int    `json:"purchases"`
+	BagsBought   int    `json:"bags_bought"`
+	// WeightKg is the total weight bought.
+	WeightKg   float64 `json:"weight_kg"`
+	TotalSpent Money   `json:"total_spent_cents"`
+	// AverageBagPrice is weighted by the number of bags of each purchase.
+	AverageBagPrice Money `json:"average_bag_price_cents"`
+	PricePerKg      Money `json:"price_per_kg_cents"`
+	FirstBagPrice   Money `json:"first_bag_price_cents"`
+	LastBagPrice    Money `json:"last_bag_price_cents"`
+	// PriceTrendPercent is the change of the bag price between the first and
+	// the last purchase, nil with fewer than two purchases or a free first
+	// one.
+	PriceTrendPercent *float64  `json:"price_trend_percent,omitempty"`
+	FirstPurchaseAt   time.Time `json:"first_purchase_at"`
+	LastPurchaseAt    time.Time `json:"last_purchase_at"`
+	BagsConsumed      float64   `json:"bags_consumed"`
+	// BagsInStock is the current stock, whatever the range.
+	BagsInStock int `json:"bags_in_stock"`
+}
+
+// ComputeBrandComparison returns one line per brand, sorted by name. Purchases
+// and consumptions are counted within the range; a zero bound is open.
+func ComputeBrandComparison(ctx context.Context, ds *DataStore, from, to time.Time) ([]BrandComparison, error) {
+	if ds == nil {
+		return []BrandComparison{}, nil
+	}
+	inventory, err := ComputeInventaire(ctx, ds, CostingFIFO)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make(map[ID]*BrandComparison, len(ds.Brands))
+	weights := make(map[ID]Grams, len(ds.Brands))
+	bagPurchases := make(map[ID]int, len(ds.Brands))
+	bagsSpent := make(map[ID]Money, len(ds.Brands))
+	for _, brand := range ds.Brands {
+		lines[brand.ID] = &BrandComparison{BrandID: brand.ID, BrandName: brand.Name, LeadTimeDays: brand.LeadTimeDays}
+	}
+	for _, stock := range inventory.Brands {
+		if line, ok := lines[stock.BrandID]; ok {
+			line.BagsInStock = stock.Bags
+		}
+	}
+
+	purchases := append([]Purchase(nil), ds.Purchases...)
+	sort.SliceStable(purchases, func(i, j int) bool { return purchases[i].PurchasedAt.Before(purchases[j].PurchasedAt) })
+	for _, purchase := range purchases {
+		line, ok := lines[purchase.BrandID]
+		if !ok || !withinRange(purchase.PurchasedAt, from, to) {
+			continue
+		}
+		if line.Purchases == 0 {
+			line.FirstPurchaseAt = purchase.PurchasedAt
+		}
+		line.Purchases++
+		line.BagsBought += purchase.Bags
+		weights[purchase.BrandID] += GramsFromKg(purchase.TotalWeightKg)
+		line.TotalSpent += purchase.TotalPriceCents
+		line.LastPurchaseAt = purchase.PurchasedAt
+		// The bag prices leave out the bulk deliveries, priced per tonne.
+		if !purchase.IsBulk() {
+			if bagPurchases[purchase.BrandID] == 0 {
+				line.FirstBagPrice = purchase.UnitPriceCents
+			}
+			bagPurchases[purchase.BrandID]++
+			bagsSpent[purchase.BrandID] += purchase.TotalPriceCents
+			line.LastBagPrice = purchase.UnitPriceCents
+		}
+	}
+	for _, consumption := range ds.Consumptions {
+		if line, ok := lines[consumption.BrandID]; ok && withinRange(consumption.ConsumedAt, from, to) {
+			line.BagsConsumed += consumption.TotalBags()
+		}
+	}
+
+	comparison := make([]BrandComparison, 0, len(lines))
+	for _, brand := range ds.Brands {
+		line := lines[brand.ID]
+		line.WeightKg = weights[brand.ID].Kg()
+		line.AverageBagPrice = bagsSpent[brand.ID].DivInt(line.BagsBought)
+		if line.WeightKg > 0 {
+			line.PricePerKg = Money(int64(roundHalfEven(float64(line.TotalSpent) / line.WeightKg)))
+		}
+		if bagPurchases[brand.ID] > 1 {
+			line.PriceTrendPercent = percentChange(line.FirstBagPrice, line.LastBagPrice)
+		}
+		comparison = append(comparison, *line)
+	}
+	sort.SliceStable(comparison, func(i, j int) bool {
+		return strings.ToLower(comparison[i].BrandName) < strings.ToLower(comparison[j].BrandName)
+	})
+	return comparison, nil
+}
@@ -0,0 +1,94 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestComputeBrandComparison(t *testing.T) {
+	t.Parallel()
+
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	trend := func(value float64) *float64 { return &value }
+	ds := core.DataStore{
+		Brands: []core.Brand{
+			{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock", LeadTimeDays: 10},
+			{Meta: core.Meta{ID: "brand-b"}, Name: "bois énergie"},
+			{Meta: core.Meta{ID: "brand-n"}, Name: "Nouvelle"},
+		},
+		Purchases: []core.Purchase{
+			{Meta: core.Meta{ID: "p3"}, BrandID: "brand-w", PurchasedAt: day(2024, time.September, 1), Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 660, TotalPriceCents: 6600},
+			{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: day(2023, time.September, 1), Bags: 30, BagWeightKg: 15, TotalWeightKg: 450, UnitPriceCents: 600, TotalPriceCents: 18000},
+			{Meta: core.Meta{ID: "p2"}, BrandID: "brand-b", PurchasedAt: day(2023, time.October, 1), Bags: 20, BagWeightKg: 10, TotalWeightKg: 200, UnitPriceCents: 450, TotalPriceCents: 9000},
+		},
+		Consumptions: []core.Consumption{
+			{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: day(2023, time.December, 1), Bags: 25},
+			{Meta: core.Meta{ID: "c2"}, BrandID: "brand-b", ConsumedAt: day(2024, time.January, 1), Bags: 5},
+		},
+	}
+
+	type params struct {
+		from time.Time
+		to   time.Time
+	}
+	type want struct {
+		comparison []core.BrandComparison
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "compares every purchase",
+			want: want{comparison: []core.BrandComparison{
+				{
+					BrandID: "brand-b", BrandName: "bois énergie", Purchases: 1, BagsBought: 20, WeightKg: 200, TotalSpent: 9000,
+					AverageBagPrice: 450, PricePerKg: 45, FirstBagPrice: 450, LastBagPrice: 450,
+					FirstPurchaseAt: day(2023, time.October, 1), LastPurchaseAt: day(2023, time.October, 1), BagsConsumed: 5, BagsInStock: 15,
+				},
+				{BrandID: "brand-n", BrandName: "Nouvelle"},
+				{
+					BrandID: "brand-w", BrandName: "Woodstock", LeadTimeDays: 10, Purchases: 2, BagsBought: 40, WeightKg: 600, TotalSpent: 24600,
+					AverageBagPrice: 615, PricePerKg: 41, FirstBagPrice: 600, LastBagPrice: 660, PriceTrendPercent: trend(10),
+					FirstPurchaseAt: day(2023, time.September, 1), LastPurchaseAt: day(2024, time.September, 1), BagsConsumed: 25, BagsInStock: 15,
+				},
+			}},
+		},
+		{
+			name:   "restricts the purchases to the range",
+			params: params{from: day(2024, time.January, 1)},
+			want: want{comparison: []core.BrandComparison{
+				{BrandID: "brand-b", BrandName: "bois énergie", BagsConsumed: 5, BagsInStock: 15},
+				{BrandID: "brand-n", BrandName: "Nouvelle"},
+				{
+					BrandID: "brand-w", BrandName: "Woodstock", LeadTimeDays: 10, Purchases: 1, BagsBought: 10, WeightKg: 150, TotalSpent: 6600,
+					AverageBagPrice: 660, PricePerKg: 44, FirstBagPrice: 660, LastBagPrice: 660,
+					FirstPurchaseAt: day(2024, time.September, 1), LastPurchaseAt: day(2024, time.September, 1), BagsInStock: 15,
+				},
+			}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			data := ds
+			comparison, err := core.ComputeBrandComparison(context.Background(), &data, tc.params.from, tc.params.to)
+
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.comparison, comparison, tc.name)
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package core
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// BrandPricePoint is the bag price paid for one purchase of a brand.
+type BrandPricePoint struct {
+	PurchaseID  ID        `json:"purchase_id"`
+	PurchasedAt time.Time `json:"purchased_at"`
+	Bags        int       `json:"bags"`
+	BagWeightKg float64   `json:"bag_weight_kg"`
+	UnitPrice   Money     `json:"unit_price_cents"`
+	PricePerKg  Money     `json:"price_per_kg_cents"`
+	// MarketPricePerTonne is the market price of the month of the purchase,
+	// zero when the index does not cover it; MarketGapPercent is how much
+	// more than the market the purchase paid per tonne.
+	MarketPricePerTonne Money    `json:"market_price_per_tonne_cents,omitempty"`
+	MarketGapPercent    *float64 `json:"market_gap_percent,omitempty"`
+}
+
+// BrandYearPrice summarizes the purchases of a brand over a calendar year.
+type BrandYearPrice struct {
+	Year      int `json:"year"`
+	Purchases int `json:"purchases"`
+	Bags      int `json:"bags"`
+	// AverageBagPrice is weighted by the number of bags of each purchase.
+	AverageBagPrice Money `json:"average_bag_price_cents"`
+	// ChangePercent compares AverageBagPrice with the previous year holding
+	// purchases, nil for the first one.
+	ChangePercent *float64 `json:"change_percent,omitempty"`
+}
+
+// BrandPriceHistory is the evolution of the bag price of a brand, oldest
+// purchase first.
+type BrandPriceHistory struct {
+	BrandID   ID                `json:"brand_id"`
+	BrandName string            `json:"brand_name"`
+	Points    []BrandPricePoint `json:"points"`
+	Years     []BrandYearPrice  `json:"years"`
+	// TrendPercent is the change between the first and the last year holding
+	// purchases, nil with a single year.
+	TrendPercent *float64 `json:"trend_percent,omitempty"`
+	// Market is the market price index from the month of the first purchase
+	// to the last, to overlay on Points.
+	Market []MarketPrice `json:"market,omitempty"`
+	// MarketGapPercent compares the purchases the index covers with the
+	// market, weighted by the weight bought: positive when the brand cost
+	// more than the market.
+	MarketGapPercent *float64 `json:"market_gap_percent,omitempty"`
+}
+
+// ComputeBrandPriceHistory returns the price paid for each purchase of the
+// brand and the yearly averages, compared with the market price index when
+// the datastore holds one.
+func ComputeBrandPriceHistory(ds *DataStore, brandID ID) (BrandPriceHistory, error) {
+	if ds == nil {
+		return BrandPriceHistory{}, ErrBrandNotFound
+	}
+	idx := findBrandIndex(ds.Brands, brandID)
+	if idx < 0 {
+		return BrandPriceHistory{}, ErrBrandNotFound
+	}
+	history := BrandPriceHistory{
+		BrandID:   brandID,
+		BrandName: ds.Brands[idx].Name,
+		Points:    []BrandPricePoint{},
+		Years:     []BrandYearPrice{},
+	}
+
+	purchases := make([]Purchase, 0, len(ds.Purchases))
+	for _, purchase := range ds.Purchases {
+		if purchase.BrandID == brandID {
+			purchases = append(purchases, purchase)
+		}
+	}
+	sort.SliceStable(purchases, func(i, j int) bool { return purchases[i].PurchasedAt.Before(purchases[j].PurchasedAt) })
+
+	market := make(map[time.Time]Money, len(ds.MarketPrices))
+	for _, price := range ds.MarketPrices {
+		market[price.Month] = price.PricePerTonneCents
+	}
+	// paid and quoted total the purchases the index covers, priced as paid
+	// and at the market price.
+	var paid, quoted float64
+	spent := map[int]Money{}
+	for _, purchase := range purchases {
+		point := BrandPricePoint{
+			PurchaseID:  purchase.ID,
+			PurchasedAt: purchase.PurchasedAt,
+			Bags:        purchase.Bags,
+			BagWeightKg: purchase.BagWeightKg,
+			UnitPrice:   purchase.UnitPriceCents,
+		}
+		switch {
+		case purchase.IsBulk():
+			point.PricePerKg = Money(int64(roundHalfEven(float64(purchase.PricePerTonneCents) / 1000)))
+		case purchase.BagWeightKg > 0:
+			point.PricePerKg = Money(int64(roundHalfEven(float64(purchase.UnitPriceCents) / purchase.BagWeightKg)))
+		}
+		month := time.Date(purchase.PurchasedAt.Year(), purchase.PurchasedAt.Month(), 1, 0, 0, 0, 0, time.UTC)
+		if perTonne, weightKg := purchasePricePerTonne(purchase); market[month] > 0 && perTonne > 0 {
+			point.MarketPricePerTonne = market[month]
+			gap := roundHalfEven((perTonne/float64(market[month])-1)*1000) / 10
+			point.MarketGapPercent = &gap
+			paid += perTonne * weightKg
+			quoted += float64(market[month]) * weightKg
+		}
+		history.Points = append(history.Points, point)
+
+		year := purchase.PurchasedAt.Year()
+		if n := len(history.Years); n == 0 || history.Years[n-1].Year != year {
+			history.Years = append(history.Years, BrandYearPrice{Year: year})
+		}
+		line := &history.Years[len(history.Years)-1]
+		line.Purchases++
+		// Bulk deliveries have no bag price to average.
+		if !purchase.IsBulk() {
+			line.Bags += purchase.Bags
+			spent[year] += purchase.TotalPriceCents
+		}
+	}
+
+	for i := range history.Years {
+		line := &history.Years[i]
+		line.AverageBagPrice = spent[line.Year].DivInt(line.Bags)
+		if i > 0 {
+			line.ChangePercent = percentChange(history.Years[i-1].AverageBagPrice, line.AverageBagPrice)
+		}
+	}
+	if n := len(history.Years); n > 1 {
+		history.TrendPercent = percentChange(history.Years[0].AverageBagPrice, history.Years[n-1].AverageBagPrice)
+	}
+	if quoted > 0 {
+		gap := roundHalfEven((paid/quoted-1)*1000) / 10
+		history.MarketGapPercent = &gap
+	}
+	if n := len(purchases); n > 0 {
+		first, last := purchases[0].PurchasedAt.UTC(), purchases[n-1].PurchasedAt.UTC()
+		from := time.Date(first.Year(), first.Month(), 1, 0, 0, 0, 0, time.UTC)
+		to := time.Date(last.Year(), last.Month(), 1, 0, 0, 0, 0, time.UTC)
+		for _, price := range ds.MarketPrices {
+			if !price.Month.Before(from) && !price.Month.After(to) {
+				history.Market = append(history.Market, price)
+			}
+		}
+	}
+	return history, nil
+}
+
+// purchasePricePerTonne returns the price paid per tonne for a purchase, in
+// cents, and the weight bought; zero when the purchase does not tell its
+// weight.
+func purchasePricePerTonne(purchase Purchase) (float64, float64) {
+	if purchase.IsBulk() {
+		return float64(purchase.PricePerTonneCents), purchase.TotalWeightKg
+	}
+	if purchase.BagWeightKg <= 0 || purchase.Bags <= 0 {
+		return 0, 0
+	}
+	return float64(purchase.UnitPriceCents) / purchase.BagWeightKg * 1000, float64(purchase.Bags) * purchase.BagWeightKg
+}
+
+// percentChange returns the change from before to after in percent, rounded
+// to one decimal, or nil when before is zero.
+func percentChange(before, after Money) *float64 {
+	if before <= 0 {
+		return nil
+	}
+	change := roundHalfEven(float64(after-before)/float64(before)*1000) / 10
+	return &change
+}
+
+// BrandPriceMonth averages the bag prices paid for a brand in one month of
+// the year, the purchases of every year together.
+type BrandPriceMonth struct {
+	Month     time.Month `json:"month"`
+	Purchases int        `json:"purchases"`
+	Bags      int        `json:"bags"`
+	// AverageBagPrice is weighted by the number of bags of each purchase,
+	// zero for the months without any.
+	AverageBagPrice Money `json:"average_bag_price_cents"`
+}
+
+// BrandPriceCalendar lays the bag prices of a brand over the months of the
+// year, to tell when it was the cheapest to buy.
+type BrandPriceCalendar struct {
+	BrandID   ID     `json:"brand_id"`
+	BrandName string `json:"brand_name"`
+	// Months holds the twelve months from January.
+	Months []BrandPriceMonth `json:"months"`
+	// CheapestMonth has the lowest average bag price, the earliest one on a
+	// tie.
+	CheapestMonth time.Month `json:"cheapest_month"`
+}
+
+// ComputeBrandPriceCalendars returns the price calendar of every brand bought
+// in bags, sorted by brand name. Bulk deliveries have no bag price and are
+// left out.
+func ComputeBrandPriceCalendars(ds *DataStore) []BrandPriceCalendar {
+	if ds == nil {
+		return nil
+	}
+	type monthTotal struct {
+		purchases int
+		bags      int
+		spent     Money
+	}
+	totals := map[ID]*[12]monthTotal{}
+	for _, purchase := range ds.Purchases {
+		if purchase.IsBulk() || purchase.Bags <= 0 {
+			continue
+		}
+		months, ok := totals[purchase.BrandID]
+		if !ok {
+			months = &[12]monthTotal{}
+			totals[purchase.BrandID] = months
+		}
+		total := &months[purchase.PurchasedAt.Month()-1]
+		total.purchases++
+		total.bags += purchase.Bags
+		total.spent += purchase.TotalPriceCents
+	}
+
+	calendars := make([]BrandPriceCalendar, 0, len(totals))
+	for _, brand := range ds.Brands {
+		months, ok := totals[brand.ID]
+		if !ok {
+			continue
+		}
+		calendar := BrandPriceCalendar{BrandID: brand.ID, BrandName: brand.Name, Months: make([]BrandPriceMonth, 12)}
+		for i, total := range months {
+			month := BrandPriceMonth{Month: time.Month(i + 1), Purchases: total.purchases, Bags: total.bags}
+			if total.bags > 0 {
+				month.AverageBagPrice = total.spent.DivInt(total.bags)
+				if calendar.CheapestMonth == 0 || month.AverageBagPrice < calendar.Months[calendar.CheapestMonth-1].AverageBagPrice {
+					calendar.CheapestMonth = month.Month
+				}
+			}
+			calendar.Months[i] = month
+		}
+		calendars = append(calendars, calendar)
+	}
+	sort.SliceStable(calendars, func(i, j int) bool {
+		return strings.ToLower(calendars[i].BrandName) < strings.ToLower(calendars[j].BrandName)
+	})
+	return calendars
+}
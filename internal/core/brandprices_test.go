@@ -0,0 +1,207 @@
+package core_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestComputeBrandPriceHistory(t *testing.T) {
+	t.Parallel()
+
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	percent := func(value float64) *float64 { return &value }
+	ds := core.DataStore{
+		Brands: []core.Brand{
+			{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"},
+			{Meta: core.Meta{ID: "brand-n"}, Name: "Nouvelle"},
+		},
+		Purchases: []core.Purchase{
+			{Meta: core.Meta{ID: "p3"}, BrandID: "brand-w", PurchasedAt: day(2024, time.September, 1), Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 660, TotalPriceCents: 6600},
+			{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: day(2023, time.March, 1), Bags: 30, BagWeightKg: 15, TotalWeightKg: 450, UnitPriceCents: 580, TotalPriceCents: 17400},
+			{Meta: core.Meta{ID: "p2"}, BrandID: "brand-w", PurchasedAt: day(2023, time.October, 1), Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 620, TotalPriceCents: 6200},
+			{Meta: core.Meta{ID: "p4"}, BrandID: "brand-x", PurchasedAt: day(2024, time.October, 1), Bags: 5, BagWeightKg: 15, TotalWeightKg: 75, UnitPriceCents: 500, TotalPriceCents: 2500},
+		},
+	}
+
+	month := func(year int, month time.Month) time.Time { return day(year, month, 1) }
+	market := []core.MarketPrice{
+		{Month: month(2022, time.December), PricePerTonneCents: 39000},
+		{Month: month(2023, time.March), PricePerTonneCents: 40000},
+		{Month: month(2023, time.October), PricePerTonneCents: 41000},
+		{Month: month(2024, time.August), PricePerTonneCents: 42000},
+	}
+
+	type params struct {
+		brandID core.ID
+		market  []core.MarketPrice
+	}
+	type want struct {
+		err     error
+		history core.BrandPriceHistory
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "lists the prices and the yearly averages",
+			params: params{brandID: "brand-w"},
+			want: want{history: core.BrandPriceHistory{
+				BrandID:   "brand-w",
+				BrandName: "Woodstock",
+				Points: []core.BrandPricePoint{
+					{PurchaseID: "p1", PurchasedAt: day(2023, time.March, 1), Bags: 30, BagWeightKg: 15, UnitPrice: 580, PricePerKg: 39},
+					{PurchaseID: "p2", PurchasedAt: day(2023, time.October, 1), Bags: 10, BagWeightKg: 15, UnitPrice: 620, PricePerKg: 41},
+					{PurchaseID: "p3", PurchasedAt: day(2024, time.September, 1), Bags: 10, BagWeightKg: 15, UnitPrice: 660, PricePerKg: 44},
+				},
+				Years: []core.BrandYearPrice{
+					{Year: 2023, Purchases: 2, Bags: 40, AverageBagPrice: 590},
+					{Year: 2024, Purchases: 1, Bags: 10, AverageBagPrice: 660, ChangePercent: percent(11.9)},
+				},
+				TrendPercent: percent(11.9),
+			}},
+		},
+		{
+			name:   "compares the purchases with the market index",
+			params: params{brandID: "brand-w", market: market},
+			want: want{history: core.BrandPriceHistory{
+				BrandID:   "brand-w",
+				BrandName: "Woodstock",
+				Points: []core.BrandPricePoint{
+					{PurchaseID: "p1", PurchasedAt: day(2023, time.March, 1), Bags: 30, BagWeightKg: 15, UnitPrice: 580, PricePerKg: 39, MarketPricePerTonne: 40000, MarketGapPercent: percent(-3.3)},
+					{PurchaseID: "p2", PurchasedAt: day(2023, time.October, 1), Bags: 10, BagWeightKg: 15, UnitPrice: 620, PricePerKg: 41, MarketPricePerTonne: 41000, MarketGapPercent: percent(0.8)},
+					{PurchaseID: "p3", PurchasedAt: day(2024, time.September, 1), Bags: 10, BagWeightKg: 15, UnitPrice: 660, PricePerKg: 44},
+				},
+				Years: []core.BrandYearPrice{
+					{Year: 2023, Purchases: 2, Bags: 40, AverageBagPrice: 590},
+					{Year: 2024, Purchases: 1, Bags: 10, AverageBagPrice: 660, ChangePercent: percent(11.9)},
+				},
+				TrendPercent:     percent(11.9),
+				Market:           market[1:],
+				MarketGapPercent: percent(-2.3),
+			}},
+		},
+		{
+			name:   "returns empty series without purchases",
+			params: params{brandID: "brand-n"},
+			want: want{history: core.BrandPriceHistory{
+				BrandID:   "brand-n",
+				BrandName: "Nouvelle",
+				Points:    []core.BrandPricePoint{},
+				Years:     []core.BrandYearPrice{},
+			}},
+		},
+		{
+			name:   "reports unknown brands",
+			params: params{brandID: "brand-x"},
+			want:   want{err: core.ErrBrandNotFound},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := ds
+			ds.MarketPrices = tc.params.market
+			history, err := core.ComputeBrandPriceHistory(&ds, tc.params.brandID)
+
+			assert.ErrorIs(t, err, tc.want.err, tc.name)
+			assert.Equal(t, tc.want.history, history, tc.name)
+		})
+	}
+}
+
+func TestComputeBrandPriceCalendars(t *testing.T) {
+	t.Parallel()
+
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	months := func(prices map[time.Month]core.BrandPriceMonth) []core.BrandPriceMonth {
+		calendar := make([]core.BrandPriceMonth, 12)
+		for i := range calendar {
+			month := time.Month(i + 1)
+			calendar[i] = prices[month]
+			calendar[i].Month = month
+		}
+		return calendar
+	}
+
+	type params struct {
+		ds core.DataStore
+	}
+	type want struct {
+		calendars []core.BrandPriceCalendar
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "averages the prices of each month across the years",
+			params: params{ds: core.DataStore{
+				Brands: []core.Brand{
+					{Meta: core.Meta{ID: "brand-w"}, Name: "woodstock"},
+					{Meta: core.Meta{ID: "brand-a"}, Name: "Alpin"},
+					{Meta: core.Meta{ID: "brand-n"}, Name: "Nouvelle"},
+				},
+				Purchases: []core.Purchase{
+					{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: day(2023, time.May, 2), Bags: 30, BagWeightKg: 15, TotalWeightKg: 450, UnitPriceCents: 560, TotalPriceCents: 16800},
+					{Meta: core.Meta{ID: "p2"}, BrandID: "brand-w", PurchasedAt: day(2024, time.May, 20), Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 600, TotalPriceCents: 6000},
+					{Meta: core.Meta{ID: "p3"}, BrandID: "brand-w", PurchasedAt: day(2023, time.November, 5), Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 690, TotalPriceCents: 6900},
+					{Meta: core.Meta{ID: "p4"}, BrandID: "brand-a", PurchasedAt: day(2024, time.March, 1), Bags: 5, BagWeightKg: 15, TotalWeightKg: 75, UnitPriceCents: 500, TotalPriceCents: 2500},
+					{Meta: core.Meta{ID: "p5"}, BrandID: "brand-a", PurchasedAt: day(2024, time.September, 1), Bags: 5, BagWeightKg: 15, TotalWeightKg: 75, UnitPriceCents: 500, TotalPriceCents: 2500},
+					{Meta: core.Meta{ID: "p6"}, BrandID: "brand-n", PurchasedAt: day(2024, time.January, 1), TotalWeightKg: 3000, PricePerTonneCents: 38000, TotalPriceCents: 114000},
+				},
+			}},
+			want: want{calendars: []core.BrandPriceCalendar{
+				{
+					BrandID:   "brand-a",
+					BrandName: "Alpin",
+					Months: months(map[time.Month]core.BrandPriceMonth{
+						time.March:     {Purchases: 1, Bags: 5, AverageBagPrice: 500},
+						time.September: {Purchases: 1, Bags: 5, AverageBagPrice: 500},
+					}),
+					CheapestMonth: time.March,
+				},
+				{
+					BrandID:   "brand-w",
+					BrandName: "woodstock",
+					Months: months(map[time.Month]core.BrandPriceMonth{
+						time.May:      {Purchases: 2, Bags: 40, AverageBagPrice: 570},
+						time.November: {Purchases: 1, Bags: 10, AverageBagPrice: 690},
+					}),
+					CheapestMonth: time.May,
+				},
+			}},
+		},
+		{
+			name:   "returns no calendar without purchases",
+			params: params{ds: core.DataStore{Brands: []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}}}},
+			want:   want{calendars: []core.BrandPriceCalendar{}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			calendars := core.ComputeBrandPriceCalendars(&tc.params.ds)
+
+			assert.Equal(t, tc.want.calendars, calendars, tc.name)
+		})
+	}
+}
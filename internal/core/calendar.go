@@ -0,0 +1,78 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// monthLayout is the layout of a month in the queries, 2024-11.
+const monthLayout = "2006-01"
+
+// CalendarDay is the consumption of one day of the calendar.
+type CalendarDay struct {
+	Date time.Time `json:"date"`
+	Bags float64   `json:"bags"`
+	// Entries is the number of consumptions entered that day.
+	Entries int `json:"entries"`
+}
+
+// ConsumptionCalendar is the consumption of every day of a month.
+type ConsumptionCalendar struct {
+	Month     time.Time `json:"month"`
+	TotalBags float64   `json:"total_bags"`
+	// MaxBags is the consumption of the busiest day, the top of the color
+	// scale of the calendar.
+	MaxBags     float64       `json:"max_bags"`
+	HeatingDays int           `json:"heating_days"`
+	Days        []CalendarDay `json:"days"`
+}
+
+// ParseMonth reads a month such as 2024-11, returning its first day at
+// midnight UTC.
+func ParseMonth(value string) (time.Time, error) {
+	month, err := time.ParseInLocation(monthLayout, strings.TrimSpace(value), time.UTC)
+	if err != nil {
+		return time.Time{}, errors.New("month must be formatted as YYYY-MM, such as 2024-11")
+	}
+	return month, nil
+}
+
+// FormatMonth writes the month of t the way ParseMonth reads it.
+func FormatMonth(t time.Time) string {
+	return t.UTC().Format(monthLayout)
+}
+
+// ComputeConsumptionCalendar returns the bags consumed on each day of the
+// month holding month, in UTC like the dates entered in the forms. Every day
+// of the month is listed, with no bags when nothing was consumed.
+func ComputeConsumptionCalendar(ds *DataStore, month time.Time) ConsumptionCalendar {
+	month = month.UTC()
+	first := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	calendar := ConsumptionCalendar{Month: first}
+	for day := first; day.Month() == first.Month(); day = day.AddDate(0, 0, 1) {
+		calendar.Days = append(calendar.Days, CalendarDay{Date: day})
+	}
+	if ds == nil {
+		return calendar
+	}
+
+	for _, consumption := range ds.Consumptions {
+		day := startOfDay(consumption.ConsumedAt)
+		if day.Year() != first.Year() || day.Month() != first.Month() {
+			continue
+		}
+		entry := &calendar.Days[day.Day()-1]
+		entry.Bags += consumption.TotalBags()
+		entry.Entries++
+	}
+	for _, day := range calendar.Days {
+		if day.Entries == 0 {
+			continue
+		}
+		calendar.TotalBags += day.Bags
+		calendar.MaxBags = max(calendar.MaxBags, day.Bags)
+		calendar.HeatingDays++
+	}
+	return calendar
+}
@@ -0,0 +1,132 @@
+package core_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestComputeConsumptionCalendar(t *testing.T) {
+	t.Parallel()
+
+	day := func(month time.Month, d, hour int) time.Time {
+		return time.Date(2024, month, d, hour, 0, 0, 0, time.UTC)
+	}
+	ds := core.DataStore{
+		Consumptions: []core.Consumption{
+			{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: day(time.January, 31, 20), Bags: 4},
+			{Meta: core.Meta{ID: "c2"}, BrandID: "brand-w", ConsumedAt: day(time.February, 3, 8), Bags: 1},
+			{Meta: core.Meta{ID: "c3"}, BrandID: "brand-w", ConsumedAt: day(time.February, 3, 19), Bags: 1, BagsFraction: 0.5},
+			{Meta: core.Meta{ID: "c4"}, BrandID: "brand-w", ConsumedAt: day(time.February, 29, 9), Bags: 2},
+		},
+	}
+
+	type params struct {
+		datastore *core.DataStore
+		month     time.Time
+	}
+	type want struct {
+		days        int
+		totalBags   float64
+		maxBags     float64
+		heatingDays int
+		consumed    map[int]core.CalendarDay
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "sums the bags of each day",
+			params: params{datastore: &ds, month: day(time.February, 14, 12)},
+			want: want{
+				days:        29,
+				totalBags:   4.5,
+				maxBags:     2.5,
+				heatingDays: 2,
+				consumed: map[int]core.CalendarDay{
+					3:  {Date: day(time.February, 3, 0), Bags: 2.5, Entries: 2},
+					29: {Date: day(time.February, 29, 0), Bags: 2, Entries: 1},
+				},
+			},
+		},
+		{
+			name:   "lists the days of a month without consumption",
+			params: params{datastore: &ds, month: day(time.April, 1, 0)},
+			want:   want{days: 30, consumed: map[int]core.CalendarDay{}},
+		},
+		{
+			name:   "handles a nil datastore",
+			params: params{month: day(time.January, 1, 0)},
+			want:   want{days: 31, consumed: map[int]core.CalendarDay{}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			calendar := core.ComputeConsumptionCalendar(tc.params.datastore, tc.params.month)
+
+			first := time.Date(tc.params.month.Year(), tc.params.month.Month(), 1, 0, 0, 0, 0, time.UTC)
+			assert.Equal(t, first, calendar.Month, tc.name)
+			require.Len(t, calendar.Days, tc.want.days, tc.name)
+			assert.Equal(t, tc.want.totalBags, calendar.TotalBags, tc.name)
+			assert.Equal(t, tc.want.maxBags, calendar.MaxBags, tc.name)
+			assert.Equal(t, tc.want.heatingDays, calendar.HeatingDays, tc.name)
+			for i, got := range calendar.Days {
+				expected, ok := tc.want.consumed[i+1]
+				if !ok {
+					expected = core.CalendarDay{Date: first.AddDate(0, 0, i)}
+				}
+				assert.Equal(t, expected, got, tc.name)
+			}
+		})
+	}
+}
+
+func TestParseMonth(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		value string
+	}
+	type want struct {
+		month     time.Time
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "reads a month", params: params{value: "2024-11"}, want: want{month: time.Date(2024, time.November, 1, 0, 0, 0, 0, time.UTC)}},
+		{name: "rejects a day", params: params{value: "2024-11-05"}, want: want{expectErr: true}},
+		{name: "rejects an unknown month", params: params{value: "2024-13"}, want: want{expectErr: true}},
+		{name: "rejects an empty value", want: want{expectErr: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			month, err := core.ParseMonth(tc.params.value)
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.month, month, tc.name)
+			assert.Equal(t, tc.params.value, core.FormatMonth(month), tc.name)
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Change is a purchase or consumption created, updated or deleted by a
+// modification of the datastore. Purchase or Consumption holds the entry as
+// it was before the change, nil for a creation. PurchaseAfter or
+// ConsumptionAfter holds it as the change left it, nil for a deletion.
+type Change struct {
+	Action           string       `json:"action"`
+	Entity           string       `json:"entity"`
+	EntityID         ID           `json:"entity_id"`
+	Purchase         *Purchase    `json:"purchase,omitempty"`
+	Consumption      *Consumption `json:"consumption,omitempty"`
+	PurchaseAfter    *Purchase    `json:"-"`
+	ConsumptionAfter *Consumption `json:"-"`
+}
+
+// DiffChanges lists the purchases and consumptions created, updated or
+// deleted between before and after, purchases first.
+func DiffChanges(before, after *DataStore) []Change {
+	var changes []Change
+
+	purchases := make(map[ID]Purchase, len(before.Purchases))
+	for _, purchase := range before.Purchases {
+		purchases[purchase.ID] = purchase
+	}
+	for _, purchase := range after.Purchases {
+		purchase := purchase
+		previous, ok := purchases[purchase.ID]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Action: AuditActionCreate, Entity: AuditEntityPurchase, EntityID: purchase.ID, PurchaseAfter: &purchase})
+		case !reflect.DeepEqual(previous, purchase):
+			changes = append(changes, Change{Action: AuditActionUpdate, Entity: AuditEntityPurchase, EntityID: purchase.ID, Purchase: &previous, PurchaseAfter: &purchase})
+		}
+		delete(purchases, purchase.ID)
+	}
+	for _, purchase := range before.Purchases {
+		if _, deleted := purchases[purchase.ID]; deleted {
+			purchase := purchase
+			changes = append(changes, Change{Action: AuditActionDelete, Entity: AuditEntityPurchase, EntityID: purchase.ID, Purchase: &purchase})
+		}
+	}
+
+	consumptions := make(map[ID]Consumption, len(before.Consumptions))
+	for _, consumption := range before.Consumptions {
+		consumptions[consumption.ID] = consumption
+	}
+	for _, consumption := range after.Consumptions {
+		consumption := consumption
+		previous, ok := consumptions[consumption.ID]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Action: AuditActionCreate, Entity: AuditEntityConsumption, EntityID: consumption.ID, ConsumptionAfter: &consumption})
+		case previous != consumption:
+			changes = append(changes, Change{Action: AuditActionUpdate, Entity: AuditEntityConsumption, EntityID: consumption.ID, Consumption: &previous, ConsumptionAfter: &consumption})
+		}
+		delete(consumptions, consumption.ID)
+	}
+	for _, consumption := range before.Consumptions {
+		if _, deleted := consumptions[consumption.ID]; deleted {
+			consumption := consumption
+			changes = append(changes, Change{Action: AuditActionDelete, Entity: AuditEntityConsumption, EntityID: consumption.ID, Consumption: &consumption})
+		}
+	}
+
+	return changes
+}
+
+// RevertChanges applies the inverse of changes to ds, last change first:
+// created entries are deleted, updated entries get their previous version
+// back and deleted entries are recreated with their ID. Each revert is
+// recorded in the audit log. It fails with ErrConflict when an entry is no
+// longer as the change left it, saved since by another writer. Nothing is
+// applied when one of them fails, ds is only modified on success.
+func RevertChanges(ds *DataStore, changes []Change) error {
+	if ds == nil {
+		return errors.New("nil datastore")
+	}
+	reverted := *ds
+	reverted.Purchases = append([]Purchase(nil), ds.Purchases...)
+	reverted.Consumptions = append([]Consumption(nil), ds.Consumptions...)
+	reverted.Audit = append([]AuditEntry(nil), ds.Audit...)
+
+	now := time.Now().UTC()
+	for i := len(changes) - 1; i >= 0; i-- {
+		change := changes[i]
+		if err := checkUnchanged(&reverted, change); err != nil {
+			return err
+		}
+		var err error
+		switch {
+		case change.Action == AuditActionCreate && change.Entity == AuditEntityPurchase:
+			err = DeletePurchase(&reverted, change.EntityID)
+		case change.Action == AuditActionCreate && change.Entity == AuditEntityConsumption:
+			err = DeleteConsumption(&reverted, change.EntityID)
+		case change.Purchase != nil:
+			err = restorePurchase(&reverted, *change.Purchase)
+		case change.Consumption != nil:
+			err = restoreConsumption(&reverted, *change.Consumption)
+		default:
+			err = errors.New("change without the previous entry")
+		}
+		if err != nil {
+			return err
+		}
+		recordAudit(&reverted, now, AuditActionUndo, change.Entity, change.EntityID, describeUndo(change))
+	}
+
+	*ds = reverted
+	return nil
+}
+
+// checkUnchanged fails with ErrConflict when the entry of change is no
+// longer as the change left it.
+func checkUnchanged(ds *DataStore, change Change) error {
+	var current, after any
+	switch change.Entity {
+	case AuditEntityPurchase:
+		if idx := findPurchaseIndex(ds.Purchases, change.EntityID); idx != -1 {
+			current = ds.Purchases[idx]
+		}
+		if change.PurchaseAfter != nil {
+			after = *change.PurchaseAfter
+		}
+	case AuditEntityConsumption:
+		if idx := findConsumptionIndex(ds.Consumptions, change.EntityID); idx != -1 {
+			current = ds.Consumptions[idx]
+		}
+		if change.ConsumptionAfter != nil {
+			after = *change.ConsumptionAfter
+		}
+	}
+	if !reflect.DeepEqual(current, after) {
+		return fmt.Errorf("%s %s: %w", change.Entity, change.EntityID, ErrConflict)
+	}
+	return nil
+}
+
+// describeUndo summarizes a reverted change for the audit log.
+func describeUndo(change Change) string {
+	var at time.Time
+	switch {
+	case change.Purchase != nil:
+		at = change.Purchase.PurchasedAt
+	case change.PurchaseAfter != nil:
+		at = change.PurchaseAfter.PurchasedAt
+	case change.Consumption != nil:
+		at = change.Consumption.ConsumedAt
+	case change.ConsumptionAfter != nil:
+		at = change.ConsumptionAfter.ConsumedAt
+	}
+	return fmt.Sprintf("%s of %s of %s undone", change.Action, change.Entity, at.Format(time.DateOnly))
+}
+
+// restorePurchase puts purchase back as it was, replacing the entry with its
+// ID if any.
+func restorePurchase(ds *DataStore, purchase Purchase) error {
+	if !brandExists(ds.Brands, purchase.BrandID) {
+		return ValidationErrors{{Field: "brand_id", Message: "unknown brand"}}
+	}
+	if idx := findPurchaseIndex(ds.Purchases, purchase.ID); idx != -1 {
+		ds.Purchases[idx] = purchase
+	} else {
+		ds.Purchases = append(ds.Purchases, purchase)
+	}
+	sort.Slice(ds.Purchases, func(i, j int) bool {
+		if ds.Purchases[i].PurchasedAt.Equal(ds.Purchases[j].PurchasedAt) {
+			return string(ds.Purchases[i].ID) > string(ds.Purchases[j].ID)
+		}
+		return ds.Purchases[i].PurchasedAt.After(ds.Purchases[j].PurchasedAt)
+	})
+	touchDatastore(ds, time.Now().UTC())
+	return nil
+}
+
+// restoreConsumption puts consumption back as it was, replacing the entry
+// with its ID if any.
+func restoreConsumption(ds *DataStore, consumption Consumption) error {
+	if !brandExists(ds.Brands, consumption.BrandID) {
+		return ValidationErrors{{Field: "brand_id", Message: "unknown brand"}}
+	}
+	if idx := findConsumptionIndex(ds.Consumptions, consumption.ID); idx != -1 {
+		ds.Consumptions[idx] = consumption
+	} else {
+		ds.Consumptions = append(ds.Consumptions, consumption)
+	}
+	sort.Slice(ds.Consumptions, func(i, j int) bool {
+		if ds.Consumptions[i].ConsumedAt.Equal(ds.Consumptions[j].ConsumedAt) {
+			return string(ds.Consumptions[i].ID) > string(ds.Consumptions[j].ID)
+		}
+		return ds.Consumptions[i].ConsumedAt.After(ds.Consumptions[j].ConsumedAt)
+	})
+	touchDatastore(ds, time.Now().UTC())
+	return nil
+}
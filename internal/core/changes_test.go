@@ -0,0 +1,209 @@
+package core_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestDiffChanges(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2024, time.November, 1, 0, 0, 0, 0, time.UTC)
+	base := core.DataStore{
+		Brands:       []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}},
+		Purchases:    []core.Purchase{{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: at, Bags: 10}},
+		Consumptions: []core.Consumption{{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: at, Bags: 1}},
+	}
+	updated := base
+	updated.Consumptions = []core.Consumption{{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: at, Bags: 12}}
+	replaced := base
+	replaced.Purchases = []core.Purchase{{Meta: core.Meta{ID: "p2"}, BrandID: "brand-w", PurchasedAt: at, Bags: 5}}
+	renamed := base
+	renamed.Brands = []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock Premium"}}
+
+	type params struct {
+		after core.DataStore
+	}
+	type want struct {
+		changes []core.Change
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "records the previous version of an update",
+			params: params{after: updated},
+			want: want{changes: []core.Change{
+				{Action: core.AuditActionUpdate, Entity: core.AuditEntityConsumption, EntityID: "c1", Consumption: &base.Consumptions[0], ConsumptionAfter: &updated.Consumptions[0]},
+			}},
+		},
+		{
+			name:   "lists creations and deletions",
+			params: params{after: replaced},
+			want: want{changes: []core.Change{
+				{Action: core.AuditActionCreate, Entity: core.AuditEntityPurchase, EntityID: "p2", PurchaseAfter: &replaced.Purchases[0]},
+				{Action: core.AuditActionDelete, Entity: core.AuditEntityPurchase, EntityID: "p1", Purchase: &base.Purchases[0]},
+			}},
+		},
+		{
+			name:   "ignores the other entities",
+			params: params{after: renamed},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			changes := core.DiffChanges(&base, &tc.params.after)
+
+			assert.Equal(t, tc.want.changes, changes, tc.name)
+		})
+	}
+}
+
+func TestRevertChanges(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2024, time.November, 1, 0, 0, 0, 0, time.UTC)
+	brands := []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}}
+	p1 := core.Purchase{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: at, Bags: 10}
+	c1 := core.Consumption{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: at, Bags: 1}
+	c2 := core.Consumption{Meta: core.Meta{ID: "c2"}, BrandID: "brand-w", ConsumedAt: at.AddDate(0, 0, 1), Bags: 2}
+	mistyped := c1
+	mistyped.Bags = 12
+	retyped := c1
+	retyped.Bags = 13
+	orphan := p1
+	orphan.BrandID = "brand-x"
+
+	type params struct {
+		ds      core.DataStore
+		changes []core.Change
+	}
+	type want struct {
+		purchases    []core.ID
+		consumptions []core.Consumption
+		audit        []string
+		err          error
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "deletes a created entry",
+			params: params{
+				ds:      core.DataStore{Brands: brands, Purchases: []core.Purchase{p1}, Consumptions: []core.Consumption{c2, c1}},
+				changes: []core.Change{{Action: core.AuditActionCreate, Entity: core.AuditEntityConsumption, EntityID: "c2", ConsumptionAfter: &c2}},
+			},
+			want: want{purchases: []core.ID{"p1"}, consumptions: []core.Consumption{c1}, audit: []string{"create of consumption of 2024-11-02 undone"}},
+		},
+		{
+			name: "restores an update and a deletion in order",
+			params: params{
+				ds: core.DataStore{Brands: brands, Consumptions: []core.Consumption{mistyped}},
+				changes: []core.Change{
+					{Action: core.AuditActionUpdate, Entity: core.AuditEntityConsumption, EntityID: "c1", Consumption: &c1, ConsumptionAfter: &mistyped},
+					{Action: core.AuditActionDelete, Entity: core.AuditEntityConsumption, EntityID: "c2", Consumption: &c2},
+					{Action: core.AuditActionDelete, Entity: core.AuditEntityPurchase, EntityID: "p1", Purchase: &p1},
+				},
+			},
+			want: want{
+				purchases:    []core.ID{"p1"},
+				consumptions: []core.Consumption{c2, c1},
+				audit:        []string{"delete of purchase of 2024-11-01 undone", "delete of consumption of 2024-11-02 undone", "update of consumption of 2024-11-01 undone"},
+			},
+		},
+		{
+			name: "leaves the datastore untouched on failure",
+			params: params{
+				ds: core.DataStore{Brands: brands, Consumptions: []core.Consumption{mistyped}},
+				changes: []core.Change{
+					{Action: core.AuditActionUpdate, Entity: core.AuditEntityConsumption, EntityID: "c1", Consumption: &c1, ConsumptionAfter: &mistyped},
+					{Action: core.AuditActionDelete, Entity: core.AuditEntityPurchase, EntityID: "p1", Purchase: &orphan},
+				},
+			},
+			want: want{consumptions: []core.Consumption{mistyped}, err: core.ValidationErrors{{Field: "brand_id", Message: "unknown brand"}}},
+		},
+		{
+			name: "requires the brand of a restored entry",
+			params: params{
+				ds:      core.DataStore{},
+				changes: []core.Change{{Action: core.AuditActionDelete, Entity: core.AuditEntityPurchase, EntityID: "p1", Purchase: &p1}},
+			},
+			want: want{err: core.ValidationErrors{{Field: "brand_id", Message: "unknown brand"}}},
+		},
+		{
+			name: "refuses to overwrite an entry updated since",
+			params: params{
+				ds:      core.DataStore{Brands: brands, Consumptions: []core.Consumption{retyped}},
+				changes: []core.Change{{Action: core.AuditActionUpdate, Entity: core.AuditEntityConsumption, EntityID: "c1", Consumption: &c1, ConsumptionAfter: &mistyped}},
+			},
+			want: want{consumptions: []core.Consumption{retyped}, err: core.ErrConflict},
+		},
+		{
+			name: "refuses to delete a created entry updated since",
+			params: params{
+				ds:      core.DataStore{Brands: brands, Consumptions: []core.Consumption{retyped}},
+				changes: []core.Change{{Action: core.AuditActionCreate, Entity: core.AuditEntityConsumption, EntityID: "c1", ConsumptionAfter: &c1}},
+			},
+			want: want{consumptions: []core.Consumption{retyped}, err: core.ErrConflict},
+		},
+		{
+			name: "refuses to recreate an entry created again since",
+			params: params{
+				ds:      core.DataStore{Brands: brands, Purchases: []core.Purchase{p1}},
+				changes: []core.Change{{Action: core.AuditActionDelete, Entity: core.AuditEntityPurchase, EntityID: "p1", Purchase: &p1}},
+			},
+			want: want{purchases: []core.ID{"p1"}, err: core.ErrConflict},
+		},
+		{
+			name: "refuses to restore an entry deleted since",
+			params: params{
+				ds:      core.DataStore{Brands: brands},
+				changes: []core.Change{{Action: core.AuditActionUpdate, Entity: core.AuditEntityConsumption, EntityID: "c1", Consumption: &c1, ConsumptionAfter: &mistyped}},
+			},
+			want: want{err: core.ErrConflict},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := tc.params.ds
+			err := core.RevertChanges(&ds, tc.params.changes)
+			if errors.Is(tc.want.err, core.ErrConflict) {
+				assert.ErrorIs(t, err, tc.want.err, tc.name)
+			} else {
+				assert.Equal(t, tc.want.err, err, tc.name)
+			}
+
+			var purchases []core.ID
+			for _, purchase := range ds.Purchases {
+				purchases = append(purchases, purchase.ID)
+			}
+			assert.Equal(t, tc.want.purchases, purchases, tc.name)
+			assert.Equal(t, tc.want.consumptions, ds.Consumptions, tc.name)
+			var audit []string
+			for _, entry := range ds.Audit {
+				assert.Equal(t, core.AuditActionUndo, entry.Action, tc.name)
+				audit = append(audit, entry.Summary)
+			}
+			assert.Equal(t, tc.want.audit, audit, tc.name)
+		})
+	}
+}
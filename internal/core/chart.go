@@ -0,0 +1,105 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ChartRollup is how the monthly chart is shortened once the history spans
+// more months than it shows.
+type ChartRollup string
+
+const (
+	// ChartRollupNone keeps the most recent months only.
+	ChartRollupNone ChartRollup = "none"
+	// ChartRollupQuarter groups the whole history by calendar quarter.
+	ChartRollupQuarter ChartRollup = "quarter"
+	// ChartRollupSeason groups the whole history by heating season.
+	ChartRollupSeason ChartRollup = "season"
+)
+
+// Periods of the bars of the monthly chart, see MonthlyBags.Period.
+const (
+	PeriodQuarter = "quarter"
+	PeriodSeason  = "season"
+)
+
+// ErrUnknownChartRollup reports a chart rollup ParseChartRollup does not know.
+var ErrUnknownChartRollup = errors.New("unknown chart rollup")
+
+// ParseChartRollup reads a chart rollup name; an empty value is
+// ChartRollupQuarter.
+func ParseChartRollup(value string) (ChartRollup, error) {
+	switch rollup := ChartRollup(strings.ToLower(strings.TrimSpace(value))); rollup {
+	case "":
+		return ChartRollupQuarter, nil
+	case ChartRollupNone, ChartRollupQuarter, ChartRollupSeason:
+		return rollup, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownChartRollup, value)
+	}
+}
+
+// LimitSacsParMois shortens the result of ComputeSacsParMois when it spans
+// more than months calendar months: it keeps the last months with
+// ChartRollupNone, or adds the months up by quarter or by heating season.
+// A quarter keeps the same quarter of prior years; a season, which already
+// compares the years side by side, does not. months of zero or less keeps
+// every month.
+func LimitSacsParMois(monthly []MonthlyBags, months int, rollup ChartRollup) []MonthlyBags {
+	if months <= 0 || len(monthly) == 0 {
+		return monthly
+	}
+	first, last := monthly[0].Month, monthly[len(monthly)-1].Month
+	span := (last.Year()-first.Year())*12 + int(last.Month()-first.Month()) + 1
+	if span <= months {
+		return monthly
+	}
+
+	var period string
+	var periodStart func(time.Time) time.Time
+	switch rollup {
+	case ChartRollupQuarter, "":
+		period = PeriodQuarter
+		periodStart = func(month time.Time) time.Time {
+			return time.Date(month.Year(), (month.Month()-1)/3*3+1, 1, 0, 0, 0, 0, time.UTC)
+		}
+	case ChartRollupSeason:
+		period = PeriodSeason
+		periodStart = func(month time.Time) time.Time { return seasonStart(SeasonStartYear(month)) }
+	default:
+		cutoff := last.AddDate(0, 1-months, 0)
+		for i, entry := range monthly {
+			if !entry.Month.Before(cutoff) {
+				return monthly[i:]
+			}
+		}
+		return nil
+	}
+
+	var results []MonthlyBags
+	for _, entry := range monthly {
+		start := periodStart(entry.Month)
+		if len(results) == 0 || !results[len(results)-1].Month.Equal(start) {
+			results = append(results, MonthlyBags{Month: start, Period: period})
+		}
+		current := &results[len(results)-1]
+		current.Bags += entry.Bags
+		current.WeightKg = (GramsFromKg(current.WeightKg) + GramsFromKg(entry.WeightKg)).Kg()
+		if period != PeriodQuarter {
+			continue
+		}
+		// The months of a quarter share their year, and so their prior years.
+		for i, prior := range entry.PriorYears {
+			if i < len(current.PriorYears) {
+				current.PriorYears[i].Bags += prior.Bags
+				current.PriorYears[i].WeightKg = (GramsFromKg(current.PriorYears[i].WeightKg) + GramsFromKg(prior.WeightKg)).Kg()
+				continue
+			}
+			current.PriorYears = append(current.PriorYears, prior)
+		}
+	}
+	return results
+}
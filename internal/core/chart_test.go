@@ -0,0 +1,84 @@
+package core_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestLimitSacsParMois(t *testing.T) {
+	t.Parallel()
+
+	month := func(year int, m time.Month) time.Time {
+		return time.Date(year, m, 1, 0, 0, 0, 0, time.UTC)
+	}
+	monthly := []core.MonthlyBags{
+		{Month: month(2023, time.November), Bags: 10},
+		{Month: month(2023, time.December), Bags: 12},
+		{Month: month(2024, time.January), Bags: 14, PriorYears: []core.YearBags{{Year: 2023, Bags: 0}}},
+		{Month: month(2024, time.February), Bags: 8, PriorYears: []core.YearBags{{Year: 2023, Bags: 0}}},
+		{Month: month(2024, time.November), Bags: 9, PriorYears: []core.YearBags{{Year: 2023, Bags: 10}}},
+		{Month: month(2024, time.December), Bags: 11, PriorYears: []core.YearBags{{Year: 2023, Bags: 12}}},
+	}
+
+	type params struct {
+		months int
+		rollup core.ChartRollup
+	}
+	type want struct {
+		monthly []core.MonthlyBags
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "keeps a history within the limit",
+			params: params{months: 14, rollup: core.ChartRollupQuarter},
+			want:   want{monthly: monthly},
+		},
+		{
+			name:   "keeps every month without limit",
+			params: params{rollup: core.ChartRollupSeason},
+			want:   want{monthly: monthly},
+		},
+		{
+			name:   "keeps the last months",
+			params: params{months: 12, rollup: core.ChartRollupNone},
+			want:   want{monthly: monthly[2:]},
+		},
+		{
+			name:   "adds the months up by quarter",
+			params: params{months: 12, rollup: core.ChartRollupQuarter},
+			want: want{monthly: []core.MonthlyBags{
+				{Month: month(2023, time.October), Bags: 22, Period: core.PeriodQuarter},
+				{Month: month(2024, time.January), Bags: 22, Period: core.PeriodQuarter, PriorYears: []core.YearBags{{Year: 2023, Bags: 0}}},
+				{Month: month(2024, time.October), Bags: 20, Period: core.PeriodQuarter, PriorYears: []core.YearBags{{Year: 2023, Bags: 22}}},
+			}},
+		},
+		{
+			name:   "adds the months up by season",
+			params: params{months: 12, rollup: core.ChartRollupSeason},
+			want: want{monthly: []core.MonthlyBags{
+				{Month: month(2023, time.May), Bags: 44, Period: core.PeriodSeason},
+				{Month: month(2024, time.May), Bags: 20, Period: core.PeriodSeason},
+			}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := core.LimitSacsParMois(monthly, tc.params.months, tc.params.rollup)
+
+			assert.Equal(t, tc.want.monthly, got, tc.name)
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CostingMethod selects how the consumed bags and the remaining stock are
+// valued. The zero value behaves as FIFO.
+type CostingMethod string
+
+const (
+	// CostingFIFO takes the bags from the oldest lots, at their price.
+	CostingFIFO CostingMethod = "fifo"
+	// CostingLIFO takes the bags from the latest lot bought before the
+	// consumption, at its price.
+	CostingLIFO CostingMethod = "lifo"
+	// CostingAverage values the bags at the weighted average price of the
+	// stock held when they are burnt.
+	CostingAverage CostingMethod = "average"
+)
+
+// ParseCostingMethod reads a costing method name; an empty value is FIFO.
+func ParseCostingMethod(value string) (CostingMethod, error) {
+	switch method := CostingMethod(strings.ToLower(strings.TrimSpace(value))); method {
+	case "":
+		return CostingFIFO, nil
+	case CostingFIFO, CostingLIFO, CostingAverage:
+		return method, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownCostingMethod, value)
+	}
+}
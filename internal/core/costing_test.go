@@ -0,0 +1,44 @@
+package core_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestParseCostingMethod(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		value string
+	}
+	type want struct {
+		method core.CostingMethod
+		err    error
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "defaults to FIFO", params: params{value: ""}, want: want{method: core.CostingFIFO}},
+		{name: "ignores the case", params: params{value: " LIFO "}, want: want{method: core.CostingLIFO}},
+		{name: "reads the average method", params: params{value: "average"}, want: want{method: core.CostingAverage}},
+		{name: "rejects unknown methods", params: params{value: "cmup"}, want: want{err: core.ErrUnknownCostingMethod}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			method, err := core.ParseCostingMethod(tc.params.value)
+
+			assert.ErrorIs(t, err, tc.want.err, tc.name)
+			assert.Equal(t, tc.want.method, method, tc.name)
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package core
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+)
+
+// EnergySummary is the heat released by the pellets burnt within a range,
+// estimated from the energy density of each brand.
+type EnergySummary struct {
+	WeightKg  float64 `json:"weight_kg"`
+	EnergyKWh float64 `json:"energy_kwh"`
+	Cost      Money   `json:"cost_cents"`
+	// CostPerMWh is the cost of the heat in cents per MWh, so the price of a
+	// kWh keeps its decimals. It is zero when nothing was burnt.
+	CostPerMWh Money `json:"cost_per_mwh_cents"`
+}
+
+// MonthlyEnergy is the heat released by the pellets burnt in one month.
+type MonthlyEnergy struct {
+	Month     time.Time `json:"month"`
+	WeightKg  float64   `json:"weight_kg"`
+	EnergyKWh float64   `json:"energy_kwh"`
+}
+
+// ComputeEnergie estimates the heat released by the consumptions within the
+// range and its cost per kWh, the consumptions being valued with method.
+func ComputeEnergie(ctx context.Context, ds *DataStore, method CostingMethod, from, to time.Time) (EnergySummary, error) {
+	if ds == nil {
+		return EnergySummary{}, nil
+	}
+
+	calculations, _, err := computeCostResults(ctx, ds, method)
+	if err != nil {
+		return EnergySummary{}, err
+	}
+
+	factors := brandEnergyFactors(ds.Brands)
+	var weight Grams
+	var wh int64
+	var cost Money
+	for _, calc := range calculations {
+		if !withinRange(calc.consumption.ConsumedAt, from, to) {
+			continue
+		}
+		weight += calc.weight
+		wh += energyWh(calc.weight, factors.of(calc.consumption.BrandID))
+		cost += calc.total
+	}
+
+	return EnergySummary{WeightKg: weight.Kg(), EnergyKWh: float64(wh) / 1000, Cost: cost, CostPerMWh: costPerMWh(cost, wh)}, nil
+}
+
+// ComputeKWhParMois estimates the heat released per month by the
+// consumptions within the range.
+func ComputeKWhParMois(ctx context.Context, ds *DataStore, from, to time.Time) ([]MonthlyEnergy, error) {
+	if ds == nil {
+		return nil, nil
+	}
+
+	// The burnt weight does not depend on the costing method.
+	calculations, _, err := computeFIFOResults(ctx, ds)
+	if err != nil {
+		return nil, err
+	}
+
+	factors := brandEnergyFactors(ds.Brands)
+	weights := make(map[time.Time]Grams)
+	energies := make(map[time.Time]int64)
+	for _, calc := range calculations {
+		consumedAt := calc.consumption.ConsumedAt
+		if !withinRange(consumedAt, from, to) {
+			continue
+		}
+		month := time.Date(consumedAt.Year(), consumedAt.Month(), 1, 0, 0, 0, 0, time.UTC)
+		weights[month] += calc.weight
+		energies[month] += energyWh(calc.weight, factors.of(calc.consumption.BrandID))
+	}
+
+	results := make([]MonthlyEnergy, 0, len(weights))
+	for month, weight := range weights {
+		results = append(results, MonthlyEnergy{Month: month, WeightKg: weight.Kg(), EnergyKWh: float64(energies[month]) / 1000})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Month.Before(results[j].Month)
+	})
+	return results, nil
+}
+
+// costPerMWh is the price of wh watt-hours costing cost, in cents per MWh;
+// zero without energy.
+func costPerMWh(cost Money, wh int64) Money {
+	if wh <= 0 {
+		return 0
+	}
+	return Money(int64(roundHalfEven(float64(cost) * 1e6 / float64(wh))))
+}
+
+// energyFactors indexes the kWh per kilogram of each brand.
+type energyFactors map[ID]float64
+
+func brandEnergyFactors(brands []Brand) energyFactors {
+	factors := make(energyFactors, len(brands))
+	for _, brand := range brands {
+		factors[brand.ID] = brand.EnergyFactor()
+	}
+	return factors
+}
+
+// of returns the factor of a brand, the default one for unknown brands.
+func (f energyFactors) of(id ID) float64 {
+	if factor, ok := f[id]; ok {
+		return factor
+	}
+	return DefaultEnergyKWhPerKg
+}
+
+// energyWh converts a burnt weight into watt-hours: a gram of pellets
+// releasing k kWh per kilogram releases k Wh.
+func energyWh(weight Grams, kwhPerKg float64) int64 {
+	return int64(math.Round(float64(weight) * kwhPerKg))
+}
+
+func validEnergyFactor(kwhPerKg float64) bool {
+	return kwhPerKg >= 0 && kwhPerKg <= MaxEnergyKWhPerKg
+}
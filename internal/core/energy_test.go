@@ -0,0 +1,140 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func energyDataStore() core.DataStore {
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	return core.DataStore{
+		Brands: []core.Brand{
+			{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock", EnergyKWhPerKg: 5},
+			{Meta: core.Meta{ID: "brand-d"}, Name: "Discount"},
+		},
+		Purchases: []core.Purchase{
+			{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: day(2024, time.September, 1), Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 600, TotalPriceCents: 6000},
+			{Meta: core.Meta{ID: "p2"}, BrandID: "brand-d", PurchasedAt: day(2024, time.September, 1), Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 500, TotalPriceCents: 5000},
+		},
+		Consumptions: []core.Consumption{
+			{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: day(2024, time.October, 5), Bags: 2},
+			{Meta: core.Meta{ID: "c2"}, BrandID: "brand-d", ConsumedAt: day(2024, time.November, 10), Bags: 1, WeightKg: 12.5},
+			{Meta: core.Meta{ID: "c3"}, BrandID: "brand-w", ConsumedAt: day(2024, time.November, 20), Bags: 1},
+		},
+	}
+}
+
+func TestComputeEnergie(t *testing.T) {
+	t.Parallel()
+
+	ds := energyDataStore()
+	empty := core.DataStore{Consumptions: []core.Consumption{
+		{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: time.Date(2024, time.October, 5, 0, 0, 0, 0, time.UTC), Bags: 1},
+	}}
+
+	type params struct {
+		ds   *core.DataStore
+		from time.Time
+		to   time.Time
+	}
+	type want struct {
+		err     error
+		summary core.EnergySummary
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "nil datastore",
+			params: params{},
+		},
+		{
+			name:   "uses the brand factor or the default one",
+			params: params{ds: &ds},
+			want:   want{summary: core.EnergySummary{WeightKg: 57.5, EnergyKWh: 285, Cost: 2300, CostPerMWh: 8070}},
+		},
+		{
+			name: "restricts to the range",
+			params: params{
+				ds:   &ds,
+				from: time.Date(2024, time.November, 1, 0, 0, 0, 0, time.UTC),
+				to:   time.Date(2024, time.November, 30, 0, 0, 0, 0, time.UTC),
+			},
+			want: want{summary: core.EnergySummary{WeightKg: 27.5, EnergyKWh: 135, Cost: 1100, CostPerMWh: 8148}},
+		},
+		{
+			name:   "reports consumptions without stock",
+			params: params{ds: &empty},
+			want:   want{err: core.ErrInsufficientInventory},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			summary, err := core.ComputeEnergie(context.Background(), tc.params.ds, core.CostingFIFO, tc.params.from, tc.params.to)
+
+			assert.ErrorIs(t, err, tc.want.err, tc.name)
+			assert.Equal(t, tc.want.summary, summary, tc.name)
+		})
+	}
+}
+
+func TestComputeKWhParMois(t *testing.T) {
+	t.Parallel()
+
+	ds := energyDataStore()
+	october := time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC)
+	november := time.Date(2024, time.November, 1, 0, 0, 0, 0, time.UTC)
+
+	type params struct {
+		from time.Time
+		to   time.Time
+	}
+	type want struct {
+		months []core.MonthlyEnergy
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "groups the energy by month",
+			want: want{months: []core.MonthlyEnergy{
+				{Month: october, WeightKg: 30, EnergyKWh: 150},
+				{Month: november, WeightKg: 27.5, EnergyKWh: 135},
+			}},
+		},
+		{
+			name:   "restricts to the range",
+			params: params{from: november},
+			want:   want{months: []core.MonthlyEnergy{{Month: november, WeightKg: 27.5, EnergyKWh: 135}}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			months, err := core.ComputeKWhParMois(context.Background(), &ds, tc.params.from, tc.params.to)
+
+			assert.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.months, months, tc.name)
+		})
+	}
+}
@@ -4,17 +4,58 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 )
 
 // Domain errors returned by core operations.
 var (
-	ErrBrandNotFound         = errors.New("brand not found")
-	ErrBrandInUse            = errors.New("brand is referenced by purchases or consumptions")
-	ErrPurchaseNotFound      = errors.New("purchase not found")
-	ErrConsumptionNotFound   = errors.New("consumption not found")
-	ErrInsufficientInventory = errors.New("insufficient inventory for consumption")
+	ErrBrandNotFound           = errors.New("brand not found")
+	ErrBrandInUse              = errors.New("brand is referenced by purchases or consumptions")
+	ErrPurchaseNotFound        = errors.New("purchase not found")
+	ErrConsumptionNotFound     = errors.New("consumption not found")
+	ErrInsufficientInventory   = errors.New("insufficient inventory for consumption")
+	ErrUserNotFound            = errors.New("user not found")
+	ErrLastUser                = errors.New("the last user cannot be deleted")
+	ErrLastAdmin               = errors.New("the last admin cannot be removed")
+	ErrAPITokenNotFound        = errors.New("api token not found")
+	ErrSeasonNotFound          = errors.New("season not found")
+	ErrSiloNotFound            = errors.New("silo not found")
+	ErrStorageLocationNotFound = errors.New("storage location not found")
+	ErrPhotoNotFound           = errors.New("photo not found")
+	ErrUnknownCostingMethod    = errors.New("unknown costing method")
+	ErrConflict                = errors.New("entry was modified since it was read")
 )
 
+// ConflictError rejects an update based on a stale revision of an entry,
+// typically a form left open while the entry was saved from another tab. It
+// matches ErrConflict.
+type ConflictError struct {
+	Entity           string    `json:"entity"`
+	ID               ID        `json:"id"`
+	ExpectedRevision int64     `json:"expected_revision"`
+	CurrentRevision  int64     `json:"current_revision"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// Error implements the error interface.
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s %s: %v (revision %d, now %d)", e.Entity, e.ID, ErrConflict, e.ExpectedRevision, e.CurrentRevision)
+}
+
+// Is reports ErrConflict as the cause of the conflict.
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// checkRevision fails with a ConflictError when expected is set and is not
+// the current revision of the entity.
+func checkRevision(entity string, meta Meta, expected *int64) error {
+	if expected == nil || *expected == meta.Revision {
+		return nil
+	}
+	return &ConflictError{Entity: entity, ID: meta.ID, ExpectedRevision: *expected, CurrentRevision: meta.Revision, UpdatedAt: meta.UpdatedAt}
+}
+
 // ValidationError describes an invalid field with an associated message.
 type ValidationError struct {
 	Field   string
@@ -0,0 +1,227 @@
+// Package events defines the typed domain events raised by the changes of
+// the datastore and by the background jobs, and the in-process bus that
+// delivers them to the integrations. Change detection lives here once, the
+// integrations only subscribe.
+package events
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"pellets-tracker/internal/core"
+)
+
+// Names of the events, also the types posted to the webhooks.
+const (
+	NamePurchaseCreated    = "purchase.created"
+	NameConsumptionCreated = "consumption.created"
+	NameLowStock           = "inventory.low"
+	NameConsumptionAnomaly = "consumption.anomaly"
+	NameSaveFailed         = "datastore.save_failed"
+	NameBackupCompleted    = "backup.completed"
+)
+
+// Event is a domain event. The concrete types below are the only
+// implementations; subscribers switch on them.
+type Event interface {
+	// Name is one of the Name constants.
+	Name() string
+	// OccurredAt is when the event was raised, in UTC.
+	OccurredAt() time.Time
+}
+
+// PurchaseCreated reports a purchase added to the datastore.
+type PurchaseCreated struct {
+	At       time.Time
+	Purchase core.Purchase
+}
+
+// ConsumptionCreated reports a consumption added to the datastore.
+type ConsumptionCreated struct {
+	At          time.Time
+	Consumption core.Consumption
+}
+
+// LowStock reports a stock falling below its minimum, the whole stock when
+// the alert has no brand. An alert already active is not raised again.
+type LowStock struct {
+	At    time.Time
+	Alert core.StockAlert
+}
+
+// ConsumptionAnomaly reports a month newly flagged by the consumption model,
+// burning far more or less than its temperatures explain.
+type ConsumptionAnomaly struct {
+	At    time.Time
+	Month core.ModelMonth
+}
+
+// SaveFailed reports a datastore save that failed, the backup taken
+// beforehand included: the changes are only held in memory.
+type SaveFailed struct {
+	At  time.Time
+	Err string
+}
+
+// BackupCompleted reports a snapshot of the datastore pushed to a remote
+// backup target.
+type BackupCompleted struct {
+	At     time.Time
+	Target string
+	File   string
+	Bytes  int
+}
+
+func (e PurchaseCreated) Name() string    { return NamePurchaseCreated }
+func (e ConsumptionCreated) Name() string { return NameConsumptionCreated }
+func (e LowStock) Name() string           { return NameLowStock }
+func (e ConsumptionAnomaly) Name() string { return NameConsumptionAnomaly }
+func (e SaveFailed) Name() string         { return NameSaveFailed }
+func (e BackupCompleted) Name() string    { return NameBackupCompleted }
+
+func (e PurchaseCreated) OccurredAt() time.Time    { return e.At }
+func (e ConsumptionCreated) OccurredAt() time.Time { return e.At }
+func (e LowStock) OccurredAt() time.Time           { return e.At }
+func (e ConsumptionAnomaly) OccurredAt() time.Time { return e.At }
+func (e SaveFailed) OccurredAt() time.Time         { return e.At }
+func (e BackupCompleted) OccurredAt() time.Time    { return e.At }
+
+// Publisher is the side of the Bus used by the jobs raising events.
+type Publisher interface {
+	Publish(event Event)
+}
+
+// Bus delivers every event published to the handlers subscribed, in process.
+type Bus struct {
+	now func() time.Time
+
+	mu       sync.RWMutex
+	handlers []func(Event)
+
+	saveMu sync.Mutex
+	// saveFailing reports a save failure was already published; it is reset
+	// by the next successful save.
+	saveFailing bool
+}
+
+// NewBus builds a Bus without subscribers.
+func NewBus() *Bus {
+	return &Bus{now: time.Now}
+}
+
+// Subscribe registers handler for every event published from then on.
+// Handlers are called in turn by the publisher and must not block: an
+// integration doing I/O queues the event and delivers it from its own
+// goroutine.
+func (b *Bus) Subscribe(handler func(Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers = append(b.handlers, handler)
+}
+
+// Publish delivers event to the handlers, in the order they subscribed.
+func (b *Bus) Publish(event Event) {
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+func (b *Bus) subscribed() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return len(b.handlers) > 0
+}
+
+// Observe publishes the events caused by replacing before with after, see
+// Detect. It is meant for store.JSONStore.SetOnReplace.
+func (b *Bus) Observe(before, after core.DataStore) {
+	b.saveMu.Lock()
+	b.saveFailing = false
+	b.saveMu.Unlock()
+
+	// The detection replays the stock and the consumption model twice,
+	// wasted without a subscriber.
+	if !b.subscribed() {
+		return
+	}
+	for _, event := range Detect(before, after, b.now()) {
+		b.Publish(event)
+	}
+}
+
+// ObserveSaveError publishes a SaveFailed for a datastore save that failed.
+// Failures are published once until a save succeeds again. It is meant for
+// store.JSONStore.SetOnSaveError.
+func (b *Bus) ObserveSaveError(err error) {
+	b.saveMu.Lock()
+	repeated := b.saveFailing
+	b.saveFailing = true
+	b.saveMu.Unlock()
+	if !repeated {
+		b.Publish(SaveFailed{At: b.now().UTC(), Err: err.Error()})
+	}
+}
+
+// Detect returns the events caused by replacing before with after at now:
+// the purchases and consumptions added, the stock alerts raised and the
+// months newly flagged by the consumption model. An alert already active
+// before the change is not repeated.
+func Detect(before, after core.DataStore, now time.Time) []Event {
+	at := now.UTC()
+	var detected []Event
+
+	purchases := make(map[core.ID]bool, len(before.Purchases))
+	for _, purchase := range before.Purchases {
+		purchases[purchase.ID] = true
+	}
+	for _, purchase := range after.Purchases {
+		if !purchases[purchase.ID] {
+			detected = append(detected, PurchaseCreated{At: at, Purchase: purchase})
+		}
+	}
+
+	consumptions := make(map[core.ID]bool, len(before.Consumptions))
+	for _, consumption := range before.Consumptions {
+		consumptions[consumption.ID] = true
+	}
+	for _, consumption := range after.Consumptions {
+		if !consumptions[consumption.ID] {
+			detected = append(detected, ConsumptionCreated{At: at, Consumption: consumption})
+		}
+	}
+
+	// A history the stock cannot be computed from has no alert to report.
+	previous, _ := core.ComputeAlertes(context.Background(), &before)
+	active := make(map[core.ID]bool, len(previous))
+	for _, alert := range previous {
+		active[alert.BrandID] = true
+	}
+	alerts, err := core.ComputeAlertes(context.Background(), &after)
+	if err != nil {
+		log.Printf("events: compute stock alerts: %v", err)
+	}
+	for _, alert := range alerts {
+		if !active[alert.BrandID] {
+			detected = append(detected, LowStock{At: at, Alert: alert})
+		}
+	}
+
+	flagged := make(map[time.Time]bool)
+	for _, month := range core.ComputeConsumptionModel(&before, now).Months {
+		flagged[month.Month] = month.Flagged
+	}
+	for _, month := range core.ComputeConsumptionModel(&after, now).Months {
+		if month.Flagged && !flagged[month.Month] {
+			detected = append(detected, ConsumptionAnomaly{At: at, Month: month})
+		}
+	}
+	return detected
+}
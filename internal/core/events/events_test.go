@@ -0,0 +1,204 @@
+package events_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/core/events"
+)
+
+func TestDetect(t *testing.T) {
+	t.Parallel()
+
+	day := func(d int) time.Time { return time.Date(2024, time.November, d, 0, 0, 0, 0, time.UTC) }
+	base := core.DataStore{
+		MinStockBags: 5,
+		Brands:       []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}},
+		Purchases: []core.Purchase{
+			{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: day(1), Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 600, TotalPriceCents: 6000},
+		},
+	}
+	withPurchase := base
+	withPurchase.Purchases = append(append([]core.Purchase(nil), base.Purchases...),
+		core.Purchase{Meta: core.Meta{ID: "p2"}, BrandID: "brand-w", PurchasedAt: day(2), Bags: 5, BagWeightKg: 15, TotalWeightKg: 75, UnitPriceCents: 620, TotalPriceCents: 3100})
+	low := base
+	low.Consumptions = []core.Consumption{{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: day(3), Bags: 6}}
+	lower := low
+	lower.Consumptions = append(append([]core.Consumption(nil), low.Consumptions...),
+		core.Consumption{Meta: core.Meta{ID: "c2"}, BrandID: "brand-w", ConsumedAt: day(4), Bags: 1})
+
+	// Monthly consumptions burning 0.2 bag per heating degree day, until a
+	// second entry in May strays from the model.
+	steady := core.DataStore{
+		Brands:    base.Brands,
+		Purchases: []core.Purchase{{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: time.Date(2023, time.October, 1, 0, 0, 0, 0, time.UTC), Bags: 500, BagWeightKg: 15, TotalWeightKg: 7500, UnitPriceCents: 600}},
+	}
+	for _, month := range []struct {
+		first time.Time
+		meanC float64
+		bags  int
+	}{
+		{first: time.Date(2023, time.November, 1, 0, 0, 0, 0, time.UTC), meanC: 7, bags: 66},
+		{first: time.Date(2023, time.December, 1, 0, 0, 0, 0, time.UTC), meanC: 8, bags: 62},
+		{first: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC), meanC: 3, bags: 93},
+		{first: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC), meanC: 8, bags: 58},
+		{first: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), meanC: 13, bags: 31},
+		{first: time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC), meanC: 6, bags: 72},
+		{first: time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC), meanC: 10, bags: 50},
+		{first: time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC), meanC: 15, bags: 18},
+	} {
+		for d := month.first; d.Month() == month.first.Month(); d = d.AddDate(0, 0, 1) {
+			steady.Temperatures = append(steady.Temperatures, core.DailyTemperature{Date: d, MeanC: month.meanC})
+		}
+		steady.Consumptions = append(steady.Consumptions, core.Consumption{Meta: core.Meta{ID: core.ID("c-" + month.first.Format("2006-01"))}, BrandID: "brand-w", ConsumedAt: month.first, Bags: month.bags})
+	}
+	strayed := steady
+	strayed.Consumptions = append(append([]core.Consumption(nil), steady.Consumptions...),
+		core.Consumption{Meta: core.Meta{ID: "c-extra"}, BrandID: "brand-w", ConsumedAt: time.Date(2024, time.May, 15, 0, 0, 0, 0, time.UTC), Bags: 30})
+
+	type params struct {
+		before core.DataStore
+		after  core.DataStore
+	}
+	type want struct {
+		events []events.Event
+	}
+
+	at := time.Date(2024, time.November, 10, 8, 0, 0, 0, time.UTC)
+	anomaly := core.ComputeConsumptionModel(&strayed, at).Months[6]
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "reports new purchases",
+			params: params{before: base, after: withPurchase},
+			want:   want{events: []events.Event{events.PurchaseCreated{At: at, Purchase: withPurchase.Purchases[1]}}},
+		},
+		{
+			name:   "reports the stock falling below its minimum",
+			params: params{before: base, after: low},
+			want: want{events: []events.Event{
+				events.ConsumptionCreated{At: at, Consumption: low.Consumptions[0]},
+				events.LowStock{At: at, Alert: core.StockAlert{Bags: 4, MinBags: 5}},
+			}},
+		},
+		{
+			name:   "does not repeat an active alert",
+			params: params{before: low, after: lower},
+			want:   want{events: []events.Event{events.ConsumptionCreated{At: at, Consumption: lower.Consumptions[1]}}},
+		},
+		{
+			name:   "reports a month straying from the model",
+			params: params{before: steady, after: strayed},
+			want: want{events: []events.Event{
+				events.ConsumptionCreated{At: at, Consumption: strayed.Consumptions[8]},
+				events.ConsumptionAnomaly{At: at, Month: anomaly},
+			}},
+		},
+		{
+			name:   "ignores unrelated changes",
+			params: params{before: base, after: base},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			detected := events.Detect(tc.params.before, tc.params.after, at)
+
+			assert.Equal(t, tc.want.events, detected, tc.name)
+		})
+	}
+}
+
+func TestBus_Publish(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		subscribers int
+	}
+	type want struct {
+		calls []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "delivers to every subscriber in order", params: params{subscribers: 2}, want: want{calls: []string{"0:backup.completed", "1:backup.completed"}}},
+		{name: "drops events without subscribers"},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			bus := events.NewBus()
+			var calls []string
+			for i := 0; i < tc.params.subscribers; i++ {
+				bus.Subscribe(func(event events.Event) { calls = append(calls, fmt.Sprintf("%d:%s", i, event.Name())) })
+			}
+
+			bus.Publish(events.BackupCompleted{Target: "/mnt/nas", File: "pellets.json-20241110T080000Z.json.gz", Bytes: 512})
+
+			assert.Equal(t, tc.want.calls, calls, tc.name)
+		})
+	}
+}
+
+func TestBus_ObserveSaveError(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		failures  int
+		recovered bool
+	}
+	type want struct {
+		events int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "reports a failure", params: params{failures: 1}, want: want{events: 1}},
+		{name: "does not repeat a failure", params: params{failures: 3}, want: want{events: 1}},
+		{name: "reports again after a successful save", params: params{failures: 2, recovered: true}, want: want{events: 2}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			bus := events.NewBus()
+			var published []events.Event
+			bus.Subscribe(func(event events.Event) { published = append(published, event) })
+
+			for i := 0; i < tc.params.failures; i++ {
+				if tc.params.recovered && i > 0 {
+					bus.Observe(core.DataStore{}, core.DataStore{})
+				}
+				bus.ObserveSaveError(errors.New("write datastore: disk full"))
+			}
+
+			require.Len(t, published, tc.want.events, tc.name)
+			failed, ok := published[0].(events.SaveFailed)
+			require.True(t, ok, tc.name)
+			assert.Equal(t, "write datastore: disk full", failed.Err, tc.name)
+		})
+	}
+}
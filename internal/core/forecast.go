@@ -0,0 +1,177 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+)
+
+// Forecast bases reported by StockForecast.Basis.
+const (
+	// ForecastMonthlyAverage projects the average daily consumption of each
+	// calendar month over the recorded history.
+	ForecastMonthlyAverage = "monthly_average"
+	// ForecastDegreeDays applies the consumption model to the average heating
+	// degree days of each calendar month; months without recorded
+	// temperatures fall back to their monthly average.
+	ForecastDegreeDays = "degree_days"
+)
+
+// forecastHorizonDays bounds the projection: a stock lasting longer is not
+// expected to run out.
+const forecastHorizonDays = 365
+
+// StockForecast projects the stock left against the seasonal consumption.
+type StockForecast struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	StockKg     float64   `json:"stock_kg"`
+	Basis       string    `json:"basis"`
+	// StockoutAt is the day the stock is expected to run out, zero when it
+	// lasts past Horizon.
+	StockoutAt time.Time `json:"stockout_at,omitempty"`
+	// Horizon is the last day of the projection.
+	Horizon time.Time       `json:"horizon"`
+	Months  []ForecastMonth `json:"months"`
+}
+
+// ForecastMonth is a month of the projection, up to the stockout.
+type ForecastMonth struct {
+	Month    time.Time `json:"month"`
+	KgPerDay float64   `json:"kg_per_day"`
+	// ExpectedKg is the consumption expected over the days of the month
+	// projected, from today on for the current month.
+	ExpectedKg float64 `json:"expected_kg"`
+	// StockKg is the stock expected at the end of those days.
+	StockKg float64 `json:"stock_kg"`
+}
+
+// ComputeForecast projects the current stock, by weight so bulk deliveries
+// count, against the average daily consumption of each calendar month since
+// the first consumption. When the consumption model is fitted against the
+// outside temperatures, the rate of a month is instead predicted from its
+// average heating degree days, which follows a mild or harsh winter better
+// than a plain average over few seasons.
+func ComputeForecast(ctx context.Context, ds *DataStore, now time.Time) (StockForecast, error) {
+	if ds == nil {
+		return StockForecast{}, errors.New("nil datastore")
+	}
+
+	calcs, tracker, err := computeFIFOResults(ctx, ds)
+	if err != nil {
+		return StockForecast{}, err
+	}
+	inventory := tracker.inventorySummary(ds.Brands, time.Time{})
+
+	today := startOfDay(now)
+	forecast := StockForecast{
+		GeneratedAt: now,
+		StockKg:     inventory.TotalWeightKg,
+		Basis:       ForecastNone,
+		Horizon:     today.AddDate(0, 0, forecastHorizonDays-1),
+		Months:      []ForecastMonth{},
+	}
+
+	rates, basis := forecastMonthlyRates(ds, calcs, today, now)
+	if basis == ForecastNone {
+		return forecast, nil
+	}
+	forecast.Basis = basis
+
+	stock := forecast.StockKg
+	if stock <= 0 {
+		forecast.StockoutAt = today
+	}
+	for i := 0; i < forecastHorizonDays && forecast.StockoutAt.IsZero(); i++ {
+		day := today.AddDate(0, 0, i)
+		month := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+		n := len(forecast.Months)
+		if n == 0 || !forecast.Months[n-1].Month.Equal(month) {
+			forecast.Months = append(forecast.Months, ForecastMonth{Month: month, KgPerDay: RoundKg(rates[day.Month()])})
+			n++
+		}
+		stock -= rates[day.Month()]
+		entry := &forecast.Months[n-1]
+		entry.ExpectedKg += rates[day.Month()]
+		entry.StockKg = math.Max(0, stock)
+		if stock < -1e-9 {
+			forecast.StockoutAt = day
+		}
+	}
+	for i := range forecast.Months {
+		forecast.Months[i].ExpectedKg = RoundKg(forecast.Months[i].ExpectedKg)
+		forecast.Months[i].StockKg = RoundKg(forecast.Months[i].StockKg)
+	}
+
+	return forecast, nil
+}
+
+// forecastMonthlyRates returns the expected consumption per day of each
+// calendar month, in kg, and the basis it was computed on. Only the days
+// before today are averaged, the consumption of today being still partial.
+// A calendar month not covered yet by the history takes the average rate of
+// the whole history.
+func forecastMonthlyRates(ds *DataStore, calcs []consumptionCalculation, today, now time.Time) (map[time.Month]float64, string) {
+	var first time.Time
+	consumed := make(map[time.Month]Grams)
+	var total Grams
+	var bagWeight Grams
+	bags := 0.0
+	for _, calc := range calcs {
+		consumedAt := calc.consumption.ConsumedAt
+		if !consumedAt.Before(today) {
+			continue
+		}
+		if first.IsZero() || consumedAt.Before(first) {
+			first = consumedAt
+		}
+		consumed[consumedAt.UTC().Month()] += calc.weight
+		total += calc.weight
+		if calc.bags > 0 {
+			bags += calc.bags
+			bagWeight += calc.weight
+		}
+	}
+	if total <= 0 {
+		return nil, ForecastNone
+	}
+
+	observed := make(map[time.Month]int)
+	days := 0
+	for day := startOfDay(first); day.Before(today); day = day.AddDate(0, 0, 1) {
+		observed[day.Month()]++
+		days++
+	}
+	average := total.Kg() / float64(days)
+	rates := make(map[time.Month]float64, 12)
+	for month := time.January; month <= time.December; month++ {
+		rates[month] = average
+		if observed[month] > 0 {
+			rates[month] = consumed[month].Kg() / float64(observed[month])
+		}
+	}
+
+	// The model predicts bags per day: the bags burnt so far give their
+	// weight.
+	model := ComputeConsumptionModel(ds, now)
+	if !model.Fitted || bags == 0 {
+		return rates, ForecastMonthlyAverage
+	}
+	kgPerBag := bagWeight.Kg() / bags
+	hdd := make(map[time.Month]float64)
+	recorded := make(map[time.Month]int)
+	for _, temperature := range ds.Temperatures {
+		hdd[temperature.Date.Month()] += math.Max(0, HeatingBaseTempC-temperature.MeanC)
+		recorded[temperature.Date.Month()]++
+	}
+	basis := ForecastMonthlyAverage
+	for month := range rates {
+		if recorded[month] == 0 {
+			continue
+		}
+		hddPerDay := hdd[month] / float64(recorded[month])
+		rates[month] = math.Max(0, model.Intercept+model.Slope*hddPerDay) * kgPerBag
+		basis = ForecastDegreeDays
+	}
+	return rates, basis
+}
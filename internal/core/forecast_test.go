@@ -0,0 +1,145 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestComputeForecast(t *testing.T) {
+	t.Parallel()
+
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	bags := func(id core.ID, at time.Time, count int) core.Purchase {
+		return core.Purchase{Meta: core.Meta{ID: id}, BrandID: "brand-w", PurchasedAt: at, Bags: count, BagWeightKg: 15, TotalWeightKg: float64(count) * 15, UnitPriceCents: 500}
+	}
+	consumption := func(id core.ID, at time.Time, count int) core.Consumption {
+		return core.Consumption{Meta: core.Meta{ID: id}, BrandID: "brand-w", ConsumedAt: at, Bags: count}
+	}
+	brands := []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}}
+
+	// Three months burning 0.2 bag per heating degree day, and the
+	// temperatures of last April for the month to come.
+	modelled := core.DataStore{
+		Brands:    brands,
+		Purchases: []core.Purchase{bags("p1", day(2024, time.December, 1), 200)},
+		Consumptions: []core.Consumption{
+			consumption("c1", day(2025, time.January, 1), 93),
+			consumption("c2", day(2025, time.February, 1), 56),
+			consumption("c3", day(2025, time.March, 1), 31),
+		},
+	}
+	for d := day(2025, time.January, 1); d.Before(day(2025, time.April, 1)); d = d.AddDate(0, 0, 1) {
+		meanC := map[time.Month]float64{time.January: 3, time.February: 8, time.March: 13}[d.Month()]
+		modelled.Temperatures = append(modelled.Temperatures, core.DailyTemperature{Date: d, MeanC: meanC})
+	}
+	for d := day(2024, time.April, 1); d.Before(day(2024, time.May, 1)); d = d.AddDate(0, 0, 1) {
+		modelled.Temperatures = append(modelled.Temperatures, core.DailyTemperature{Date: d, MeanC: 15.5})
+	}
+
+	type params struct {
+		datastore core.DataStore
+		now       time.Time
+	}
+	type want struct {
+		basis      string
+		stockKg    float64
+		stockoutAt time.Time
+		months     []core.ForecastMonth
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "does not forecast without consumptions",
+			params: params{
+				datastore: core.DataStore{Brands: brands, Purchases: []core.Purchase{bags("p1", day(2025, time.March, 1), 10)}},
+				now:       day(2025, time.March, 11),
+			},
+			want: want{basis: core.ForecastNone, stockKg: 150, months: []core.ForecastMonth{}},
+		},
+		{
+			name: "projects the average of each month",
+			params: params{
+				datastore: core.DataStore{
+					Brands:       brands,
+					Purchases:    []core.Purchase{bags("p1", day(2025, time.February, 1), 20)},
+					Consumptions: []core.Consumption{consumption("c1", day(2025, time.March, 1), 2), consumption("c2", day(2025, time.March, 6), 2)},
+				},
+				now: time.Date(2025, time.March, 11, 18, 0, 0, 0, time.UTC),
+			},
+			want: want{
+				basis:      core.ForecastMonthlyAverage,
+				stockKg:    240,
+				stockoutAt: day(2025, time.April, 20),
+				months: []core.ForecastMonth{
+					{Month: day(2025, time.March, 1), KgPerDay: 6, ExpectedKg: 126, StockKg: 114},
+					{Month: day(2025, time.April, 1), KgPerDay: 6, ExpectedKg: 120, StockKg: 0},
+				},
+			},
+		},
+		{
+			name: "counts bulk deliveries by weight",
+			params: params{
+				datastore: core.DataStore{
+					Brands:       brands,
+					Purchases:    []core.Purchase{{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: day(2025, time.February, 1), TotalWeightKg: 1000, PricePerTonneCents: 40000, TotalPriceCents: 40000}},
+					Consumptions: []core.Consumption{{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: day(2025, time.March, 1), WeightKg: 100}},
+				},
+				now: day(2025, time.March, 11),
+			},
+			want: want{basis: core.ForecastMonthlyAverage, stockKg: 900, stockoutAt: day(2025, time.June, 9)},
+		},
+		{
+			name:   "follows the degree days when the model is fitted",
+			params: params{datastore: modelled, now: day(2025, time.April, 1)},
+			want: want{
+				basis:      core.ForecastDegreeDays,
+				stockKg:    300,
+				stockoutAt: day(2025, time.May, 3),
+				months: []core.ForecastMonth{
+					{Month: day(2025, time.April, 1), KgPerDay: 7.5, ExpectedKg: 225, StockKg: 75},
+					{Month: day(2025, time.May, 1), KgPerDay: 30, ExpectedKg: 90, StockKg: 0},
+				},
+			},
+		},
+		{
+			name: "reports a stock already exhausted",
+			params: params{
+				datastore: core.DataStore{
+					Brands:       brands,
+					Purchases:    []core.Purchase{bags("p1", day(2025, time.February, 1), 2)},
+					Consumptions: []core.Consumption{consumption("c1", day(2025, time.March, 1), 2)},
+				},
+				now: day(2025, time.March, 11),
+			},
+			want: want{basis: core.ForecastMonthlyAverage, stockoutAt: day(2025, time.March, 11), months: []core.ForecastMonth{}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			forecast, err := core.ComputeForecast(context.Background(), &tc.params.datastore, tc.params.now)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.basis, forecast.Basis, tc.name)
+			assert.InDelta(t, tc.want.stockKg, forecast.StockKg, 1e-9, tc.name)
+			assert.Equal(t, tc.want.stockoutAt, forecast.StockoutAt, tc.name)
+			if tc.want.months != nil {
+				assert.Equal(t, tc.want.months, forecast.Months, tc.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package core
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// HeatingBaseTempC is the outside temperature above which no heating is
+	// needed, the base of the French "degrés jours unifiés".
+	HeatingBaseTempC = 18.0
+	// ModelDeviationThreshold is the number of residual standard deviations
+	// past which a month is flagged as abnormal.
+	ModelDeviationThreshold = 2.0
+	// modelMinPoints is the number of months needed to fit the model.
+	modelMinPoints = 3
+	// modelMinCoverage is the share of days of a month that must have a
+	// recorded temperature for the month to be used.
+	modelMinCoverage = 0.8
+	// modelMinStdDev keeps months that fit an almost perfect line from being
+	// flagged over rounding noise, in bags per day.
+	modelMinStdDev  = 0.01
+	minTemperatureC = -60
+	maxTemperatureC = 60
+)
+
+// DailyTemperature is the mean outside temperature of a day.
+type DailyTemperature struct {
+	Date  time.Time `json:"date"`
+	MeanC float64   `json:"mean_c"`
+}
+
+// ConsumptionModel relates the daily consumption to the heating degree days
+// (HDD): bags per day = Intercept + Slope × HDD per day.
+type ConsumptionModel struct {
+	BaseTempC float64 `json:"base_temp_c"`
+	// Fitted is false until enough months combine consumptions and
+	// temperatures; the coefficients are zero then.
+	Fitted    bool    `json:"fitted"`
+	Intercept float64 `json:"intercept"`
+	Slope     float64 `json:"slope"`
+	R2        float64 `json:"r2"`
+	// StdDev is the standard deviation of the residuals, in bags per day.
+	StdDev float64      `json:"std_dev"`
+	Months []ModelMonth `json:"months"`
+}
+
+// ModelMonth compares the consumption of a month with the model.
+type ModelMonth struct {
+	Month      time.Time `json:"month"`
+	HDDPerDay  float64   `json:"hdd_per_day"`
+	BagsPerDay float64   `json:"bags_per_day"`
+	Expected   float64   `json:"expected_bags_per_day"`
+	// Deviation is the residual in standard deviations, positive when more
+	// was burnt than expected.
+	Deviation float64 `json:"deviation"`
+	Flagged   bool    `json:"flagged"`
+}
+
+// SetTemperatures records daily mean temperatures, replacing the value of a
+// day already known, and returns the number of days stored.
+func SetTemperatures(ds *DataStore, temperatures []DailyTemperature) (int, error) {
+	if ds == nil {
+		return 0, errors.New("nil datastore")
+	}
+	errs := ValidationErrors{}
+	for _, temperature := range temperatures {
+		errs = errs.AppendIf(temperature.Date.IsZero(), "date", "date is required")
+		errs = errs.AppendIf(math.IsNaN(temperature.MeanC) || temperature.MeanC < minTemperatureC || temperature.MeanC > maxTemperatureC, "mean_c", "temperature must be between -60 and 60 °C")
+	}
+	if len(errs) > 0 {
+		return 0, errs
+	}
+
+	byDay := make(map[time.Time]int, len(ds.Temperatures))
+	for i, temperature := range ds.Temperatures {
+		byDay[temperature.Date] = i
+	}
+	for _, temperature := range temperatures {
+		temperature.Date = startOfDay(temperature.Date)
+		if i, ok := byDay[temperature.Date]; ok {
+			ds.Temperatures[i] = temperature
+			continue
+		}
+		byDay[temperature.Date] = len(ds.Temperatures)
+		ds.Temperatures = append(ds.Temperatures, temperature)
+	}
+	sort.Slice(ds.Temperatures, func(i, j int) bool { return ds.Temperatures[i].Date.Before(ds.Temperatures[j].Date) })
+	touchDatastore(ds, time.Now().UTC())
+	return len(temperatures), nil
+}
+
+// ComputeConsumptionModel fits the consumption model on every complete month
+// before now that has enough recorded temperatures, starting with the first
+// consumption, and flags the months that stray from it.
+func ComputeConsumptionModel(ds *DataStore, now time.Time) ConsumptionModel {
+	model := ConsumptionModel{BaseTempC: HeatingBaseTempC, Months: []ModelMonth{}}
+	if ds == nil || len(ds.Consumptions) == 0 || len(ds.Temperatures) == 0 {
+		return model
+	}
+
+	type monthTotals struct {
+		bags    float64
+		hdd     float64
+		covered int
+	}
+	months := make(map[time.Time]*monthTotals)
+	totals := func(ts time.Time) *monthTotals {
+		month := time.Date(ts.Year(), ts.Month(), 1, 0, 0, 0, 0, time.UTC)
+		if months[month] == nil {
+			months[month] = &monthTotals{}
+		}
+		return months[month]
+	}
+	first := ds.Consumptions[0].ConsumedAt
+	for _, consumption := range ds.Consumptions {
+		totals(consumption.ConsumedAt).bags += consumption.TotalBags()
+		if consumption.ConsumedAt.Before(first) {
+			first = consumption.ConsumedAt
+		}
+	}
+	for _, temperature := range ds.Temperatures {
+		t := totals(temperature.Date)
+		t.hdd += math.Max(0, HeatingBaseTempC-temperature.MeanC)
+		t.covered++
+	}
+
+	firstMonth := time.Date(first.Year(), first.Month(), 1, 0, 0, 0, 0, time.UTC)
+	currentMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for month, t := range months {
+		days := month.AddDate(0, 1, 0).Sub(month).Hours() / 24
+		if month.Before(firstMonth) || !month.Before(currentMonth) || float64(t.covered) < modelMinCoverage*days {
+			continue
+		}
+		model.Months = append(model.Months, ModelMonth{
+			Month:      month,
+			HDDPerDay:  t.hdd / float64(t.covered),
+			BagsPerDay: t.bags / days,
+		})
+	}
+	sort.Slice(model.Months, func(i, j int) bool { return model.Months[i].Month.Before(model.Months[j].Month) })
+
+	fitConsumptionModel(&model)
+	return model
+}
+
+// fitConsumptionModel computes the ordinary least squares regression of the
+// daily bags on the daily HDD and scores every month against it. A month is
+// scored against the fit of the other months: an abnormal month would
+// otherwise pull the line and inflate the spread enough to hide itself.
+func fitConsumptionModel(model *ConsumptionModel) {
+	fit, ok := fitLine(model.Months, -1)
+	if !ok {
+		return
+	}
+	model.Fitted = true
+	model.Intercept = fit.intercept
+	model.Slope = fit.slope
+	model.R2 = fit.r2
+	model.StdDev = fit.stdDev
+	for i := range model.Months {
+		m := &model.Months[i]
+		m.Expected = fit.predict(m.HDDPerDay)
+		others, ok := fitLine(model.Months, i)
+		if !ok {
+			continue
+		}
+		m.Deviation = (m.BagsPerDay - others.predict(m.HDDPerDay)) / math.Max(others.stdDev, modelMinStdDev)
+		m.Flagged = math.Abs(m.Deviation) > ModelDeviationThreshold
+	}
+}
+
+type lineFit struct {
+	intercept, slope, r2, stdDev float64
+}
+
+func (f lineFit) predict(hddPerDay float64) float64 {
+	return f.intercept + f.slope*hddPerDay
+}
+
+// fitLine regresses the months, leaving out the one at index skip, and
+// reports false when they are too few or share the same HDD.
+func fitLine(months []ModelMonth, skip int) (lineFit, bool) {
+	var n, meanX, meanY float64
+	for i, m := range months {
+		if i == skip {
+			continue
+		}
+		n++
+		meanX += m.HDDPerDay
+		meanY += m.BagsPerDay
+	}
+	if n < modelMinPoints {
+		return lineFit{}, false
+	}
+	meanX /= n
+	meanY /= n
+	var sxx, sxy, syy float64
+	for i, m := range months {
+		if i == skip {
+			continue
+		}
+		dx, dy := m.HDDPerDay-meanX, m.BagsPerDay-meanY
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+	if sxx == 0 {
+		return lineFit{}, false
+	}
+	fit := lineFit{slope: sxy / sxx}
+	fit.intercept = meanY - fit.slope*meanX
+	// The residual sum of squares of a simple regression.
+	sse := math.Max(0, syy-fit.slope*sxy)
+	if syy > 0 {
+		fit.r2 = 1 - sse/syy
+	}
+	fit.stdDev = math.Sqrt(sse / (n - 2))
+	return fit, true
+}
@@ -0,0 +1,196 @@
+package core_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestComputeConsumptionModel(t *testing.T) {
+	t.Parallel()
+
+	const intercept, slope = 0.05, 0.03
+	now := time.Date(2024, time.April, 10, 0, 0, 0, 0, time.UTC)
+
+	type month struct {
+		start time.Time
+		bags  int
+		// tempDays is the number of days with a temperature, every day of the
+		// month when zero.
+		tempDays int
+		// extraBags are burnt on top of what the temperatures explain.
+		extraBags int
+	}
+	// season returns months whose bags follow the model exactly: the daily
+	// temperature is derived from the bags burnt.
+	season := func(months ...month) core.DataStore {
+		ds := core.DataStore{}
+		for _, m := range months {
+			days := m.start.AddDate(0, 1, 0).Sub(m.start).Hours() / 24
+			hdd := (float64(m.bags)/days - intercept) / slope
+			ds.Consumptions = append(ds.Consumptions, core.Consumption{
+				Meta:       core.Meta{ID: core.NewID()},
+				ConsumedAt: m.start.AddDate(0, 0, 14),
+				Bags:       m.bags + m.extraBags,
+			})
+			tempDays := m.tempDays
+			if tempDays == 0 {
+				tempDays = int(days)
+			}
+			for day := 0; day < tempDays; day++ {
+				ds.Temperatures = append(ds.Temperatures, core.DailyTemperature{
+					Date:  m.start.AddDate(0, 0, day),
+					MeanC: core.HeatingBaseTempC - hdd,
+				})
+			}
+		}
+		return ds
+	}
+	monthOf := func(year int, m time.Month) time.Time { return time.Date(year, m, 1, 0, 0, 0, 0, time.UTC) }
+	winter := []month{
+		{start: monthOf(2023, time.October), bags: 7},
+		{start: monthOf(2023, time.November), bags: 11},
+		{start: monthOf(2023, time.December), bags: 15},
+		{start: monthOf(2024, time.January), bags: 16},
+		{start: monthOf(2024, time.February), bags: 12},
+		{start: monthOf(2024, time.March), bags: 9},
+	}
+	withMonth := func(i int, change func(*month)) []month {
+		months := append([]month(nil), winter...)
+		change(&months[i])
+		return months
+	}
+
+	type params struct {
+		datastore core.DataStore
+	}
+	type want struct {
+		fitted  bool
+		months  []time.Time
+		flagged []time.Time
+	}
+
+	allMonths := []time.Time{winter[0].start, winter[1].start, winter[2].start, winter[3].start, winter[4].start, winter[5].start}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "needs enough months",
+			params: params{datastore: season(winter[:2]...)},
+			want:   want{months: []time.Time{winter[0].start, winter[1].start}},
+		},
+		{
+			name:   "fits a consumption following the temperatures",
+			params: params{datastore: season(winter...)},
+			want:   want{fitted: true, months: allMonths},
+		},
+		{
+			name:   "flags a month burning far more than expected",
+			params: params{datastore: season(withMonth(3, func(m *month) { m.extraBags = 12 })...)},
+			want:   want{fitted: true, months: allMonths, flagged: []time.Time{winter[3].start}},
+		},
+		{
+			name:   "skips months with too few temperatures",
+			params: params{datastore: season(withMonth(1, func(m *month) { m.tempDays = 10 })...)},
+			want:   want{fitted: true, months: []time.Time{winter[0].start, winter[2].start, winter[3].start, winter[4].start, winter[5].start}},
+		},
+		{
+			name:   "skips the current month",
+			params: params{datastore: season(append(append([]month(nil), winter...), month{start: monthOf(2024, time.April), bags: 3, tempDays: 9})...)},
+			want:   want{fitted: true, months: allMonths},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			model := core.ComputeConsumptionModel(&tc.params.datastore, now)
+			assert.Equal(t, tc.want.fitted, model.Fitted, tc.name)
+			var months, flagged []time.Time
+			for _, m := range model.Months {
+				months = append(months, m.Month)
+				if m.Flagged {
+					flagged = append(flagged, m.Month)
+				}
+			}
+			assert.Equal(t, tc.want.months, months, tc.name)
+			assert.Equal(t, tc.want.flagged, flagged, tc.name)
+			if tc.want.fitted && tc.want.flagged == nil {
+				assert.InDelta(t, intercept, model.Intercept, 1e-9, tc.name)
+				assert.InDelta(t, slope, model.Slope, 1e-9, tc.name)
+				assert.InDelta(t, 1, model.R2, 1e-9, tc.name)
+			}
+		})
+	}
+}
+
+func TestSetTemperatures(t *testing.T) {
+	t.Parallel()
+
+	day := func(d int) time.Time { return time.Date(2024, time.January, d, 0, 0, 0, 0, time.UTC) }
+
+	type params struct {
+		existing []core.DailyTemperature
+		recorded []core.DailyTemperature
+	}
+	type want struct {
+		temperatures []core.DailyTemperature
+		expectErr    bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "records days in order",
+			params: params{recorded: []core.DailyTemperature{
+				{Date: day(2).Add(13 * time.Hour), MeanC: 3.5},
+				{Date: day(1), MeanC: 1},
+			}},
+			want: want{temperatures: []core.DailyTemperature{{Date: day(1), MeanC: 1}, {Date: day(2), MeanC: 3.5}}},
+		},
+		{
+			name: "replaces a known day",
+			params: params{
+				existing: []core.DailyTemperature{{Date: day(1), MeanC: 1}},
+				recorded: []core.DailyTemperature{{Date: day(1), MeanC: -2}},
+			},
+			want: want{temperatures: []core.DailyTemperature{{Date: day(1), MeanC: -2}}},
+		},
+		{
+			name: "rejects implausible temperature",
+			params: params{
+				existing: []core.DailyTemperature{{Date: day(1), MeanC: 1}},
+				recorded: []core.DailyTemperature{{Date: day(2), MeanC: 4}, {Date: day(3), MeanC: 85}},
+			},
+			want: want{expectErr: true, temperatures: []core.DailyTemperature{{Date: day(1), MeanC: 1}}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := core.DataStore{Temperatures: append([]core.DailyTemperature(nil), tc.params.existing...)}
+			_, err := core.SetTemperatures(&ds, tc.params.recorded)
+			if tc.want.expectErr {
+				require.Error(t, err, tc.name)
+			} else {
+				require.NoError(t, err, tc.name)
+			}
+			assert.Equal(t, tc.want.temperatures, ds.Temperatures, tc.name)
+		})
+	}
+}
@@ -0,0 +1,446 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ImportMode selects how an imported datastore is combined with the current
+// one.
+type ImportMode string
+
+const (
+	// ImportMerge adds the entries of the import that are not known yet.
+	ImportMerge ImportMode = "merge"
+	// ImportReplace swaps the whole datastore for the import.
+	ImportReplace ImportMode = "replace"
+)
+
+// ParseImportMode validates an import mode, merging by default.
+func ParseImportMode(value string) (ImportMode, error) {
+	switch mode := ImportMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return ImportMerge, nil
+	case ImportMerge, ImportReplace:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown import mode %q", value)
+	}
+}
+
+// ImportSummary counts the entries an import added.
+type ImportSummary struct {
+	Mode         ImportMode `json:"mode"`
+	Brands       int        `json:"brands"`
+	Purchases    int        `json:"purchases"`
+	Consumptions int        `json:"consumptions"`
+	Transfers    int        `json:"transfers"`
+	Temperatures int        `json:"temperatures"`
+	// Skipped counts the merged entries already present in the datastore.
+	Skipped int `json:"skipped"`
+}
+
+// ImportDataStore combines an exported datastore with ds according to mode.
+// The import is upgraded to the current schema and checked with
+// ValidateDataStore; ds is left untouched when it is invalid. The users and
+// API tokens of ds are kept whatever the mode, those of the import are
+// ignored.
+func ImportDataStore(ds *DataStore, imported DataStore, mode ImportMode) (ImportSummary, error) {
+	if ds == nil {
+		return ImportSummary{}, errors.New("nil datastore")
+	}
+	if imported.SchemaVersion > CurrentSchemaVersion {
+		return ImportSummary{}, ValidationErrors{}.AppendIf(true, "schema_version", fmt.Sprintf("schema %d is newer than this version supports (%d)", imported.SchemaVersion, CurrentSchemaVersion))
+	}
+	MigrateDataStore(&imported)
+	if errs := ValidateDataStore(&imported); len(errs) > 0 {
+		return ImportSummary{}, errs
+	}
+
+	now := time.Now().UTC()
+	switch mode {
+	case ImportReplace:
+		summary := ImportSummary{
+			Mode:         mode,
+			Brands:       len(imported.Brands),
+			Purchases:    len(imported.Purchases),
+			Consumptions: len(imported.Consumptions),
+			Transfers:    len(imported.Transfers),
+			Temperatures: len(imported.Temperatures),
+		}
+		if imported.CreatedAt.IsZero() {
+			imported.CreatedAt = now
+		}
+		touchDatastore(&imported, now)
+		imported.Users = ds.Users
+		imported.APITokens = ds.APITokens
+		*ds = imported
+		return summary, nil
+	case ImportMerge:
+		merged := cloneForImport(*ds)
+		summary := mergeDataStore(&merged, imported)
+		touchDatastore(&merged, now)
+		*ds = merged
+		return summary, nil
+	default:
+		return ImportSummary{}, fmt.Errorf("unknown import mode %q", mode)
+	}
+}
+
+// mergeDataStore adds to ds the entries of imported whose ID it does not
+// know. A brand named like an existing one is the same brand: the entries of
+// the import are attached to the existing brand.
+func mergeDataStore(ds *DataStore, imported DataStore) ImportSummary {
+	summary := ImportSummary{Mode: ImportMerge}
+
+	brandIDs := make(map[ID]ID, len(imported.Brands))
+	for _, brand := range imported.Brands {
+		if existing, ok := findBrandForImport(ds.Brands, brand); ok {
+			brandIDs[brand.ID] = existing
+			summary.Skipped++
+			continue
+		}
+		brandIDs[brand.ID] = brand.ID
+		ds.Brands = append(ds.Brands, brand)
+		summary.Brands++
+	}
+	brandID := func(id ID) ID {
+		if mapped, ok := brandIDs[id]; ok {
+			return mapped
+		}
+		return id
+	}
+
+	purchases := make(map[ID]bool, len(ds.Purchases))
+	for _, p := range ds.Purchases {
+		purchases[p.ID] = true
+	}
+	for _, purchase := range imported.Purchases {
+		if purchases[purchase.ID] {
+			summary.Skipped++
+			continue
+		}
+		purchase.BrandID = brandID(purchase.BrandID)
+		ds.Purchases = append(ds.Purchases, purchase)
+		summary.Purchases++
+	}
+
+	consumptions := make(map[ID]bool, len(ds.Consumptions))
+	for _, c := range ds.Consumptions {
+		consumptions[c.ID] = true
+	}
+	for _, consumption := range imported.Consumptions {
+		if consumptions[consumption.ID] {
+			summary.Skipped++
+			continue
+		}
+		consumption.BrandID = brandID(consumption.BrandID)
+		ds.Consumptions = append(ds.Consumptions, consumption)
+		summary.Consumptions++
+	}
+
+	transfers := make(map[ID]bool, len(ds.Transfers))
+	for _, t := range ds.Transfers {
+		transfers[t.ID] = true
+	}
+	for _, transfer := range imported.Transfers {
+		if transfers[transfer.ID] {
+			summary.Skipped++
+			continue
+		}
+		transfer.BrandID = brandID(transfer.BrandID)
+		if transfer.ToBrandID != "" {
+			transfer.ToBrandID = brandID(transfer.ToBrandID)
+		}
+		transfer.Lots = append([]TransferLot(nil), transfer.Lots...)
+		ds.Transfers = append(ds.Transfers, transfer)
+		summary.Transfers++
+	}
+
+	audit := make(map[ID]bool, len(ds.Audit))
+	for _, entry := range ds.Audit {
+		audit[entry.ID] = true
+	}
+	for _, entry := range imported.Audit {
+		if !audit[entry.ID] {
+			ds.Audit = append(ds.Audit, entry)
+		}
+	}
+	sort.SliceStable(ds.Audit, func(i, j int) bool { return ds.Audit[i].At.Before(ds.Audit[j].At) })
+
+	// Recorded temperatures win over the imported ones.
+	days := make(map[time.Time]bool, len(ds.Temperatures))
+	for _, temperature := range ds.Temperatures {
+		days[temperature.Date] = true
+	}
+	for _, temperature := range imported.Temperatures {
+		temperature.Date = startOfDay(temperature.Date)
+		if days[temperature.Date] {
+			continue
+		}
+		days[temperature.Date] = true
+		ds.Temperatures = append(ds.Temperatures, temperature)
+		summary.Temperatures++
+	}
+	sort.Slice(ds.Temperatures, func(i, j int) bool { return ds.Temperatures[i].Date.Before(ds.Temperatures[j].Date) })
+
+	// Likewise for the recorded occupancy.
+	occupied := make(map[time.Time]bool, len(ds.Occupancy))
+	for _, day := range ds.Occupancy {
+		occupied[day.Date] = true
+	}
+	for _, day := range imported.Occupancy {
+		day.Date = startOfDay(day.Date)
+		if occupied[day.Date] {
+			continue
+		}
+		occupied[day.Date] = true
+		ds.Occupancy = append(ds.Occupancy, day)
+	}
+	sort.Slice(ds.Occupancy, func(i, j int) bool { return ds.Occupancy[i].Date.Before(ds.Occupancy[j].Date) })
+
+	// A silo named like an existing one is the same silo, whose readings of
+	// the day win over the imported ones.
+	siloIDs := make(map[ID]ID, len(imported.Silos))
+	for _, silo := range imported.Silos {
+		siloIDs[silo.ID] = silo.ID
+		for _, existing := range ds.Silos {
+			if existing.ID == silo.ID || strings.EqualFold(existing.Name, NormalizeName(silo.Name)) {
+				siloIDs[silo.ID] = existing.ID
+				break
+			}
+		}
+		if siloIDs[silo.ID] == silo.ID && findSiloIndex(ds.Silos, silo.ID) == -1 {
+			ds.Silos = append(ds.Silos, silo)
+		}
+	}
+	type siloDay struct {
+		silo ID
+		day  time.Time
+	}
+	read := make(map[siloDay]bool, len(ds.SiloReadings))
+	for _, reading := range ds.SiloReadings {
+		read[siloDay{reading.SiloID, startOfDay(reading.ReadAt)}] = true
+	}
+	for _, reading := range imported.SiloReadings {
+		reading.SiloID = siloIDs[reading.SiloID]
+		key := siloDay{reading.SiloID, startOfDay(reading.ReadAt)}
+		if read[key] {
+			continue
+		}
+		read[key] = true
+		ds.SiloReadings = append(ds.SiloReadings, reading)
+	}
+	sort.SliceStable(ds.SiloReadings, func(i, j int) bool { return ds.SiloReadings[i].ReadAt.Before(ds.SiloReadings[j].ReadAt) })
+
+	// A declared location named like an existing one is already known.
+	for _, location := range imported.StorageLocations {
+		known := false
+		for _, existing := range ds.StorageLocations {
+			if existing.ID == location.ID || strings.EqualFold(existing.Name, NormalizeName(location.Name)) {
+				known = true
+				break
+			}
+		}
+		if !known {
+			ds.StorageLocations = append(ds.StorageLocations, location)
+		}
+	}
+
+	// The archives of a season already purged here are kept.
+	archived := make(map[int]bool, len(ds.SeasonArchives))
+	for _, archive := range ds.SeasonArchives {
+		archived[archive.StartYear] = true
+	}
+	for _, archive := range imported.SeasonArchives {
+		if !archived[archive.StartYear] {
+			ds.SeasonArchives = append(ds.SeasonArchives, archive)
+		}
+	}
+	sort.Slice(ds.SeasonArchives, func(i, j int) bool { return ds.SeasonArchives[i].StartYear < ds.SeasonArchives[j].StartYear })
+
+	sortDataStore(ds)
+	return summary
+}
+
+func findBrandForImport(brands []Brand, brand Brand) (ID, bool) {
+	name := strings.ToLower(NormalizeName(brand.Name))
+	for _, existing := range brands {
+		if existing.ID == brand.ID || strings.ToLower(existing.Name) == name {
+			return existing.ID, true
+		}
+	}
+	return "", false
+}
+
+// sortDataStore restores the newest first order the operations keep.
+func sortDataStore(ds *DataStore) {
+	sort.Slice(ds.Purchases, func(i, j int) bool {
+		if ds.Purchases[i].PurchasedAt.Equal(ds.Purchases[j].PurchasedAt) {
+			return string(ds.Purchases[i].ID) > string(ds.Purchases[j].ID)
+		}
+		return ds.Purchases[i].PurchasedAt.After(ds.Purchases[j].PurchasedAt)
+	})
+	sort.Slice(ds.Consumptions, func(i, j int) bool {
+		if ds.Consumptions[i].ConsumedAt.Equal(ds.Consumptions[j].ConsumedAt) {
+			return string(ds.Consumptions[i].ID) > string(ds.Consumptions[j].ID)
+		}
+		return ds.Consumptions[i].ConsumedAt.After(ds.Consumptions[j].ConsumedAt)
+	})
+	sort.Slice(ds.Transfers, func(i, j int) bool {
+		if ds.Transfers[i].TransferredAt.Equal(ds.Transfers[j].TransferredAt) {
+			return string(ds.Transfers[i].ID) > string(ds.Transfers[j].ID)
+		}
+		return ds.Transfers[i].TransferredAt.After(ds.Transfers[j].TransferredAt)
+	})
+}
+
+func cloneForImport(ds DataStore) DataStore {
+	clone := ds
+	clone.Brands = append([]Brand(nil), ds.Brands...)
+	clone.Purchases = append([]Purchase(nil), ds.Purchases...)
+	clone.Consumptions = append([]Consumption(nil), ds.Consumptions...)
+	clone.Transfers = append([]Transfer(nil), ds.Transfers...)
+	clone.Audit = append([]AuditEntry(nil), ds.Audit...)
+	clone.Temperatures = append([]DailyTemperature(nil), ds.Temperatures...)
+	clone.Occupancy = append([]DailyOccupancy(nil), ds.Occupancy...)
+	clone.MarketPrices = append([]MarketPrice(nil), ds.MarketPrices...)
+	clone.Silos = append([]Silo(nil), ds.Silos...)
+	clone.SiloReadings = append([]SiloReading(nil), ds.SiloReadings...)
+	clone.StorageLocations = append([]StorageLocation(nil), ds.StorageLocations...)
+	clone.SeasonArchives = append([]SeasonArchive(nil), ds.SeasonArchives...)
+	clone.Users = append([]User(nil), ds.Users...)
+	clone.APITokens = append([]APIToken(nil), ds.APITokens...)
+	return clone
+}
+
+// ValidateDataStore checks the invariants the operations maintain: every
+// entry has a unique ID, references existing brands and purchases, and holds
+// values the forms would accept. Fields are reported as "purchases[3].bags".
+// The stock is not replayed: consumptions recorded past the stock are valid.
+func ValidateDataStore(ds *DataStore) ValidationErrors {
+	errs := ValidationErrors{}
+	if ds == nil {
+		return errs.AppendIf(true, "", "datastore is empty")
+	}
+	errs = errs.AppendIf(ds.MinStockBags < 0, "min_stock_bags", "minimum stock cannot be negative")
+
+	brands := make(map[ID]bool, len(ds.Brands))
+	names := make(map[string]bool, len(ds.Brands))
+	for i, brand := range ds.Brands {
+		field := fmt.Sprintf("brands[%d]", i)
+		errs = validateImportID(errs, brands, field, brand.ID)
+		name := strings.ToLower(NormalizeName(brand.Name))
+		errs = errs.AppendIf(name == "", field+".name", "name is required")
+		errs = errs.AppendIf(name != "" && names[name], field+".name", "brand name already exists")
+		names[name] = true
+		errs = errs.AppendIf(brand.LeadTimeDays < 0 || brand.LeadTimeDays > MaxLeadTimeDays, field+".lead_time_days", "lead time must be between 0 and 365 days")
+		errs = errs.AppendIf(!validEnergyFactor(brand.EnergyKWhPerKg), field+".energy_kwh_per_kg", "energy must be between 0 and 6 kWh/kg")
+		errs = errs.AppendIf(brand.MinStockBags < 0, field+".min_stock_bags", "minimum stock cannot be negative")
+	}
+
+	purchases := make(map[ID]bool, len(ds.Purchases))
+	for i, purchase := range ds.Purchases {
+		field := fmt.Sprintf("purchases[%d]", i)
+		errs = validateImportID(errs, purchases, field, purchase.ID)
+		errs = errs.AppendIf(!brands[purchase.BrandID], field+".brand_id", "unknown brand")
+		errs = errs.AppendIf(purchase.PurchasedAt.IsZero(), field+".purchased_at", "purchase date is required")
+		if purchase.IsBulk() {
+			errs = errs.AppendIf(purchase.PricePerTonneCents < 0, field+".price_per_tonne_cents", "price per tonne cannot be negative")
+		} else {
+			errs = errs.AppendIf(purchase.Bags <= 0, field+".bags", "bags must be greater than zero")
+			errs = errs.AppendIf(purchaseBagWeight(purchase) <= 0, field+".bag_weight_kg", "bag weight must be greater than zero")
+		}
+		errs = errs.AppendIf(purchase.UnitPriceCents < 0, field+".unit_price_cents", "unit price cannot be negative")
+	}
+
+	consumptions := make(map[ID]bool, len(ds.Consumptions))
+	for i, consumption := range ds.Consumptions {
+		field := fmt.Sprintf("consumptions[%d]", i)
+		errs = validateImportID(errs, consumptions, field, consumption.ID)
+		errs = errs.AppendIf(!brands[consumption.BrandID], field+".brand_id", "unknown brand")
+		errs = errs.AppendIf(consumption.ConsumedAt.IsZero(), field+".consumed_at", "consumption date is required")
+		errs = errs.AppendIf(consumption.Bags < 0 || (consumption.Bags == 0 && consumption.BagsFraction == 0 && consumption.WeightKg <= 0), field+".bags", "bags must be greater than zero")
+		errs = errs.AppendIf(math.IsNaN(consumption.BagsFraction) || consumption.BagsFraction < 0 || consumption.BagsFraction >= 1, field+".bags_fraction", "part of a bag must be between 0 and 1")
+		errs = errs.AppendIf(consumption.WeightKg < 0, field+".weight_kg", "weight cannot be negative")
+		errs = errs.AppendIf(consumption.PowerLevel != 0 && (consumption.PowerLevel < MinPowerLevel || consumption.PowerLevel > MaxPowerLevel), field+".power_level", "power level must be between 1 and 5")
+	}
+
+	transfers := make(map[ID]bool, len(ds.Transfers))
+	for i, transfer := range ds.Transfers {
+		field := fmt.Sprintf("transfers[%d]", i)
+		errs = validateImportID(errs, transfers, field, transfer.ID)
+		errs = errs.AppendIf(!brands[transfer.BrandID], field+".brand_id", "unknown brand")
+		errs = errs.AppendIf(transfer.ToBrandID != "" && !brands[transfer.ToBrandID], field+".to_brand_id", "unknown brand")
+		errs = errs.AppendIf(transfer.TransferredAt.IsZero(), field+".transferred_at", "transfer date is required")
+		errs = errs.AppendIf(transfer.Bags <= 0, field+".bags", "bags must be greater than zero")
+		for j, lot := range transfer.Lots {
+			lotField := fmt.Sprintf("%s.lots[%d]", field, j)
+			errs = errs.AppendIf(!purchases[lot.PurchaseID], lotField+".purchase_id", "unknown purchase")
+			errs = errs.AppendIf(lot.Bags <= 0, lotField+".bags", "bags must be greater than zero")
+		}
+	}
+
+	days := make(map[time.Time]bool, len(ds.Temperatures))
+	for i, temperature := range ds.Temperatures {
+		field := fmt.Sprintf("temperatures[%d]", i)
+		day := startOfDay(temperature.Date)
+		errs = errs.AppendIf(temperature.Date.IsZero(), field+".date", "date is required")
+		errs = errs.AppendIf(days[day], field+".date", "date is recorded twice")
+		days[day] = true
+		errs = errs.AppendIf(math.IsNaN(temperature.MeanC) || temperature.MeanC < minTemperatureC || temperature.MeanC > maxTemperatureC, field+".mean_c", "temperature must be between -60 and 60 °C")
+	}
+
+	occupied := make(map[time.Time]bool, len(ds.Occupancy))
+	for i, occupancy := range ds.Occupancy {
+		field := fmt.Sprintf("occupancy[%d]", i)
+		day := startOfDay(occupancy.Date)
+		errs = errs.AppendIf(occupancy.Date.IsZero(), field+".date", "date is required")
+		errs = errs.AppendIf(occupied[day], field+".date", "date is recorded twice")
+		occupied[day] = true
+		errs = errs.AppendIf(!validOccupancyStatus(occupancy.Status), field+".status", "status must be home, away or vacation")
+	}
+
+	silos := make(map[ID]bool, len(ds.Silos))
+	for i, silo := range ds.Silos {
+		field := fmt.Sprintf("silos[%d]", i)
+		errs = validateImportID(errs, silos, field, silo.ID)
+		errs = errs.AppendIf(NormalizeName(silo.Name) == "", field+".name", "name is required")
+		errs = errs.AppendIf(silo.CapacityKg <= 0, field+".capacity_kg", "capacity must be greater than zero")
+	}
+	for i, reading := range ds.SiloReadings {
+		field := fmt.Sprintf("silo_readings[%d]", i)
+		errs = errs.AppendIf(!silos[reading.SiloID], field+".silo_id", "unknown silo")
+		errs = errs.AppendIf(reading.ReadAt.IsZero(), field+".read_at", "reading date is required")
+		errs = errs.AppendIf(reading.LevelKg < 0, field+".level_kg", "level cannot be negative")
+	}
+	locations := make(map[ID]bool, len(ds.StorageLocations))
+	locationNames := make(map[string]bool, len(ds.StorageLocations))
+	for i, location := range ds.StorageLocations {
+		field := fmt.Sprintf("storage_locations[%d]", i)
+		errs = validateImportID(errs, locations, field, location.ID)
+		name := strings.ToLower(NormalizeName(location.Name))
+		errs = errs.AppendIf(name == "", field+".name", "name is required")
+		errs = errs.AppendIf(name != "" && locationNames[name], field+".name", "location is declared twice")
+		locationNames[name] = true
+	}
+	archives := make(map[int]bool, len(ds.SeasonArchives))
+	for i, archive := range ds.SeasonArchives {
+		field := fmt.Sprintf("season_archives[%d]", i)
+		errs = errs.AppendIf(archive.StartYear <= 0, field+".start_year", "start year is required")
+		errs = errs.AppendIf(archive.StartYear > 0 && archives[archive.StartYear], field+".start_year", "season is archived twice")
+		archives[archive.StartYear] = true
+	}
+	return errs
+}
+
+func validateImportID(errs ValidationErrors, seen map[ID]bool, field string, id ID) ValidationErrors {
+	errs = errs.AppendIf(id == "", field+".id", "id is required")
+	errs = errs.AppendIf(id != "" && seen[id], field+".id", "id is used twice")
+	seen[id] = true
+	return errs
+}
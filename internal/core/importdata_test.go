@@ -0,0 +1,179 @@
+package core_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestImportDataStore(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC)
+	current := core.DataStore{
+		Meta:   core.Meta{ID: "current"},
+		Brands: []core.Brand{{Meta: core.Meta{ID: "brand-a"}, Name: "Granules"}},
+		Purchases: []core.Purchase{
+			{Meta: core.Meta{ID: "purchase-1"}, BrandID: "brand-a", PurchasedAt: at, Bags: 10, BagWeightKg: 15},
+		},
+	}
+	export := core.DataStore{
+		Meta:          core.Meta{ID: "export"},
+		SchemaVersion: core.CurrentSchemaVersion,
+		Brands: []core.Brand{
+			{Meta: core.Meta{ID: "brand-b"}, Name: "granules"},
+			{Meta: core.Meta{ID: "brand-c"}, Name: "Bois Énergie"},
+		},
+		Purchases: []core.Purchase{
+			{Meta: core.Meta{ID: "purchase-1"}, BrandID: "brand-b", PurchasedAt: at, Bags: 10, BagWeightKg: 15},
+			{Meta: core.Meta{ID: "purchase-2"}, BrandID: "brand-b", PurchasedAt: at.AddDate(0, 1, 0), Bags: 5, BagWeightKg: 15},
+		},
+		Consumptions: []core.Consumption{
+			{Meta: core.Meta{ID: "consumption-1"}, BrandID: "brand-c", ConsumedAt: at, Bags: 1},
+		},
+	}
+	dangling := export
+	dangling.Consumptions = []core.Consumption{{Meta: core.Meta{ID: "consumption-2"}, BrandID: "missing", ConsumedAt: at, Bags: 1}}
+	future := export
+	future.SchemaVersion = core.CurrentSchemaVersion + 1
+
+	type params struct {
+		imported core.DataStore
+		mode     core.ImportMode
+	}
+	type want struct {
+		summary   core.ImportSummary
+		brands    int
+		purchases int
+		field     string
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "merges new entries",
+			params: params{imported: export, mode: core.ImportMerge},
+			want: want{
+				summary:   core.ImportSummary{Mode: core.ImportMerge, Brands: 1, Purchases: 1, Consumptions: 1, Skipped: 2},
+				brands:    2,
+				purchases: 2,
+			},
+		},
+		{
+			name:   "replaces everything",
+			params: params{imported: export, mode: core.ImportReplace},
+			want: want{
+				summary:   core.ImportSummary{Mode: core.ImportReplace, Brands: 2, Purchases: 2, Consumptions: 1},
+				brands:    2,
+				purchases: 2,
+			},
+		},
+		{
+			name:   "rejects dangling brand",
+			params: params{imported: dangling, mode: core.ImportReplace},
+			want:   want{brands: 1, purchases: 1, field: "consumptions[0].brand_id", expectErr: true},
+		},
+		{
+			name:   "rejects newer schema",
+			params: params{imported: future, mode: core.ImportMerge},
+			want:   want{brands: 1, purchases: 1, field: "schema_version", expectErr: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := current
+			ds.Brands = append([]core.Brand(nil), current.Brands...)
+			ds.Purchases = append([]core.Purchase(nil), current.Purchases...)
+			summary, err := core.ImportDataStore(&ds, tc.params.imported, tc.params.mode)
+			if tc.want.expectErr {
+				var ve core.ValidationErrors
+				require.ErrorAs(t, err, &ve, tc.name)
+				assert.True(t, ve.Has(tc.want.field), tc.name)
+			} else {
+				require.NoError(t, err, tc.name)
+				assert.Equal(t, tc.want.summary, summary, tc.name)
+			}
+			assert.Len(t, ds.Brands, tc.want.brands, tc.name)
+			assert.Len(t, ds.Purchases, tc.want.purchases, tc.name)
+			brands := map[core.ID]bool{}
+			for _, brand := range ds.Brands {
+				brands[brand.ID] = true
+			}
+			for _, purchase := range ds.Purchases {
+				assert.True(t, brands[purchase.BrandID], tc.name)
+			}
+		})
+	}
+}
+
+func TestValidateDataStore(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC)
+	brand := core.Brand{Meta: core.Meta{ID: "brand-a"}, Name: "Granules"}
+	purchase := core.Purchase{Meta: core.Meta{ID: "purchase-1"}, BrandID: "brand-a", PurchasedAt: at, Bags: 10, BagWeightKg: 15}
+
+	type params struct {
+		ds core.DataStore
+	}
+	type want struct {
+		fields []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "valid", params: params{ds: core.DataStore{Brands: []core.Brand{brand}, Purchases: []core.Purchase{purchase}}}},
+		{
+			name:   "duplicate brand name",
+			params: params{ds: core.DataStore{Brands: []core.Brand{brand, {Meta: core.Meta{ID: "brand-b"}, Name: " granules "}}}},
+			want:   want{fields: []string{"brands[1].name"}},
+		},
+		{
+			name:   "duplicate id",
+			params: params{ds: core.DataStore{Brands: []core.Brand{brand}, Purchases: []core.Purchase{purchase, purchase}}},
+			want:   want{fields: []string{"purchases[1].id"}},
+		},
+		{
+			name: "transfer of unknown lot",
+			params: params{ds: core.DataStore{Brands: []core.Brand{brand}, Transfers: []core.Transfer{{
+				Meta: core.Meta{ID: "transfer-1"}, BrandID: "brand-a", TransferredAt: at, Bags: 2,
+				Lots: []core.TransferLot{{PurchaseID: "missing", Bags: 2}},
+			}}}},
+			want: want{fields: []string{"transfers[0].lots[0].purchase_id"}},
+		},
+		{
+			name:   "purchase without weight",
+			params: params{ds: core.DataStore{Brands: []core.Brand{brand}, Purchases: []core.Purchase{{Meta: core.Meta{ID: "purchase-2"}, BrandID: "brand-a", PurchasedAt: at, Bags: 3}}}},
+			want:   want{fields: []string{"purchases[0].bag_weight_kg"}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			errs := core.ValidateDataStore(&tc.params.ds)
+			fields := []string{}
+			for _, e := range errs {
+				fields = append(fields, e.Field)
+			}
+			assert.ElementsMatch(t, tc.want.fields, fields, tc.name)
+		})
+	}
+}
@@ -0,0 +1,574 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CreateTransferParams contains the fields required to move bags between
+// storage locations or to reclassify them under another brand.
+type CreateTransferParams struct {
+	BrandID ID
+	// ToBrandID is optional; when set the bags are reclassified under it.
+	ToBrandID    ID
+	FromLocation string
+	// ToLocation defaults to FromLocation for a pure brand reclassification.
+	ToLocation    string
+	Bags          int
+	TransferredAt time.Time
+	Notes         string
+}
+
+// LocationInventory summarizes the bags stored in one location. An empty
+// Location groups purchases recorded without one.
+type LocationInventory struct {
+	Location  string           `json:"location"`
+	Bags      int              `json:"bags"`
+	WeightKg  float64          `json:"weight_kg"`
+	TotalCost Money            `json:"total_cost_cents"`
+	Brands    []BrandInventory `json:"brands"`
+}
+
+// AddTransfer records a move of bags between two locations and/or two brands.
+// The source must hold enough bags of the brand at the transfer date; the
+// oldest lots are moved first and recorded on the transfer together with an
+// audit entry.
+func AddTransfer(ds *DataStore, params CreateTransferParams) (Transfer, error) {
+	if ds == nil {
+		return Transfer{}, errors.New("nil datastore")
+	}
+
+	from := canonicalLocation(ds, params.FromLocation)
+	to := canonicalLocation(ds, params.ToLocation)
+	if to == "" {
+		to = from
+	}
+	toBrandID := params.ToBrandID
+	if toBrandID == params.BrandID {
+		toBrandID = ""
+	}
+	errs := ValidationErrors{}
+	errs = errs.AppendIf(!brandExists(ds.Brands, params.BrandID), "brand_id", "unknown brand")
+	errs = errs.AppendIf(toBrandID != "" && !brandExists(ds.Brands, toBrandID), "to_brand_id", "unknown brand")
+	errs = errs.AppendIf(params.Bags <= 0, "bags", "bags must be greater than zero")
+	errs = errs.AppendIf(toBrandID == "" && strings.EqualFold(from, to), "to_location", "destination must differ from source")
+	if !params.TransferredAt.IsZero() {
+		errs = errs.AppendIf(params.TransferredAt.After(time.Now().Add(24*time.Hour)), "transferred_at", "transfer date cannot be in the far future")
+	}
+	if len(errs) > 0 {
+		return Transfer{}, errs
+	}
+
+	now := time.Now().UTC()
+	transferredAt := params.TransferredAt
+	if transferredAt.IsZero() {
+		transferredAt = now
+	}
+
+	transfer := Transfer{
+		Meta: Meta{
+			ID:        NewID(),
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		BrandID:       params.BrandID,
+		ToBrandID:     toBrandID,
+		FromLocation:  from,
+		ToLocation:    to,
+		Bags:          params.Bags,
+		TransferredAt: transferredAt,
+		Notes:         strings.TrimSpace(params.Notes),
+	}
+
+	candidate := *ds
+	candidate.Transfers = append(append([]Transfer(nil), ds.Transfers...), transfer)
+	tracker, err := replayLocations(context.Background(), &candidate)
+	if err != nil {
+		return Transfer{}, err
+	}
+	transfer.Lots = tracker.moved[transfer.ID]
+	candidate.Transfers[len(candidate.Transfers)-1] = transfer
+
+	ds.Transfers = candidate.Transfers
+	sort.Slice(ds.Transfers, func(i, j int) bool {
+		if ds.Transfers[i].TransferredAt.Equal(ds.Transfers[j].TransferredAt) {
+			return string(ds.Transfers[i].ID) > string(ds.Transfers[j].ID)
+		}
+		return ds.Transfers[i].TransferredAt.After(ds.Transfers[j].TransferredAt)
+	})
+	recordAudit(ds, now, AuditActionCreate, AuditEntityTransfer, transfer.ID, describeTransfer(ds, transfer))
+	touchDatastore(ds, now)
+
+	return transfer, nil
+}
+
+func describeTransfer(ds *DataStore, transfer Transfer) string {
+	names := brandNameIndex(ds.Brands)
+	summary := fmt.Sprintf("%d bags of %s", transfer.Bags, names[transfer.BrandID])
+	if transfer.ToBrandID != "" {
+		summary += fmt.Sprintf(" reclassified as %s", names[transfer.ToBrandID])
+	}
+	if !strings.EqualFold(transfer.FromLocation, transfer.ToLocation) {
+		summary += fmt.Sprintf(" moved from %q to %q", transfer.FromLocation, transfer.ToLocation)
+	}
+	return summary
+}
+
+// canonicalLocation normalizes a location name and reuses the spelling already
+// recorded for it so that "garage" and "Garage" designate the same place.
+func canonicalLocation(ds *DataStore, location string) string {
+	location = NormalizeName(location)
+	for _, existing := range Locations(ds) {
+		if strings.EqualFold(existing, location) {
+			return existing
+		}
+	}
+	return location
+}
+
+// Locations returns the distinct storage locations declared or used by
+// purchases, transfers and silos, sorted alphabetically.
+func Locations(ds *DataStore) []string {
+	if ds == nil {
+		return nil
+	}
+	seen := make(map[string]string)
+	add := func(location string) {
+		if location == "" {
+			return
+		}
+		key := strings.ToLower(location)
+		if _, ok := seen[key]; !ok {
+			seen[key] = location
+		}
+	}
+	for _, location := range ds.StorageLocations {
+		add(location.Name)
+	}
+	for _, purchase := range ds.Purchases {
+		add(purchase.Location)
+	}
+	for _, transfer := range ds.Transfers {
+		add(transfer.FromLocation)
+		add(transfer.ToLocation)
+	}
+	for _, silo := range ds.Silos {
+		add(silo.Name)
+	}
+	locations := make([]string, 0, len(seen))
+	for _, location := range seen {
+		locations = append(locations, location)
+	}
+	sort.Slice(locations, func(i, j int) bool { return strings.ToLower(locations[i]) < strings.ToLower(locations[j]) })
+	return locations
+}
+
+// ComputeInventaireParEmplacement breaks the remaining inventory down by
+// storage location. Purchases, transfers and consumptions are replayed
+// chronologically, every purchase being stocked where it was delivered.
+// Transfers move the oldest lots first; consumptions follow the FIFO valuation
+// order and, inside a lot, take the bags that arrived last in a location first
+// since those are the ones brought next to the stove.
+func ComputeInventaireParEmplacement(ctx context.Context, ds *DataStore) ([]LocationInventory, error) {
+	return ComputeInventaireParEmplacementAu(ctx, ds, time.Time{})
+}
+
+// ComputeInventaireParEmplacementAu breaks the inventory down by storage
+// location as it stood at asOf, the history being replayed up to that
+// instant only. A zero asOf gives the current breakdown. The declared
+// locations holding nothing are listed empty.
+func ComputeInventaireParEmplacementAu(ctx context.Context, ds *DataStore, asOf time.Time) ([]LocationInventory, error) {
+	if ds == nil {
+		return nil, nil
+	}
+	tracker, err := replayLocationsUntil(ctx, ds, asOf)
+	if err != nil {
+		return nil, err
+	}
+	results := tracker.summary(ds.Brands)
+	stocked := make(map[string]bool, len(results))
+	for _, entry := range results {
+		stocked[strings.ToLower(entry.Location)] = true
+	}
+	for _, location := range ds.StorageLocations {
+		if !stocked[strings.ToLower(location.Name)] {
+			results = append(results, LocationInventory{Location: location.Name, Brands: []BrandInventory{}})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return strings.ToLower(results[i].Location) < strings.ToLower(results[j].Location)
+	})
+	return results, nil
+}
+
+func replayLocations(ctx context.Context, ds *DataStore) (*locationTracker, error) {
+	return replayLocationsUntil(ctx, ds, time.Time{})
+}
+
+// replayLocationsUntil replays the events recorded up to until, every event
+// when until is zero.
+func replayLocationsUntil(ctx context.Context, ds *DataStore, until time.Time) (*locationTracker, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	events := make([]stockEvent, 0, len(ds.Purchases)+len(ds.Transfers)+len(ds.Consumptions))
+	for _, purchase := range ds.Purchases {
+		events = append(events, stockEvent{at: purchase.PurchasedAt, id: purchase.ID, purchase: &purchase})
+	}
+	for _, transfer := range ds.Transfers {
+		events = append(events, stockEvent{at: transfer.TransferredAt, id: transfer.ID, transfer: &transfer})
+	}
+	for _, consumption := range ds.Consumptions {
+		events = append(events, stockEvent{at: consumption.ConsumedAt, id: consumption.ID, consumption: &consumption})
+	}
+	sortStockEvents(events)
+
+	tracker := &locationTracker{lots: make(map[ID][]*locationLot), moved: make(map[ID][]TransferLot), bulk: make(map[ID]Grams), opened: make(map[ID]*openedLocationBag)}
+	for i, event := range events {
+		if !withinRange(event.at, time.Time{}, until) {
+			break
+		}
+		if i%cancelCheckInterval == cancelCheckInterval-1 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		var err error
+		switch {
+		case event.purchase != nil:
+			tracker.stock(*event.purchase)
+		case event.transfer != nil:
+			err = tracker.transfer(*event.transfer)
+		default:
+			err = tracker.consume(event.consumption.BrandID, event.consumption.Bags)
+			if err == nil {
+				err = tracker.consumePart(*event.consumption)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tracker, nil
+}
+
+// stockEvent is one of the operations replayed in chronological order to
+// rebuild the stock.
+type stockEvent struct {
+	at          time.Time
+	id          ID
+	purchase    *Purchase
+	transfer    *Transfer
+	consumption *Consumption
+}
+
+// rank orders events sharing a timestamp: deliveries first, then moves, then
+// consumptions.
+func (e stockEvent) rank() int {
+	switch {
+	case e.purchase != nil:
+		return 0
+	case e.transfer != nil:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func sortStockEvents(events []stockEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].at.Equal(events[j].at) {
+			return events[i].at.Before(events[j].at)
+		}
+		if events[i].rank() != events[j].rank() {
+			return events[i].rank() < events[j].rank()
+		}
+		return string(events[i].id) < string(events[j].id)
+	})
+}
+
+type locationLot struct {
+	purchaseID   ID
+	purchasedAt  time.Time
+	unitPrice    Money
+	weightPerBag Grams
+	bags         map[string]int
+	// arrivals lists the locations holding bags of the lot, oldest first.
+	arrivals []string
+}
+
+func (l *locationLot) add(location string, bags int) {
+	if l.bags[location] == 0 {
+		l.arrivals = removeLocation(l.arrivals, location)
+		l.arrivals = append(l.arrivals, location)
+	}
+	l.bags[location] += bags
+}
+
+func (l *locationLot) take(location string, bags int) int {
+	taken := min(bags, l.bags[location])
+	l.bags[location] -= taken
+	if l.bags[location] == 0 {
+		delete(l.bags, location)
+		l.arrivals = removeLocation(l.arrivals, location)
+	}
+	return taken
+}
+
+type locationTracker struct {
+	lots map[ID][]*locationLot
+	// moved records the lots taken by each transfer.
+	moved map[ID][]TransferLot
+	// bulk holds the weight left of the bulk deliveries of each brand, burnt
+	// by the consumptions recorded by weight before any bag is opened.
+	bulk map[ID]Grams
+	// opened is the bag the partial consumptions of each brand are taken
+	// from; it has left its location.
+	opened map[ID]*openedLocationBag
+}
+
+type openedLocationBag struct {
+	weight    Grams
+	bagWeight Grams
+}
+
+func (t *locationTracker) stock(purchase Purchase) {
+	if purchase.IsBulk() {
+		t.bulk[purchase.BrandID] += GramsFromKg(purchase.TotalWeightKg)
+		return
+	}
+	if purchase.Bags <= 0 {
+		return
+	}
+	lot := &locationLot{
+		purchaseID:   purchase.ID,
+		purchasedAt:  purchase.PurchasedAt,
+		unitPrice:    purchase.UnitPriceCents,
+		weightPerBag: purchaseBagWeight(purchase),
+		bags:         make(map[string]int),
+	}
+	lot.add(purchase.Location, purchase.Bags)
+	t.lots[purchase.BrandID] = append(t.lots[purchase.BrandID], lot)
+}
+
+// transfer moves bags out of the source location, following the lots recorded
+// on the transfer when present and the oldest lots otherwise.
+func (t *locationTracker) transfer(transfer Transfer) error {
+	var moved []TransferLot
+	if len(transfer.Lots) > 0 {
+		for _, recorded := range transfer.Lots {
+			lot := findLocationLot(t.lots[transfer.BrandID], recorded.PurchaseID)
+			if lot == nil || lot.take(transfer.FromLocation, recorded.Bags) < recorded.Bags {
+				return ErrInsufficientInventory
+			}
+			t.place(transfer, lot, recorded.Bags)
+			moved = append(moved, recorded)
+		}
+	} else {
+		remaining := transfer.Bags
+		for _, lot := range t.lots[transfer.BrandID] {
+			if remaining == 0 {
+				break
+			}
+			if taken := lot.take(transfer.FromLocation, remaining); taken > 0 {
+				t.place(transfer, lot, taken)
+				moved = append(moved, TransferLot{PurchaseID: lot.purchaseID, Bags: taken, UnitPrice: lot.unitPrice})
+				remaining -= taken
+			}
+		}
+		if remaining > 0 {
+			return ErrInsufficientInventory
+		}
+	}
+	t.moved[transfer.ID] = moved
+	return nil
+}
+
+// place stores bags taken from lot at the destination of the transfer, under
+// the target brand.
+func (t *locationTracker) place(transfer Transfer, lot *locationLot, bags int) {
+	target := transfer.TargetBrandID()
+	if target == transfer.BrandID {
+		lot.add(transfer.ToLocation, bags)
+		return
+	}
+	dest := findLocationLot(t.lots[target], lot.purchaseID)
+	if dest == nil {
+		dest = &locationLot{
+			purchaseID:   lot.purchaseID,
+			purchasedAt:  lot.purchasedAt,
+			unitPrice:    lot.unitPrice,
+			weightPerBag: lot.weightPerBag,
+			bags:         make(map[string]int),
+		}
+		lots := append(t.lots[target], dest)
+		sort.SliceStable(lots, func(i, j int) bool { return lots[i].purchasedAt.Before(lots[j].purchasedAt) })
+		t.lots[target] = lots
+	}
+	dest.add(transfer.ToLocation, bags)
+}
+
+func (t *locationTracker) consume(brandID ID, bags int) error {
+	remaining := bags
+	for _, lot := range t.lots[brandID] {
+		for remaining > 0 && len(lot.arrivals) > 0 {
+			remaining -= lot.take(lot.arrivals[len(lot.arrivals)-1], remaining)
+		}
+		if remaining == 0 {
+			return nil
+		}
+	}
+	if remaining > 0 {
+		return ErrInsufficientInventory
+	}
+	return nil
+}
+
+// consumePart takes the part of a bag of a consumption, or the weight of a
+// consumption recorded by weight alone, from the opened bag of the brand,
+// opening the next bag when it is empty. Like the valuation, the weight is
+// taken from the bulk deliveries first and the weight exceeding the stock is
+// ignored.
+func (t *locationTracker) consumePart(consumption Consumption) error {
+	brandID := consumption.BrandID
+	switch {
+	case consumption.BagsFraction > 0:
+		bagWeight := t.openingWeight(brandID)
+		if bagWeight <= 0 {
+			return ErrInsufficientInventory
+		}
+		if t.takeOpened(brandID, Grams(math.Round(consumption.BagsFraction*float64(bagWeight)))) > 0 {
+			return ErrInsufficientInventory
+		}
+	case consumption.Bags == 0 && consumption.WeightKg > 0:
+		weight := GramsFromKg(consumption.WeightKg)
+		fromBulk := min(weight, t.bulk[brandID])
+		t.bulk[brandID] -= fromBulk
+		t.takeOpened(brandID, weight-fromBulk)
+	}
+	return nil
+}
+
+// openingWeight returns the weight of the bag the next part is taken from.
+func (t *locationTracker) openingWeight(brandID ID) Grams {
+	if bag := t.opened[brandID]; bag != nil && bag.weight > 0 {
+		return bag.bagWeight
+	}
+	for _, lot := range t.lots[brandID] {
+		if len(lot.arrivals) > 0 {
+			return lot.weightPerBag
+		}
+	}
+	return 0
+}
+
+// takeOpened takes weight from the opened bag of the brand, opening the
+// oldest bag left as it empties, and returns the weight left once no bag is.
+func (t *locationTracker) takeOpened(brandID ID, weight Grams) Grams {
+	for weight > 0 {
+		bag := t.opened[brandID]
+		if bag == nil || bag.weight <= 0 {
+			bag = t.openBag(brandID)
+			if bag == nil {
+				return weight
+			}
+			t.opened[brandID] = bag
+		}
+		take := min(weight, bag.weight)
+		bag.weight -= take
+		weight -= take
+	}
+	return 0
+}
+
+func (t *locationTracker) openBag(brandID ID) *openedLocationBag {
+	for _, lot := range t.lots[brandID] {
+		if len(lot.arrivals) == 0 || lot.weightPerBag <= 0 {
+			continue
+		}
+		lot.take(lot.arrivals[len(lot.arrivals)-1], 1)
+		return &openedLocationBag{weight: lot.weightPerBag, bagWeight: lot.weightPerBag}
+	}
+	return nil
+}
+
+func (t *locationTracker) summary(brands []Brand) []LocationInventory {
+	brandNames := brandNameIndex(brands)
+
+	type brandTotals struct {
+		bags   int
+		weight Grams
+		cost   Money
+	}
+	byLocation := make(map[string]map[ID]*brandTotals)
+	for brandID, lots := range t.lots {
+		for _, lot := range lots {
+			for location, bags := range lot.bags {
+				if byLocation[location] == nil {
+					byLocation[location] = make(map[ID]*brandTotals)
+				}
+				totals := byLocation[location][brandID]
+				if totals == nil {
+					totals = &brandTotals{}
+					byLocation[location][brandID] = totals
+				}
+				totals.bags += bags
+				totals.weight += lot.weightPerBag.MulInt(bags)
+				totals.cost += lot.unitPrice.MulInt(bags)
+			}
+		}
+	}
+
+	results := make([]LocationInventory, 0, len(byLocation))
+	for location, brandsTotals := range byLocation {
+		entry := LocationInventory{Location: location}
+		var weight Grams
+		for brandID, totals := range brandsTotals {
+			entry.Brands = append(entry.Brands, BrandInventory{
+				BrandID:   brandID,
+				BrandName: brandNames[brandID],
+				Bags:      totals.bags,
+				WeightKg:  totals.weight.Kg(),
+				TotalCost: totals.cost,
+			})
+			entry.Bags += totals.bags
+			weight += totals.weight
+			entry.TotalCost += totals.cost
+		}
+		entry.WeightKg = weight.Kg()
+		sort.Slice(entry.Brands, func(i, j int) bool {
+			if entry.Brands[i].BrandName == entry.Brands[j].BrandName {
+				return string(entry.Brands[i].BrandID) < string(entry.Brands[j].BrandID)
+			}
+			return entry.Brands[i].BrandName < entry.Brands[j].BrandName
+		})
+		results = append(results, entry)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return strings.ToLower(results[i].Location) < strings.ToLower(results[j].Location)
+	})
+	return results
+}
+
+func findLocationLot(lots []*locationLot, purchaseID ID) *locationLot {
+	for _, lot := range lots {
+		if lot.purchaseID == purchaseID {
+			return lot
+		}
+	}
+	return nil
+}
+
+func removeLocation(locations []string, location string) []string {
+	for i, l := range locations {
+		if l == location {
+			return append(locations[:i], locations[i+1:]...)
+		}
+	}
+	return locations
+}
@@ -0,0 +1,283 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestAddTransfer(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		input core.CreateTransferParams
+	}
+	type want struct {
+		err             error
+		validationField string
+		from            string
+		to              string
+		reclassified    bool
+		lots            []core.TransferLot
+	}
+
+	jan15 := time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC)
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "moves bags between locations",
+			params: params{input: core.CreateTransferParams{FromLocation: " garage ", ToLocation: "cave", Bags: 2, TransferredAt: jan15}},
+			want:   want{from: "Garage", to: "Cave", lots: []core.TransferLot{{Bags: 2, UnitPrice: 550}}},
+		},
+		{
+			name:   "reclassifies bags in place",
+			params: params{input: core.CreateTransferParams{FromLocation: "Garage", Bags: 3, TransferredAt: jan15}},
+			want:   want{from: "Garage", to: "Garage", reclassified: true, lots: []core.TransferLot{{Bags: 3, UnitPrice: 550}}},
+		},
+		{
+			name:   "rejects moving more bags than stored",
+			params: params{input: core.CreateTransferParams{FromLocation: "Garage", ToLocation: "Cave", Bags: 6, TransferredAt: jan15}},
+			want:   want{err: core.ErrInsufficientInventory},
+		},
+		{
+			name:   "rejects moving bags not yet delivered",
+			params: params{input: core.CreateTransferParams{FromLocation: "Cave", ToLocation: "Garage", Bags: 1, TransferredAt: jan15}},
+			want:   want{err: core.ErrInsufficientInventory},
+		},
+		{
+			name:   "rejects identical locations",
+			params: params{input: core.CreateTransferParams{FromLocation: "Garage", ToLocation: "garage", Bags: 1, TransferredAt: jan15}},
+			want:   want{validationField: "to_location"},
+		},
+		{
+			name:   "requires a destination",
+			params: params{input: core.CreateTransferParams{FromLocation: "Garage", Bags: 1, TransferredAt: jan15}},
+			want:   want{validationField: "to_location"},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := locationDataStore(t)
+			input := tc.params.input
+			input.BrandID = ds.Brands[0].ID
+			if tc.want.reclassified {
+				target, err := core.AddBrand(&ds, core.CreateBrandParams{Name: "Pellets Pro"})
+				require.NoError(t, err, tc.name)
+				input.ToBrandID = target.ID
+			}
+
+			transfer, err := core.AddTransfer(&ds, input)
+			if tc.want.err != nil {
+				assert.ErrorIs(t, err, tc.want.err, tc.name)
+				assert.Empty(t, ds.Transfers, tc.name)
+				return
+			}
+			if tc.want.validationField != "" {
+				var vErr core.ValidationErrors
+				require.ErrorAs(t, err, &vErr, tc.name)
+				assert.True(t, vErr.Has(tc.want.validationField), tc.name)
+				assert.Empty(t, ds.Transfers, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.from, transfer.FromLocation, tc.name)
+			assert.Equal(t, tc.want.to, transfer.ToLocation, tc.name)
+			assert.Len(t, ds.Transfers, 1, tc.name)
+			for i := range transfer.Lots {
+				transfer.Lots[i].PurchaseID = ""
+			}
+			assert.Equal(t, tc.want.lots, transfer.Lots, tc.name)
+			require.Len(t, ds.Audit, 1, tc.name)
+			assert.Equal(t, transfer.ID, ds.Audit[0].EntityID, tc.name)
+		})
+	}
+}
+
+func TestComputeInventaireParEmplacement(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		transfers []core.CreateTransferParams
+		declared  []string
+	}
+	type want struct {
+		locations []string
+		bags      []int
+		cost      []core.Money
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "keeps purchases where they were delivered",
+			want: want{
+				locations: []string{"Cave", "Garage"},
+				bags:      []int{3, 3},
+				cost:      []core.Money{1800, 1650},
+			},
+		},
+		{
+			name: "consumes the bags moved last first",
+			params: params{transfers: []core.CreateTransferParams{{
+				FromLocation:  "Garage",
+				ToLocation:    "Cellier",
+				Bags:          4,
+				TransferredAt: time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC),
+			}}},
+			want: want{
+				locations: []string{"Cave", "Cellier", "Garage"},
+				bags:      []int{3, 2, 1},
+				cost:      []core.Money{1800, 1100, 550},
+			},
+		},
+		{
+			name:   "lists the declared locations left empty",
+			params: params{declared: []string{"Abri", "garage"}},
+			want: want{
+				locations: []string{"Abri", "Cave", "Garage"},
+				bags:      []int{0, 3, 3},
+				cost:      []core.Money{0, 1800, 1650},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := locationDataStore(t)
+			for _, transfer := range tc.params.transfers {
+				transfer.BrandID = ds.Brands[0].ID
+				_, err := core.AddTransfer(&ds, transfer)
+				require.NoError(t, err, tc.name)
+			}
+			for _, name := range tc.params.declared {
+				_, err := core.AddStorageLocation(&ds, core.StorageLocationParams{Name: name})
+				require.NoError(t, err, tc.name)
+			}
+
+			inventory, err := core.ComputeInventaireParEmplacement(context.Background(), &ds)
+			require.NoError(t, err, tc.name)
+
+			var locations []string
+			var bags []int
+			var cost []core.Money
+			for _, entry := range inventory {
+				locations = append(locations, entry.Location)
+				bags = append(bags, entry.Bags)
+				cost = append(cost, entry.TotalCost)
+			}
+			assert.Equal(t, tc.want.locations, locations, tc.name)
+			assert.Equal(t, tc.want.bags, bags, tc.name)
+			assert.Equal(t, tc.want.cost, cost, tc.name)
+		})
+	}
+}
+
+func TestComputeInventaireParEmplacementAu(t *testing.T) {
+	t.Parallel()
+
+	ds := locationDataStore(t)
+
+	type params struct {
+		asOf time.Time
+	}
+	type want struct {
+		locations []string
+		bags      []int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "reports the current breakdown without date",
+			want: want{locations: []string{"Cave", "Garage"}, bags: []int{3, 3}},
+		},
+		{
+			name:   "replays the history up to the date",
+			params: params{asOf: time.Date(2024, time.February, 10, 0, 0, 0, 0, time.UTC)},
+			want:   want{locations: []string{"Cave", "Garage"}, bags: []int{3, 5}},
+		},
+		{
+			name:   "ignores the deliveries made later",
+			params: params{asOf: time.Date(2024, time.January, 31, 0, 0, 0, 0, time.UTC)},
+			want:   want{locations: []string{"Garage"}, bags: []int{5}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			inventory, err := core.ComputeInventaireParEmplacementAu(context.Background(), &ds, tc.params.asOf)
+			require.NoError(t, err, tc.name)
+
+			var locations []string
+			var bags []int
+			for _, entry := range inventory {
+				locations = append(locations, entry.Location)
+				bags = append(bags, entry.Bags)
+			}
+			assert.Equal(t, tc.want.locations, locations, tc.name)
+			assert.Equal(t, tc.want.bags, bags, tc.name)
+		})
+	}
+}
+
+func locationDataStore(t *testing.T) core.DataStore {
+	t.Helper()
+
+	ds := core.DataStore{}
+	brand, err := core.AddBrand(&ds, core.CreateBrandParams{Name: "Granules"})
+	require.NoError(t, err, "seed brand")
+
+	_, err = core.AddPurchase(&ds, core.CreatePurchaseParams{
+		BrandID:     brand.ID,
+		PurchasedAt: time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC),
+		Bags:        5,
+		BagWeightKg: 15,
+		UnitPrice:   core.Money(550),
+		Location:    "Garage",
+	})
+	require.NoError(t, err, "seed garage purchase")
+
+	_, err = core.AddPurchase(&ds, core.CreatePurchaseParams{
+		BrandID:     brand.ID,
+		PurchasedAt: time.Date(2024, time.February, 5, 0, 0, 0, 0, time.UTC),
+		Bags:        3,
+		BagWeightKg: 15,
+		UnitPrice:   core.Money(600),
+		Location:    "Cave",
+	})
+	require.NoError(t, err, "seed cellar purchase")
+
+	_, err = core.AddConsumption(&ds, core.CreateConsumptionParams{
+		BrandID:    brand.ID,
+		ConsumedAt: time.Date(2024, time.February, 20, 0, 0, 0, 0, time.UTC),
+		Bags:       2,
+	})
+	require.NoError(t, err, "seed consumption")
+
+	return ds
+}
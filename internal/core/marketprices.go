@@ -0,0 +1,52 @@
+package core
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// MarketPrice is the price of a tonne of pellets on the market over a month,
+// as published by a public price index.
+type MarketPrice struct {
+	// Month is the first day of the month, in UTC.
+	Month              time.Time `json:"month"`
+	PricePerTonneCents Money     `json:"price_per_tonne_cents"`
+	// Source tells where the price comes from, the URL of the index.
+	Source string `json:"source,omitempty"`
+}
+
+// SetMarketPrices records monthly market prices, replacing the price of a
+// month already known, and returns the number of months stored. Prices dated
+// within a month are stored on its first day.
+func SetMarketPrices(ds *DataStore, prices []MarketPrice) (int, error) {
+	if ds == nil {
+		return 0, errors.New("nil datastore")
+	}
+	errs := ValidationErrors{}
+	for _, price := range prices {
+		errs = errs.AppendIf(price.Month.IsZero(), "month", "month is required")
+		errs = errs.AppendIf(price.PricePerTonneCents <= 0, "price_per_tonne_cents", "price must be positive")
+	}
+	if len(errs) > 0 {
+		return 0, errs
+	}
+
+	byMonth := make(map[time.Time]int, len(ds.MarketPrices))
+	for i, price := range ds.MarketPrices {
+		byMonth[price.Month] = i
+	}
+	for _, price := range prices {
+		month := price.Month.UTC()
+		price.Month = time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+		if i, ok := byMonth[price.Month]; ok {
+			ds.MarketPrices[i] = price
+			continue
+		}
+		byMonth[price.Month] = len(ds.MarketPrices)
+		ds.MarketPrices = append(ds.MarketPrices, price)
+	}
+	sort.Slice(ds.MarketPrices, func(i, j int) bool { return ds.MarketPrices[i].Month.Before(ds.MarketPrices[j].Month) })
+	touchDatastore(ds, time.Now().UTC())
+	return len(prices), nil
+}
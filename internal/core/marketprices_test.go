@@ -0,0 +1,76 @@
+package core_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestSetMarketPrices(t *testing.T) {
+	t.Parallel()
+
+	month := func(m time.Month) time.Time { return time.Date(2024, m, 1, 0, 0, 0, 0, time.UTC) }
+
+	type params struct {
+		existing []core.MarketPrice
+		recorded []core.MarketPrice
+	}
+	type want struct {
+		prices    []core.MarketPrice
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "records months in order",
+			params: params{recorded: []core.MarketPrice{
+				{Month: month(time.February).AddDate(0, 0, 14), PricePerTonneCents: 41000, Source: "index"},
+				{Month: month(time.January), PricePerTonneCents: 40000, Source: "index"},
+			}},
+			want: want{prices: []core.MarketPrice{
+				{Month: month(time.January), PricePerTonneCents: 40000, Source: "index"},
+				{Month: month(time.February), PricePerTonneCents: 41000, Source: "index"},
+			}},
+		},
+		{
+			name: "replaces a known month",
+			params: params{
+				existing: []core.MarketPrice{{Month: month(time.January), PricePerTonneCents: 40000}},
+				recorded: []core.MarketPrice{{Month: month(time.January), PricePerTonneCents: 39500}},
+			},
+			want: want{prices: []core.MarketPrice{{Month: month(time.January), PricePerTonneCents: 39500}}},
+		},
+		{
+			name: "rejects a price that is not positive",
+			params: params{
+				existing: []core.MarketPrice{{Month: month(time.January), PricePerTonneCents: 40000}},
+				recorded: []core.MarketPrice{{Month: month(time.February), PricePerTonneCents: 41000}, {Month: month(time.March)}},
+			},
+			want: want{expectErr: true, prices: []core.MarketPrice{{Month: month(time.January), PricePerTonneCents: 40000}}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := core.DataStore{MarketPrices: append([]core.MarketPrice(nil), tc.params.existing...)}
+			_, err := core.SetMarketPrices(&ds, tc.params.recorded)
+			if tc.want.expectErr {
+				require.Error(t, err, tc.name)
+			} else {
+				require.NoError(t, err, tc.name)
+			}
+			assert.Equal(t, tc.want.prices, ds.MarketPrices, tc.name)
+		})
+	}
+}
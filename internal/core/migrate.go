@@ -0,0 +1,50 @@
+package core
+
+import "context"
+
+// CurrentSchemaVersion is the datastore layout written by this version.
+//
+//   - 1: consumptions carry the weight they burnt (Consumption.WeightKg).
+const CurrentSchemaVersion = 1
+
+// MigrateDataStore upgrades a datastore read from disk to
+// CurrentSchemaVersion and reports whether it changed. Migrations never fail:
+// data they cannot upgrade keeps a meaning the current code still handles.
+func MigrateDataStore(ds *DataStore) bool {
+	if ds == nil || ds.SchemaVersion >= CurrentSchemaVersion {
+		return false
+	}
+	if ds.SchemaVersion < 1 {
+		backfillConsumptionWeights(ds)
+	}
+	ds.SchemaVersion = CurrentSchemaVersion
+	return true
+}
+
+// backfillConsumptionWeights records on every consumption the weight of the
+// bags FIFO assigned to it, so the weight burnt in the past no longer moves
+// when a purchase is edited afterwards. When the history cannot be replayed
+// the weights stay unset, which still counts whole bags.
+func backfillConsumptionWeights(ds *DataStore) {
+	calculations, _, err := computeFIFOResults(context.Background(), ds)
+	if err != nil {
+		return
+	}
+	bagWeights := make(map[ID]Grams, len(ds.Purchases))
+	for _, purchase := range ds.Purchases {
+		bagWeights[purchase.ID] = purchaseBagWeight(purchase)
+	}
+	weights := make(map[ID]Grams, len(calculations))
+	for _, calc := range calculations {
+		var weight Grams
+		for _, allocation := range calc.allocations {
+			weight += bagWeights[allocation.PurchaseID].MulInt(allocation.Bags)
+		}
+		weights[calc.consumption.ID] = weight
+	}
+	for i := range ds.Consumptions {
+		if ds.Consumptions[i].WeightKg == 0 {
+			ds.Consumptions[i].WeightKg = weights[ds.Consumptions[i].ID].Kg()
+		}
+	}
+}
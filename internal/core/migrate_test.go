@@ -0,0 +1,78 @@
+package core_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestMigrateDataStore(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		datastore func(t *testing.T) core.DataStore
+	}
+	type want struct {
+		changed bool
+		weights []float64
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "backfills consumption weights from fifo lots",
+			params: params{datastore: sampleDataStore},
+			want:   want{changed: true, weights: []float64{30}},
+		},
+		{
+			name: "keeps recorded weights",
+			params: params{datastore: func(t *testing.T) core.DataStore {
+				ds := sampleDataStore(t)
+				ds.Consumptions[0].WeightKg = 29.35
+				return ds
+			}},
+			want: want{changed: true, weights: []float64{29.35}},
+		},
+		{
+			name: "leaves weights unset when history cannot be replayed",
+			params: params{datastore: func(t *testing.T) core.DataStore {
+				ds := sampleDataStore(t)
+				ds.Consumptions[0].Bags = 50
+				return ds
+			}},
+			want: want{changed: true, weights: []float64{0}},
+		},
+		{
+			name: "skips current schema",
+			params: params{datastore: func(t *testing.T) core.DataStore {
+				ds := sampleDataStore(t)
+				ds.SchemaVersion = core.CurrentSchemaVersion
+				return ds
+			}},
+			want: want{weights: []float64{0}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := tc.params.datastore(t)
+			changed := core.MigrateDataStore(&ds)
+
+			assert.Equal(t, tc.want.changed, changed, tc.name)
+			assert.Equal(t, core.CurrentSchemaVersion, ds.SchemaVersion, tc.name)
+			weights := make([]float64, len(ds.Consumptions))
+			for i, consumption := range ds.Consumptions {
+				weights[i] = consumption.WeightKg
+			}
+			assert.Equal(t, tc.want.weights, weights, tc.name)
+		})
+	}
+}
@@ -12,11 +12,20 @@ import (
 // ID represents the identifier type for domain entities.
 type ID string
 
-// Meta captures metadata for persisted entities.
+// Meta captures metadata for persisted entities. Revision counts the updates
+// of the entity, absent until the first one; an update may carry the
+// revision it was based on to be rejected when the entity changed since.
 type Meta struct {
 	ID        ID        `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	Revision  int64     `json:"revision,omitempty"`
+}
+
+// touch records an update of the entity at now.
+func (m *Meta) touch(now time.Time) {
+	m.UpdatedAt = now
+	m.Revision++
 }
 
 // Money represents a monetary amount stored in euro cents.
@@ -37,6 +46,30 @@ func (m Money) MulInt(count int) Money {
 	return Money(int64(m) * int64(count))
 }
 
+// DivInt splits the amount into count equal shares rounded half to even; it
+// returns zero when count is not positive.
+func (m Money) DivInt(count int) Money {
+	if count <= 0 {
+		return 0
+	}
+	return Money(int64(roundHalfEven(float64(m) / float64(count))))
+}
+
+// DivBags splits the amount over a count of bags that can include the part
+// of a bag, rounded half to even; it returns zero when bags is not positive.
+func (m Money) DivBags(bags float64) Money {
+	if bags <= 0 {
+		return 0
+	}
+	return Money(int64(roundHalfEven(float64(m) / bags)))
+}
+
+// WeightPrice returns the price of weight at perTonne cents per tonne,
+// rounded to the cent.
+func WeightPrice(weight Grams, perTonne Money) Money {
+	return Money(int64(roundHalfEven(float64(perTonne) * float64(weight) / 1e6)))
+}
+
 // ParseMoney converts a float euro amount into Money using round half even.
 func ParseMoney(amount float64) Money {
 	return Money(int64(roundHalfEven(amount * 100)))
@@ -48,6 +81,51 @@ type Brand struct {
 	Name        string `json:"name"`
 	Description string `json:"description,omitempty"`
 	ImageBase64 string `json:"image_base64,omitempty"`
+	// LeadTimeDays is the usual delay between ordering from the supplier and
+	// the delivery.
+	LeadTimeDays int `json:"lead_time_days,omitempty"`
+	// EnergyKWhPerKg is the heat released by one kilogram of the pellets,
+	// zero for DefaultEnergyKWhPerKg.
+	EnergyKWhPerKg float64 `json:"energy_kwh_per_kg,omitempty"`
+	// MinStockBags raises a low stock alert once fewer bags of the brand are
+	// left, zero disables it.
+	MinStockBags int `json:"min_stock_bags,omitempty"`
+	// Gallery holds more pictures of the brand, such as its bags or its
+	// certification labels, next to ImageBase64.
+	Gallery []Photo `json:"gallery,omitempty"`
+	// Archived hides a brand no longer bought from the forms and the default
+	// listings; its purchases and consumptions still count everywhere.
+	Archived bool `json:"archived,omitempty"`
+}
+
+// MaxLeadTimeDays bounds the supplier lead time of a brand.
+const MaxLeadTimeDays = 365
+
+// DefaultEnergyKWhPerKg is the typical net calorific value of wood pellets,
+// used for brands without their own figure. MaxEnergyKWhPerKg rejects values
+// no wood pellet reaches.
+const (
+	DefaultEnergyKWhPerKg = 4.8
+	MaxEnergyKWhPerKg     = 6.0
+)
+
+// EnergyFactor returns the kWh released per kilogram of the brand.
+func (b Brand) EnergyFactor() float64 {
+	if b.EnergyKWhPerKg > 0 {
+		return b.EnergyKWhPerKg
+	}
+	return DefaultEnergyKWhPerKg
+}
+
+// ActiveBrands returns the brands that are not archived, in their order.
+func ActiveBrands(brands []Brand) []Brand {
+	active := make([]Brand, 0, len(brands))
+	for _, brand := range brands {
+		if !brand.Archived {
+			active = append(active, brand)
+		}
+	}
+	return active
 }
 
 // Purchase records a pellets purchase.
@@ -60,7 +138,31 @@ type Purchase struct {
 	TotalWeightKg   float64   `json:"total_weight_kg"`
 	UnitPriceCents  Money     `json:"unit_price_cents"`
 	TotalPriceCents Money     `json:"total_price_cents"`
-	Notes           string    `json:"notes,omitempty"`
+	// PricePerTonneCents prices a bulk delivery, weighed rather than counted
+	// in bags: Bags, BagWeightKg and UnitPriceCents are zero then.
+	PricePerTonneCents Money `json:"price_per_tonne_cents,omitempty"`
+	// Location is the storage place the bags were put in on delivery.
+	Location string `json:"location,omitempty"`
+	Notes    string `json:"notes,omitempty"`
+	// Photos keeps the pictures of the receipt or of the bags delivered.
+	Photos []Photo `json:"photos,omitempty"`
+}
+
+// Photo is a picture attached to a brand or to a purchase.
+type Photo struct {
+	ID          ID        `json:"id"`
+	AddedAt     time.Time `json:"added_at"`
+	Caption     string    `json:"caption,omitempty"`
+	ImageBase64 string    `json:"image_base64"`
+	// ThumbnailBase64 is a small copy of the image shown in the lists, the
+	// image itself when empty.
+	ThumbnailBase64 string `json:"thumbnail_base64,omitempty"`
+}
+
+// IsBulk reports whether the purchase is a bulk delivery, such as pellets
+// blown into a silo, tracked by weight instead of bags.
+func (p Purchase) IsBulk() bool {
+	return p.Bags == 0 && p.TotalWeightKg > 0
 }
 
 // MarshalJSON emits both the per-bag and total weight fields while keeping
@@ -93,10 +195,10 @@ func (p *Purchase) UnmarshalJSON(data []byte) error {
 		p.TotalWeightKg = aux.WeightKg
 	}
 	if p.BagWeightKg == 0 && p.Bags > 0 && p.TotalWeightKg > 0 {
-		p.BagWeightKg = p.TotalWeightKg / float64(p.Bags)
+		p.BagWeightKg = GramsFromKg(p.TotalWeightKg).DivInt(p.Bags).Kg()
 	}
 	if p.TotalWeightKg == 0 && p.BagWeightKg > 0 && p.Bags > 0 {
-		p.TotalWeightKg = p.BagWeightKg * float64(p.Bags)
+		p.TotalWeightKg = GramsFromKg(p.BagWeightKg).MulInt(p.Bags).Kg()
 	}
 	return nil
 }
@@ -107,15 +209,176 @@ type Consumption struct {
 	BrandID    ID        `json:"brand_id"`
 	ConsumedAt time.Time `json:"consumed_at"`
 	Bags       int       `json:"bags"`
-	Notes      string    `json:"notes,omitempty"`
+	// BagsFraction is the part of a bag burnt on top of Bags, below one, for
+	// a hopper filled with a bag and a half.
+	BagsFraction float64 `json:"bags_fraction,omitempty"`
+	// WeightKg is the weight actually burnt. Zero means whole bags at the
+	// weight of the lots they are taken from. Without bags, it is taken from
+	// a bulk delivery or from opened bags.
+	WeightKg float64 `json:"weight_kg,omitempty"`
+	// PowerLevel is the stove power setting used, zero when not recorded.
+	PowerLevel int    `json:"power_level,omitempty"`
+	Notes      string `json:"notes,omitempty"`
+}
+
+// TotalBags returns the bags burnt, the part of a bag included.
+func (c Consumption) TotalBags() float64 {
+	return float64(c.Bags) + c.BagsFraction
 }
 
+// Bounds of the stove power setting recorded on consumptions.
+const (
+	MinPowerLevel = 1
+	MaxPowerLevel = 5
+)
+
+// Transfer moves bags of a brand from one storage location to another, or
+// reclassifies them under another brand when they were recorded under the
+// wrong one.
+type Transfer struct {
+	Meta
+	BrandID ID `json:"brand_id"`
+	// ToBrandID is set when the bags are reclassified under another brand.
+	ToBrandID     ID        `json:"to_brand_id,omitempty"`
+	FromLocation  string    `json:"from_location"`
+	ToLocation    string    `json:"to_location"`
+	Bags          int       `json:"bags"`
+	TransferredAt time.Time `json:"transferred_at"`
+	// Lots records which purchase lots were moved, oldest first, so that the
+	// FIFO valuation follows the bags.
+	Lots  []TransferLot `json:"lots,omitempty"`
+	Notes string        `json:"notes,omitempty"`
+}
+
+// TargetBrandID returns the brand the bags belong to after the transfer.
+func (t Transfer) TargetBrandID() ID {
+	if t.ToBrandID != "" {
+		return t.ToBrandID
+	}
+	return t.BrandID
+}
+
+// TransferLot is the part of a purchase lot moved by a transfer.
+type TransferLot struct {
+	PurchaseID ID    `json:"purchase_id"`
+	Bags       int   `json:"bags"`
+	UnitPrice  Money `json:"unit_price_cents"`
+}
+
+// AuditEntry traces an operation that moved stock without a purchase or a
+// consumption, or a purchase or a consumption moved to another brand.
+type AuditEntry struct {
+	ID       ID        `json:"id"`
+	At       time.Time `json:"at"`
+	Action   string    `json:"action"`
+	Entity   string    `json:"entity"`
+	EntityID ID        `json:"entity_id"`
+	Summary  string    `json:"summary"`
+}
+
+// User is an account allowed to modify the data once authentication is
+// enabled. Only the bcrypt hash of its password is kept.
+type User struct {
+	Meta
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash"`
+	// Role is empty for the accounts created before roles, which keep
+	// every right: see AccessRole.
+	Role Role `json:"role,omitempty"`
+}
+
+// Role sets what an account may change. Reads are open to every role.
+type Role string
+
+// Roles, from the least to the most trusted.
+const (
+	// RoleViewer only reads.
+	RoleViewer Role = "viewer"
+	// RoleEditor also records purchases, consumptions and the other entries
+	// and edits them.
+	RoleEditor Role = "editor"
+	// RoleAdmin also deletes, imports, undoes and manages the accounts.
+	RoleAdmin Role = "admin"
+)
+
+// MaxUsernameLength bounds the length of a username.
+const MaxUsernameLength = 64
+
+// APIToken lets a script act as a user through an Authorization: Bearer
+// header. Only the SHA-256 hash of the token is kept; the token itself is
+// shown once, when it is created.
+type APIToken struct {
+	Meta
+	UserID ID     `json:"user_id"`
+	Name   string `json:"name"`
+	Hash   string `json:"hash"`
+}
+
+// MaxAPITokenNameLength bounds the length of an API token name.
+const MaxAPITokenNameLength = 64
+
 // DataStore contains the complete persisted dataset.
 type DataStore struct {
 	Meta
-	Brands       []Brand       `json:"brands"`
-	Purchases    []Purchase    `json:"purchases"`
-	Consumptions []Consumption `json:"consumptions"`
+	// SchemaVersion is the layout revision the datastore was written with,
+	// see MigrateDataStore.
+	SchemaVersion int           `json:"schema_version,omitempty"`
+	Brands        []Brand       `json:"brands"`
+	Purchases     []Purchase    `json:"purchases"`
+	Consumptions  []Consumption `json:"consumptions"`
+	Transfers     []Transfer    `json:"transfers,omitempty"`
+	Audit         []AuditEntry  `json:"audit,omitempty"`
+	// Temperatures holds the daily outside temperatures the consumption
+	// model is fitted with, oldest first.
+	Temperatures []DailyTemperature `json:"temperatures,omitempty"`
+	// Occupancy holds the days the house was left empty, oldest first; a
+	// day without a record counts as spent at home.
+	Occupancy []DailyOccupancy `json:"occupancy,omitempty"`
+	// Users are the accounts of the authentication; they are left out of
+	// exports and kept as is by imports.
+	Users []User `json:"users,omitempty"`
+	// APITokens are the tokens of the users, handled like Users.
+	APITokens []APIToken `json:"api_tokens,omitempty"`
+	// MinStockBags raises a low stock alert once fewer bags are left, all
+	// brands together; zero disables it.
+	MinStockBags int `json:"min_stock_bags,omitempty"`
+	// Silos hold bulk deliveries; SiloReadings are their measured levels,
+	// oldest first.
+	Silos        []Silo        `json:"silos,omitempty"`
+	SiloReadings []SiloReading `json:"silo_readings,omitempty"`
+	// StorageLocations are the storage places declared ahead of use; the
+	// purchases and transfers refer to them by name.
+	StorageLocations []StorageLocation `json:"storage_locations,omitempty"`
+	// MarketPrices is the public pellet price index, one price per month,
+	// oldest first.
+	MarketPrices []MarketPrice `json:"market_prices,omitempty"`
+	// SeasonArchives keep the season figures of the entries removed by the
+	// retention policy, oldest season first.
+	SeasonArchives []SeasonArchive `json:"season_archives,omitempty"`
+}
+
+// StorageLocation is a storage place declared before any bag is put in it,
+// such as a garage, a cellar or a shed.
+type StorageLocation struct {
+	Meta
+	Name  string `json:"name"`
+	Notes string `json:"notes,omitempty"`
+}
+
+// Silo is a bulk storage filled by the bulk purchases located at its name.
+type Silo struct {
+	Meta
+	Name       string  `json:"name"`
+	CapacityKg float64 `json:"capacity_kg"`
+}
+
+// SiloReading is the level of a silo measured by hand or by a sensor. A silo
+// keeps one reading per day.
+type SiloReading struct {
+	SiloID  ID        `json:"silo_id"`
+	ReadAt  time.Time `json:"read_at"`
+	LevelKg float64   `json:"level_kg"`
+	Source  string    `json:"source"`
 }
 
 // NewID creates a new ULID identifier.
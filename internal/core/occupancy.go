@@ -0,0 +1,152 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+// Occupancy statuses of a day. A day without a record counts as home.
+const (
+	OccupancyHome     = "home"
+	OccupancyAway     = "away"
+	OccupancyVacation = "vacation"
+)
+
+// occupancyStatuses lists the statuses in the order the statistics use.
+var occupancyStatuses = []string{OccupancyHome, OccupancyAway, OccupancyVacation}
+
+// DailyOccupancy records whether the house was occupied on a day: home, away
+// for the day or on vacation.
+type DailyOccupancy struct {
+	Date   time.Time `json:"date"`
+	Status string    `json:"status"`
+}
+
+// OccupancyUsage summarizes the consumptions of the days spent in one
+// occupancy status.
+type OccupancyUsage struct {
+	Status string `json:"status"`
+	// Days counts the calendar days of the period with that status.
+	Days       int     `json:"days"`
+	Bags       float64 `json:"bags"`
+	WeightKg   float64 `json:"weight_kg"`
+	Cost       Money   `json:"cost_cents"`
+	BagsPerDay float64 `json:"bags_per_day"`
+	CostPerDay Money   `json:"cost_per_day_cents"`
+}
+
+func validOccupancyStatus(status string) bool {
+	switch status {
+	case OccupancyHome, OccupancyAway, OccupancyVacation:
+		return true
+	default:
+		return false
+	}
+}
+
+// SetOccupancy records the occupancy of days, replacing the status of a day
+// already known, and returns the number of days stored.
+func SetOccupancy(ds *DataStore, days []DailyOccupancy) (int, error) {
+	if ds == nil {
+		return 0, errors.New("nil datastore")
+	}
+	errs := ValidationErrors{}
+	for _, day := range days {
+		errs = errs.AppendIf(day.Date.IsZero(), "date", "date is required")
+		errs = errs.AppendIf(!validOccupancyStatus(day.Status), "status", "status must be home, away or vacation")
+	}
+	if len(errs) > 0 {
+		return 0, errs
+	}
+
+	byDay := make(map[time.Time]int, len(ds.Occupancy))
+	for i, day := range ds.Occupancy {
+		byDay[day.Date] = i
+	}
+	for _, day := range days {
+		day.Date = startOfDay(day.Date)
+		if i, ok := byDay[day.Date]; ok {
+			ds.Occupancy[i] = day
+			continue
+		}
+		byDay[day.Date] = len(ds.Occupancy)
+		ds.Occupancy = append(ds.Occupancy, day)
+	}
+	sort.Slice(ds.Occupancy, func(i, j int) bool { return ds.Occupancy[i].Date.Before(ds.Occupancy[j].Date) })
+	touchDatastore(ds, time.Now().UTC())
+	return len(days), nil
+}
+
+// ComputeConsoParOccupation splits the consumptions of the range by the
+// occupancy of their day, valued with method, to compare what the stove
+// burns while the house is empty with the days spent at home. The period
+// runs from from, or the first consumption of the range, to to, or its last
+// consumption. Nothing is returned until an occupancy is recorded.
+func ComputeConsoParOccupation(ctx context.Context, ds *DataStore, method CostingMethod, from, to time.Time) ([]OccupancyUsage, error) {
+	if ds == nil || len(ds.Occupancy) == 0 {
+		return nil, nil
+	}
+
+	calculations, _, err := computeCostResults(ctx, ds, method)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make(map[time.Time]string, len(ds.Occupancy))
+	for _, day := range ds.Occupancy {
+		statuses[startOfDay(day.Date)] = day.Status
+	}
+	statusOf := func(day time.Time) string {
+		if status, ok := statuses[day]; ok {
+			return status
+		}
+		return OccupancyHome
+	}
+
+	usage := make(map[string]*OccupancyUsage, len(occupancyStatuses))
+	for _, status := range occupancyStatuses {
+		usage[status] = &OccupancyUsage{Status: status}
+	}
+	first, last := startOfDay(from), startOfDay(to)
+	weights := make(map[string]Grams, len(occupancyStatuses))
+	consumed := false
+	for _, calc := range calculations {
+		if !withinRange(calc.consumption.ConsumedAt, from, to) {
+			continue
+		}
+		day := startOfDay(calc.consumption.ConsumedAt)
+		if from.IsZero() && (!consumed || day.Before(first)) {
+			first = day
+		}
+		if to.IsZero() && (!consumed || day.After(last)) {
+			last = day
+		}
+		consumed = true
+		entry := usage[statusOf(day)]
+		entry.Bags += calc.bags
+		entry.Cost += calc.total
+		weights[entry.Status] += calc.weight
+	}
+	if !consumed {
+		return nil, nil
+	}
+
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		usage[statusOf(day)].Days++
+	}
+
+	results := make([]OccupancyUsage, 0, len(occupancyStatuses))
+	for _, status := range occupancyStatuses {
+		entry := usage[status]
+		if entry.Days == 0 {
+			continue
+		}
+		entry.WeightKg = weights[status].Kg()
+		entry.BagsPerDay = entry.Bags / float64(entry.Days)
+		entry.CostPerDay = entry.Cost.DivInt(entry.Days)
+		results = append(results, *entry)
+	}
+	return results, nil
+}
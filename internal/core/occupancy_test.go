@@ -0,0 +1,147 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestSetOccupancy(t *testing.T) {
+	t.Parallel()
+
+	day := func(d int) time.Time { return time.Date(2024, time.February, d, 0, 0, 0, 0, time.UTC) }
+
+	type params struct {
+		existing []core.DailyOccupancy
+		days     []core.DailyOccupancy
+	}
+	type want struct {
+		occupancy []core.DailyOccupancy
+		err       error
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "stores days at midnight, oldest first",
+			params: params{days: []core.DailyOccupancy{
+				{Date: day(3).Add(18 * time.Hour), Status: core.OccupancyVacation},
+				{Date: day(2), Status: core.OccupancyAway},
+			}},
+			want: want{occupancy: []core.DailyOccupancy{
+				{Date: day(2), Status: core.OccupancyAway},
+				{Date: day(3), Status: core.OccupancyVacation},
+			}},
+		},
+		{
+			name: "replaces the status of a known day",
+			params: params{
+				existing: []core.DailyOccupancy{{Date: day(2), Status: core.OccupancyVacation}},
+				days:     []core.DailyOccupancy{{Date: day(2), Status: core.OccupancyHome}},
+			},
+			want: want{occupancy: []core.DailyOccupancy{{Date: day(2), Status: core.OccupancyHome}}},
+		},
+		{
+			name:   "rejects an unknown status",
+			params: params{days: []core.DailyOccupancy{{Date: day(2), Status: "abroad"}}},
+			want:   want{err: core.ValidationErrors{{Field: "status", Message: "status must be home, away or vacation"}}},
+		},
+		{
+			name:   "requires the date",
+			params: params{days: []core.DailyOccupancy{{Status: core.OccupancyAway}}},
+			want:   want{err: core.ValidationErrors{{Field: "date", Message: "date is required"}}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := core.DataStore{Occupancy: append([]core.DailyOccupancy(nil), tc.params.existing...)}
+			_, err := core.SetOccupancy(&ds, tc.params.days)
+
+			assert.Equal(t, tc.want.err, err, tc.name)
+			if tc.want.err == nil {
+				assert.Equal(t, tc.want.occupancy, ds.Occupancy, tc.name)
+			}
+		})
+	}
+}
+
+func TestComputeConsoParOccupation(t *testing.T) {
+	t.Parallel()
+
+	day := func(d int) time.Time { return time.Date(2024, time.February, d, 0, 0, 0, 0, time.UTC) }
+	base := core.DataStore{
+		Brands: []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}},
+		Purchases: []core.Purchase{
+			{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: day(1), Bags: 20, BagWeightKg: 15, TotalWeightKg: 300, UnitPriceCents: 500, TotalPriceCents: 10000},
+		},
+		Consumptions: []core.Consumption{
+			{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: day(1).Add(8 * time.Hour), Bags: 2},
+			{Meta: core.Meta{ID: "c2"}, BrandID: "brand-w", ConsumedAt: day(3), Bags: 1},
+			{Meta: core.Meta{ID: "c3"}, BrandID: "brand-w", ConsumedAt: day(4), Bags: 2},
+		},
+	}
+	away := base
+	away.Occupancy = []core.DailyOccupancy{
+		{Date: day(2), Status: core.OccupancyVacation},
+		{Date: day(3), Status: core.OccupancyVacation},
+	}
+
+	type params struct {
+		ds       core.DataStore
+		from, to time.Time
+	}
+	type want struct {
+		usage []core.OccupancyUsage
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "splits the consumptions by the occupancy of their day",
+			params: params{ds: away},
+			want: want{usage: []core.OccupancyUsage{
+				{Status: core.OccupancyHome, Days: 2, Bags: 4, WeightKg: 60, Cost: 2000, BagsPerDay: 2, CostPerDay: 1000},
+				{Status: core.OccupancyVacation, Days: 2, Bags: 1, WeightKg: 15, Cost: 500, BagsPerDay: 0.5, CostPerDay: 250},
+			}},
+		},
+		{
+			name:   "counts the days of the range",
+			params: params{ds: away, from: day(2), to: day(10)},
+			want: want{usage: []core.OccupancyUsage{
+				{Status: core.OccupancyHome, Days: 7, Bags: 2, WeightKg: 30, Cost: 1000, BagsPerDay: 2.0 / 7, CostPerDay: 143},
+				{Status: core.OccupancyVacation, Days: 2, Bags: 1, WeightKg: 15, Cost: 500, BagsPerDay: 0.5, CostPerDay: 250},
+			}},
+		},
+		{
+			name:   "returns nothing without occupancy",
+			params: params{ds: base},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			usage, err := core.ComputeConsoParOccupation(context.Background(), &tc.params.ds, core.CostingFIFO, tc.params.from, tc.params.to)
+			require.NoError(t, err, tc.name)
+
+			assert.Equal(t, tc.want.usage, usage, tc.name)
+		})
+	}
+}
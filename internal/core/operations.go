@@ -2,6 +2,7 @@ package core
 
 import (
 	"errors"
+	"math"
 	"sort"
 	"strings"
 	"time"
@@ -9,50 +10,136 @@ import (
 
 // CreateBrandParams captures the fields required to create a brand.
 type CreateBrandParams struct {
-	Name        string
-	Description string
-	ImageBase64 string
+	Name           string
+	Description    string
+	ImageBase64    string
+	LeadTimeDays   int
+	EnergyKWhPerKg float64
+	MinStockBags   int
 }
 
 // UpdateBrandParams captures the mutable brand fields.
 type UpdateBrandParams struct {
-	Name        string
-	Description string
-	ImageBase64 string
+	Name           string
+	Description    string
+	ImageBase64    string
+	LeadTimeDays   int
+	EnergyKWhPerKg float64
+	MinStockBags   int
+	Archived       bool
+	// ExpectedRevision, when set, rejects the update with a ConflictError
+	// unless the brand is still at this revision.
+	ExpectedRevision *int64
 }
 
 // CreatePurchaseParams contains the data necessary to create a purchase entry.
+// A bulk delivery leaves Bags at zero and sets WeightKg and PricePerTonne
+// instead of BagWeightKg and UnitPrice.
 type CreatePurchaseParams struct {
-	BrandID     ID
-	PurchasedAt time.Time
-	Bags        int
-	BagWeightKg float64
-	UnitPrice   Money
-	Notes       string
+	BrandID       ID
+	PurchasedAt   time.Time
+	Bags          int
+	BagWeightKg   float64
+	UnitPrice     Money
+	WeightKg      float64
+	PricePerTonne Money
+	Location      string
+	Notes         string
 }
 
 // UpdatePurchaseParams captures the mutable purchase fields.
 type UpdatePurchaseParams struct {
-	PurchasedAt time.Time
-	Bags        int
-	BagWeightKg float64
-	UnitPrice   Money
-	Notes       string
+	PurchasedAt   time.Time
+	Bags          int
+	BagWeightKg   float64
+	UnitPrice     Money
+	WeightKg      float64
+	PricePerTonne Money
+	Location      string
+	Notes         string
+	// ExpectedRevision, when set, rejects the update with a ConflictError
+	// unless the purchase is still at this revision.
+	ExpectedRevision *int64
 }
 
 // CreateConsumptionParams contains the fields to create a consumption entry.
+// BagsFraction adds the part of a bag to Bags. WeightKg records the weight
+// burnt; it is the only quantity of consumptions taken from a bulk delivery
+// or from opened bags, Bags and BagsFraction being zero then.
 type CreateConsumptionParams struct {
-	BrandID    ID
-	ConsumedAt time.Time
-	Bags       int
-	Notes      string
+	BrandID      ID
+	ConsumedAt   time.Time
+	Bags         int
+	BagsFraction float64
+	WeightKg     float64
+	PowerLevel   int
+	Notes        string
 }
 
 // UpdateConsumptionParams captures mutable consumption fields.
 type UpdateConsumptionParams struct {
-	ConsumedAt time.Time
-	Bags       int
-	Notes      string
+	ConsumedAt   time.Time
+	Bags         int
+	BagsFraction float64
+	WeightKg     float64
+	PowerLevel   int
+	Notes        string
+	// ExpectedRevision, when set, rejects the update with a ConflictError
+	// unless the consumption is still at this revision.
+	ExpectedRevision *int64
+}
+
+// SplitBags splits a count of bags such as 1.5 into whole bags and the part
+// of a bag, rounded to the hundredth.
+func SplitBags(bags float64) (int, float64) {
+	whole := math.Floor(bags)
+	fraction := math.Round((bags-whole)*100) / 100
+	if fraction >= 1 {
+		whole, fraction = whole+1, 0
+	}
+	return int(whole), fraction
+}
+
+// purchaseQuantity is what a purchase brought in: bags at a unit price or,
+// for a bulk delivery, a weight at a price per tonne.
+type purchaseQuantity struct {
+	bags          int
+	bagWeightKg   float64
+	unitPrice     Money
+	weightKg      float64
+	pricePerTonne Money
+}
+
+func (p CreatePurchaseParams) quantity() purchaseQuantity {
+	return purchaseQuantity{bags: p.Bags, bagWeightKg: p.BagWeightKg, unitPrice: p.UnitPrice, weightKg: p.WeightKg, pricePerTonne: p.PricePerTonne}
+}
+
+func (p UpdatePurchaseParams) quantity() purchaseQuantity {
+	return purchaseQuantity{bags: p.Bags, bagWeightKg: p.BagWeightKg, unitPrice: p.UnitPrice, weightKg: p.WeightKg, pricePerTonne: p.PricePerTonne}
+}
+
+func (q purchaseQuantity) bulk() bool {
+	return q.bags == 0 && q.weightKg > 0
+}
+
+// apply sets the quantity, weight and price fields of purchase.
+func (q purchaseQuantity) apply(purchase *Purchase) {
+	if q.bulk() {
+		weight := GramsFromKg(q.weightKg)
+		purchase.Bags = 0
+		purchase.BagWeightKg = 0
+		purchase.TotalWeightKg = weight.Kg()
+		purchase.UnitPriceCents = 0
+		purchase.PricePerTonneCents = q.pricePerTonne
+		purchase.TotalPriceCents = WeightPrice(weight, q.pricePerTonne)
+		return
+	}
+	purchase.Bags = q.bags
+	purchase.BagWeightKg = RoundKg(q.bagWeightKg)
+	purchase.TotalWeightKg = GramsFromKg(q.bagWeightKg).MulInt(q.bags).Kg()
+	purchase.UnitPriceCents = q.unitPrice
+	purchase.PricePerTonneCents = 0
+	purchase.TotalPriceCents = q.unitPrice.MulInt(q.bags)
 }
 
 // AddBrand inserts a new brand into the datastore.
@@ -67,6 +154,9 @@ func AddBrand(ds *DataStore, params CreateBrandParams) (Brand, error) {
 	if name != "" && hasBrandWithName(ds.Brands, name, "") {
 		errs = errs.AppendIf(true, "name", "brand name already exists")
 	}
+	errs = errs.AppendIf(params.LeadTimeDays < 0 || params.LeadTimeDays > MaxLeadTimeDays, "lead_time_days", "lead time must be between 0 and 365 days")
+	errs = errs.AppendIf(!validEnergyFactor(params.EnergyKWhPerKg), "energy_kwh_per_kg", "energy must be between 0 and 6 kWh/kg")
+	errs = errs.AppendIf(params.MinStockBags < 0, "min_stock_bags", "minimum stock cannot be negative")
 	if len(errs) > 0 {
 		return Brand{}, errs
 	}
@@ -78,9 +168,12 @@ func AddBrand(ds *DataStore, params CreateBrandParams) (Brand, error) {
 			CreatedAt: now,
 			UpdatedAt: now,
 		},
-		Name:        name,
-		Description: strings.TrimSpace(params.Description),
-		ImageBase64: strings.TrimSpace(params.ImageBase64),
+		Name:           name,
+		Description:    strings.TrimSpace(params.Description),
+		ImageBase64:    strings.TrimSpace(params.ImageBase64),
+		LeadTimeDays:   params.LeadTimeDays,
+		EnergyKWhPerKg: params.EnergyKWhPerKg,
+		MinStockBags:   params.MinStockBags,
 	}
 
 	ds.Brands = append(ds.Brands, brand)
@@ -99,6 +192,9 @@ func UpdateBrand(ds *DataStore, id ID, params UpdateBrandParams) (Brand, error)
 	if idx == -1 {
 		return Brand{}, ErrBrandNotFound
 	}
+	if err := checkRevision("brand", ds.Brands[idx].Meta, params.ExpectedRevision); err != nil {
+		return Brand{}, err
+	}
 
 	name := NormalizeName(params.Name)
 	errs := ValidationErrors{}
@@ -106,6 +202,9 @@ func UpdateBrand(ds *DataStore, id ID, params UpdateBrandParams) (Brand, error)
 	if name != "" && hasBrandWithName(ds.Brands, name, id) {
 		errs = errs.AppendIf(true, "name", "brand name already exists")
 	}
+	errs = errs.AppendIf(params.LeadTimeDays < 0 || params.LeadTimeDays > MaxLeadTimeDays, "lead_time_days", "lead time must be between 0 and 365 days")
+	errs = errs.AppendIf(!validEnergyFactor(params.EnergyKWhPerKg), "energy_kwh_per_kg", "energy must be between 0 and 6 kWh/kg")
+	errs = errs.AppendIf(params.MinStockBags < 0, "min_stock_bags", "minimum stock cannot be negative")
 	if len(errs) > 0 {
 		return Brand{}, errs
 	}
@@ -115,7 +214,11 @@ func UpdateBrand(ds *DataStore, id ID, params UpdateBrandParams) (Brand, error)
 	brand.Name = name
 	brand.Description = strings.TrimSpace(params.Description)
 	brand.ImageBase64 = strings.TrimSpace(params.ImageBase64)
-	brand.UpdatedAt = now
+	brand.LeadTimeDays = params.LeadTimeDays
+	brand.EnergyKWhPerKg = params.EnergyKWhPerKg
+	brand.MinStockBags = params.MinStockBags
+	brand.Archived = params.Archived
+	brand.touch(now)
 	ds.Brands[idx] = brand
 
 	touchDatastore(ds, now)
@@ -123,7 +226,49 @@ func UpdateBrand(ds *DataStore, id ID, params UpdateBrandParams) (Brand, error)
 	return brand, nil
 }
 
+// SetBrandImage replaces the image of an existing brand, leaving its other
+// fields untouched.
+func SetBrandImage(ds *DataStore, id ID, imageBase64 string) (Brand, error) {
+	if ds == nil {
+		return Brand{}, errors.New("nil datastore")
+	}
+
+	idx := findBrandIndex(ds.Brands, id)
+	if idx == -1 {
+		return Brand{}, ErrBrandNotFound
+	}
+
+	now := time.Now().UTC()
+	ds.Brands[idx].ImageBase64 = strings.TrimSpace(imageBase64)
+	ds.Brands[idx].touch(now)
+	touchDatastore(ds, now)
+
+	return ds.Brands[idx], nil
+}
+
+// SetBrandArchived archives a brand, or restores it when archived is false.
+// Unlike DeleteBrand it works for a brand with purchases or consumptions,
+// which keep counting in the statistics.
+func SetBrandArchived(ds *DataStore, id ID, archived bool) (Brand, error) {
+	if ds == nil {
+		return Brand{}, errors.New("nil datastore")
+	}
+
+	idx := findBrandIndex(ds.Brands, id)
+	if idx == -1 {
+		return Brand{}, ErrBrandNotFound
+	}
+
+	now := time.Now().UTC()
+	ds.Brands[idx].Archived = archived
+	ds.Brands[idx].touch(now)
+	touchDatastore(ds, now)
+
+	return ds.Brands[idx], nil
+}
+
 // DeleteBrand removes a brand when no purchase or consumption references it.
+// SetBrandArchived hides the brands that cannot be deleted.
 func DeleteBrand(ds *DataStore, id ID) error {
 	if ds == nil {
 		return errors.New("nil datastore")
@@ -141,13 +286,68 @@ func DeleteBrand(ds *DataStore, id ID) error {
 	return nil
 }
 
+// BrandDeletion lists everything removed by ForceDeleteBrand so it can be
+// exported before the datastore is persisted.
+type BrandDeletion struct {
+	Brand        Brand         `json:"brand"`
+	Purchases    []Purchase    `json:"purchases"`
+	Consumptions []Consumption `json:"consumptions"`
+	Transfers    []Transfer    `json:"transfers,omitempty"`
+}
+
+// ForceDeleteBrand removes a brand together with every purchase, consumption
+// and transfer referencing it.
+func ForceDeleteBrand(ds *DataStore, id ID) (BrandDeletion, error) {
+	if ds == nil {
+		return BrandDeletion{}, errors.New("nil datastore")
+	}
+	idx := findBrandIndex(ds.Brands, id)
+	if idx == -1 {
+		return BrandDeletion{}, ErrBrandNotFound
+	}
+
+	deletion := BrandDeletion{Brand: ds.Brands[idx], Purchases: []Purchase{}, Consumptions: []Consumption{}}
+	purchases := make([]Purchase, 0, len(ds.Purchases))
+	for _, purchase := range ds.Purchases {
+		if purchase.BrandID == id {
+			deletion.Purchases = append(deletion.Purchases, purchase)
+			continue
+		}
+		purchases = append(purchases, purchase)
+	}
+	consumptions := make([]Consumption, 0, len(ds.Consumptions))
+	for _, consumption := range ds.Consumptions {
+		if consumption.BrandID == id {
+			deletion.Consumptions = append(deletion.Consumptions, consumption)
+			continue
+		}
+		consumptions = append(consumptions, consumption)
+	}
+
+	transfers := make([]Transfer, 0, len(ds.Transfers))
+	for _, transfer := range ds.Transfers {
+		if transfer.BrandID == id || transfer.ToBrandID == id {
+			deletion.Transfers = append(deletion.Transfers, transfer)
+			continue
+		}
+		transfers = append(transfers, transfer)
+	}
+
+	ds.Purchases = purchases
+	ds.Consumptions = consumptions
+	ds.Transfers = transfers
+	ds.Brands = append(ds.Brands[:idx], ds.Brands[idx+1:]...)
+	touchDatastore(ds, time.Now().UTC())
+	return deletion, nil
+}
+
 // AddPurchase appends a new purchase entry with derived totals.
 func AddPurchase(ds *DataStore, params CreatePurchaseParams) (Purchase, error) {
 	if ds == nil {
 		return Purchase{}, errors.New("nil datastore")
 	}
 
-	errs := validatePurchaseInput(ds, params.BrandID, params.Bags, params.BagWeightKg, params.UnitPrice, params.PurchasedAt)
+	errs := validatePurchaseInput(ds, params.BrandID, params.quantity(), params.PurchasedAt)
 	if len(errs) > 0 {
 		return Purchase{}, errs
 	}
@@ -164,15 +364,12 @@ func AddPurchase(ds *DataStore, params CreatePurchaseParams) (Purchase, error) {
 			CreatedAt: now,
 			UpdatedAt: now,
 		},
-		BrandID:         params.BrandID,
-		PurchasedAt:     purchasedAt,
-		Bags:            params.Bags,
-		BagWeightKg:     params.BagWeightKg,
-		TotalWeightKg:   params.BagWeightKg * float64(params.Bags),
-		UnitPriceCents:  params.UnitPrice,
-		TotalPriceCents: params.UnitPrice.MulInt(params.Bags),
-		Notes:           strings.TrimSpace(params.Notes),
+		BrandID:     params.BrandID,
+		PurchasedAt: purchasedAt,
+		Location:    canonicalLocation(ds, params.Location),
+		Notes:       strings.TrimSpace(params.Notes),
 	}
+	params.quantity().apply(&purchase)
 
 	ds.Purchases = append(ds.Purchases, purchase)
 	sort.Slice(ds.Purchases, func(i, j int) bool {
@@ -196,8 +393,11 @@ func UpdatePurchase(ds *DataStore, id ID, params UpdatePurchaseParams) (Purchase
 	if idx == -1 {
 		return Purchase{}, ErrPurchaseNotFound
 	}
+	if err := checkRevision("purchase", ds.Purchases[idx].Meta, params.ExpectedRevision); err != nil {
+		return Purchase{}, err
+	}
 
-	errs := validatePurchaseInput(ds, ds.Purchases[idx].BrandID, params.Bags, params.BagWeightKg, params.UnitPrice, params.PurchasedAt)
+	errs := validatePurchaseInput(ds, ds.Purchases[idx].BrandID, params.quantity(), params.PurchasedAt)
 	if len(errs) > 0 {
 		return Purchase{}, errs
 	}
@@ -210,13 +410,10 @@ func UpdatePurchase(ds *DataStore, id ID, params UpdatePurchaseParams) (Purchase
 
 	purchase := ds.Purchases[idx]
 	purchase.PurchasedAt = purchasedAt
-	purchase.Bags = params.Bags
-	purchase.BagWeightKg = params.BagWeightKg
-	purchase.TotalWeightKg = params.BagWeightKg * float64(params.Bags)
-	purchase.UnitPriceCents = params.UnitPrice
-	purchase.TotalPriceCents = params.UnitPrice.MulInt(params.Bags)
+	params.quantity().apply(&purchase)
+	purchase.Location = canonicalLocation(ds, params.Location)
 	purchase.Notes = strings.TrimSpace(params.Notes)
-	purchase.UpdatedAt = now
+	purchase.touch(now)
 	ds.Purchases[idx] = purchase
 
 	sort.Slice(ds.Purchases, func(i, j int) bool {
@@ -250,7 +447,7 @@ func AddConsumption(ds *DataStore, params CreateConsumptionParams) (Consumption,
 		return Consumption{}, errors.New("nil datastore")
 	}
 
-	errs := validateConsumptionInput(ds, params.BrandID, params.Bags, params.ConsumedAt)
+	errs := validateConsumptionInput(ds, params.BrandID, params.Bags, params.BagsFraction, params.WeightKg, params.PowerLevel, params.ConsumedAt)
 	if len(errs) > 0 {
 		return Consumption{}, errs
 	}
@@ -267,10 +464,13 @@ func AddConsumption(ds *DataStore, params CreateConsumptionParams) (Consumption,
 			CreatedAt: now,
 			UpdatedAt: now,
 		},
-		BrandID:    params.BrandID,
-		ConsumedAt: consumedAt,
-		Bags:       params.Bags,
-		Notes:      strings.TrimSpace(params.Notes),
+		BrandID:      params.BrandID,
+		ConsumedAt:   consumedAt,
+		Bags:         params.Bags,
+		BagsFraction: params.BagsFraction,
+		WeightKg:     RoundKg(params.WeightKg),
+		PowerLevel:   params.PowerLevel,
+		Notes:        strings.TrimSpace(params.Notes),
 	}
 
 	ds.Consumptions = append(ds.Consumptions, consumption)
@@ -295,8 +495,11 @@ func UpdateConsumption(ds *DataStore, id ID, params UpdateConsumptionParams) (Co
 	if idx == -1 {
 		return Consumption{}, ErrConsumptionNotFound
 	}
+	if err := checkRevision("consumption", ds.Consumptions[idx].Meta, params.ExpectedRevision); err != nil {
+		return Consumption{}, err
+	}
 
-	errs := validateConsumptionInput(ds, ds.Consumptions[idx].BrandID, params.Bags, params.ConsumedAt)
+	errs := validateConsumptionInput(ds, ds.Consumptions[idx].BrandID, params.Bags, params.BagsFraction, params.WeightKg, params.PowerLevel, params.ConsumedAt)
 	if len(errs) > 0 {
 		return Consumption{}, errs
 	}
@@ -308,10 +511,19 @@ func UpdateConsumption(ds *DataStore, id ID, params UpdateConsumptionParams) (Co
 	}
 
 	consumption := ds.Consumptions[idx]
+	switch {
+	case params.WeightKg > 0:
+		consumption.WeightKg = RoundKg(params.WeightKg)
+	case consumption.Bags != params.Bags || consumption.BagsFraction != params.BagsFraction:
+		// The recorded weight described the previous bag count.
+		consumption.WeightKg = 0
+	}
 	consumption.ConsumedAt = consumedAt
 	consumption.Bags = params.Bags
+	consumption.BagsFraction = params.BagsFraction
+	consumption.PowerLevel = params.PowerLevel
 	consumption.Notes = strings.TrimSpace(params.Notes)
-	consumption.UpdatedAt = now
+	consumption.touch(now)
 	ds.Consumptions[idx] = consumption
 
 	sort.Slice(ds.Consumptions, func(i, j int) bool {
@@ -325,6 +537,31 @@ func UpdateConsumption(ds *DataStore, id ID, params UpdateConsumptionParams) (Co
 	return consumption, nil
 }
 
+// DuplicateConsumption records a new consumption with the same brand, bag
+// count, weight, power level and notes as an existing one, dated
+// consumedAt.
+func DuplicateConsumption(ds *DataStore, id ID, consumedAt time.Time) (Consumption, error) {
+	if ds == nil {
+		return Consumption{}, errors.New("nil datastore")
+	}
+
+	idx := findConsumptionIndex(ds.Consumptions, id)
+	if idx == -1 {
+		return Consumption{}, ErrConsumptionNotFound
+	}
+	source := ds.Consumptions[idx]
+
+	return AddConsumption(ds, CreateConsumptionParams{
+		BrandID:      source.BrandID,
+		ConsumedAt:   consumedAt,
+		Bags:         source.Bags,
+		BagsFraction: source.BagsFraction,
+		WeightKg:     source.WeightKg,
+		PowerLevel:   source.PowerLevel,
+		Notes:        source.Notes,
+	})
+}
+
 // DeleteConsumption removes a consumption entry.
 func DeleteConsumption(ds *DataStore, id ID) error {
 	if ds == nil {
@@ -339,20 +576,28 @@ func DeleteConsumption(ds *DataStore, id ID) error {
 	return nil
 }
 
-func validatePurchaseInput(ds *DataStore, brandID ID, bags int, bagWeightKg float64, unitPrice Money, purchasedAt time.Time) ValidationErrors {
+func validatePurchaseInput(ds *DataStore, brandID ID, quantity purchaseQuantity, purchasedAt time.Time) ValidationErrors {
 	errs := ValidationErrors{}
 	errs = errs.AppendIf(!brandExists(ds.Brands, brandID), "brand_id", "unknown brand")
-	errs = errs.AppendIf(bags <= 0, "bags", "bags must be greater than zero")
-	errs = errs.AppendIf(bagWeightKg <= 0, "bag_weight_kg", "bag weight must be greater than zero")
-	errs = errs.AppendIf(unitPrice.Int64() < 0, "unit_price", "unit price cannot be negative")
+	if quantity.bulk() {
+		errs = errs.AppendIf(quantity.pricePerTonne < 0, "price_per_tonne", "price per tonne cannot be negative")
+	} else {
+		errs = errs.AppendIf(quantity.bags <= 0, "bags", "bags must be greater than zero")
+		errs = errs.AppendIf(quantity.bagWeightKg <= 0, "bag_weight_kg", "bag weight must be greater than zero")
+		errs = errs.AppendIf(quantity.unitPrice.Int64() < 0, "unit_price", "unit price cannot be negative")
+		errs = errs.AppendIf(quantity.pricePerTonne != 0, "price_per_tonne", "price per tonne only applies to bulk purchases")
+	}
 	errs = errs.AppendIf(!purchasedAt.IsZero() && purchasedAt.After(time.Now().Add(24*time.Hour)), "purchased_at", "purchase date cannot be in the far future")
 	return errs
 }
 
-func validateConsumptionInput(ds *DataStore, brandID ID, bags int, consumedAt time.Time) ValidationErrors {
+func validateConsumptionInput(ds *DataStore, brandID ID, bags int, fraction, weightKg float64, powerLevel int, consumedAt time.Time) ValidationErrors {
 	errs := ValidationErrors{}
 	errs = errs.AppendIf(!brandExists(ds.Brands, brandID), "brand_id", "unknown brand")
-	errs = errs.AppendIf(bags <= 0, "bags", "bags must be greater than zero")
+	errs = errs.AppendIf(bags < 0 || (bags == 0 && fraction == 0 && weightKg <= 0), "bags", "bags must be greater than zero")
+	errs = errs.AppendIf(math.IsNaN(fraction) || fraction < 0 || fraction >= 1, "bags_fraction", "part of a bag must be between 0 and 1")
+	errs = errs.AppendIf(weightKg < 0, "weight_kg", "weight cannot be negative")
+	errs = errs.AppendIf(powerLevel != 0 && (powerLevel < MinPowerLevel || powerLevel > MaxPowerLevel), "power_level", "power level must be between 1 and 5")
 	if !consumedAt.IsZero() {
 		errs = errs.AppendIf(consumedAt.After(time.Now().Add(24*time.Hour)), "consumed_at", "consumption date cannot be in the far future")
 	}
@@ -392,6 +637,11 @@ func brandReferenced(ds *DataStore, id ID) bool {
 			return true
 		}
 	}
+	for _, t := range ds.Transfers {
+		if t.BrandID == id || t.ToBrandID == id {
+			return true
+		}
+	}
 	return false
 }
 
@@ -62,6 +62,15 @@ func TestAddBrand(t *testing.T) {
 				brandCount: 1,
 			},
 		},
+		{
+			name: "rejects implausible energy densities",
+			params: params{
+				input: core.CreateBrandParams{Name: "Premium", EnergyKWhPerKg: 12},
+			},
+			want: want{
+				err: core.ValidationErrors{{Field: "energy_kwh_per_kg", Message: "energy must be between 0 and 6 kWh/kg"}},
+			},
+		},
 	}
 
 	for _, tc := range tcs {
@@ -81,7 +90,7 @@ func TestAddBrand(t *testing.T) {
 				assert.Error(t, err, tc.name)
 				var vErr core.ValidationErrors
 				assert.True(t, errors.As(err, &vErr), tc.name)
-				assert.True(t, vErr.Has("name"), tc.name)
+				assert.Equal(t, tc.want.err, vErr, tc.name)
 				assert.Equal(t, len(tc.params.datastore.Brands), len(ds.Brands), tc.name)
 			}
 		})
@@ -97,6 +106,7 @@ func TestAddPurchase(t *testing.T) {
 	}
 	type want struct {
 		err             error
+		errField        string
 		totalPriceCents core.Money
 		totalWeightKg   float64
 		bagWeightKg     float64
@@ -130,6 +140,24 @@ func TestAddPurchase(t *testing.T) {
 				bagWeightKg:     15,
 			},
 		},
+		{
+			name: "keeps decimal weights exact",
+			params: params{
+				existing: ds,
+				input: core.CreatePurchaseParams{
+					BrandID:     brand.ID,
+					PurchasedAt: time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC),
+					Bags:        3,
+					BagWeightKg: 0.1,
+					UnitPrice:   core.Money(100),
+				},
+			},
+			want: want{
+				totalPriceCents: core.Money(300),
+				totalWeightKg:   0.3,
+				bagWeightKg:     0.1,
+			},
+		},
 		{
 			name: "fails when bag weight missing",
 			params: params{
@@ -142,7 +170,37 @@ func TestAddPurchase(t *testing.T) {
 					UnitPrice:   core.Money(1000),
 				},
 			},
-			want: want{err: core.ValidationErrors{{Field: "bag_weight_kg", Message: "bag weight must be greater than zero"}}},
+			want: want{err: core.ValidationErrors{{Field: "bag_weight_kg", Message: "bag weight must be greater than zero"}}, errField: "bag_weight_kg"},
+		},
+		{
+			name: "prices bulk deliveries per tonne",
+			params: params{
+				existing: ds,
+				input: core.CreatePurchaseParams{
+					BrandID:       brand.ID,
+					PurchasedAt:   time.Date(2024, time.September, 2, 0, 0, 0, 0, time.UTC),
+					WeightKg:      2850,
+					PricePerTonne: core.Money(39000),
+				},
+			},
+			want: want{
+				totalPriceCents: core.Money(111150),
+				totalWeightKg:   2850,
+			},
+		},
+		{
+			name: "rejects a price per tonne on bags",
+			params: params{
+				existing: ds,
+				input: core.CreatePurchaseParams{
+					BrandID:       brand.ID,
+					PurchasedAt:   time.Date(2024, time.September, 2, 0, 0, 0, 0, time.UTC),
+					Bags:          2,
+					BagWeightKg:   15,
+					PricePerTonne: core.Money(39000),
+				},
+			},
+			want: want{err: core.ValidationErrors{{Field: "price_per_tonne", Message: "price per tonne only applies to bulk purchases"}}, errField: "price_per_tonne"},
 		},
 	}
 
@@ -157,13 +215,13 @@ func TestAddPurchase(t *testing.T) {
 			if tc.want.err == nil {
 				require.NoError(t, err, tc.name)
 				assert.Equal(t, tc.want.totalPriceCents, purchase.TotalPriceCents, tc.name)
-				assert.InDelta(t, tc.want.totalWeightKg, purchase.TotalWeightKg, 1e-9, tc.name)
-				assert.InDelta(t, tc.want.bagWeightKg, purchase.BagWeightKg, 1e-9, tc.name)
+				assert.Equal(t, tc.want.totalWeightKg, purchase.TotalWeightKg, tc.name)
+				assert.Equal(t, tc.want.bagWeightKg, purchase.BagWeightKg, tc.name)
 			} else {
 				assert.Error(t, err, tc.name)
 				var vErr core.ValidationErrors
 				assert.True(t, errors.As(err, &vErr), tc.name)
-				assert.True(t, vErr.Has("bag_weight_kg"), tc.name)
+				assert.True(t, vErr.Has(tc.want.errField), tc.name)
 				assert.Equal(t, len(tc.params.existing.Purchases), len(dsCopy.Purchases), tc.name)
 			}
 		})
@@ -174,26 +232,35 @@ func TestUpdatePurchase(t *testing.T) {
 	t.Parallel()
 
 	type params struct {
-		existing core.DataStore
+		// updates are the unchanged saves made before the update.
+		updates  int
 		update   core.UpdatePurchaseParams
+		expected *int64
 	}
 	type want struct {
-		err             error
+		conflict        bool
+		revision        int64
 		totalPriceCents core.Money
 		totalWeightKg   float64
 	}
 
-	base := core.DataStore{}
-	brand, err := core.AddBrand(&base, core.CreateBrandParams{Name: "Brand"})
-	require.NoError(t, err, "seed brand")
-	purchase, err := core.AddPurchase(&base, core.CreatePurchaseParams{
-		BrandID:     brand.ID,
-		PurchasedAt: time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC),
-		Bags:        3,
-		BagWeightKg: 12.5,
-		UnitPrice:   core.Money(700),
-	})
-	require.NoError(t, err, "seed purchase")
+	purchasedAt := time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC)
+	seed := func(t *testing.T) (core.DataStore, core.Purchase) {
+		ds := core.DataStore{}
+		brand, err := core.AddBrand(&ds, core.CreateBrandParams{Name: "Brand"})
+		require.NoError(t, err, "seed brand")
+		purchase, err := core.AddPurchase(&ds, core.CreatePurchaseParams{
+			BrandID:     brand.ID,
+			PurchasedAt: purchasedAt,
+			Bags:        3,
+			BagWeightKg: 12.5,
+			UnitPrice:   core.Money(700),
+		})
+		require.NoError(t, err, "seed purchase")
+		return ds, purchase
+	}
+	unchanged := core.UpdatePurchaseParams{PurchasedAt: purchasedAt, Bags: 3, BagWeightKg: 12.5, UnitPrice: core.Money(700), Notes: "modifié"}
+	revision := func(value int64) *int64 { return &value }
 
 	tcs := []struct {
 		name   string
@@ -203,9 +270,8 @@ func TestUpdatePurchase(t *testing.T) {
 		{
 			name: "updates totals when bags change",
 			params: params{
-				existing: base,
 				update: core.UpdatePurchaseParams{
-					PurchasedAt: purchase.PurchasedAt,
+					PurchasedAt: purchasedAt,
 					Bags:        5,
 					BagWeightKg: 13,
 					UnitPrice:   core.Money(650),
@@ -213,11 +279,31 @@ func TestUpdatePurchase(t *testing.T) {
 				},
 			},
 			want: want{
-				err:             nil,
+				revision:        1,
 				totalPriceCents: core.Money(3250),
 				totalWeightKg:   65,
 			},
 		},
+		{
+			name:   "updates without a revision",
+			params: params{updates: 1, update: unchanged},
+			want:   want{revision: 2, totalPriceCents: core.Money(2100), totalWeightKg: 37.5},
+		},
+		{
+			name:   "updates the current revision",
+			params: params{updates: 1, update: unchanged, expected: revision(1)},
+			want:   want{revision: 2, totalPriceCents: core.Money(2100), totalWeightKg: 37.5},
+		},
+		{
+			name:   "updates a never updated entry",
+			params: params{update: unchanged, expected: revision(0)},
+			want:   want{revision: 1, totalPriceCents: core.Money(2100), totalWeightKg: 37.5},
+		},
+		{
+			name:   "rejects a stale revision",
+			params: params{updates: 2, update: unchanged, expected: revision(1)},
+			want:   want{conflict: true, revision: 2},
+		},
 	}
 
 	for _, tc := range tcs {
@@ -225,9 +311,32 @@ func TestUpdatePurchase(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
 
-			dsCopy := tc.params.existing
-			updated, err := core.UpdatePurchase(&dsCopy, purchase.ID, tc.params.update)
+			ds, purchase := seed(t)
+			for i := 0; i < tc.params.updates; i++ {
+				_, err := core.UpdatePurchase(&ds, purchase.ID, core.UpdatePurchaseParams{
+					PurchasedAt: purchase.PurchasedAt,
+					Bags:        purchase.Bags,
+					BagWeightKg: purchase.BagWeightKg,
+					UnitPrice:   purchase.UnitPriceCents,
+				})
+				require.NoError(t, err, tc.name)
+			}
+
+			update := tc.params.update
+			update.ExpectedRevision = tc.params.expected
+			updated, err := core.UpdatePurchase(&ds, purchase.ID, update)
+
+			if tc.want.conflict {
+				require.ErrorIs(t, err, core.ErrConflict, tc.name)
+				var conflict *core.ConflictError
+				require.ErrorAs(t, err, &conflict, tc.name)
+				assert.Equal(t, core.ConflictError{Entity: "purchase", ID: purchase.ID, ExpectedRevision: *tc.params.expected, CurrentRevision: tc.want.revision, UpdatedAt: conflict.UpdatedAt}, *conflict, tc.name)
+				assert.Empty(t, ds.Purchases[0].Notes, tc.name)
+				return
+			}
 			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.revision, updated.Revision, tc.name)
+			assert.Equal(t, update.Notes, updated.Notes, tc.name)
 			assert.Equal(t, tc.want.totalPriceCents, updated.TotalPriceCents, tc.name)
 			assert.InDelta(t, tc.want.totalWeightKg, updated.TotalWeightKg, 1e-9, tc.name)
 		})
@@ -284,6 +393,77 @@ func TestDeleteBrand(t *testing.T) {
 	}
 }
 
+func TestSetBrandArchived(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		brandID  core.ID
+		archived bool
+	}
+	type want struct {
+		err    error
+		active []string
+	}
+
+	seed := core.DataStore{}
+	old, err := core.AddBrand(&seed, core.CreateBrandParams{Name: "Ancienne"})
+	require.NoError(t, err, "seed old brand")
+	_, err = core.AddBrand(&seed, core.CreateBrandParams{Name: "Actuelle"})
+	require.NoError(t, err, "seed current brand")
+	_, err = core.AddPurchase(&seed, core.CreatePurchaseParams{
+		BrandID:     old.ID,
+		PurchasedAt: time.Now().Add(-time.Hour),
+		Bags:        1,
+		BagWeightKg: 15,
+		UnitPrice:   core.Money(500),
+	})
+	require.NoError(t, err, "seed purchase")
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "archives a brand in use",
+			params: params{brandID: old.ID, archived: true},
+			want:   want{active: []string{"Actuelle"}},
+		},
+		{
+			name:   "restores a brand",
+			params: params{brandID: old.ID},
+			want:   want{active: []string{"Ancienne", "Actuelle"}},
+		},
+		{
+			name:   "reports unknown brands",
+			params: params{brandID: "missing", archived: true},
+			want:   want{err: core.ErrBrandNotFound, active: []string{"Ancienne", "Actuelle"}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := seed
+			ds.Brands = append([]core.Brand(nil), seed.Brands...)
+			brand, err := core.SetBrandArchived(&ds, tc.params.brandID, tc.params.archived)
+			assert.ErrorIs(t, err, tc.want.err, tc.name)
+			if tc.want.err == nil {
+				assert.Equal(t, tc.params.archived, brand.Archived, tc.name)
+			}
+			var active []string
+			for _, brand := range core.ActiveBrands(ds.Brands) {
+				active = append(active, brand.Name)
+			}
+			assert.Equal(t, tc.want.active, active, tc.name)
+			// The purchases of an archived brand still count.
+			assert.Equal(t, core.Money(500), core.ComputeInvesti(&ds, time.Time{}, time.Time{}), tc.name)
+		})
+	}
+}
+
 func TestAddConsumption(t *testing.T) {
 	t.Parallel()
 
@@ -292,7 +472,11 @@ func TestAddConsumption(t *testing.T) {
 		input     core.CreateConsumptionParams
 	}
 	type want struct {
-		bagCount int
+		bagCount   int
+		fraction   float64
+		weightKg   float64
+		powerLevel int
+		errField   string
 	}
 
 	seed := core.DataStore{}
@@ -319,6 +503,94 @@ func TestAddConsumption(t *testing.T) {
 				bagCount: 2,
 			},
 		},
+		{
+			name: "records power level",
+			params: params{
+				datastore: seed,
+				input: core.CreateConsumptionParams{
+					BrandID:    brand.ID,
+					ConsumedAt: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+					Bags:       1,
+					PowerLevel: 4,
+				},
+			},
+			want: want{
+				bagCount:   1,
+				powerLevel: 4,
+			},
+		},
+		{
+			name: "rejects out of range power level",
+			params: params{
+				datastore: seed,
+				input: core.CreateConsumptionParams{
+					BrandID:    brand.ID,
+					ConsumedAt: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+					Bags:       1,
+					PowerLevel: 6,
+				},
+			},
+			want: want{
+				errField: "power_level",
+			},
+		},
+		{
+			name: "records a weight without bags",
+			params: params{
+				datastore: seed,
+				input: core.CreateConsumptionParams{
+					BrandID:    brand.ID,
+					ConsumedAt: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+					WeightKg:   42.5,
+				},
+			},
+			want: want{
+				weightKg: 42.5,
+			},
+		},
+		{
+			name: "records part of a bag",
+			params: params{
+				datastore: seed,
+				input: core.CreateConsumptionParams{
+					BrandID:      brand.ID,
+					ConsumedAt:   time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+					Bags:         1,
+					BagsFraction: 0.5,
+				},
+			},
+			want: want{
+				bagCount: 1,
+				fraction: 0.5,
+			},
+		},
+		{
+			name: "rejects a part larger than a bag",
+			params: params{
+				datastore: seed,
+				input: core.CreateConsumptionParams{
+					BrandID:      brand.ID,
+					ConsumedAt:   time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+					BagsFraction: 1.5,
+				},
+			},
+			want: want{
+				errField: "bags_fraction",
+			},
+		},
+		{
+			name: "requires bags or a weight",
+			params: params{
+				datastore: seed,
+				input: core.CreateConsumptionParams{
+					BrandID:    brand.ID,
+					ConsumedAt: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+				},
+			},
+			want: want{
+				errField: "bags",
+			},
+		},
 	}
 
 	for _, tc := range tcs {
@@ -328,9 +600,206 @@ func TestAddConsumption(t *testing.T) {
 
 			ds := tc.params.datastore
 			consumption, err := core.AddConsumption(&ds, tc.params.input)
+			if tc.want.errField != "" {
+				var vErr core.ValidationErrors
+				require.True(t, errors.As(err, &vErr), tc.name)
+				assert.True(t, vErr.Has(tc.want.errField), tc.name)
+				assert.Empty(t, ds.Consumptions, tc.name)
+				return
+			}
 			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.powerLevel, consumption.PowerLevel, tc.name)
 			assert.Equal(t, tc.want.bagCount, consumption.Bags, tc.name)
+			assert.Equal(t, tc.want.fraction, consumption.BagsFraction, tc.name)
+			assert.Equal(t, tc.want.weightKg, consumption.WeightKg, tc.name)
 			assert.Equal(t, 1, len(ds.Consumptions), tc.name)
 		})
 	}
 }
+
+func TestDuplicateConsumption(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		id         core.ID
+		consumedAt time.Time
+	}
+	type want struct {
+		err      error
+		bags     int
+		weightKg float64
+		notes    string
+		count    int
+	}
+
+	seed := core.DataStore{}
+	brand, err := core.AddBrand(&seed, core.CreateBrandParams{Name: "Brand"})
+	require.NoError(t, err, "seed brand")
+	source, err := core.AddConsumption(&seed, core.CreateConsumptionParams{
+		BrandID:    brand.ID,
+		ConsumedAt: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+		Bags:       2,
+		Notes:      "Hiver",
+	})
+	require.NoError(t, err, "seed consumption")
+	weighed, err := core.AddConsumption(&seed, core.CreateConsumptionParams{
+		BrandID:    brand.ID,
+		ConsumedAt: time.Date(2024, time.February, 3, 0, 0, 0, 0, time.UTC),
+		Bags:       2,
+		WeightKg:   29.35,
+	})
+	require.NoError(t, err, "seed weighed consumption")
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "clones consumption on new date",
+			params: params{id: source.ID, consumedAt: time.Date(2024, time.February, 2, 0, 0, 0, 0, time.UTC)},
+			want:   want{bags: 2, notes: "Hiver", count: 3},
+		},
+		{
+			name:   "copies the weight of weighed bags",
+			params: params{id: weighed.ID, consumedAt: time.Date(2024, time.February, 4, 0, 0, 0, 0, time.UTC)},
+			want:   want{bags: 2, weightKg: 29.35, count: 3},
+		},
+		{
+			name:   "unknown consumption",
+			params: params{id: core.ID("missing"), consumedAt: time.Date(2024, time.February, 2, 0, 0, 0, 0, time.UTC)},
+			want:   want{err: core.ErrConsumptionNotFound, count: 2},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := seed
+			ds.Consumptions = append([]core.Consumption(nil), seed.Consumptions...)
+			consumption, err := core.DuplicateConsumption(&ds, tc.params.id, tc.params.consumedAt)
+			assert.Equal(t, tc.want.count, len(ds.Consumptions), tc.name)
+			if tc.want.err != nil {
+				assert.True(t, errors.Is(err, tc.want.err), tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.NotEqual(t, tc.params.id, consumption.ID, tc.name)
+			assert.Equal(t, brand.ID, consumption.BrandID, tc.name)
+			assert.Equal(t, tc.want.bags, consumption.Bags, tc.name)
+			assert.Equal(t, tc.want.weightKg, consumption.WeightKg, tc.name)
+			assert.Equal(t, tc.want.notes, consumption.Notes, tc.name)
+			assert.True(t, tc.params.consumedAt.Equal(consumption.ConsumedAt), tc.name)
+		})
+	}
+}
+
+func TestUpdateConsumption(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		bags int
+	}
+	type want struct {
+		weightKg float64
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "same bag count keeps weight", params: params{bags: 2}, want: want{weightKg: 29.35}},
+		{name: "new bag count drops weight", params: params{bags: 3}, want: want{weightKg: 0}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := sampleDataStore(t)
+			ds.Consumptions[0].WeightKg = 29.35
+			updated, err := core.UpdateConsumption(&ds, ds.Consumptions[0].ID, core.UpdateConsumptionParams{
+				ConsumedAt: time.Date(2024, time.February, 20, 0, 0, 0, 0, time.UTC),
+				Bags:       tc.params.bags,
+			})
+			assert.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.weightKg, updated.WeightKg, tc.name)
+		})
+	}
+}
+
+func TestForceDeleteBrand(t *testing.T) {
+	t.Parallel()
+
+	seed := core.DataStore{}
+	doomed, err := core.AddBrand(&seed, core.CreateBrandParams{Name: "Test"})
+	require.NoError(t, err, "seed doomed brand")
+	kept, err := core.AddBrand(&seed, core.CreateBrandParams{Name: "Kept"})
+	require.NoError(t, err, "seed kept brand")
+	for _, brandID := range []core.ID{doomed.ID, kept.ID} {
+		_, err = core.AddPurchase(&seed, core.CreatePurchaseParams{BrandID: brandID, Bags: 4, BagWeightKg: 15, UnitPrice: core.Money(500)})
+		require.NoError(t, err, "seed purchase")
+		_, err = core.AddConsumption(&seed, core.CreateConsumptionParams{BrandID: brandID, Bags: 1})
+		require.NoError(t, err, "seed consumption")
+	}
+
+	type params struct {
+		id core.ID
+	}
+	type want struct {
+		err                 error
+		removedPurchases    int
+		removedConsumptions int
+		brands              int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "cascades to purchases and consumptions",
+			params: params{id: doomed.ID},
+			want:   want{removedPurchases: 1, removedConsumptions: 1, brands: 1},
+		},
+		{
+			name:   "unknown brand",
+			params: params{id: core.ID("missing")},
+			want:   want{err: core.ErrBrandNotFound, brands: 2},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := seed
+			ds.Brands = append([]core.Brand(nil), seed.Brands...)
+			ds.Purchases = append([]core.Purchase(nil), seed.Purchases...)
+			ds.Consumptions = append([]core.Consumption(nil), seed.Consumptions...)
+
+			deletion, err := core.ForceDeleteBrand(&ds, tc.params.id)
+			assert.Len(t, ds.Brands, tc.want.brands, tc.name)
+			if tc.want.err != nil {
+				assert.True(t, errors.Is(err, tc.want.err), tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.params.id, deletion.Brand.ID, tc.name)
+			assert.Len(t, deletion.Purchases, tc.want.removedPurchases, tc.name)
+			assert.Len(t, deletion.Consumptions, tc.want.removedConsumptions, tc.name)
+			for _, purchase := range ds.Purchases {
+				assert.NotEqual(t, tc.params.id, purchase.BrandID, tc.name)
+			}
+			for _, consumption := range ds.Consumptions {
+				assert.NotEqual(t, tc.params.id, consumption.BrandID, tc.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Forecast bases reported by OrderPlan.ForecastBasis.
+const (
+	// ForecastPreviousSeason replays the consumption of the same days one
+	// year earlier.
+	ForecastPreviousSeason = "previous_season"
+	// ForecastRecentRate extrapolates the average of the last
+	// recentRateDays days when there is no history for last year.
+	ForecastRecentRate = "recent_rate"
+	// ForecastNone means no consumption was recorded yet.
+	ForecastNone = "none"
+)
+
+const recentRateDays = 30
+
+// OrderPlan summarizes what to order before the end of the heating season.
+type OrderPlan struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	// SeasonEnd is the last day covered by the forecast.
+	SeasonEnd     time.Time `json:"season_end"`
+	StockBags     int       `json:"stock_bags"`
+	ForecastBags  int       `json:"forecast_bags"`
+	ForecastBasis string    `json:"forecast_basis"`
+	// StockoutAt is the day the stock is expected to run out, zero when it
+	// covers the whole season.
+	StockoutAt      time.Time        `json:"stockout_at,omitempty"`
+	RecommendedBags int              `json:"recommended_bags"`
+	Brands          []OrderPlanBrand `json:"brands"`
+}
+
+// OrderPlanBrand gives the ordering conditions of a brand already purchased.
+type OrderPlanBrand struct {
+	BrandID         ID        `json:"brand_id"`
+	BrandName       string    `json:"brand_name"`
+	UnitPrice       Money     `json:"unit_price_cents"`
+	LastPurchasedAt time.Time `json:"last_purchased_at"`
+	LeadTimeDays    int       `json:"lead_time_days"`
+	StockBags       int       `json:"stock_bags"`
+	// OrderBy is the latest day to order so that the delivery arrives before
+	// the stockout, zero when no order is needed this season.
+	OrderBy       time.Time `json:"order_by,omitempty"`
+	EstimatedCost Money     `json:"estimated_cost_cents"`
+}
+
+// HeatingSeasonEnd returns the end of the heating season following now: the
+// next April 30th.
+func HeatingSeasonEnd(now time.Time) time.Time {
+	today := startOfDay(now)
+	end := time.Date(today.Year(), time.April, 30, 0, 0, 0, 0, time.UTC)
+	if end.Before(today) {
+		end = end.AddDate(1, 0, 0)
+	}
+	return end
+}
+
+// ComputePlanDeCommande forecasts the consumption until the end of the heating
+// season and derives how many bags to order, and by when for each brand given
+// its supplier lead time.
+func ComputePlanDeCommande(ctx context.Context, ds *DataStore, now time.Time) (OrderPlan, error) {
+	if ds == nil {
+		return OrderPlan{}, errors.New("nil datastore")
+	}
+
+	inventory, err := ComputeInventaire(ctx, ds, CostingFIFO)
+	if err != nil {
+		return OrderPlan{}, err
+	}
+
+	today := startOfDay(now)
+	plan := OrderPlan{
+		GeneratedAt: now,
+		SeasonEnd:   HeatingSeasonEnd(now),
+		StockBags:   inventory.TotalBags,
+	}
+
+	daily, basis := forecastDailyBags(ds, today, plan.SeasonEnd)
+	plan.ForecastBasis = basis
+	var cumulative float64
+	for i, bags := range daily {
+		cumulative += bags
+		if plan.StockoutAt.IsZero() && cumulative > float64(plan.StockBags) {
+			plan.StockoutAt = today.AddDate(0, 0, i)
+		}
+	}
+	plan.ForecastBags = int(math.Ceil(cumulative - 1e-9))
+	plan.RecommendedBags = max(0, plan.ForecastBags-plan.StockBags)
+
+	stockByBrand := make(map[ID]int, len(inventory.Brands))
+	for _, brand := range inventory.Brands {
+		stockByBrand[brand.BrandID] = brand.Bags
+	}
+	latest := make(map[ID]Purchase)
+	for _, purchase := range ds.Purchases {
+		if current, ok := latest[purchase.BrandID]; !ok || purchase.PurchasedAt.After(current.PurchasedAt) {
+			latest[purchase.BrandID] = purchase
+		}
+	}
+	for _, brand := range ds.Brands {
+		purchase, ok := latest[brand.ID]
+		if !ok {
+			continue
+		}
+		entry := OrderPlanBrand{
+			BrandID:         brand.ID,
+			BrandName:       brand.Name,
+			UnitPrice:       purchase.UnitPriceCents,
+			LastPurchasedAt: purchase.PurchasedAt,
+			LeadTimeDays:    brand.LeadTimeDays,
+			StockBags:       stockByBrand[brand.ID],
+			EstimatedCost:   purchase.UnitPriceCents.MulInt(plan.RecommendedBags),
+		}
+		if !plan.StockoutAt.IsZero() {
+			entry.OrderBy = plan.StockoutAt.AddDate(0, 0, -brand.LeadTimeDays)
+			if entry.OrderBy.Before(today) {
+				entry.OrderBy = today
+			}
+		}
+		plan.Brands = append(plan.Brands, entry)
+	}
+	sort.Slice(plan.Brands, func(i, j int) bool {
+		return strings.ToLower(plan.Brands[i].BrandName) < strings.ToLower(plan.Brands[j].BrandName)
+	})
+
+	return plan, nil
+}
+
+// forecastDailyBags returns the expected consumption of every day from today
+// to seasonEnd included.
+func forecastDailyBags(ds *DataStore, today, seasonEnd time.Time) ([]float64, string) {
+	days := int(seasonEnd.Sub(today).Hours()/24) + 1
+	daily := make([]float64, days)
+
+	lastYear := today.AddDate(-1, 0, 0)
+	hasHistory := false
+	for _, consumption := range ds.Consumptions {
+		if consumption.ConsumedAt.Before(lastYear) {
+			hasHistory = true
+			break
+		}
+	}
+	if hasHistory {
+		for _, consumption := range ds.Consumptions {
+			offset := int(startOfDay(consumption.ConsumedAt).Sub(lastYear).Hours() / 24)
+			if offset >= 0 && offset < days {
+				daily[offset] += consumption.TotalBags()
+			}
+		}
+		return daily, ForecastPreviousSeason
+	}
+
+	since := today.AddDate(0, 0, -recentRateDays)
+	recent := 0.0
+	for _, consumption := range ds.Consumptions {
+		if !consumption.ConsumedAt.Before(since) && consumption.ConsumedAt.Before(today) {
+			recent += consumption.TotalBags()
+		}
+	}
+	if recent == 0 {
+		return daily, ForecastNone
+	}
+	rate := recent / recentRateDays
+	for i := range daily {
+		daily[i] = rate
+	}
+	return daily, ForecastRecentRate
+}
@@ -0,0 +1,173 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestHeatingSeasonEnd(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		now time.Time
+	}
+	type want struct {
+		end time.Time
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "autumn ends next spring",
+			params: params{now: time.Date(2025, time.October, 16, 12, 0, 0, 0, time.UTC)},
+			want:   want{end: time.Date(2026, time.April, 30, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:   "winter ends this spring",
+			params: params{now: time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC)},
+			want:   want{end: time.Date(2026, time.April, 30, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:   "last day of the season",
+			params: params{now: time.Date(2026, time.April, 30, 18, 0, 0, 0, time.UTC)},
+			want:   want{end: time.Date(2026, time.April, 30, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want.end, core.HeatingSeasonEnd(tc.params.now), tc.name)
+		})
+	}
+}
+
+func TestComputePlanDeCommande(t *testing.T) {
+	t.Parallel()
+
+	type seedConsumption struct {
+		at   time.Time
+		bags int
+	}
+	type params struct {
+		purchaseAt   time.Time
+		purchaseBags int
+		consumptions []seedConsumption
+	}
+	type want struct {
+		basis       string
+		stock       int
+		forecast    int
+		recommended int
+		stockoutAt  time.Time
+		orderBy     time.Time
+		cost        core.Money
+	}
+
+	now := time.Date(2025, time.October, 16, 9, 0, 0, 0, time.UTC)
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "replays the previous season",
+			params: params{
+				purchaseAt:   day(2024, time.September, 1),
+				purchaseBags: 20,
+				consumptions: []seedConsumption{
+					{at: day(2024, time.October, 1), bags: 1},
+					{at: day(2024, time.October, 20), bags: 3},
+					{at: day(2024, time.November, 10), bags: 4},
+					{at: day(2024, time.December, 1), bags: 5},
+				},
+			},
+			want: want{
+				basis:       core.ForecastPreviousSeason,
+				stock:       7,
+				forecast:    12,
+				recommended: 5,
+				stockoutAt:  day(2025, time.December, 1),
+				orderBy:     day(2025, time.November, 24),
+				cost:        core.Money(5 * 500),
+			},
+		},
+		{
+			name: "extrapolates the recent rate without history",
+			params: params{
+				purchaseAt:   day(2025, time.September, 1),
+				purchaseBags: 60,
+				consumptions: []seedConsumption{{at: day(2025, time.October, 1), bags: 30}},
+			},
+			want: want{
+				basis:       core.ForecastRecentRate,
+				stock:       30,
+				forecast:    197,
+				recommended: 167,
+				stockoutAt:  day(2025, time.November, 15),
+				orderBy:     day(2025, time.November, 8),
+				cost:        core.Money(167 * 500),
+			},
+		},
+		{
+			name: "recommends nothing without consumption",
+			params: params{
+				purchaseAt:   day(2025, time.September, 1),
+				purchaseBags: 10,
+			},
+			want: want{
+				basis: core.ForecastNone,
+				stock: 10,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := core.DataStore{}
+			brand, err := core.AddBrand(&ds, core.CreateBrandParams{Name: "Granules", LeadTimeDays: 7})
+			require.NoError(t, err, tc.name)
+			_, err = core.AddPurchase(&ds, core.CreatePurchaseParams{
+				BrandID:     brand.ID,
+				PurchasedAt: tc.params.purchaseAt,
+				Bags:        tc.params.purchaseBags,
+				BagWeightKg: 15,
+				UnitPrice:   core.Money(500),
+			})
+			require.NoError(t, err, tc.name)
+			for _, c := range tc.params.consumptions {
+				_, err = core.AddConsumption(&ds, core.CreateConsumptionParams{BrandID: brand.ID, ConsumedAt: c.at, Bags: c.bags})
+				require.NoError(t, err, tc.name)
+			}
+
+			plan, err := core.ComputePlanDeCommande(context.Background(), &ds, now)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.basis, plan.ForecastBasis, tc.name)
+			assert.Equal(t, tc.want.stock, plan.StockBags, tc.name)
+			assert.Equal(t, tc.want.forecast, plan.ForecastBags, tc.name)
+			assert.Equal(t, tc.want.recommended, plan.RecommendedBags, tc.name)
+			assert.Equal(t, tc.want.stockoutAt, plan.StockoutAt, tc.name)
+			require.Len(t, plan.Brands, 1, tc.name)
+			assert.Equal(t, 7, plan.Brands[0].LeadTimeDays, tc.name)
+			assert.Equal(t, tc.want.orderBy, plan.Brands[0].OrderBy, tc.name)
+			assert.Equal(t, tc.want.cost, plan.Brands[0].EstimatedCost, tc.name)
+		})
+	}
+}
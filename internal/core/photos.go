@@ -0,0 +1,143 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// MaxPhotos bounds the photos of a brand gallery or of a purchase, every
+// one of them being stored in the datastore file.
+const MaxPhotos = 12
+
+// AddPhotoParams captures the input of AddBrandPhoto and AddPurchasePhoto.
+type AddPhotoParams struct {
+	Caption         string
+	ImageBase64     string
+	ThumbnailBase64 string
+}
+
+// AddBrandPhoto appends a photo to the gallery of a brand.
+func AddBrandPhoto(ds *DataStore, brandID ID, params AddPhotoParams) (Photo, error) {
+	if ds == nil {
+		return Photo{}, errors.New("nil datastore")
+	}
+	idx := findBrandIndex(ds.Brands, brandID)
+	if idx == -1 {
+		return Photo{}, ErrBrandNotFound
+	}
+
+	now := time.Now().UTC()
+	gallery, photo, err := addPhoto(ds.Brands[idx].Gallery, params, now)
+	if err != nil {
+		return Photo{}, err
+	}
+	ds.Brands[idx].Gallery = gallery
+	ds.Brands[idx].touch(now)
+	touchDatastore(ds, now)
+	return photo, nil
+}
+
+// DeleteBrandPhoto removes a photo from the gallery of a brand.
+func DeleteBrandPhoto(ds *DataStore, brandID, photoID ID) error {
+	if ds == nil {
+		return errors.New("nil datastore")
+	}
+	idx := findBrandIndex(ds.Brands, brandID)
+	if idx == -1 {
+		return ErrBrandNotFound
+	}
+
+	gallery, err := removePhoto(ds.Brands[idx].Gallery, photoID)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	ds.Brands[idx].Gallery = gallery
+	ds.Brands[idx].touch(now)
+	touchDatastore(ds, now)
+	return nil
+}
+
+// AddPurchasePhoto attaches a photo, typically of the receipt, to a
+// purchase.
+func AddPurchasePhoto(ds *DataStore, purchaseID ID, params AddPhotoParams) (Photo, error) {
+	if ds == nil {
+		return Photo{}, errors.New("nil datastore")
+	}
+	idx := findPurchaseIndex(ds.Purchases, purchaseID)
+	if idx == -1 {
+		return Photo{}, ErrPurchaseNotFound
+	}
+
+	now := time.Now().UTC()
+	photos, photo, err := addPhoto(ds.Purchases[idx].Photos, params, now)
+	if err != nil {
+		return Photo{}, err
+	}
+	ds.Purchases[idx].Photos = photos
+	ds.Purchases[idx].touch(now)
+	touchDatastore(ds, now)
+	return photo, nil
+}
+
+// DeletePurchasePhoto removes a photo from a purchase.
+func DeletePurchasePhoto(ds *DataStore, purchaseID, photoID ID) error {
+	if ds == nil {
+		return errors.New("nil datastore")
+	}
+	idx := findPurchaseIndex(ds.Purchases, purchaseID)
+	if idx == -1 {
+		return ErrPurchaseNotFound
+	}
+
+	photos, err := removePhoto(ds.Purchases[idx].Photos, photoID)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	ds.Purchases[idx].Photos = photos
+	ds.Purchases[idx].touch(now)
+	touchDatastore(ds, now)
+	return nil
+}
+
+// FindPhoto returns the photo id among photos.
+func FindPhoto(photos []Photo, id ID) (Photo, bool) {
+	for _, photo := range photos {
+		if photo.ID == id {
+			return photo, true
+		}
+	}
+	return Photo{}, false
+}
+
+func addPhoto(photos []Photo, params AddPhotoParams, now time.Time) ([]Photo, Photo, error) {
+	image := strings.TrimSpace(params.ImageBase64)
+	errs := ValidationErrors{}
+	errs = errs.AppendIf(image == "", "image", "image is required")
+	errs = errs.AppendIf(len(photos) >= MaxPhotos, "image", "too many photos")
+	if len(errs) > 0 {
+		return nil, Photo{}, errs
+	}
+
+	photo := Photo{
+		ID:              NewID(),
+		AddedAt:         now,
+		Caption:         strings.TrimSpace(params.Caption),
+		ImageBase64:     image,
+		ThumbnailBase64: strings.TrimSpace(params.ThumbnailBase64),
+	}
+	// A fresh slice keeps the datastore snapshots sharing the old one intact.
+	return append(append([]Photo(nil), photos...), photo), photo, nil
+}
+
+func removePhoto(photos []Photo, id ID) ([]Photo, error) {
+	for i, photo := range photos {
+		if photo.ID == id {
+			kept := append([]Photo(nil), photos[:i]...)
+			return append(kept, photos[i+1:]...), nil
+		}
+	}
+	return nil, ErrPhotoNotFound
+}
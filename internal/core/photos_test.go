@@ -0,0 +1,145 @@
+package core_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestAddPurchasePhoto(t *testing.T) {
+	t.Parallel()
+
+	full := make([]core.Photo, core.MaxPhotos)
+	for i := range full {
+		full[i] = core.Photo{ID: core.NewID(), ImageBase64: "QUJD"}
+	}
+
+	type params struct {
+		purchaseID core.ID
+		photos     []core.Photo
+		add        core.AddPhotoParams
+	}
+	type want struct {
+		expectErr error
+		photos    int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "attaches a photo",
+			params: params{purchaseID: "p1", add: core.AddPhotoParams{Caption: " Ticket ", ImageBase64: "QUJD", ThumbnailBase64: "QQ=="}},
+			want:   want{photos: 1},
+		},
+		{
+			name:   "requires an image",
+			params: params{purchaseID: "p1", add: core.AddPhotoParams{Caption: "Ticket"}},
+			want:   want{expectErr: core.ValidationErrors{}},
+		},
+		{
+			name:   "bounds the photos",
+			params: params{purchaseID: "p1", photos: full, add: core.AddPhotoParams{ImageBase64: "QUJD"}},
+			want:   want{expectErr: core.ValidationErrors{}},
+		},
+		{
+			name:   "fails on an unknown purchase",
+			params: params{purchaseID: "missing", add: core.AddPhotoParams{ImageBase64: "QUJD"}},
+			want:   want{expectErr: core.ErrPurchaseNotFound},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := core.DataStore{Purchases: []core.Purchase{{Meta: core.Meta{ID: "p1"}, BrandID: "b1", PurchasedAt: time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC), Bags: 10, Photos: tc.params.photos}}}
+
+			photo, err := core.AddPurchasePhoto(&ds, tc.params.purchaseID, tc.params.add)
+			if tc.want.expectErr != nil {
+				require.Error(t, err, tc.name)
+				if _, ok := tc.want.expectErr.(core.ValidationErrors); ok {
+					assert.ErrorAs(t, err, new(core.ValidationErrors), tc.name)
+				} else {
+					assert.ErrorIs(t, err, tc.want.expectErr, tc.name)
+				}
+				assert.Len(t, ds.Purchases[0].Photos, len(tc.params.photos), tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.NotEmpty(t, photo.ID, tc.name)
+			assert.Equal(t, "Ticket", photo.Caption, tc.name)
+			assert.Equal(t, int64(1), ds.Purchases[0].Revision, tc.name)
+			require.Len(t, ds.Purchases[0].Photos, tc.want.photos, tc.name)
+			assert.Equal(t, photo, ds.Purchases[0].Photos[0], tc.name)
+		})
+	}
+}
+
+func TestDeleteBrandPhoto(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		brandID core.ID
+		photoID core.ID
+	}
+	type want struct {
+		expectErr error
+		photos    []core.ID
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "removes the photo",
+			params: params{brandID: "b1", photoID: "ph1"},
+			want:   want{photos: []core.ID{"ph2"}},
+		},
+		{
+			name:   "fails on an unknown photo",
+			params: params{brandID: "b1", photoID: "ph3"},
+			want:   want{expectErr: core.ErrPhotoNotFound, photos: []core.ID{"ph1", "ph2"}},
+		},
+		{
+			name:   "fails on an unknown brand",
+			params: params{brandID: "missing", photoID: "ph1"},
+			want:   want{expectErr: core.ErrBrandNotFound, photos: []core.ID{"ph1", "ph2"}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			gallery := []core.Photo{{ID: "ph1", ImageBase64: "QUJD"}, {ID: "ph2", ImageBase64: "REVG"}}
+			ds := core.DataStore{Brands: []core.Brand{{Meta: core.Meta{ID: "b1"}, Name: "Woodstock", Gallery: gallery}}}
+
+			err := core.DeleteBrandPhoto(&ds, tc.params.brandID, tc.params.photoID)
+			if tc.want.expectErr != nil {
+				assert.ErrorIs(t, err, tc.want.expectErr, tc.name)
+			} else {
+				require.NoError(t, err, tc.name)
+			}
+
+			var ids []core.ID
+			for _, photo := range ds.Brands[0].Gallery {
+				ids = append(ids, photo.ID)
+			}
+			assert.Equal(t, tc.want.photos, ids, tc.name)
+			// The slice a snapshot of the datastore may share is left as it was.
+			assert.Equal(t, core.ID("ph1"), gallery[0].ID, tc.name)
+			assert.Equal(t, core.ID("ph2"), gallery[1].ID, tc.name)
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// MoveToBrandParams names the brand a purchase or a consumption recorded
+// under the wrong brand is moved to.
+type MoveToBrandParams struct {
+	BrandID ID
+	// ExpectedRevision, when set, rejects the move with a ConflictError
+	// unless the entry is still at this revision.
+	ExpectedRevision *int64
+}
+
+// MovePurchaseToBrand records a purchase under another brand, keeping its ID
+// and dates. The transfers of both brands take their FIFO lots again, the
+// move failing with ErrInsufficientInventory when a transfer or a
+// consumption no longer finds the bags it took. The move is added to the
+// audit trail; moving to the current brand changes nothing.
+func MovePurchaseToBrand(ds *DataStore, id ID, params MoveToBrandParams) (Purchase, error) {
+	if ds == nil {
+		return Purchase{}, errors.New("nil datastore")
+	}
+
+	idx := findPurchaseIndex(ds.Purchases, id)
+	if idx == -1 {
+		return Purchase{}, ErrPurchaseNotFound
+	}
+	if err := checkRevision("purchase", ds.Purchases[idx].Meta, params.ExpectedRevision); err != nil {
+		return Purchase{}, err
+	}
+	if errs := validateBrandMove(ds, params.BrandID); len(errs) > 0 {
+		return Purchase{}, errs
+	}
+	purchase := ds.Purchases[idx]
+	from := purchase.BrandID
+	if from == params.BrandID {
+		return purchase, nil
+	}
+
+	now := time.Now().UTC()
+	purchase.BrandID = params.BrandID
+	purchase.touch(now)
+
+	candidate := *ds
+	candidate.Purchases = slices.Clone(ds.Purchases)
+	candidate.Purchases[idx] = purchase
+	err := relotTransfers(&candidate, func(transfer Transfer) bool {
+		return transferTouchesBrand(transfer, from, params.BrandID) || slices.ContainsFunc(transfer.Lots, func(lot TransferLot) bool { return lot.PurchaseID == id })
+	})
+	if err != nil {
+		return Purchase{}, err
+	}
+
+	ds.Purchases = candidate.Purchases
+	ds.Transfers = candidate.Transfers
+	recordAudit(ds, now, AuditActionReassign, AuditEntityPurchase, purchase.ID, describeBrandMove(ds, "purchase", purchase.PurchasedAt, from, purchase.BrandID))
+	touchDatastore(ds, now)
+
+	return purchase, nil
+}
+
+// MoveConsumptionToBrand records a consumption under another brand, keeping
+// its ID and dates, like MovePurchaseToBrand.
+func MoveConsumptionToBrand(ds *DataStore, id ID, params MoveToBrandParams) (Consumption, error) {
+	if ds == nil {
+		return Consumption{}, errors.New("nil datastore")
+	}
+
+	idx := findConsumptionIndex(ds.Consumptions, id)
+	if idx == -1 {
+		return Consumption{}, ErrConsumptionNotFound
+	}
+	if err := checkRevision("consumption", ds.Consumptions[idx].Meta, params.ExpectedRevision); err != nil {
+		return Consumption{}, err
+	}
+	if errs := validateBrandMove(ds, params.BrandID); len(errs) > 0 {
+		return Consumption{}, errs
+	}
+	consumption := ds.Consumptions[idx]
+	from := consumption.BrandID
+	if from == params.BrandID {
+		return consumption, nil
+	}
+
+	now := time.Now().UTC()
+	consumption.BrandID = params.BrandID
+	consumption.touch(now)
+
+	candidate := *ds
+	candidate.Consumptions = slices.Clone(ds.Consumptions)
+	candidate.Consumptions[idx] = consumption
+	err := relotTransfers(&candidate, func(transfer Transfer) bool {
+		return transferTouchesBrand(transfer, from, params.BrandID)
+	})
+	if err != nil {
+		return Consumption{}, err
+	}
+
+	ds.Consumptions = candidate.Consumptions
+	ds.Transfers = candidate.Transfers
+	recordAudit(ds, now, AuditActionReassign, AuditEntityConsumption, consumption.ID, describeBrandMove(ds, "consumption", consumption.ConsumedAt, from, consumption.BrandID))
+	touchDatastore(ds, now)
+
+	return consumption, nil
+}
+
+func validateBrandMove(ds *DataStore, brandID ID) ValidationErrors {
+	errs := ValidationErrors{}
+	return errs.AppendIf(!brandExists(ds.Brands, brandID), "brand_id", "unknown brand")
+}
+
+// relotTransfers forgets the lots recorded on the affected transfers and
+// replays the stock of ds, recording the oldest lots they take instead.
+func relotTransfers(ds *DataStore, affected func(Transfer) bool) error {
+	transfers := slices.Clone(ds.Transfers)
+	relotted := make(map[ID]bool)
+	for i, transfer := range transfers {
+		if affected(transfer) {
+			transfers[i].Lots = nil
+			relotted[transfer.ID] = true
+		}
+	}
+	ds.Transfers = transfers
+
+	tracker, err := replayLocations(context.Background(), ds)
+	if err != nil {
+		return err
+	}
+	for i, transfer := range ds.Transfers {
+		if relotted[transfer.ID] {
+			ds.Transfers[i].Lots = tracker.moved[transfer.ID]
+		}
+	}
+	return nil
+}
+
+func transferTouchesBrand(transfer Transfer, brandIDs ...ID) bool {
+	return slices.Contains(brandIDs, transfer.BrandID) || (transfer.ToBrandID != "" && slices.Contains(brandIDs, transfer.ToBrandID))
+}
+
+func describeBrandMove(ds *DataStore, entity string, at time.Time, from, to ID) string {
+	names := brandNameIndex(ds.Brands)
+	return fmt.Sprintf("%s of %s moved from %s to %s", entity, at.Format(time.DateOnly), names[from], names[to])
+}
@@ -0,0 +1,229 @@
+package core_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestMovePurchaseToBrand(t *testing.T) {
+	t.Parallel()
+
+	jan15 := time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC)
+	jan20 := time.Date(2024, time.January, 20, 0, 0, 0, 0, time.UTC)
+	stale := int64(7)
+
+	type params struct {
+		// january moves the purchase of January 10 instead of the one of
+		// February 5.
+		january bool
+		// transfer records a transfer of 2 bags of Granules on January 15.
+		transfer bool
+		// targetTransfer records a purchase of 2 bags of the target brand on
+		// January 20 and a transfer of 1 of them on February 10.
+		targetTransfer bool
+		unknownBrand   bool
+		sameBrand      bool
+		revision       *int64
+	}
+	type want struct {
+		err             error
+		validationField string
+		moved           bool
+		// targetLot expects the transfer of the target brand to take the
+		// moved purchase.
+		targetLot bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "moves a purchase",
+			params: params{transfer: true},
+			want:   want{moved: true},
+		},
+		{
+			name:   "relots the transfers of the target brand",
+			params: params{january: true, targetTransfer: true},
+			want:   want{moved: true, targetLot: true},
+		},
+		{
+			name:   "rejects a move taking the bags of a transfer",
+			params: params{january: true, transfer: true},
+			want:   want{err: core.ErrInsufficientInventory},
+		},
+		{
+			name:   "rejects an unknown brand",
+			params: params{unknownBrand: true},
+			want:   want{validationField: "brand_id"},
+		},
+		{
+			name:   "rejects a stale revision",
+			params: params{revision: &stale},
+			want:   want{err: core.ErrConflict},
+		},
+		{
+			name:   "changes nothing for the current brand",
+			params: params{sameBrand: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := locationDataStore(t)
+			source := ds.Brands[0].ID
+			target, err := core.AddBrand(&ds, core.CreateBrandParams{Name: "Pellets Pro"})
+			require.NoError(t, err, tc.name)
+			if tc.params.transfer {
+				_, err := core.AddTransfer(&ds, core.CreateTransferParams{BrandID: source, FromLocation: "Garage", ToLocation: "Cave", Bags: 2, TransferredAt: jan15})
+				require.NoError(t, err, tc.name)
+			}
+			if tc.params.targetTransfer {
+				_, err := core.AddPurchase(&ds, core.CreatePurchaseParams{BrandID: target.ID, PurchasedAt: jan20, Bags: 2, BagWeightKg: 15, UnitPrice: 700, Location: "Garage"})
+				require.NoError(t, err, tc.name)
+				_, err = core.AddTransfer(&ds, core.CreateTransferParams{BrandID: target.ID, FromLocation: "Garage", ToLocation: "Cave", Bags: 1, TransferredAt: jan20.AddDate(0, 0, 21)})
+				require.NoError(t, err, tc.name)
+			}
+			var purchase core.Purchase
+			for _, candidate := range ds.Purchases {
+				if candidate.BrandID == source && (candidate.PurchasedAt.Month() == time.January) == tc.params.january {
+					purchase = candidate
+				}
+			}
+			require.NotEmpty(t, purchase.ID, tc.name)
+			brandID := target.ID
+			switch {
+			case tc.params.unknownBrand:
+				brandID = "missing"
+			case tc.params.sameBrand:
+				brandID = source
+			}
+			before := ds
+			audit := len(ds.Audit)
+
+			moved, err := core.MovePurchaseToBrand(&ds, purchase.ID, core.MoveToBrandParams{BrandID: brandID, ExpectedRevision: tc.params.revision})
+			if tc.want.err != nil {
+				assert.ErrorIs(t, err, tc.want.err, tc.name)
+				assert.Equal(t, before, ds, tc.name)
+				return
+			}
+			if tc.want.validationField != "" {
+				var vErr core.ValidationErrors
+				require.ErrorAs(t, err, &vErr, tc.name)
+				assert.True(t, vErr.Has(tc.want.validationField), tc.name)
+				assert.Equal(t, before, ds, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			if !tc.want.moved {
+				assert.Equal(t, purchase, moved, tc.name)
+				assert.Len(t, ds.Audit, audit, tc.name)
+				return
+			}
+			assert.Equal(t, purchase.ID, moved.ID, tc.name)
+			assert.Equal(t, purchase.CreatedAt, moved.CreatedAt, tc.name)
+			assert.Equal(t, purchase.PurchasedAt, moved.PurchasedAt, tc.name)
+			assert.Equal(t, target.ID, moved.BrandID, tc.name)
+			assert.Equal(t, purchase.Revision+1, moved.Revision, tc.name)
+			require.Len(t, ds.Audit, audit+1, tc.name)
+			assert.Equal(t, core.AuditActionReassign, ds.Audit[0].Action, tc.name)
+			assert.Equal(t, core.AuditEntityPurchase, ds.Audit[0].Entity, tc.name)
+			assert.Equal(t, purchase.ID, ds.Audit[0].EntityID, tc.name)
+			assert.Contains(t, ds.Audit[0].Summary, "from Granules to Pellets Pro", tc.name)
+			if tc.want.targetLot {
+				for _, transfer := range ds.Transfers {
+					if transfer.BrandID == target.ID {
+						assert.Equal(t, []core.TransferLot{{PurchaseID: purchase.ID, Bags: 1, UnitPrice: 550}}, transfer.Lots, tc.name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMoveConsumptionToBrand(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		// stocked buys bags of the target brand before the consumption.
+		stocked      bool
+		unknownBrand bool
+	}
+	type want struct {
+		err             error
+		validationField string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "moves a consumption",
+			params: params{stocked: true},
+		},
+		{
+			name: "rejects a brand without the bags consumed",
+			want: want{err: core.ErrInsufficientInventory},
+		},
+		{
+			name:   "rejects an unknown brand",
+			params: params{stocked: true, unknownBrand: true},
+			want:   want{validationField: "brand_id"},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := locationDataStore(t)
+			target, err := core.AddBrand(&ds, core.CreateBrandParams{Name: "Pellets Pro"})
+			require.NoError(t, err, tc.name)
+			if tc.params.stocked {
+				_, err := core.AddPurchase(&ds, core.CreatePurchaseParams{BrandID: target.ID, PurchasedAt: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC), Bags: 4, BagWeightKg: 15, UnitPrice: 700})
+				require.NoError(t, err, tc.name)
+			}
+			brandID := target.ID
+			if tc.params.unknownBrand {
+				brandID = "missing"
+			}
+			consumption := ds.Consumptions[0]
+			before := ds
+
+			moved, err := core.MoveConsumptionToBrand(&ds, consumption.ID, core.MoveToBrandParams{BrandID: brandID})
+			if tc.want.err != nil {
+				assert.ErrorIs(t, err, tc.want.err, tc.name)
+				assert.Equal(t, before, ds, tc.name)
+				return
+			}
+			if tc.want.validationField != "" {
+				var vErr core.ValidationErrors
+				require.ErrorAs(t, err, &vErr, tc.name)
+				assert.True(t, vErr.Has(tc.want.validationField), tc.name)
+				assert.Equal(t, before, ds, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, consumption.ID, moved.ID, tc.name)
+			assert.Equal(t, consumption.ConsumedAt, moved.ConsumedAt, tc.name)
+			assert.Equal(t, target.ID, moved.BrandID, tc.name)
+			assert.Equal(t, target.ID, ds.Consumptions[0].BrandID, tc.name)
+			require.Len(t, ds.Audit, 1, tc.name)
+			assert.Equal(t, core.AuditActionReassign, ds.Audit[0].Action, tc.name)
+			assert.Equal(t, core.AuditEntityConsumption, ds.Audit[0].Entity, tc.name)
+		})
+	}
+}
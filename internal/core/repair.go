@@ -0,0 +1,134 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// RepairIssue is a problem found in a datastore read leniently. Path is the
+// JSON pointer of the entry at fault, such as /purchases/3, as in
+// ValidateDataStoreJSON.
+type RepairIssue struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+	// Fixed is false for the issues only flagged, left as they are for a
+	// person to check.
+	Fixed bool `json:"fixed"`
+}
+
+// RepairReport lists what a lenient load changed in, or flagged on, a
+// datastore.
+type RepairReport struct {
+	At     time.Time     `json:"at"`
+	Issues []RepairIssue `json:"issues"`
+}
+
+// Add records an issue found at path.
+func (r *RepairReport) Add(path string, fixed bool, format string, args ...any) {
+	r.Issues = append(r.Issues, RepairIssue{Path: path, Message: fmt.Sprintf(format, args...), Fixed: fixed})
+}
+
+// Fixed counts the issues that were repaired.
+func (r RepairReport) Fixed() int {
+	fixed := 0
+	for _, issue := range r.Issues {
+		if issue.Fixed {
+			fixed++
+		}
+	}
+	return fixed
+}
+
+// RepairDataStore fixes the issues left by old versions or hand edits that
+// the rest of the code does not expect, and records them in report:
+//
+//   - brands, purchases and consumptions without an ID, or with the ID of an
+//     earlier entry, get a new one;
+//   - a zero creation or update time is set from the date of the entry;
+//   - a purchase or consumption without a date takes its creation time.
+//
+// Negative bag counts and references to unknown brands are only flagged:
+// guessing them could make the statistics wrong without anyone noticing.
+func RepairDataStore(ds *DataStore, now time.Time, report *RepairReport) {
+	if ds == nil {
+		return
+	}
+
+	seen := make(map[ID]bool, len(ds.Brands))
+	for i := range ds.Brands {
+		brand := &ds.Brands[i]
+		path := fmt.Sprintf("/brands/%d", i)
+		repairMeta(&brand.Meta, seen, time.Time{}, now, path, report)
+		if NormalizeName(brand.Name) == "" {
+			report.Add(path+"/name", false, "brand without a name")
+		}
+	}
+	brands := seen
+
+	seen = make(map[ID]bool, len(ds.Purchases))
+	for i := range ds.Purchases {
+		purchase := &ds.Purchases[i]
+		path := fmt.Sprintf("/purchases/%d", i)
+		if purchase.PurchasedAt.IsZero() && !purchase.CreatedAt.IsZero() {
+			purchase.PurchasedAt = purchase.CreatedAt
+			report.Add(path+"/purchased_at", true, "missing purchase date set to its creation time")
+		}
+		repairMeta(&purchase.Meta, seen, purchase.PurchasedAt, now, path, report)
+		if purchase.PurchasedAt.IsZero() {
+			report.Add(path+"/purchased_at", false, "purchase without a date")
+		}
+		if purchase.Bags < 0 {
+			report.Add(path+"/bags", false, "negative number of bags: %d", purchase.Bags)
+		}
+		if !brands[purchase.BrandID] {
+			report.Add(path+"/brand_id", false, "unknown brand %q", purchase.BrandID)
+		}
+	}
+
+	seen = make(map[ID]bool, len(ds.Consumptions))
+	for i := range ds.Consumptions {
+		consumption := &ds.Consumptions[i]
+		path := fmt.Sprintf("/consumptions/%d", i)
+		if consumption.ConsumedAt.IsZero() && !consumption.CreatedAt.IsZero() {
+			consumption.ConsumedAt = consumption.CreatedAt
+			report.Add(path+"/consumed_at", true, "missing consumption date set to its creation time")
+		}
+		repairMeta(&consumption.Meta, seen, consumption.ConsumedAt, now, path, report)
+		if consumption.ConsumedAt.IsZero() {
+			report.Add(path+"/consumed_at", false, "consumption without a date")
+		}
+		if consumption.Bags < 0 {
+			report.Add(path+"/bags", false, "negative number of bags: %d", consumption.Bags)
+		}
+		if !brands[consumption.BrandID] {
+			report.Add(path+"/brand_id", false, "unknown brand %q", consumption.BrandID)
+		}
+	}
+}
+
+// repairMeta gives the entry at path an ID unique among seen and timestamps,
+// taken from at or else now.
+func repairMeta(meta *Meta, seen map[ID]bool, at, now time.Time, path string, report *RepairReport) {
+	switch {
+	case meta.ID == "":
+		meta.ID = NewID()
+		report.Add(path+"/id", true, "missing ID replaced by %s", meta.ID)
+	case seen[meta.ID]:
+		previous := meta.ID
+		meta.ID = NewID()
+		report.Add(path+"/id", true, "duplicate ID %s replaced by %s", previous, meta.ID)
+	}
+	seen[meta.ID] = true
+
+	if meta.CreatedAt.IsZero() {
+		meta.CreatedAt = at
+		if at.IsZero() {
+			meta.CreatedAt = now
+		}
+		report.Add(path+"/created_at", true, "missing creation time set to %s", meta.CreatedAt.Format(time.RFC3339))
+	}
+	if meta.UpdatedAt.IsZero() {
+		meta.UpdatedAt = meta.CreatedAt
+		report.Add(path+"/updated_at", true, "missing update time set to %s", meta.UpdatedAt.Format(time.RFC3339))
+	}
+}
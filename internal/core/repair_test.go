@@ -0,0 +1,131 @@
+package core_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestRepairDataStore(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, time.November, 10, 8, 0, 0, 0, time.UTC)
+	purchasedAt := time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC)
+	meta := core.Meta{ID: "purchase-1", CreatedAt: purchasedAt, UpdatedAt: purchasedAt}
+	brand := core.Brand{Meta: core.Meta{ID: "brand-1", CreatedAt: purchasedAt, UpdatedAt: purchasedAt}, Name: "Woodstock"}
+
+	type params struct {
+		ds core.DataStore
+	}
+	type want struct {
+		paths []string
+		fixed int
+		check func(t *testing.T, ds core.DataStore, name string)
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "leaves valid records alone",
+			params: params{ds: core.DataStore{
+				Brands:    []core.Brand{brand},
+				Purchases: []core.Purchase{{Meta: meta, BrandID: "brand-1", PurchasedAt: purchasedAt, Bags: 2}},
+			}},
+		},
+		{
+			name: "assigns missing and duplicate IDs",
+			params: params{ds: core.DataStore{
+				Brands: []core.Brand{brand},
+				Purchases: []core.Purchase{
+					{Meta: meta, BrandID: "brand-1", PurchasedAt: purchasedAt, Bags: 1},
+					{Meta: meta, BrandID: "brand-1", PurchasedAt: purchasedAt, Bags: 2},
+					{Meta: core.Meta{CreatedAt: purchasedAt, UpdatedAt: purchasedAt}, BrandID: "brand-1", PurchasedAt: purchasedAt, Bags: 3},
+				},
+			}},
+			want: want{
+				paths: []string{"/purchases/1/id", "/purchases/2/id"},
+				fixed: 2,
+				check: func(t *testing.T, ds core.DataStore, name string) {
+					assert.Equal(t, core.ID("purchase-1"), ds.Purchases[0].ID, name)
+					assert.NotEqual(t, ds.Purchases[0].ID, ds.Purchases[1].ID, name)
+					assert.NotEmpty(t, ds.Purchases[2].ID, name)
+				},
+			},
+		},
+		{
+			name: "fills zero timestamps from the date of the entry",
+			params: params{ds: core.DataStore{
+				Brands:    []core.Brand{{Meta: core.Meta{ID: "brand-1"}, Name: "Woodstock"}},
+				Purchases: []core.Purchase{{Meta: core.Meta{ID: "purchase-1"}, BrandID: "brand-1", PurchasedAt: purchasedAt, Bags: 2}},
+			}},
+			want: want{
+				paths: []string{"/brands/0/created_at", "/brands/0/updated_at", "/purchases/0/created_at", "/purchases/0/updated_at"},
+				fixed: 4,
+				check: func(t *testing.T, ds core.DataStore, name string) {
+					assert.Equal(t, now, ds.Brands[0].CreatedAt, name)
+					assert.Equal(t, purchasedAt, ds.Purchases[0].CreatedAt, name)
+					assert.Equal(t, purchasedAt, ds.Purchases[0].UpdatedAt, name)
+				},
+			},
+		},
+		{
+			name: "dates a consumption from its creation time",
+			params: params{ds: core.DataStore{
+				Brands:       []core.Brand{brand},
+				Consumptions: []core.Consumption{{Meta: core.Meta{ID: "consumption-1", CreatedAt: purchasedAt, UpdatedAt: purchasedAt}, BrandID: "brand-1", Bags: 1}},
+			}},
+			want: want{
+				paths: []string{"/consumptions/0/consumed_at"},
+				fixed: 1,
+				check: func(t *testing.T, ds core.DataStore, name string) {
+					assert.Equal(t, purchasedAt, ds.Consumptions[0].ConsumedAt, name)
+				},
+			},
+		},
+		{
+			name: "flags negative bags and unknown brands",
+			params: params{ds: core.DataStore{
+				Brands: []core.Brand{brand},
+				Purchases: []core.Purchase{
+					{Meta: meta, BrandID: "brand-1", PurchasedAt: purchasedAt, Bags: -2},
+					{Meta: core.Meta{ID: "purchase-2", CreatedAt: purchasedAt, UpdatedAt: purchasedAt}, BrandID: "brand-gone", PurchasedAt: purchasedAt, Bags: 1},
+				},
+			}},
+			want: want{
+				paths: []string{"/purchases/0/bags", "/purchases/1/brand_id"},
+				check: func(t *testing.T, ds core.DataStore, name string) {
+					assert.Equal(t, -2, ds.Purchases[0].Bags, name)
+					assert.Equal(t, core.ID("brand-gone"), ds.Purchases[1].BrandID, name)
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := tc.params.ds
+			report := core.RepairReport{At: now}
+			core.RepairDataStore(&ds, now, &report)
+
+			var paths []string
+			for _, issue := range report.Issues {
+				paths = append(paths, issue.Path)
+			}
+			require.Equal(t, tc.want.paths, paths, tc.name)
+			assert.Equal(t, tc.want.fixed, report.Fixed(), tc.name)
+			if tc.want.check != nil {
+				tc.want.check(t, ds, tc.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,350 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// MinConsumptionRetentionYears is the shortest retention of the
+// consumptions: the forecast replays the same period of the year before.
+const MinConsumptionRetentionYears = 2
+
+// ErrPurgeChangesStock is returned by PurgeDataStore when removing the old
+// consumptions would change the stock or the value of the ones kept.
+var ErrPurgeChangesStock = errors.New("purging the consumptions would change the stock")
+
+// RetentionPolicy sets how many years of each kind of entry are kept; zero
+// keeps them all.
+type RetentionPolicy struct {
+	// Consumptions also removes the purchases and transfers of the lots they
+	// emptied; their figures stay in the season summaries.
+	Consumptions int
+	Audit        int
+	Temperatures int
+	Occupancy    int
+	// SiloReadings always keeps the latest reading of each silo.
+	SiloReadings int
+	// CompactSeasons compacts the seasons ended more than CompactSeasons
+	// seasons ago: their emptied purchases and the consumptions taken from
+	// them are collapsed into the season archives, like Consumptions does
+	// but on season boundaries. The later cutoff of the two applies.
+	CompactSeasons int
+}
+
+// Enabled reports whether the policy purges anything.
+func (p RetentionPolicy) Enabled() bool {
+	return p.Consumptions > 0 || p.Audit > 0 || p.Temperatures > 0 || p.Occupancy > 0 || p.SiloReadings > 0 || p.CompactSeasons > 0
+}
+
+// PurgeSummary counts the entries removed by PurgeDataStore.
+type PurgeSummary struct {
+	Purchases    int `json:"purchases"`
+	Consumptions int `json:"consumptions"`
+	Transfers    int `json:"transfers"`
+	Audit        int `json:"audit"`
+	Temperatures int `json:"temperatures"`
+	Occupancy    int `json:"occupancy"`
+	SiloReadings int `json:"silo_readings"`
+}
+
+// Total returns the number of entries removed.
+func (s PurgeSummary) Total() int {
+	return s.Purchases + s.Consumptions + s.Transfers + s.Audit + s.Temperatures + s.Occupancy + s.SiloReadings
+}
+
+// PurgeDataStore removes the entries older than policy allows at now.
+//
+// A consumption is only removed with every purchase lot it was taken from,
+// once the lot is empty and each consumption and transfer of it is old
+// enough too, so the stock left and its FIFO value do not change. The
+// purchases and consumptions removed are added to the SeasonArchives, which
+// keep the season summaries whole. ds is left untouched on error.
+func PurgeDataStore(ctx context.Context, ds *DataStore, policy RetentionPolicy, now time.Time) (PurgeSummary, error) {
+	if ds == nil {
+		return PurgeSummary{}, errors.New("nil datastore")
+	}
+	purged := cloneForImport(*ds)
+	var summary PurgeSummary
+	var cutoff time.Time
+	if policy.Consumptions > 0 {
+		cutoff = retentionCutoff(now, policy.Consumptions)
+	}
+	if policy.CompactSeasons > 0 {
+		if compacted := compactionCutoff(now, policy.CompactSeasons); compacted.After(cutoff) {
+			cutoff = compacted
+		}
+	}
+	if !cutoff.IsZero() {
+		var err error
+		summary, err = purgeConsumptions(ctx, &purged, cutoff)
+		if err != nil {
+			return PurgeSummary{}, err
+		}
+	}
+	if policy.Audit > 0 {
+		cutoff := retentionCutoff(now, policy.Audit)
+		purged.Audit, summary.Audit = keepSince(purged.Audit, cutoff, func(entry AuditEntry) time.Time { return entry.At })
+	}
+	if policy.Temperatures > 0 {
+		cutoff := retentionCutoff(now, policy.Temperatures)
+		purged.Temperatures, summary.Temperatures = keepSince(purged.Temperatures, cutoff, func(day DailyTemperature) time.Time { return day.Date })
+	}
+	if policy.Occupancy > 0 {
+		cutoff := retentionCutoff(now, policy.Occupancy)
+		purged.Occupancy, summary.Occupancy = keepSince(purged.Occupancy, cutoff, func(day DailyOccupancy) time.Time { return day.Date })
+	}
+	if policy.SiloReadings > 0 {
+		purged.SiloReadings, summary.SiloReadings = purgeSiloReadings(purged.SiloReadings, retentionCutoff(now, policy.SiloReadings))
+	}
+	if summary.Total() == 0 {
+		return summary, nil
+	}
+	touchDatastore(&purged, now.UTC())
+	*ds = purged
+	return summary, nil
+}
+
+func retentionCutoff(now time.Time, years int) time.Time {
+	return startOfDay(now).AddDate(-years, 0, 0)
+}
+
+// compactionCutoff returns the start of the season seasons before the one
+// holding now: the seasons before it are compacted.
+func compactionCutoff(now time.Time, seasons int) time.Time {
+	return seasonStart(SeasonStartYear(now) - seasons)
+}
+
+// keepSince returns the entries dated from cutoff on and the number removed.
+func keepSince[T any](entries []T, cutoff time.Time, date func(T) time.Time) ([]T, int) {
+	kept := entries[:0:0]
+	for _, entry := range entries {
+		if !date(entry).Before(cutoff) {
+			kept = append(kept, entry)
+		}
+	}
+	return kept, len(entries) - len(kept)
+}
+
+// purgeSiloReadings removes the readings taken before cutoff but the latest
+// one of each silo, its level being read from it.
+func purgeSiloReadings(readings []SiloReading, cutoff time.Time) ([]SiloReading, int) {
+	latest := make(map[ID]time.Time, len(readings))
+	for _, reading := range readings {
+		if reading.ReadAt.After(latest[reading.SiloID]) {
+			latest[reading.SiloID] = reading.ReadAt
+		}
+	}
+	kept := readings[:0:0]
+	for _, reading := range readings {
+		if !reading.ReadAt.Before(cutoff) || reading.ReadAt.Equal(latest[reading.SiloID]) {
+			kept = append(kept, reading)
+		}
+	}
+	return kept, len(readings) - len(kept)
+}
+
+// purgeConsumptions removes the consumptions recorded before cutoff together
+// with the emptied purchase lots they were taken from, then checks the stock
+// and the value of the consumptions kept are unchanged.
+func purgeConsumptions(ctx context.Context, ds *DataStore, cutoff time.Time) (PurgeSummary, error) {
+	calculations, tracker, err := computeFIFOResults(ctx, ds)
+	if err != nil {
+		return PurgeSummary{}, err
+	}
+
+	// A reclassified lot is split between the states of both brands.
+	purchases := make(map[ID]bool)
+	for _, state := range tracker.states {
+		for _, lot := range state.lots {
+			emptied := lot.purchasedAt.Before(cutoff) && lot.remaining == 0 && lot.remainingWeight <= 0
+			if seen, ok := purchases[lot.id]; ok {
+				emptied = emptied && seen
+			}
+			purchases[lot.id] = emptied
+		}
+	}
+	for _, state := range tracker.states {
+		if state.opened != nil && state.opened.weight > 0 {
+			purchases[state.opened.lot.id] = false
+		}
+	}
+	consumptions := make(map[ID]bool, len(calculations))
+	lots := make(map[ID][]ID, len(calculations))
+	consumers := make(map[ID][]ID)
+	for _, calc := range calculations {
+		id := calc.consumption.ID
+		consumptions[id] = calc.consumption.ConsumedAt.Before(cutoff)
+		for _, allocation := range calc.allocations {
+			lots[id] = append(lots[id], allocation.PurchaseID)
+			consumers[allocation.PurchaseID] = append(consumers[allocation.PurchaseID], id)
+		}
+	}
+	transfers := make(map[ID]bool, len(ds.Transfers))
+	for _, transfer := range ds.Transfers {
+		transfers[transfer.ID] = transfer.TransferredAt.Before(cutoff) && len(transfer.Lots) > 0
+	}
+
+	// An entry only goes with every entry it depends on.
+	for changed := true; changed; {
+		changed = false
+		drop := func(set map[ID]bool, id ID) {
+			if set[id] {
+				set[id] = false
+				changed = true
+			}
+		}
+		for id, purge := range consumptions {
+			for _, lot := range lots[id] {
+				if purge && !purchases[lot] {
+					drop(consumptions, id)
+				}
+			}
+		}
+		for id, purge := range purchases {
+			for _, consumption := range consumers[id] {
+				if purge && !consumptions[consumption] {
+					drop(purchases, id)
+				}
+			}
+		}
+		for _, transfer := range ds.Transfers {
+			for _, lot := range transfer.Lots {
+				if transfers[transfer.ID] && !purchases[lot.PurchaseID] {
+					drop(transfers, transfer.ID)
+				}
+			}
+			if !transfers[transfer.ID] {
+				for _, lot := range transfer.Lots {
+					drop(purchases, lot.PurchaseID)
+				}
+			}
+		}
+	}
+
+	var summary PurgeSummary
+	before := *ds
+	archives := archiveSeasons(ds, calculations, purchases, consumptions)
+	ds.Purchases, summary.Purchases = keepUnless(ds.Purchases, func(purchase Purchase) bool { return purchases[purchase.ID] })
+	ds.Consumptions, summary.Consumptions = keepUnless(ds.Consumptions, func(consumption Consumption) bool { return consumptions[consumption.ID] })
+	ds.Transfers, summary.Transfers = keepUnless(ds.Transfers, func(transfer Transfer) bool { return transfers[transfer.ID] })
+	if summary.Purchases+summary.Consumptions+summary.Transfers == 0 {
+		return summary, nil
+	}
+
+	after, _, err := computeFIFOResults(ctx, ds)
+	if err != nil {
+		return PurgeSummary{}, err
+	}
+	if !sameValuation(before, calculations, *ds, after) {
+		return PurgeSummary{}, ErrPurgeChangesStock
+	}
+	ds.SeasonArchives = archives
+	return summary, nil
+}
+
+// sameValuation reports whether the stock left and the value of every
+// consumption of after match those computed for before.
+func sameValuation(before DataStore, calculations []consumptionCalculation, after DataStore, recalculated []consumptionCalculation) bool {
+	values := make(map[ID]consumptionCalculation, len(calculations))
+	for _, calc := range calculations {
+		values[calc.consumption.ID] = calc
+	}
+	for _, calc := range recalculated {
+		previous := values[calc.consumption.ID]
+		if previous.total != calc.total || previous.weight != calc.weight || previous.bags != calc.bags {
+			return false
+		}
+	}
+	stockBefore, err := ComputeInventaire(context.Background(), &before, CostingFIFO)
+	if err != nil {
+		return false
+	}
+	stockAfter, err := ComputeInventaire(context.Background(), &after, CostingFIFO)
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(stockBefore, stockAfter)
+}
+
+// keepUnless returns the entries purge does not match and the number removed.
+func keepUnless[T any](entries []T, purge func(T) bool) ([]T, int) {
+	kept := entries[:0:0]
+	for _, entry := range entries {
+		if !purge(entry) {
+			kept = append(kept, entry)
+		}
+	}
+	return kept, len(entries) - len(kept)
+}
+
+// archiveSeasons adds the figures of the purchases and consumptions about to
+// be purged to the season archives of ds and returns them.
+func archiveSeasons(ds *DataStore, calculations []consumptionCalculation, purchases, consumptions map[ID]bool) []SeasonArchive {
+	archives := make(map[int]*SeasonArchive, len(ds.SeasonArchives))
+	for _, archive := range ds.SeasonArchives {
+		archive := archive
+		archive.Months = append([]SeasonMonth(nil), archive.Months...)
+		archives[archive.StartYear] = &archive
+	}
+	season := func(t time.Time) *SeasonArchive {
+		year := SeasonStartYear(t)
+		archive, ok := archives[year]
+		if !ok {
+			archive = &SeasonArchive{StartYear: year}
+			archives[year] = archive
+		}
+		return archive
+	}
+
+	for _, purchase := range ds.Purchases {
+		if !purchases[purchase.ID] {
+			continue
+		}
+		archive := season(purchase.PurchasedAt)
+		archive.Purchases++
+		archive.BagsBought += purchase.Bags
+		archive.WeightBoughtKg = (GramsFromKg(archive.WeightBoughtKg) + GramsFromKg(purchase.TotalWeightKg)).Kg()
+		archive.Spent += purchase.TotalPriceCents
+	}
+
+	// A day keeps counting through the consumptions left on it.
+	keptDays := make(map[time.Time]bool)
+	for _, consumption := range ds.Consumptions {
+		if !consumptions[consumption.ID] {
+			keptDays[startOfDay(consumption.ConsumedAt)] = true
+		}
+	}
+	purgedDays := make(map[time.Time]bool)
+	for _, calc := range calculations {
+		consumption := calc.consumption
+		if !consumptions[consumption.ID] {
+			continue
+		}
+		archive := season(consumption.ConsumedAt)
+		archive.Consumptions++
+		archive.BagsConsumed += calc.bags
+		archive.WeightConsumedKg = (GramsFromKg(archive.WeightConsumedKg) + calc.weight).Kg()
+		archive.ConsumedValue += calc.total
+		if archive.FirstConsumptionAt.IsZero() || consumption.ConsumedAt.Before(archive.FirstConsumptionAt) {
+			archive.FirstConsumptionAt = consumption.ConsumedAt
+		}
+		if consumption.ConsumedAt.After(archive.LastConsumptionAt) {
+			archive.LastConsumptionAt = consumption.ConsumedAt
+		}
+		if day := startOfDay(consumption.ConsumedAt); !keptDays[day] && !purgedDays[day] {
+			purgedDays[day] = true
+			archive.HeatingDays++
+		}
+		archive.addMonth(consumption.ConsumedAt, calc.bags, calc.total)
+	}
+
+	results := make([]SeasonArchive, 0, len(archives))
+	for _, archive := range archives {
+		results = append(results, *archive)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].StartYear < results[j].StartYear })
+	return results
+}
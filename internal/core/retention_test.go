@@ -0,0 +1,165 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestPurgeDataStore(t *testing.T) {
+	t.Parallel()
+
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	now := day(2026, time.June, 1)
+	brands := []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}}
+	purchases := []core.Purchase{
+		{Meta: core.Meta{ID: "p-old"}, BrandID: "brand-w", PurchasedAt: day(2015, time.October, 1), Bags: 4, BagWeightKg: 15, TotalWeightKg: 60, UnitPriceCents: 500, TotalPriceCents: 2000},
+		{Meta: core.Meta{ID: "p-new"}, BrandID: "brand-w", PurchasedAt: day(2025, time.September, 1), Bags: 5, BagWeightKg: 15, TotalWeightKg: 75, UnitPriceCents: 700, TotalPriceCents: 3500},
+	}
+
+	type params struct {
+		ds     core.DataStore
+		policy core.RetentionPolicy
+	}
+	type want struct {
+		summary      core.PurgeSummary
+		consumptions []core.ID
+		siloReadings []time.Time
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "removes an emptied lot with its consumptions",
+			params: params{
+				ds: core.DataStore{
+					Brands:    brands,
+					Purchases: purchases,
+					Consumptions: []core.Consumption{
+						{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: day(2015, time.November, 10), Bags: 2},
+						{Meta: core.Meta{ID: "c2"}, BrandID: "brand-w", ConsumedAt: day(2015, time.November, 10).Add(12 * time.Hour), Bags: 2},
+						{Meta: core.Meta{ID: "c3"}, BrandID: "brand-w", ConsumedAt: day(2025, time.November, 2), Bags: 1},
+					},
+				},
+				policy: core.RetentionPolicy{Consumptions: 2},
+			},
+			want: want{summary: core.PurgeSummary{Purchases: 1, Consumptions: 2}, consumptions: []core.ID{"c3"}},
+		},
+		{
+			name: "keeps a lot still in stock",
+			params: params{
+				ds: core.DataStore{
+					Brands:    brands,
+					Purchases: purchases,
+					Consumptions: []core.Consumption{
+						{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: day(2015, time.November, 10), Bags: 2},
+						{Meta: core.Meta{ID: "c3"}, BrandID: "brand-w", ConsumedAt: day(2025, time.November, 2), Bags: 1},
+					},
+				},
+				policy: core.RetentionPolicy{Consumptions: 2},
+			},
+			want: want{consumptions: []core.ID{"c1", "c3"}},
+		},
+		{
+			name: "purges the other entries",
+			params: params{
+				ds: core.DataStore{
+					Audit: []core.AuditEntry{
+						{ID: "a1", At: day(2023, time.January, 2), Action: "create"},
+						{ID: "a2", At: day(2025, time.January, 2), Action: "create"},
+					},
+					Temperatures: []core.DailyTemperature{{Date: day(2015, time.December, 1), MeanC: 2}, {Date: day(2025, time.December, 1), MeanC: 3}},
+					Occupancy:    []core.DailyOccupancy{{Date: day(2015, time.December, 1), Status: core.OccupancyVacation}},
+					SiloReadings: []core.SiloReading{
+						{SiloID: "silo", ReadAt: day(2019, time.March, 1), LevelKg: 2000},
+						{SiloID: "silo", ReadAt: day(2020, time.March, 1), LevelKg: 1500},
+						{SiloID: "silo-2", ReadAt: day(2019, time.March, 1), LevelKg: 800},
+					},
+				},
+				policy: core.RetentionPolicy{Audit: 2, Temperatures: 5, Occupancy: 5, SiloReadings: 5},
+			},
+			want: want{
+				summary:      core.PurgeSummary{Audit: 1, Temperatures: 1, Occupancy: 1, SiloReadings: 1},
+				siloReadings: []time.Time{day(2020, time.March, 1), day(2019, time.March, 1)},
+			},
+		},
+		{
+			name: "compacts the seasons before the last ones",
+			params: params{
+				ds: core.DataStore{
+					Brands: brands,
+					Purchases: append(append([]core.Purchase(nil), purchases...),
+						core.Purchase{Meta: core.Meta{ID: "p-mid"}, BrandID: "brand-w", PurchasedAt: day(2024, time.October, 1), Bags: 4, BagWeightKg: 15, TotalWeightKg: 60, UnitPriceCents: 600, TotalPriceCents: 2400}),
+					Consumptions: []core.Consumption{
+						{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: day(2015, time.November, 10), Bags: 4},
+						{Meta: core.Meta{ID: "c2"}, BrandID: "brand-w", ConsumedAt: day(2024, time.November, 5), Bags: 4},
+						{Meta: core.Meta{ID: "c3"}, BrandID: "brand-w", ConsumedAt: day(2025, time.November, 2), Bags: 1},
+					},
+				},
+				policy: core.RetentionPolicy{Consumptions: 10, CompactSeasons: 1},
+			},
+			want: want{summary: core.PurgeSummary{Purchases: 2, Consumptions: 2}, consumptions: []core.ID{"c3"}},
+		},
+		{
+			name: "keeps everything without a policy",
+			params: params{
+				ds: core.DataStore{
+					Brands:    brands,
+					Purchases: purchases,
+					Consumptions: []core.Consumption{
+						{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: day(2015, time.November, 10), Bags: 4},
+					},
+				},
+			},
+			want: want{consumptions: []core.ID{"c1"}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := tc.params.ds
+			before, err := core.ComputeSaisons(context.Background(), &ds)
+			require.NoError(t, err, tc.name)
+			consumedBefore, _, err := core.ComputeConsoValue(context.Background(), &ds, core.CostingFIFO, time.Time{}, time.Time{})
+			require.NoError(t, err, tc.name)
+			investedBefore := core.ComputeInvesti(&ds, time.Time{}, time.Time{})
+
+			summary, err := core.PurgeDataStore(context.Background(), &ds, tc.params.policy, now)
+
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.summary, summary, tc.name)
+			var consumptions []core.ID
+			for _, consumption := range ds.Consumptions {
+				consumptions = append(consumptions, consumption.ID)
+			}
+			assert.Equal(t, tc.want.consumptions, consumptions, tc.name)
+			if tc.want.siloReadings != nil {
+				var readings []time.Time
+				for _, reading := range ds.SiloReadings {
+					readings = append(readings, reading.ReadAt)
+				}
+				assert.Equal(t, tc.want.siloReadings, readings, tc.name)
+			}
+			after, err := core.ComputeSaisons(context.Background(), &ds)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, before, after, tc.name)
+			consumedAfter, _, err := core.ComputeConsoValue(context.Background(), &ds, core.CostingFIFO, time.Time{}, time.Time{})
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, consumedBefore, consumedAfter, tc.name)
+			assert.Equal(t, investedBefore, core.ComputeInvesti(&ds, time.Time{}, time.Time{}), tc.name)
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package core
+
+import (
+	_ "embed"
+	"fmt"
+	"sync"
+
+	"pellets-tracker/internal/jsonschema"
+)
+
+// DataStoreSchema is the JSON Schema of the datastore file, served by
+// /api/schema.
+//
+//go:embed datastore.schema.json
+var DataStoreSchema []byte
+
+var compileDataStoreSchema = sync.OnceValues(func() (*jsonschema.Schema, error) {
+	return jsonschema.Compile(DataStoreSchema)
+})
+
+// ValidateDataStoreJSON checks a datastore file against DataStoreSchema
+// before it is decoded, so a hand-edited file fails on the exact entry at
+// fault rather than on the first field Go cannot decode. Violations are
+// returned as ValidationErrors whose Field is the JSON pointer of the value,
+// such as /purchases/3/bags; a file that is not JSON at all returns a plain
+// error with the line and column of the mistake.
+func ValidateDataStoreJSON(data []byte) error {
+	schema, err := compileDataStoreSchema()
+	if err != nil {
+		return fmt.Errorf("datastore schema: %w", err)
+	}
+	violations, err := schema.Validate(data)
+	if err != nil {
+		return err
+	}
+	var errs ValidationErrors
+	for _, violation := range violations {
+		errs = append(errs, ValidationError{Field: violation.Path, Message: violation.Message})
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
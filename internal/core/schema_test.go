@@ -0,0 +1,133 @@
+package core_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestValidateDataStoreJSON(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2024, time.October, 1, 8, 0, 0, 0, time.UTC)
+	meta := func(id core.ID) core.Meta { return core.Meta{ID: id, CreatedAt: at, UpdatedAt: at, Revision: 2} }
+	// Every field set, so a field added to the models without the schema
+	// fails here rather than on the first import.
+	full, err := json.Marshal(core.DataStore{
+		Meta:          meta(""),
+		SchemaVersion: core.CurrentSchemaVersion,
+		Brands: []core.Brand{{
+			Meta: meta("brand-w"), Name: "Woodstock", Description: "Sacs de 15 kg", ImageBase64: "iVBORw0KGgo=",
+			LeadTimeDays: 10, EnergyKWhPerKg: 4.9, MinStockBags: 5,
+		}},
+		Purchases: []core.Purchase{
+			{Meta: meta("p1"), BrandID: "brand-w", PurchasedAt: at, Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 550, TotalPriceCents: 5500, Location: "Garage", Notes: "Promo"},
+			{Meta: meta("p2"), BrandID: "brand-w", PurchasedAt: at, TotalWeightKg: 3000, PricePerTonneCents: 39000, TotalPriceCents: 117000, Location: "Silo"},
+		},
+		Consumptions: []core.Consumption{{Meta: meta("c1"), BrandID: "brand-w", ConsumedAt: at, Bags: 1, WeightKg: 15, PowerLevel: 3, Notes: "Froid"}},
+		Transfers: []core.Transfer{{
+			Meta: meta("t1"), BrandID: "brand-w", ToBrandID: "brand-w", FromLocation: "Garage", ToLocation: "Cave", Bags: 2, TransferredAt: at,
+			Lots: []core.TransferLot{{PurchaseID: "p1", Bags: 2, UnitPrice: 550}}, Notes: "Rangement",
+		}},
+		Audit:            []core.AuditEntry{{ID: "a1", At: at, Action: "transfer", Entity: "transfer", EntityID: "t1", Summary: "2 sacs"}},
+		Temperatures:     []core.DailyTemperature{{Date: at, MeanC: -2.5}},
+		Occupancy:        []core.DailyOccupancy{{Date: at, Status: core.OccupancyVacation}},
+		Users:            []core.User{{Meta: meta("u1"), Username: "alice", PasswordHash: "$2a$10$hash"}},
+		APITokens:        []core.APIToken{{Meta: meta("k1"), UserID: "u1", Name: "capteur", Hash: "abc"}},
+		MinStockBags:     20,
+		Silos:            []core.Silo{{Meta: meta("silo"), Name: "Silo", CapacityKg: 4000}},
+		SiloReadings:     []core.SiloReading{{SiloID: "silo", ReadAt: at, LevelKg: 2500, Source: core.SiloSourceSensor}},
+		StorageLocations: []core.StorageLocation{{Meta: meta("loc"), Name: "Abri", Notes: "Au fond du jardin"}},
+		SeasonArchives: []core.SeasonArchive{{
+			StartYear: 2013, Purchases: 2, BagsBought: 60, WeightBoughtKg: 900, Spent: 33000, Consumptions: 50, BagsConsumed: 55.5,
+			ConsumedValue: 30525, HeatingDays: 48, FirstConsumptionAt: at, LastConsumptionAt: at,
+			Months: []core.SeasonMonth{{Month: at, Bags: 55.5, ConsumedValue: 30525}},
+		}},
+	})
+	require.NoError(t, err)
+
+	type params struct {
+		data string
+	}
+	type want struct {
+		fields []string
+		err    bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "accepts a complete export",
+			params: params{data: string(full)},
+		},
+		{
+			name:   "accepts an empty datastore",
+			params: params{data: `{"brands":null,"purchases":null,"consumptions":null}`},
+		},
+		{
+			name:   "accepts the legacy purchase weight",
+			params: params{data: `{"purchases":[{"id":"p1","brand_id":"b","purchased_at":"2023-10-01T00:00:00Z","bags":10,"weight_kg":150}]}`},
+		},
+		{
+			name: "points at the values of the wrong type",
+			params: params{data: `{"purchases":[
+				{"id":"p1","brand_id":"b","purchased_at":"2024-10-01T00:00:00Z","bags":10},
+				{"id":"p2","brand_id":"b","purchased_at":"2024-10-01T00:00:00Z","bags":"10","unit_price_cents":5.5}
+			]}`},
+			want: want{fields: []string{"/purchases/1/bags", "/purchases/1/unit_price_cents"}},
+		},
+		{
+			name:   "reports unknown properties",
+			params: params{data: `{"consumptions":[{"id":"c1","brand_id":"b","consumed_at":"2024-10-01T00:00:00Z","bag":1}],"brand":[]}`},
+			want:   want{fields: []string{"/brand", "/consumptions/0/bag"}},
+		},
+		{
+			name:   "reports missing properties and invalid dates",
+			params: params{data: `{"consumptions":[{"id":"c1","consumed_at":"01/10/2024","bags":-1}]}`},
+			want:   want{fields: []string{"/consumptions/0", "/consumptions/0/bags", "/consumptions/0/consumed_at"}},
+		},
+		{
+			name:   "rejects another document",
+			params: params{data: `[]`},
+			want:   want{fields: []string{""}},
+		},
+		{
+			name:   "rejects a file that is not JSON",
+			params: params{data: "{\n  \"brands\": [,]\n}"},
+			want:   want{err: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := core.ValidateDataStoreJSON([]byte(tc.params.data))
+			if tc.want.fields == nil && !tc.want.err {
+				assert.NoError(t, err, tc.name)
+				return
+			}
+			require.Error(t, err, tc.name)
+			var ve core.ValidationErrors
+			if tc.want.err {
+				assert.NotErrorAs(t, err, &ve, tc.name)
+				return
+			}
+			require.ErrorAs(t, err, &ve, tc.name)
+			fields := make([]string, len(ve))
+			for i, violation := range ve {
+				fields[i] = violation.Field
+			}
+			assert.Equal(t, tc.want.fields, fields, tc.name)
+		})
+	}
+}
@@ -0,0 +1,416 @@
+package core
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SeasonSummary holds the key figures of one heating season. A season runs
+// from May 1st to April 30th, like HeatingSeasonEnd, and is identified by the
+// year it starts in.
+type SeasonSummary struct {
+	StartYear int       `json:"start_year"`
+	Label     string    `json:"label"`
+	Start     time.Time `json:"start"`
+	// End is the last day of the season.
+	End            time.Time `json:"end"`
+	Purchases      int       `json:"purchases"`
+	BagsBought     int       `json:"bags_bought"`
+	WeightBoughtKg float64   `json:"weight_bought_kg"`
+	Spent          Money     `json:"spent_cents"`
+	Consumptions   int       `json:"consumptions"`
+	BagsConsumed   float64   `json:"bags_consumed"`
+	// ConsumedValue is the FIFO value of the bags burnt during the season.
+	ConsumedValue  Money `json:"consumed_value_cents"`
+	AverageBagCost Money `json:"average_bag_cost_cents"`
+	// HeatingDays counts the distinct days with a consumption.
+	HeatingDays        int       `json:"heating_days"`
+	FirstConsumptionAt time.Time `json:"first_consumption_at"`
+	LastConsumptionAt  time.Time `json:"last_consumption_at"`
+	// EnergyKWh is the heat released by the bags burnt, and CostPerMWh its
+	// FIFO cost in cents per MWh, zero without energy. Both leave out the
+	// archived consumptions whose weight was not recorded.
+	EnergyKWh  float64 `json:"energy_kwh"`
+	CostPerMWh Money   `json:"cost_per_mwh_cents"`
+}
+
+// SeasonBrand is the share of a brand in a season.
+type SeasonBrand struct {
+	BrandID       ID      `json:"brand_id"`
+	BrandName     string  `json:"brand_name"`
+	BagsBought    int     `json:"bags_bought"`
+	Spent         Money   `json:"spent_cents"`
+	BagsConsumed  float64 `json:"bags_consumed"`
+	ConsumedValue Money   `json:"consumed_value_cents"`
+}
+
+// SeasonMonth is a month of a season with the bags burnt and their FIFO
+// value.
+type SeasonMonth struct {
+	Month         time.Time `json:"month"`
+	Bags          float64   `json:"bags"`
+	ConsumedValue Money     `json:"consumed_value_cents"`
+}
+
+// SeasonDetail is the logbook page of a season.
+type SeasonDetail struct {
+	SeasonSummary
+	// Months lists the twelve months of the season, May first.
+	Months    []SeasonMonth `json:"months"`
+	Brands    []SeasonBrand `json:"brands"`
+	Purchases []Purchase    `json:"purchases"`
+}
+
+// SeasonArchive holds the figures of the purchases and consumptions of a
+// season removed by the retention policy, see PurgeDataStore. They are still
+// counted in the summary of the season.
+type SeasonArchive struct {
+	StartYear      int     `json:"start_year"`
+	Purchases      int     `json:"purchases"`
+	BagsBought     int     `json:"bags_bought"`
+	WeightBoughtKg float64 `json:"weight_bought_kg"`
+	Spent          Money   `json:"spent_cents"`
+	Consumptions   int     `json:"consumptions"`
+	BagsConsumed   float64 `json:"bags_consumed"`
+	// WeightConsumedKg is the weight burnt, zero for the archives made
+	// before it was recorded.
+	WeightConsumedKg   float64   `json:"weight_consumed_kg,omitempty"`
+	ConsumedValue      Money     `json:"consumed_value_cents"`
+	HeatingDays        int       `json:"heating_days"`
+	FirstConsumptionAt time.Time `json:"first_consumption_at"`
+	LastConsumptionAt  time.Time `json:"last_consumption_at"`
+	// Months lists the months holding a removed consumption, oldest first.
+	Months []SeasonMonth `json:"months,omitempty"`
+}
+
+func (a *SeasonArchive) addMonth(at time.Time, bags float64, value Money) {
+	at = at.UTC()
+	month := time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for i := range a.Months {
+		if a.Months[i].Month.Equal(month) {
+			a.Months[i].Bags += bags
+			a.Months[i].ConsumedValue += value
+			return
+		}
+	}
+	a.Months = append(a.Months, SeasonMonth{Month: month, Bags: bags, ConsumedValue: value})
+	sort.Slice(a.Months, func(i, j int) bool { return a.Months[i].Month.Before(a.Months[j].Month) })
+}
+
+// SeasonComparison holds the figures of an earlier season and how the
+// reported season compares with them, in percent. A change is nil when the
+// earlier season has nothing to compare with.
+type SeasonComparison struct {
+	StartYear                  int      `json:"start_year"`
+	Label                      string   `json:"label"`
+	BagsConsumed               float64  `json:"bags_consumed"`
+	ConsumedValue              Money    `json:"consumed_value_cents"`
+	AverageBagCost             Money    `json:"average_bag_cost_cents"`
+	Spent                      Money    `json:"spent_cents"`
+	BagsChangePercent          *float64 `json:"bags_change_percent,omitempty"`
+	ConsumedValueChangePercent *float64 `json:"consumed_value_change_percent,omitempty"`
+	SpentChangePercent         *float64 `json:"spent_change_percent,omitempty"`
+	CostPerMWh                 Money    `json:"cost_per_mwh_cents"`
+	// AverageBagCostChangePercent and CostPerMWhChangePercent follow the
+	// price of the pellets burnt, per bag and per kWh.
+	AverageBagCostChangePercent *float64 `json:"average_bag_cost_change_percent,omitempty"`
+	CostPerMWhChangePercent     *float64 `json:"cost_per_mwh_change_percent,omitempty"`
+}
+
+// SeasonReport is the yearly report of a season.
+type SeasonReport struct {
+	SeasonDetail
+	// Previous lists the seasons before it, most recent first.
+	Previous []SeasonComparison `json:"previous"`
+}
+
+// SeasonStartYear returns the start year of the heating season containing t.
+func SeasonStartYear(t time.Time) int {
+	t = t.UTC()
+	if t.Month() < time.May {
+		return t.Year() - 1
+	}
+	return t.Year()
+}
+
+// seasonStart returns the first day of the season starting in startYear.
+func seasonStart(startYear int) time.Time {
+	return time.Date(startYear, time.May, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// archivedWithin returns the season archives of ds whose whole season lies
+// within the optional range; the figures of a season partly covered cannot
+// be split.
+func archivedWithin(ds *DataStore, from, to time.Time) []SeasonArchive {
+	var archives []SeasonArchive
+	for _, archive := range ds.SeasonArchives {
+		last := seasonStart(archive.StartYear + 1).Add(-time.Nanosecond)
+		if withinRange(seasonStart(archive.StartYear), from, to) && withinRange(last, from, to) {
+			archives = append(archives, archive)
+		}
+	}
+	return archives
+}
+
+// SeasonLabel names the season starting in startYear, such as "2023-2024".
+func SeasonLabel(startYear int) string {
+	return strconv.Itoa(startYear) + "-" + strconv.Itoa(startYear+1)
+}
+
+// ParseSeasonLabel returns the start year of a label built by SeasonLabel.
+func ParseSeasonLabel(label string) (int, bool) {
+	first, second, ok := strings.Cut(label, "-")
+	if !ok {
+		return 0, false
+	}
+	start, err := strconv.Atoi(first)
+	if err != nil || len(first) != 4 {
+		return 0, false
+	}
+	end, err := strconv.Atoi(second)
+	if err != nil || end != start+1 {
+		return 0, false
+	}
+	return start, true
+}
+
+// ComputeSaisons returns the summary of every season holding a purchase or a
+// consumption, most recent first.
+func ComputeSaisons(ctx context.Context, ds *DataStore) ([]SeasonSummary, error) {
+	if ds == nil {
+		return []SeasonSummary{}, nil
+	}
+	calculations, _, err := computeFIFOResults(ctx, ds)
+	if err != nil {
+		return nil, err
+	}
+	seasons := summarizeSeasons(ds, calculations)
+	results := make([]SeasonSummary, 0, len(seasons))
+	for _, season := range seasons {
+		results = append(results, *season)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].StartYear > results[j].StartYear })
+	return results, nil
+}
+
+// ComputeSaison details the season starting in startYear. It returns
+// ErrSeasonNotFound when the season holds neither purchase nor consumption.
+func ComputeSaison(ctx context.Context, ds *DataStore, startYear int) (SeasonDetail, error) {
+	if ds == nil {
+		return SeasonDetail{}, ErrSeasonNotFound
+	}
+	calculations, _, err := computeFIFOResults(ctx, ds)
+	if err != nil {
+		return SeasonDetail{}, err
+	}
+	return detailSeason(ds, calculations, summarizeSeasons(ds, calculations), startYear)
+}
+
+// ComputeRapportSaison reports on the season starting in startYear and
+// compares it with every earlier season. It returns ErrSeasonNotFound when
+// the season holds neither purchase nor consumption.
+func ComputeRapportSaison(ctx context.Context, ds *DataStore, startYear int) (SeasonReport, error) {
+	if ds == nil {
+		return SeasonReport{}, ErrSeasonNotFound
+	}
+	calculations, _, err := computeFIFOResults(ctx, ds)
+	if err != nil {
+		return SeasonReport{}, err
+	}
+	seasons := summarizeSeasons(ds, calculations)
+	detail, err := detailSeason(ds, calculations, seasons, startYear)
+	if err != nil {
+		return SeasonReport{}, err
+	}
+
+	report := SeasonReport{SeasonDetail: detail, Previous: []SeasonComparison{}}
+	for _, season := range seasons {
+		if season.StartYear >= startYear {
+			continue
+		}
+		report.Previous = append(report.Previous, SeasonComparison{
+			StartYear:                   season.StartYear,
+			Label:                       season.Label,
+			BagsConsumed:                season.BagsConsumed,
+			ConsumedValue:               season.ConsumedValue,
+			AverageBagCost:              season.AverageBagCost,
+			Spent:                       season.Spent,
+			BagsChangePercent:           bagsPercentChange(season.BagsConsumed, detail.BagsConsumed),
+			ConsumedValueChangePercent:  percentChange(season.ConsumedValue, detail.ConsumedValue),
+			SpentChangePercent:          percentChange(season.Spent, detail.Spent),
+			CostPerMWh:                  season.CostPerMWh,
+			AverageBagCostChangePercent: percentChange(season.AverageBagCost, detail.AverageBagCost),
+			CostPerMWhChangePercent:     percentChange(season.CostPerMWh, detail.CostPerMWh),
+		})
+	}
+	sort.Slice(report.Previous, func(i, j int) bool { return report.Previous[i].StartYear > report.Previous[j].StartYear })
+	return report, nil
+}
+
+// detailSeason details the season starting in startYear out of the seasons
+// summarized from calculations.
+func detailSeason(ds *DataStore, calculations []consumptionCalculation, seasons map[int]*SeasonSummary, startYear int) (SeasonDetail, error) {
+	summary, ok := seasons[startYear]
+	if !ok {
+		return SeasonDetail{}, ErrSeasonNotFound
+	}
+
+	detail := SeasonDetail{SeasonSummary: *summary, Purchases: []Purchase{}}
+	months := make(map[time.Month]float64, 12)
+	values := make(map[time.Month]Money, 12)
+	brands := make(map[ID]*SeasonBrand)
+	brandLine := func(id ID) *SeasonBrand {
+		line, ok := brands[id]
+		if !ok {
+			line = &SeasonBrand{BrandID: id}
+			brands[id] = line
+		}
+		return line
+	}
+	for _, purchase := range ds.Purchases {
+		if SeasonStartYear(purchase.PurchasedAt) != startYear {
+			continue
+		}
+		detail.Purchases = append(detail.Purchases, purchase)
+		line := brandLine(purchase.BrandID)
+		line.BagsBought += purchase.Bags
+		line.Spent += purchase.TotalPriceCents
+	}
+	for _, calc := range calculations {
+		consumption := calc.consumption
+		if SeasonStartYear(consumption.ConsumedAt) != startYear {
+			continue
+		}
+		months[consumption.ConsumedAt.UTC().Month()] += calc.bags
+		values[consumption.ConsumedAt.UTC().Month()] += calc.total
+		line := brandLine(consumption.BrandID)
+		line.BagsConsumed += calc.bags
+		line.ConsumedValue += calc.total
+	}
+	for _, archive := range ds.SeasonArchives {
+		if archive.StartYear != startYear {
+			continue
+		}
+		for _, month := range archive.Months {
+			months[month.Month.Month()] += month.Bags
+			values[month.Month.Month()] += month.ConsumedValue
+		}
+	}
+
+	for i := 0; i < 12; i++ {
+		month := summary.Start.AddDate(0, i, 0)
+		detail.Months = append(detail.Months, SeasonMonth{Month: month, Bags: months[month.Month()], ConsumedValue: values[month.Month()]})
+	}
+	names := brandNameIndex(ds.Brands)
+	for _, line := range brands {
+		line.BrandName = names[line.BrandID]
+		detail.Brands = append(detail.Brands, *line)
+	}
+	sort.Slice(detail.Brands, func(i, j int) bool {
+		return strings.ToLower(detail.Brands[i].BrandName) < strings.ToLower(detail.Brands[j].BrandName)
+	})
+	sort.SliceStable(detail.Purchases, func(i, j int) bool {
+		return detail.Purchases[i].PurchasedAt.Before(detail.Purchases[j].PurchasedAt)
+	})
+	return detail, nil
+}
+
+// bagsPercentChange is percentChange for counts of bags.
+func bagsPercentChange(before, after float64) *float64 {
+	if before <= 0 {
+		return nil
+	}
+	change := roundHalfEven((after-before)/before*1000) / 10
+	return &change
+}
+
+// summarizeSeasons aggregates the purchases and the valued consumptions per
+// season start year.
+func summarizeSeasons(ds *DataStore, calculations []consumptionCalculation) map[int]*SeasonSummary {
+	seasons := make(map[int]*SeasonSummary)
+	season := func(t time.Time) *SeasonSummary {
+		year := SeasonStartYear(t)
+		summary, ok := seasons[year]
+		if !ok {
+			summary = &SeasonSummary{
+				StartYear: year,
+				Label:     SeasonLabel(year),
+				Start:     seasonStart(year),
+				End:       time.Date(year+1, time.April, 30, 0, 0, 0, 0, time.UTC),
+			}
+			seasons[year] = summary
+		}
+		return summary
+	}
+
+	weights := make(map[int]Grams)
+	for _, purchase := range ds.Purchases {
+		summary := season(purchase.PurchasedAt)
+		summary.Purchases++
+		summary.BagsBought += purchase.Bags
+		summary.Spent += purchase.TotalPriceCents
+		weights[summary.StartYear] += GramsFromKg(purchase.TotalWeightKg)
+	}
+
+	// energies and energyCosts hold the heat of the consumptions whose
+	// weight is known, and their value.
+	factors := brandEnergyFactors(ds.Brands)
+	energies := make(map[int]int64)
+	energyCosts := make(map[int]Money)
+	days := make(map[int]map[time.Time]struct{})
+	for _, calc := range calculations {
+		consumedAt := calc.consumption.ConsumedAt
+		summary := season(consumedAt)
+		summary.Consumptions++
+		summary.BagsConsumed += calc.bags
+		summary.ConsumedValue += calc.total
+		energies[summary.StartYear] += energyWh(calc.weight, factors.of(calc.consumption.BrandID))
+		energyCosts[summary.StartYear] += calc.total
+		if summary.FirstConsumptionAt.IsZero() || consumedAt.Before(summary.FirstConsumptionAt) {
+			summary.FirstConsumptionAt = consumedAt
+		}
+		if consumedAt.After(summary.LastConsumptionAt) {
+			summary.LastConsumptionAt = consumedAt
+		}
+		if days[summary.StartYear] == nil {
+			days[summary.StartYear] = make(map[time.Time]struct{})
+		}
+		days[summary.StartYear][startOfDay(consumedAt)] = struct{}{}
+	}
+
+	archivedDays := make(map[int]int, len(ds.SeasonArchives))
+	for _, archive := range ds.SeasonArchives {
+		summary := season(seasonStart(archive.StartYear))
+		summary.Purchases += archive.Purchases
+		summary.BagsBought += archive.BagsBought
+		summary.Spent += archive.Spent
+		weights[archive.StartYear] += GramsFromKg(archive.WeightBoughtKg)
+		summary.Consumptions += archive.Consumptions
+		summary.BagsConsumed += archive.BagsConsumed
+		summary.ConsumedValue += archive.ConsumedValue
+		archivedDays[archive.StartYear] += archive.HeatingDays
+		// The brands of the archived consumptions are not kept.
+		if archive.WeightConsumedKg > 0 {
+			energies[archive.StartYear] += energyWh(GramsFromKg(archive.WeightConsumedKg), DefaultEnergyKWhPerKg)
+			energyCosts[archive.StartYear] += archive.ConsumedValue
+		}
+		if !archive.FirstConsumptionAt.IsZero() && (summary.FirstConsumptionAt.IsZero() || archive.FirstConsumptionAt.Before(summary.FirstConsumptionAt)) {
+			summary.FirstConsumptionAt = archive.FirstConsumptionAt
+		}
+		if archive.LastConsumptionAt.After(summary.LastConsumptionAt) {
+			summary.LastConsumptionAt = archive.LastConsumptionAt
+		}
+	}
+
+	for year, summary := range seasons {
+		summary.WeightBoughtKg = weights[year].Kg()
+		summary.HeatingDays = len(days[year]) + archivedDays[year]
+		summary.AverageBagCost = summary.ConsumedValue.DivBags(summary.BagsConsumed)
+		summary.EnergyKWh = float64(energies[year]) / 1000
+		summary.CostPerMWh = costPerMWh(energyCosts[year], energies[year])
+	}
+	return seasons
+}
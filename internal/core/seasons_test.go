@@ -0,0 +1,310 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func seasonsDataStore() core.DataStore {
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	return core.DataStore{
+		Brands: []core.Brand{
+			{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"},
+			{Meta: core.Meta{ID: "brand-b"}, Name: "Bois énergie"},
+		},
+		Purchases: []core.Purchase{
+			{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: day(2023, time.September, 1), Bags: 20, BagWeightKg: 15, TotalWeightKg: 300, UnitPriceCents: 600, TotalPriceCents: 12000},
+			{Meta: core.Meta{ID: "p2"}, BrandID: "brand-b", PurchasedAt: day(2024, time.March, 1), Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 500, TotalPriceCents: 5000},
+			{Meta: core.Meta{ID: "p3"}, BrandID: "brand-w", PurchasedAt: day(2024, time.May, 2), Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 650, TotalPriceCents: 6500},
+		},
+		Consumptions: []core.Consumption{
+			{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: day(2023, time.November, 10), Bags: 2},
+			{Meta: core.Meta{ID: "c2"}, BrandID: "brand-w", ConsumedAt: day(2023, time.November, 10).Add(12 * time.Hour), Bags: 1},
+			{Meta: core.Meta{ID: "c3"}, BrandID: "brand-b", ConsumedAt: day(2024, time.April, 30), Bags: 4},
+			{Meta: core.Meta{ID: "c4"}, BrandID: "brand-w", ConsumedAt: day(2024, time.October, 5), Bags: 1},
+		},
+	}
+}
+
+func TestSeasonStartYear(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		at time.Time
+	}
+	type want struct {
+		year int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "starts on May 1st", params: params{at: time.Date(2023, time.May, 1, 0, 0, 0, 0, time.UTC)}, want: want{year: 2023}},
+		{name: "ends on April 30th", params: params{at: time.Date(2024, time.April, 30, 23, 0, 0, 0, time.UTC)}, want: want{year: 2023}},
+		{name: "uses UTC", params: params{at: time.Date(2024, time.May, 1, 1, 0, 0, 0, time.FixedZone("CEST", 2*3600))}, want: want{year: 2023}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.want.year, core.SeasonStartYear(tc.params.at), tc.name)
+		})
+	}
+}
+
+func TestParseSeasonLabel(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		label string
+	}
+	type want struct {
+		year int
+		ok   bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "parses a label", params: params{label: core.SeasonLabel(2023)}, want: want{year: 2023, ok: true}},
+		{name: "rejects non consecutive years", params: params{label: "2023-2025"}, want: want{}},
+		{name: "rejects a single year", params: params{label: "2023"}, want: want{}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			year, ok := core.ParseSeasonLabel(tc.params.label)
+
+			assert.Equal(t, tc.want.ok, ok, tc.name)
+			assert.Equal(t, tc.want.year, year, tc.name)
+		})
+	}
+}
+
+func TestComputeSaisons(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		ds core.DataStore
+	}
+	type want struct {
+		seasons []core.SeasonSummary
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "summarizes each season, most recent first",
+			params: params{ds: seasonsDataStore()},
+			want: want{seasons: []core.SeasonSummary{
+				{
+					StartYear: 2024, Label: "2024-2025",
+					Start: time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2025, time.April, 30, 0, 0, 0, 0, time.UTC),
+					Purchases: 1, BagsBought: 10, WeightBoughtKg: 150, Spent: 6500,
+					Consumptions: 1, BagsConsumed: 1, ConsumedValue: 600, AverageBagCost: 600, HeatingDays: 1,
+					EnergyKWh: 72, CostPerMWh: 8333,
+					FirstConsumptionAt: time.Date(2024, time.October, 5, 0, 0, 0, 0, time.UTC), LastConsumptionAt: time.Date(2024, time.October, 5, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					StartYear: 2023, Label: "2023-2024",
+					Start: time.Date(2023, time.May, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2024, time.April, 30, 0, 0, 0, 0, time.UTC),
+					Purchases: 2, BagsBought: 30, WeightBoughtKg: 450, Spent: 17000,
+					Consumptions: 3, BagsConsumed: 7, ConsumedValue: 3800, AverageBagCost: 543, HeatingDays: 2,
+					EnergyKWh: 504, CostPerMWh: 7540,
+					FirstConsumptionAt: time.Date(2023, time.November, 10, 0, 0, 0, 0, time.UTC), LastConsumptionAt: time.Date(2024, time.April, 30, 0, 0, 0, 0, time.UTC),
+				},
+			}},
+		},
+		{
+			name: "counts the energy of the archives with a weight",
+			params: params{ds: core.DataStore{SeasonArchives: []core.SeasonArchive{
+				{StartYear: 2021, Consumptions: 10, BagsConsumed: 20, WeightConsumedKg: 300, ConsumedValue: 12000, HeatingDays: 8},
+				{StartYear: 2020, Consumptions: 8, BagsConsumed: 15, ConsumedValue: 9000, HeatingDays: 6},
+			}}},
+			want: want{seasons: []core.SeasonSummary{
+				{
+					StartYear: 2021, Label: "2021-2022",
+					Start: time.Date(2021, time.May, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2022, time.April, 30, 0, 0, 0, 0, time.UTC),
+					Consumptions: 10, BagsConsumed: 20, ConsumedValue: 12000, AverageBagCost: 600, HeatingDays: 8,
+					EnergyKWh: 1440, CostPerMWh: 8333,
+				},
+				{
+					StartYear: 2020, Label: "2020-2021",
+					Start: time.Date(2020, time.May, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2021, time.April, 30, 0, 0, 0, 0, time.UTC),
+					Consumptions: 8, BagsConsumed: 15, ConsumedValue: 9000, AverageBagCost: 600, HeatingDays: 6,
+				},
+			}},
+		},
+		{
+			name: "returns no season without data",
+			want: want{seasons: []core.SeasonSummary{}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			seasons, err := core.ComputeSaisons(context.Background(), &tc.params.ds)
+
+			assert.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.seasons, seasons, tc.name)
+		})
+	}
+}
+
+func TestComputeSaison(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		startYear int
+	}
+	type want struct {
+		err       error
+		months    []float64
+		brands    []core.SeasonBrand
+		purchases []core.ID
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "details a season",
+			params: params{startYear: 2023},
+			want: want{
+				months: []float64{0, 0, 0, 0, 0, 0, 3, 0, 0, 0, 0, 4},
+				brands: []core.SeasonBrand{
+					{BrandID: "brand-b", BrandName: "Bois énergie", BagsBought: 10, Spent: 5000, BagsConsumed: 4, ConsumedValue: 2000},
+					{BrandID: "brand-w", BrandName: "Woodstock", BagsBought: 20, Spent: 12000, BagsConsumed: 3, ConsumedValue: 1800},
+				},
+				purchases: []core.ID{"p1", "p2"},
+			},
+		},
+		{
+			name:   "reports empty seasons",
+			params: params{startYear: 2020},
+			want:   want{err: core.ErrSeasonNotFound},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := seasonsDataStore()
+
+			detail, err := core.ComputeSaison(context.Background(), &ds, tc.params.startYear)
+
+			assert.ErrorIs(t, err, tc.want.err, tc.name)
+			if tc.want.err != nil {
+				return
+			}
+			months := []float64{}
+			for _, month := range detail.Months {
+				months = append(months, month.Bags)
+			}
+			purchases := []core.ID{}
+			for _, purchase := range detail.Purchases {
+				purchases = append(purchases, purchase.ID)
+			}
+			assert.Equal(t, tc.want.months, months, tc.name)
+			assert.Equal(t, time.May, detail.Months[0].Month.Month(), tc.name)
+			assert.Equal(t, tc.want.brands, detail.Brands, tc.name)
+			assert.Equal(t, tc.want.purchases, purchases, tc.name)
+		})
+	}
+}
+
+func TestComputeRapportSaison(t *testing.T) {
+	t.Parallel()
+
+	percent := func(v float64) *float64 { return &v }
+
+	type params struct {
+		startYear int
+	}
+	type want struct {
+		err      error
+		values   []core.Money
+		previous []core.SeasonComparison
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "compares with the earlier seasons",
+			params: params{startYear: 2024},
+			want: want{
+				values: []core.Money{0, 0, 0, 0, 0, 600, 0, 0, 0, 0, 0, 0},
+				previous: []core.SeasonComparison{{
+					StartYear: 2023, Label: "2023-2024",
+					BagsConsumed: 7, ConsumedValue: 3800, AverageBagCost: 543, Spent: 17000,
+					BagsChangePercent: percent(-85.7), ConsumedValueChangePercent: percent(-84.2), SpentChangePercent: percent(-61.8),
+					CostPerMWh: 7540, AverageBagCostChangePercent: percent(10.5), CostPerMWhChangePercent: percent(10.5),
+				}},
+			},
+		},
+		{
+			name:   "values each month of the first season",
+			params: params{startYear: 2023},
+			want: want{
+				values:   []core.Money{0, 0, 0, 0, 0, 0, 1800, 0, 0, 0, 0, 2000},
+				previous: []core.SeasonComparison{},
+			},
+		},
+		{
+			name:   "reports empty seasons",
+			params: params{startYear: 2020},
+			want:   want{err: core.ErrSeasonNotFound},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := seasonsDataStore()
+
+			report, err := core.ComputeRapportSaison(context.Background(), &ds, tc.params.startYear)
+
+			assert.ErrorIs(t, err, tc.want.err, tc.name)
+			if tc.want.err != nil {
+				return
+			}
+			values := []core.Money{}
+			for _, month := range report.Months {
+				values = append(values, month.ConsumedValue)
+			}
+			assert.Equal(t, tc.want.values, values, tc.name)
+			assert.Equal(t, tc.want.previous, report.Previous, tc.name)
+		})
+	}
+}
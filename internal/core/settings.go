@@ -0,0 +1,247 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SettingsVersion is the layout revision of the settings exports.
+const SettingsVersion = 1
+
+// Settings are the preferences of a datastore, exported apart from its
+// entries so they can be copied to another instance or restored after a
+// reset: the stock thresholds, the figures of the brands and the storage
+// places. The brands, silos and storage locations are matched by name.
+type Settings struct {
+	Version          int                       `json:"version"`
+	MinStockBags     int                       `json:"min_stock_bags"`
+	Brands           []BrandSettings           `json:"brands"`
+	StorageLocations []StorageLocationSettings `json:"storage_locations"`
+	Silos            []SiloSettings            `json:"silos"`
+}
+
+// BrandSettings are the preferences of a brand; its image and gallery are
+// exported with /api/export/images.
+type BrandSettings struct {
+	Name           string  `json:"name"`
+	Description    string  `json:"description,omitempty"`
+	LeadTimeDays   int     `json:"lead_time_days,omitempty"`
+	EnergyKWhPerKg float64 `json:"energy_kwh_per_kg,omitempty"`
+	MinStockBags   int     `json:"min_stock_bags,omitempty"`
+	Archived       bool    `json:"archived,omitempty"`
+}
+
+// StorageLocationSettings is a declared storage location.
+type StorageLocationSettings struct {
+	Name  string `json:"name"`
+	Notes string `json:"notes,omitempty"`
+}
+
+// SiloSettings is a silo, without its readings.
+type SiloSettings struct {
+	Name       string  `json:"name"`
+	CapacityKg float64 `json:"capacity_kg"`
+}
+
+// SettingsImportSummary counts the brands, storage locations and silos an
+// import of settings created, and those it updated.
+type SettingsImportSummary struct {
+	BrandsCreated           int `json:"brands_created"`
+	BrandsUpdated           int `json:"brands_updated"`
+	StorageLocationsCreated int `json:"storage_locations_created"`
+	StorageLocationsUpdated int `json:"storage_locations_updated"`
+	SilosCreated            int `json:"silos_created"`
+	SilosUpdated            int `json:"silos_updated"`
+}
+
+// ExportSettings returns the settings of ds, each list sorted by name.
+func ExportSettings(ds *DataStore) Settings {
+	settings := Settings{
+		Version:          SettingsVersion,
+		Brands:           []BrandSettings{},
+		StorageLocations: []StorageLocationSettings{},
+		Silos:            []SiloSettings{},
+	}
+	if ds == nil {
+		return settings
+	}
+	settings.MinStockBags = ds.MinStockBags
+	for _, brand := range ds.Brands {
+		settings.Brands = append(settings.Brands, BrandSettings{
+			Name:           brand.Name,
+			Description:    brand.Description,
+			LeadTimeDays:   brand.LeadTimeDays,
+			EnergyKWhPerKg: brand.EnergyKWhPerKg,
+			MinStockBags:   brand.MinStockBags,
+			Archived:       brand.Archived,
+		})
+	}
+	for _, location := range ds.StorageLocations {
+		settings.StorageLocations = append(settings.StorageLocations, StorageLocationSettings{Name: location.Name, Notes: location.Notes})
+	}
+	for _, silo := range ds.Silos {
+		settings.Silos = append(settings.Silos, SiloSettings{Name: silo.Name, CapacityKg: silo.CapacityKg})
+	}
+	sort.Slice(settings.Brands, func(i, j int) bool {
+		return strings.ToLower(settings.Brands[i].Name) < strings.ToLower(settings.Brands[j].Name)
+	})
+	sort.Slice(settings.StorageLocations, func(i, j int) bool {
+		return strings.ToLower(settings.StorageLocations[i].Name) < strings.ToLower(settings.StorageLocations[j].Name)
+	})
+	sort.Slice(settings.Silos, func(i, j int) bool {
+		return strings.ToLower(settings.Silos[i].Name) < strings.ToLower(settings.Silos[j].Name)
+	})
+	return settings
+}
+
+// ImportSettings applies settings exported by ExportSettings to ds. The
+// brands, storage locations and silos named like existing ones update them,
+// the others are created; those missing from the import are left as they
+// are, as are the entries. ds is left untouched when settings are invalid.
+func ImportSettings(ds *DataStore, settings Settings) (SettingsImportSummary, error) {
+	if ds == nil {
+		return SettingsImportSummary{}, errors.New("nil datastore")
+	}
+	if errs := validateSettings(settings); len(errs) > 0 {
+		return SettingsImportSummary{}, errs
+	}
+
+	work := cloneForImport(*ds)
+	summary := SettingsImportSummary{}
+	if err := SetMinStockBags(&work, settings.MinStockBags); err != nil {
+		return SettingsImportSummary{}, err
+	}
+	for i, imported := range settings.Brands {
+		field := fmt.Sprintf("brands[%d]", i)
+		id, ok := findBrandForImport(work.Brands, Brand{Name: imported.Name})
+		if !ok {
+			brand, err := AddBrand(&work, CreateBrandParams{
+				Name:           imported.Name,
+				Description:    imported.Description,
+				LeadTimeDays:   imported.LeadTimeDays,
+				EnergyKWhPerKg: imported.EnergyKWhPerKg,
+				MinStockBags:   imported.MinStockBags,
+			})
+			if err != nil {
+				return SettingsImportSummary{}, prefixValidationErrors(err, field)
+			}
+			if imported.Archived {
+				if _, err := SetBrandArchived(&work, brand.ID, true); err != nil {
+					return SettingsImportSummary{}, err
+				}
+			}
+			summary.BrandsCreated++
+			continue
+		}
+		current := work.Brands[findBrandIndex(work.Brands, id)]
+		if _, err := UpdateBrand(&work, id, UpdateBrandParams{
+			Name:           current.Name,
+			Description:    imported.Description,
+			ImageBase64:    current.ImageBase64,
+			LeadTimeDays:   imported.LeadTimeDays,
+			EnergyKWhPerKg: imported.EnergyKWhPerKg,
+			MinStockBags:   imported.MinStockBags,
+			Archived:       imported.Archived,
+		}); err != nil {
+			return SettingsImportSummary{}, prefixValidationErrors(err, field)
+		}
+		summary.BrandsUpdated++
+	}
+	for i, imported := range settings.StorageLocations {
+		field := fmt.Sprintf("storage_locations[%d]", i)
+		params := StorageLocationParams{Name: imported.Name, Notes: imported.Notes}
+		idx := findStorageLocationByName(work.StorageLocations, imported.Name)
+		if idx == -1 {
+			if _, err := AddStorageLocation(&work, params); err != nil {
+				return SettingsImportSummary{}, prefixValidationErrors(err, field)
+			}
+			summary.StorageLocationsCreated++
+			continue
+		}
+		// The location keeps its spelling, a rename would move its stock.
+		params.Name = work.StorageLocations[idx].Name
+		if _, err := UpdateStorageLocation(&work, work.StorageLocations[idx].ID, params); err != nil {
+			return SettingsImportSummary{}, prefixValidationErrors(err, field)
+		}
+		summary.StorageLocationsUpdated++
+	}
+	for i, imported := range settings.Silos {
+		field := fmt.Sprintf("silos[%d]", i)
+		idx := findSiloByName(work.Silos, imported.Name)
+		if idx == -1 {
+			if _, err := AddSilo(&work, CreateSiloParams{Name: imported.Name, CapacityKg: imported.CapacityKg}); err != nil {
+				return SettingsImportSummary{}, prefixValidationErrors(err, field)
+			}
+			summary.SilosCreated++
+			continue
+		}
+		silo := work.Silos[idx]
+		if _, err := UpdateSilo(&work, silo.ID, UpdateSiloParams{Name: silo.Name, CapacityKg: imported.CapacityKg}); err != nil {
+			return SettingsImportSummary{}, prefixValidationErrors(err, field)
+		}
+		summary.SilosUpdated++
+	}
+
+	touchDatastore(&work, time.Now().UTC())
+	*ds = work
+	return summary, nil
+}
+
+// validateSettings checks the version of settings and the names they match
+// on: set, and not twice in a list.
+func validateSettings(settings Settings) ValidationErrors {
+	errs := ValidationErrors{}
+	errs = errs.AppendIf(settings.Version > SettingsVersion, "version", fmt.Sprintf("settings version %d is newer than this version supports (%d)", settings.Version, SettingsVersion))
+	errs = errs.AppendIf(settings.MinStockBags < 0, "min_stock_bags", "minimum stock cannot be negative")
+	names := func(list string, count int, name func(int) string) {
+		seen := make(map[string]bool, count)
+		for i := 0; i < count; i++ {
+			field := fmt.Sprintf("%s[%d].name", list, i)
+			key := strings.ToLower(NormalizeName(name(i)))
+			errs = errs.AppendIf(key == "", field, "name is required")
+			errs = errs.AppendIf(key != "" && seen[key], field, "name is listed twice")
+			seen[key] = true
+		}
+	}
+	names("brands", len(settings.Brands), func(i int) string { return settings.Brands[i].Name })
+	names("storage_locations", len(settings.StorageLocations), func(i int) string { return settings.StorageLocations[i].Name })
+	names("silos", len(settings.Silos), func(i int) string { return settings.Silos[i].Name })
+	return errs
+}
+
+// prefixValidationErrors prefixes the fields of a ValidationErrors with
+// prefix, returning the other errors as they are.
+func prefixValidationErrors(err error, prefix string) error {
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		return err
+	}
+	prefixed := make(ValidationErrors, len(errs))
+	for i, e := range errs {
+		prefixed[i] = ValidationError{Field: prefix + "." + e.Field, Message: e.Message}
+	}
+	return prefixed
+}
+
+func findStorageLocationByName(locations []StorageLocation, name string) int {
+	name = NormalizeName(name)
+	for i, location := range locations {
+		if strings.EqualFold(location.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func findSiloByName(silos []Silo, name string) int {
+	name = NormalizeName(name)
+	for i, silo := range silos {
+		if strings.EqualFold(silo.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
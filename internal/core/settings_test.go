@@ -0,0 +1,175 @@
+package core_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func settingsDataStore() core.DataStore {
+	return core.DataStore{
+		MinStockBags: 10,
+		Brands: []core.Brand{
+			{Meta: core.Meta{ID: "b2"}, Name: "Woodstock", LeadTimeDays: 5, ImageBase64: "aW1hZ2U="},
+			{Meta: core.Meta{ID: "b1"}, Name: "Alpha", EnergyKWhPerKg: 5.1, MinStockBags: 4, Archived: true},
+		},
+		Purchases:        []core.Purchase{{Meta: core.Meta{ID: "p1"}, BrandID: "b2", Bags: 10}},
+		StorageLocations: []core.StorageLocation{{Meta: core.Meta{ID: "l1"}, Name: "Garage", Notes: "Au fond"}},
+		Silos:            []core.Silo{{Meta: core.Meta{ID: "s1"}, Name: "Silo", CapacityKg: 3000}},
+	}
+}
+
+func TestExportSettings(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		ds *core.DataStore
+	}
+	type want struct {
+		settings core.Settings
+	}
+
+	ds := settingsDataStore()
+	empty := core.Settings{
+		Version:          core.SettingsVersion,
+		Brands:           []core.BrandSettings{},
+		StorageLocations: []core.StorageLocationSettings{},
+		Silos:            []core.SiloSettings{},
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "exports the settings sorted by name without the entries",
+			params: params{ds: &ds},
+			want: want{settings: core.Settings{
+				Version:      core.SettingsVersion,
+				MinStockBags: 10,
+				Brands: []core.BrandSettings{
+					{Name: "Alpha", EnergyKWhPerKg: 5.1, MinStockBags: 4, Archived: true},
+					{Name: "Woodstock", LeadTimeDays: 5},
+				},
+				StorageLocations: []core.StorageLocationSettings{{Name: "Garage", Notes: "Au fond"}},
+				Silos:            []core.SiloSettings{{Name: "Silo", CapacityKg: 3000}},
+			}},
+		},
+		{
+			name:   "exports empty lists without settings",
+			params: params{ds: &core.DataStore{}},
+			want:   want{settings: empty},
+		},
+		{
+			name: "exports empty lists without datastore",
+			want: want{settings: empty},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			settings := core.ExportSettings(tc.params.ds)
+
+			assert.Equal(t, tc.want.settings, settings, tc.name)
+		})
+	}
+}
+
+func TestImportSettings(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		settings core.Settings
+	}
+	type want struct {
+		summary core.SettingsImportSummary
+		// settings are the settings exported after the import.
+		settings core.Settings
+		err      error
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "updates the settings named alike and creates the others",
+			params: params{settings: core.Settings{
+				Version:      core.SettingsVersion,
+				MinStockBags: 20,
+				Brands: []core.BrandSettings{
+					{Name: "WOODSTOCK", LeadTimeDays: 7, MinStockBags: 3},
+					{Name: "Bois d'or", EnergyKWhPerKg: 4.9, Archived: true},
+				},
+				StorageLocations: []core.StorageLocationSettings{{Name: "garage", Notes: "Près de la porte"}, {Name: "Cave"}},
+				Silos:            []core.SiloSettings{{Name: "silo", CapacityKg: 4000}},
+			}},
+			want: want{
+				summary: core.SettingsImportSummary{BrandsCreated: 1, BrandsUpdated: 1, StorageLocationsCreated: 1, StorageLocationsUpdated: 1, SilosUpdated: 1},
+				settings: core.Settings{
+					Version:      core.SettingsVersion,
+					MinStockBags: 20,
+					Brands: []core.BrandSettings{
+						{Name: "Alpha", EnergyKWhPerKg: 5.1, MinStockBags: 4, Archived: true},
+						{Name: "Bois d'or", EnergyKWhPerKg: 4.9, Archived: true},
+						{Name: "Woodstock", LeadTimeDays: 7, MinStockBags: 3},
+					},
+					StorageLocations: []core.StorageLocationSettings{{Name: "Cave"}, {Name: "Garage", Notes: "Près de la porte"}},
+					Silos:            []core.SiloSettings{{Name: "Silo", CapacityKg: 4000}},
+				},
+			},
+		},
+		{
+			name:   "rejects a newer version",
+			params: params{settings: core.Settings{Version: core.SettingsVersion + 1}},
+			want:   want{err: core.ValidationErrors{{Field: "version", Message: "settings version 2 is newer than this version supports (1)"}}},
+		},
+		{
+			name: "rejects a name listed twice",
+			params: params{settings: core.Settings{Version: core.SettingsVersion, Silos: []core.SiloSettings{
+				{Name: "Silo", CapacityKg: 3000},
+				{Name: "silo ", CapacityKg: 4000},
+			}}},
+			want: want{err: core.ValidationErrors{{Field: "silos[1].name", Message: "name is listed twice"}}},
+		},
+		{
+			name: "points at the entry at fault",
+			params: params{settings: core.Settings{Version: core.SettingsVersion, Brands: []core.BrandSettings{
+				{Name: "Alpha"},
+				{Name: "Woodstock", LeadTimeDays: 400},
+			}}},
+			want: want{err: core.ValidationErrors{{Field: "brands[1].lead_time_days", Message: "lead time must be between 0 and 365 days"}}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := settingsDataStore()
+			summary, err := core.ImportSettings(&ds, tc.params.settings)
+
+			if tc.want.err != nil {
+				assert.Equal(t, tc.want.err, err, tc.name)
+				assert.Equal(t, settingsDataStore(), ds, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.summary, summary, tc.name)
+			assert.Equal(t, tc.want.settings, core.ExportSettings(&ds), tc.name)
+			assert.Len(t, ds.Purchases, 1, tc.name)
+			woodstock := ds.Brands[0]
+			assert.Equal(t, core.ID("b2"), woodstock.ID, tc.name)
+			assert.Equal(t, "aW1hZ2U=", woodstock.ImageBase64, tc.name)
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sources of a silo level reading.
+const (
+	SiloSourceManual = "manual"
+	SiloSourceSensor = "sensor"
+)
+
+// CreateSiloParams contains the fields required to declare a silo.
+type CreateSiloParams struct {
+	Name       string
+	CapacityKg float64
+}
+
+// UpdateSiloParams captures the mutable silo fields.
+type UpdateSiloParams struct {
+	Name       string
+	CapacityKg float64
+}
+
+// RecordSiloLevelParams contains a level reading, typed in or sent by a
+// level sensor.
+type RecordSiloLevelParams struct {
+	SiloID  ID
+	ReadAt  time.Time
+	LevelKg float64
+	// Source is SiloSourceManual or SiloSourceSensor, manual when empty.
+	Source string
+}
+
+// SiloStatus compares the last level read in a silo with the level expected
+// from the bulk deliveries stored in it and the weight burnt since.
+type SiloStatus struct {
+	Silo
+	// LevelKg and ReadAt are the last reading, zero without any.
+	LevelKg     float64   `json:"level_kg"`
+	ReadAt      time.Time `json:"read_at,omitempty"`
+	FillPercent float64   `json:"fill_percent"`
+	// ExpectedKg is the weight left in the bulk lots delivered to the silo,
+	// as of the last reading or now without any.
+	ExpectedKg float64 `json:"expected_kg"`
+	// GapKg is the reading minus the expected weight: negative when more
+	// pellets were burnt than recorded.
+	GapKg   float64          `json:"gap_kg"`
+	History []SiloLevelPoint `json:"history"`
+}
+
+// SiloLevelPoint is a reading of a silo with the level expected that day.
+type SiloLevelPoint struct {
+	ReadAt     time.Time `json:"read_at"`
+	LevelKg    float64   `json:"level_kg"`
+	ExpectedKg float64   `json:"expected_kg"`
+	Source     string    `json:"source"`
+}
+
+// AddSilo declares a silo. Bulk deliveries whose location is the name of the
+// silo fill it.
+func AddSilo(ds *DataStore, params CreateSiloParams) (Silo, error) {
+	if ds == nil {
+		return Silo{}, errors.New("nil datastore")
+	}
+
+	name := NormalizeName(params.Name)
+	if errs := validateSiloInput(ds, name, params.CapacityKg, ""); len(errs) > 0 {
+		return Silo{}, errs
+	}
+
+	now := time.Now().UTC()
+	silo := Silo{
+		Meta: Meta{
+			ID:        NewID(),
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		Name:       canonicalLocation(ds, name),
+		CapacityKg: RoundKg(params.CapacityKg),
+	}
+	ds.Silos = append(ds.Silos, silo)
+	touchDatastore(ds, now)
+
+	return silo, nil
+}
+
+// UpdateSilo renames a silo or changes its capacity.
+func UpdateSilo(ds *DataStore, id ID, params UpdateSiloParams) (Silo, error) {
+	if ds == nil {
+		return Silo{}, errors.New("nil datastore")
+	}
+
+	idx := findSiloIndex(ds.Silos, id)
+	if idx == -1 {
+		return Silo{}, ErrSiloNotFound
+	}
+
+	name := NormalizeName(params.Name)
+	if errs := validateSiloInput(ds, name, params.CapacityKg, id); len(errs) > 0 {
+		return Silo{}, errs
+	}
+
+	now := time.Now().UTC()
+	silo := ds.Silos[idx]
+	silo.Name = canonicalLocation(ds, name)
+	silo.CapacityKg = RoundKg(params.CapacityKg)
+	silo.touch(now)
+	ds.Silos[idx] = silo
+	touchDatastore(ds, now)
+
+	return silo, nil
+}
+
+// DeleteSilo removes a silo together with its readings.
+func DeleteSilo(ds *DataStore, id ID) error {
+	if ds == nil {
+		return errors.New("nil datastore")
+	}
+	idx := findSiloIndex(ds.Silos, id)
+	if idx == -1 {
+		return ErrSiloNotFound
+	}
+
+	ds.Silos = append(ds.Silos[:idx], ds.Silos[idx+1:]...)
+	readings := make([]SiloReading, 0, len(ds.SiloReadings))
+	for _, reading := range ds.SiloReadings {
+		if reading.SiloID != id {
+			readings = append(readings, reading)
+		}
+	}
+	ds.SiloReadings = readings
+	touchDatastore(ds, time.Now().UTC())
+	return nil
+}
+
+// RecordSiloLevel stores a level reading. A silo keeps one reading per day:
+// a later reading of the same day replaces the previous one, so a sensor
+// reporting every few minutes does not grow the datastore.
+func RecordSiloLevel(ds *DataStore, params RecordSiloLevelParams) (SiloReading, error) {
+	if ds == nil {
+		return SiloReading{}, errors.New("nil datastore")
+	}
+	idx := findSiloIndex(ds.Silos, params.SiloID)
+	if idx == -1 {
+		return SiloReading{}, ErrSiloNotFound
+	}
+
+	source := params.Source
+	if source == "" {
+		source = SiloSourceManual
+	}
+	errs := ValidationErrors{}
+	errs = errs.AppendIf(params.LevelKg < 0, "level_kg", "level cannot be negative")
+	errs = errs.AppendIf(params.LevelKg > ds.Silos[idx].CapacityKg, "level_kg", "level cannot exceed the capacity")
+	errs = errs.AppendIf(source != SiloSourceManual && source != SiloSourceSensor, "source", "unknown reading source")
+	if !params.ReadAt.IsZero() {
+		errs = errs.AppendIf(params.ReadAt.After(time.Now().Add(24*time.Hour)), "read_at", "reading date cannot be in the far future")
+	}
+	if len(errs) > 0 {
+		return SiloReading{}, errs
+	}
+
+	readAt := params.ReadAt
+	if readAt.IsZero() {
+		readAt = time.Now()
+	}
+	reading := SiloReading{
+		SiloID:  params.SiloID,
+		ReadAt:  readAt.UTC(),
+		LevelKg: RoundKg(params.LevelKg),
+		Source:  source,
+	}
+
+	day := startOfDay(reading.ReadAt)
+	readings := make([]SiloReading, 0, len(ds.SiloReadings)+1)
+	for _, existing := range ds.SiloReadings {
+		if existing.SiloID == reading.SiloID && startOfDay(existing.ReadAt).Equal(day) {
+			continue
+		}
+		readings = append(readings, existing)
+	}
+	readings = append(readings, reading)
+	sort.SliceStable(readings, func(i, j int) bool {
+		return readings[i].ReadAt.Before(readings[j].ReadAt)
+	})
+	ds.SiloReadings = readings
+	touchDatastore(ds, time.Now().UTC())
+
+	return reading, nil
+}
+
+// ComputeSilos reports every silo with its readings, each compared with the
+// weight expected from the bulk lots delivered to the silo: the bulk
+// purchases located at the silo name, or every bulk purchase without a
+// location when there is a single silo. The expected weight drops with the
+// consumptions recorded by weight, so a growing gap points at forgotten
+// entries or at a drifting sensor.
+func ComputeSilos(ctx context.Context, ds *DataStore) ([]SiloStatus, error) {
+	if ds == nil || len(ds.Silos) == 0 {
+		return nil, nil
+	}
+
+	lots := make(map[ID][]ID, len(ds.Silos))
+	for _, purchase := range ds.Purchases {
+		if !purchase.IsBulk() {
+			continue
+		}
+		for _, silo := range ds.Silos {
+			located := strings.EqualFold(purchase.Location, silo.Name)
+			if located || (purchase.Location == "" && len(ds.Silos) == 1) {
+				lots[silo.ID] = append(lots[silo.ID], purchase.ID)
+			}
+		}
+	}
+	readings := make(map[ID][]SiloReading, len(ds.Silos))
+	for _, reading := range ds.SiloReadings {
+		readings[reading.SiloID] = append(readings[reading.SiloID], reading)
+	}
+
+	// Replays are shared between silos read at the same time.
+	remaining := make(map[time.Time]map[ID]Grams)
+	remainingAt := func(at time.Time) (map[ID]Grams, error) {
+		if weights, ok := remaining[at]; ok {
+			return weights, nil
+		}
+		_, tracker, err := replayCostsUntil(ctx, ds, CostingFIFO, at)
+		if err != nil {
+			return nil, err
+		}
+		weights := tracker.bulkRemaining(at)
+		remaining[at] = weights
+		return weights, nil
+	}
+	expectedAt := func(siloID ID, at time.Time) (float64, error) {
+		weights, err := remainingAt(at)
+		if err != nil {
+			return 0, err
+		}
+		var total Grams
+		for _, id := range lots[siloID] {
+			total += weights[id]
+		}
+		return total.Kg(), nil
+	}
+
+	statuses := make([]SiloStatus, 0, len(ds.Silos))
+	for _, silo := range ds.Silos {
+		status := SiloStatus{Silo: silo, History: make([]SiloLevelPoint, 0, len(readings[silo.ID]))}
+		for _, reading := range readings[silo.ID] {
+			expected, err := expectedAt(silo.ID, reading.ReadAt)
+			if err != nil {
+				return nil, err
+			}
+			status.History = append(status.History, SiloLevelPoint{
+				ReadAt:     reading.ReadAt,
+				LevelKg:    reading.LevelKg,
+				ExpectedKg: expected,
+				Source:     reading.Source,
+			})
+		}
+		if n := len(status.History); n > 0 {
+			last := status.History[n-1]
+			status.LevelKg = last.LevelKg
+			status.ReadAt = last.ReadAt
+			status.ExpectedKg = last.ExpectedKg
+			status.GapKg = RoundKg(last.LevelKg - last.ExpectedKg)
+		} else {
+			expected, err := expectedAt(silo.ID, time.Time{})
+			if err != nil {
+				return nil, err
+			}
+			status.ExpectedKg = expected
+		}
+		if silo.CapacityKg > 0 {
+			status.FillPercent = roundHalfEven(status.LevelKg*1000/silo.CapacityKg) / 10
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return strings.ToLower(statuses[i].Name) < strings.ToLower(statuses[j].Name)
+	})
+	return statuses, nil
+}
+
+// bulkRemaining returns the weight left in each bulk lot delivered by asOf,
+// keyed by purchase.
+func (t *lotTracker) bulkRemaining(asOf time.Time) map[ID]Grams {
+	weights := make(map[ID]Grams)
+	for _, state := range t.states {
+		if state == nil {
+			continue
+		}
+		for _, lot := range state.lots {
+			if lot.bulk && withinRange(lot.purchasedAt, time.Time{}, asOf) {
+				weights[lot.id] += lot.remainingWeight
+			}
+		}
+	}
+	return weights
+}
+
+func validateSiloInput(ds *DataStore, name string, capacityKg float64, id ID) ValidationErrors {
+	errs := ValidationErrors{}
+	errs = errs.AppendIf(name == "", "name", "name is required")
+	for _, silo := range ds.Silos {
+		if silo.ID != id && strings.EqualFold(silo.Name, name) {
+			errs = errs.AppendIf(name != "", "name", "silo name already exists")
+			break
+		}
+	}
+	errs = errs.AppendIf(capacityKg <= 0, "capacity_kg", "capacity must be greater than zero")
+	return errs
+}
+
+func findSiloIndex(silos []Silo, id ID) int {
+	for i, silo := range silos {
+		if silo.ID == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,233 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func silosDataStore() core.DataStore {
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2024, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	return core.DataStore{
+		Brands: []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}},
+		Purchases: []core.Purchase{
+			{Meta: core.Meta{ID: "p2"}, BrandID: "brand-w", PurchasedAt: day(time.December, 1), TotalWeightKg: 1000, PricePerTonneCents: 40000, TotalPriceCents: 40000, Location: "Silo"},
+			{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: day(time.September, 1), TotalWeightKg: 3000, PricePerTonneCents: 39000, TotalPriceCents: 117000, Location: "Silo"},
+			{Meta: core.Meta{ID: "p0"}, BrandID: "brand-w", PurchasedAt: day(time.September, 1), Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 600, TotalPriceCents: 6000, Location: "Garage"},
+		},
+		Consumptions: []core.Consumption{
+			{Meta: core.Meta{ID: "c2"}, BrandID: "brand-w", ConsumedAt: day(time.November, 15), WeightKg: 700},
+			{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: day(time.October, 15), WeightKg: 500},
+			{Meta: core.Meta{ID: "c0"}, BrandID: "brand-w", ConsumedAt: day(time.October, 20), Bags: 2},
+		},
+		Silos: []core.Silo{{Meta: core.Meta{ID: "silo"}, Name: "Silo", CapacityKg: 4000}},
+	}
+}
+
+func TestAddSilo(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		input core.CreateSiloParams
+	}
+	type want struct {
+		name     string
+		errField string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "reuses the spelling of an existing location",
+			params: params{input: core.CreateSiloParams{Name: " garage ", CapacityKg: 2500}},
+			want:   want{name: "Garage"},
+		},
+		{
+			name:   "requires a capacity",
+			params: params{input: core.CreateSiloParams{Name: "Cuve"}},
+			want:   want{errField: "capacity_kg"},
+		},
+		{
+			name:   "rejects a duplicate name",
+			params: params{input: core.CreateSiloParams{Name: "silo", CapacityKg: 2500}},
+			want:   want{errField: "name"},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := silosDataStore()
+			silo, err := core.AddSilo(&ds, tc.params.input)
+			if tc.want.errField != "" {
+				var vErr core.ValidationErrors
+				assert.ErrorAs(t, err, &vErr, tc.name)
+				assert.True(t, vErr.Has(tc.want.errField), tc.name)
+				assert.Len(t, ds.Silos, 1, tc.name)
+				return
+			}
+			assert.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.name, silo.Name, tc.name)
+			assert.Len(t, ds.Silos, 2, tc.name)
+		})
+	}
+}
+
+func TestRecordSiloLevel(t *testing.T) {
+	t.Parallel()
+
+	morning := time.Date(2024, time.December, 2, 7, 0, 0, 0, time.UTC)
+	evening := time.Date(2024, time.December, 2, 19, 0, 0, 0, time.UTC)
+	measured := silosDataStore()
+	measured.SiloReadings = []core.SiloReading{{SiloID: "silo", ReadAt: morning, LevelKg: 2600, Source: core.SiloSourceManual}}
+
+	type params struct {
+		datastore core.DataStore
+		input     core.RecordSiloLevelParams
+	}
+	type want struct {
+		err      error
+		errField string
+		readings []core.SiloReading
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "records a manual reading",
+			params: params{datastore: silosDataStore(), input: core.RecordSiloLevelParams{SiloID: "silo", ReadAt: morning, LevelKg: 2600}},
+			want:   want{readings: []core.SiloReading{{SiloID: "silo", ReadAt: morning, LevelKg: 2600, Source: core.SiloSourceManual}}},
+		},
+		{
+			name:   "keeps the last reading of the day",
+			params: params{datastore: measured, input: core.RecordSiloLevelParams{SiloID: "silo", ReadAt: evening, LevelKg: 2540.25, Source: core.SiloSourceSensor}},
+			want:   want{readings: []core.SiloReading{{SiloID: "silo", ReadAt: evening, LevelKg: 2540.25, Source: core.SiloSourceSensor}}},
+		},
+		{
+			name:   "rejects a level above the capacity",
+			params: params{datastore: silosDataStore(), input: core.RecordSiloLevelParams{SiloID: "silo", LevelKg: 4200}},
+			want:   want{errField: "level_kg"},
+		},
+		{
+			name:   "rejects unknown sources",
+			params: params{datastore: silosDataStore(), input: core.RecordSiloLevelParams{SiloID: "silo", LevelKg: 100, Source: "radar"}},
+			want:   want{errField: "source"},
+		},
+		{
+			name:   "reports unknown silos",
+			params: params{datastore: silosDataStore(), input: core.RecordSiloLevelParams{SiloID: "missing", LevelKg: 100}},
+			want:   want{err: core.ErrSiloNotFound},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := tc.params.datastore
+			_, err := core.RecordSiloLevel(&ds, tc.params.input)
+			switch {
+			case tc.want.err != nil:
+				assert.ErrorIs(t, err, tc.want.err, tc.name)
+			case tc.want.errField != "":
+				var vErr core.ValidationErrors
+				assert.ErrorAs(t, err, &vErr, tc.name)
+				assert.True(t, vErr.Has(tc.want.errField), tc.name)
+			default:
+				assert.NoError(t, err, tc.name)
+				assert.Equal(t, tc.want.readings, ds.SiloReadings, tc.name)
+			}
+		})
+	}
+}
+
+func TestComputeSilos(t *testing.T) {
+	t.Parallel()
+
+	measured := silosDataStore()
+	measured.SiloReadings = []core.SiloReading{
+		{SiloID: "silo", ReadAt: time.Date(2024, time.October, 31, 8, 0, 0, 0, time.UTC), LevelKg: 2450, Source: core.SiloSourceSensor},
+		{SiloID: "silo", ReadAt: time.Date(2024, time.December, 2, 8, 0, 0, 0, time.UTC), LevelKg: 2700, Source: core.SiloSourceManual},
+	}
+	unlocated := silosDataStore()
+	for i := range unlocated.Purchases {
+		if unlocated.Purchases[i].IsBulk() {
+			unlocated.Purchases[i].Location = ""
+		}
+	}
+	unlocated.Silos = append(unlocated.Silos, core.Silo{Meta: core.Meta{ID: "cuve"}, Name: "Cuve", CapacityKg: 2000})
+
+	type params struct {
+		datastore core.DataStore
+	}
+	type want struct {
+		statuses []core.SiloStatus
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "expects the bulk lots left without readings",
+			params: params{datastore: silosDataStore()},
+			want: want{statuses: []core.SiloStatus{{
+				Silo:       silosDataStore().Silos[0],
+				ExpectedKg: 2800,
+				History:    []core.SiloLevelPoint{},
+			}}},
+		},
+		{
+			name:   "compares every reading with the expected level",
+			params: params{datastore: measured},
+			want: want{statuses: []core.SiloStatus{{
+				Silo:        measured.Silos[0],
+				LevelKg:     2700,
+				ReadAt:      time.Date(2024, time.December, 2, 8, 0, 0, 0, time.UTC),
+				FillPercent: 67.5,
+				ExpectedKg:  2800,
+				GapKg:       -100,
+				History: []core.SiloLevelPoint{
+					{ReadAt: time.Date(2024, time.October, 31, 8, 0, 0, 0, time.UTC), LevelKg: 2450, ExpectedKg: 2500, Source: core.SiloSourceSensor},
+					{ReadAt: time.Date(2024, time.December, 2, 8, 0, 0, 0, time.UTC), LevelKg: 2700, ExpectedKg: 2800, Source: core.SiloSourceManual},
+				},
+			}}},
+		},
+		{
+			name:   "leaves unlocated deliveries out with several silos",
+			params: params{datastore: unlocated},
+			want: want{statuses: []core.SiloStatus{
+				{Silo: unlocated.Silos[1], History: []core.SiloLevelPoint{}},
+				{Silo: unlocated.Silos[0], History: []core.SiloLevelPoint{}},
+			}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			statuses, err := core.ComputeSilos(context.Background(), &tc.params.datastore)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.statuses, statuses, tc.name)
+		})
+	}
+}
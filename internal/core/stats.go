@@ -1,6 +1,8 @@
 package core
 
 import (
+	"context"
+	"math"
 	"sort"
 	"time"
 )
@@ -11,14 +13,21 @@ type ConsumptionAllocation struct {
 	Bags       int   `json:"bags"`
 	UnitPrice  Money `json:"unit_price_cents"`
 	TotalPrice Money `json:"total_price_cents"`
+	// WeightKg and PricePerTonne are set instead of Bags and UnitPrice for
+	// the weight taken from a bulk delivery.
+	WeightKg      float64 `json:"weight_kg,omitempty"`
+	PricePerTonne Money   `json:"price_per_tonne_cents,omitempty"`
 }
 
-// ConsumptionCost details the FIFO valuation of a consumption entry.
+// ConsumptionCost details the valuation of a consumption entry.
 type ConsumptionCost struct {
 	Consumption Consumption             `json:"consumption"`
 	Allocations []ConsumptionAllocation `json:"allocations"`
-	TotalBags   int                     `json:"total_bags"`
+	TotalBags   float64                 `json:"total_bags"`
 	TotalPrice  Money                   `json:"total_price_cents"`
+	// BlendedBagPrice is what one bag of the consumption cost on average when
+	// it spans lots bought at different prices.
+	BlendedBagPrice Money `json:"blended_bag_price_cents"`
 }
 
 // BrandInventory summarizes the remaining inventory for a brand.
@@ -41,10 +50,42 @@ type InventorySummary struct {
 // MonthlyBags tracks the number of bags consumed in a specific month.
 type MonthlyBags struct {
 	Month time.Time `json:"month"`
-	Bags  int       `json:"bags"`
+	Bags  float64   `json:"bags"`
+	// WeightKg is the weight burnt, which compares months where bags of
+	// different sizes were burnt; weight taken from bulk deliveries counts.
+	WeightKg float64 `json:"weight_kg"`
+	// PriorYears holds the same calendar month of every earlier year since the
+	// first recorded consumption, oldest first, to compare seasons.
+	PriorYears []YearBags `json:"prior_years,omitempty"`
+	// Period is PeriodQuarter or PeriodSeason for the bars LimitSacsParMois
+	// adds up, Month being their first month; empty for a month.
+	Period string `json:"period,omitempty"`
+}
+
+// PowerLevelUsage summarizes the consumptions recorded at one stove power level.
+type PowerLevelUsage struct {
+	PowerLevel int     `json:"power_level"`
+	Days       int     `json:"days"`
+	Bags       float64 `json:"bags"`
+	BagsPerDay float64 `json:"bags_per_day"`
+}
+
+// YearBags is the number of bags consumed during one month of a given year.
+type YearBags struct {
+	Year     int     `json:"year"`
+	Bags     float64 `json:"bags"`
+	WeightKg float64 `json:"weight_kg"`
+}
+
+// MonthlyStock is the weight left in stock at the end of a month.
+type MonthlyStock struct {
+	Month    time.Time `json:"month"`
+	WeightKg float64   `json:"weight_kg"`
 }
 
 // ComputeInvesti returns the total amount invested in purchases within the optional range.
+// The purchases compacted into season archives count when their whole season
+// is within the range.
 func ComputeInvesti(ds *DataStore, from, to time.Time) Money {
 	if ds == nil {
 		return 0
@@ -57,16 +98,22 @@ func ComputeInvesti(ds *DataStore, from, to time.Time) Money {
 		}
 		total += purchase.TotalPriceCents
 	}
+	for _, archive := range archivedWithin(ds, from, to) {
+		total += archive.Spent
+	}
 	return total
 }
 
-// ComputeConsoValue returns the FIFO valuation for consumptions within the optional range.
-func ComputeConsoValue(ds *DataStore, from, to time.Time) (Money, []ConsumptionCost, error) {
+// ComputeConsoValue returns the valuation for consumptions within the optional range.
+// The replay stops with the context error once ctx is done, as do the other
+// lot based computations. The total includes the FIFO value of the seasons
+// archived within the range, which have no details left.
+func ComputeConsoValue(ctx context.Context, ds *DataStore, method CostingMethod, from, to time.Time) (Money, []ConsumptionCost, error) {
 	if ds == nil {
 		return 0, nil, nil
 	}
 
-	calculations, _, err := computeFIFOResults(ds)
+	calculations, _, err := computeCostResults(ctx, ds, method)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -79,55 +126,85 @@ func ComputeConsoValue(ds *DataStore, from, to time.Time) (Money, []ConsumptionC
 		}
 
 		detail := ConsumptionCost{
-			Consumption: calc.consumption,
-			Allocations: append([]ConsumptionAllocation(nil), calc.allocations...),
-			TotalPrice:  calc.total,
-			TotalBags:   calc.consumption.Bags,
+			Consumption:     calc.consumption,
+			Allocations:     append([]ConsumptionAllocation(nil), calc.allocations...),
+			TotalPrice:      calc.total,
+			TotalBags:       calc.bags,
+			BlendedBagPrice: calc.total.DivBags(calc.bags),
 		}
 		total += calc.total
 		details = append(details, detail)
 	}
+	for _, archive := range archivedWithin(ds, from, to) {
+		total += archive.ConsumedValue
+	}
 
 	return total, details, nil
 }
 
-// ComputeInventaire calculates the remaining inventory per brand after FIFO consumption.
-func ComputeInventaire(ds *DataStore) (InventorySummary, error) {
+// ComputeInventaire calculates the remaining inventory per brand, valued with
+// method.
+func ComputeInventaire(ctx context.Context, ds *DataStore, method CostingMethod) (InventorySummary, error) {
+	return ComputeInventaireAu(ctx, ds, method, time.Time{})
+}
+
+// ComputeInventaireAu calculates the inventory per brand as it stood at
+// asOf: only the purchases, consumptions and reclassifications recorded up
+// to that instant are replayed. A zero asOf gives the current inventory.
+func ComputeInventaireAu(ctx context.Context, ds *DataStore, method CostingMethod, asOf time.Time) (InventorySummary, error) {
 	if ds == nil {
 		return InventorySummary{}, nil
 	}
 
-	_, tracker, err := computeFIFOResults(ds)
+	_, tracker, err := replayCostsUntil(ctx, ds, method, asOf)
 	if err != nil {
 		return InventorySummary{}, err
 	}
 
-	return tracker.inventorySummary(ds.Brands), nil
+	return tracker.inventorySummary(ds.Brands, asOf), nil
 }
 
-// ComputeSacsParMois aggregates the number of bags consumed per month within the range.
-func ComputeSacsParMois(ds *DataStore, from, to time.Time) ([]MonthlyBags, error) {
+// ComputeSacsParMois aggregates the number of bags and the weight consumed per
+// month within the range.
+// Each month also carries the same month of prior years, which are looked up
+// regardless of the range so a filtered view can still be compared.
+func ComputeSacsParMois(ctx context.Context, ds *DataStore, from, to time.Time) ([]MonthlyBags, error) {
 	if ds == nil {
 		return nil, nil
 	}
 
-	calculations, _, err := computeFIFOResults(ds)
+	calculations, _, err := computeFIFOResults(ctx, ds)
 	if err != nil {
 		return nil, err
 	}
 
-	buckets := make(map[time.Time]int)
+	all := make(map[time.Time]float64)
+	allWeights := make(map[time.Time]Grams)
+	buckets := make(map[time.Time]float64)
+	weights := make(map[time.Time]Grams)
+	firstYear := 0
 	for _, calc := range calculations {
-		if !withinRange(calc.consumption.ConsumedAt, from, to) {
-			continue
+		consumedAt := calc.consumption.ConsumedAt
+		month := time.Date(consumedAt.Year(), consumedAt.Month(), 1, 0, 0, 0, 0, time.UTC)
+		all[month] += calc.bags
+		allWeights[month] += calc.weight
+		if firstYear == 0 || month.Year() < firstYear {
+			firstYear = month.Year()
+		}
+		if withinRange(consumedAt, from, to) {
+			buckets[month] += calc.bags
+			weights[month] += calc.weight
 		}
-		month := time.Date(calc.consumption.ConsumedAt.Year(), calc.consumption.ConsumedAt.Month(), 1, 0, 0, 0, 0, time.UTC)
-		buckets[month] += calc.consumption.Bags
 	}
 
 	results := make([]MonthlyBags, 0, len(buckets))
 	for month, bags := range buckets {
-		results = append(results, MonthlyBags{Month: month, Bags: bags})
+		entry := MonthlyBags{Month: month, Bags: bags, WeightKg: weights[month].Kg()}
+		for year := firstYear; year < month.Year(); year++ {
+			prior := time.Date(year, month.Month(), 1, 0, 0, 0, 0, time.UTC)
+			entry.PriorYears = append(entry.PriorYears, YearBags{Year: year, Bags: all[prior], WeightKg: allWeights[prior].Kg()})
+		}
+		results = append(results, entry)
 	}
 	sort.Slice(results, func(i, j int) bool {
 		return results[i].Month.Before(results[j].Month)
@@ -136,33 +213,179 @@ func ComputeSacsParMois(ds *DataStore, from, to time.Time) ([]MonthlyBags, error
 	return results, nil
 }
 
-// ComputeCoutMoyenParSac returns the average FIFO cost per bag consumed within the range.
-func ComputeCoutMoyenParSac(ds *DataStore, from, to time.Time) (Money, error) {
+// ComputeStockKgParMois returns the weight in stock at the end of every month
+// from the first purchase or consumption, or from the start of the range, up
+// to the last one or the end of the range. Unlike a number of bags, the
+// weight adds up bags of every size and bulk deliveries alike.
+func ComputeStockKgParMois(ctx context.Context, ds *DataStore, from, to time.Time) ([]MonthlyStock, error) {
+	if ds == nil {
+		return nil, nil
+	}
+
+	// The burnt weight does not depend on the costing method.
+	calculations, _, err := computeFIFOResults(ctx, ds)
+	if err != nil {
+		return nil, err
+	}
+
+	monthOf := func(ts time.Time) time.Time {
+		ts = ts.UTC()
+		return time.Date(ts.Year(), ts.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	deltas := make(map[time.Time]Grams)
+	for _, purchase := range ds.Purchases {
+		weight := GramsFromKg(purchase.TotalWeightKg)
+		if !purchase.IsBulk() {
+			weight = purchaseBagWeight(purchase).MulInt(max(purchase.Bags, 0))
+		}
+		deltas[monthOf(purchase.PurchasedAt)] += weight
+	}
+	for _, calc := range calculations {
+		deltas[monthOf(calc.consumption.ConsumedAt)] -= calc.weight
+	}
+	if len(deltas) == 0 {
+		return nil, nil
+	}
+
+	var first, last time.Time
+	for month := range deltas {
+		if first.IsZero() || month.Before(first) {
+			first = month
+		}
+		if month.After(last) {
+			last = month
+		}
+	}
+	if !from.IsZero() && monthOf(from).After(first) {
+		first = monthOf(from)
+	}
+	if !to.IsZero() {
+		last = monthOf(to)
+	}
+
+	var stock Grams
+	for month, delta := range deltas {
+		if month.Before(first) {
+			stock += delta
+		}
+	}
+	var results []MonthlyStock
+	for month := first; !month.After(last); month = month.AddDate(0, 1, 0) {
+		stock += deltas[month]
+		results = append(results, MonthlyStock{Month: month, WeightKg: stock.Kg()})
+	}
+	return results, nil
+}
+
+// ComputeSacsParPuissance returns the average number of bags burnt per day for
+// each stove power level within the range. Days are the distinct calendar days
+// with a consumption logged at that level; untagged consumptions are ignored.
+func ComputeSacsParPuissance(ds *DataStore, from, to time.Time) []PowerLevelUsage {
+	if ds == nil {
+		return nil
+	}
+
+	bags := make(map[int]float64)
+	days := make(map[int]map[time.Time]struct{})
+	for _, consumption := range ds.Consumptions {
+		if consumption.PowerLevel == 0 || !withinRange(consumption.ConsumedAt, from, to) {
+			continue
+		}
+		level := consumption.PowerLevel
+		bags[level] += consumption.TotalBags()
+		if days[level] == nil {
+			days[level] = make(map[time.Time]struct{})
+		}
+		days[level][startOfDay(consumption.ConsumedAt)] = struct{}{}
+	}
+
+	results := make([]PowerLevelUsage, 0, len(bags))
+	for level, total := range bags {
+		dayCount := len(days[level])
+		results = append(results, PowerLevelUsage{
+			PowerLevel: level,
+			Days:       dayCount,
+			Bags:       total,
+			BagsPerDay: total / float64(dayCount),
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].PowerLevel < results[j].PowerLevel
+	})
+	return results
+}
+
+// ComputeCoutMoyenParSac returns the average cost per bag consumed within the range,
+// the seasons archived within it included.
+func ComputeCoutMoyenParSac(ctx context.Context, ds *DataStore, method CostingMethod, from, to time.Time) (Money, error) {
 	if ds == nil {
 		return 0, nil
 	}
 
-	calculations, _, err := computeFIFOResults(ds)
+	calculations, _, err := computeCostResults(ctx, ds, method)
 	if err != nil {
 		return 0, err
 	}
 
 	var totalCost Money
-	var totalBags int
+	var totalBags float64
 	for _, calc := range calculations {
-		if !withinRange(calc.consumption.ConsumedAt, from, to) {
+		// Weight taken from bulk deliveries has no bag to share the cost
+		// with.
+		if calc.bags == 0 || !withinRange(calc.consumption.ConsumedAt, from, to) {
 			continue
 		}
 		totalCost += calc.total
-		totalBags += calc.consumption.Bags
+		totalBags += calc.bags
+	}
+	for _, archive := range archivedWithin(ds, from, to) {
+		totalCost += archive.ConsumedValue
+		totalBags += archive.BagsConsumed
 	}
 
 	if totalBags == 0 {
 		return 0, nil
 	}
 
-	avgCents := roundHalfEven(float64(totalCost.Int64()) / float64(totalBags))
-	return Money(int64(avgCents)), nil
+	return totalCost.DivBags(totalBags), nil
+}
+
+// ComputeCoutMoyenParTonne returns the average cost of the weight consumed
+// within the range in cents per tonne, so the price of a kilogram keeps its
+// decimals. Unlike ComputeCoutMoyenParSac it compares brands sold in bags of
+// different sizes and counts the weight taken from bulk deliveries. The
+// seasons archived within the range count when their weight was recorded.
+func ComputeCoutMoyenParTonne(ctx context.Context, ds *DataStore, method CostingMethod, from, to time.Time) (Money, error) {
+	if ds == nil {
+		return 0, nil
+	}
+
+	calculations, _, err := computeCostResults(ctx, ds, method)
+	if err != nil {
+		return 0, err
+	}
+
+	var totalCost Money
+	var totalWeight Grams
+	for _, calc := range calculations {
+		if calc.weight <= 0 || !withinRange(calc.consumption.ConsumedAt, from, to) {
+			continue
+		}
+		totalCost += calc.total
+		totalWeight += calc.weight
+	}
+	for _, archive := range archivedWithin(ds, from, to) {
+		if archive.WeightConsumedKg <= 0 {
+			continue
+		}
+		totalCost += archive.ConsumedValue
+		totalWeight += GramsFromKg(archive.WeightConsumedKg)
+	}
+
+	if totalWeight <= 0 {
+		return 0, nil
+	}
+	return Money(int64(roundHalfEven(float64(totalCost) * 1e6 / float64(totalWeight)))), nil
 }
 
 func withinRange(ts, from, to time.Time) bool {
@@ -179,52 +402,120 @@ type consumptionCalculation struct {
 	consumption Consumption
 	allocations []ConsumptionAllocation
 	total       Money
+	// weight is the weight burnt, as removed from the stock.
+	weight Grams
+	// bags counts the bags burnt, parts of opened bags included; weight taken
+	// from bulk deliveries counts for none.
+	bags float64
 }
 
 type purchaseLot struct {
 	id           ID
+	purchasedAt  time.Time
 	unitPrice    Money
 	remaining    int
-	weightPerBag float64
+	weightPerBag Grams
+	// remainingWeight is tracked apart from the bag count so consumptions
+	// recorded by weight decrement it to the gram.
+	remainingWeight Grams
+	// pooled reports, with average costing, whether the bags of the lot were
+	// added to the valued pool of their brand.
+	pooled bool
+	// bulk lots hold no bags: they are consumed by weight, at pricePerTonne.
+	bulk          bool
+	pricePerTonne Money
 }
 
-type fifoState struct {
+type lotState struct {
 	lots  []*purchaseLot
 	index int
+	// pooledBags and pooledValue hold, with average costing, the bags bought
+	// so far and their value; every consumption takes its share at the
+	// average price.
+	pooledBags  int
+	pooledValue Money
+	// opened is the bag partial consumptions are taken from, nil until one
+	// is recorded.
+	opened *openedBag
+}
+
+type lotTracker struct {
+	method CostingMethod
+	states map[ID]*lotState
+}
+
+// cancelCheckInterval is the number of replayed events between two checks of
+// the caller's context, frequent enough to stop abandoned requests quickly
+// without measurable overhead.
+const cancelCheckInterval = 256
+
+// computeFIFOResults replays the history with FIFO costing, for the
+// computations that report FIFO figures whatever the configured method.
+func computeFIFOResults(ctx context.Context, ds *DataStore) ([]consumptionCalculation, *lotTracker, error) {
+	return computeCostResults(ctx, ds, CostingFIFO)
 }
 
-type fifoTracker struct {
-	states map[ID]*fifoState
+// computeCostResults replays the consumptions and reclassifications in order
+// against the purchase lots, valuing each consumption with method.
+func computeCostResults(ctx context.Context, ds *DataStore, method CostingMethod) ([]consumptionCalculation, *lotTracker, error) {
+	return replayCostsUntil(ctx, ds, method, time.Time{})
 }
 
-func computeFIFOResults(ds *DataStore) ([]consumptionCalculation, *fifoTracker, error) {
-	tracker := newFIFOTracker(ds)
-	consumptions := append([]Consumption(nil), ds.Consumptions...)
-	sort.Slice(consumptions, func(i, j int) bool {
-		if consumptions[i].ConsumedAt.Equal(consumptions[j].ConsumedAt) {
-			return string(consumptions[i].ID) < string(consumptions[j].ID)
+// replayCostsUntil is computeCostResults restricted to the consumptions and
+// reclassifications recorded up to until, when set. Every purchase is still
+// loaded so a consumption recorded before its purchase replays as it does
+// over the whole history.
+func replayCostsUntil(ctx context.Context, ds *DataStore, method CostingMethod, until time.Time) ([]consumptionCalculation, *lotTracker, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	tracker := newLotTracker(ds, method)
+	events := make([]stockEvent, 0, len(ds.Consumptions)+len(ds.Transfers))
+	for _, consumption := range ds.Consumptions {
+		if withinRange(consumption.ConsumedAt, time.Time{}, until) {
+			events = append(events, stockEvent{at: consumption.ConsumedAt, id: consumption.ID, consumption: &consumption})
 		}
-		return consumptions[i].ConsumedAt.Before(consumptions[j].ConsumedAt)
-	})
+	}
+	// Only reclassifications change the valuation; moves between locations
+	// keep the bags under the same brand.
+	for _, transfer := range ds.Transfers {
+		if transfer.TargetBrandID() != transfer.BrandID && withinRange(transfer.TransferredAt, time.Time{}, until) {
+			events = append(events, stockEvent{at: transfer.TransferredAt, id: transfer.ID, transfer: &transfer})
+		}
+	}
+	sortStockEvents(events)
 
-	results := make([]consumptionCalculation, 0, len(consumptions))
-	for _, consumption := range consumptions {
-		allocations, total, err := tracker.consume(consumption)
+	results := make([]consumptionCalculation, 0, len(ds.Consumptions))
+	for i, event := range events {
+		if i%cancelCheckInterval == cancelCheckInterval-1 {
+			if err := ctx.Err(); err != nil {
+				return nil, nil, err
+			}
+		}
+		if event.transfer != nil {
+			if err := tracker.reclassify(*event.transfer); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		allocations, total, weight, bags, err := tracker.consume(*event.consumption)
 		if err != nil {
 			return nil, nil, err
 		}
 		results = append(results, consumptionCalculation{
-			consumption: consumption,
+			consumption: *event.consumption,
 			allocations: allocations,
 			total:       total,
+			weight:      weight,
+			bags:        bags,
 		})
 	}
 
 	return results, tracker, nil
 }
 
-func newFIFOTracker(ds *DataStore) *fifoTracker {
-	tracker := &fifoTracker{states: make(map[ID]*fifoState)}
+func newLotTracker(ds *DataStore, method CostingMethod) *lotTracker {
+	tracker := &lotTracker{method: method, states: make(map[ID]*lotState)}
 	purchases := append([]Purchase(nil), ds.Purchases...)
 	sort.Slice(purchases, func(i, j int) bool {
 		if purchases[i].PurchasedAt.Equal(purchases[j].PurchasedAt) {
@@ -234,74 +525,398 @@ func newFIFOTracker(ds *DataStore) *fifoTracker {
 	})
 
 	for _, purchase := range purchases {
-		if purchase.Bags <= 0 {
+		if purchase.Bags <= 0 && !purchase.IsBulk() {
 			continue
 		}
 		state := tracker.states[purchase.BrandID]
 		if state == nil {
-			state = &fifoState{}
+			state = &lotState{}
 			tracker.states[purchase.BrandID] = state
 		}
-		weightPerBag := purchase.BagWeightKg
-		if weightPerBag <= 0 && purchase.Bags > 0 {
-			weightPerBag = purchase.TotalWeightKg / float64(purchase.Bags)
+		if purchase.IsBulk() {
+			state.lots = append(state.lots, &purchaseLot{
+				id:              purchase.ID,
+				purchasedAt:     purchase.PurchasedAt,
+				remainingWeight: GramsFromKg(purchase.TotalWeightKg),
+				bulk:            true,
+				pricePerTonne:   purchase.PricePerTonneCents,
+			})
+			continue
 		}
+		weightPerBag := purchaseBagWeight(purchase)
 		state.lots = append(state.lots, &purchaseLot{
-			id:           purchase.ID,
-			unitPrice:    purchase.UnitPriceCents,
-			remaining:    purchase.Bags,
-			weightPerBag: weightPerBag,
+			id:              purchase.ID,
+			purchasedAt:     purchase.PurchasedAt,
+			unitPrice:       purchase.UnitPriceCents,
+			remaining:       purchase.Bags,
+			weightPerBag:    weightPerBag,
+			remainingWeight: weightPerBag.MulInt(purchase.Bags),
 		})
 	}
 
 	return tracker
 }
 
-func (t *fifoTracker) consume(consumption Consumption) ([]ConsumptionAllocation, Money, error) {
-	if consumption.Bags <= 0 {
-		return nil, 0, nil
+// purchaseBagWeight returns the weight of one bag of a purchase, derived from
+// the total weight for entries recorded before the per-bag weight existed.
+func purchaseBagWeight(purchase Purchase) Grams {
+	weightPerBag := GramsFromKg(purchase.BagWeightKg)
+	if weightPerBag <= 0 && purchase.Bags > 0 {
+		weightPerBag = GramsFromKg(purchase.TotalWeightKg).DivInt(purchase.Bags)
+	}
+	return weightPerBag
+}
+
+// consume values the bags of a consumption against the lots picked by the
+// costing method and removes the burnt weight from the stock: its WeightKg
+// when recorded, the weight of the bags taken otherwise. The removed weight is
+// returned with the value and the bags burnt. The part of a bag is taken from
+// the bag left open by the previous partial consumptions, or a new one.
+// Consumptions recorded by weight alone are taken from the bulk lots, then
+// from opened bags.
+func (t *lotTracker) consume(consumption Consumption) ([]ConsumptionAllocation, Money, Grams, float64, error) {
+	if consumption.Bags <= 0 && consumption.BagsFraction <= 0 && consumption.WeightKg <= 0 {
+		return nil, 0, 0, 0, nil
 	}
 
 	state := t.states[consumption.BrandID]
 	if state == nil {
-		return nil, 0, ErrInsufficientInventory
+		return nil, 0, 0, 0, ErrInsufficientInventory
+	}
+	if consumption.Bags <= 0 && consumption.BagsFraction <= 0 {
+		burnt := GramsFromKg(consumption.WeightKg)
+		allocations, total, left := state.takeBulk(burnt)
+		opened, openedTotal, bags, left := state.takeOpened(t.method, consumption.ConsumedAt, left)
+		state.drainWeight(left)
+		return append(allocations, opened...), total + openedTotal, burnt, bags, nil
+	}
+	average := t.method == CostingAverage
+	if average {
+		state.pool(consumption.ConsumedAt, consumption.Bags)
 	}
+	poolBags, poolValue := state.pooledBags, state.pooledValue
 
 	var allocations []ConsumptionAllocation
 	var total Money
+	var bagsWeight Grams
 	remainingBags := consumption.Bags
 
 	for remainingBags > 0 {
-		lot := state.nextLot()
+		lot := state.pick(t.method, consumption.ConsumedAt)
 		if lot == nil {
-			return nil, 0, ErrInsufficientInventory
+			return nil, 0, 0, 0, ErrInsufficientInventory
 		}
 
 		take := remainingBags
 		if take > lot.remaining {
 			take = lot.remaining
 		}
-
 		lot.remaining -= take
-		if lot.remaining == 0 {
-			state.index++
-		}
 
+		bagsWeight += lot.weightPerBag.MulInt(take)
+		unitPrice := lot.unitPrice
 		cost := lot.unitPrice.MulInt(take)
+		if average {
+			// The share is computed on the cumulated bags so the rounding
+			// never leaves value behind once the pool is emptied.
+			taken := consumption.Bags - remainingBags
+			unitPrice = poolValue.DivInt(poolBags)
+			cost = poolShare(poolValue, poolBags, taken+take) - poolShare(poolValue, poolBags, taken)
+		}
 		allocations = append(allocations, ConsumptionAllocation{
 			PurchaseID: lot.id,
 			Bags:       take,
-			UnitPrice:  lot.unitPrice,
+			UnitPrice:  unitPrice,
 			TotalPrice: cost,
 		})
 		total += cost
 		remainingBags -= take
 	}
+	if average {
+		state.pooledBags -= consumption.Bags
+		state.pooledValue -= total
+	}
+	bags := float64(consumption.Bags)
+
+	// The opened bag already left the stock weight as it was taken.
+	var partWeight Grams
+	if consumption.BagsFraction > 0 {
+		bagWeight := state.openingWeight(t.method, consumption.ConsumedAt)
+		if bagWeight <= 0 {
+			return nil, 0, 0, 0, ErrInsufficientInventory
+		}
+		partWeight = Grams(math.Round(consumption.BagsFraction * float64(bagWeight)))
+		opened, openedTotal, openedBags, left := state.takeOpened(t.method, consumption.ConsumedAt, partWeight)
+		if left > 0 {
+			return nil, 0, 0, 0, ErrInsufficientInventory
+		}
+		allocations = append(allocations, opened...)
+		total += openedTotal
+		bags += openedBags
+	}
+
+	burnt := bagsWeight + partWeight
+	if consumption.WeightKg > 0 {
+		burnt = GramsFromKg(consumption.WeightKg)
+	}
+	state.drainWeight(max(burnt-partWeight, 0))
+	return allocations, total, burnt, bags, nil
+}
+
+// openedBag is a bag a partial consumption was taken from, whose weight and
+// value left go to the next partial consumptions of its brand.
+type openedBag struct {
+	lot *purchaseLot
+	// unitPrice is the value of the whole bag when it was opened.
+	unitPrice Money
+	weight    Grams
+	bagWeight Grams
+	value     Money
+}
+
+// openingWeight returns the weight of the bag the next partial consumption is
+// taken from: the one left open or the next one the method picks.
+func (s *lotState) openingWeight(method CostingMethod, at time.Time) Grams {
+	if s.opened != nil && s.opened.weight > 0 {
+		return s.opened.bagWeight
+	}
+	if method == CostingAverage {
+		s.pool(at, 1)
+	}
+	if lot := s.pick(method, at); lot != nil {
+		return lot.weightPerBag
+	}
+	return 0
+}
+
+// takeOpened values weight against the opened bag, opening the bags picked
+// by the costing method as it empties. It returns the bags burnt, as a part
+// of a bag each, and the weight left once every bag is taken.
+func (s *lotState) takeOpened(method CostingMethod, at time.Time, weight Grams) ([]ConsumptionAllocation, Money, float64, Grams) {
+	var allocations []ConsumptionAllocation
+	var total Money
+	var bags float64
+	for weight > 0 {
+		if s.opened == nil || s.opened.weight <= 0 {
+			if !s.openBag(method, at) {
+				break
+			}
+		}
+		bag := s.opened
+		take, cost := min(weight, bag.weight), bag.value
+		if take < bag.weight {
+			cost = Money(int64(roundHalfEven(float64(bag.value) * float64(take) / float64(bag.weight))))
+		}
+		bag.weight -= take
+		bag.value -= cost
+		bag.lot.remainingWeight -= min(take, bag.lot.remainingWeight)
+		allocations = append(allocations, ConsumptionAllocation{
+			PurchaseID: bag.lot.id,
+			UnitPrice:  bag.unitPrice,
+			TotalPrice: cost,
+			WeightKg:   take.Kg(),
+		})
+		total += cost
+		bags += float64(take) / float64(bag.bagWeight)
+		weight -= take
+	}
+	return allocations, total, bags, weight
+}
+
+// openBag takes the next bag picked by the costing method out of its lot to
+// be burnt in parts. It reports false when no bag is left or when the bags
+// of the lot have no known weight.
+func (s *lotState) openBag(method CostingMethod, at time.Time) bool {
+	average := method == CostingAverage
+	if average {
+		s.pool(at, 1)
+	}
+	lot := s.pick(method, at)
+	if lot == nil || lot.weightPerBag <= 0 {
+		return false
+	}
+	lot.remaining--
+	price := lot.unitPrice
+	if average {
+		price = poolShare(s.pooledValue, s.pooledBags, 1)
+		s.pooledBags--
+		s.pooledValue -= price
+	}
+	s.opened = &openedBag{lot: lot, unitPrice: price, weight: lot.weightPerBag, bagWeight: lot.weightPerBag, value: price}
+	return true
+}
+
+// poolShare returns the value of bags out of a pool of poolBags worth value.
+func poolShare(value Money, poolBags, bags int) Money {
+	if poolBags <= 0 {
+		return 0
+	}
+	return Money(int64(roundHalfEven(float64(value) * float64(bags) / float64(poolBags))))
+}
+
+// pool adds to the average costing pool the lots bought up to at, then the
+// following ones while the pool holds fewer than bags, for consumptions
+// recorded before the purchase they come from.
+func (s *lotState) pool(at time.Time, bags int) {
+	for _, lot := range s.lots {
+		if lot.pooled || lot.bulk {
+			continue
+		}
+		if lot.purchasedAt.After(at) && s.pooledBags >= bags {
+			return
+		}
+		lot.pooled = true
+		s.pooledBags += lot.remaining
+		s.pooledValue += lot.unitPrice.MulInt(lot.remaining)
+	}
+}
+
+// pick returns the lot the next bag of a consumption made at is taken from.
+// FIFO takes the oldest lot; LIFO the latest one bought by then, falling
+// back to the oldest for consumptions recorded before their purchase; average
+// costing takes the oldest pooled lot, the price being that of the pool.
+func (s *lotState) pick(method CostingMethod, at time.Time) *purchaseLot {
+	oldest := s.nextLot()
+	if oldest == nil {
+		return nil
+	}
+	switch method {
+	case CostingLIFO:
+		var latest *purchaseLot
+		for _, lot := range s.lots[s.index:] {
+			if lot.remaining > 0 && !lot.purchasedAt.After(at) {
+				latest = lot
+			}
+		}
+		if latest != nil {
+			return latest
+		}
+	case CostingAverage:
+		for _, lot := range s.lots[s.index:] {
+			if lot.remaining > 0 && lot.pooled {
+				return lot
+			}
+		}
+		return nil
+	}
+	return oldest
+}
+
+// takeBulk values weight against the bulk lots, oldest first whatever the
+// costing method: a silo is filled on top of what is left and emptied from
+// the bottom. The weight exceeding the bulk lots is returned.
+func (s *lotState) takeBulk(weight Grams) ([]ConsumptionAllocation, Money, Grams) {
+	var allocations []ConsumptionAllocation
+	var total Money
+	for _, lot := range s.lots {
+		if weight <= 0 {
+			break
+		}
+		if !lot.bulk || lot.remainingWeight <= 0 {
+			continue
+		}
+		take := min(weight, lot.remainingWeight)
+		cost := WeightPrice(take, lot.pricePerTonne)
+		allocations = append(allocations, ConsumptionAllocation{
+			PurchaseID:    lot.id,
+			WeightKg:      take.Kg(),
+			PricePerTonne: lot.pricePerTonne,
+			TotalPrice:    cost,
+		})
+		total += cost
+		lot.remainingWeight -= take
+		weight -= take
+	}
+	return allocations, total, weight
+}
+
+// drainWeight removes weight from the oldest lots still holding some. Bags
+// rarely weigh exactly their nominal weight, so burning more than what is
+// left empties the stock instead of failing.
+func (s *lotState) drainWeight(weight Grams) {
+	for _, lot := range s.lots {
+		if weight <= 0 {
+			return
+		}
+		take := min(weight, lot.remainingWeight)
+		lot.remainingWeight -= take
+		weight -= take
+	}
+}
+
+// reclassify moves the lots recorded on a transfer to its target brand. The
+// moved bags keep their purchase date and price so they are consumed in order
+// among the lots of the target brand. With average costing they leave the
+// source pool at its average price and join the target pool at that price.
+func (t *lotTracker) reclassify(transfer Transfer) error {
+	source := t.states[transfer.BrandID]
+	average := t.method == CostingAverage
+	if average && source != nil {
+		source.pool(transfer.TransferredAt, 0)
+	}
+	for _, moved := range transfer.Lots {
+		lot := source.findLot(moved.PurchaseID)
+		if lot == nil || lot.remaining < moved.Bags {
+			return ErrInsufficientInventory
+		}
+		var value Money
+		if average {
+			if !lot.pooled {
+				lot.pooled = true
+				source.pooledBags += lot.remaining
+				source.pooledValue += lot.unitPrice.MulInt(lot.remaining)
+			}
+			value = poolShare(source.pooledValue, source.pooledBags, moved.Bags)
+			source.pooledBags -= moved.Bags
+			source.pooledValue -= value
+		}
+		lot.remaining -= moved.Bags
+		weight := min(lot.weightPerBag.MulInt(moved.Bags), lot.remainingWeight)
+		lot.remainingWeight -= weight
+
+		target := t.states[transfer.ToBrandID]
+		if target == nil {
+			target = &lotState{}
+			t.states[transfer.ToBrandID] = target
+		}
+		if average {
+			target.pooledBags += moved.Bags
+			target.pooledValue += value
+		}
+		if dest := target.findLot(lot.id); dest != nil {
+			dest.remaining += moved.Bags
+			dest.remainingWeight += weight
+			continue
+		}
+		dest := &purchaseLot{
+			id:              lot.id,
+			purchasedAt:     lot.purchasedAt,
+			unitPrice:       lot.unitPrice,
+			remaining:       moved.Bags,
+			weightPerBag:    lot.weightPerBag,
+			remainingWeight: weight,
+			pooled:          average,
+		}
+		pending := append(target.lots[target.index:len(target.lots):len(target.lots)], dest)
+		sort.SliceStable(pending, func(i, j int) bool { return pending[i].purchasedAt.Before(pending[j].purchasedAt) })
+		target.lots = append(target.lots[:target.index], pending...)
+	}
+	return nil
+}
 
-	return allocations, total, nil
+func (s *lotState) findLot(id ID) *purchaseLot {
+	if s == nil {
+		return nil
+	}
+	for _, lot := range s.lots[s.index:] {
+		if lot.id == id {
+			return lot
+		}
+	}
+	return nil
 }
 
-func (s *fifoState) nextLot() *purchaseLot {
+func (s *lotState) nextLot() *purchaseLot {
 	for s != nil && s.index < len(s.lots) {
 		lot := s.lots[s.index]
 		if lot.remaining > 0 {
@@ -312,27 +927,41 @@ func (s *fifoState) nextLot() *purchaseLot {
 	return nil
 }
 
-func (t *fifoTracker) inventorySummary(brands []Brand) InventorySummary {
+// inventorySummary sums the bags left in the lots bought up to asOf, every
+// lot when asOf is zero.
+func (t *lotTracker) inventorySummary(brands []Brand, asOf time.Time) InventorySummary {
 	brandNames := make(map[ID]string, len(brands))
 	for _, brand := range brands {
 		brandNames[brand.ID] = brand.Name
 	}
 
 	summary := InventorySummary{}
+	var totalWeight Grams
 	for brandID, state := range t.states {
 		var bags int
-		var weight float64
+		var weight Grams
 		var cost Money
 
 		if state != nil {
-			for idx := state.index; idx < len(state.lots); idx++ {
-				lot := state.lots[idx]
-				if lot.remaining <= 0 {
+			// Lots already emptied of their bags can still hold weight when
+			// consumptions were recorded by weight, so every lot is summed.
+			for _, lot := range state.lots {
+				if !withinRange(lot.purchasedAt, time.Time{}, asOf) {
 					continue
 				}
 				bags += lot.remaining
-				weight += float64(lot.remaining) * lot.weightPerBag
-				cost += lot.unitPrice.MulInt(lot.remaining)
+				weight += lot.remainingWeight
+				switch {
+				case lot.bulk:
+					cost += WeightPrice(lot.remainingWeight, lot.pricePerTonne)
+				case !lot.pooled:
+					cost += lot.unitPrice.MulInt(lot.remaining)
+				}
+			}
+			// With average costing the pooled bags are worth the pool value.
+			cost += state.pooledValue
+			if bag := state.opened; bag != nil && withinRange(bag.lot.purchasedAt, time.Time{}, asOf) {
+				cost += bag.value
 			}
 		}
 
@@ -344,13 +973,14 @@ func (t *fifoTracker) inventorySummary(brands []Brand) InventorySummary {
 			BrandID:   brandID,
 			BrandName: brandNames[brandID],
 			Bags:      bags,
-			WeightKg:  weight,
+			WeightKg:  weight.Kg(),
 			TotalCost: cost,
 		})
 		summary.TotalBags += bags
-		summary.TotalWeightKg += weight
+		totalWeight += weight
 		summary.TotalCost += cost
 	}
+	summary.TotalWeightKg = totalWeight.Kg()
 
 	sort.Slice(summary.Brands, func(i, j int) bool {
 		if summary.Brands[i].BrandName == summary.Brands[j].BrandName {
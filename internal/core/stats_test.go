@@ -1,6 +1,7 @@
 package core_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -23,6 +24,8 @@ func TestComputeInvesti(t *testing.T) {
 	}
 
 	ds := sampleDataStore(t)
+	archived := sampleDataStore(t)
+	archived.SeasonArchives = []core.SeasonArchive{{StartYear: 2020, Purchases: 2, BagsBought: 10, Spent: 5000}}
 
 	tcs := []struct {
 		name   string
@@ -47,6 +50,19 @@ func TestComputeInvesti(t *testing.T) {
 			},
 			want: want{total: core.Money(3 * 600)},
 		},
+		{
+			name:   "counts the archived seasons",
+			params: params{datastore: archived},
+			want:   want{total: core.Money(5000 + 5*550 + 3*600)},
+		},
+		{
+			name: "skips the archived seasons partly in range",
+			params: params{
+				datastore: archived,
+				from:      time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+			},
+			want: want{total: core.Money(5*550 + 3*600)},
+		},
 	}
 
 	for _, tc := range tcs {
@@ -65,15 +81,36 @@ func TestComputeConsoValue(t *testing.T) {
 
 	type params struct {
 		datastore core.DataStore
+		method    core.CostingMethod
 		from      time.Time
 		to        time.Time
 	}
 	type want struct {
-		total core.Money
+		total   core.Money
+		blended []core.Money
 	}
 
 	ds := sampleDataStore(t)
 
+	acrossLots := sampleDataStore(t)
+	_, err := core.AddConsumption(&acrossLots, core.CreateConsumptionParams{
+		BrandID:    acrossLots.Brands[0].ID,
+		ConsumedAt: time.Date(2024, time.February, 25, 0, 0, 0, 0, time.UTC),
+		Bags:       4,
+	})
+	require.NoError(t, err, "seed consumption across lots")
+
+	partial := sampleDataStore(t)
+	for i, fraction := range []float64{0.5, 0.5} {
+		_, err = core.AddConsumption(&partial, core.CreateConsumptionParams{
+			BrandID:      partial.Brands[0].ID,
+			ConsumedAt:   time.Date(2024, time.February, 25+i, 0, 0, 0, 0, time.UTC),
+			Bags:         1 - i,
+			BagsFraction: fraction,
+		})
+		require.NoError(t, err, "seed partial consumption")
+	}
+
 	tcs := []struct {
 		name   string
 		params params
@@ -86,7 +123,41 @@ func TestComputeConsoValue(t *testing.T) {
 				from:      time.Time{},
 				to:        time.Time{},
 			},
-			want: want{total: core.Money(2 * 550)},
+			want: want{total: core.Money(2 * 550), blended: []core.Money{550}},
+		},
+		{
+			name: "blends the price of lots bought at different prices",
+			params: params{
+				datastore: acrossLots,
+			},
+			// 3 bags at 5.50 and 1 at 6.00: 22.50 for 4 bags, 5.625 rounded half to even.
+			want: want{total: core.Money(2*550 + 3*550 + 600), blended: []core.Money{550, 562}},
+		},
+		{
+			name: "takes the latest lots with LIFO",
+			params: params{
+				datastore: acrossLots,
+				method:    core.CostingLIFO,
+			},
+			// 2 bags of the February lot, then its last bag and 3 of January.
+			want: want{total: core.Money(2*600 + 600 + 3*550), blended: []core.Money{600, 562}},
+		},
+		{
+			name: "values the bags at the average price of the stock",
+			params: params{
+				datastore: acrossLots,
+				method:    core.CostingAverage,
+			},
+			// 2 of 8 bags worth 45.50, then 4 of the 6 bags left worth 34.12.
+			want: want{total: core.Money(1138 + 2275), blended: []core.Money{569, 569}},
+		},
+		{
+			name: "values the part of an opened bag",
+			params: params{
+				datastore: partial,
+			},
+			// 1.5 bags opens a third January bag, the next half bag finishes it.
+			want: want{total: core.Money(2*550 + 550 + 275 + 275), blended: []core.Money{550, 550, 550}},
 		},
 	}
 
@@ -95,9 +166,14 @@ func TestComputeConsoValue(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
 
-			total, _, err := core.ComputeConsoValue(&tc.params.datastore, tc.params.from, tc.params.to)
+			total, details, err := core.ComputeConsoValue(context.Background(), &tc.params.datastore, tc.params.method, tc.params.from, tc.params.to)
 			require.NoError(t, err, tc.name)
 			assert.Equal(t, tc.want.total, total, tc.name)
+			var blended []core.Money
+			for _, detail := range details {
+				blended = append(blended, detail.BlendedBagPrice)
+			}
+			assert.Equal(t, tc.want.blended, blended, tc.name)
 		})
 	}
 }
@@ -107,8 +183,48 @@ func TestComputeInventaire(t *testing.T) {
 
 	ds := sampleDataStore(t)
 
+	reclassified := sampleDataStore(t)
+	granules := reclassified.Brands[0]
+	pro, err := core.AddBrand(&reclassified, core.CreateBrandParams{Name: "Pellets Pro"})
+	require.NoError(t, err, "seed second brand")
+	_, err = core.AddTransfer(&reclassified, core.CreateTransferParams{
+		BrandID:       granules.ID,
+		ToBrandID:     pro.ID,
+		Bags:          2,
+		TransferredAt: time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC),
+	})
+	require.NoError(t, err, "seed reclassification")
+
+	weighed := sampleDataStore(t)
+	weighed.Consumptions[0].WeightKg = 29.35
+
+	partial := sampleDataStore(t)
+	partial.Consumptions = append(partial.Consumptions, core.Consumption{
+		Meta:       core.Meta{ID: core.NewID()},
+		BrandID:    partial.Brands[0].ID,
+		ConsumedAt: time.Date(2024, time.February, 21, 0, 0, 0, 0, time.UTC),
+		WeightKg:   7.5,
+	})
+
+	silo := sampleDataStore(t)
+	silo.Purchases = append(silo.Purchases, core.Purchase{
+		Meta:               core.Meta{ID: core.NewID()},
+		BrandID:            silo.Brands[0].ID,
+		PurchasedAt:        time.Date(2024, time.January, 20, 0, 0, 0, 0, time.UTC),
+		TotalWeightKg:      1000,
+		PricePerTonneCents: 35000,
+		TotalPriceCents:    35000,
+	})
+	silo.Consumptions = append(silo.Consumptions, core.Consumption{
+		Meta:       core.Meta{ID: core.NewID()},
+		BrandID:    silo.Brands[0].ID,
+		ConsumedAt: time.Date(2024, time.February, 21, 0, 0, 0, 0, time.UTC),
+		WeightKg:   200,
+	})
+
 	type params struct {
 		datastore core.DataStore
+		method    core.CostingMethod
 	}
 	type want struct {
 		summary core.InventorySummary
@@ -137,6 +253,134 @@ func TestComputeInventaire(t *testing.T) {
 				},
 			}},
 		},
+		{
+			name:   "decrements the recorded weight to the gram",
+			params: params{datastore: weighed},
+			want: want{summary: core.InventorySummary{
+				TotalBags:     6,
+				TotalWeightKg: 90.65,
+				TotalCost:     core.Money(3*600 + 3*550),
+				Brands: []core.BrandInventory{
+					{
+						BrandID:   weighed.Brands[0].ID,
+						BrandName: weighed.Brands[0].Name,
+						Bags:      6,
+						WeightKg:  90.65,
+						TotalCost: core.Money(3*600 + 3*550),
+					},
+				},
+			}},
+		},
+		{
+			name:   "counts consumptions recorded by weight only",
+			params: params{datastore: partial},
+			// The 7.5 kg are taken from an opened bag of 15 kg, whose other
+			// half is left at half its price.
+			want: want{summary: core.InventorySummary{
+				TotalBags:     5,
+				TotalWeightKg: 82.5,
+				TotalCost:     core.Money(3*600 + 2*550 + 275),
+				Brands: []core.BrandInventory{
+					{
+						BrandID:   partial.Brands[0].ID,
+						BrandName: partial.Brands[0].Name,
+						Bags:      5,
+						WeightKg:  82.5,
+						TotalCost: core.Money(3*600 + 2*550 + 275),
+					},
+				},
+			}},
+		},
+		{
+			name:   "values bulk lots by the tonne",
+			params: params{datastore: silo, method: core.CostingLIFO},
+			// Bulk lots are burnt by weight, first in first out, whatever
+			// the method: 800 kg are left at 350 € per tonne.
+			want: want{summary: core.InventorySummary{
+				TotalBags:     6,
+				TotalWeightKg: 6*15 + 800,
+				TotalCost:     core.Money(5*550 + 600 + 28000),
+				Brands: []core.BrandInventory{
+					{
+						BrandID:   silo.Brands[0].ID,
+						BrandName: silo.Brands[0].Name,
+						Bags:      6,
+						WeightKg:  6*15 + 800,
+						TotalCost: core.Money(5*550 + 600 + 28000),
+					},
+				},
+			}},
+		},
+		{
+			name:   "follows reclassified lots",
+			params: params{datastore: reclassified},
+			want: want{summary: core.InventorySummary{
+				TotalBags:     6,
+				TotalWeightKg: 6 * 15,
+				TotalCost:     core.Money(3*600 + 550 + 2*550),
+				Brands: []core.BrandInventory{
+					{
+						BrandID:   granules.ID,
+						BrandName: granules.Name,
+						Bags:      4,
+						WeightKg:  4 * 15,
+						TotalCost: core.Money(3*600 + 550),
+					},
+					{
+						BrandID:   pro.ID,
+						BrandName: pro.Name,
+						Bags:      2,
+						WeightKg:  2 * 15,
+						TotalCost: core.Money(2 * 550),
+					},
+				},
+			}},
+		},
+		{
+			name:   "keeps the oldest lots with LIFO",
+			params: params{datastore: ds, method: core.CostingLIFO},
+			want: want{summary: core.InventorySummary{
+				TotalBags:     6,
+				TotalWeightKg: 6 * 15,
+				TotalCost:     core.Money(5*550 + 600),
+				Brands: []core.BrandInventory{
+					{
+						BrandID:   ds.Brands[0].ID,
+						BrandName: ds.Brands[0].Name,
+						Bags:      6,
+						WeightKg:  6 * 15,
+						TotalCost: core.Money(5*550 + 600),
+					},
+				},
+			}},
+		},
+		{
+			name:   "values reclassified bags at the average price",
+			params: params{datastore: reclassified, method: core.CostingAverage},
+			// 2 of the 5 January bags move at 5.50; the 2 bags burnt in
+			// February cost a third of the 6 bags left, worth 34.50.
+			want: want{summary: core.InventorySummary{
+				TotalBags:     6,
+				TotalWeightKg: 6 * 15,
+				TotalCost:     core.Money(2300 + 1100),
+				Brands: []core.BrandInventory{
+					{
+						BrandID:   granules.ID,
+						BrandName: granules.Name,
+						Bags:      4,
+						WeightKg:  4 * 15,
+						TotalCost: core.Money(2300),
+					},
+					{
+						BrandID:   pro.ID,
+						BrandName: pro.Name,
+						Bags:      2,
+						WeightKg:  2 * 15,
+						TotalCost: core.Money(1100),
+					},
+				},
+			}},
+		},
 	}
 
 	for _, tc := range tcs {
@@ -144,18 +388,106 @@ func TestComputeInventaire(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
 
-			summary, err := core.ComputeInventaire(&tc.params.datastore)
+			summary, err := core.ComputeInventaire(context.Background(), &tc.params.datastore, tc.params.method)
 			require.NoError(t, err, tc.name)
 			assert.Equal(t, tc.want.summary, summary, tc.name)
 		})
 	}
 }
 
+func TestComputeInventaireAu(t *testing.T) {
+	t.Parallel()
+
+	ds := sampleDataStore(t)
+
+	early := sampleDataStore(t)
+	early.Consumptions = append(early.Consumptions, core.Consumption{
+		Meta:       core.Meta{ID: core.NewID()},
+		BrandID:    early.Brands[0].ID,
+		ConsumedAt: time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC),
+		Bags:       1,
+	})
+
+	type params struct {
+		datastore core.DataStore
+		asOf      time.Time
+	}
+	type want struct {
+		bags int
+		cost core.Money
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "reports the current inventory without date",
+			params: params{datastore: ds},
+			want:   want{bags: 6, cost: core.Money(3*550 + 3*600)},
+		},
+		{
+			name:   "ignores the purchases made later",
+			params: params{datastore: ds, asOf: time.Date(2024, time.January, 31, 0, 0, 0, 0, time.UTC)},
+			want:   want{bags: 5, cost: core.Money(5 * 550)},
+		},
+		{
+			name:   "ignores the consumptions made later",
+			params: params{datastore: ds, asOf: time.Date(2024, time.February, 10, 0, 0, 0, 0, time.UTC)},
+			want:   want{bags: 8, cost: core.Money(5*550 + 3*600)},
+		},
+		{
+			name:   "is empty before the first purchase",
+			params: params{datastore: ds, asOf: time.Date(2023, time.December, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:   "replays consumptions recorded before their purchase",
+			params: params{datastore: early, asOf: time.Date(2024, time.January, 6, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			summary, err := core.ComputeInventaireAu(context.Background(), &tc.params.datastore, core.CostingFIFO, tc.params.asOf)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.bags, summary.TotalBags, tc.name)
+			assert.Equal(t, tc.want.cost, summary.TotalCost, tc.name)
+		})
+	}
+}
+
 func TestComputeSacsParMois(t *testing.T) {
 	t.Parallel()
 
 	ds := sampleDataStore(t)
 
+	multiYear := core.DataStore{}
+	brand, err := core.AddBrand(&multiYear, core.CreateBrandParams{Name: "Brand"})
+	require.NoError(t, err, "seed brand")
+	_, err = core.AddPurchase(&multiYear, core.CreatePurchaseParams{
+		BrandID:     brand.ID,
+		PurchasedAt: time.Date(2022, time.October, 1, 0, 0, 0, 0, time.UTC),
+		Bags:        50,
+		BagWeightKg: 15,
+		UnitPrice:   core.Money(500),
+	})
+	require.NoError(t, err, "seed purchase")
+	for _, c := range []struct {
+		at   time.Time
+		bags int
+	}{
+		{at: time.Date(2023, time.January, 10, 0, 0, 0, 0, time.UTC), bags: 4},
+		{at: time.Date(2024, time.February, 3, 0, 0, 0, 0, time.UTC), bags: 5},
+		{at: time.Date(2025, time.February, 12, 0, 0, 0, 0, time.UTC), bags: 3},
+	} {
+		_, err = core.AddConsumption(&multiYear, core.CreateConsumptionParams{BrandID: brand.ID, ConsumedAt: c.at, Bags: c.bags})
+		require.NoError(t, err, "seed consumption")
+	}
+
 	type params struct {
 		datastore core.DataStore
 		from      time.Time
@@ -178,9 +510,26 @@ func TestComputeSacsParMois(t *testing.T) {
 				to:        time.Time{},
 			},
 			want: want{points: []core.MonthlyBags{{
-				Month: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
-				Bags:  2,
+				Month:    time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+				Bags:     2,
+				WeightKg: 30,
 			}}}},
+		{
+			name: "adds same month of prior years outside the range",
+			params: params{
+				datastore: multiYear,
+				from:      time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC),
+			},
+			want: want{points: []core.MonthlyBags{{
+				Month:    time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC),
+				Bags:     3,
+				WeightKg: 45,
+				PriorYears: []core.YearBags{
+					{Year: 2023, Bags: 0},
+					{Year: 2024, Bags: 5, WeightKg: 75},
+				},
+			}}},
+		},
 	}
 
 	for _, tc := range tcs {
@@ -188,13 +537,81 @@ func TestComputeSacsParMois(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
 
-			points, err := core.ComputeSacsParMois(&tc.params.datastore, tc.params.from, tc.params.to)
+			points, err := core.ComputeSacsParMois(context.Background(), &tc.params.datastore, tc.params.from, tc.params.to)
 			require.NoError(t, err, tc.name)
 			assert.Equal(t, tc.want.points, points, tc.name)
 		})
 	}
 }
 
+func TestComputeSacsParPuissance(t *testing.T) {
+	t.Parallel()
+
+	ds := core.DataStore{}
+	brand, err := core.AddBrand(&ds, core.CreateBrandParams{Name: "Brand"})
+	require.NoError(t, err, "seed brand")
+	for _, c := range []struct {
+		at    time.Time
+		bags  int
+		level int
+	}{
+		{at: time.Date(2024, time.January, 10, 8, 0, 0, 0, time.UTC), bags: 1, level: 3},
+		{at: time.Date(2024, time.January, 10, 20, 0, 0, 0, time.UTC), bags: 1, level: 3},
+		{at: time.Date(2024, time.January, 11, 0, 0, 0, 0, time.UTC), bags: 1, level: 3},
+		{at: time.Date(2024, time.January, 12, 0, 0, 0, 0, time.UTC), bags: 3, level: 5},
+		{at: time.Date(2024, time.January, 13, 0, 0, 0, 0, time.UTC), bags: 4},
+	} {
+		_, err = core.AddConsumption(&ds, core.CreateConsumptionParams{BrandID: brand.ID, ConsumedAt: c.at, Bags: c.bags, PowerLevel: c.level})
+		require.NoError(t, err, "seed consumption")
+	}
+
+	type params struct {
+		datastore core.DataStore
+		from      time.Time
+		to        time.Time
+	}
+	type want struct {
+		usage []core.PowerLevelUsage
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "averages bags per day for tagged consumptions",
+			params: params{datastore: ds},
+			want: want{usage: []core.PowerLevelUsage{
+				{PowerLevel: 3, Days: 2, Bags: 3, BagsPerDay: 1.5},
+				{PowerLevel: 5, Days: 1, Bags: 3, BagsPerDay: 3},
+			}},
+		},
+		{
+			name:   "filters by range",
+			params: params{datastore: ds, from: time.Date(2024, time.January, 12, 0, 0, 0, 0, time.UTC)},
+			want: want{usage: []core.PowerLevelUsage{
+				{PowerLevel: 5, Days: 1, Bags: 3, BagsPerDay: 3},
+			}},
+		},
+		{
+			name:   "empty without tagged consumptions",
+			params: params{datastore: sampleDataStore(t)},
+			want:   want{usage: []core.PowerLevelUsage{}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			usage := core.ComputeSacsParPuissance(&tc.params.datastore, tc.params.from, tc.params.to)
+			assert.Equal(t, tc.want.usage, usage, tc.name)
+		})
+	}
+}
+
 func TestComputeCoutMoyenParSac(t *testing.T) {
 	t.Parallel()
 
@@ -202,6 +619,7 @@ func TestComputeCoutMoyenParSac(t *testing.T) {
 
 	type params struct {
 		datastore core.DataStore
+		method    core.CostingMethod
 	}
 	type want struct {
 		average core.Money
@@ -217,6 +635,16 @@ func TestComputeCoutMoyenParSac(t *testing.T) {
 			params: params{datastore: ds},
 			want:   want{average: core.Money(550)},
 		},
+		{
+			name:   "averages the LIFO cost",
+			params: params{datastore: ds, method: core.CostingLIFO},
+			want:   want{average: core.Money(600)},
+		},
+		{
+			name:   "averages the weighted average cost",
+			params: params{datastore: ds, method: core.CostingAverage},
+			want:   want{average: core.Money(569)},
+		},
 	}
 
 	for _, tc := range tcs {
@@ -224,13 +652,177 @@ func TestComputeCoutMoyenParSac(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
 
-			avg, err := core.ComputeCoutMoyenParSac(&tc.params.datastore, time.Time{}, time.Time{})
+			avg, err := core.ComputeCoutMoyenParSac(context.Background(), &tc.params.datastore, tc.params.method, time.Time{}, time.Time{})
 			require.NoError(t, err, tc.name)
 			assert.Equal(t, tc.want.average, avg, tc.name)
 		})
 	}
 }
 
+func TestComputeCoutMoyenParTonne(t *testing.T) {
+	t.Parallel()
+
+	ds := sampleDataStore(t)
+	// Smaller bags cost less each but about as much per kilogram.
+	small := sampleDataStore(t)
+	_, err := core.AddPurchase(&small, core.CreatePurchaseParams{
+		BrandID:     small.Brands[0].ID,
+		PurchasedAt: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+		Bags:        4,
+		BagWeightKg: 10,
+		UnitPrice:   core.Money(450),
+	})
+	require.NoError(t, err, "seed small bags")
+	_, err = core.AddConsumption(&small, core.CreateConsumptionParams{
+		BrandID:    small.Brands[0].ID,
+		ConsumedAt: time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC),
+		Bags:       7,
+	})
+	require.NoError(t, err, "seed small bags consumption")
+
+	type params struct {
+		datastore core.DataStore
+		method    core.CostingMethod
+		from      time.Time
+	}
+	type want struct {
+		perTonne core.Money
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "averages the cost per tonne",
+			params: params{datastore: ds},
+			want:   want{perTonne: core.Money(36667)},
+		},
+		{
+			name:   "weighs the bags of every size",
+			params: params{datastore: small, from: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)},
+			want:   want{perTonne: core.Money(39000)},
+		},
+		{
+			name:   "is zero without consumption",
+			params: params{datastore: ds, from: time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			perTonne, err := core.ComputeCoutMoyenParTonne(context.Background(), &tc.params.datastore, tc.params.method, tc.params.from, time.Time{})
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.perTonne, perTonne, tc.name)
+		})
+	}
+}
+
+func TestComputeStockKgParMois(t *testing.T) {
+	t.Parallel()
+
+	ds := sampleDataStore(t)
+	month := func(year int, m time.Month) time.Time { return time.Date(year, m, 1, 0, 0, 0, 0, time.UTC) }
+
+	type params struct {
+		from time.Time
+		to   time.Time
+	}
+	type want struct {
+		stock []core.MonthlyStock
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "follows the stock from the first purchase",
+			want: want{stock: []core.MonthlyStock{
+				{Month: month(2024, time.January), WeightKg: 75},
+				{Month: month(2024, time.February), WeightKg: 90},
+			}},
+		},
+		{
+			name:   "carries the stock over the months without change",
+			params: params{from: month(2024, time.February), to: time.Date(2024, time.April, 15, 0, 0, 0, 0, time.UTC)},
+			want: want{stock: []core.MonthlyStock{
+				{Month: month(2024, time.February), WeightKg: 90},
+				{Month: month(2024, time.March), WeightKg: 90},
+				{Month: month(2024, time.April), WeightKg: 90},
+			}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			stock, err := core.ComputeStockKgParMois(context.Background(), &ds, tc.params.from, tc.params.to)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.stock, stock, tc.name)
+		})
+	}
+}
+
+func TestComputeCancellation(t *testing.T) {
+	t.Parallel()
+
+	ds := sampleDataStore(t)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+
+	type params struct {
+		ctx     context.Context
+		compute func(ctx context.Context) error
+	}
+	type want struct {
+		err error
+	}
+
+	inventory := func(ctx context.Context) error {
+		_, err := core.ComputeInventaire(ctx, &ds, core.CostingFIFO)
+		return err
+	}
+	byLocation := func(ctx context.Context) error {
+		_, err := core.ComputeInventaireParEmplacement(ctx, &ds)
+		return err
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "fifo completes with live context", params: params{ctx: context.Background(), compute: inventory}},
+		{name: "fifo stops when cancelled", params: params{ctx: cancelled, compute: inventory}, want: want{err: context.Canceled}},
+		{name: "fifo stops past deadline", params: params{ctx: expired, compute: inventory}, want: want{err: context.DeadlineExceeded}},
+		{name: "locations stop when cancelled", params: params{ctx: cancelled, compute: byLocation}, want: want{err: context.Canceled}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.params.compute(tc.params.ctx)
+			if tc.want.err != nil {
+				assert.ErrorIs(t, err, tc.want.err, tc.name)
+				return
+			}
+			assert.NoError(t, err, tc.name)
+		})
+	}
+}
+
 func sampleDataStore(t *testing.T) core.DataStore {
 	t.Helper()
 
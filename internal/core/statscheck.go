@@ -0,0 +1,124 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Codes of the StatsWarning raised by CheckStats.
+const (
+	// StatsWarningNegativeInventory flags stock left with a negative value,
+	// weight or bag count.
+	StatsWarningNegativeInventory = "negative_inventory"
+	// StatsWarningAverageAbovePrices flags an average cost per bag consumed
+	// above every price paid for a bag.
+	StatsWarningAverageAbovePrices = "average_above_prices"
+	// StatsWarningWeightMismatch flags a purchase whose total weight is not
+	// its bags times their weight, or a stock heavier than what was bought.
+	StatsWarningWeightMismatch = "weight_mismatch"
+)
+
+// StatsWarning reports a derived figure consistent entries cannot produce,
+// the sign of a corrupted datastore rather than of a real situation.
+type StatsWarning struct {
+	Code       string `json:"code"`
+	BrandID    ID     `json:"brand_id,omitempty"`
+	PurchaseID ID     `json:"purchase_id,omitempty"`
+	Message    string `json:"message"`
+}
+
+// CheckStats checks the inventory computed at to and the average cost per
+// bag consumed between from and to against the entries of ds, returning the
+// figures that cannot be right.
+func CheckStats(ds *DataStore, inventory InventorySummary, averageBagCost Money, from, to time.Time) []StatsWarning {
+	if ds == nil {
+		return nil
+	}
+	var warnings []StatsWarning
+
+	if inventory.TotalCost < 0 {
+		warnings = append(warnings, StatsWarning{
+			Code:    StatsWarningNegativeInventory,
+			Message: fmt.Sprintf("inventory is valued at %s", FormatMoney(inventory.TotalCost)),
+		})
+	}
+	for _, brand := range inventory.Brands {
+		if brand.TotalCost >= 0 && brand.Bags >= 0 && brand.WeightKg >= 0 {
+			continue
+		}
+		warnings = append(warnings, StatsWarning{
+			Code:    StatsWarningNegativeInventory,
+			BrandID: brand.BrandID,
+			Message: fmt.Sprintf("inventory of %s holds %d bags and %.3f kg valued at %s", brand.BrandName, brand.Bags, brand.WeightKg, FormatMoney(brand.TotalCost)),
+		})
+	}
+
+	if averageBagCost > 0 {
+		highest, priced := highestBagPrice(ds, from, to)
+		// A cent of rounding is left to the shares of the average costing.
+		if !priced || averageBagCost > highest+1 {
+			warnings = append(warnings, StatsWarning{
+				Code:    StatsWarningAverageAbovePrices,
+				Message: fmt.Sprintf("average cost per bag %s is above the highest bag price %s", FormatMoney(averageBagCost), FormatMoney(highest)),
+			})
+		}
+	}
+
+	var bought Grams
+	for _, purchase := range ds.Purchases {
+		if withinRange(purchase.PurchasedAt, time.Time{}, to) {
+			if purchase.IsBulk() {
+				bought += GramsFromKg(purchase.TotalWeightKg)
+			} else if purchase.Bags > 0 {
+				bought += purchaseBagWeight(purchase).MulInt(purchase.Bags)
+			}
+		}
+		if purchase.Bags <= 0 || purchase.BagWeightKg <= 0 || purchase.TotalWeightKg <= 0 {
+			continue
+		}
+		// The bag weight derived from the total is rounded to the gram.
+		gap := GramsFromKg(purchase.BagWeightKg).MulInt(purchase.Bags) - GramsFromKg(purchase.TotalWeightKg)
+		if math.Abs(float64(gap)) > float64(purchase.Bags) {
+			warnings = append(warnings, StatsWarning{
+				Code:       StatsWarningWeightMismatch,
+				BrandID:    purchase.BrandID,
+				PurchaseID: purchase.ID,
+				Message:    fmt.Sprintf("purchase of %d bags of %.3f kg weighs %.3f kg in total", purchase.Bags, purchase.BagWeightKg, purchase.TotalWeightKg),
+			})
+		}
+	}
+	if GramsFromKg(inventory.TotalWeightKg) > bought+1 {
+		warnings = append(warnings, StatsWarning{
+			Code:    StatsWarningWeightMismatch,
+			Message: fmt.Sprintf("inventory weighs %.3f kg, more than the %.3f kg bought", inventory.TotalWeightKg, bought.Kg()),
+		})
+	}
+	return warnings
+}
+
+// highestBagPrice returns the highest price paid for a bag, and whether any
+// bag was priced. The seasons archived within the range only keep averages,
+// which stand for their prices.
+func highestBagPrice(ds *DataStore, from, to time.Time) (Money, bool) {
+	var highest Money
+	priced := false
+	for _, purchase := range ds.Purchases {
+		if purchase.Bags <= 0 {
+			continue
+		}
+		priced = true
+		highest = max(highest, purchase.UnitPriceCents)
+	}
+	for _, archive := range archivedWithin(ds, from, to) {
+		if archive.BagsConsumed > 0 {
+			priced = true
+			highest = max(highest, archive.ConsumedValue.DivBags(archive.BagsConsumed))
+		}
+		if archive.BagsBought > 0 {
+			priced = true
+			highest = max(highest, archive.Spent.DivInt(archive.BagsBought))
+		}
+	}
+	return highest, priced
+}
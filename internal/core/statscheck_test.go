@@ -0,0 +1,99 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestCheckStats(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2024, time.November, 1, 0, 0, 0, 0, time.UTC)
+	purchase := core.Purchase{Meta: core.Meta{ID: "p1"}, BrandID: "b1", PurchasedAt: at, Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 600, TotalPriceCents: 6000}
+
+	type params struct {
+		ds core.DataStore
+		// inventory replaces the inventory computed from ds when set.
+		inventory *core.InventorySummary
+		// average replaces the average cost per bag computed from ds when set.
+		average *core.Money
+	}
+	type want struct {
+		codes []string
+	}
+
+	negative := core.InventorySummary{TotalCost: -600, Brands: []core.BrandInventory{{BrandID: "b1", BrandName: "Woodstock", Bags: -1, WeightKg: -15, TotalCost: -600}}}
+	tooHigh := core.Money(900)
+	heavy := core.InventorySummary{TotalBags: 10, TotalWeightKg: 300, TotalCost: 6000}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "accepts consistent entries",
+			params: params{ds: core.DataStore{
+				Brands:       []core.Brand{{Meta: core.Meta{ID: "b1"}, Name: "Woodstock"}},
+				Purchases:    []core.Purchase{purchase},
+				Consumptions: []core.Consumption{{Meta: core.Meta{ID: "c1"}, BrandID: "b1", ConsumedAt: at.AddDate(0, 0, 1), Bags: 2, BagsFraction: 0.5}},
+			}},
+		},
+		{
+			name:   "flags a negative inventory",
+			params: params{ds: core.DataStore{Purchases: []core.Purchase{purchase}}, inventory: &negative},
+			want:   want{codes: []string{core.StatsWarningNegativeInventory, core.StatsWarningNegativeInventory}},
+		},
+		{
+			name:   "flags an average above every price",
+			params: params{ds: core.DataStore{Purchases: []core.Purchase{purchase}}, average: &tooHigh},
+			want:   want{codes: []string{core.StatsWarningAverageAbovePrices}},
+		},
+		{
+			name: "flags a purchase weighing more than its bags",
+			params: params{ds: core.DataStore{Purchases: []core.Purchase{
+				{Meta: core.Meta{ID: "p2"}, BrandID: "b1", PurchasedAt: at, Bags: 10, BagWeightKg: 15, TotalWeightKg: 200, UnitPriceCents: 600},
+			}}},
+			want: want{codes: []string{core.StatsWarningWeightMismatch}},
+		},
+		{
+			name:   "flags a stock heavier than the purchases",
+			params: params{ds: core.DataStore{Purchases: []core.Purchase{purchase}}, inventory: &heavy},
+			want:   want{codes: []string{core.StatsWarningWeightMismatch}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := tc.params.ds
+			inventory, err := core.ComputeInventaire(context.Background(), &ds, core.CostingFIFO)
+			require.NoError(t, err, tc.name)
+			if tc.params.inventory != nil {
+				inventory = *tc.params.inventory
+			}
+			average, err := core.ComputeCoutMoyenParSac(context.Background(), &ds, core.CostingFIFO, time.Time{}, time.Time{})
+			require.NoError(t, err, tc.name)
+			if tc.params.average != nil {
+				average = *tc.params.average
+			}
+
+			warnings := core.CheckStats(&ds, inventory, average, time.Time{}, time.Time{})
+
+			var codes []string
+			for _, warning := range warnings {
+				codes = append(codes, warning.Code)
+				assert.NotEmpty(t, warning.Message, tc.name)
+			}
+			assert.Equal(t, tc.want.codes, codes, tc.name)
+		})
+	}
+}
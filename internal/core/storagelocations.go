@@ -0,0 +1,157 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// StorageLocationParams contains the fields of a declared storage location.
+type StorageLocationParams struct {
+	Name  string
+	Notes string
+}
+
+// AddStorageLocation declares a storage location, such as a garage, a
+// cellar or a shed, so it is offered in the forms before any bag is put in
+// it. A name already used by purchases keeps their spelling.
+func AddStorageLocation(ds *DataStore, params StorageLocationParams) (StorageLocation, error) {
+	if ds == nil {
+		return StorageLocation{}, errors.New("nil datastore")
+	}
+
+	name := NormalizeName(params.Name)
+	if errs := validateStorageLocationInput(ds, name, ""); len(errs) > 0 {
+		return StorageLocation{}, errs
+	}
+
+	now := time.Now().UTC()
+	location := StorageLocation{
+		Meta: Meta{
+			ID:        NewID(),
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		Name:  canonicalLocation(ds, name),
+		Notes: strings.TrimSpace(params.Notes),
+	}
+	ds.StorageLocations = append(ds.StorageLocations, location)
+	touchDatastore(ds, now)
+
+	return location, nil
+}
+
+// UpdateStorageLocation changes the notes of a storage location or renames
+// it. A rename is applied to the purchases, transfers and silo stored at the
+// former name, so the stock stays in the same place.
+func UpdateStorageLocation(ds *DataStore, id ID, params StorageLocationParams) (StorageLocation, error) {
+	if ds == nil {
+		return StorageLocation{}, errors.New("nil datastore")
+	}
+
+	idx := findStorageLocationIndex(ds.StorageLocations, id)
+	if idx == -1 {
+		return StorageLocation{}, ErrStorageLocationNotFound
+	}
+
+	name := NormalizeName(params.Name)
+	location := ds.StorageLocations[idx]
+	if errs := validateStorageLocationInput(ds, name, location.Name); len(errs) > 0 {
+		return StorageLocation{}, errs
+	}
+
+	now := time.Now().UTC()
+	if name != location.Name {
+		renameLocation(ds, location.Name, name, now)
+		location.Name = name
+	}
+	location.Notes = strings.TrimSpace(params.Notes)
+	location.touch(now)
+	ds.StorageLocations[idx] = location
+	touchDatastore(ds, now)
+
+	return location, nil
+}
+
+// DeleteStorageLocation removes a declared storage location. The purchases
+// and transfers recorded there keep their location, which stays listed as
+// long as they do.
+func DeleteStorageLocation(ds *DataStore, id ID) error {
+	if ds == nil {
+		return errors.New("nil datastore")
+	}
+	idx := findStorageLocationIndex(ds.StorageLocations, id)
+	if idx == -1 {
+		return ErrStorageLocationNotFound
+	}
+
+	ds.StorageLocations = append(ds.StorageLocations[:idx], ds.StorageLocations[idx+1:]...)
+	touchDatastore(ds, time.Now().UTC())
+	return nil
+}
+
+// validateStorageLocationInput checks name is set and not declared twice;
+// current is the name of the location being updated, so it can keep it or
+// change its case.
+func validateStorageLocationInput(ds *DataStore, name, current string) ValidationErrors {
+	errs := ValidationErrors{}
+	errs = errs.AppendIf(name == "", "name", "name is required")
+	if name == "" || strings.EqualFold(name, current) {
+		return errs
+	}
+	for _, location := range ds.StorageLocations {
+		if strings.EqualFold(location.Name, name) {
+			return append(errs, ValidationError{Field: "name", Message: "location already exists"})
+		}
+	}
+	// Renaming onto a location in use would merge two stocks silently.
+	if current != "" {
+		for _, used := range Locations(ds) {
+			if strings.EqualFold(used, name) {
+				return append(errs, ValidationError{Field: "name", Message: "location already in use"})
+			}
+		}
+	}
+	return errs
+}
+
+// renameLocation moves everything recorded at from, whatever its case, to
+// to. Each entry rewritten is touched, so an edit made from a page loaded
+// before the rename conflicts instead of restoring the former name.
+func renameLocation(ds *DataStore, from, to string, now time.Time) {
+	for i := range ds.Purchases {
+		if strings.EqualFold(ds.Purchases[i].Location, from) {
+			ds.Purchases[i].Location = to
+			ds.Purchases[i].touch(now)
+		}
+	}
+	for i := range ds.Transfers {
+		renamed := false
+		if strings.EqualFold(ds.Transfers[i].FromLocation, from) {
+			ds.Transfers[i].FromLocation = to
+			renamed = true
+		}
+		if strings.EqualFold(ds.Transfers[i].ToLocation, from) {
+			ds.Transfers[i].ToLocation = to
+			renamed = true
+		}
+		if renamed {
+			ds.Transfers[i].touch(now)
+		}
+	}
+	for i := range ds.Silos {
+		if strings.EqualFold(ds.Silos[i].Name, from) {
+			ds.Silos[i].Name = to
+			ds.Silos[i].touch(now)
+		}
+	}
+}
+
+func findStorageLocationIndex(locations []StorageLocation, id ID) int {
+	for i, location := range locations {
+		if location.ID == id {
+			return i
+		}
+	}
+	return -1
+}
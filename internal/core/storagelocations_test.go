@@ -0,0 +1,203 @@
+package core_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestAddStorageLocation(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		input core.StorageLocationParams
+	}
+	type want struct {
+		name string
+		err  error
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "declares a location",
+			params: params{input: core.StorageLocationParams{Name: "  Abri  ", Notes: "Au fond du jardin"}},
+			want:   want{name: "Abri"},
+		},
+		{
+			name:   "keeps the spelling of a location in use",
+			params: params{input: core.StorageLocationParams{Name: "GARAGE"}},
+			want:   want{name: "Garage"},
+		},
+		{
+			name:   "requires a name",
+			params: params{input: core.StorageLocationParams{Name: " "}},
+			want:   want{err: core.ValidationErrors{{Field: "name", Message: "name is required"}}},
+		},
+		{
+			name:   "rejects a location declared twice",
+			params: params{input: core.StorageLocationParams{Name: "cave"}},
+			want:   want{err: core.ValidationErrors{{Field: "name", Message: "location already exists"}}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := storageLocationDataStore(t)
+			location, err := core.AddStorageLocation(&ds, tc.params.input)
+
+			assert.Equal(t, tc.want.err, err, tc.name)
+			if tc.want.err == nil {
+				assert.Equal(t, tc.want.name, location.Name, tc.name)
+				assert.Contains(t, core.Locations(&ds), tc.want.name, tc.name)
+			}
+		})
+	}
+}
+
+func TestUpdateStorageLocation(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		input core.StorageLocationParams
+		// stale is saved to the purchase stored there after the rename,
+		// as a page loaded before it would.
+		stale *core.UpdatePurchaseParams
+	}
+	type want struct {
+		purchaseLocation string
+		transferTo       string
+		// revision is the one of the purchase and transfer renamed.
+		revision int64
+		staleErr error
+		err      error
+	}
+
+	before := int64(0)
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "renames the purchases and transfers stored there",
+			params: params{input: core.StorageLocationParams{Name: "Cellier"}},
+			want:   want{purchaseLocation: "Cellier", transferTo: "Cellier", revision: 1},
+		},
+		{
+			name:   "changes the case of the name",
+			params: params{input: core.StorageLocationParams{Name: "CAVE"}},
+			want:   want{purchaseLocation: "CAVE", transferTo: "CAVE", revision: 1},
+		},
+		{
+			name: "rejects an update of a purchase loaded before the rename",
+			params: params{
+				input: core.StorageLocationParams{Name: "Cellier"},
+				stale: &core.UpdatePurchaseParams{Bags: 10, BagWeightKg: 15, UnitPrice: 550, Location: "cave", ExpectedRevision: &before},
+			},
+			want: want{purchaseLocation: "Cellier", transferTo: "Cellier", revision: 1, staleErr: core.ErrConflict},
+		},
+		{
+			name:   "refuses to merge with a location in use",
+			params: params{input: core.StorageLocationParams{Name: "garage"}},
+			want:   want{err: core.ValidationErrors{{Field: "name", Message: "location already in use"}}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := storageLocationDataStore(t)
+			_, err := core.UpdateStorageLocation(&ds, ds.StorageLocations[0].ID, tc.params.input)
+
+			assert.Equal(t, tc.want.err, err, tc.name)
+			if tc.want.err != nil {
+				return
+			}
+			if tc.params.stale != nil {
+				_, err := core.UpdatePurchase(&ds, ds.Purchases[1].ID, *tc.params.stale)
+				assert.ErrorIs(t, err, tc.want.staleErr, tc.name)
+			}
+			assert.Equal(t, tc.want.purchaseLocation, ds.Purchases[1].Location, tc.name)
+			assert.Equal(t, tc.want.transferTo, ds.Transfers[0].ToLocation, tc.name)
+			assert.Equal(t, tc.want.revision, ds.Purchases[1].Revision, tc.name)
+			assert.Equal(t, tc.want.revision, ds.Transfers[0].Revision, tc.name)
+			assert.Equal(t, "Garage", ds.Purchases[0].Location, tc.name)
+			assert.Zero(t, ds.Purchases[0].Revision, tc.name)
+		})
+	}
+}
+
+func TestDeleteStorageLocation(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		id core.ID
+	}
+	type want struct {
+		err error
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "removes the declaration only", params: params{id: "loc-cave"}},
+		{name: "unknown location", params: params{id: "missing"}, want: want{err: core.ErrStorageLocationNotFound}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := storageLocationDataStore(t)
+			err := core.DeleteStorageLocation(&ds, tc.params.id)
+
+			assert.ErrorIs(t, err, tc.want.err, tc.name)
+			if tc.want.err == nil {
+				assert.Empty(t, ds.StorageLocations, tc.name)
+				assert.Equal(t, "cave", ds.Purchases[1].Location, tc.name)
+			}
+		})
+	}
+}
+
+// storageLocationDataStore stores bags in the garage and, declared, the
+// cellar, where more bags are moved.
+func storageLocationDataStore(t *testing.T) core.DataStore {
+	t.Helper()
+
+	at := time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC)
+	ds := core.DataStore{
+		Brands: []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}},
+		Purchases: []core.Purchase{
+			{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: at, Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 550, TotalPriceCents: 5500, Location: "Garage"},
+			{Meta: core.Meta{ID: "p2"}, BrandID: "brand-w", PurchasedAt: at, Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 550, TotalPriceCents: 5500, Location: "cave"},
+		},
+		StorageLocations: []core.StorageLocation{{Meta: core.Meta{ID: "loc-cave"}, Name: "Cave"}},
+	}
+	_, err := core.AddTransfer(&ds, core.CreateTransferParams{
+		BrandID:       "brand-w",
+		FromLocation:  "Garage",
+		ToLocation:    "Cave",
+		Bags:          2,
+		TransferredAt: at.Add(time.Hour),
+	})
+	require.NoError(t, err, "seed transfer")
+	return ds
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"sort"
+	"time"
+)
+
+// SeriesPoint is a single daily value of a time series.
+type SeriesPoint struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// ComputeStockSeries returns the number of bags in stock at the end of every
+// day with a purchase or consumption inside the optional range. When from is
+// set the series starts with the opening stock on that date.
+func ComputeStockSeries(ds *DataStore, from, to time.Time) []SeriesPoint {
+	if ds == nil {
+		return nil
+	}
+
+	deltas := make(map[time.Time]float64)
+	for _, purchase := range ds.Purchases {
+		deltas[startOfDay(purchase.PurchasedAt)] += float64(purchase.Bags)
+	}
+	for _, consumption := range ds.Consumptions {
+		deltas[startOfDay(consumption.ConsumedAt)] -= consumption.TotalBags()
+	}
+
+	days := sortedDays(deltas)
+	var points []SeriesPoint
+	var stock float64
+	openingEmitted := from.IsZero()
+	for _, day := range days {
+		if !from.IsZero() && day.Before(startOfDay(from)) {
+			stock += deltas[day]
+			continue
+		}
+		if !to.IsZero() && day.After(to) {
+			break
+		}
+		if !openingEmitted {
+			if !day.Equal(startOfDay(from)) {
+				points = append(points, SeriesPoint{Time: startOfDay(from), Value: stock})
+			}
+			openingEmitted = true
+		}
+		stock += deltas[day]
+		points = append(points, SeriesPoint{Time: day, Value: stock})
+	}
+	if !openingEmitted {
+		points = append(points, SeriesPoint{Time: startOfDay(from), Value: stock})
+	}
+	return points
+}
+
+// ComputeSpendSeries returns the euro amount spent on purchases per day within
+// the optional range.
+func ComputeSpendSeries(ds *DataStore, from, to time.Time) []SeriesPoint {
+	if ds == nil {
+		return nil
+	}
+
+	buckets := make(map[time.Time]float64)
+	for _, purchase := range ds.Purchases {
+		if !withinRange(purchase.PurchasedAt, from, to) {
+			continue
+		}
+		buckets[startOfDay(purchase.PurchasedAt)] += purchase.TotalPriceCents.Float64()
+	}
+	return seriesFromBuckets(buckets)
+}
+
+// ComputeConsumptionSeries returns the number of bags consumed per day within
+// the optional range.
+func ComputeConsumptionSeries(ds *DataStore, from, to time.Time) []SeriesPoint {
+	if ds == nil {
+		return nil
+	}
+
+	buckets := make(map[time.Time]float64)
+	for _, consumption := range ds.Consumptions {
+		if !withinRange(consumption.ConsumedAt, from, to) {
+			continue
+		}
+		buckets[startOfDay(consumption.ConsumedAt)] += consumption.TotalBags()
+	}
+	return seriesFromBuckets(buckets)
+}
+
+func seriesFromBuckets(buckets map[time.Time]float64) []SeriesPoint {
+	days := sortedDays(buckets)
+	points := make([]SeriesPoint, len(days))
+	for i, day := range days {
+		points[i] = SeriesPoint{Time: day, Value: buckets[day]}
+	}
+	return points
+}
+
+func sortedDays(buckets map[time.Time]float64) []time.Time {
+	days := make([]time.Time, 0, len(buckets))
+	for day := range buckets {
+		days = append(days, day)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days
+}
+
+func startOfDay(ts time.Time) time.Time {
+	ts = ts.UTC()
+	return time.Date(ts.Year(), ts.Month(), ts.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,158 @@
+package core_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestComputeStockSeries(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		datastore core.DataStore
+		from      time.Time
+		to        time.Time
+	}
+	type want struct {
+		points []core.SeriesPoint
+	}
+
+	ds := sampleDataStore(t)
+	jan10 := time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC)
+	feb1 := time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)
+	feb5 := time.Date(2024, time.February, 5, 0, 0, 0, 0, time.UTC)
+	feb20 := time.Date(2024, time.February, 20, 0, 0, 0, 0, time.UTC)
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "cumulates purchases and consumptions",
+			params: params{datastore: ds},
+			want: want{points: []core.SeriesPoint{
+				{Time: jan10, Value: 5},
+				{Time: feb5, Value: 8},
+				{Time: feb20, Value: 6},
+			}},
+		},
+		{
+			name:   "starts with opening stock",
+			params: params{datastore: ds, from: feb1, to: time.Date(2024, time.February, 10, 0, 0, 0, 0, time.UTC)},
+			want: want{points: []core.SeriesPoint{
+				{Time: feb1, Value: 5},
+				{Time: feb5, Value: 8},
+			}},
+		},
+		{
+			name:   "returns opening stock when range has no activity",
+			params: params{datastore: ds, from: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)},
+			want: want{points: []core.SeriesPoint{
+				{Time: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), Value: 6},
+			}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			points := core.ComputeStockSeries(&tc.params.datastore, tc.params.from, tc.params.to)
+			assert.Equal(t, tc.want.points, points, tc.name)
+		})
+	}
+}
+
+func TestComputeSpendSeries(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		datastore core.DataStore
+		from      time.Time
+		to        time.Time
+	}
+	type want struct {
+		points []core.SeriesPoint
+	}
+
+	ds := sampleDataStore(t)
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "sums purchases per day in euros",
+			params: params{datastore: ds},
+			want: want{points: []core.SeriesPoint{
+				{Time: time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC), Value: 27.5},
+				{Time: time.Date(2024, time.February, 5, 0, 0, 0, 0, time.UTC), Value: 18},
+			}},
+		},
+		{
+			name:   "filters by range",
+			params: params{datastore: ds, from: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+			want: want{points: []core.SeriesPoint{
+				{Time: time.Date(2024, time.February, 5, 0, 0, 0, 0, time.UTC), Value: 18},
+			}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			points := core.ComputeSpendSeries(&tc.params.datastore, tc.params.from, tc.params.to)
+			assert.Equal(t, tc.want.points, points, tc.name)
+		})
+	}
+}
+
+func TestComputeConsumptionSeries(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		datastore core.DataStore
+		from      time.Time
+		to        time.Time
+	}
+	type want struct {
+		points []core.SeriesPoint
+	}
+
+	ds := sampleDataStore(t)
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "sums bags per day",
+			params: params{datastore: ds},
+			want: want{points: []core.SeriesPoint{
+				{Time: time.Date(2024, time.February, 20, 0, 0, 0, 0, time.UTC), Value: 2},
+			}},
+		},
+		{
+			name:   "empty outside range",
+			params: params{datastore: ds, to: time.Date(2024, time.January, 31, 0, 0, 0, 0, time.UTC)},
+			want:   want{points: []core.SeriesPoint{}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			points := core.ComputeConsumptionSeries(&tc.params.datastore, tc.params.from, tc.params.to)
+			assert.Equal(t, tc.want.points, points, tc.name)
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// CreateUserParams contains the fields required to create a user. The
+// password is hashed by the caller, core never sees it in clear.
+type CreateUserParams struct {
+	Username     string
+	PasswordHash string
+	// Role defaults to RoleAdmin for the first user, who must be able to
+	// manage the others, and to RoleEditor afterwards.
+	Role Role
+}
+
+// roleRanks orders the roles, a role granting the rights of the lower ones.
+var roleRanks = map[Role]int{RoleViewer: 1, RoleEditor: 2, RoleAdmin: 3}
+
+// Valid reports whether r is one of the roles.
+func (r Role) Valid() bool {
+	_, ok := roleRanks[r]
+	return ok
+}
+
+// Includes reports whether r grants the rights of other.
+func (r Role) Includes(other Role) bool {
+	return r.Valid() && roleRanks[r] >= roleRanks[other]
+}
+
+// AccessRole returns the role of the user, RoleAdmin for the accounts
+// created before roles: they could change everything.
+func (u User) AccessRole() Role {
+	if u.Role == "" {
+		return RoleAdmin
+	}
+	return u.Role
+}
+
+// AddUser inserts a new user into the datastore. Usernames are unique
+// regardless of case.
+func AddUser(ds *DataStore, params CreateUserParams) (User, error) {
+	if ds == nil {
+		return User{}, errors.New("nil datastore")
+	}
+
+	username := strings.TrimSpace(params.Username)
+	errs := ValidationErrors{}
+	errs = errs.AppendIf(username == "", "username", "username is required")
+	errs = errs.AppendIf(len(username) > MaxUsernameLength, "username", "username is too long")
+	errs = errs.AppendIf(strings.IndexFunc(username, unicode.IsSpace) >= 0, "username", "username cannot contain spaces")
+	if _, exists := FindUserByName(ds.Users, username); username != "" && exists {
+		errs = errs.AppendIf(true, "username", "username already exists")
+	}
+	errs = errs.AppendIf(params.PasswordHash == "", "password", "password is required")
+	role := params.Role
+	if role == "" {
+		role = RoleEditor
+		if len(ds.Users) == 0 {
+			role = RoleAdmin
+		}
+	}
+	errs = errs.AppendIf(!role.Valid(), "role", "role must be viewer, editor or admin")
+	if len(errs) > 0 {
+		return User{}, errs
+	}
+
+	now := time.Now().UTC()
+	user := User{
+		Meta: Meta{
+			ID:        NewID(),
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		Username:     username,
+		PasswordHash: params.PasswordHash,
+		Role:         role,
+	}
+	ds.Users = append(ds.Users, user)
+	touchDatastore(ds, now)
+
+	return user, nil
+}
+
+// SetUserPassword replaces the password hash of a user.
+func SetUserPassword(ds *DataStore, id ID, passwordHash string) (User, error) {
+	if ds == nil {
+		return User{}, errors.New("nil datastore")
+	}
+
+	idx := findUserIndex(ds.Users, id)
+	if idx == -1 {
+		return User{}, ErrUserNotFound
+	}
+	if passwordHash == "" {
+		return User{}, ValidationErrors{}.AppendIf(true, "password", "password is required")
+	}
+
+	now := time.Now().UTC()
+	ds.Users[idx].PasswordHash = passwordHash
+	ds.Users[idx].touch(now)
+	touchDatastore(ds, now)
+
+	return ds.Users[idx], nil
+}
+
+// SetUserRole changes the role of a user. The last admin keeps its role:
+// without it nobody could manage the accounts any more.
+func SetUserRole(ds *DataStore, id ID, role Role) (User, error) {
+	if ds == nil {
+		return User{}, errors.New("nil datastore")
+	}
+
+	idx := findUserIndex(ds.Users, id)
+	if idx == -1 {
+		return User{}, ErrUserNotFound
+	}
+	if !role.Valid() {
+		return User{}, ValidationErrors{}.AppendIf(true, "role", "role must be viewer, editor or admin")
+	}
+	if role != RoleAdmin && isLastAdmin(ds.Users, idx) {
+		return User{}, ErrLastAdmin
+	}
+
+	now := time.Now().UTC()
+	ds.Users[idx].Role = role
+	ds.Users[idx].touch(now)
+	touchDatastore(ds, now)
+
+	return ds.Users[idx], nil
+}
+
+// DeleteUser removes a user and its API tokens. The last user and the last
+// admin are kept: without them nobody could sign in or manage the accounts
+// any more.
+func DeleteUser(ds *DataStore, id ID) error {
+	if ds == nil {
+		return errors.New("nil datastore")
+	}
+
+	idx := findUserIndex(ds.Users, id)
+	if idx == -1 {
+		return ErrUserNotFound
+	}
+	if len(ds.Users) == 1 {
+		return ErrLastUser
+	}
+	if isLastAdmin(ds.Users, idx) {
+		return ErrLastAdmin
+	}
+
+	ds.Users = append(ds.Users[:idx], ds.Users[idx+1:]...)
+	ds.APITokens = removeUserAPITokens(ds.APITokens, id)
+	touchDatastore(ds, time.Now().UTC())
+
+	return nil
+}
+
+// FindUserByName looks a user up by username, ignoring case.
+func FindUserByName(users []User, username string) (User, bool) {
+	username = strings.TrimSpace(username)
+	for _, user := range users {
+		if strings.EqualFold(user.Username, username) {
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+// FindUser looks a user up by ID.
+func FindUser(users []User, id ID) (User, bool) {
+	if idx := findUserIndex(users, id); idx != -1 {
+		return users[idx], true
+	}
+	return User{}, false
+}
+
+// isLastAdmin reports whether users[idx] is the only admin.
+func isLastAdmin(users []User, idx int) bool {
+	if users[idx].AccessRole() != RoleAdmin {
+		return false
+	}
+	for i, user := range users {
+		if i != idx && user.AccessRole() == RoleAdmin {
+			return false
+		}
+	}
+	return true
+}
+
+func findUserIndex(users []User, id ID) int {
+	for i, user := range users {
+		if user.ID == id {
+			return i
+		}
+	}
+	return -1
+}
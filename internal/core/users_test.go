@@ -0,0 +1,252 @@
+package core_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestAddUser(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		input core.CreateUserParams
+		// first adds the user to a datastore without accounts.
+		first bool
+	}
+	type want struct {
+		validationField string
+		username        string
+		role            core.Role
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "adds a user",
+			params: params{input: core.CreateUserParams{Username: " bob ", PasswordHash: "hash"}},
+			want:   want{username: "bob", role: core.RoleEditor},
+		},
+		{
+			name:   "makes the first user an admin",
+			params: params{input: core.CreateUserParams{Username: "bob", PasswordHash: "hash"}, first: true},
+			want:   want{username: "bob", role: core.RoleAdmin},
+		},
+		{
+			name:   "keeps the role asked for",
+			params: params{input: core.CreateUserParams{Username: "bob", PasswordHash: "hash", Role: core.RoleViewer}},
+			want:   want{username: "bob", role: core.RoleViewer},
+		},
+		{
+			name:   "rejects unknown roles",
+			params: params{input: core.CreateUserParams{Username: "bob", PasswordHash: "hash", Role: "owner"}},
+			want:   want{validationField: "role"},
+		},
+		{
+			name:   "rejects a taken username whatever its case",
+			params: params{input: core.CreateUserParams{Username: "Alice", PasswordHash: "hash"}},
+			want:   want{validationField: "username"},
+		},
+		{
+			name:   "rejects spaces",
+			params: params{input: core.CreateUserParams{Username: "jean pierre", PasswordHash: "hash"}},
+			want:   want{validationField: "username"},
+		},
+		{
+			name:   "rejects long usernames",
+			params: params{input: core.CreateUserParams{Username: strings.Repeat("a", core.MaxUsernameLength+1), PasswordHash: "hash"}},
+			want:   want{validationField: "username"},
+		},
+		{
+			name:   "requires a password",
+			params: params{input: core.CreateUserParams{Username: "bob"}},
+			want:   want{validationField: "password"},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := core.DataStore{Users: []core.User{{Meta: core.Meta{ID: "user-a"}, Username: "alice", PasswordHash: "hash"}}}
+			if tc.params.first {
+				ds.Users = nil
+			}
+			existing := append([]core.User(nil), ds.Users...)
+
+			user, err := core.AddUser(&ds, tc.params.input)
+
+			if tc.want.validationField != "" {
+				var ve core.ValidationErrors
+				assert.True(t, errors.As(err, &ve), tc.name)
+				assert.True(t, ve.Has(tc.want.validationField), tc.name)
+				assert.Len(t, ds.Users, 1, tc.name)
+				return
+			}
+			assert.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.username, user.Username, tc.name)
+			assert.Equal(t, tc.want.role, user.Role, tc.name)
+			assert.NotEmpty(t, user.ID, tc.name)
+			assert.Equal(t, append(existing, user), ds.Users, tc.name)
+		})
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		users []core.User
+		id    core.ID
+	}
+	type want struct {
+		err    error
+		users  []core.ID
+		tokens []core.ID
+	}
+
+	alice := core.User{Meta: core.Meta{ID: "user-a"}, Username: "alice", PasswordHash: "hash"}
+	bob := core.User{Meta: core.Meta{ID: "user-b"}, Username: "bob", PasswordHash: "hash"}
+	editor := core.User{Meta: core.Meta{ID: "user-b"}, Username: "bob", PasswordHash: "hash", Role: core.RoleEditor}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "deletes a user",
+			params: params{users: []core.User{alice, bob}, id: "user-a"},
+			want:   want{users: []core.ID{"user-b"}, tokens: []core.ID{"token-b"}},
+		},
+		{
+			name:   "keeps the last user",
+			params: params{users: []core.User{alice}, id: "user-a"},
+			want:   want{err: core.ErrLastUser, users: []core.ID{"user-a"}, tokens: []core.ID{"token-a", "token-b"}},
+		},
+		{
+			name:   "keeps the last admin",
+			params: params{users: []core.User{alice, editor}, id: "user-a"},
+			want:   want{err: core.ErrLastAdmin, users: []core.ID{"user-a", "user-b"}, tokens: []core.ID{"token-a", "token-b"}},
+		},
+		{
+			name:   "reports unknown users",
+			params: params{users: []core.User{alice, bob}, id: "user-c"},
+			want:   want{err: core.ErrUserNotFound, users: []core.ID{"user-a", "user-b"}, tokens: []core.ID{"token-a", "token-b"}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := core.DataStore{
+				Users: append([]core.User(nil), tc.params.users...),
+				APITokens: []core.APIToken{
+					{Meta: core.Meta{ID: "token-a"}, UserID: "user-a", Name: "Téléphone", Hash: "a"},
+					{Meta: core.Meta{ID: "token-b"}, UserID: "user-b", Name: "Téléphone", Hash: "b"},
+				},
+			}
+
+			err := core.DeleteUser(&ds, tc.params.id)
+
+			assert.ErrorIs(t, err, tc.want.err, tc.name)
+			ids := []core.ID{}
+			for _, user := range ds.Users {
+				ids = append(ids, user.ID)
+			}
+			assert.Equal(t, tc.want.users, ids, tc.name)
+			tokens := []core.ID{}
+			for _, token := range ds.APITokens {
+				tokens = append(tokens, token.ID)
+			}
+			assert.Equal(t, tc.want.tokens, tokens, tc.name)
+		})
+	}
+}
+
+func TestSetUserRole(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		users []core.User
+		id    core.ID
+		role  core.Role
+	}
+	type want struct {
+		err             error
+		validationField string
+		roles           []core.Role
+	}
+
+	alice := core.User{Meta: core.Meta{ID: "user-a"}, Username: "alice", PasswordHash: "hash"}
+	bob := core.User{Meta: core.Meta{ID: "user-b"}, Username: "bob", PasswordHash: "hash", Role: core.RoleEditor}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "changes a role",
+			params: params{users: []core.User{alice, bob}, id: "user-b", role: core.RoleViewer},
+			want:   want{roles: []core.Role{"", core.RoleViewer}},
+		},
+		{
+			name:   "promotes an admin",
+			params: params{users: []core.User{alice, bob}, id: "user-b", role: core.RoleAdmin},
+			want:   want{roles: []core.Role{"", core.RoleAdmin}},
+		},
+		{
+			name:   "keeps the last admin",
+			params: params{users: []core.User{alice, bob}, id: "user-a", role: core.RoleEditor},
+			want:   want{err: core.ErrLastAdmin, roles: []core.Role{"", core.RoleEditor}},
+		},
+		{
+			name:   "rejects unknown roles",
+			params: params{users: []core.User{alice, bob}, id: "user-b", role: "owner"},
+			want:   want{validationField: "role", roles: []core.Role{"", core.RoleEditor}},
+		},
+		{
+			name:   "reports unknown users",
+			params: params{users: []core.User{alice, bob}, id: "user-c", role: core.RoleViewer},
+			want:   want{err: core.ErrUserNotFound, roles: []core.Role{"", core.RoleEditor}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := core.DataStore{Users: append([]core.User(nil), tc.params.users...)}
+
+			_, err := core.SetUserRole(&ds, tc.params.id, tc.params.role)
+
+			switch {
+			case tc.want.validationField != "":
+				var ve core.ValidationErrors
+				assert.True(t, errors.As(err, &ve), tc.name)
+				assert.True(t, ve.Has(tc.want.validationField), tc.name)
+			case tc.want.err != nil:
+				assert.ErrorIs(t, err, tc.want.err, tc.name)
+			default:
+				assert.NoError(t, err, tc.name)
+			}
+			roles := []core.Role{}
+			for _, user := range ds.Users {
+				roles = append(roles, user.Role)
+			}
+			assert.Equal(t, tc.want.roles, roles, tc.name)
+		})
+	}
+}
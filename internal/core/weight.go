@@ -0,0 +1,69 @@
+package core
+
+import (
+	"fmt"
+	"math"
+)
+
+// MaxWeightDecimals is the finest display precision: weights are tracked to
+// the gram.
+const MaxWeightDecimals = 3
+
+// Grams is a weight in whole grams. Weights are persisted and exposed in
+// kilograms, but every sum and product goes through Grams so totals never pick
+// up floating point artifacts such as 0.30000000000000004.
+type Grams int64
+
+// GramsFromKg converts kilograms to the nearest gram.
+func GramsFromKg(kg float64) Grams {
+	return Grams(math.Round(kg * 1000))
+}
+
+// Kg returns the weight in kilograms.
+func (g Grams) Kg() float64 {
+	return float64(g) / 1000
+}
+
+// MulInt multiplies the weight by an integer quantity.
+func (g Grams) MulInt(quantity int) Grams {
+	return g * Grams(quantity)
+}
+
+// DivInt splits the weight into quantity equal parts, rounded to the gram.
+func (g Grams) DivInt(quantity int) Grams {
+	if quantity == 0 {
+		return 0
+	}
+	return Grams(math.Round(float64(g) / float64(quantity)))
+}
+
+// RoundKg rounds a kilogram value to the gram.
+func RoundKg(kg float64) float64 {
+	return GramsFromKg(kg).Kg()
+}
+
+// FormatWeight renders kilograms with the given number of decimals (clamped
+// to 0..MaxWeightDecimals) and a French decimal comma. Rounding is done on
+// whole grams, half away from zero.
+func FormatWeight(kg float64, decimals int) string {
+	if decimals < 0 {
+		decimals = 0
+	}
+	if decimals > MaxWeightDecimals {
+		decimals = MaxWeightDecimals
+	}
+	grams := int64(GramsFromKg(kg))
+	sign := ""
+	if grams < 0 {
+		sign = "-"
+		grams = -grams
+	}
+	step := int64(math.Pow10(MaxWeightDecimals - decimals))
+	units := (grams + step/2) / step
+	scale := int64(math.Pow10(decimals))
+	whole := units / scale
+	if decimals == 0 {
+		return fmt.Sprintf("%s%d", sign, whole)
+	}
+	return fmt.Sprintf("%s%d,%0*d", sign, whole, decimals, units%scale)
+}
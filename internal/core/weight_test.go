@@ -0,0 +1,102 @@
+package core_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestGramsFromKg(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		kg float64
+	}
+	type want struct {
+		grams core.Grams
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "whole kilograms", params: params{kg: 15}, want: want{grams: 15000}},
+		{name: "decimal kilograms", params: params{kg: 14.5}, want: want{grams: 14500}},
+		{name: "binary artifact", params: params{kg: 0.1 + 0.2}, want: want{grams: 300}},
+		{name: "sub gram rounds", params: params{kg: 0.0004}, want: want{grams: 0}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want.grams, core.GramsFromKg(tc.params.kg), tc.name)
+		})
+	}
+}
+
+func TestGrams_DivInt(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		grams    core.Grams
+		quantity int
+	}
+	type want struct {
+		grams core.Grams
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "even split", params: params{grams: 45000, quantity: 3}, want: want{grams: 15000}},
+		{name: "rounds to the gram", params: params{grams: 1000, quantity: 3}, want: want{grams: 333}},
+		{name: "zero quantity", params: params{grams: 1000, quantity: 0}, want: want{grams: 0}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want.grams, tc.params.grams.DivInt(tc.params.quantity), tc.name)
+		})
+	}
+}
+
+func TestFormatWeight(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		kg       float64
+		decimals int
+	}
+	type want struct {
+		formatted string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "default precision", params: params{kg: 43.5, decimals: 2}, want: want{formatted: "43,50"}},
+		{name: "no artifact", params: params{kg: 0.1 + 0.2, decimals: 3}, want: want{formatted: "0,300"}},
+		{name: "no decimals rounds half up", params: params{kg: 14.5, decimals: 0}, want: want{formatted: "15"}},
+		{name: "one decimal", params: params{kg: 14.25, decimals: 1}, want: want{formatted: "14,3"}},
+		{name: "clamps precision", params: params{kg: 1.2345, decimals: 5}, want: want{formatted: "1,235"}},
+		{name: "negative", params: params{kg: -2.5, decimals: 2}, want: want{formatted: "-2,50"}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want.formatted, core.FormatWeight(tc.params.kg, tc.params.decimals), tc.name)
+		})
+	}
+}
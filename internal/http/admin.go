@@ -0,0 +1,151 @@
+package http
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"pellets-tracker/internal/core"
+)
+
+var (
+	errAdminDisabled     = errors.New("admin endpoints are disabled")
+	errAdminUnauthorized = errors.New("invalid admin token")
+	errBackupUnsupported = errors.New("datastore does not support backups")
+)
+
+// registerAdminRoutes registers the management endpoints on the admin mux
+// and, unless separate, on the main mux as well. The debug endpoints are
+// only served by the admin mux.
+func (s *Server) registerAdminRoutes(separate bool) {
+	muxes := []*http.ServeMux{s.adminMux}
+	if !separate {
+		muxes = append(muxes, s.mux)
+	}
+	for _, mux := range muxes {
+		mux.HandleFunc("/metrics", s.handleMetrics)
+		mux.HandleFunc("/api/admin/marques/", s.handleAdminBrandAPI)
+		mux.HandleFunc("/api/admin/backup", s.handleAdminBackupAPI)
+	}
+	s.adminMux.HandleFunc("/healthz", s.handleHealthz)
+	s.adminMux.Handle("/debug/", DebugHandler())
+	s.adminMux.HandleFunc("/", s.notFound)
+}
+
+// AdminHandler returns the handler of the management endpoints: metrics,
+// admin and backup API, pprof and expvar. It is meant for a listener of its
+// own, which can be firewalled apart from the one of Handler.
+func (s *Server) AdminHandler() http.Handler {
+	return s.loggingMiddleware(s.adminMux)
+}
+
+type forceDeleteBrandPayload struct {
+	// Confirm must repeat the exact brand name to prevent accidental wipes.
+	Confirm string `json:"confirm"`
+}
+
+// handleAdminBrandAPI serves DELETE /api/admin/marques/{id}, which removes a
+// brand and cascades to its purchases and consumptions. The response is the
+// export of every removed entry so the caller keeps a copy of the data.
+func (s *Server) handleAdminBrandAPI(w http.ResponseWriter, r *http.Request) {
+	id := core.ID(strings.TrimPrefix(r.URL.Path, "/api/admin/marques/"))
+	if id == "" || strings.ContainsRune(string(id), '/') {
+		s.notFound(w, r)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		s.methodNotAllowed(w, r, http.MethodDelete)
+		return
+	}
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	s.forceDeleteBrand(w, r, id)
+}
+
+// handleAdminBackupAPI serves POST /api/admin/backup, which writes a copy of
+// the datastore to the backup directory. Like the copies taken before an
+// import, it is never rotated.
+func (s *Server) handleAdminBackupAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	snap, ok := s.changes.DataStore.(snapshotter)
+	if !ok {
+		s.writeError(w, http.StatusNotImplemented, errBackupUnsupported)
+		return
+	}
+	path, err := snap.Snapshot("backup")
+	if err != nil {
+		log.Printf("admin backup: %v", err)
+		s.writeError(w, http.StatusInternalServerError, errors.New("failed to write backup"))
+		return
+	}
+	log.Printf(`{"type":"backup","path":%q}`, path)
+	s.writeJSON(w, http.StatusCreated, map[string]string{"backup": path})
+}
+
+func (s *Server) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if s.adminToken == "" {
+		s.writeError(w, http.StatusForbidden, errAdminDisabled)
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="pellets-admin"`)
+		s.writeError(w, http.StatusUnauthorized, errAdminUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (s *Server) forceDeleteBrand(w http.ResponseWriter, r *http.Request, id core.ID) {
+	var payload forceDeleteBrandPayload
+	if err := decodeJSON(r.Body, &payload); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ds := s.store.Data()
+	brand, ok := findBrand(ds.Brands, id)
+	if !ok {
+		s.handleCoreError(w, core.ErrBrandNotFound)
+		return
+	}
+	if payload.Confirm != brand.Name {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("confirm must match the brand name %q", brand.Name))
+		return
+	}
+
+	deletion, err := core.ForceDeleteBrand(&ds, id)
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	if err := s.store.Replace(ds); err != nil {
+		s.handleStoreError(w, err)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"brand","id":"%s","action":"force_delete","purchases":%d,"consumptions":%d}`, id, len(deletion.Purchases), len(deletion.Consumptions))
+
+	filename := fmt.Sprintf("pellets-marque-%s-%s.json", id, time.Now().UTC().Format("20060102T150405Z"))
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	s.writeJSON(w, http.StatusOK, deletion)
+}
+
+func findBrand(brands []core.Brand, id core.ID) (core.Brand, bool) {
+	for _, brand := range brands {
+		if brand.ID == id {
+			return brand, true
+		}
+	}
+	return core.Brand{}, false
+}
@@ -0,0 +1,231 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_handleAdminBrandAPI(t *testing.T) {
+	t.Parallel()
+
+	brandID := core.NewID()
+	baseData := core.DataStore{
+		Brands:       []core.Brand{{Meta: core.Meta{ID: brandID}, Name: "Test"}},
+		Purchases:    []core.Purchase{{Meta: core.Meta{ID: core.NewID()}, BrandID: brandID, Bags: 2}},
+		Consumptions: []core.Consumption{{Meta: core.Meta{ID: core.NewID()}, BrandID: brandID, Bags: 1}},
+	}
+
+	type params struct {
+		adminToken    string
+		authorization string
+		body          string
+	}
+	type want struct {
+		statusCode   int
+		replaced     bool
+		bodyContains string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "disabled without configured token",
+			params: params{authorization: "Bearer secret", body: `{"confirm":"Test"}`},
+			want:   want{statusCode: http.StatusForbidden, bodyContains: "disabled"},
+		},
+		{
+			name:   "rejects wrong token",
+			params: params{adminToken: "secret", authorization: "Bearer nope", body: `{"confirm":"Test"}`},
+			want:   want{statusCode: http.StatusUnauthorized, bodyContains: "invalid admin token"},
+		},
+		{
+			name:   "requires typed confirmation",
+			params: params{adminToken: "secret", authorization: "Bearer secret", body: `{"confirm":"test"}`},
+			want:   want{statusCode: http.StatusBadRequest, bodyContains: "confirm must match"},
+		},
+		{
+			name:   "deletes brand and returns export",
+			params: params{adminToken: "secret", authorization: "Bearer secret", body: `{"confirm":"Test"}`},
+			want:   want{statusCode: http.StatusOK, replaced: true, bodyContains: `"consumptions":[{`},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: baseData}
+			server := NewServer(store, Config{AdminToken: tc.params.adminToken})
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/admin/marques/"+string(brandID), strings.NewReader(tc.params.body))
+			req.Header.Set("Authorization", tc.params.authorization)
+			rec := httptest.NewRecorder()
+
+			server.handleAdminBrandAPI(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.replaced, store.replaced, tc.name)
+			assert.Contains(t, rec.Body.String(), tc.want.bodyContains, tc.name)
+			if tc.want.replaced {
+				assert.Empty(t, store.replacedWith.Brands, tc.name)
+				assert.Empty(t, store.replacedWith.Purchases, tc.name)
+				assert.Empty(t, store.replacedWith.Consumptions, tc.name)
+			}
+		})
+	}
+}
+
+func TestServer_handleAdminBackupAPI(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		store         DataStore
+		authorization string
+		method        string
+	}
+	type want struct {
+		statusCode   int
+		snapshots    int
+		bodyContains string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "writes a backup",
+			params: params{store: &snapshotStore{}, authorization: "Bearer secret", method: http.MethodPost},
+			want:   want{statusCode: http.StatusCreated, snapshots: 1, bodyContains: `"backup":"data/backups/pellets.json-backup.json"`},
+		},
+		{
+			name:   "rejects wrong token",
+			params: params{store: &snapshotStore{}, authorization: "Bearer nope", method: http.MethodPost},
+			want:   want{statusCode: http.StatusUnauthorized, bodyContains: "invalid admin token"},
+		},
+		{
+			name:   "reports stores without backups",
+			params: params{store: &stubDataStore{}, authorization: "Bearer secret", method: http.MethodPost},
+			want:   want{statusCode: http.StatusNotImplemented, bodyContains: "does not support backups"},
+		},
+		{
+			name:   "rejects other methods",
+			params: params{store: &snapshotStore{}, authorization: "Bearer secret", method: http.MethodGet},
+			want:   want{statusCode: http.StatusMethodNotAllowed},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(tc.params.store, Config{AdminToken: "secret"})
+			req := httptest.NewRequest(tc.params.method, "/api/admin/backup", nil)
+			req.Header.Set("Authorization", tc.params.authorization)
+			rec := httptest.NewRecorder()
+
+			server.handleAdminBackupAPI(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Contains(t, rec.Body.String(), tc.want.bodyContains, tc.name)
+			if snap, ok := tc.params.store.(*snapshotStore); ok {
+				assert.Equal(t, tc.want.snapshots, snap.snapshots, tc.name)
+			}
+		})
+	}
+}
+
+func TestServer_AdminHandler(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		separate bool
+		admin    bool
+		path     string
+	}
+	type want struct {
+		statusCode int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "serves the metrics on the main handler by default",
+			params: params{path: "/metrics"},
+			want:   want{statusCode: http.StatusOK},
+		},
+		{
+			name:   "keeps the debug endpoints off the main handler",
+			params: params{path: "/debug/vars"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "moves the metrics off the main handler",
+			params: params{separate: true, path: "/metrics"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "moves the admin API off the main handler",
+			params: params{separate: true, path: "/api/admin/backup"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "still serves the pages on the main handler",
+			params: params{separate: true, path: "/api/marques"},
+			want:   want{statusCode: http.StatusOK},
+		},
+		{
+			name:   "serves the metrics on the admin handler",
+			params: params{separate: true, admin: true, path: "/metrics"},
+			want:   want{statusCode: http.StatusOK},
+		},
+		{
+			name:   "serves the debug endpoints on the admin handler",
+			params: params{separate: true, admin: true, path: "/debug/vars"},
+			want:   want{statusCode: http.StatusOK},
+		},
+		{
+			name:   "serves the health check on the admin handler",
+			params: params{separate: true, admin: true, path: "/healthz"},
+			want:   want{statusCode: http.StatusOK},
+		},
+		{
+			name:   "keeps the pages off the admin handler",
+			params: params{separate: true, admin: true, path: "/api/marques"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{}, Config{SeparateAdmin: tc.params.separate})
+			handler := server.Handler()
+			if tc.params.admin {
+				handler = server.AdminHandler()
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.params.path, nil))
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+		})
+	}
+}
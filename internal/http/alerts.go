@@ -0,0 +1,89 @@
+package http
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"pellets-tracker/internal/core"
+)
+
+// alertsResponse is the body of /api/alertes: the minimum of the whole
+// stock and the stocks currently below their minimum.
+type alertsResponse struct {
+	MinStockBags int               `json:"min_stock_bags"`
+	Alerts       []core.StockAlert `json:"alertes"`
+}
+
+type alertsPayload struct {
+	MinStockBags int `json:"min_stock_bags"`
+}
+
+// handleAlertsAPI lists the low stock alerts on GET and changes the minimum
+// of the whole stock on PUT.
+func (s *Server) handleAlertsAPI(w http.ResponseWriter, r *http.Request) {
+	ds := s.store.Data()
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var payload alertsPayload
+		if err := decodeJSON(r.Body, &payload); err != nil {
+			s.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := core.SetMinStockBags(&ds, payload.MinStockBags); err != nil {
+			s.handleCoreError(w, err)
+			return
+		}
+		if err := s.store.Replace(ds); err != nil {
+			s.handleStoreError(w, err)
+			return
+		}
+		log.Print(`{"type":"save","entity":"settings","field":"min_stock_bags"}`)
+	default:
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPut)
+		return
+	}
+
+	ctx, cancel := s.computeContext(r)
+	defer cancel()
+	alerts, err := core.ComputeAlertes(ctx, &ds)
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, alertsResponse{MinStockBags: ds.MinStockBags, Alerts: alerts})
+}
+
+// handleAlertsForm saves the minimum of the whole stock from the brands
+// page.
+func (s *Server) handleAlertsForm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.renderBrandsPage(w, http.StatusBadRequest, &flashMessage{Kind: "error", Message: "Formulaire invalide"}, formState{})
+		return
+	}
+	bags := 0
+	if value := strings.TrimSpace(r.PostForm.Get("min_stock_bags")); value != "" {
+		var err error
+		if bags, err = parseIntField(value); err != nil {
+			s.renderBrandsPage(w, http.StatusBadRequest, &flashMessage{Kind: "error", Message: "Seuil d'alerte invalide"}, formState{})
+			return
+		}
+	}
+	ds := s.store.Data()
+	if err := core.SetMinStockBags(&ds, bags); err != nil {
+		s.renderBrandsPage(w, http.StatusBadRequest, &flashMessage{Kind: "error", Message: "Le seuil d'alerte ne peut pas être négatif"}, formState{})
+		return
+	}
+	if err := s.store.Replace(ds); err != nil {
+		log.Printf("persist alerts form: %v", err)
+		s.renderBrandsPage(w, http.StatusInternalServerError, &flashMessage{Kind: "error", Message: "Impossible d'enregistrer le seuil d'alerte"}, formState{})
+		return
+	}
+	log.Print(`{"type":"save","entity":"settings","field":"min_stock_bags"}`)
+	http.Redirect(w, r, "/marques?added=alerts", http.StatusSeeOther)
+}
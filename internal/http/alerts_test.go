@@ -0,0 +1,166 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func alertsDataStore() core.DataStore {
+	return core.DataStore{
+		MinStockBags: 10,
+		Brands: []core.Brand{
+			{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock", MinStockBags: 5},
+		},
+		Purchases: []core.Purchase{
+			{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC), Bags: 8, BagWeightKg: 15, TotalWeightKg: 120, UnitPriceCents: 600, TotalPriceCents: 4800},
+		},
+		Consumptions: []core.Consumption{
+			{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: time.Date(2024, time.December, 1, 0, 0, 0, 0, time.UTC), Bags: 2},
+		},
+	}
+}
+
+func TestServer_handleAlertsAPI(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		method string
+		body   string
+	}
+	type want struct {
+		statusCode   int
+		body         string
+		minStockBags int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "lists the triggered alerts",
+			params: params{method: http.MethodGet},
+			want:   want{statusCode: http.StatusOK, body: `{"min_stock_bags":10,"alertes":[{"bags":6,"min_bags":10}]}`, minStockBags: 10},
+		},
+		{
+			name:   "changes the minimum of the whole stock",
+			params: params{method: http.MethodPut, body: `{"min_stock_bags":0}`},
+			want:   want{statusCode: http.StatusOK, body: `{"min_stock_bags":0,"alertes":[]}`},
+		},
+		{
+			name:   "rejects negative minimums",
+			params: params{method: http.MethodPut, body: `{"min_stock_bags":-2}`},
+			want:   want{statusCode: http.StatusBadRequest, minStockBags: 10},
+		},
+		{
+			name:   "rejects unknown fields",
+			params: params{method: http.MethodPut, body: `{"seuil":3}`},
+			want:   want{statusCode: http.StatusBadRequest, minStockBags: 10},
+		},
+		{
+			name:   "rejects other methods",
+			params: params{method: http.MethodDelete},
+			want:   want{statusCode: http.StatusMethodNotAllowed, minStockBags: 10},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: alertsDataStore()}
+			server := NewServer(store, Config{})
+			req := httptest.NewRequest(tc.params.method, "/api/alertes", strings.NewReader(tc.params.body))
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			if tc.want.body != "" {
+				assert.JSONEq(t, tc.want.body, rec.Body.String(), tc.name)
+			}
+			assert.Equal(t, tc.want.minStockBags, store.data.MinStockBags, tc.name)
+		})
+	}
+}
+
+func TestServer_handleAlertsForm(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		method string
+		value  string
+	}
+	type want struct {
+		statusCode   int
+		location     string
+		minStockBags int
+		banner       bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "saves the minimum",
+			params: params{method: http.MethodPost, value: "4"},
+			want:   want{statusCode: http.StatusSeeOther, location: "/marques?added=alerts", minStockBags: 4},
+		},
+		{
+			name:   "an empty value disables the alert",
+			params: params{method: http.MethodPost, value: ""},
+			want:   want{statusCode: http.StatusSeeOther, location: "/marques?added=alerts"},
+		},
+		{
+			name:   "rejects invalid values",
+			params: params{method: http.MethodPost, value: "beaucoup"},
+			want:   want{statusCode: http.StatusBadRequest, minStockBags: 10, banner: true},
+		},
+		{
+			name:   "rejects negative values",
+			params: params{method: http.MethodPost, value: "-1"},
+			want:   want{statusCode: http.StatusBadRequest, minStockBags: 10, banner: true},
+		},
+		{
+			name:   "only accepts posts",
+			params: params{method: http.MethodGet},
+			want:   want{statusCode: http.StatusMethodNotAllowed, minStockBags: 10, banner: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: alertsDataStore()}
+			server := NewServer(store, Config{})
+			form := url.Values{"min_stock_bags": {tc.params.value}}
+			req := httptest.NewRequest(tc.params.method, "/alertes", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.location, rec.Header().Get("Location"), tc.name)
+			assert.Equal(t, tc.want.minStockBags, store.data.MinStockBags, tc.name)
+
+			home := httptest.NewRecorder()
+			server.mux.ServeHTTP(home, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, tc.want.banner, strings.Contains(home.Body.String(), "Toutes marques : 6 sacs restants, minimum 10"), tc.name)
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package http
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"pellets-tracker/internal/auth"
+	"pellets-tracker/internal/core"
+)
+
+type apiTokenPayload struct {
+	Name string `json:"name"`
+}
+
+type apiTokenView struct {
+	ID        core.ID   `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// createdAPITokenView is the only response carrying the token itself.
+type createdAPITokenView struct {
+	apiTokenView
+	Token string `json:"token"`
+}
+
+func newAPITokenView(token core.APIToken) apiTokenView {
+	return apiTokenView{ID: token.ID, Name: token.Name, CreatedAt: token.CreatedAt}
+}
+
+// handleAPITokensAPI lists the API tokens of the current user (GET) or
+// creates one (POST). The token is returned once, at its creation.
+func (s *Server) handleAPITokensAPI(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		tokens := core.UserAPITokens(s.store.Data().APITokens, userID)
+		views := make([]apiTokenView, 0, len(tokens))
+		for _, token := range tokens {
+			views = append(views, newAPITokenView(token))
+		}
+		s.writeJSON(w, http.StatusOK, views)
+	case http.MethodPost:
+		s.createAPIToken(w, r, userID)
+	default:
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleAPITokenByIDAPI serves DELETE /api/tokens/{id}, which revokes a token
+// of the current user.
+func (s *Server) handleAPITokenByIDAPI(w http.ResponseWriter, r *http.Request) {
+	id := core.ID(strings.TrimPrefix(r.URL.Path, "/api/tokens/"))
+	if id == "" || strings.ContainsRune(string(id), '/') {
+		s.notFound(w, r)
+		return
+	}
+	userID, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodDelete {
+		s.methodNotAllowed(w, r, http.MethodDelete)
+		return
+	}
+
+	ds := s.store.Data()
+	if err := core.DeleteAPIToken(&ds, id, userID); err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	if err := s.store.Replace(ds); err != nil {
+		s.handleStoreError(w, err)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"api_token","id":"%s","action":"delete"}`, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) createAPIToken(w http.ResponseWriter, r *http.Request, userID core.ID) {
+	var payload apiTokenPayload
+	if err := decodeJSON(r.Body, &payload); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	secret, hash, err := auth.NewAPIToken()
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+
+	ds := s.store.Data()
+	token, err := core.AddAPIToken(&ds, core.CreateAPITokenParams{UserID: userID, Name: payload.Name, Hash: hash})
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	if err := s.store.Replace(ds); err != nil {
+		s.handleStoreError(w, err)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"api_token","id":"%s","action":"create"}`, token.ID)
+	s.writeJSON(w, http.StatusCreated, createdAPITokenView{apiTokenView: newAPITokenView(token), Token: secret})
+}
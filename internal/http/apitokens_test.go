@@ -0,0 +1,156 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/auth"
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_handleAPITokensAPI(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		method   string
+		body     string
+		signedIn bool
+		token    string
+	}
+	type want struct {
+		statusCode int
+		names      []string
+		tokens     int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "requires a user",
+			params: params{method: http.MethodGet},
+			want:   want{statusCode: http.StatusUnauthorized, tokens: 2},
+		},
+		{
+			name:   "lists the tokens of the user",
+			params: params{method: http.MethodGet, token: testAPIToken},
+			want:   want{statusCode: http.StatusOK, names: []string{"Téléphone"}, tokens: 2},
+		},
+		{
+			name:   "creates a token",
+			params: params{method: http.MethodPost, body: `{"name":"HTTP Shortcuts"}`, signedIn: true},
+			want:   want{statusCode: http.StatusCreated, names: []string{"HTTP Shortcuts"}, tokens: 3},
+		},
+		{
+			name:   "requires a name",
+			params: params{method: http.MethodPost, body: `{"name":" "}`, signedIn: true},
+			want:   want{statusCode: http.StatusBadRequest, tokens: 2},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server, store, cookie := newAuthServer(t, true)
+			store.data.APITokens = append(store.data.APITokens, core.APIToken{Meta: core.Meta{ID: "token-b"}, UserID: "user-b", Name: "Tablette", Hash: "b"})
+			req := httptest.NewRequest(tc.params.method, "/api/tokens", strings.NewReader(tc.params.body))
+			if tc.params.signedIn {
+				req.AddCookie(cookie)
+			}
+			if tc.params.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.params.token)
+			}
+			rec := httptest.NewRecorder()
+
+			server.Handler().ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Len(t, store.data.APITokens, tc.want.tokens, tc.name)
+			assert.NotContains(t, rec.Body.String(), `"hash"`, tc.name)
+			switch rec.Code {
+			case http.StatusOK:
+				var views []apiTokenView
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &views), tc.name)
+				names := []string{}
+				for _, view := range views {
+					names = append(names, view.Name)
+				}
+				assert.Equal(t, tc.want.names, names, tc.name)
+			case http.StatusCreated:
+				var created createdAPITokenView
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created), tc.name)
+				assert.Equal(t, tc.want.names, []string{created.Name}, tc.name)
+				stored, ok := auth.FindAPIToken(store.data.APITokens, created.Token)
+				assert.True(t, ok, tc.name)
+				assert.Equal(t, core.ID("user-a"), stored.UserID, tc.name)
+			}
+		})
+	}
+}
+
+func TestServer_handleAPITokenByIDAPI(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		method string
+		id     string
+	}
+	type want struct {
+		statusCode int
+		tokens     []core.ID
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "revokes a token of the user",
+			params: params{method: http.MethodDelete, id: "token-a"},
+			want:   want{statusCode: http.StatusNoContent, tokens: []core.ID{"token-b"}},
+		},
+		{
+			name:   "hides the tokens of other users",
+			params: params{method: http.MethodDelete, id: "token-b"},
+			want:   want{statusCode: http.StatusNotFound, tokens: []core.ID{"token-a", "token-b"}},
+		},
+		{
+			name:   "rejects other methods",
+			params: params{method: http.MethodPut, id: "token-a"},
+			want:   want{statusCode: http.StatusMethodNotAllowed, tokens: []core.ID{"token-a", "token-b"}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server, store, _ := newAuthServer(t, true)
+			store.data.APITokens = append(store.data.APITokens, core.APIToken{Meta: core.Meta{ID: "token-b"}, UserID: "user-b", Name: "Tablette", Hash: "b"})
+			req := httptest.NewRequest(tc.params.method, "/api/tokens/"+tc.params.id, nil)
+			req.Header.Set("Authorization", "Bearer "+testAPIToken)
+			rec := httptest.NewRecorder()
+
+			server.Handler().ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			ids := []core.ID{}
+			for _, token := range store.data.APITokens {
+				ids = append(ids, token.ID)
+			}
+			assert.Equal(t, tc.want.tokens, ids, tc.name)
+		})
+	}
+}
@@ -0,0 +1,479 @@
+package http
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"pellets-tracker/internal/auth"
+	"pellets-tracker/internal/core"
+)
+
+var (
+	errAuthRequired       = errors.New("authentication required")
+	errInvalidCredentials = errors.New("invalid username or password")
+	errInvalidAPIToken    = errors.New("invalid api token")
+)
+
+// authExemptPaths are reachable without a session whatever the method: the
+// login itself, and the admin API guarded by its own token.
+var authExemptPaths = []string{"/connexion", "/deconnexion", "/api/session", "/api/admin/"}
+
+// publicReadPaths stay readable without a session with Config.PrivateReads:
+// the health check and the assets of the login page.
+var publicReadPaths = []string{"/healthz", "/static/"}
+
+// readPosts only read the data despite their method: the Grafana JSON
+// datasource posts its discovery and queries.
+var readPosts = []string{"/api/grafana/metrics", "/api/grafana/search", "/api/grafana/query"}
+
+var loginFormFields = []string{"username", "next"}
+
+type loginView struct {
+	// Username is the signed-in user, empty when the login form is shown,
+	// and Role its role.
+	Username string
+	Role     core.Role
+	// Setup asks for the first account while no user is registered.
+	Setup bool
+	Next  string
+	Form  formState
+}
+
+type credentialsPayload struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type passwordPayload struct {
+	Password string `json:"password"`
+}
+
+// userPayload creates an account; Role defaults to core.RoleEditor.
+type userPayload struct {
+	Username string    `json:"username"`
+	Password string    `json:"password"`
+	Role     core.Role `json:"role"`
+}
+
+type sessionResponse struct {
+	Username  string    `json:"username"`
+	Role      core.Role `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type userView struct {
+	ID        core.ID   `json:"id"`
+	Username  string    `json:"username"`
+	Role      core.Role `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newUserView(user core.User) userView {
+	return userView{ID: user.ID, Username: user.Username, Role: user.AccessRole(), CreatedAt: user.CreatedAt}
+}
+
+// authMiddleware requires a session or an API token for every request that
+// may modify the data, from a user whose role allows the change (see
+// requiredRole). Reads stay open so dashboards and exports keep working,
+// unless they carry a token, which must then be valid, or the reads are
+// private. Until the first account is created only the login page accepts
+// changes.
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	if s.auth == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, hasToken := auth.BearerToken(r)
+		if isAuthExempt(r.URL.Path) || (isRead(r) && !hasToken && s.openRead(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if userID, ok := s.currentUser(r); ok {
+			if !s.userRole(userID).Includes(requiredRole(r, userID)) {
+				s.writeRoleForbidden(w, r, userID)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if hasToken || wantsJSON(r) {
+			s.writeUnauthorized(w, hasToken)
+			return
+		}
+		http.Redirect(w, r, "/connexion?next="+url.QueryEscape(r.URL.Path), http.StatusSeeOther)
+	})
+}
+
+// openRead reports whether the read r may go without a session: always
+// unless the reads are private and an account exists.
+func (s *Server) openRead(r *http.Request) bool {
+	return !s.privateReads || matchesPath(r.URL.Path, publicReadPaths) || len(s.store.Data().Users) == 0
+}
+
+// currentUser returns the user authenticated by the API token of r, or else
+// by its session cookie.
+func (s *Server) currentUser(r *http.Request) (core.ID, bool) {
+	if token, ok := auth.BearerToken(r); ok {
+		apiToken, ok := auth.FindAPIToken(s.store.Data().APITokens, token)
+		return apiToken.UserID, ok
+	}
+	session, ok := s.auth.Session(r)
+	return session.UserID, ok
+}
+
+func (s *Server) writeUnauthorized(w http.ResponseWriter, invalidToken bool) {
+	if invalidToken {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="pellets", error="invalid_token"`)
+		s.writeError(w, http.StatusUnauthorized, errInvalidAPIToken)
+		return
+	}
+	s.writeError(w, http.StatusUnauthorized, errAuthRequired)
+}
+
+// isRead reports whether r only reads the data: a safe method, or one of
+// the readPosts.
+func isRead(r *http.Request) bool {
+	return isSafeMethod(r.Method) || (r.Method == http.MethodPost && matchesPath(strings.TrimSuffix(r.URL.Path, "/"), readPosts))
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+func isAuthExempt(path string) bool {
+	return matchesPath(path, authExemptPaths)
+}
+
+// matchesPath reports whether path is one of paths, those ending with a
+// slash matching the paths below them.
+func matchesPath(path string, paths []string) bool {
+	for _, candidate := range paths {
+		if path == candidate || (strings.HasSuffix(candidate, "/") && strings.HasPrefix(path, candidate)) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleLoginPage serves /connexion: the login form, the creation of the
+// first account while there is none, or the current account with the logout
+// button.
+func (s *Server) handleLoginPage(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		view := loginView{Next: safeNext(r.URL.Query().Get("next"))}
+		if session, ok := s.auth.Session(r); ok {
+			view.Username = session.Username
+			view.Role = s.userRole(session.UserID)
+		}
+		s.renderLoginPage(w, http.StatusOK, view, nil)
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			s.renderLoginPage(w, http.StatusBadRequest, loginView{}, invalidFormFlash())
+			return
+		}
+		if len(s.store.Data().Users) == 0 {
+			s.createFirstUser(w, r)
+			return
+		}
+		s.login(w, r)
+	default:
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	form := newFormState(r, loginFormFields...)
+	user, ok := s.auth.Authenticate(s.store.Data().Users, form.Value("username"), r.FormValue("password"))
+	if !ok {
+		log.Printf(`{"type":"auth","action":"login_failed","username":%q}`, form.Value("username"))
+		view := loginView{Next: safeNext(form.Value("next")), Form: form}
+		s.renderLoginPage(w, http.StatusUnauthorized, view, &flashMessage{Kind: "error", Message: "Identifiant ou mot de passe incorrect."})
+		return
+	}
+	s.startSession(w, r, user, safeNext(form.Value("next")))
+}
+
+func (s *Server) createFirstUser(w http.ResponseWriter, r *http.Request) {
+	form := newFormState(r, loginFormFields...)
+	view := loginView{Setup: true, Next: safeNext(form.Value("next"))}
+	password := r.FormValue("password")
+	if password != r.FormValue("password_confirm") {
+		form.addError("password_confirm", "Les mots de passe ne correspondent pas")
+	}
+	hash, err := s.auth.HashPassword(password)
+	if err != nil {
+		form.addError("password", passwordErrorFR(err))
+	}
+	if form.HasErrors() {
+		view.Form = form
+		s.renderLoginPage(w, http.StatusBadRequest, view, invalidFormFlash())
+		return
+	}
+
+	ds := s.store.Data()
+	user, err := core.AddUser(&ds, core.CreateUserParams{Username: form.Value("username"), PasswordHash: hash})
+	if err != nil {
+		if !form.addValidationErrors(err, nil) {
+			log.Printf("create first user: %v", err)
+		}
+		view.Form = form
+		s.renderLoginPage(w, http.StatusBadRequest, view, invalidFormFlash())
+		return
+	}
+	if err := s.store.Replace(ds); err != nil {
+		log.Printf("store error: %v", err)
+		s.renderLoginPage(w, http.StatusInternalServerError, view, &flashMessage{Kind: "error", Message: "Impossible d'enregistrer le compte."})
+		return
+	}
+	log.Printf(`{"type":"save","entity":"user","id":"%s","action":"create"}`, user.ID)
+	s.startSession(w, r, user, view.Next)
+}
+
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, user core.User, next string) {
+	session, err := s.auth.Login(user)
+	if err != nil {
+		log.Printf("login: %v", err)
+		s.renderErrorPage(w, http.StatusInternalServerError)
+		return
+	}
+	log.Printf(`{"type":"auth","action":"login","user":"%s"}`, user.ID)
+	http.SetCookie(w, auth.Cookie(session, r.TLS != nil))
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// handleLogout closes the session of the browser and goes back to the login
+// form.
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	if session, ok := s.auth.Session(r); ok {
+		s.auth.Logout(session.Token)
+	}
+	http.SetCookie(w, auth.ExpiredCookie(r.TLS != nil))
+	http.Redirect(w, r, "/connexion", http.StatusSeeOther)
+}
+
+func (s *Server) renderLoginPage(w http.ResponseWriter, status int, view loginView, flash *flashMessage) {
+	if view.Username == "" && len(s.store.Data().Users) == 0 {
+		view.Setup = true
+	}
+	s.renderPage(w, status, "login", "Connexion", "account", view, flash)
+}
+
+// handleSessionAPI lets scripts sign in with a JSON body: POST opens a
+// session and sets its cookie, GET describes it and DELETE closes it.
+func (s *Server) handleSessionAPI(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		session, ok := s.auth.Session(r)
+		if !ok {
+			s.writeError(w, http.StatusUnauthorized, errAuthRequired)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, sessionResponse{Username: session.Username, Role: s.userRole(session.UserID), ExpiresAt: session.ExpiresAt})
+	case http.MethodPost:
+		var payload credentialsPayload
+		if err := decodeJSON(r.Body, &payload); err != nil {
+			s.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		user, ok := s.auth.Authenticate(s.store.Data().Users, payload.Username, payload.Password)
+		if !ok {
+			log.Printf(`{"type":"auth","action":"login_failed","username":%q}`, payload.Username)
+			s.writeError(w, http.StatusUnauthorized, errInvalidCredentials)
+			return
+		}
+		session, err := s.auth.Login(user)
+		if err != nil {
+			log.Printf("login: %v", err)
+			s.writeError(w, http.StatusInternalServerError, errors.New("internal error"))
+			return
+		}
+		log.Printf(`{"type":"auth","action":"login","user":"%s"}`, user.ID)
+		http.SetCookie(w, auth.Cookie(session, r.TLS != nil))
+		s.writeJSON(w, http.StatusOK, sessionResponse{Username: session.Username, Role: user.AccessRole(), ExpiresAt: session.ExpiresAt})
+	case http.MethodDelete:
+		if session, ok := s.auth.Session(r); ok {
+			s.auth.Logout(session.Token)
+		}
+		http.SetCookie(w, auth.ExpiredCookie(r.TLS != nil))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
+
+// handleUsersAPI lists and creates the accounts, editors by default. Unlike
+// the other reads, the list requires a signed-in user.
+func (s *Server) handleUsersAPI(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.requireUser(w, r); !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		users := s.store.Data().Users
+		views := make([]userView, 0, len(users))
+		for _, user := range users {
+			views = append(views, newUserView(user))
+		}
+		s.writeJSON(w, http.StatusOK, views)
+	case http.MethodPost:
+		s.createUser(w, r)
+	default:
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleUserByIDAPI changes the password of an account (PUT) or deletes it,
+// closing the sessions of the account either way. PUT on its /role changes
+// its role.
+func (s *Server) handleUserByIDAPI(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/utilisateurs/")
+	id := core.ID(strings.TrimSuffix(rest, "/role"))
+	if id == "" || strings.ContainsRune(string(id), '/') {
+		s.notFound(w, r)
+		return
+	}
+	if _, ok := s.requireUser(w, r); !ok {
+		return
+	}
+	if string(id) != rest {
+		if r.Method != http.MethodPut {
+			s.methodNotAllowed(w, r, http.MethodPut)
+			return
+		}
+		s.updateUserRole(w, r, id)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		s.updateUserPassword(w, r, id)
+	case http.MethodDelete:
+		s.deleteUser(w, id)
+	default:
+		s.methodNotAllowed(w, r, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// requireUser answers 401 unless r comes from a signed-in user or carries one
+// of its API tokens.
+func (s *Server) requireUser(w http.ResponseWriter, r *http.Request) (core.ID, bool) {
+	userID, ok := s.currentUser(r)
+	if !ok {
+		_, hasToken := auth.BearerToken(r)
+		s.writeUnauthorized(w, hasToken)
+	}
+	return userID, ok
+}
+
+func (s *Server) createUser(w http.ResponseWriter, r *http.Request) {
+	var payload userPayload
+	if err := decodeJSON(r.Body, &payload); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	hash, err := s.auth.HashPassword(payload.Password)
+	if err != nil {
+		s.writePasswordError(w, err)
+		return
+	}
+
+	ds := s.store.Data()
+	role := payload.Role
+	if role == "" {
+		role = core.RoleEditor
+	}
+	user, err := core.AddUser(&ds, core.CreateUserParams{Username: payload.Username, PasswordHash: hash, Role: role})
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	if err := s.store.Replace(ds); err != nil {
+		s.handleStoreError(w, err)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"user","id":"%s","action":"create"}`, user.ID)
+	s.writeJSON(w, http.StatusCreated, newUserView(user))
+}
+
+func (s *Server) updateUserPassword(w http.ResponseWriter, r *http.Request, id core.ID) {
+	var payload passwordPayload
+	if err := decodeJSON(r.Body, &payload); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	hash, err := s.auth.HashPassword(payload.Password)
+	if err != nil {
+		s.writePasswordError(w, err)
+		return
+	}
+
+	ds := s.store.Data()
+	user, err := core.SetUserPassword(&ds, id, hash)
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	if err := s.store.Replace(ds); err != nil {
+		s.handleStoreError(w, err)
+		return
+	}
+	s.auth.Revoke(id)
+	log.Printf(`{"type":"save","entity":"user","id":"%s","action":"password"}`, id)
+	s.writeJSON(w, http.StatusOK, newUserView(user))
+}
+
+func (s *Server) deleteUser(w http.ResponseWriter, id core.ID) {
+	ds := s.store.Data()
+	if err := core.DeleteUser(&ds, id); err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	if err := s.store.Replace(ds); err != nil {
+		s.handleStoreError(w, err)
+		return
+	}
+	s.auth.Revoke(id)
+	log.Printf(`{"type":"save","entity":"user","id":"%s","action":"delete"}`, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) writePasswordError(w http.ResponseWriter, err error) {
+	if !auth.IsPasswordError(err) {
+		log.Printf("hash password: %v", err)
+		s.writeError(w, http.StatusInternalServerError, errors.New("internal error"))
+		return
+	}
+	s.writeValidationError(w, core.ValidationErrors{}.AppendIf(true, "password", err.Error()))
+}
+
+func passwordErrorFR(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrPasswordTooShort):
+		return "Le mot de passe doit contenir au moins 8 caractères"
+	case errors.Is(err, auth.ErrPasswordTooLong):
+		return "Le mot de passe est trop long"
+	default:
+		return "Mot de passe invalide"
+	}
+}
+
+// safeNext keeps the page to open after the login on this site.
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
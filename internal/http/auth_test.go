@@ -0,0 +1,310 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"pellets-tracker/internal/auth"
+	"pellets-tracker/internal/core"
+)
+
+const (
+	testPassword = "granulés2024"
+	testAPIToken = "pt_alice"
+)
+
+// newAuthServer returns a server requiring a login, the store holding the
+// user "alice" and her API token testAPIToken when withUser is set, and the
+// cookie of an open session of alice.
+func newAuthServer(t *testing.T, withUser bool) (*Server, *stubDataStore, *http.Cookie) {
+	t.Helper()
+	manager, err := auth.New(auth.Config{BcryptCost: bcrypt.MinCost})
+	require.NoError(t, err)
+	store := &stubDataStore{data: core.DataStore{Brands: []core.Brand{{Meta: core.Meta{ID: "brand-a"}, Name: "Granules"}}}}
+	alice := core.User{Meta: core.Meta{ID: "user-a"}, Username: "alice"}
+	if withUser {
+		alice.PasswordHash, err = manager.HashPassword(testPassword)
+		require.NoError(t, err)
+		store.data.Users = []core.User{alice}
+		store.data.APITokens = []core.APIToken{{Meta: core.Meta{ID: "token-a"}, UserID: alice.ID, Name: "Téléphone", Hash: auth.HashAPIToken(testAPIToken)}}
+	}
+	session, err := manager.Login(alice)
+	require.NoError(t, err)
+	return NewServer(store, Config{Auth: manager}), store, auth.Cookie(session, false)
+}
+
+func TestServer_authMiddleware(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		method      string
+		path        string
+		body        string
+		contentType string
+		signedIn    bool
+		token       string
+	}
+	type want struct {
+		statusCode int
+		location   string
+		replaced   bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "reads stay open",
+			params: params{method: http.MethodGet, path: "/api/marques"},
+			want:   want{statusCode: http.StatusOK},
+		},
+		{
+			name:   "rejects API changes without a session",
+			params: params{method: http.MethodPost, path: "/api/marques", body: `{"name":"Bois Énergie"}`},
+			want:   want{statusCode: http.StatusUnauthorized},
+		},
+		{
+			name:   "sends forms to the login page",
+			params: params{method: http.MethodPost, path: "/marques", body: "name=Bois", contentType: "application/x-www-form-urlencoded"},
+			want:   want{statusCode: http.StatusSeeOther, location: "/connexion?next=%2Fmarques"},
+		},
+		{
+			name:   "accepts changes with a session",
+			params: params{method: http.MethodPost, path: "/api/marques", body: `{"name":"Bois Énergie"}`, signedIn: true},
+			want:   want{statusCode: http.StatusCreated, replaced: true},
+		},
+		{
+			name:   "accepts changes with an API token",
+			params: params{method: http.MethodPost, path: "/api/marques", body: `{"name":"Bois Énergie"}`, token: testAPIToken},
+			want:   want{statusCode: http.StatusCreated, replaced: true},
+		},
+		{
+			name:   "rejects reads with a wrong API token",
+			params: params{method: http.MethodGet, path: "/api/marques", token: "pt_forged"},
+			want:   want{statusCode: http.StatusUnauthorized},
+		},
+		{
+			name:   "leaves the admin API to its token",
+			params: params{method: http.MethodDelete, path: "/api/admin/marques/brand-a", body: `{"confirm":"Granules"}`},
+			want:   want{statusCode: http.StatusForbidden},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server, store, cookie := newAuthServer(t, true)
+			req := httptest.NewRequest(tc.params.method, tc.params.path, strings.NewReader(tc.params.body))
+			if tc.params.contentType != "" {
+				req.Header.Set("Content-Type", tc.params.contentType)
+			}
+			if tc.params.signedIn {
+				req.AddCookie(cookie)
+			}
+			if tc.params.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.params.token)
+			}
+			rec := httptest.NewRecorder()
+
+			server.Handler().ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.location, rec.Header().Get("Location"), tc.name)
+			assert.Equal(t, tc.want.replaced, store.replaced, tc.name)
+		})
+	}
+}
+
+func TestServer_handleLoginPage(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		method   string
+		form     url.Values
+		withUser bool
+		signedIn bool
+	}
+	type want struct {
+		statusCode int
+		location   string
+		contains   string
+		cookie     bool
+		users      []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "asks for the first account",
+			params: params{method: http.MethodGet},
+			want:   want{statusCode: http.StatusOK, contains: "Créer le premier compte", users: []string{}},
+		},
+		{
+			name:   "creates the first account",
+			params: params{method: http.MethodPost, form: url.Values{"username": {"bob"}, "password": {testPassword}, "password_confirm": {testPassword}, "next": {"/stats"}}},
+			want:   want{statusCode: http.StatusSeeOther, location: "/stats", cookie: true, users: []string{"bob"}},
+		},
+		{
+			name:   "checks the confirmation",
+			params: params{method: http.MethodPost, form: url.Values{"username": {"bob"}, "password": {testPassword}, "password_confirm": {"granules"}}},
+			want:   want{statusCode: http.StatusBadRequest, contains: "Les mots de passe ne correspondent pas", users: []string{}},
+		},
+		{
+			name:   "signs in",
+			params: params{method: http.MethodPost, form: url.Values{"username": {"Alice"}, "password": {testPassword}, "next": {"//evil.example"}}, withUser: true},
+			want:   want{statusCode: http.StatusSeeOther, location: "/", cookie: true, users: []string{"alice"}},
+		},
+		{
+			name:   "rejects a wrong password",
+			params: params{method: http.MethodPost, form: url.Values{"username": {"alice"}, "password": {"granules"}}, withUser: true},
+			want:   want{statusCode: http.StatusUnauthorized, contains: "Identifiant ou mot de passe incorrect", users: []string{"alice"}},
+		},
+		{
+			name:   "shows the account",
+			params: params{method: http.MethodGet, withUser: true, signedIn: true},
+			want:   want{statusCode: http.StatusOK, contains: "Se déconnecter", users: []string{"alice"}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server, store, cookie := newAuthServer(t, tc.params.withUser)
+			req := httptest.NewRequest(tc.params.method, "/connexion", strings.NewReader(tc.params.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tc.params.signedIn {
+				req.AddCookie(cookie)
+			}
+			rec := httptest.NewRecorder()
+
+			server.Handler().ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.location, rec.Header().Get("Location"), tc.name)
+			assert.Contains(t, rec.Body.String(), tc.want.contains, tc.name)
+			assert.Equal(t, tc.want.cookie, strings.Contains(rec.Header().Get("Set-Cookie"), auth.CookieName+"="), tc.name)
+			usernames := []string{}
+			for _, user := range store.data.Users {
+				usernames = append(usernames, user.Username)
+			}
+			assert.Equal(t, tc.want.users, usernames, tc.name)
+		})
+	}
+}
+
+func TestServer_handleUsersAPI(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		method   string
+		path     string
+		body     string
+		signedIn bool
+	}
+	type want struct {
+		statusCode int
+		contains   string
+		users      int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "requires a session to list",
+			params: params{method: http.MethodGet, path: "/api/utilisateurs"},
+			want:   want{statusCode: http.StatusUnauthorized, users: 1},
+		},
+		{
+			name:   "lists without the hashes",
+			params: params{method: http.MethodGet, path: "/api/utilisateurs", signedIn: true},
+			want:   want{statusCode: http.StatusOK, contains: `"username":"alice"`, users: 1},
+		},
+		{
+			name:   "creates a user",
+			params: params{method: http.MethodPost, path: "/api/utilisateurs", body: `{"username":"bob","password":"poêle-à-bois"}`, signedIn: true},
+			want:   want{statusCode: http.StatusCreated, contains: `"username":"bob"`, users: 2},
+		},
+		{
+			name:   "rejects short passwords",
+			params: params{method: http.MethodPost, path: "/api/utilisateurs", body: `{"username":"bob","password":"bois"}`, signedIn: true},
+			want:   want{statusCode: http.StatusBadRequest, contains: `"Field":"password"`, users: 1},
+		},
+		{
+			name:   "keeps the last user",
+			params: params{method: http.MethodDelete, path: "/api/utilisateurs/user-a", signedIn: true},
+			want:   want{statusCode: http.StatusConflict, users: 1},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server, store, cookie := newAuthServer(t, true)
+			req := httptest.NewRequest(tc.params.method, tc.params.path, strings.NewReader(tc.params.body))
+			if tc.params.signedIn {
+				req.AddCookie(cookie)
+			}
+			rec := httptest.NewRecorder()
+
+			server.Handler().ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Contains(t, rec.Body.String(), tc.want.contains, tc.name)
+			assert.NotContains(t, rec.Body.String(), "password_hash", tc.name)
+			assert.Len(t, store.data.Users, tc.want.users, tc.name)
+		})
+	}
+}
+
+func TestSafeNext(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		next string
+	}
+	type want struct {
+		next string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "keeps local paths", params: params{next: "/stats?year=2024"}, want: want{next: "/stats?year=2024"}},
+		{name: "defaults to the home page", params: params{next: ""}, want: want{next: "/"}},
+		{name: "rejects absolute URLs", params: params{next: "https://evil.example/"}, want: want{next: "/"}},
+		{name: "rejects scheme relative URLs", params: params{next: "//evil.example"}, want: want{next: "/"}},
+		{name: "rejects backslashes", params: params{next: "/\\evil.example"}, want: want{next: "/"}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.want.next, safeNext(tc.params.next), tc.name)
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"pellets-tracker/internal/core"
+)
+
+// Operations accepted by /api/batch.
+const (
+	batchCreatePurchase    = "create_purchase"
+	batchCreateConsumption = "create_consumption"
+	batchUpdateBrand       = "update_brand"
+)
+
+// maxBatchOperations bounds the size of a single batch.
+const maxBatchOperations = 500
+
+var errBatchNotApplied = errors.New("not applied: an earlier operation failed")
+
+type batchRequest struct {
+	Operations []batchOperation `json:"operations"`
+}
+
+type batchOperation struct {
+	Op string `json:"op"`
+	// ID designates the entity to update.
+	ID   core.ID         `json:"id,omitempty"`
+	Data json.RawMessage `json:"data"`
+}
+
+// brandUpdatePayload changes only the brand fields that are present.
+type brandUpdatePayload struct {
+	Name           *string  `json:"name"`
+	Description    *string  `json:"description"`
+	ImageBase64    *string  `json:"image_base64"`
+	LeadTimeDays   *int     `json:"lead_time_days"`
+	EnergyKWhPerKg *float64 `json:"energy_kwh_per_kg"`
+	MinStockBags   *int     `json:"min_stock_bags"`
+	Archived       *bool    `json:"archived"`
+	// Revision rejects the update when the brand changed since it was read.
+	Revision *int64 `json:"revision"`
+}
+
+type batchResponse struct {
+	// Committed is false when an operation failed: nothing was saved then.
+	Committed bool          `json:"committed"`
+	Results   []batchResult `json:"results"`
+}
+
+type batchResult struct {
+	Op     string                `json:"op"`
+	Status int                   `json:"status"`
+	Result any                   `json:"result,omitempty"`
+	Error  string                `json:"error,omitempty"`
+	Fields core.ValidationErrors `json:"details,omitempty"`
+}
+
+// handleBatchAPI applies a list of operations in order to a single snapshot
+// of the datastore, saved once when all of them succeed. Later operations see
+// the entities created by earlier ones, so a client can replay an offline
+// queue or an import without leaving it half applied.
+func (s *Server) handleBatchAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	var req batchRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	switch {
+	case len(req.Operations) == 0:
+		s.writeError(w, http.StatusBadRequest, errors.New("no operations"))
+		return
+	case len(req.Operations) > maxBatchOperations:
+		s.writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("too many operations, at most %d per batch", maxBatchOperations))
+		return
+	}
+
+	results := make([]batchResult, len(req.Operations))
+	failed := -1
+	err := s.update(func(ds *core.DataStore) error {
+		for i, op := range req.Operations {
+			results[i].Op = op.Op
+			if failed >= 0 {
+				results[i].Status = http.StatusFailedDependency
+				results[i].Error = errBatchNotApplied.Error()
+				continue
+			}
+			status, result, err := applyBatchOperation(ds, op)
+			results[i].Status = status
+			if err != nil {
+				failed = i
+				results[i].Error = err.Error()
+				var ve core.ValidationErrors
+				if errors.As(err, &ve) {
+					results[i].Fields = ve
+				}
+				continue
+			}
+			results[i].Result = result
+		}
+		if failed >= 0 {
+			return errBatchNotApplied
+		}
+		return nil
+	})
+	if failed >= 0 {
+		s.writeJSON(w, results[failed].Status, batchResponse{Results: results})
+		return
+	}
+	if err != nil {
+		s.handleUpdateError(w, err)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"batch","operations":%d}`, len(results))
+	s.writeJSON(w, http.StatusOK, batchResponse{Committed: true, Results: results})
+}
+
+// applyBatchOperation runs one operation against ds and returns the status
+// the equivalent single request would have answered.
+func applyBatchOperation(ds *core.DataStore, op batchOperation) (int, any, error) {
+	var (
+		status int
+		result any
+		err    error
+	)
+	switch op.Op {
+	case batchCreatePurchase:
+		status = http.StatusCreated
+		result, err = batchCreatePurchaseOp(ds, op.Data)
+	case batchCreateConsumption:
+		status = http.StatusCreated
+		result, err = batchCreateConsumptionOp(ds, op.Data)
+	case batchUpdateBrand:
+		status = http.StatusOK
+		result, err = batchUpdateBrandOp(ds, op.ID, op.Data)
+	default:
+		return http.StatusBadRequest, nil, fmt.Errorf("unknown operation %q", op.Op)
+	}
+	if err == nil {
+		return status, result, nil
+	}
+	if status, ok := coreErrorStatus(err); ok {
+		return status, nil, err
+	}
+	var pe payloadError
+	if errors.As(err, &pe) {
+		return http.StatusBadRequest, nil, err
+	}
+	return http.StatusInternalServerError, nil, err
+}
+
+// payloadError marks the operations whose data cannot be decoded.
+type payloadError struct{ err error }
+
+func (e payloadError) Error() string { return e.err.Error() }
+func (e payloadError) Unwrap() error { return e.err }
+
+func batchCreatePurchaseOp(ds *core.DataStore, data json.RawMessage) (core.Purchase, error) {
+	var payload purchasePayload
+	if err := decodeJSON(bytes.NewReader(data), &payload); err != nil {
+		return core.Purchase{}, payloadError{err}
+	}
+	params, err := payload.params()
+	if err != nil {
+		return core.Purchase{}, payloadError{err}
+	}
+	return core.AddPurchase(ds, params)
+}
+
+func batchCreateConsumptionOp(ds *core.DataStore, data json.RawMessage) (core.Consumption, error) {
+	var payload consumptionPayload
+	if err := decodeJSON(bytes.NewReader(data), &payload); err != nil {
+		return core.Consumption{}, payloadError{err}
+	}
+	params, err := payload.params()
+	if err != nil {
+		return core.Consumption{}, payloadError{err}
+	}
+	return core.AddConsumption(ds, params)
+}
+
+func batchUpdateBrandOp(ds *core.DataStore, id core.ID, data json.RawMessage) (core.Brand, error) {
+	var payload brandUpdatePayload
+	if err := decodeJSON(bytes.NewReader(data), &payload); err != nil {
+		return core.Brand{}, payloadError{err}
+	}
+	return updateBrand(ds, id, payload)
+}
+
+// updateBrand applies the fields present in payload to the brand id.
+func updateBrand(ds *core.DataStore, id core.ID, payload brandUpdatePayload) (core.Brand, error) {
+	var current *core.Brand
+	for i := range ds.Brands {
+		if ds.Brands[i].ID == id {
+			current = &ds.Brands[i]
+			break
+		}
+	}
+	if current == nil {
+		return core.Brand{}, core.ErrBrandNotFound
+	}
+	params := core.UpdateBrandParams{
+		Name:             current.Name,
+		Description:      current.Description,
+		ImageBase64:      current.ImageBase64,
+		LeadTimeDays:     current.LeadTimeDays,
+		EnergyKWhPerKg:   current.EnergyKWhPerKg,
+		MinStockBags:     current.MinStockBags,
+		Archived:         current.Archived,
+		ExpectedRevision: payload.Revision,
+	}
+	if payload.Name != nil {
+		params.Name = *payload.Name
+	}
+	if payload.Description != nil {
+		params.Description = *payload.Description
+	}
+	if payload.ImageBase64 != nil {
+		params.ImageBase64 = *payload.ImageBase64
+	}
+	if payload.LeadTimeDays != nil {
+		params.LeadTimeDays = *payload.LeadTimeDays
+	}
+	if payload.EnergyKWhPerKg != nil {
+		params.EnergyKWhPerKg = *payload.EnergyKWhPerKg
+	}
+	if payload.MinStockBags != nil {
+		params.MinStockBags = *payload.MinStockBags
+	}
+	if payload.Archived != nil {
+		params.Archived = *payload.Archived
+	}
+	return core.UpdateBrand(ds, id, params)
+}
@@ -0,0 +1,128 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_handleBatchAPI(t *testing.T) {
+	t.Parallel()
+
+	brand := core.Brand{Meta: core.Meta{ID: "brand-1"}, Name: "Bois & Co", Description: "Premium", ImageBase64: "iVBORw0KGgo="}
+
+	type params struct {
+		method string
+		body   string
+	}
+	type want struct {
+		statusCode   int
+		committed    bool
+		statuses     []int
+		replaced     bool
+		purchases    int
+		consumptions int
+		brandName    string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "applies every operation",
+			params: params{method: http.MethodPost, body: `{"operations":[
+				{"op":"create_purchase","data":{"brand_id":"brand-1","purchased_at":"2024-01-10T00:00:00Z","bags":10,"bag_weight_kg":15,"unit_price_cents":550}},
+				{"op":"create_consumption","data":{"brand_id":"brand-1","consumed_at":"2024-01-12T00:00:00Z","bags":2}},
+				{"op":"update_brand","id":"brand-1","data":{"name":"Bois et Compagnie"}}
+			]}`},
+			want: want{
+				statusCode:   http.StatusOK,
+				committed:    true,
+				statuses:     []int{http.StatusCreated, http.StatusCreated, http.StatusOK},
+				replaced:     true,
+				purchases:    1,
+				consumptions: 1,
+				brandName:    "Bois et Compagnie",
+			},
+		},
+		{
+			name: "rolls back when an operation fails",
+			params: params{method: http.MethodPost, body: `{"operations":[
+				{"op":"create_purchase","data":{"brand_id":"brand-1","purchased_at":"2024-01-10T00:00:00Z","bags":2,"bag_weight_kg":15,"unit_price_cents":550}},
+				{"op":"create_consumption","data":{"brand_id":"brand-1","consumed_at":"2024-01-12T00:00:00Z","bags":0}},
+				{"op":"update_brand","id":"brand-1","data":{"name":"Bois et Compagnie"}}
+			]}`},
+			want: want{
+				statusCode: http.StatusBadRequest,
+				statuses:   []int{http.StatusCreated, http.StatusBadRequest, http.StatusFailedDependency},
+				brandName:  "Bois & Co",
+			},
+		},
+		{
+			name: "reports unknown brand",
+			params: params{method: http.MethodPost, body: `{"operations":[
+				{"op":"update_brand","id":"missing","data":{"name":"Autre"}}
+			]}`},
+			want: want{statusCode: http.StatusNotFound, statuses: []int{http.StatusNotFound}, brandName: "Bois & Co"},
+		},
+		{
+			name: "rejects unknown operation",
+			params: params{method: http.MethodPost, body: `{"operations":[
+				{"op":"delete_everything","data":{}}
+			]}`},
+			want: want{statusCode: http.StatusBadRequest, statuses: []int{http.StatusBadRequest}, brandName: "Bois & Co"},
+		},
+		{
+			name:   "rejects empty batch",
+			params: params{method: http.MethodPost, body: `{"operations":[]}`},
+			want:   want{statusCode: http.StatusBadRequest, brandName: "Bois & Co"},
+		},
+		{
+			name:   "rejects reads",
+			params: params{method: http.MethodGet},
+			want:   want{statusCode: http.StatusMethodNotAllowed, brandName: "Bois & Co"},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: core.DataStore{Brands: []core.Brand{brand}}}
+			server := NewServer(store, Config{})
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, httptest.NewRequest(tc.params.method, "/api/batch", strings.NewReader(tc.params.body)))
+
+			require.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.replaced, store.replaced, tc.name)
+			assert.Len(t, store.data.Purchases, tc.want.purchases, tc.name)
+			assert.Len(t, store.data.Consumptions, tc.want.consumptions, tc.name)
+			require.Len(t, store.data.Brands, 1, tc.name)
+			assert.Equal(t, tc.want.brandName, store.data.Brands[0].Name, tc.name)
+			assert.Equal(t, brand.ImageBase64, store.data.Brands[0].ImageBase64, tc.name)
+			if tc.want.statuses == nil {
+				return
+			}
+
+			var resp batchResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp), tc.name)
+			assert.Equal(t, tc.want.committed, resp.Committed, tc.name)
+			statuses := make([]int, 0, len(resp.Results))
+			for _, result := range resp.Results {
+				statuses = append(statuses, result.Status)
+			}
+			assert.Equal(t, tc.want.statuses, statuses, tc.name)
+		})
+	}
+}
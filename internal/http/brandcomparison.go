@@ -0,0 +1,89 @@
+package http
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"pellets-tracker/internal/core"
+)
+
+// brandComparisonColumns are the columns of /api/export/brands-comparison.
+var brandComparisonColumns = []string{
+	"brand_id", "brand_name", "lead_time_days", "purchases", "bags_bought", "weight_kg",
+	"total_spent_cents", "average_bag_price_cents", "price_per_kg_cents",
+	"first_bag_price_cents", "last_bag_price_cents", "price_trend_percent",
+	"first_purchase", "last_purchase", "bags_consumed", "bags_in_stock",
+}
+
+// exportBrandComparison writes one CSV line per brand with the figures used
+// to compare them before ordering. from and to restrict the purchases and
+// consumptions taken into account; the stock is the current one.
+func (s *Server) exportBrandComparison(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseRangeQuery(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid range: %w", err))
+		return
+	}
+	format, err := s.csvExportFormat(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	ds := s.store.Data()
+	ctx, cancel := s.computeContext(r)
+	defer cancel()
+	comparison, err := core.ComputeBrandComparison(ctx, &ds, from, to)
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", "attachment; filename=pellets-comparatif-marques.csv")
+	writer := format.writer(w)
+	if err := writer.Write(brandComparisonColumns); err != nil {
+		log.Printf("export brand comparison header: %v", err)
+		return
+	}
+	for _, line := range comparison {
+		if err := writer.Write(brandComparisonRecord(line, format)); err != nil {
+			log.Printf("export brand comparison: %v", err)
+			return
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Printf("export brand comparison flush: %v", err)
+	}
+}
+
+// brandComparisonRecord formats a line; figures that do not apply, such as
+// prices of a brand never bought in the range, are left empty.
+func brandComparisonRecord(line core.BrandComparison, format csvFormat) []string {
+	record := []string{
+		string(line.BrandID),
+		line.BrandName,
+		itoaInt(line.LeadTimeDays),
+		itoaInt(line.Purchases),
+		itoaInt(line.BagsBought),
+		format.number(formatFloat(line.WeightKg)),
+		itoaMoney(line.TotalSpent),
+		"", "", "", "", "", "", "",
+		format.number(formatFloat(line.BagsConsumed)),
+		itoaInt(line.BagsInStock),
+	}
+	if line.Purchases > 0 {
+		record[7] = itoaMoney(line.AverageBagPrice)
+		record[8] = itoaMoney(line.PricePerKg)
+		record[9] = itoaMoney(line.FirstBagPrice)
+		record[10] = itoaMoney(line.LastBagPrice)
+		record[12] = format.date(line.FirstPurchaseAt)
+		record[13] = format.date(line.LastPurchaseAt)
+	}
+	if line.PriceTrendPercent != nil {
+		record[11] = format.number(strconv.FormatFloat(*line.PriceTrendPercent, 'f', 1, 64))
+	}
+	return record
+}
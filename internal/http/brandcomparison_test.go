@@ -0,0 +1,107 @@
+package http
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_exportBrandComparison(t *testing.T) {
+	t.Parallel()
+
+	store := &stubDataStore{data: core.DataStore{
+		Brands: []core.Brand{
+			{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"},
+			{Meta: core.Meta{ID: "brand-n"}, Name: "Nouvelle"},
+		},
+		Purchases: []core.Purchase{
+			{Meta: core.Meta{ID: "p2"}, BrandID: "brand-w", PurchasedAt: time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC), Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 660, TotalPriceCents: 6600},
+			{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: time.Date(2023, time.September, 1, 0, 0, 0, 0, time.UTC), Bags: 30, BagWeightKg: 15, TotalWeightKg: 450, UnitPriceCents: 600, TotalPriceCents: 18000},
+		},
+	}}
+
+	type params struct {
+		query string
+	}
+	type want struct {
+		statusCode int
+		comma      rune
+		records    [][]string
+	}
+
+	header := brandComparisonColumns
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "writes a line per brand",
+			want: want{statusCode: http.StatusOK, records: [][]string{
+				header,
+				{"brand-n", "Nouvelle", "0", "0", "0", "0", "0", "", "", "", "", "", "", "", "0", "0"},
+				{"brand-w", "Woodstock", "0", "2", "40", "600", "24600", "615", "41", "600", "660", "10.0", "2023-09-01T00:00:00Z", "2024-09-01T00:00:00Z", "0", "40"},
+			}},
+		},
+		{
+			name:   "restricts the range",
+			params: params{query: "?from=2024-01-01T00:00:00Z"},
+			want: want{statusCode: http.StatusOK, records: [][]string{
+				header,
+				{"brand-n", "Nouvelle", "0", "0", "0", "0", "0", "", "", "", "", "", "", "", "0", "0"},
+				{"brand-w", "Woodstock", "0", "1", "10", "150", "6600", "660", "44", "660", "660", "", "2024-09-01T00:00:00Z", "2024-09-01T00:00:00Z", "0", "40"},
+			}},
+		},
+		{
+			name:   "writes the French Excel format",
+			params: params{query: "?format=excel-fr"},
+			want: want{statusCode: http.StatusOK, comma: ';', records: [][]string{
+				header,
+				{"brand-n", "Nouvelle", "0", "0", "0", "0", "0", "", "", "", "", "", "", "", "0", "0"},
+				{"brand-w", "Woodstock", "0", "2", "40", "600", "24600", "615", "41", "600", "660", "10,0", "01/09/2023", "01/09/2024", "0", "40"},
+			}},
+		},
+		{
+			name:   "rejects an unknown format",
+			params: params{query: "?format=excel"},
+			want:   want{statusCode: http.StatusBadRequest},
+		},
+		{
+			name:   "rejects an invalid range",
+			params: params{query: "?from=2024"},
+			want:   want{statusCode: http.StatusBadRequest},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(store, Config{})
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/export/brands-comparison"+tc.params.query, nil))
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			if tc.want.records == nil {
+				return
+			}
+			reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(rec.Body.String(), "\ufeff")))
+			if tc.want.comma != 0 {
+				reader.Comma = tc.want.comma
+			}
+			records, err := reader.ReadAll()
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.records, records, tc.name)
+		})
+	}
+}
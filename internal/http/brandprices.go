@@ -0,0 +1,69 @@
+package http
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"pellets-tracker/internal/core"
+)
+
+// handleBrandByIDAPI serves the brand sub-resources. GET
+// /api/marques/{id}/prix returns the price history of the brand and
+// /api/marques/{id}/photos its gallery, see handlePhotosAPI. POST
+// /api/marques/{id}/archiver archives the brand and /desarchiver restores it.
+func (s *Server) handleBrandByIDAPI(w http.ResponseWriter, r *http.Request) {
+	if target, ok := parsePhotoPath(r.URL.Path, brandPhotos.apiPrefix); ok {
+		s.handlePhotosAPI(w, r, brandPhotos, target)
+		return
+	}
+	rest := strings.TrimPrefix(r.URL.Path, "/api/marques/")
+	id, action, _ := strings.Cut(rest, "/")
+	switch {
+	case id == "":
+		s.notFound(w, r)
+	case action == "" && !strings.HasSuffix(rest, "/"):
+		s.brandByID(w, r, core.ID(id))
+	case action == "prix":
+		s.brandPriceHistory(w, r, core.ID(id))
+	case action == "archiver" || action == "desarchiver":
+		s.archiveBrand(w, r, core.ID(id), action == "archiver")
+	default:
+		s.notFound(w, r)
+	}
+}
+
+func (s *Server) brandPriceHistory(w http.ResponseWriter, r *http.Request, id core.ID) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	ds := s.store.Data()
+	history, err := core.ComputeBrandPriceHistory(&ds, id)
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, history)
+}
+
+// archiveBrand hides a brand from the forms and the default listings, or
+// restores it, answering with the brand.
+func (s *Server) archiveBrand(w http.ResponseWriter, r *http.Request, id core.ID, archived bool) {
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	ds := s.store.Data()
+	brand, err := core.SetBrandArchived(&ds, id, archived)
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	if err := s.store.Replace(ds); err != nil {
+		s.handleStoreError(w, err)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"brand","id":"%s","action":"archive","archived":%t}`, brand.ID, archived)
+	s.writeJSON(w, http.StatusOK, brand)
+}
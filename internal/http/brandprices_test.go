@@ -0,0 +1,97 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_handleBrandByIDAPI(t *testing.T) {
+	t.Parallel()
+
+	store := &stubDataStore{data: core.DataStore{
+		Brands: []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}},
+		Purchases: []core.Purchase{
+			{Meta: core.Meta{ID: "p2"}, BrandID: "brand-w", PurchasedAt: time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC), Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 660, TotalPriceCents: 6600},
+			{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: time.Date(2023, time.September, 1, 0, 0, 0, 0, time.UTC), Bags: 30, BagWeightKg: 15, TotalWeightKg: 450, UnitPriceCents: 600, TotalPriceCents: 18000},
+		},
+	}}
+
+	type params struct {
+		method string
+		path   string
+	}
+	type want struct {
+		statusCode int
+		prices     []core.Money
+		years      []int
+		trend      float64
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "returns the price history",
+			params: params{method: http.MethodGet, path: "/api/marques/brand-w/prix"},
+			want:   want{statusCode: http.StatusOK, prices: []core.Money{600, 660}, years: []int{2023, 2024}, trend: 10},
+		},
+		{
+			name:   "reports unknown brands",
+			params: params{method: http.MethodGet, path: "/api/marques/brand-x/prix"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "ignores other sub-resources",
+			params: params{method: http.MethodGet, path: "/api/marques/brand-w/stock"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "is read-only",
+			params: params{method: http.MethodPost, path: "/api/marques/brand-w/prix"},
+			want:   want{statusCode: http.StatusMethodNotAllowed},
+		},
+	}
+
+	server := NewServer(store, Config{})
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(tc.params.method, tc.params.path, nil)
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			if tc.want.statusCode != http.StatusOK {
+				return
+			}
+			var history core.BrandPriceHistory
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &history), tc.name)
+			prices := []core.Money{}
+			for _, point := range history.Points {
+				prices = append(prices, point.UnitPrice)
+			}
+			years := []int{}
+			for _, year := range history.Years {
+				years = append(years, year.Year)
+			}
+			assert.Equal(t, tc.want.prices, prices, tc.name)
+			assert.Equal(t, tc.want.years, years, tc.name)
+			if assert.NotNil(t, history.TrendPercent, tc.name) {
+				assert.InDelta(t, tc.want.trend, *history.TrendPercent, 0.001, tc.name)
+			}
+		})
+	}
+}
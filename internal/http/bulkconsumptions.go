@@ -0,0 +1,78 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"pellets-tracker/internal/core"
+)
+
+type bulkConsumptionsResponse struct {
+	// Committed is false when an entry failed: nothing was saved then.
+	Committed bool                    `json:"committed"`
+	Results   []bulkConsumptionResult `json:"results"`
+}
+
+type bulkConsumptionResult struct {
+	Index       int                   `json:"index"`
+	Status      int                   `json:"status"`
+	Consumption *core.Consumption     `json:"consumption,omitempty"`
+	Error       string                `json:"error,omitempty"`
+	Fields      core.ValidationErrors `json:"details,omitempty"`
+}
+
+// createConsumptions serves POST /api/consommations/bulk: an array of
+// consumptions, such as one per day typed in after a holiday, saved at once
+// when all of them are valid. Unlike /api/batch, every entry is checked
+// even after a failure so all the mistakes are reported in one answer.
+func (s *Server) createConsumptions(w http.ResponseWriter, r *http.Request) {
+	var entries []json.RawMessage
+	if err := decodeJSON(r.Body, &entries); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	switch {
+	case len(entries) == 0:
+		s.writeError(w, http.StatusBadRequest, errors.New("no consumptions"))
+		return
+	case len(entries) > maxBatchOperations:
+		s.writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("too many consumptions, at most %d per request", maxBatchOperations))
+		return
+	}
+
+	ds := s.store.Data()
+	results := make([]bulkConsumptionResult, len(entries))
+	failed := -1
+	for i, entry := range entries {
+		results[i].Index = i
+		status, result, err := applyBatchOperation(&ds, batchOperation{Op: batchCreateConsumption, Data: entry})
+		results[i].Status = status
+		if err != nil {
+			if failed < 0 {
+				failed = i
+			}
+			results[i].Error = err.Error()
+			var ve core.ValidationErrors
+			if errors.As(err, &ve) {
+				results[i].Fields = ve
+			}
+			continue
+		}
+		consumption := result.(core.Consumption)
+		results[i].Consumption = &consumption
+	}
+	if failed >= 0 {
+		s.writeJSON(w, results[failed].Status, bulkConsumptionsResponse{Results: results})
+		return
+	}
+
+	if err := s.store.Replace(ds); err != nil {
+		s.handleStoreError(w, err)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"consumption","action":"bulk","count":%d}`, len(results))
+	s.writeJSON(w, http.StatusCreated, bulkConsumptionsResponse{Committed: true, Results: results})
+}
@@ -0,0 +1,124 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_createConsumptions(t *testing.T) {
+	t.Parallel()
+
+	data := core.DataStore{
+		Brands: []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}},
+		Purchases: []core.Purchase{{
+			Meta:            core.Meta{ID: "p1"},
+			BrandID:         "brand-w",
+			PurchasedAt:     time.Date(2024, time.December, 1, 0, 0, 0, 0, time.UTC),
+			Bags:            10,
+			BagWeightKg:     15,
+			TotalWeightKg:   150,
+			UnitPriceCents:  550,
+			TotalPriceCents: 5500,
+		}},
+	}
+
+	type params struct {
+		method string
+		body   string
+	}
+	type want struct {
+		statusCode   int
+		committed    bool
+		statuses     []int
+		fields       []string
+		consumptions int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "records every consumption",
+			params: params{method: http.MethodPost, body: `[
+				{"brand_id":"brand-w","consumed_at":"2024-12-20T00:00:00Z","bags":1},
+				{"brand_id":"brand-w","consumed_at":"2024-12-21T00:00:00Z","bags":1},
+				{"brand_id":"brand-w","consumed_at":"2024-12-22T00:00:00Z","bags":2}
+			]`},
+			want: want{
+				statusCode:   http.StatusCreated,
+				committed:    true,
+				statuses:     []int{http.StatusCreated, http.StatusCreated, http.StatusCreated},
+				consumptions: 3,
+			},
+		},
+		{
+			name: "reports every invalid entry and saves nothing",
+			params: params{method: http.MethodPost, body: `[
+				{"brand_id":"brand-w","consumed_at":"2024-12-20T00:00:00Z","bags":1},
+				{"brand_id":"brand-w","consumed_at":"2024-12-21T00:00:00Z","bags":0},
+				{"brand_id":"missing","consumed_at":"2024-12-22T00:00:00Z","bags":1}
+			]`},
+			want: want{
+				statusCode: http.StatusBadRequest,
+				statuses:   []int{http.StatusCreated, http.StatusBadRequest, http.StatusBadRequest},
+				fields:     []string{"", "bags", "brand_id"},
+			},
+		},
+		{
+			name:   "rejects an empty list",
+			params: params{method: http.MethodPost, body: `[]`},
+			want:   want{statusCode: http.StatusBadRequest},
+		},
+		{
+			name:   "rejects other methods",
+			params: params{method: http.MethodGet},
+			want:   want{statusCode: http.StatusMethodNotAllowed},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: data}
+			server := NewServer(store, Config{})
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, httptest.NewRequest(tc.params.method, "/api/consommations/bulk", strings.NewReader(tc.params.body)))
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.committed, store.replaced, tc.name)
+			assert.Len(t, store.data.Consumptions, tc.want.consumptions, tc.name)
+			if tc.want.statuses == nil {
+				return
+			}
+			var resp bulkConsumptionsResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp), tc.name)
+			assert.Equal(t, tc.want.committed, resp.Committed, tc.name)
+			require.Len(t, resp.Results, len(tc.want.statuses), tc.name)
+			for i, result := range resp.Results {
+				assert.Equal(t, i, result.Index, tc.name)
+				assert.Equal(t, tc.want.statuses[i], result.Status, tc.name)
+				if tc.want.statuses[i] == http.StatusCreated {
+					assert.NotNil(t, result.Consumption, tc.name)
+				}
+				if tc.want.fields != nil && tc.want.fields[i] != "" {
+					require.NotEmpty(t, result.Fields, tc.name)
+					assert.Equal(t, tc.want.fields[i], result.Fields[0].Field, tc.name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package http
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"pellets-tracker/internal/core"
+)
+
+// calendarView is the month grid of the calendar page, weeks starting on
+// Monday.
+type calendarView struct {
+	core.ConsumptionCalendar
+	Label    string
+	Value    string
+	Previous string
+	Next     string
+	Weeks    [][]calendarCell
+}
+
+// calendarCell is a square of the calendar grid. Blank squares pad the weeks
+// overlapping the previous or the next month.
+type calendarCell struct {
+	core.CalendarDay
+	Blank bool
+	Today bool
+	// Heat grades the bags of the day from 1 to 5 against the busiest day
+	// of the month, 0 without consumption.
+	Heat int
+}
+
+// handleCalendarPage serves /calendrier?month=2024-11, the bags consumed
+// each day of a month, the current one without month.
+func (s *Server) handleCalendarPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	month, err := calendarMonth(r)
+	if err != nil {
+		s.renderErrorPage(w, http.StatusBadRequest)
+		return
+	}
+	ds := s.store.Data()
+	calendar := core.ComputeConsumptionCalendar(&ds, month)
+	s.renderPage(w, http.StatusOK, "calendar", "Calendrier", "calendar", newCalendarView(calendar, today()), nil)
+}
+
+// handleCalendarAPI serves GET /api/calendrier?month=2024-11, the per-day
+// aggregation behind the calendar page.
+func (s *Server) handleCalendarAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	month, err := calendarMonth(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	ds := s.store.Data()
+	s.writeJSON(w, http.StatusOK, core.ComputeConsumptionCalendar(&ds, month))
+}
+
+// calendarMonth reads the month query parameter, the current month when it
+// is missing.
+func calendarMonth(r *http.Request) (time.Time, error) {
+	value := r.URL.Query().Get("month")
+	if value == "" {
+		return today(), nil
+	}
+	return core.ParseMonth(value)
+}
+
+func newCalendarView(calendar core.ConsumptionCalendar, now time.Time) calendarView {
+	view := calendarView{
+		ConsumptionCalendar: calendar,
+		Label:               formatMonthLabel(calendar.Month),
+		Value:               core.FormatMonth(calendar.Month),
+		Previous:            core.FormatMonth(calendar.Month.AddDate(0, -1, 0)),
+		Next:                core.FormatMonth(calendar.Month.AddDate(0, 1, 0)),
+	}
+	// time.Weekday counts from Sunday, the grid from Monday.
+	week := make([]calendarCell, (int(calendar.Month.Weekday())+6)%7)
+	for i := range week {
+		week[i].Blank = true
+	}
+	for _, day := range calendar.Days {
+		cell := calendarCell{CalendarDay: day, Today: day.Date.Equal(now)}
+		if day.Bags > 0 && calendar.MaxBags > 0 {
+			cell.Heat = 1 + int(math.Round(day.Bags/calendar.MaxBags*4))
+		}
+		week = append(week, cell)
+		if len(week) == 7 {
+			view.Weeks = append(view.Weeks, week)
+			week = nil
+		}
+	}
+	if len(week) > 0 {
+		for len(week) < 7 {
+			week = append(week, calendarCell{Blank: true})
+		}
+		view.Weeks = append(view.Weeks, week)
+	}
+	return view
+}
@@ -0,0 +1,108 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_calendar(t *testing.T) {
+	t.Parallel()
+
+	store := &stubDataStore{data: core.DataStore{
+		Brands: []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}},
+		Consumptions: []core.Consumption{
+			{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: time.Date(2024, time.January, 10, 8, 0, 0, 0, time.UTC), Bags: 1},
+			{Meta: core.Meta{ID: "c2"}, BrandID: "brand-w", ConsumedAt: time.Date(2024, time.January, 10, 20, 0, 0, 0, time.UTC), Bags: 2},
+			{Meta: core.Meta{ID: "c3"}, BrandID: "brand-w", ConsumedAt: time.Date(2024, time.January, 12, 0, 0, 0, 0, time.UTC), Bags: 1},
+		},
+	}}
+
+	type params struct {
+		method string
+		path   string
+	}
+	type want struct {
+		statusCode int
+		contains   []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "renders the month grid",
+			params: params{method: http.MethodGet, path: "/calendrier?month=2024-01"},
+			want: want{statusCode: http.StatusOK, contains: []string{
+				"Jan. 2024",
+				"4 sacs · 2 jours de chauffe",
+				`<td class="heat-5" title="10 janv. · 3 sacs">`,
+				`<td class="heat-2" title="12 janv. · 1 sac">`,
+				`href="/calendrier?month=2023-12"`,
+				`href="/calendrier?month=2024-02"`,
+				`value="2024-01"`,
+			}},
+		},
+		{
+			name:   "pads the weeks from Monday",
+			params: params{method: http.MethodGet, path: "/calendrier?month=2024-02"},
+			want:   want{statusCode: http.StatusOK, contains: []string{`<td class="blank"></td>`, "Aucune consommation enregistrée ce mois-ci."}},
+		},
+		{
+			name:   "opens on the current month",
+			params: params{method: http.MethodGet, path: "/calendrier"},
+			want:   want{statusCode: http.StatusOK, contains: []string{`value="` + core.FormatMonth(time.Now()) + `"`}},
+		},
+		{
+			name:   "rejects a malformed month",
+			params: params{method: http.MethodGet, path: "/calendrier?month=janvier"},
+			want:   want{statusCode: http.StatusBadRequest},
+		},
+		{
+			name:   "aggregates the days as JSON",
+			params: params{method: http.MethodGet, path: "/api/calendrier?month=2024-01"},
+			want: want{statusCode: http.StatusOK, contains: []string{
+				`"month":"2024-01-01T00:00:00Z"`,
+				`"total_bags":4`,
+				`"max_bags":3`,
+				`{"date":"2024-01-10T00:00:00Z","bags":3,"entries":2}`,
+				`{"date":"2024-01-31T00:00:00Z","bags":0,"entries":0}`,
+			}},
+		},
+		{
+			name:   "rejects a malformed month in the API",
+			params: params{method: http.MethodGet, path: "/api/calendrier?month=2024-1"},
+			want:   want{statusCode: http.StatusBadRequest, contains: []string{"YYYY-MM"}},
+		},
+		{
+			name:   "is read-only",
+			params: params{method: http.MethodPost, path: "/api/calendrier"},
+			want:   want{statusCode: http.StatusMethodNotAllowed},
+		},
+	}
+
+	server := NewServer(store, Config{})
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(tc.params.method, tc.params.path, nil)
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			for _, fragment := range tc.want.contains {
+				assert.Contains(t, rec.Body.String(), fragment, tc.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package http
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// connSentBuckets are the upper bounds, in bytes, of the histogram of the
+// bytes sent per connection: a page, a few pages, an export, a large export.
+var connSentBuckets = []uint64{16 << 10, 256 << 10, 4 << 20, 64 << 20}
+
+// ConnTracker follows the connections of the listeners it wraps, added to
+// /metrics through Config.Connections: how many are open and the bytes each
+// one carried.
+type ConnTracker struct {
+	mu        sync.Mutex
+	listeners map[string]*listenerConns
+}
+
+// listenerConns are the connections accepted by one listener. The bytes of
+// the open connections are only added to the totals once they close.
+type listenerConns struct {
+	accepted uint64
+	active   map[*trackedConn]struct{}
+	received uint64
+	sent     uint64
+	// closed counts the connections in the histogram, sentBuckets the ones
+	// that sent at most each bound of connSentBuckets.
+	closed      uint64
+	sentBuckets []uint64
+}
+
+// NewConnTracker returns a tracker without listeners.
+func NewConnTracker() *ConnTracker {
+	return &ConnTracker{listeners: make(map[string]*listenerConns)}
+}
+
+// Listener wraps ln so that its connections are tracked under name. Wrap the
+// plain listener, before TLS, to count the bytes on the wire.
+func (t *ConnTracker) Listener(ln net.Listener, name string) net.Listener {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.listeners[name] == nil {
+		t.listeners[name] = &listenerConns{active: make(map[*trackedConn]struct{}), sentBuckets: make([]uint64, len(connSentBuckets))}
+	}
+	return &trackedListener{Listener: ln, tracker: t, name: name}
+}
+
+func (t *ConnTracker) open(name string, conn *trackedConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	conns := t.listeners[name]
+	conns.accepted++
+	conns.active[conn] = struct{}{}
+}
+
+func (t *ConnTracker) close(name string, conn *trackedConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	conns := t.listeners[name]
+	delete(conns.active, conn)
+	sent := conn.sent.Load()
+	conns.received += conn.received.Load()
+	conns.sent += sent
+	conns.closed++
+	for i, bound := range connSentBuckets {
+		if sent <= bound {
+			conns.sentBuckets[i]++
+		}
+	}
+}
+
+// connStats is what writeMetrics reports of a listener.
+type connStats struct {
+	name        string
+	accepted    uint64
+	active      int
+	received    uint64
+	sent        uint64
+	closed      uint64
+	closedSent  uint64
+	sentBuckets []uint64
+}
+
+// snapshot returns the connections of every listener sorted by name, the
+// bytes of the open connections included.
+func (t *ConnTracker) snapshot() []connStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := make([]connStats, 0, len(t.listeners))
+	for name, conns := range t.listeners {
+		stat := connStats{
+			name:        name,
+			accepted:    conns.accepted,
+			active:      len(conns.active),
+			received:    conns.received,
+			sent:        conns.sent,
+			closed:      conns.closed,
+			closedSent:  conns.sent,
+			sentBuckets: append([]uint64(nil), conns.sentBuckets...),
+		}
+		for conn := range conns.active {
+			stat.received += conn.received.Load()
+			stat.sent += conn.sent.Load()
+		}
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].name < stats[j].name })
+	return stats
+}
+
+// writeMetrics adds the connection metrics to a /metrics response.
+func (t *ConnTracker) writeMetrics(buf *bytes.Buffer) {
+	stats := t.snapshot()
+	writeMetricHeader(buf, "pellets_http_connections_active", "gauge", "Connections open by listener.")
+	for _, stat := range stats {
+		writeMetric(buf, "pellets_http_connections_active", []string{"listener", stat.name}, float64(stat.active))
+	}
+	writeMetricHeader(buf, "pellets_http_connections_total", "counter", "Connections accepted by listener.")
+	for _, stat := range stats {
+		writeMetric(buf, "pellets_http_connections_total", []string{"listener", stat.name}, float64(stat.accepted))
+	}
+	writeMetricHeader(buf, "pellets_http_connection_received_bytes_total", "counter", "Bytes received on the connections by listener.")
+	for _, stat := range stats {
+		writeMetric(buf, "pellets_http_connection_received_bytes_total", []string{"listener", stat.name}, float64(stat.received))
+	}
+	writeMetricHeader(buf, "pellets_http_connection_sent_bytes_total", "counter", "Bytes sent on the connections by listener.")
+	for _, stat := range stats {
+		writeMetric(buf, "pellets_http_connection_sent_bytes_total", []string{"listener", stat.name}, float64(stat.sent))
+	}
+	writeMetricHeader(buf, "pellets_http_connection_sent_bytes", "histogram", "Bytes sent by each closed connection by listener.")
+	for _, stat := range stats {
+		for i, bound := range connSentBuckets {
+			writeMetric(buf, "pellets_http_connection_sent_bytes_bucket", []string{"listener", stat.name, "le", strconv.FormatUint(bound, 10)}, float64(stat.sentBuckets[i]))
+		}
+		writeMetric(buf, "pellets_http_connection_sent_bytes_bucket", []string{"listener", stat.name, "le", "+Inf"}, float64(stat.closed))
+		writeMetric(buf, "pellets_http_connection_sent_bytes_sum", []string{"listener", stat.name}, float64(stat.closedSent))
+		writeMetric(buf, "pellets_http_connection_sent_bytes_count", []string{"listener", stat.name}, float64(stat.closed))
+	}
+}
+
+type trackedListener struct {
+	net.Listener
+	tracker *ConnTracker
+	name    string
+}
+
+func (l *trackedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	tracked := &trackedConn{Conn: conn, tracker: l.tracker, name: l.name}
+	l.tracker.open(l.name, tracked)
+	return tracked, nil
+}
+
+// trackedConn counts the bytes of a connection until it is closed.
+type trackedConn struct {
+	net.Conn
+	tracker  *ConnTracker
+	name     string
+	received atomic.Uint64
+	sent     atomic.Uint64
+	once     sync.Once
+}
+
+func (c *trackedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.received.Add(uint64(n))
+	return n, err
+}
+
+func (c *trackedConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.sent.Add(uint64(n))
+	return n, err
+}
+
+func (c *trackedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() { c.tracker.close(c.name, c) })
+	return err
+}
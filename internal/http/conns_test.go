@@ -0,0 +1,104 @@
+package http
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnTracker(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		// sent is the number of bytes the server sends on each connection.
+		sent []int
+		// open leaves the last connection open.
+		open bool
+	}
+	type want struct {
+		bodyContains []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "counts closed connections",
+			params: params{sent: []int{10, 300 << 10}},
+			want: want{bodyContains: []string{
+				`pellets_http_connections_active{listener="lan"} 0`,
+				`pellets_http_connections_total{listener="lan"} 2`,
+				`pellets_http_connection_received_bytes_total{listener="lan"} 2`,
+				`pellets_http_connection_sent_bytes_total{listener="lan"} 307210`,
+				`pellets_http_connection_sent_bytes_bucket{listener="lan",le="16384"} 1`,
+				`pellets_http_connection_sent_bytes_bucket{listener="lan",le="4194304"} 2`,
+				`pellets_http_connection_sent_bytes_bucket{listener="lan",le="+Inf"} 2`,
+				`pellets_http_connection_sent_bytes_sum{listener="lan"} 307210`,
+				`pellets_http_connection_sent_bytes_count{listener="lan"} 2`,
+			}},
+		},
+		{
+			name:   "includes the bytes of open connections",
+			params: params{sent: []int{10, 20}, open: true},
+			want: want{bodyContains: []string{
+				`pellets_http_connections_active{listener="lan"} 1`,
+				`pellets_http_connections_total{listener="lan"} 2`,
+				`pellets_http_connection_sent_bytes_total{listener="lan"} 30`,
+				`pellets_http_connection_sent_bytes_count{listener="lan"} 1`,
+			}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			plain, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err, tc.name)
+			tracker := NewConnTracker()
+			ln := tracker.Listener(plain, "lan")
+			t.Cleanup(func() { _ = ln.Close() })
+
+			for i, sent := range tc.params.sent {
+				client, err := net.Dial("tcp", ln.Addr().String())
+				require.NoError(t, err, tc.name)
+				conn, err := ln.Accept()
+				require.NoError(t, err, tc.name)
+
+				_, err = client.Write([]byte{byte(i)})
+				require.NoError(t, err, tc.name)
+				_, err = io.ReadFull(conn, make([]byte, 1))
+				require.NoError(t, err, tc.name)
+				written := make(chan error, 1)
+				go func() {
+					_, err := conn.Write(make([]byte, sent))
+					written <- err
+				}()
+				_, err = io.ReadFull(client, make([]byte, sent))
+				require.NoError(t, err, tc.name)
+				require.NoError(t, <-written, tc.name)
+
+				_ = client.Close()
+				if tc.params.open && i == len(tc.params.sent)-1 {
+					t.Cleanup(func() { _ = conn.Close() })
+					continue
+				}
+				require.NoError(t, conn.Close(), tc.name)
+			}
+
+			var buf bytes.Buffer
+			tracker.writeMetrics(&buf)
+			body := buf.String()
+			for _, expected := range tc.want.bodyContains {
+				assert.Contains(t, body, expected, tc.name)
+			}
+		})
+	}
+}
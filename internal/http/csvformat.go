@@ -0,0 +1,99 @@
+package http
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CSV export presets, picked with PELLETS_CSV_FORMAT or the format query
+// parameter.
+const (
+	// CSVFormatStandard writes commas between fields, dots in numbers and
+	// RFC 3339 timestamps, as read by scripts and English spreadsheets.
+	CSVFormatStandard = "standard"
+	// CSVFormatExcelFR writes what a French Excel opens without the import
+	// wizard: semicolons between fields, decimal commas, dates as 31/12/2024
+	// and a byte order mark so the accents are read as UTF-8.
+	CSVFormatExcelFR = "excel-fr"
+)
+
+// csvFormat is how an export writes its separators, numbers and dates.
+type csvFormat struct {
+	delimiter    rune
+	decimalComma bool
+	dateLayout   string
+	bom          bool
+}
+
+var csvFormatPresets = map[string]csvFormat{
+	CSVFormatStandard: {delimiter: ',', dateLayout: time.RFC3339},
+	CSVFormatExcelFR:  {delimiter: ';', decimalComma: true, dateLayout: "02/01/2006", bom: true},
+}
+
+var csvDelimiters = map[string]rune{"comma": ',', "semicolon": ';', "tab": '\t'}
+
+var csvExportDateLayouts = map[string]string{"rfc3339": time.RFC3339, "iso": "2006-01-02", "fr": "02/01/2006"}
+
+// csvExportFormat returns the format of a CSV export: the preset of the
+// format query parameter, the configured one without it, then adjusted by
+// the delimiter, decimal and date parameters. Separators are named rather
+// than written since Go drops query strings holding a raw semicolon.
+func (s *Server) csvExportFormat(r *http.Request) (csvFormat, error) {
+	query := r.URL.Query()
+	name := query.Get("format")
+	if name == "" {
+		name = s.csvFormat
+	}
+	format, ok := csvFormatPresets[name]
+	if !ok {
+		return csvFormat{}, fmt.Errorf("unknown format %q", name)
+	}
+	if value := query.Get("delimiter"); value != "" {
+		if format.delimiter, ok = csvDelimiters[value]; !ok {
+			return csvFormat{}, fmt.Errorf("unknown delimiter %q, want comma, semicolon or tab", value)
+		}
+	}
+	switch value := query.Get("decimal"); value {
+	case "":
+	case "comma":
+		format.decimalComma = true
+	case "dot":
+		format.decimalComma = false
+	default:
+		return csvFormat{}, fmt.Errorf("unknown decimal separator %q, want comma or dot", value)
+	}
+	if value := query.Get("date"); value != "" {
+		if format.dateLayout, ok = csvExportDateLayouts[value]; !ok {
+			return csvFormat{}, fmt.Errorf("unknown date format %q, want rfc3339, iso or fr", value)
+		}
+	}
+	return format, nil
+}
+
+// writer starts the export on w, writing the byte order mark first when the
+// format asks for it.
+func (f csvFormat) writer(w io.Writer) *csv.Writer {
+	if f.bom {
+		_, _ = io.WriteString(w, "\ufeff")
+	}
+	writer := csv.NewWriter(w)
+	writer.Comma = f.delimiter
+	return writer
+}
+
+// number rewrites a number formatted with a dot to the decimal separator of
+// the format.
+func (f csvFormat) number(value string) string {
+	if f.decimalComma {
+		return strings.Replace(value, ".", ",", 1)
+	}
+	return value
+}
+
+func (f csvFormat) date(value time.Time) string {
+	return value.Format(f.dateLayout)
+}
@@ -0,0 +1,86 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_csvExportFormat(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		configured string
+		query      string
+	}
+	type want struct {
+		format csvFormat
+		err    bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "defaults to the standard format",
+			want: want{format: csvFormat{delimiter: ',', dateLayout: time.RFC3339}},
+		},
+		{
+			name:   "uses the configured preset",
+			params: params{configured: CSVFormatExcelFR},
+			want:   want{format: csvFormat{delimiter: ';', decimalComma: true, dateLayout: "02/01/2006", bom: true}},
+		},
+		{
+			name:   "picks a preset from the query",
+			params: params{configured: CSVFormatExcelFR, query: "?format=standard"},
+			want:   want{format: csvFormat{delimiter: ',', dateLayout: time.RFC3339}},
+		},
+		{
+			name:   "adjusts the preset",
+			params: params{query: "?delimiter=semicolon&decimal=comma&date=iso"},
+			want:   want{format: csvFormat{delimiter: ';', decimalComma: true, dateLayout: "2006-01-02"}},
+		},
+		{
+			name:   "rejects an unknown preset",
+			params: params{query: "?format=excel"},
+			want:   want{err: true},
+		},
+		{
+			name:   "rejects an unknown delimiter",
+			params: params{query: "?delimiter=pipe"},
+			want:   want{err: true},
+		},
+		{
+			name:   "rejects an unknown decimal separator",
+			params: params{query: "?decimal=space"},
+			want:   want{err: true},
+		},
+		{
+			name:   "rejects an unknown date format",
+			params: params{query: "?date=us"},
+			want:   want{err: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{}, Config{CSVFormat: tc.params.configured})
+
+			format, err := server.csvExportFormat(httptest.NewRequest(http.MethodGet, "/api/export/csv"+tc.params.query, nil))
+			if tc.want.err {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			assert.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.format, format, tc.name)
+		})
+	}
+}
@@ -0,0 +1,389 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/numparse"
+)
+
+// maxImportCSVBytes bounds an imported spreadsheet.
+const maxImportCSVBytes = 8 << 20
+
+// csvColumns are the columns written by /api/export/csv. Only type, the
+// brand, timestamp and bags are required on import.
+var csvColumns = []string{"type", "id", "brand_id", "brand_name", "timestamp", "bags", "weight_kg", "unit_price_cents", "total_price_cents", "notes"}
+
+// csvDateLayouts are the timestamp formats accepted on import, spreadsheets
+// rarely keep the RFC 3339 times of the export.
+var csvDateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02", "02/01/2006"}
+
+// csvRowError reports why a line of the imported file was rejected. Line
+// counts the header as line 1, like a spreadsheet.
+type csvRowError struct {
+	Line    int    `json:"line"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+type csvImportResponse struct {
+	// Committed is false when a line was rejected: nothing was saved then.
+	Committed     bool          `json:"committed"`
+	Purchases     int           `json:"purchases"`
+	Consumptions  int           `json:"consumptions"`
+	Skipped       int           `json:"skipped"`
+	CreatedBrands []string      `json:"created_brands"`
+	Errors        []csvRowError `json:"errors,omitempty"`
+}
+
+// handleImportCSV loads purchases and consumptions from a file with the
+// columns of the CSV export, or from the file of another tool picked with
+// source. Brands are matched by ID then by name; unknown brands are created
+// when create_brands is set and rejected otherwise. Lines whose id is already
+// recorded are skipped, so an export can be imported again. The file is
+// applied as a whole or not at all.
+func (s *Server) handleImportCSV(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	opts, err := csvImportOptionsOf(r.URL.Query())
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportCSVBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			s.writeError(w, http.StatusRequestEntityTooLarge, errors.New("file too large"))
+			return
+		}
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ds := s.store.Data()
+	resp, err := importCSV(&ds, body, opts)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(resp.Errors) > 0 {
+		s.writeJSON(w, http.StatusBadRequest, resp)
+		return
+	}
+	if resp.Purchases+resp.Consumptions+len(resp.CreatedBrands) > 0 {
+		if err := s.store.Replace(ds); err != nil {
+			s.handleStoreError(w, err)
+			return
+		}
+		log.Printf(`{"type":"import","format":"csv","source":%q,"purchases":%d,"consumptions":%d,"brands":%d}`, opts.source, resp.Purchases, resp.Consumptions, len(resp.CreatedBrands))
+	}
+	resp.Committed = true
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+// csvImportOptions are the query parameters of /api/import/csv.
+type csvImportOptions struct {
+	createBrands bool
+	// source names the csvSources entry reading the file.
+	source string
+	// kind and brand fill the type and brand of the lines without one.
+	kind  string
+	brand string
+	// statistic and unit pick the readings of a Home Assistant export.
+	statistic string
+	unit      string
+}
+
+func csvImportOptionsOf(query url.Values) (csvImportOptions, error) {
+	createBrands, err := parseBoolQuery(query.Get("create_brands"))
+	if err != nil {
+		return csvImportOptions{}, fmt.Errorf("invalid create_brands: %w", err)
+	}
+	opts := csvImportOptions{
+		createBrands: createBrands,
+		source:       query.Get("source"),
+		kind:         strings.ToLower(query.Get("type")),
+		brand:        core.NormalizeName(query.Get("brand")),
+		statistic:    query.Get("statistic"),
+		unit:         strings.ToLower(query.Get("unit")),
+	}
+	if opts.source == "" {
+		opts.source = csvSourceExport
+	}
+	if _, ok := csvSources[opts.source]; !ok {
+		return csvImportOptions{}, fmt.Errorf("unknown source %q, want %s, %s or %s", opts.source, csvSourceExport, csvSourceFuelLog, csvSourceHomeAssistant)
+	}
+	if opts.kind != "" && opts.kind != "purchase" && opts.kind != "consumption" {
+		return csvImportOptions{}, fmt.Errorf(`invalid type %q, want "purchase" or "consumption"`, opts.kind)
+	}
+	if opts.unit != "" && opts.unit != csvUnitBags && opts.unit != csvUnitKg {
+		return csvImportOptions{}, fmt.Errorf("invalid unit %q, want %s or %s", opts.unit, csvUnitBags, csvUnitKg)
+	}
+	return opts, nil
+}
+
+// importCSV applies every line of the file to ds, collecting the errors of
+// all lines. It only fails on files that cannot be read as a table, or
+// whose columns do not fit the source.
+func importCSV(ds *core.DataStore, body []byte, opts csvImportOptions) (csvImportResponse, error) {
+	body = bytes.TrimPrefix(body, []byte("\ufeff"))
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.Comma = csvDelimiter(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return csvImportResponse{}, fmt.Errorf("read header: %w", err)
+	}
+	resp := csvImportResponse{CreatedBrands: []string{}}
+	table := csvTable{header: header}
+	line := 1
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		line++
+		if err != nil {
+			resp.Errors = append(resp.Errors, csvRowError{Line: line, Message: err.Error()})
+			continue
+		}
+		table.records = append(table.records, csvRecord{line: line, values: record})
+	}
+	lines, err := csvSources[opts.source](ds, table, opts, &resp)
+	if err != nil {
+		return csvImportResponse{}, err
+	}
+
+	known := make(map[core.ID]bool, len(ds.Purchases)+len(ds.Consumptions))
+	for _, purchase := range ds.Purchases {
+		known[purchase.ID] = true
+	}
+	for _, consumption := range ds.Consumptions {
+		known[consumption.ID] = true
+	}
+
+	for _, line := range lines {
+		if line.row.empty() {
+			continue
+		}
+		if id := core.ID(line.row.get("id")); id != "" && known[id] {
+			resp.Skipped++
+			continue
+		}
+		if errs := importCSVRow(ds, line.row, opts.createBrands, &resp); len(errs) > 0 {
+			for _, e := range errs {
+				resp.Errors = append(resp.Errors, csvRowError{Line: line.number, Field: e.Field, Message: e.Message})
+			}
+		}
+	}
+	return resp, nil
+}
+
+// importCSVRow records one purchase or consumption line.
+func importCSVRow(ds *core.DataStore, row csvRow, createBrands bool, resp *csvImportResponse) core.ValidationErrors {
+	errs := core.ValidationErrors{}
+	kind := strings.ToLower(row.get("type"))
+	errs = errs.AppendIf(kind != "purchase" && kind != "consumption", "type", `type must be "purchase" or "consumption"`)
+	at, err := parseCSVTime(row.get("timestamp"))
+	errs = errs.AppendIf(err != nil, "timestamp", "invalid date")
+	var bags int
+	var bagWeightKg, fraction, weightKg float64
+	var unitPrice core.Money
+	if kind == "purchase" {
+		bags, err = numparse.Int(row.get("bags"))
+		errs = errs.AppendIf(err != nil, "bags", "invalid number of bags")
+		weight, err := numparse.Float(row.get("weight_kg"))
+		errs = errs.AppendIf(err != nil, "weight_kg", "invalid weight")
+		if bags > 0 {
+			bagWeightKg = core.GramsFromKg(weight).DivInt(bags).Kg()
+		}
+		unitPrice, err = csvUnitPrice(row, bags)
+		errs = errs.AppendIf(err != nil, "unit_price_cents", "invalid price")
+	} else {
+		// Consumptions can burn part of a bag, or a weight alone.
+		count, err := numparse.Float(row.get("bags"))
+		errs = errs.AppendIf(err != nil, "bags", "invalid number of bags")
+		bags, fraction = core.SplitBags(count)
+		if value := row.get("weight_kg"); value != "" {
+			weightKg, err = numparse.Float(value)
+			errs = errs.AppendIf(err != nil, "weight_kg", "invalid weight")
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	brandID, ok := csvBrand(ds, row)
+	if !ok {
+		name := core.NormalizeName(row.get("brand_name"))
+		if !createBrands || name == "" {
+			return errs.AppendIf(true, "brand_name", "unknown brand")
+		}
+		brand, err := core.AddBrand(ds, core.CreateBrandParams{Name: name})
+		if err != nil {
+			return validationErrorsOf(err)
+		}
+		brandID = brand.ID
+		resp.CreatedBrands = append(resp.CreatedBrands, brand.Name)
+	}
+
+	notes := row.get("notes")
+	if kind == "purchase" {
+		if _, err := core.AddPurchase(ds, core.CreatePurchaseParams{
+			BrandID:     brandID,
+			PurchasedAt: at,
+			Bags:        bags,
+			BagWeightKg: bagWeightKg,
+			UnitPrice:   unitPrice,
+			Notes:       notes,
+		}); err != nil {
+			return validationErrorsOf(err)
+		}
+		resp.Purchases++
+		return nil
+	}
+	if _, err := core.AddConsumption(ds, core.CreateConsumptionParams{
+		BrandID:      brandID,
+		ConsumedAt:   at,
+		Bags:         bags,
+		BagsFraction: fraction,
+		WeightKg:     weightKg,
+		Notes:        notes,
+	}); err != nil {
+		return validationErrorsOf(err)
+	}
+	resp.Consumptions++
+	return nil
+}
+
+// csvBrand finds the brand of a line by ID, then by name.
+func csvBrand(ds *core.DataStore, row csvRow) (core.ID, bool) {
+	id := core.ID(row.get("brand_id"))
+	name := strings.ToLower(core.NormalizeName(row.get("brand_name")))
+	for _, brand := range ds.Brands {
+		if id != "" && brand.ID == id {
+			return brand.ID, true
+		}
+	}
+	for _, brand := range ds.Brands {
+		if name != "" && strings.ToLower(brand.Name) == name {
+			return brand.ID, true
+		}
+	}
+	return "", false
+}
+
+// csvUnitPrice reads the price of a bag in cents, derived from the total
+// price when only that one is filled. Files from other tools give the prices
+// in euros, in unit_price and total_price.
+func csvUnitPrice(row csvRow, bags int) (core.Money, error) {
+	if value := row.get("unit_price_cents"); value != "" {
+		cents, err := numparse.Int(value)
+		return core.Money(cents), err
+	}
+	if value := row.get("total_price_cents"); value != "" {
+		cents, err := numparse.Int(value)
+		return core.Money(cents).DivInt(bags), err
+	}
+	if value := row.get("unit_price"); value != "" {
+		return numparse.Money(value)
+	}
+	if value := row.get("total_price"); value != "" {
+		total, err := numparse.Money(value)
+		return total.DivInt(bags), err
+	}
+	return 0, nil
+}
+
+func parseCSVTime(value string) (time.Time, error) {
+	for _, layout := range csvDateLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
+
+// csvDelimiter picks the separator of the header line: spreadsheets set to
+// French use semicolons since the comma is their decimal separator.
+func csvDelimiter(body []byte) rune {
+	header, _ := bufio.NewReader(bytes.NewReader(body)).ReadString('\n')
+	if strings.Count(header, ";") > strings.Count(header, ",") {
+		return ';'
+	}
+	return ','
+}
+
+func validationErrorsOf(err error) core.ValidationErrors {
+	var ve core.ValidationErrors
+	if errors.As(err, &ve) {
+		return ve
+	}
+	return core.ValidationErrors{{Message: err.Error()}}
+}
+
+func parseBoolQuery(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// csvTable is the imported file, its lines numbered like in a spreadsheet.
+type csvTable struct {
+	header  []string
+	records []csvRecord
+}
+
+type csvRecord struct {
+	line   int
+	values []string
+}
+
+// csvLine is a line to import, in the columns of the export.
+type csvLine struct {
+	number int
+	row    csvRow
+}
+
+type csvRow struct {
+	record  []string
+	columns map[string]int
+	// defaults fills the columns missing from the file or left empty.
+	defaults map[string]string
+}
+
+func (r csvRow) get(column string) string {
+	i, ok := r.columns[column]
+	if ok && i < len(r.record) {
+		if value := strings.TrimSpace(r.record[i]); value != "" {
+			return value
+		}
+	}
+	return r.defaults[column]
+}
+
+func (r csvRow) empty() bool {
+	for _, value := range r.record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
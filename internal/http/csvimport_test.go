@@ -0,0 +1,154 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_handleImportCSV(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC)
+	current := core.DataStore{
+		Brands:    []core.Brand{{Meta: core.Meta{ID: "brand-a"}, Name: "Granules"}},
+		Purchases: []core.Purchase{{Meta: core.Meta{ID: "purchase-1"}, BrandID: "brand-a", PurchasedAt: at, Bags: 10, BagWeightKg: 15, TotalWeightKg: 150}},
+	}
+
+	type params struct {
+		query string
+		body  string
+	}
+	type want struct {
+		statusCode    int
+		replaced      bool
+		brands        int
+		purchases     int
+		consumptions  int
+		skipped       int
+		createdBrands []string
+		errorLines    []int
+		bagWeightKg   float64
+		unitPrice     core.Money
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "imports lines of the export",
+			params: params{body: "type,id,brand_id,brand_name,timestamp,bags,weight_kg,unit_price_cents,total_price_cents,notes\n" +
+				"purchase,purchase-1,brand-a,Granules,2024-01-10T00:00:00Z,10,150,550,5500,\n" +
+				"purchase,,,granules,2024-03-01,20,300,,11000,printemps\n" +
+				"consumption,,,Granules,2024-03-02,2,,,,\n"},
+			want: want{statusCode: http.StatusOK, replaced: true, brands: 1, purchases: 2, consumptions: 1, skipped: 1, createdBrands: []string{}, bagWeightKg: 15, unitPrice: 550},
+		},
+		{
+			name: "reads a French spreadsheet",
+			params: params{body: "type;brand_name;timestamp;bags;weight_kg;unit_price_cents\n" +
+				"purchase;Granules;01/03/2024;3;45,6;599\n"},
+			want: want{statusCode: http.StatusOK, replaced: true, brands: 1, purchases: 2, createdBrands: []string{}, bagWeightKg: 15.2, unitPrice: 599},
+		},
+		{
+			name: "rejects unknown brands",
+			params: params{body: "type,brand_name,timestamp,bags,weight_kg\n" +
+				"purchase,Bois Énergie,2024-03-01,5,75\n" +
+				"consumption,Granules,2024-03-02,0,\n"},
+			want: want{statusCode: http.StatusBadRequest, brands: 1, purchases: 1, createdBrands: []string{}, errorLines: []int{2, 3}},
+		},
+		{
+			name:   "creates missing brands on request",
+			params: params{query: "?create_brands=true", body: "type,brand_name,timestamp,bags,weight_kg\npurchase,Bois Énergie,2024-03-01,5,75\n"},
+			want:   want{statusCode: http.StatusOK, replaced: true, brands: 2, purchases: 2, createdBrands: []string{"Bois Énergie"}, bagWeightKg: 15},
+		},
+		{
+			name: "reads a fuel log",
+			params: params{query: "?source=fuel-log", body: "Date,Entry,Fuel,Quantity,Weight (kg),Cost,Comment\n" +
+				"2024-03-01,Delivery,Granules,4,60,\"22,00 €\",\n" +
+				"2024-03-03,Burn,Granules,1,,,soirée froide\n"},
+			want: want{statusCode: http.StatusOK, replaced: true, brands: 1, purchases: 2, consumptions: 1, createdBrands: []string{}, bagWeightKg: 15, unitPrice: 550},
+		},
+		{
+			name:   "fills the type and brand of a fuel log from the query",
+			params: params{query: "?source=fuel-log&type=consumption&brand=Granules", body: "date,qty\n2024-03-02,1\n2024-03-03,2\n"},
+			want:   want{statusCode: http.StatusOK, replaced: true, brands: 1, purchases: 1, consumptions: 2, createdBrands: []string{}},
+		},
+		{
+			name:   "rejects unknown fuel log types",
+			params: params{query: "?source=fuel-log&brand=Granules", body: "date,entry,qty\n2024-03-02,spill,1\n"},
+			want:   want{statusCode: http.StatusBadRequest, brands: 1, purchases: 1, createdBrands: []string{}, errorLines: []int{2}},
+		},
+		{
+			name: "reads home assistant statistics",
+			params: params{query: "?source=home-assistant&brand=Granules", body: "statistic_id,unit,start,state,sum\n" +
+				"sensor.pellets,bags,2024-03-01 22:00:00,10,10\n" +
+				"sensor.pellets,bags,2024-03-02 08:00:00,11,11\n" +
+				"sensor.pellets,bags,2024-03-02 20:00:00,12,12\n" +
+				"sensor.pellets,bags,2024-03-03 08:00:00,13,13\n"},
+			want: want{statusCode: http.StatusOK, replaced: true, brands: 1, purchases: 1, consumptions: 2, createdBrands: []string{}},
+		},
+		{
+			name:   "requires a brand for home assistant",
+			params: params{query: "?source=home-assistant", body: "entity_id,state,last_changed\nsensor.pellets,10,2024-03-01T22:00:00Z\n"},
+			want:   want{statusCode: http.StatusBadRequest, brands: 1, purchases: 1},
+		},
+		{
+			name:   "rejects an unknown source",
+			params: params{query: "?source=excel", body: "type,brand_name,timestamp,bags\n"},
+			want:   want{statusCode: http.StatusBadRequest, brands: 1, purchases: 1},
+		},
+		{
+			name:   "rejects another table",
+			params: params{body: "date,quantity\n2024-03-01,5\n"},
+			want:   want{statusCode: http.StatusBadRequest, brands: 1, purchases: 1},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: current}
+			server := NewServer(store, Config{})
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/import/csv"+tc.params.query, strings.NewReader(tc.params.body)))
+
+			require.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.replaced, store.replaced, tc.name)
+			assert.Len(t, store.data.Brands, tc.want.brands, tc.name)
+			assert.Len(t, store.data.Purchases, tc.want.purchases, tc.name)
+			assert.Len(t, store.data.Consumptions, tc.want.consumptions, tc.name)
+
+			var resp csvImportResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.CreatedBrands == nil {
+				return
+			}
+			assert.Equal(t, tc.want.skipped, resp.Skipped, tc.name)
+			assert.Equal(t, tc.want.createdBrands, resp.CreatedBrands, tc.name)
+			lines := []int{}
+			for _, e := range resp.Errors {
+				lines = append(lines, e.Line)
+			}
+			if tc.want.errorLines != nil {
+				assert.Equal(t, tc.want.errorLines, lines, tc.name)
+			}
+			if tc.want.bagWeightKg > 0 {
+				// Purchases are kept newest first: the imported one leads.
+				assert.Equal(t, tc.want.bagWeightKg, store.data.Purchases[0].BagWeightKg, tc.name)
+				assert.Equal(t, tc.want.unitPrice, store.data.Purchases[0].UnitPriceCents, tc.name)
+			}
+		})
+	}
+}
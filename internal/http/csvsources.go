@@ -0,0 +1,317 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/numparse"
+)
+
+// Sources of /api/import/csv, picked with the source query parameter.
+const (
+	// csvSourceExport reads the columns of /api/export/csv.
+	csvSourceExport = "export"
+	// csvSourceFuelLog reads the fuel logs of other trackers and
+	// spreadsheets: one line per delivery or burn, under the column names
+	// of fuelLogColumns.
+	csvSourceFuelLog = "fuel-log"
+	// csvSourceHomeAssistant reads the readings of a Home Assistant sensor
+	// counting the bags or kilograms burnt, from a long-term statistics or a
+	// history export, and records one consumption per day.
+	csvSourceHomeAssistant = "home-assistant"
+)
+
+// Units of the readings of a Home Assistant sensor.
+const (
+	csvUnitBags = "bags"
+	csvUnitKg   = "kg"
+)
+
+// csvSource turns the lines of an imported file into lines with the columns
+// of the export. It may skip lines or reject some, on resp.
+type csvSource func(ds *core.DataStore, table csvTable, opts csvImportOptions, resp *csvImportResponse) ([]csvLine, error)
+
+var csvSources = map[string]csvSource{
+	csvSourceExport:        exportLines,
+	csvSourceFuelLog:       fuelLogLines,
+	csvSourceHomeAssistant: homeAssistantLines,
+}
+
+// fuelLogColumns maps the column names of fuel logs, lower-cased, to the
+// columns of the export. Prices are in euros.
+var fuelLogColumns = map[string]string{
+	"date":           "timestamp",
+	"datetime":       "timestamp",
+	"day":            "timestamp",
+	"entry":          "type",
+	"kind":           "type",
+	"event":          "type",
+	"action":         "type",
+	"brand":          "brand_name",
+	"fuel":           "brand_name",
+	"fuel type":      "brand_name",
+	"product":        "brand_name",
+	"quantity":       "bags",
+	"qty":            "bags",
+	"units":          "bags",
+	"weight":         "weight_kg",
+	"weight (kg)":    "weight_kg",
+	"kg":             "weight_kg",
+	"cost":           "total_price",
+	"price":          "total_price",
+	"total":          "total_price",
+	"amount":         "total_price",
+	"total cost":     "total_price",
+	"unit price":     "unit_price",
+	"price per unit": "unit_price",
+	"price per bag":  "unit_price",
+	"note":           "notes",
+	"comment":        "notes",
+	"comments":       "notes",
+}
+
+// fuelLogTypes maps the entry types of fuel logs to purchase or consumption.
+var fuelLogTypes = map[string]string{
+	"purchase":     "purchase",
+	"delivery":     "purchase",
+	"refill":       "purchase",
+	"fill":         "purchase",
+	"buy":          "purchase",
+	"achat":        "purchase",
+	"livraison":    "purchase",
+	"consumption":  "consumption",
+	"burn":         "consumption",
+	"burned":       "consumption",
+	"usage":        "consumption",
+	"use":          "consumption",
+	"used":         "consumption",
+	"consommation": "consumption",
+}
+
+// exportLines reads a file with the columns of the export. The type and the
+// brand may come from the query instead.
+func exportLines(_ *core.DataStore, table csvTable, opts csvImportOptions, _ *csvImportResponse) ([]csvLine, error) {
+	lines, err := csvLines(table, nil, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%w, expected the columns of the export: %s", err, strings.Join(csvColumns, ","))
+	}
+	return lines, nil
+}
+
+// fuelLogLines reads a fuel log, renaming its columns and its entry types to
+// the ones of the export.
+func fuelLogLines(_ *core.DataStore, table csvTable, opts csvImportOptions, _ *csvImportResponse) ([]csvLine, error) {
+	lines, err := csvLines(table, fuelLogColumns, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%w, expected a date, a quantity and an entry type and fuel or brand unless given by the type and brand parameters", err)
+	}
+	for _, line := range lines {
+		if i, ok := line.row.columns["type"]; ok && i < len(line.row.record) {
+			if kind, ok := fuelLogTypes[strings.ToLower(strings.TrimSpace(line.row.record[i]))]; ok {
+				line.row.record[i] = kind
+			}
+		}
+	}
+	return lines, nil
+}
+
+// csvLines indexes the columns of table, renamed by aliases, and checks that
+// every line has a type, a brand, a date and a number of bags.
+func csvLines(table csvTable, aliases map[string]string, opts csvImportOptions) ([]csvLine, error) {
+	columns := make(map[string]int, len(table.header))
+	for i, name := range table.header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if alias, ok := aliases[name]; ok {
+			name = alias
+		}
+		if _, ok := columns[name]; !ok {
+			columns[name] = i
+		}
+	}
+	defaults := map[string]string{}
+	if opts.kind != "" {
+		defaults["type"] = opts.kind
+	}
+	if opts.brand != "" {
+		defaults["brand_name"] = opts.brand
+	}
+	for _, required := range []string{"type", "timestamp", "bags"} {
+		if _, ok := columns[required]; !ok && defaults[required] == "" {
+			return nil, fmt.Errorf("missing column %q", required)
+		}
+	}
+	_, hasBrandID := columns["brand_id"]
+	_, hasBrandName := columns["brand_name"]
+	if !hasBrandID && !hasBrandName && opts.brand == "" {
+		return nil, errors.New(`missing column "brand_id" or "brand_name"`)
+	}
+
+	lines := make([]csvLine, 0, len(table.records))
+	for _, record := range table.records {
+		lines = append(lines, csvLine{number: record.line, row: csvRow{record: record.values, columns: columns, defaults: defaults}})
+	}
+	return lines, nil
+}
+
+// homeAssistantReading is a value of the sensor, which only grows but for
+// the resets of the counter.
+type homeAssistantReading struct {
+	line  int
+	at    time.Time
+	value float64
+}
+
+// homeAssistantLines turns the readings of a sensor into one consumption per
+// day, of the growth of the sensor that day. The days the brand already has
+// a consumption are skipped, so a longer export can be imported again.
+func homeAssistantLines(ds *core.DataStore, table csvTable, opts csvImportOptions, resp *csvImportResponse) ([]csvLine, error) {
+	if opts.brand == "" {
+		return nil, errors.New("missing brand, the readings of Home Assistant do not name the pellets")
+	}
+	columns := make(map[string]int, len(table.header))
+	for i, name := range table.header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	idColumn, hasID := firstColumn(columns, "statistic_id", "entity_id")
+	timeColumn, hasTime := firstColumn(columns, "start", "start_ts", "last_changed", "last_updated")
+	valueColumn, hasValue := firstColumn(columns, "sum", "state")
+	if !hasTime || !hasValue {
+		return nil, errors.New(`missing column "start" or "last_changed" and "sum" or "state", expected a Home Assistant statistics or history export`)
+	}
+	unitColumn, hasUnit := firstColumn(columns, "unit", "unit_of_measurement")
+
+	unit := opts.unit
+	statistics := map[string]bool{}
+	var readings []homeAssistantReading
+	for _, record := range table.records {
+		row := csvRow{record: record.values, columns: columns}
+		if row.empty() {
+			continue
+		}
+		var id string
+		if hasID {
+			id = row.get(idColumn)
+		}
+		if opts.statistic != "" && id != opts.statistic {
+			continue
+		}
+		raw := row.get(valueColumn)
+		if raw == "" || raw == "unknown" || raw == "unavailable" {
+			continue
+		}
+		statistics[id] = true
+		at, err := parseHomeAssistantTime(row.get(timeColumn))
+		if err != nil {
+			resp.Errors = append(resp.Errors, csvRowError{Line: record.line, Field: timeColumn, Message: "invalid date"})
+			continue
+		}
+		value, err := numparse.Float(raw)
+		if err != nil {
+			resp.Errors = append(resp.Errors, csvRowError{Line: record.line, Field: valueColumn, Message: "invalid number"})
+			continue
+		}
+		if unit == "" && hasUnit && strings.EqualFold(row.get(unitColumn), csvUnitKg) {
+			unit = csvUnitKg
+		}
+		readings = append(readings, homeAssistantReading{line: record.line, at: at, value: value})
+	}
+	if len(statistics) > 1 {
+		ids := make([]string, 0, len(statistics))
+		for id := range statistics {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		return nil, fmt.Errorf("the file holds several statistics (%s), pick one with the statistic parameter", strings.Join(ids, ", "))
+	}
+	if unit == "" {
+		unit = csvUnitBags
+	}
+
+	type dayTotal struct {
+		day   time.Time
+		line  int
+		total float64
+	}
+	var days []*dayTotal
+	sort.SliceStable(readings, func(i, j int) bool { return readings[i].at.Before(readings[j].at) })
+	for i := 1; i < len(readings); i++ {
+		growth := readings[i].value - readings[i-1].value
+		if growth < 0 {
+			// The counter restarted from zero.
+			growth = readings[i].value
+		}
+		day := time.Date(readings[i].at.Year(), readings[i].at.Month(), readings[i].at.Day(), 0, 0, 0, 0, time.UTC)
+		if len(days) == 0 || !days[len(days)-1].day.Equal(day) {
+			days = append(days, &dayTotal{day: day})
+		}
+		days[len(days)-1].total += growth
+		days[len(days)-1].line = readings[i].line
+	}
+
+	recorded := map[time.Time]bool{}
+	if brandID, ok := csvBrand(ds, csvRow{defaults: map[string]string{"brand_name": opts.brand}}); ok {
+		for _, consumption := range ds.Consumptions {
+			if consumption.BrandID == brandID {
+				at := consumption.ConsumedAt.UTC()
+				recorded[time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)] = true
+			}
+		}
+	}
+	exportColumns := map[string]int{"type": 0, "brand_name": 1, "timestamp": 2, "bags": 3, "weight_kg": 4, "notes": 5}
+	notes := "Importé de Home Assistant"
+	for id := range statistics {
+		if id != "" {
+			notes += " (" + id + ")"
+		}
+	}
+	lines := make([]csvLine, 0, len(days))
+	for _, day := range days {
+		total := math.Round(day.total*1000) / 1000
+		if total <= 0 {
+			continue
+		}
+		if recorded[day.day] {
+			resp.Skipped++
+			continue
+		}
+		bags, weight := strconv.FormatFloat(total, 'f', -1, 64), ""
+		if unit == csvUnitKg {
+			bags, weight = "0", bags
+		}
+		record := []string{"consumption", opts.brand, day.day.Format(time.RFC3339), bags, weight, notes}
+		lines = append(lines, csvLine{number: day.line, row: csvRow{record: record, columns: exportColumns}})
+	}
+	return lines, nil
+}
+
+// homeAssistantTimeLayouts are the dates of the Home Assistant exports, next
+// to the Unix timestamps of start_ts.
+var homeAssistantTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "02.01.2006 15:04"}
+
+func parseHomeAssistantTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(0, int64(seconds*float64(time.Second))).UTC(), nil
+	}
+	for _, layout := range homeAssistantTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
+
+// firstColumn returns the first of names found in columns.
+func firstColumn(columns map[string]int, names ...string) (string, bool) {
+	for _, name := range names {
+		if _, ok := columns[name]; ok {
+			return name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,139 @@
+package http
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestHomeAssistantLines(t *testing.T) {
+	t.Parallel()
+
+	current := core.DataStore{
+		Brands:       []core.Brand{{Meta: core.Meta{ID: "brand-a"}, Name: "Granules"}},
+		Consumptions: []core.Consumption{{Meta: core.Meta{ID: "consumption-1"}, BrandID: "brand-a", ConsumedAt: time.Date(2024, time.March, 4, 18, 0, 0, 0, time.UTC), Bags: 1}},
+	}
+
+	type params struct {
+		statistic string
+		table     string
+	}
+	type want struct {
+		// lines are the timestamp, bags and weight of each line.
+		lines   [][3]string
+		skipped int
+		errors  []int
+		err     bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "sums the growth of each day",
+			params: params{table: "statistic_id,start,sum\n" +
+				"sensor.pellets,2024-03-01 23:00:00,10\n" +
+				"sensor.pellets,2024-03-02 08:00:00,10.5\n" +
+				"sensor.pellets,2024-03-02 20:00:00,11.25\n" +
+				"sensor.pellets,2024-03-03 08:00:00,11.25\n" +
+				"sensor.pellets,2024-03-05 08:00:00,12\n"},
+			want: want{lines: [][3]string{{"2024-03-02T00:00:00Z", "1.25", ""}, {"2024-03-05T00:00:00Z", "0.75", ""}}},
+		},
+		{
+			name: "counts from zero after a reset",
+			params: params{table: "entity_id,state,last_changed\n" +
+				"sensor.pellets,8,2024-03-01T20:00:00Z\n" +
+				"sensor.pellets,9,2024-03-02T08:00:00Z\n" +
+				"sensor.pellets,unavailable,2024-03-02T09:00:00Z\n" +
+				"sensor.pellets,2,2024-03-02T20:00:00Z\n"},
+			want: want{lines: [][3]string{{"2024-03-02T00:00:00Z", "3", ""}}},
+		},
+		{
+			name: "reads kilograms from the unit",
+			params: params{table: "statistic_id,unit,start_ts,sum\n" +
+				"sensor.pellets_kg,kg,1709337600,100\n" +
+				"sensor.pellets_kg,kg,1709424000,112.5\n"},
+			want: want{lines: [][3]string{{"2024-03-03T00:00:00Z", "0", "12.5"}}},
+		},
+		{
+			name: "skips the days already recorded",
+			params: params{table: "statistic_id,start,sum\n" +
+				"sensor.pellets,2024-03-03 08:00:00,1\n" +
+				"sensor.pellets,2024-03-04 08:00:00,2\n" +
+				"sensor.pellets,2024-03-05 08:00:00,3\n"},
+			want: want{lines: [][3]string{{"2024-03-05T00:00:00Z", "1", ""}}, skipped: 1},
+		},
+		{
+			name:   "picks a statistic",
+			params: params{statistic: "sensor.b", table: "statistic_id,start,sum\nsensor.a,2024-03-01 08:00:00,1\nsensor.b,2024-03-01 08:00:00,5\nsensor.b,2024-03-02 08:00:00,6\n"},
+			want:   want{lines: [][3]string{{"2024-03-02T00:00:00Z", "1", ""}}},
+		},
+		{
+			name:   "rejects several statistics",
+			params: params{table: "statistic_id,start,sum\nsensor.a,2024-03-01 08:00:00,1\nsensor.b,2024-03-01 08:00:00,5\n"},
+			want:   want{err: true},
+		},
+		{
+			name:   "reports invalid readings",
+			params: params{table: "statistic_id,start,sum\nsensor.a,yesterday,1\nsensor.a,2024-03-01 08:00:00,lots\n"},
+			want:   want{errors: []int{2, 3}},
+		},
+		{
+			name:   "rejects another table",
+			params: params{table: "date,bags\n2024-03-01,1\n"},
+			want:   want{err: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			table := csvTable{}
+			for i, line := range strings.Split(strings.TrimSpace(tc.params.table), "\n") {
+				if i == 0 {
+					table.header = strings.Split(line, ",")
+					continue
+				}
+				table.records = append(table.records, csvRecord{line: i + 1, values: strings.Split(line, ",")})
+			}
+			ds := current
+			resp := csvImportResponse{}
+
+			lines, err := homeAssistantLines(&ds, table, csvImportOptions{brand: "Granules", statistic: tc.params.statistic}, &resp)
+
+			if tc.want.err {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			got := [][3]string{}
+			for _, line := range lines {
+				assert.Equal(t, "consumption", line.row.get("type"), tc.name)
+				assert.Equal(t, "Granules", line.row.get("brand_name"), tc.name)
+				got = append(got, [3]string{line.row.get("timestamp"), line.row.get("bags"), line.row.get("weight_kg")})
+			}
+			if tc.want.lines == nil {
+				tc.want.lines = [][3]string{}
+			}
+			assert.Equal(t, tc.want.lines, got, tc.name)
+			assert.Equal(t, tc.want.skipped, resp.Skipped, tc.name)
+			errorLines := []int{}
+			for _, e := range resp.Errors {
+				errorLines = append(errorLines, e.Line)
+			}
+			if tc.want.errors == nil {
+				tc.want.errors = []int{}
+			}
+			assert.Equal(t, tc.want.errors, errorLines, tc.name)
+		})
+	}
+}
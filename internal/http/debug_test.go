@@ -0,0 +1,46 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugHandler(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		path string
+	}
+	type want struct {
+		statusCode   int
+		bodyContains string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "serves expvar", params: params{path: "/debug/vars"}, want: want{statusCode: http.StatusOK, bodyContains: `"memstats"`}},
+		{name: "serves pprof index", params: params{path: "/debug/pprof/"}, want: want{statusCode: http.StatusOK, bodyContains: "goroutine"}},
+		{name: "does not expose the application", params: params{path: "/api/stats"}, want: want{statusCode: http.StatusNotFound}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, tc.params.path, nil)
+			rec := httptest.NewRecorder()
+
+			DebugHandler().ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Contains(t, rec.Body.String(), tc.want.bodyContains, tc.name)
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"pellets-tracker/internal/core"
+)
+
+// purchaseFields drops the MarshalJSON of core.Purchase, which would
+// otherwise be promoted and leave brand_name out.
+type purchaseFields core.Purchase
+
+// purchaseResource is a purchase returned by GET /api/achats/{id}, with the
+// legacy weight_kg property written by core.Purchase.
+type purchaseResource struct {
+	purchaseFields
+	WeightKg  float64 `json:"weight_kg,omitempty"`
+	BrandName string  `json:"brand_name"`
+}
+
+// consumptionResource is a consumption returned by GET
+// /api/consommations/{id}, valued like the listing.
+type consumptionResource struct {
+	consumptionResponse
+	BrandName string `json:"brand_name"`
+}
+
+func (s *Server) getPurchase(w http.ResponseWriter, r *http.Request, id core.ID) {
+	ds := s.store.Data()
+	for _, purchase := range ds.Purchases {
+		if purchase.ID != id {
+			continue
+		}
+		brand, _ := findBrand(ds.Brands, purchase.BrandID)
+		s.writeCachedJSON(w, r, latest(purchase.UpdatedAt, brand.UpdatedAt), purchaseResource{purchaseFields: purchaseFields(purchase), WeightKg: purchase.TotalWeightKg, BrandName: brand.Name})
+		return
+	}
+	s.handleCoreError(w, core.ErrPurchaseNotFound)
+}
+
+func (s *Server) getConsumption(w http.ResponseWriter, r *http.Request, id core.ID) {
+	ds := s.store.Data()
+	for _, consumption := range ds.Consumptions {
+		if consumption.ID != id {
+			continue
+		}
+		ctx, cancel := s.computeContext(r)
+		defer cancel()
+		costs, err := consumptionCosts(ctx, &ds, s.costing)
+		if isContextError(err) {
+			s.handleCoreError(w, err)
+			return
+		}
+		brand, _ := findBrand(ds.Brands, consumption.BrandID)
+		detail := consumptionResource{consumptionResponse: consumptionResponse{Consumption: consumption}, BrandName: brand.Name}
+		if cost, ok := costs[consumption.ID]; ok {
+			detail.TotalPrice = &cost.TotalPrice
+			detail.BlendedBagPrice = &cost.BlendedBagPrice
+		}
+		// The price depends on the purchases and the consumptions before
+		// it, so any of them being edited modifies the consumption too.
+		modified := latest(consumption.UpdatedAt, brand.UpdatedAt)
+		for _, purchase := range ds.Purchases {
+			modified = latest(modified, purchase.UpdatedAt)
+		}
+		for _, other := range ds.Consumptions {
+			modified = latest(modified, other.UpdatedAt)
+		}
+		s.writeCachedJSON(w, r, modified, detail)
+		return
+	}
+	s.handleCoreError(w, core.ErrConsumptionNotFound)
+}
+
+// writeCachedJSON writes payload with an ETag hashed from its encoding and a
+// Last-Modified header, answering 304 to a request whose If-None-Match or
+// If-Modified-Since still matches. The ETag takes precedence, and is the
+// only one to notice a deletion in the history.
+func (s *Server) writeCachedJSON(w http.ResponseWriter, r *http.Request, modified time.Time, payload any) {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(payload); err != nil {
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	sum := sha256.Sum256(body.Bytes())
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, "", modified, bytes.NewReader(body.Bytes()))
+}
+
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,199 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func detailsDataStore() core.DataStore {
+	edited := time.Date(2024, time.October, 2, 9, 30, 0, 0, time.UTC)
+	return core.DataStore{
+		Brands: []core.Brand{{Meta: core.Meta{ID: "brand-w", UpdatedAt: edited.AddDate(0, 0, -10)}, Name: "Woodstock"}},
+		Purchases: []core.Purchase{{
+			Meta:            core.Meta{ID: "p1", UpdatedAt: edited.AddDate(0, 0, -5)},
+			BrandID:         "brand-w",
+			PurchasedAt:     time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC),
+			Bags:            10,
+			BagWeightKg:     15,
+			TotalWeightKg:   150,
+			UnitPriceCents:  550,
+			TotalPriceCents: 5500,
+		}},
+		Consumptions: []core.Consumption{{
+			Meta:       core.Meta{ID: "c1", UpdatedAt: edited},
+			BrandID:    "brand-w",
+			ConsumedAt: time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC),
+			Bags:       2,
+		}},
+	}
+}
+
+func TestServer_getPurchase(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		path            string
+		revalidate      bool
+		ifModifiedSince string
+	}
+	type want struct {
+		statusCode   int
+		brandName    string
+		lastModified string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "returns the purchase with its brand name",
+			params: params{path: "/api/achats/p1"},
+			want:   want{statusCode: http.StatusOK, brandName: "Woodstock", lastModified: "Fri, 27 Sep 2024 09:30:00 GMT"},
+		},
+		{
+			name:   "answers 304 to a matching ETag",
+			params: params{path: "/api/achats/p1", revalidate: true},
+			want:   want{statusCode: http.StatusNotModified},
+		},
+		{
+			name:   "answers 304 when not modified since",
+			params: params{path: "/api/achats/p1", ifModifiedSince: "Sat, 28 Sep 2024 00:00:00 GMT"},
+			want:   want{statusCode: http.StatusNotModified},
+		},
+		{
+			name:   "returns a purchase modified since",
+			params: params{path: "/api/achats/p1", ifModifiedSince: "Thu, 26 Sep 2024 00:00:00 GMT"},
+			want:   want{statusCode: http.StatusOK, brandName: "Woodstock", lastModified: "Fri, 27 Sep 2024 09:30:00 GMT"},
+		},
+		{
+			name:   "reports unknown purchases",
+			params: params{path: "/api/achats/missing"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{data: detailsDataStore()}, Config{})
+
+			req := httptest.NewRequest(http.MethodGet, tc.params.path, nil)
+			if tc.params.revalidate {
+				first := httptest.NewRecorder()
+				server.mux.ServeHTTP(first, httptest.NewRequest(http.MethodGet, tc.params.path, nil))
+				require.NotEmpty(t, first.Header().Get("ETag"), tc.name)
+				req.Header.Set("If-None-Match", first.Header().Get("ETag"))
+			}
+			if tc.params.ifModifiedSince != "" {
+				req.Header.Set("If-Modified-Since", tc.params.ifModifiedSince)
+			}
+			rec := httptest.NewRecorder()
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.lastModified, rec.Header().Get("Last-Modified"), tc.name)
+			if tc.want.statusCode != http.StatusOK {
+				return
+			}
+			assert.NotEmpty(t, rec.Header().Get("ETag"), tc.name)
+			var purchase purchaseResource
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &purchase), tc.name)
+			assert.Equal(t, core.ID("p1"), purchase.ID, tc.name)
+			assert.Equal(t, tc.want.brandName, purchase.BrandName, tc.name)
+		})
+	}
+}
+
+func TestServer_getConsumption(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		path       string
+		revalidate bool
+		edit       func(ds *core.DataStore)
+	}
+	type want struct {
+		statusCode   int
+		brandName    string
+		totalPrice   core.Money
+		lastModified string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "returns the consumption with its brand name and price",
+			params: params{path: "/api/consommations/c1"},
+			want:   want{statusCode: http.StatusOK, brandName: "Woodstock", totalPrice: 1100, lastModified: "Wed, 02 Oct 2024 09:30:00 GMT"},
+		},
+		{
+			name:   "answers 304 to a matching ETag",
+			params: params{path: "/api/consommations/c1", revalidate: true},
+			want:   want{statusCode: http.StatusNotModified},
+		},
+		{
+			name: "changes when a purchase reprices it",
+			params: params{path: "/api/consommations/c1", revalidate: true, edit: func(ds *core.DataStore) {
+				ds.Purchases[0].UnitPriceCents = 600
+				ds.Purchases[0].TotalPriceCents = 6000
+				ds.Purchases[0].UpdatedAt = time.Date(2024, time.October, 5, 0, 0, 0, 0, time.UTC)
+			}},
+			want: want{statusCode: http.StatusOK, brandName: "Woodstock", totalPrice: 1200, lastModified: "Sat, 05 Oct 2024 00:00:00 GMT"},
+		},
+		{
+			name:   "reports unknown consumptions",
+			params: params{path: "/api/consommations/missing"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: detailsDataStore()}
+			server := NewServer(store, Config{})
+
+			req := httptest.NewRequest(http.MethodGet, tc.params.path, nil)
+			if tc.params.revalidate {
+				first := httptest.NewRecorder()
+				server.mux.ServeHTTP(first, httptest.NewRequest(http.MethodGet, tc.params.path, nil))
+				require.NotEmpty(t, first.Header().Get("ETag"), tc.name)
+				req.Header.Set("If-None-Match", first.Header().Get("ETag"))
+			}
+			if tc.params.edit != nil {
+				tc.params.edit(&store.data)
+			}
+			rec := httptest.NewRecorder()
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.lastModified, rec.Header().Get("Last-Modified"), tc.name)
+			if tc.want.statusCode != http.StatusOK {
+				return
+			}
+			var consumption consumptionResource
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &consumption), tc.name)
+			assert.Equal(t, core.ID("c1"), consumption.ID, tc.name)
+			assert.Equal(t, tc.want.brandName, consumption.BrandName, tc.name)
+			require.NotNil(t, consumption.TotalPrice, tc.name)
+			assert.Equal(t, tc.want.totalPrice, *consumption.TotalPrice, tc.name)
+		})
+	}
+}
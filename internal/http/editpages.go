@@ -0,0 +1,353 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pellets-tracker/internal/core"
+)
+
+// purchaseEditView backs the edit page of a purchase, the HTML counterpart
+// of PUT and DELETE /api/achats/{id}.
+type purchaseEditView struct {
+	Purchase  purchaseView
+	Locations []string
+	Form      formState
+	Photos    photoGallery
+}
+
+// consumptionEditView backs the edit page of a consumption.
+type consumptionEditView struct {
+	Consumption consumptionView
+	PowerLevels []string
+	Form        formState
+}
+
+// editPageTarget splits /achats/{id} and /achats/{id}/supprimer into the id
+// and the action, empty for the edit page itself.
+func editPageTarget(path, prefix string) (core.ID, string, bool) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(path, prefix), "/")
+	if id == "" || strings.ContainsRune(action, '/') {
+		return "", "", false
+	}
+	return core.ID(id), action, true
+}
+
+// handlePurchasePage serves the edit form of a purchase at /achats/{id} and
+// deletes it on POST /achats/{id}/supprimer, so both work without JavaScript.
+// The photo forms of the page post to /achats/{id}/photos.
+func (s *Server) handlePurchasePage(w http.ResponseWriter, r *http.Request) {
+	if target, ok := parsePhotoPath(r.URL.Path, "/achats/"); ok {
+		s.handlePhotoForm(w, r, purchasePhotos, target, "/achats/"+string(target.OwnerID), "photos")
+		return
+	}
+	id, action, ok := editPageTarget(r.URL.Path, "/achats/")
+	if !ok {
+		s.notFound(w, r)
+		return
+	}
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		ds := s.store.Data()
+		purchase, ok := findPurchase(ds.Purchases, id)
+		if !ok {
+			s.notFound(w, r)
+			return
+		}
+		s.renderPurchaseEditPage(w, r, http.StatusOK, photoFlash(r), purchaseFormState(purchase), id)
+	case action == "" && r.Method == http.MethodPost:
+		s.updatePurchaseForm(w, r, id)
+	case action == "supprimer" && r.Method == http.MethodPost:
+		s.deletePurchaseForm(w, r, id)
+	case action == "":
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	case action == "supprimer":
+		s.methodNotAllowed(w, r, http.MethodPost)
+	default:
+		s.notFound(w, r)
+	}
+}
+
+func (s *Server) updatePurchaseForm(w http.ResponseWriter, r *http.Request, id core.ID) {
+	if err := r.ParseForm(); err != nil {
+		s.renderPurchaseEditPage(w, r, http.StatusBadRequest, &flashMessage{Kind: "error", Message: "Formulaire invalide"}, formState{}, id)
+		return
+	}
+	form := newFormState(r, purchaseFormFields...)
+	params := purchaseFormParams(&form)
+	if form.HasErrors() {
+		s.renderPurchaseEditPage(w, r, http.StatusBadRequest, invalidFormFlash(), form, id)
+		return
+	}
+
+	var purchase core.Purchase
+	err := s.update(func(ds *core.DataStore) error {
+		var err error
+		purchase, err = core.UpdatePurchase(ds, id, core.UpdatePurchaseParams{
+			PurchasedAt:      params.PurchasedAt,
+			Bags:             params.Bags,
+			BagWeightKg:      params.BagWeightKg,
+			UnitPrice:        params.UnitPrice,
+			WeightKg:         params.WeightKg,
+			PricePerTonne:    params.PricePerTonne,
+			Location:         params.Location,
+			Notes:            params.Notes,
+			ExpectedRevision: formRevision(form),
+		})
+		return err
+	})
+	var save *saveError
+	switch {
+	case errors.As(err, &save):
+		log.Printf("persist purchase edit form: %v", save.err)
+		s.renderPurchaseEditPage(w, r, http.StatusInternalServerError, &flashMessage{Kind: "error", Message: "Impossible d'enregistrer l'achat"}, form, id)
+		return
+	case errors.Is(err, core.ErrPurchaseNotFound):
+		s.notFound(w, r)
+		return
+	case errors.Is(err, core.ErrConflict):
+		s.renderPurchaseEditPage(w, r, http.StatusConflict, &flashMessage{Kind: "error", Message: s.friendlyError(err)}, form, id)
+		return
+	case err != nil:
+		if form.addValidationErrors(err, purchaseFormAliases) {
+			s.renderPurchaseEditPage(w, r, http.StatusBadRequest, invalidFormFlash(), form, id)
+			return
+		}
+		s.renderPurchaseEditPage(w, r, http.StatusBadRequest, &flashMessage{Kind: "error", Message: s.friendlyError(err)}, form, id)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"purchase","id":"%s"}`, purchase.ID)
+	http.Redirect(w, r, "/?added=purchase", http.StatusSeeOther)
+}
+
+func (s *Server) deletePurchaseForm(w http.ResponseWriter, r *http.Request, id core.ID) {
+	ds := s.store.Data()
+	if err := core.DeletePurchase(&ds, id); err != nil {
+		s.notFound(w, r)
+		return
+	}
+	if err := s.store.Replace(ds); err != nil {
+		log.Printf("persist purchase delete form: %v", err)
+		s.renderHomePage(w, r, http.StatusInternalServerError, &flashMessage{Kind: "error", Message: "Impossible de supprimer l'achat"}, formState{})
+		return
+	}
+	log.Printf(`{"type":"save","entity":"purchase","id":"%s","action":"delete"}`, id)
+	http.Redirect(w, r, "/?deleted=purchase", http.StatusSeeOther)
+}
+
+// renderPurchaseEditPage shows the purchase id with form, answering 404 once
+// it has been deleted.
+func (s *Server) renderPurchaseEditPage(w http.ResponseWriter, r *http.Request, status int, flash *flashMessage, form formState, id core.ID) {
+	ds := s.store.Data()
+	purchase, ok := findPurchase(ds.Purchases, id)
+	if !ok {
+		s.notFound(w, r)
+		return
+	}
+	view := purchaseEditView{
+		Purchase:  purchaseView{Purchase: purchase, BrandName: brandLookup(ds.Brands)[purchase.BrandID]},
+		Locations: core.Locations(&ds),
+		Form:      form,
+		Photos:    newPhotoGallery(purchasePhotos, purchase.ID, purchase.Photos, "/achats/"+string(purchase.ID)+"/photos", "photos"),
+	}
+	s.renderPage(w, status, "purchase", "Modifier un achat", "purchases", view, flash)
+}
+
+// purchaseFormState fills the edit form with the stored purchase.
+func purchaseFormState(p core.Purchase) formState {
+	values := map[string]string{
+		"purchased_at": p.PurchasedAt.Format("2006-01-02"),
+		"location":     p.Location,
+		"notes":        p.Notes,
+		"revision":     strconv.FormatInt(p.Revision, 10),
+	}
+	if p.IsBulk() {
+		values["kind"] = purchaseKindBulk
+		values["weight_kg"] = formInputNumber(p.TotalWeightKg)
+		values["price_per_tonne_eur"] = formInputMoney(p.PricePerTonneCents)
+	} else {
+		values["bags"] = itoaInt(p.Bags)
+		values["bag_weight_kg"] = formInputNumber(p.BagWeightKg)
+		values["unit_price_eur"] = formInputMoney(p.UnitPriceCents)
+	}
+	return formState{Values: values}
+}
+
+// handleConsumptionPage serves the edit form of a consumption at
+// /consommations/{id} and deletes it on POST /consommations/{id}/supprimer.
+func (s *Server) handleConsumptionPage(w http.ResponseWriter, r *http.Request) {
+	id, action, ok := editPageTarget(r.URL.Path, "/consommations/")
+	if !ok {
+		s.notFound(w, r)
+		return
+	}
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		ds := s.store.Data()
+		consumption, ok := findConsumption(ds.Consumptions, id)
+		if !ok {
+			s.notFound(w, r)
+			return
+		}
+		s.renderConsumptionEditPage(w, r, http.StatusOK, nil, consumptionFormState(consumption), id)
+	case action == "" && r.Method == http.MethodPost:
+		s.updateConsumptionForm(w, r, id)
+	case action == "supprimer" && r.Method == http.MethodPost:
+		s.deleteConsumptionForm(w, r, id)
+	case action == "":
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	case action == "supprimer":
+		s.methodNotAllowed(w, r, http.MethodPost)
+	default:
+		s.notFound(w, r)
+	}
+}
+
+func (s *Server) updateConsumptionForm(w http.ResponseWriter, r *http.Request, id core.ID) {
+	if err := r.ParseForm(); err != nil {
+		s.renderConsumptionEditPage(w, r, http.StatusBadRequest, &flashMessage{Kind: "error", Message: "Formulaire invalide"}, formState{}, id)
+		return
+	}
+	form := newFormState(r, consumptionFormFields...)
+	params := consumptionFormParams(&form)
+	if form.HasErrors() {
+		s.renderConsumptionEditPage(w, r, http.StatusBadRequest, invalidFormFlash(), form, id)
+		return
+	}
+
+	var consumption core.Consumption
+	err := s.update(func(ds *core.DataStore) error {
+		var err error
+		consumption, err = core.UpdateConsumption(ds, id, core.UpdateConsumptionParams{
+			ConsumedAt:       params.ConsumedAt,
+			Bags:             params.Bags,
+			BagsFraction:     params.BagsFraction,
+			WeightKg:         params.WeightKg,
+			PowerLevel:       params.PowerLevel,
+			Notes:            params.Notes,
+			ExpectedRevision: formRevision(form),
+		})
+		return err
+	})
+	var save *saveError
+	switch {
+	case errors.As(err, &save):
+		log.Printf("persist consumption edit form: %v", save.err)
+		s.renderConsumptionEditPage(w, r, http.StatusInternalServerError, &flashMessage{Kind: "error", Message: "Impossible d'enregistrer la consommation"}, form, id)
+		return
+	case errors.Is(err, core.ErrConsumptionNotFound):
+		s.notFound(w, r)
+		return
+	case errors.Is(err, core.ErrConflict):
+		s.renderConsumptionEditPage(w, r, http.StatusConflict, &flashMessage{Kind: "error", Message: s.friendlyError(err)}, form, id)
+		return
+	case err != nil:
+		if form.addValidationErrors(err, nil) {
+			s.renderConsumptionEditPage(w, r, http.StatusBadRequest, invalidFormFlash(), form, id)
+			return
+		}
+		s.renderConsumptionEditPage(w, r, http.StatusBadRequest, &flashMessage{Kind: "error", Message: s.friendlyError(err)}, form, id)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"consumption","id":"%s"}`, consumption.ID)
+	http.Redirect(w, r, "/consommations?added=consumption", http.StatusSeeOther)
+}
+
+func (s *Server) deleteConsumptionForm(w http.ResponseWriter, r *http.Request, id core.ID) {
+	ds := s.store.Data()
+	if err := core.DeleteConsumption(&ds, id); err != nil {
+		s.notFound(w, r)
+		return
+	}
+	if err := s.store.Replace(ds); err != nil {
+		log.Printf("persist consumption delete form: %v", err)
+		s.renderConsumptionsPage(w, r, http.StatusInternalServerError, &flashMessage{Kind: "error", Message: "Impossible de supprimer la consommation"}, formState{})
+		return
+	}
+	log.Printf(`{"type":"save","entity":"consumption","id":"%s","action":"delete"}`, id)
+	http.Redirect(w, r, "/consommations?deleted=consumption", http.StatusSeeOther)
+}
+
+func (s *Server) renderConsumptionEditPage(w http.ResponseWriter, r *http.Request, status int, flash *flashMessage, form formState, id core.ID) {
+	ds := s.store.Data()
+	consumption, ok := findConsumption(ds.Consumptions, id)
+	if !ok {
+		s.notFound(w, r)
+		return
+	}
+	view := consumptionEditView{
+		Consumption: consumptionView{Consumption: consumption, BrandName: brandLookup(ds.Brands)[consumption.BrandID]},
+		Form:        form,
+	}
+	for level := core.MinPowerLevel; level <= core.MaxPowerLevel; level++ {
+		view.PowerLevels = append(view.PowerLevels, itoaInt(level))
+	}
+	s.renderPage(w, status, "consumption", "Modifier une consommation", "consumptions", view, flash)
+}
+
+// consumptionFormState fills the edit form with the stored consumption.
+func consumptionFormState(c core.Consumption) formState {
+	values := map[string]string{
+		"consumed_at": c.ConsumedAt.Format("2006-01-02"),
+		"notes":       c.Notes,
+		"revision":    strconv.FormatInt(c.Revision, 10),
+	}
+	if bags := c.TotalBags(); bags > 0 {
+		values["bags"] = formInputNumber(bags)
+	}
+	if c.WeightKg > 0 {
+		values["weight_kg"] = formInputNumber(c.WeightKg)
+	}
+	if c.PowerLevel > 0 {
+		values["power_level"] = itoaInt(c.PowerLevel)
+	}
+	return formState{Values: values}
+}
+
+// formRevision returns the revision the edit form was filled with, nil for a
+// form sent without one, which then overwrites the entry whatever its
+// revision.
+func formRevision(form formState) *int64 {
+	revision, err := strconv.ParseInt(form.Value("revision"), 10, 64)
+	if err != nil {
+		return nil
+	}
+	return &revision
+}
+
+// formInputMoney writes an amount the way it is typed in the forms, 5,49.
+func formInputMoney(m core.Money) string {
+	cents := m.Int64()
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d,%02d", sign, cents/100, cents%100)
+}
+
+// formInputNumber writes a weight the way it is typed in the forms, 14,5.
+func formInputNumber(value float64) string {
+	return strings.Replace(formatFloat(value), ".", ",", 1)
+}
+
+func findPurchase(purchases []core.Purchase, id core.ID) (core.Purchase, bool) {
+	for _, purchase := range purchases {
+		if purchase.ID == id {
+			return purchase, true
+		}
+	}
+	return core.Purchase{}, false
+}
+
+func findConsumption(consumptions []core.Consumption, id core.ID) (core.Consumption, bool) {
+	for _, consumption := range consumptions {
+		if consumption.ID == id {
+			return consumption, true
+		}
+	}
+	return core.Consumption{}, false
+}
@@ -0,0 +1,304 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func editPagesDataStore() core.DataStore {
+	return core.DataStore{
+		Brands: []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}},
+		Purchases: []core.Purchase{
+			{
+				Meta:            core.Meta{ID: "p1"},
+				BrandID:         "brand-w",
+				PurchasedAt:     time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC),
+				Bags:            10,
+				BagWeightKg:     14.5,
+				TotalWeightKg:   145,
+				UnitPriceCents:  549,
+				TotalPriceCents: 5490,
+				Location:        "Garage",
+			},
+			{
+				Meta:               core.Meta{ID: "p2"},
+				BrandID:            "brand-w",
+				PurchasedAt:        time.Date(2024, time.August, 1, 0, 0, 0, 0, time.UTC),
+				TotalWeightKg:      3000,
+				PricePerTonneCents: 39000,
+				TotalPriceCents:    117000,
+				Location:           "Silo",
+			},
+		},
+		Consumptions: []core.Consumption{{
+			Meta:       core.Meta{ID: "c1"},
+			BrandID:    "brand-w",
+			ConsumedAt: time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC),
+			Bags:       2,
+			PowerLevel: 3,
+			Notes:      "Froid",
+		}},
+	}
+}
+
+func TestServer_handlePurchasePage(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		method string
+		path   string
+		form   url.Values
+	}
+	type want struct {
+		statusCode     int
+		redirectTarget string
+		bodyContains   []string
+		purchases      int
+		bags           int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "fills the form with the purchase",
+			params: params{method: http.MethodGet, path: "/achats/p1"},
+			want: want{
+				statusCode: http.StatusOK,
+				bodyContains: []string{
+					`action="/achats/p1"`,
+					`name="purchased_at" value="2024-09-01"`,
+					`name="bags" value="10"`,
+					`name="bag_weight_kg" value="14,5"`,
+					`name="unit_price_eur" value="5,49"`,
+					`name="revision" value="0"`,
+					`action="/achats/p1/supprimer"`,
+				},
+				purchases: 2,
+				bags:      10,
+			},
+		},
+		{
+			name:   "fills the form of a bulk delivery",
+			params: params{method: http.MethodGet, path: "/achats/p2"},
+			want: want{
+				statusCode: http.StatusOK,
+				bodyContains: []string{
+					`name="kind" value="bulk"`,
+					`name="weight_kg" value="3000"`,
+					`name="price_per_tonne_eur" value="390,00"`,
+				},
+				purchases: 2,
+				bags:      10,
+			},
+		},
+		{
+			name: "updates the purchase",
+			params: params{method: http.MethodPost, path: "/achats/p1", form: url.Values{
+				"purchased_at":   {"02/09/2024"},
+				"bags":           {"12"},
+				"bag_weight_kg":  {"15"},
+				"unit_price_eur": {"5,49"},
+			}},
+			want: want{statusCode: http.StatusSeeOther, redirectTarget: "/?added=purchase", purchases: 2, bags: 12},
+		},
+		{
+			name: "updates the revision the form was filled with",
+			params: params{method: http.MethodPost, path: "/achats/p1", form: url.Values{
+				"purchased_at":   {"2024-09-01"},
+				"bags":           {"12"},
+				"bag_weight_kg":  {"15"},
+				"unit_price_eur": {"5,49"},
+				"revision":       {"0"},
+			}},
+			want: want{statusCode: http.StatusSeeOther, redirectTarget: "/?added=purchase", purchases: 2, bags: 12},
+		},
+		{
+			name: "rejects a form filled before another save",
+			params: params{method: http.MethodPost, path: "/achats/p1", form: url.Values{
+				"purchased_at":   {"2024-09-01"},
+				"bags":           {"12"},
+				"bag_weight_kg":  {"15"},
+				"unit_price_eur": {"5,49"},
+				"revision":       {"3"},
+			}},
+			want: want{
+				statusCode:   http.StatusConflict,
+				bodyContains: []string{"Cette entrée a été modifiée entre-temps", `name="bags" value="12"`, `name="revision" value="3"`},
+				purchases:    2,
+				bags:         10,
+			},
+		},
+		{
+			name: "shows the errors of the form",
+			params: params{method: http.MethodPost, path: "/achats/p1", form: url.Values{
+				"purchased_at":   {"2024-09-01"},
+				"bags":           {"0"},
+				"bag_weight_kg":  {"15"},
+				"unit_price_eur": {"5,49"},
+			}},
+			want: want{
+				statusCode:   http.StatusBadRequest,
+				bodyContains: []string{"Le nombre de sacs doit être supérieur à zéro", `name="bags" value="0"`},
+				purchases:    2,
+				bags:         10,
+			},
+		},
+		{
+			name:   "deletes the purchase",
+			params: params{method: http.MethodPost, path: "/achats/p1/supprimer"},
+			want:   want{statusCode: http.StatusSeeOther, redirectTarget: "/?deleted=purchase", purchases: 1},
+		},
+		{
+			name:   "only deletes on POST",
+			params: params{method: http.MethodGet, path: "/achats/p1/supprimer"},
+			want:   want{statusCode: http.StatusMethodNotAllowed, purchases: 2, bags: 10},
+		},
+		{
+			name:   "reports unknown purchases",
+			params: params{method: http.MethodGet, path: "/achats/missing"},
+			want:   want{statusCode: http.StatusNotFound, purchases: 2, bags: 10},
+		},
+		{
+			name:   "reports unknown actions",
+			params: params{method: http.MethodPost, path: "/achats/p1/archiver"},
+			want:   want{statusCode: http.StatusNotFound, purchases: 2, bags: 10},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: editPagesDataStore()}
+			server := NewServer(store, Config{})
+
+			req := httptest.NewRequest(tc.params.method, tc.params.path, strings.NewReader(tc.params.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.redirectTarget, rec.Header().Get("Location"), tc.name)
+			for _, fragment := range tc.want.bodyContains {
+				assert.Contains(t, rec.Body.String(), fragment, tc.name)
+			}
+			ds := store.Data()
+			assert.Len(t, ds.Purchases, tc.want.purchases, tc.name)
+			if purchase, ok := findPurchase(ds.Purchases, "p1"); ok {
+				assert.Equal(t, tc.want.bags, purchase.Bags, tc.name)
+			}
+		})
+	}
+}
+
+func TestServer_handleConsumptionPage(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		method string
+		path   string
+		form   url.Values
+	}
+	type want struct {
+		statusCode     int
+		redirectTarget string
+		bodyContains   []string
+		consumptions   int
+		bags           int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "fills the form with the consumption",
+			params: params{method: http.MethodGet, path: "/consommations/c1"},
+			want: want{
+				statusCode: http.StatusOK,
+				bodyContains: []string{
+					`action="/consommations/c1"`,
+					`name="consumed_at" value="2024-10-01"`,
+					`name="bags" value="2"`,
+					`<option value="3" selected>`,
+					"Froid",
+					`action="/consommations/c1/supprimer"`,
+				},
+				consumptions: 1,
+				bags:         2,
+			},
+		},
+		{
+			name: "updates the consumption",
+			params: params{method: http.MethodPost, path: "/consommations/c1", form: url.Values{
+				"brand_id":    {"brand-w"},
+				"consumed_at": {"2024-10-01"},
+				"bags":        {"3"},
+			}},
+			want: want{statusCode: http.StatusSeeOther, redirectTarget: "/consommations?added=consumption", consumptions: 1, bags: 3},
+		},
+		{
+			name: "shows the errors of the form",
+			params: params{method: http.MethodPost, path: "/consommations/c1", form: url.Values{
+				"brand_id":    {"brand-w"},
+				"consumed_at": {"hier"},
+				"bags":        {"3"},
+			}},
+			want: want{statusCode: http.StatusBadRequest, bodyContains: []string{"Date invalide"}, consumptions: 1, bags: 2},
+		},
+		{
+			name:   "deletes the consumption",
+			params: params{method: http.MethodPost, path: "/consommations/c1/supprimer"},
+			want:   want{statusCode: http.StatusSeeOther, redirectTarget: "/consommations?deleted=consumption"},
+		},
+		{
+			name:   "reports unknown consumptions",
+			params: params{method: http.MethodPost, path: "/consommations/missing/supprimer"},
+			want:   want{statusCode: http.StatusNotFound, consumptions: 1, bags: 2},
+		},
+		{
+			name:   "keeps the duplicate form",
+			params: params{method: http.MethodPost, path: "/consommations/dupliquer", form: url.Values{"id": {"c1"}}},
+			want:   want{statusCode: http.StatusSeeOther, redirectTarget: "/consommations?added=consumption", consumptions: 2, bags: 2},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: editPagesDataStore()}
+			server := NewServer(store, Config{})
+
+			req := httptest.NewRequest(tc.params.method, tc.params.path, strings.NewReader(tc.params.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.redirectTarget, rec.Header().Get("Location"), tc.name)
+			for _, fragment := range tc.want.bodyContains {
+				assert.Contains(t, rec.Body.String(), fragment, tc.name)
+			}
+			ds := store.Data()
+			assert.Len(t, ds.Consumptions, tc.want.consumptions, tc.name)
+			if consumption, ok := findConsumption(ds.Consumptions, "c1"); ok {
+				assert.Equal(t, tc.want.bags, consumption.Bags, tc.name)
+			}
+		})
+	}
+}
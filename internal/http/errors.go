@@ -0,0 +1,150 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"pellets-tracker/internal/version"
+)
+
+// errorPageStatuses are the statuses rendered with an error page on HTML
+// routes; LoadErrorPages reads a replacement for each of them.
+var errorPageStatuses = []int{http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusInternalServerError}
+
+type errorView struct {
+	Status  int
+	Heading string
+	Message string
+}
+
+var errorViews = map[int]errorView{
+	http.StatusForbidden:           {Heading: "Action non autorisée", Message: "Vous pouvez consulter les données, mais pas effectuer cette modification."},
+	http.StatusNotFound:            {Heading: "Page introuvable", Message: "La page demandée n'existe pas ou a été déplacée."},
+	http.StatusMethodNotAllowed:    {Heading: "Action impossible", Message: "Cette page ne peut pas être utilisée de cette façon. Revenez en arrière et réessayez depuis l'interface."},
+	http.StatusInternalServerError: {Heading: "Erreur interne", Message: "Une erreur inattendue est survenue. Réessayez dans un instant ; si le problème persiste, consultez les journaux du serveur."},
+}
+
+// LoadErrorPages reads the custom error pages of dir, named after their
+// status ("404.html", "405.html", "500.html"). Missing files keep the built-in
+// page.
+func LoadErrorPages(dir string) (map[int][]byte, error) {
+	pages := make(map[int][]byte, len(errorPageStatuses))
+	for _, status := range errorPageStatuses {
+		page, err := os.ReadFile(filepath.Join(dir, strconv.Itoa(status)+".html"))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read error page: %w", err)
+		}
+		pages[status] = page
+	}
+	return pages, nil
+}
+
+// wantsJSON reports whether an error for r is answered in JSON rather than
+// with an HTML page: always on API routes, elsewhere when the client prefers
+// JSON to HTML.
+func wantsJSON(r *http.Request) bool {
+	if r.URL.Path == "/api" || strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/healthz" {
+		return true
+	}
+	return acceptQuality(r.Header.Get("Accept"), "application/json") > acceptQuality(r.Header.Get("Accept"), "text/html")
+}
+
+// acceptQuality returns the weight the Accept header gives to mediaType,
+// wildcards included; a missing header accepts everything.
+func acceptQuality(accept, mediaType string) float64 {
+	if strings.TrimSpace(accept) == "" {
+		return 1
+	}
+	kind, _, _ := strings.Cut(mediaType, "/")
+	best, bestSpecificity := 0.0, -1
+	for _, entry := range strings.Split(accept, ",") {
+		media, params, err := mime.ParseMediaType(strings.TrimSpace(entry))
+		if err != nil {
+			continue
+		}
+		specificity := -1
+		switch media {
+		case mediaType:
+			specificity = 2
+		case kind + "/*":
+			specificity = 1
+		case "*/*":
+			specificity = 0
+		}
+		if specificity <= bestSpecificity {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = parsed
+			}
+		}
+		best, bestSpecificity = quality, specificity
+	}
+	return best
+}
+
+func (s *Server) notFound(w http.ResponseWriter, r *http.Request) {
+	if wantsJSON(r) {
+		s.writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	s.renderErrorPage(w, http.StatusNotFound)
+}
+
+func (s *Server) methodNotAllowed(w http.ResponseWriter, r *http.Request, allowed ...string) {
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ","))
+	}
+	if wantsJSON(r) {
+		s.writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	s.renderErrorPage(w, http.StatusMethodNotAllowed)
+}
+
+// renderErrorPage answers with the custom page of status when one was
+// configured, the built-in one otherwise. It does not go through renderPage
+// since it is also the fallback when a page fails to render.
+func (s *Server) renderErrorPage(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if page, ok := s.errorPages[status]; ok {
+		w.WriteHeader(status)
+		_, _ = w.Write(page)
+		return
+	}
+	view, ok := errorViews[status]
+	if !ok {
+		view = errorView{Heading: http.StatusText(status)}
+	}
+	view.Status = status
+	var buf bytes.Buffer
+	tmpl, ok := s.templates["error"]
+	if ok {
+		err := tmpl.ExecuteTemplate(&buf, "error", pageData{Title: view.Heading, Data: view, Version: version.Version, Auth: s.auth != nil, ReadOnlyAccess: s.readOnlyAccess})
+		if err != nil {
+			log.Printf("render error page: %v", err)
+			ok = false
+		}
+	}
+	if !ok {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	w.WriteHeader(status)
+	_, _ = buf.WriteTo(w)
+}
@@ -0,0 +1,173 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_errorPages(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		method     string
+		path       string
+		accept     string
+		errorPages map[int][]byte
+	}
+	type want struct {
+		statusCode  int
+		contentType string
+		contains    string
+		allow       string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "unknown page",
+			params: params{method: http.MethodGet, path: "/inconnue", accept: "text/html,application/xhtml+xml,*/*;q=0.8"},
+			want:   want{statusCode: http.StatusNotFound, contentType: "text/html; charset=utf-8", contains: "Page introuvable"},
+		},
+		{
+			name:   "unknown page asked as JSON",
+			params: params{method: http.MethodGet, path: "/inconnue", accept: "application/json"},
+			want:   want{statusCode: http.StatusNotFound, contentType: "application/json", contains: `"error":"not found"`},
+		},
+		{
+			name:   "unknown API entry",
+			params: params{method: http.MethodPut, path: "/api/achats/a/b", accept: "text/html"},
+			want:   want{statusCode: http.StatusNotFound, contentType: "application/json", contains: `"error":"not found"`},
+		},
+		{
+			name:   "page method",
+			params: params{method: http.MethodDelete, path: "/stats"},
+			want:   want{statusCode: http.StatusMethodNotAllowed, contentType: "text/html; charset=utf-8", contains: "Action impossible", allow: "GET"},
+		},
+		{
+			name:   "API method",
+			params: params{method: http.MethodDelete, path: "/api/marques"},
+			want:   want{statusCode: http.StatusMethodNotAllowed, contentType: "application/json", contains: `"error":"method not allowed"`, allow: "GET,POST"},
+		},
+		{
+			name:   "custom page",
+			params: params{method: http.MethodGet, path: "/inconnue", errorPages: map[int][]byte{http.StatusNotFound: []byte("<h1>Perdu</h1>")}},
+			want:   want{statusCode: http.StatusNotFound, contentType: "text/html; charset=utf-8", contains: "<h1>Perdu</h1>"},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{}, Config{ErrorPages: tc.params.errorPages})
+			req := httptest.NewRequest(tc.params.method, tc.params.path, nil)
+			if tc.params.accept != "" {
+				req.Header.Set("Accept", tc.params.accept)
+			}
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.contentType, rec.Header().Get("Content-Type"), tc.name)
+			assert.Contains(t, rec.Body.String(), tc.want.contains, tc.name)
+			assert.Equal(t, tc.want.allow, rec.Header().Get("Allow"), tc.name)
+			if tc.want.contentType == "application/json" {
+				assert.True(t, json.Valid(rec.Body.Bytes()), tc.name)
+			}
+		})
+	}
+}
+
+func TestWantsJSON(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		path   string
+		accept string
+	}
+	type want struct {
+		json bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "browser", params: params{path: "/stats", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"}},
+		{name: "no accept header", params: params{path: "/stats"}},
+		{name: "JSON client", params: params{path: "/stats", accept: "application/json"}, want: want{json: true}},
+		{name: "JSON preferred", params: params{path: "/stats", accept: "text/html;q=0.5, application/json"}, want: want{json: true}},
+		{name: "wildcard", params: params{path: "/stats", accept: "*/*"}},
+		{name: "API route", params: params{path: "/api/stats", accept: "text/html"}, want: want{json: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, tc.params.path, nil)
+			if tc.params.accept != "" {
+				req.Header.Set("Accept", tc.params.accept)
+			}
+			assert.Equal(t, tc.want.json, wantsJSON(req), tc.name)
+		})
+	}
+}
+
+func TestLoadErrorPages(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		files map[string]string
+	}
+	type want struct {
+		statuses []int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "empty directory", want: want{statuses: []int{}}},
+		{
+			name:   "known statuses only",
+			params: params{files: map[string]string{"404.html": "<h1>Perdu</h1>", "500.html": "<h1>Oups</h1>", "418.html": "<h1>Théière</h1>"}},
+			want:   want{statuses: []int{http.StatusNotFound, http.StatusInternalServerError}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			for name, content := range tc.params.files {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600), tc.name)
+			}
+
+			pages, err := LoadErrorPages(dir)
+			require.NoError(t, err, tc.name)
+			statuses := []int{}
+			for status := range pages {
+				statuses = append(statuses, status)
+			}
+			assert.ElementsMatch(t, tc.want.statuses, statuses, tc.name)
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"pellets-tracker/internal/core"
+)
+
+// forecastView is the stock-out forecast card of the stats page.
+type forecastView struct {
+	core.StockForecast
+	BasisLabel string
+}
+
+// handleForecastAPI serves the day the stock is expected to run out.
+func (s *Server) handleForecastAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	ds := s.store.Data()
+	ctx, cancel := s.computeContext(r)
+	defer cancel()
+	forecast, err := s.stockForecast(ctx, &ds, time.Now().UTC())
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, forecast)
+}
+
+func newForecastView(forecast core.StockForecast) forecastView {
+	return forecastView{StockForecast: forecast, BasisLabel: forecastBasisLabels[forecast.Basis]}
+}
@@ -0,0 +1,76 @@
+package http
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// plural renders count followed by the singular or the plural noun, the
+// singular below 2 as in French: "0 sac", "1,5 sac", "3 sacs". count is an
+// integer or a float64, rendered like formatBags.
+func plural(count any, singular, plural string) string {
+	var value float64
+	var text string
+	switch n := count.(type) {
+	case int:
+		value, text = float64(n), strconv.Itoa(n)
+	case int64:
+		value, text = float64(n), strconv.FormatInt(n, 10)
+	case float64:
+		value, text = n, formatBags(n)
+	default:
+		return fmt.Sprintf("%v %s", count, plural)
+	}
+	if math.Abs(value) < 2 {
+		return text + " " + singular
+	}
+	return text + " " + plural
+}
+
+// relativeDate renders the day of t relative to now: "aujourd'hui", "hier",
+// "il y a 3 jours", "il y a 2 semaines", "dans 4 jours"… Days are counted on
+// the calendar of now, past a month in months then in years.
+func relativeDate(t, now time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	t = t.In(now.Location())
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	days := int(today.Sub(day).Hours() / 24)
+	switch days {
+	case 0:
+		return "aujourd'hui"
+	case 1:
+		return "hier"
+	case -1:
+		return "demain"
+	}
+	span := days
+	if span < 0 {
+		span = -span
+	}
+	var amount string
+	switch {
+	case span < 7:
+		amount = plural(span, "jour", "jours")
+	case span < 30:
+		amount = plural(span/7, "semaine", "semaines")
+	case span < 365:
+		amount = plural(span/30, "mois", "mois")
+	default:
+		amount = plural(span/365, "an", "ans")
+	}
+	if days < 0 {
+		return "dans " + amount
+	}
+	return "il y a " + amount
+}
+
+// formatPercent renders a French percentage with one decimal, "42,5 %".
+func formatPercent(percent float64) string {
+	return strings.ReplaceAll(fmt.Sprintf("%.1f %%", percent), ".", ",")
+}
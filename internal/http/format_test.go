@@ -0,0 +1,106 @@
+package http
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlural(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		count any
+	}
+	type want struct {
+		text string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "none takes the singular", params: params{count: 0}, want: want{text: "0 sac"}},
+		{name: "one", params: params{count: 1}, want: want{text: "1 sac"}},
+		{name: "a bag and a half takes the singular", params: params{count: 1.5}, want: want{text: "1,5 sac"}},
+		{name: "several", params: params{count: 3}, want: want{text: "3 sacs"}},
+		{name: "several as float", params: params{count: 2.25}, want: want{text: "2,25 sacs"}},
+		{name: "int64", params: params{count: int64(12)}, want: want{text: "12 sacs"}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want.text, plural(tc.params.count, "sac", "sacs"), tc.name)
+		})
+	}
+}
+
+func TestRelativeDate(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, time.March, 15, 9, 0, 0, 0, time.UTC)
+
+	type params struct {
+		t time.Time
+	}
+	type want struct {
+		text string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "zero", want: want{text: ""}},
+		{name: "earlier today", params: params{t: now.Add(-8 * time.Hour)}, want: want{text: "aujourd'hui"}},
+		{name: "yesterday evening", params: params{t: time.Date(2025, time.March, 14, 23, 0, 0, 0, time.UTC)}, want: want{text: "hier"}},
+		{name: "tomorrow", params: params{t: now.AddDate(0, 0, 1)}, want: want{text: "demain"}},
+		{name: "days", params: params{t: now.AddDate(0, 0, -3)}, want: want{text: "il y a 3 jours"}},
+		{name: "one week", params: params{t: now.AddDate(0, 0, -8)}, want: want{text: "il y a 1 semaine"}},
+		{name: "weeks", params: params{t: now.AddDate(0, 0, -20)}, want: want{text: "il y a 2 semaines"}},
+		{name: "months", params: params{t: now.AddDate(0, -5, 0)}, want: want{text: "il y a 5 mois"}},
+		{name: "years", params: params{t: now.AddDate(-2, 0, -1)}, want: want{text: "il y a 2 ans"}},
+		{name: "future", params: params{t: now.AddDate(0, 0, 4)}, want: want{text: "dans 4 jours"}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want.text, relativeDate(tc.params.t, now), tc.name)
+		})
+	}
+}
+
+func TestFormatPercent(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		percent float64
+	}
+	type want struct {
+		text string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "rounds to one decimal", params: params{percent: 42.46}, want: want{text: "42,5 %"}},
+		{name: "whole", params: params{percent: 100}, want: want{text: "100,0 %"}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want.text, formatPercent(tc.params.percent), tc.name)
+		})
+	}
+}
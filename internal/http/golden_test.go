@@ -0,0 +1,178 @@
+package http_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	core "pellets-tracker/internal/core"
+	httpserver "pellets-tracker/internal/http"
+	"pellets-tracker/internal/store"
+)
+
+// updateGolden rewrites the golden files from the current responses:
+// go test ./internal/http -run TestAPIGolden -update
+var updateGolden = flag.Bool("update", false, "rewrite the API golden files")
+
+// TestAPIGolden pins the JSON bodies of the API so a refactor cannot change
+// them for existing clients unnoticed. Generated IDs and timestamps are
+// normalized before the comparison.
+func TestAPIGolden(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		method string
+		path   string
+		body   string
+	}
+	type want struct {
+		golden string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "list brands", params: params{method: http.MethodGet, path: "/api/marques"}, want: want{golden: "brands_list"}},
+		{name: "create brand", params: params{method: http.MethodPost, path: "/api/marques", body: `{"name":"Nouvelle","lead_time_days":7}`}, want: want{golden: "brands_create"}},
+		{name: "reject invalid brand", params: params{method: http.MethodPost, path: "/api/marques", body: `{"name":""}`}, want: want{golden: "brands_create_invalid"}},
+		{name: "brand prices", params: params{method: http.MethodGet, path: "/api/marques/brand-w/prix"}, want: want{golden: "brand_prices"}},
+		{name: "list purchases", params: params{method: http.MethodGet, path: "/api/achats"}, want: want{golden: "purchases_list"}},
+		{name: "create purchase", params: params{method: http.MethodPost, path: "/api/achats", body: `{"brand_id":"brand-w","purchased_at":"2024-12-01T00:00:00Z","bags":5,"bag_weight_kg":15,"unit_price_eur":6.2}`}, want: want{golden: "purchases_create"}},
+		{name: "unknown purchase", params: params{method: http.MethodDelete, path: "/api/achats/missing"}, want: want{golden: "purchases_delete_missing"}},
+		{name: "list consumptions", params: params{method: http.MethodGet, path: "/api/consommations"}, want: want{golden: "consumptions_list"}},
+		{name: "create consumption", params: params{method: http.MethodPost, path: "/api/consommations", body: `{"brand_id":"brand-w","consumed_at":"2024-12-02T00:00:00Z","bags":1}`}, want: want{golden: "consumptions_create"}},
+		{name: "stats", params: params{method: http.MethodGet, path: "/api/stats"}, want: want{golden: "stats"}},
+		{name: "stats with average costing", params: params{method: http.MethodGet, path: "/api/stats?costing=average"}, want: want{golden: "stats_average"}},
+		{name: "alerts", params: params{method: http.MethodGet, path: "/api/alertes"}, want: want{golden: "alerts"}},
+		{name: "list transfers", params: params{method: http.MethodGet, path: "/api/transferts"}, want: want{golden: "transfers_list"}},
+		{name: "list temperatures", params: params{method: http.MethodGet, path: "/api/temperatures"}, want: want{golden: "temperatures_list"}},
+		{name: "audit", params: params{method: http.MethodGet, path: "/api/audit"}, want: want{golden: "audit"}},
+		{name: "export json", params: params{method: http.MethodGet, path: "/api/export/json"}, want: want{golden: "export_json"}},
+		{name: "batch", params: params{method: http.MethodPost, path: "/api/batch", body: `{"operations":[{"op":"update_brand","id":"brand-p","data":{"min_stock_bags":3}}]}`}, want: want{golden: "batch"}},
+		{name: "grafana metrics", params: params{method: http.MethodPost, path: "/api/grafana/metrics", body: `{}`}, want: want{golden: "grafana_metrics"}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			jsonStore, err := store.NewJSONStore(filepath.Join(t.TempDir(), "data.json"), "", store.FormatCompact)
+			require.NoError(t, err, tc.name)
+			require.NoError(t, jsonStore.Replace(goldenDataStore()), tc.name)
+			server := httpserver.NewServer(jsonStore, httpserver.Config{})
+
+			req := httptest.NewRequest(tc.params.method, tc.params.path, strings.NewReader(tc.params.body))
+			rec := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rec, req)
+
+			got := goldenResponse(t, rec)
+			path := filepath.Join("testdata", "golden", tc.want.golden+".json")
+			if *updateGolden {
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755), tc.name)
+				require.NoError(t, os.WriteFile(path, got, 0o644), tc.name)
+			}
+			expected, err := os.ReadFile(path)
+			require.NoError(t, err, tc.name)
+			assert.JSONEq(t, string(expected), string(got), tc.name)
+		})
+	}
+}
+
+var (
+	ulidPattern = regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`)
+	// volatileTimeKeys hold the timestamps set when an entry is written.
+	volatileTimeKeys = map[string]bool{"created_at": true, "updated_at": true, "at": true}
+)
+
+// goldenResponse renders the status and the normalized body of a response.
+func goldenResponse(t *testing.T, rec *httptest.ResponseRecorder) []byte {
+	t.Helper()
+
+	var body any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body), rec.Body.String())
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	require.NoError(t, encoder.Encode(map[string]any{
+		"status": rec.Code,
+		"body":   normalizeGolden("", body),
+	}))
+	return buf.Bytes()
+}
+
+func normalizeGolden(key string, value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for k, item := range v {
+			v[k] = normalizeGolden(k, item)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = normalizeGolden(key, item)
+		}
+		return v
+	case string:
+		switch {
+		case ulidPattern.MatchString(v):
+			return "<ulid>"
+		case volatileTimeKeys[key]:
+			return "<timestamp>"
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// goldenDataStore is the fixture every golden response is computed from.
+// Its IDs are readable so they are kept as is by the normalization.
+func goldenDataStore() core.DataStore {
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	meta := func(id core.ID, at time.Time) core.Meta {
+		return core.Meta{ID: id, CreatedAt: at, UpdatedAt: at}
+	}
+	return core.DataStore{
+		Meta:          meta("datastore", day(2023, time.September, 1)),
+		SchemaVersion: core.CurrentSchemaVersion,
+		MinStockBags:  40,
+		Brands: []core.Brand{
+			{Meta: meta("brand-w", day(2023, time.September, 1)), Name: "Woodstock", Description: "Résineux", LeadTimeDays: 10, EnergyKWhPerKg: 5},
+			{Meta: meta("brand-p", day(2023, time.September, 1)), Name: "Premium", MinStockBags: 8},
+		},
+		Purchases: []core.Purchase{
+			{Meta: meta("p1", day(2023, time.September, 15)), BrandID: "brand-w", PurchasedAt: day(2023, time.September, 15), Bags: 20, BagWeightKg: 15, TotalWeightKg: 300, UnitPriceCents: 580, TotalPriceCents: 11600, Location: "Garage"},
+			{Meta: meta("p2", day(2024, time.October, 1)), BrandID: "brand-w", PurchasedAt: day(2024, time.October, 1), Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 640, TotalPriceCents: 6400},
+			{Meta: meta("p3", day(2024, time.October, 1)), BrandID: "brand-p", PurchasedAt: day(2024, time.October, 1), Bags: 10, BagWeightKg: 10, TotalWeightKg: 100, UnitPriceCents: 520, TotalPriceCents: 5200, Notes: "Promo"},
+		},
+		Consumptions: []core.Consumption{
+			{Meta: meta("c1", day(2023, time.December, 10)), BrandID: "brand-w", ConsumedAt: day(2023, time.December, 10), Bags: 12, PowerLevel: 3},
+			{Meta: meta("c2", day(2024, time.November, 5)), BrandID: "brand-p", ConsumedAt: day(2024, time.November, 5), Bags: 4, WeightKg: 38.5},
+			{Meta: meta("c3", day(2024, time.November, 20)), BrandID: "brand-w", ConsumedAt: day(2024, time.November, 20), Bags: 10, PowerLevel: 4},
+		},
+		Transfers: []core.Transfer{
+			{Meta: meta("t1", day(2024, time.October, 2)), BrandID: "brand-w", FromLocation: "Garage", ToLocation: "Cave", Bags: 5, TransferredAt: day(2024, time.October, 2)},
+		},
+		Temperatures: []core.DailyTemperature{
+			{Date: day(2024, time.November, 5), MeanC: 6.5},
+			{Date: day(2024, time.November, 20), MeanC: 2},
+		},
+	}
+}
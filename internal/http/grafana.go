@@ -0,0 +1,129 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"pellets-tracker/internal/core"
+)
+
+// grafanaMetric describes a series exposed to the Grafana JSON datasource.
+type grafanaMetric struct {
+	Label   string `json:"label"`
+	Value   string `json:"value"`
+	compute func(ds *core.DataStore, from, to time.Time) []core.SeriesPoint
+}
+
+var grafanaMetrics = []grafanaMetric{
+	{Label: "Stock (sacs)", Value: "stock", compute: core.ComputeStockSeries},
+	{Label: "Dépenses (€)", Value: "depenses", compute: core.ComputeSpendSeries},
+	{Label: "Consommation (sacs)", Value: "consommation", compute: core.ComputeConsumptionSeries},
+}
+
+type grafanaQueryRequest struct {
+	Range struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	} `json:"range"`
+	Targets []struct {
+		Target string `json:"target"`
+		RefID  string `json:"refId"`
+		Hide   bool   `json:"hide"`
+	} `json:"targets"`
+}
+
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	RefID      string       `json:"refId,omitempty"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// handleGrafanaAPI implements the endpoints expected by the Grafana JSON
+// datasource plugin: a health check on the root path, metric discovery through
+// /metrics (and the legacy /search) and time-series retrieval through /query.
+func (s *Server) handleGrafanaAPI(w http.ResponseWriter, r *http.Request) {
+	endpoint := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/grafana"), "/")
+	switch endpoint {
+	case "":
+		if r.Method != http.MethodGet {
+			s.methodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	case "metrics":
+		if r.Method != http.MethodPost {
+			s.methodNotAllowed(w, r, http.MethodPost)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, grafanaMetrics)
+	case "search":
+		if r.Method != http.MethodPost {
+			s.methodNotAllowed(w, r, http.MethodPost)
+			return
+		}
+		names := make([]string, len(grafanaMetrics))
+		for i, metric := range grafanaMetrics {
+			names[i] = metric.Value
+		}
+		s.writeJSON(w, http.StatusOK, names)
+	case "query":
+		if r.Method != http.MethodPost {
+			s.methodNotAllowed(w, r, http.MethodPost)
+			return
+		}
+		s.grafanaQuery(w, r)
+	default:
+		s.notFound(w, r)
+	}
+}
+
+func (s *Server) grafanaQuery(w http.ResponseWriter, r *http.Request) {
+	var payload grafanaQueryRequest
+	// Grafana sends many optional fields depending on its version, so unknown
+	// fields are tolerated here unlike the other JSON endpoints.
+	if err := decodeJSONLenient(r.Body, &payload); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	from, err := parseTime(payload.Range.From)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid range.from: %w", err))
+		return
+	}
+	to, err := parseTime(payload.Range.To)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid range.to: %w", err))
+		return
+	}
+
+	ds := s.store.Data()
+	series := make([]grafanaSeries, 0, len(payload.Targets))
+	for _, target := range payload.Targets {
+		if target.Hide || target.Target == "" {
+			continue
+		}
+		metric, ok := findGrafanaMetric(target.Target)
+		if !ok {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("unknown target %q", target.Target))
+			return
+		}
+		points := metric.compute(&ds, from, to)
+		datapoints := make([][2]float64, len(points))
+		for i, point := range points {
+			datapoints[i] = [2]float64{point.Value, float64(point.Time.UnixMilli())}
+		}
+		series = append(series, grafanaSeries{Target: metric.Value, RefID: target.RefID, Datapoints: datapoints})
+	}
+	s.writeJSON(w, http.StatusOK, series)
+}
+
+func findGrafanaMetric(value string) (grafanaMetric, bool) {
+	for _, metric := range grafanaMetrics {
+		if metric.Value == value {
+			return metric, true
+		}
+	}
+	return grafanaMetric{}, false
+}
@@ -0,0 +1,104 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_handleGrafanaAPI(t *testing.T) {
+	t.Parallel()
+
+	brandID := core.NewID()
+	data := core.DataStore{
+		Brands: []core.Brand{{Meta: core.Meta{ID: brandID}, Name: "Granules"}},
+		Purchases: []core.Purchase{{
+			Meta:            core.Meta{ID: core.NewID()},
+			BrandID:         brandID,
+			PurchasedAt:     time.Date(2024, time.January, 10, 9, 0, 0, 0, time.UTC),
+			Bags:            4,
+			UnitPriceCents:  500,
+			TotalPriceCents: 2000,
+		}},
+		Consumptions: []core.Consumption{{
+			Meta:       core.Meta{ID: core.NewID()},
+			BrandID:    brandID,
+			ConsumedAt: time.Date(2024, time.January, 12, 20, 0, 0, 0, time.UTC),
+			Bags:       1,
+		}},
+	}
+
+	type params struct {
+		method string
+		path   string
+		body   string
+	}
+	type want struct {
+		statusCode int
+		body       string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "answers health check",
+			params: params{method: http.MethodGet, path: "/api/grafana/"},
+			want:   want{statusCode: http.StatusOK, body: `{"status":"ok"}`},
+		},
+		{
+			name:   "lists searchable metrics",
+			params: params{method: http.MethodPost, path: "/api/grafana/search", body: `{"target":""}`},
+			want:   want{statusCode: http.StatusOK, body: `["stock","depenses","consommation"]`},
+		},
+		{
+			name: "returns stock datapoints",
+			params: params{
+				method: http.MethodPost,
+				path:   "/api/grafana/query",
+				body:   `{"range":{"from":"2024-01-01T00:00:00.000Z","to":"2024-01-31T00:00:00.000Z"},"intervalMs":60000,"targets":[{"target":"stock","refId":"A","type":"timeseries"}]}`,
+			},
+			want: want{
+				statusCode: http.StatusOK,
+				body:       `[{"target":"stock","refId":"A","datapoints":[[0,1704067200000],[4,1704844800000],[3,1705017600000]]}]`,
+			},
+		},
+		{
+			name: "rejects unknown targets",
+			params: params{
+				method: http.MethodPost,
+				path:   "/api/grafana/query",
+				body:   `{"targets":[{"target":"temperature"}]}`,
+			},
+			want: want{statusCode: http.StatusBadRequest, body: `{"error":"unknown target \"temperature\""}`},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{data: data}, Config{})
+			req := httptest.NewRequest(tc.params.method, tc.params.path, strings.NewReader(tc.params.body))
+			rec := httptest.NewRecorder()
+
+			server.handleGrafanaAPI(rec, req)
+
+			res := rec.Result()
+			defer res.Body.Close()
+			require.NotNil(t, res, tc.name)
+			assert.Equal(t, tc.want.statusCode, res.StatusCode, tc.name)
+			assert.JSONEq(t, tc.want.body, rec.Body.String(), tc.name)
+		})
+	}
+}
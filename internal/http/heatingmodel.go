@@ -0,0 +1,72 @@
+package http
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"pellets-tracker/internal/core"
+)
+
+type temperaturePayload struct {
+	Date  string  `json:"date"`
+	MeanC float64 `json:"mean_c"`
+}
+
+// handleModelAPI serves the consumption model fitted against the outside
+// temperatures, with the months that deviate from it.
+func (s *Server) handleModelAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	ds := s.store.Data()
+	s.writeJSON(w, http.StatusOK, core.ComputeConsumptionModel(&ds, time.Now().UTC()))
+}
+
+func (s *Server) handleTemperaturesAPI(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ds := s.store.Data()
+		temperatures := ds.Temperatures
+		if temperatures == nil {
+			temperatures = []core.DailyTemperature{}
+		}
+		s.writeJSON(w, http.StatusOK, temperatures)
+	case http.MethodPost:
+		s.recordTemperatures(w, r)
+	default:
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+// recordTemperatures stores a batch of daily temperatures, typically the
+// export of a weather station or of a weather service history.
+func (s *Server) recordTemperatures(w http.ResponseWriter, r *http.Request) {
+	var payload []temperaturePayload
+	if err := decodeJSON(r.Body, &payload); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	temperatures := make([]core.DailyTemperature, len(payload))
+	for i, entry := range payload {
+		date, err := parseTime(entry.Date)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		temperatures[i] = core.DailyTemperature{Date: date, MeanC: entry.MeanC}
+	}
+	ds := s.store.Data()
+	count, err := core.SetTemperatures(&ds, temperatures)
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	if err := s.store.Replace(ds); err != nil {
+		s.handleStoreError(w, err)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"temperatures","count":%d}`, count)
+	s.writeJSON(w, http.StatusOK, map[string]int{"recorded": count})
+}
@@ -0,0 +1,125 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_handleTemperaturesAPI(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		method string
+		body   string
+	}
+	type want struct {
+		statusCode   int
+		replaced     bool
+		temperatures int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "records temperatures",
+			params: params{method: http.MethodPost, body: `[{"date":"2024-01-01T00:00:00Z","mean_c":2.5},{"date":"2024-01-02T00:00:00Z","mean_c":-1}]`},
+			want:   want{statusCode: http.StatusOK, replaced: true, temperatures: 2},
+		},
+		{
+			name:   "rejects implausible temperature",
+			params: params{method: http.MethodPost, body: `[{"date":"2024-01-01T00:00:00Z","mean_c":120}]`},
+			want:   want{statusCode: http.StatusBadRequest},
+		},
+		{
+			name:   "rejects invalid date",
+			params: params{method: http.MethodPost, body: `[{"date":"01/01/2024","mean_c":2}]`},
+			want:   want{statusCode: http.StatusBadRequest},
+		},
+		{
+			name:   "lists temperatures",
+			params: params{method: http.MethodGet},
+			want:   want{statusCode: http.StatusOK},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{}
+			server := NewServer(store, Config{})
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, httptest.NewRequest(tc.params.method, "/api/temperatures", strings.NewReader(tc.params.body)))
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.replaced, store.replaced, tc.name)
+			assert.Len(t, store.data.Temperatures, tc.want.temperatures, tc.name)
+		})
+	}
+}
+
+func TestServer_handleModelAPI(t *testing.T) {
+	t.Parallel()
+
+	ds := core.DataStore{}
+	for month := time.October; month <= time.December; month++ {
+		start := time.Date(2023, month, 1, 0, 0, 0, 0, time.UTC)
+		ds.Consumptions = append(ds.Consumptions, core.Consumption{Meta: core.Meta{ID: core.NewID()}, ConsumedAt: start, Bags: int(month)})
+		for day := start; day.Month() == month; day = day.AddDate(0, 0, 1) {
+			ds.Temperatures = append(ds.Temperatures, core.DailyTemperature{Date: day, MeanC: 20 - float64(month)})
+		}
+	}
+
+	type params struct {
+		method string
+	}
+	type want struct {
+		statusCode int
+		fitted     bool
+		months     int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "fits the model", params: params{method: http.MethodGet}, want: want{statusCode: http.StatusOK, fitted: true, months: 3}},
+		{name: "rejects writes", params: params{method: http.MethodPost}, want: want{statusCode: http.StatusMethodNotAllowed}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{data: ds}, Config{})
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, httptest.NewRequest(tc.params.method, "/api/model", nil))
+
+			require.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			if tc.want.statusCode != http.StatusOK {
+				return
+			}
+			var model core.ConsumptionModel
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &model), tc.name)
+			assert.Equal(t, tc.want.fitted, model.Fitted, tc.name)
+			assert.Len(t, model.Months, tc.want.months, tc.name)
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package http
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+
+	"pellets-tracker/internal/core"
+)
+
+// imageImportResult reports how the files of an imported archive were used.
+type imageImportResult struct {
+	Updated   []string          `json:"updated"`
+	Unmatched []string          `json:"unmatched"`
+	Invalid   map[string]string `json:"invalid"`
+}
+
+// exportImages streams a zip holding one file per brand image, named after
+// the brand so the archive can be edited and imported back.
+func (s *Server) exportImages(w http.ResponseWriter, _ *http.Request) {
+	ds := s.store.Data()
+	files := brandImageFiles(ds.Brands)
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename=pellets-images.zip")
+	archive := zip.NewWriter(w)
+	for _, brand := range ds.Brands {
+		name, ok := files[brand.ID]
+		if !ok {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(brand.ImageBase64)
+		if err != nil {
+			log.Printf("export images: brand %s: %v", brand.ID, err)
+			continue
+		}
+		// Images are already compressed, storing them avoids a useless deflate.
+		file, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: brand.UpdatedAt})
+		if err != nil {
+			log.Printf("export images: %v", err)
+			return
+		}
+		if _, err := file.Write(data); err != nil {
+			log.Printf("export images: %v", err)
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		log.Printf("export images: %v", err)
+	}
+}
+
+func (s *Server) handleImportImages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	ds := s.store.Data()
+	maxBytes := s.effectiveMaxBrandImageBytes()*int64(max(len(ds.Brands), 1)) + brandImageRequestOverhead
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			s.writeError(w, http.StatusRequestEntityTooLarge, errors.New("archive too large"))
+			return
+		}
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid zip archive: %w", err))
+		return
+	}
+
+	brands := brandsByImageName(ds.Brands)
+	result := imageImportResult{Updated: []string{}, Unmatched: []string{}, Invalid: map[string]string{}}
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() || strings.HasPrefix(path.Base(file.Name), ".") {
+			continue
+		}
+		brand, ok := brands[imageNameKey(file.Name)]
+		if !ok {
+			result.Unmatched = append(result.Unmatched, file.Name)
+			continue
+		}
+		imageBase64, err := s.importImage(file)
+		if err != nil {
+			result.Invalid[file.Name] = err.Error()
+			continue
+		}
+		if _, err := core.SetBrandImage(&ds, brand.ID, imageBase64); err != nil {
+			s.handleCoreError(w, err)
+			return
+		}
+		result.Updated = append(result.Updated, brand.Name)
+	}
+
+	if len(result.Updated) > 0 {
+		if err := s.store.Replace(ds); err != nil {
+			s.handleStoreError(w, err)
+			return
+		}
+		log.Printf(`{"type":"save","entity":"brand_images","count":%d}`, len(result.Updated))
+	}
+	sort.Strings(result.Updated)
+	s.writeJSON(w, http.StatusOK, result)
+}
+
+// importImage validates and resizes an archive entry like an uploaded image.
+func (s *Server) importImage(file *zip.File) (string, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	return s.encodeBrandImage(rc)
+}
+
+// brandImageFiles names the image file of every brand that has one. Brands
+// whose names reduce to the same file name get their ID appended.
+func brandImageFiles(brands []core.Brand) map[core.ID]string {
+	files := make(map[core.ID]string, len(brands))
+	used := make(map[string]bool, len(brands))
+	for _, brand := range brands {
+		if strings.TrimSpace(brand.ImageBase64) == "" {
+			continue
+		}
+		stem := imageFileStem(brand.Name)
+		if used[stem] {
+			stem += "-" + string(brand.ID)
+		}
+		used[stem] = true
+		files[brand.ID] = stem + imageExtension(brand.ImageBase64)
+	}
+	return files
+}
+
+// brandsByImageName indexes brands by every file name that designates them:
+// their exported file name, with or without the ID suffix.
+func brandsByImageName(brands []core.Brand) map[string]core.Brand {
+	index := make(map[string]core.Brand, len(brands)*2)
+	for _, brand := range brands {
+		stem := imageFileStem(brand.Name)
+		if _, taken := index[stem]; !taken {
+			index[stem] = brand
+		}
+		index[stem+"-"+strings.ToLower(string(brand.ID))] = brand
+	}
+	return index
+}
+
+// imageNameKey turns an archive entry name into a brandsByImageName key.
+func imageNameKey(name string) string {
+	base := path.Base(strings.ReplaceAll(name, "\\", "/"))
+	return imageFileStem(strings.TrimSuffix(base, path.Ext(base)))
+}
+
+// imageFileStem builds a portable file name from a brand name: lower case
+// ASCII letters and digits separated by dashes.
+func imageFileStem(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range norm.NFD.String(strings.ToLower(name)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Drop the accents split off by the decomposition.
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(r)
+		default:
+			dash = true
+		}
+	}
+	if b.Len() == 0 {
+		return "marque"
+	}
+	return b.String()
+}
+
+func imageExtension(imageBase64 string) string {
+	switch imageContentType(imageBase64) {
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	default:
+		return ".jpg"
+	}
+}
+
+// imageContentType sniffs the media type of a stored brand image, JPEG when
+// it is not recognised.
+func imageContentType(imageBase64 string) string {
+	head, err := base64.StdEncoding.DecodeString(imageBase64[:min(len(imageBase64), 64)])
+	if err != nil && len(head) == 0 {
+		return "image/jpeg"
+	}
+	switch contentType := http.DetectContentType(head); contentType {
+	case "image/png", "image/gif", "image/webp":
+		return contentType
+	default:
+		return "image/jpeg"
+	}
+}
@@ -0,0 +1,203 @@
+package http
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestImageFileStem(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		name string
+	}
+	type want struct {
+		stem string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "plain name", params: params{name: "Granules"}, want: want{stem: "granules"}},
+		{name: "accents and spaces", params: params{name: "Bois Énergie Vosges"}, want: want{stem: "bois-energie-vosges"}},
+		{name: "punctuation collapses", params: params{name: "  A/B -- C.  "}, want: want{stem: "a-b-c"}},
+		{name: "no usable character", params: params{name: "🔥"}, want: want{stem: "marque"}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want.stem, imageFileStem(tc.params.name), tc.name)
+		})
+	}
+}
+
+func TestServer_brandImagesArchive(t *testing.T) {
+	t.Parallel()
+
+	pngImage := func(width int) []byte {
+		img := imaging.New(width, 10, color.NRGBA{R: 200, G: 100, B: 50, A: 255})
+		var buf bytes.Buffer
+		require.NoError(t, png.Encode(&buf, img))
+		return buf.Bytes()
+	}
+	brand := func(name string, image []byte) core.Brand {
+		b := core.Brand{Meta: core.Meta{ID: core.NewID(), CreatedAt: time.Now(), UpdatedAt: time.Now()}, Name: name}
+		if image != nil {
+			b.ImageBase64 = base64.StdEncoding.EncodeToString(image)
+		}
+		return b
+	}
+	zipOf := func(files map[string][]byte) []byte {
+		var buf bytes.Buffer
+		archive := zip.NewWriter(&buf)
+		for name, data := range files {
+			f, err := archive.Create(name)
+			require.NoError(t, err)
+			_, err = f.Write(data)
+			require.NoError(t, err)
+		}
+		require.NoError(t, archive.Close())
+		return buf.Bytes()
+	}
+
+	type params struct {
+		brands  []core.Brand
+		archive []byte
+	}
+	type want struct {
+		statusCode int
+		files      []string
+		updated    []string
+		unmatched  []string
+		invalid    []string
+		replaced   bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "exports images named by brand",
+			params: params{brands: []core.Brand{
+				brand("Bois Énergie", pngImage(20)),
+				brand("Granules", nil),
+			}},
+			want: want{statusCode: http.StatusOK, files: []string{"bois-energie.png"}},
+		},
+		{
+			name: "imports images matched by file name",
+			params: params{
+				brands: []core.Brand{brand("Bois Énergie", nil), brand("Granules", nil)},
+				archive: zipOf(map[string][]byte{
+					"export/Bois-Energie.PNG": pngImage(20),
+					"inconnue.png":            pngImage(20),
+					"granules.jpg":            []byte("not an image"),
+					"__MACOSX/._granules.jpg": []byte("resource fork"),
+				}),
+			},
+			want: want{
+				statusCode: http.StatusOK,
+				updated:    []string{"Bois Énergie"},
+				unmatched:  []string{"inconnue.png"},
+				invalid:    []string{"granules.jpg"},
+				replaced:   true,
+			},
+		},
+		{
+			name: "archive without match keeps the datastore",
+			params: params{
+				brands:  []core.Brand{brand("Granules", nil)},
+				archive: zipOf(map[string][]byte{"autre.png": pngImage(20)}),
+			},
+			want: want{statusCode: http.StatusOK, unmatched: []string{"autre.png"}},
+		},
+		{
+			name:   "rejects invalid archive",
+			params: params{brands: []core.Brand{brand("Granules", nil)}, archive: []byte("not a zip")},
+			want:   want{statusCode: http.StatusBadRequest},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: core.DataStore{Brands: tc.params.brands}}
+			server := NewServer(store, Config{})
+			rec := httptest.NewRecorder()
+
+			if tc.params.archive == nil {
+				server.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/export/images", nil))
+				require.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+				assert.Equal(t, "application/zip", rec.Header().Get("Content-Type"), tc.name)
+				archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+				require.NoError(t, err, tc.name)
+				var files []string
+				for _, file := range archive.File {
+					files = append(files, file.Name)
+					rc, err := file.Open()
+					require.NoError(t, err, tc.name)
+					data, err := io.ReadAll(rc)
+					require.NoError(t, err, tc.name)
+					assert.Equal(t, tc.params.brands[0].ImageBase64, base64.StdEncoding.EncodeToString(data), tc.name)
+				}
+				assert.Equal(t, tc.want.files, files, tc.name)
+				return
+			}
+
+			server.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/import/images", bytes.NewReader(tc.params.archive)))
+			require.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.replaced, store.replaced, tc.name)
+			if tc.want.statusCode != http.StatusOK {
+				return
+			}
+			var result imageImportResult
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result), tc.name)
+			sort.Strings(result.Unmatched)
+			var invalid []string
+			for name := range result.Invalid {
+				invalid = append(invalid, name)
+			}
+			assert.Equal(t, tc.want.updated, nilIfEmpty(result.Updated), tc.name)
+			assert.Equal(t, tc.want.unmatched, nilIfEmpty(result.Unmatched), tc.name)
+			assert.Equal(t, tc.want.invalid, invalid, tc.name)
+			for _, b := range store.Data().Brands {
+				imported := false
+				for _, name := range tc.want.updated {
+					imported = imported || name == b.Name
+				}
+				assert.Equal(t, imported, b.ImageBase64 != "", tc.name)
+			}
+		})
+	}
+}
+
+func nilIfEmpty(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
@@ -0,0 +1,208 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"pellets-tracker/internal/core"
+)
+
+// maxImportJSONBytes bounds an imported datastore, brand images included.
+const maxImportJSONBytes = 64 << 20
+
+// snapshotter is implemented by stores able to keep a copy of the datastore
+// before it is overwritten by an import.
+type snapshotter interface {
+	Snapshot(label string) (string, error)
+}
+
+type importResponse struct {
+	core.ImportSummary
+	// Backup is the copy of the datastore taken before the import.
+	Backup string `json:"backup,omitempty"`
+}
+
+// handleImportJSON restores a datastore exported by /api/export/json, merged
+// into the current one or replacing it depending on the mode query parameter.
+func (s *Server) handleImportJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	mode, err := core.ParseImportMode(r.URL.Query().Get("mode"))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportJSONBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			s.writeError(w, http.StatusRequestEntityTooLarge, errors.New("datastore too large"))
+			return
+		}
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	imported, err := decodeDataStore(body)
+	if err != nil {
+		s.writeValidationError(w, err)
+		return
+	}
+
+	resp, err := s.importDataStore(imported, mode)
+	if err != nil {
+		var ve core.ValidationErrors
+		if errors.As(err, &ve) {
+			s.writeValidationError(w, err)
+			return
+		}
+		s.handleStoreError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+// decodeDataStore checks an uploaded datastore against the schema, so the
+// errors point at the entries at fault, then decodes it.
+func decodeDataStore(body []byte) (core.DataStore, error) {
+	if err := core.ValidateDataStoreJSON(body); err != nil {
+		return core.DataStore{}, err
+	}
+	var imported core.DataStore
+	if err := decodeJSON(bytes.NewReader(body), &imported); err != nil {
+		return core.DataStore{}, err
+	}
+	return imported, nil
+}
+
+// handleSchemaAPI serves the JSON Schema imports are validated against.
+func (s *Server) handleSchemaAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	if _, err := w.Write(core.DataStoreSchema); err != nil {
+		log.Printf("write schema: %v", err)
+	}
+}
+
+// importDataStore snapshots the current datastore, then applies the import.
+func (s *Server) importDataStore(imported core.DataStore, mode core.ImportMode) (importResponse, error) {
+	ds := s.store.Data()
+	summary, err := core.ImportDataStore(&ds, imported, mode)
+	if err != nil {
+		return importResponse{}, err
+	}
+	resp := importResponse{ImportSummary: summary}
+	if snap, ok := s.changes.DataStore.(snapshotter); ok {
+		if resp.Backup, err = snap.Snapshot("import"); err != nil {
+			return importResponse{}, fmt.Errorf("backup before import: %w", err)
+		}
+	}
+	if err := s.store.Replace(ds); err != nil {
+		return importResponse{}, err
+	}
+	log.Printf(`{"type":"import","mode":%q,"brands":%d,"purchases":%d,"consumptions":%d,"backup":%q}`, mode, summary.Brands, summary.Purchases, summary.Consumptions, resp.Backup)
+	return resp, nil
+}
+
+type dataPageView struct {
+	Brands       int
+	Purchases    int
+	Consumptions int
+	Mode         core.ImportMode
+	Errors       core.ValidationErrors
+}
+
+// handleDataPage lists the exports and restores a JSON export uploaded
+// through its form.
+func (s *Server) handleDataPage(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.renderDataPage(w, http.StatusOK, nil, dataPageView{Mode: core.ImportMerge})
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportJSONBytes+brandImageRequestOverhead)
+		if err := r.ParseMultipartForm(maxImportJSONBytes); err != nil {
+			s.renderDataPage(w, http.StatusBadRequest, &flashMessage{Kind: "error", Message: "Fichier trop volumineux ou invalide"}, dataPageView{Mode: core.ImportMerge})
+			return
+		}
+		view := dataPageView{Mode: core.ImportMerge}
+		mode, err := core.ParseImportMode(r.FormValue("mode"))
+		if err != nil {
+			s.renderDataPage(w, http.StatusBadRequest, &flashMessage{Kind: "error", Message: "Mode d'import inconnu"}, view)
+			return
+		}
+		view.Mode = mode
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			s.renderDataPage(w, http.StatusBadRequest, &flashMessage{Kind: "error", Message: "Sélectionnez un export JSON"}, view)
+			return
+		}
+		defer file.Close()
+		body, err := io.ReadAll(file)
+		if err != nil {
+			s.renderDataPage(w, http.StatusBadRequest, &flashMessage{Kind: "error", Message: "Impossible de lire le fichier"}, view)
+			return
+		}
+		imported, err := decodeDataStore(body)
+		if err != nil {
+			var ve core.ValidationErrors
+			if errors.As(err, &ve) {
+				view.Errors = ve
+				s.renderDataPage(w, http.StatusBadRequest, &flashMessage{Kind: "error", Message: "Le fichier ne respecte pas le format des exports, rien n'a été importé"}, view)
+				return
+			}
+			s.renderDataPage(w, http.StatusBadRequest, &flashMessage{Kind: "error", Message: "Le fichier n'est pas un export JSON valide : " + err.Error()}, view)
+			return
+		}
+
+		resp, err := s.importDataStore(imported, mode)
+		if err != nil {
+			var ve core.ValidationErrors
+			if errors.As(err, &ve) {
+				view.Errors = ve
+				s.renderDataPage(w, http.StatusBadRequest, &flashMessage{Kind: "error", Message: "L'export contient des incohérences, rien n'a été importé"}, view)
+				return
+			}
+			log.Printf("import datastore: %v", err)
+			s.renderDataPage(w, http.StatusInternalServerError, &flashMessage{Kind: "error", Message: "Impossible d'enregistrer l'import"}, view)
+			return
+		}
+		s.renderDataPage(w, http.StatusOK, &flashMessage{Kind: "success", Message: importFlashMessage(resp)}, view)
+	default:
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (s *Server) renderDataPage(w http.ResponseWriter, status int, flash *flashMessage, view dataPageView) {
+	ds := s.store.Data()
+	view.Brands = len(ds.Brands)
+	view.Purchases = len(ds.Purchases)
+	view.Consumptions = len(ds.Consumptions)
+	s.renderPage(w, status, "data", "Données", "data", view, flash)
+}
+
+func importFlashMessage(resp importResponse) string {
+	var b strings.Builder
+	if resp.Mode == core.ImportReplace {
+		b.WriteString("Données remplacées : ")
+	} else {
+		b.WriteString("Import terminé : ")
+	}
+	fmt.Fprintf(&b, "%d marques, %d achats, %d consommations, %d transferts et %d températures", resp.Brands, resp.Purchases, resp.Consumptions, resp.Transfers, resp.Temperatures)
+	if resp.Mode == core.ImportMerge {
+		fmt.Fprintf(&b, " ajoutés, %d entrées déjà présentes", resp.Skipped)
+	}
+	b.WriteString(".")
+	if resp.Backup != "" {
+		fmt.Fprintf(&b, " Sauvegarde préalable : %s.", resp.Backup)
+	}
+	return b.String()
+}
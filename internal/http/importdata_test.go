@@ -0,0 +1,236 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+// snapshotStore is a stubDataStore able to take the backup made before an
+// import.
+type snapshotStore struct {
+	stubDataStore
+	snapshots int
+}
+
+func (s *snapshotStore) Snapshot(label string) (string, error) {
+	s.snapshots++
+	return "data/backups/pellets.json-" + label + ".json", nil
+}
+
+func TestServer_handleImportJSON(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC)
+	current := core.DataStore{
+		Brands:    []core.Brand{{Meta: core.Meta{ID: "brand-a"}, Name: "Granules"}},
+		Purchases: []core.Purchase{{Meta: core.Meta{ID: "purchase-1"}, BrandID: "brand-a", PurchasedAt: at, Bags: 10, BagWeightKg: 15}},
+	}
+	export, err := json.Marshal(core.DataStore{
+		Brands: []core.Brand{{Meta: core.Meta{ID: "brand-b"}, Name: "Bois Énergie"}},
+		Purchases: []core.Purchase{
+			{Meta: core.Meta{ID: "purchase-2"}, BrandID: "brand-b", PurchasedAt: at, Bags: 5, BagWeightKg: 15},
+		},
+	})
+	require.NoError(t, err)
+
+	type params struct {
+		method string
+		query  string
+		body   string
+	}
+	type want struct {
+		statusCode int
+		replaced   bool
+		brands     int
+		purchases  int
+		snapshots  int
+		contains   string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "merges by default",
+			params: params{method: http.MethodPost, body: string(export)},
+			want:   want{statusCode: http.StatusOK, replaced: true, brands: 2, purchases: 2, snapshots: 1},
+		},
+		{
+			name:   "replaces",
+			params: params{method: http.MethodPost, query: "?mode=replace", body: string(export)},
+			want:   want{statusCode: http.StatusOK, replaced: true, brands: 1, purchases: 1, snapshots: 1},
+		},
+		{
+			name:   "rejects inconsistent export",
+			params: params{method: http.MethodPost, body: `{"brands":[],"purchases":[{"id":"p","brand_id":"missing","purchased_at":"2024-01-10T00:00:00Z","bags":1,"bag_weight_kg":15}],"consumptions":[]}`},
+			want:   want{statusCode: http.StatusBadRequest, brands: 1, purchases: 1},
+		},
+		{
+			name:   "points at the entry breaking the schema",
+			params: params{method: http.MethodPost, body: `{"brands":[],"purchases":[{"id":"p","brand_id":"b","purchased_at":"2024-01-10T00:00:00Z","bags":"1"}],"consumptions":[]}`},
+			want:   want{statusCode: http.StatusBadRequest, brands: 1, purchases: 1, contains: `"Field":"/purchases/0/bags","Message":"expected integer, got string"`},
+		},
+		{
+			name:   "rejects unknown mode",
+			params: params{method: http.MethodPost, query: "?mode=overwrite", body: string(export)},
+			want:   want{statusCode: http.StatusBadRequest, brands: 1, purchases: 1},
+		},
+		{
+			name:   "rejects reads",
+			params: params{method: http.MethodGet},
+			want:   want{statusCode: http.StatusMethodNotAllowed, brands: 1, purchases: 1},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &snapshotStore{stubDataStore: stubDataStore{data: current}}
+			server := NewServer(store, Config{})
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, httptest.NewRequest(tc.params.method, "/api/import/json"+tc.params.query, strings.NewReader(tc.params.body)))
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.replaced, store.replaced, tc.name)
+			assert.Equal(t, tc.want.snapshots, store.snapshots, tc.name)
+			assert.Len(t, store.data.Brands, tc.want.brands, tc.name)
+			assert.Len(t, store.data.Purchases, tc.want.purchases, tc.name)
+			assert.Contains(t, rec.Body.String(), tc.want.contains, tc.name)
+		})
+	}
+}
+
+func TestServer_handleSchemaAPI(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		method string
+	}
+	type want struct {
+		statusCode  int
+		contentType string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "serves the datastore schema",
+			params: params{method: http.MethodGet},
+			want:   want{statusCode: http.StatusOK, contentType: "application/schema+json"},
+		},
+		{
+			name:   "rejects writes",
+			params: params{method: http.MethodPost},
+			want:   want{statusCode: http.StatusMethodNotAllowed, contentType: "application/json"},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{}, Config{})
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, httptest.NewRequest(tc.params.method, "/api/schema", nil))
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.contentType, rec.Header().Get("Content-Type"), tc.name)
+			if tc.want.statusCode == http.StatusOK {
+				var schema map[string]any
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &schema), tc.name)
+				assert.Contains(t, schema, "$defs", tc.name)
+			}
+		})
+	}
+}
+
+func TestServer_handleDataPage(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		file string
+		mode string
+	}
+	type want struct {
+		statusCode int
+		contains   string
+		brands     int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "imports the uploaded export",
+			params: params{file: `{"brands":[{"id":"brand-a","name":"Granules"}],"purchases":[],"consumptions":[]}`, mode: "replace"},
+			want:   want{statusCode: http.StatusOK, contains: "Données remplacées : 1 marques", brands: 1},
+		},
+		{
+			name:   "lists the inconsistencies",
+			params: params{file: `{"brands":[{"id":"brand-a","name":""}],"purchases":[],"consumptions":[]}`, mode: "merge"},
+			want:   want{statusCode: http.StatusBadRequest, contains: "brands[0].name"},
+		},
+		{
+			name:   "rejects another file",
+			params: params{file: `brand,bags`, mode: "merge"},
+			want:   want{statusCode: http.StatusBadRequest, contains: "export JSON valide"},
+		},
+		{
+			name:   "lists the schema violations",
+			params: params{file: `{"brands":[{"id":"brand-a","name":"Granules","lead_time":3}],"purchases":[],"consumptions":[]}`, mode: "merge"},
+			want:   want{statusCode: http.StatusBadRequest, contains: "<code>/brands/0/lead_time</code> : unknown property"},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{}
+			server := NewServer(store, Config{})
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			require.NoError(t, writer.WriteField("mode", tc.params.mode), tc.name)
+			part, err := writer.CreateFormFile("file", "pellets-datastore.json")
+			require.NoError(t, err, tc.name)
+			_, err = part.Write([]byte(tc.params.file))
+			require.NoError(t, err, tc.name)
+			require.NoError(t, writer.Close(), tc.name)
+
+			req := httptest.NewRequest(http.MethodPost, "/donnees", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Contains(t, rec.Body.String(), tc.want.contains, tc.name)
+			assert.Len(t, store.data.Brands, tc.want.brands, tc.name)
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/jobs"
+)
+
+// JobStatuses reports the state of the scheduled jobs, see jobs.Scheduler.
+type JobStatuses interface {
+	Statuses() []jobs.Status
+}
+
+// handleJobsAPI serves the state of the scheduled jobs: their schedule, next
+// run and the outcome of the last one.
+func (s *Server) handleJobsAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	statuses := []jobs.Status{}
+	if s.jobs != nil {
+		statuses = s.jobs.Statuses()
+	}
+	s.writeJSON(w, http.StatusOK, statuses)
+}
+
+// cachedForecast is a forecast computed by RefreshForecast, valid for the
+// datastore last updated at updatedAt, on day.
+type cachedForecast struct {
+	forecast  core.StockForecast
+	updatedAt time.Time
+	day       string
+}
+
+// RefreshForecast computes the stock-out forecast ahead of the requests, the
+// heaviest statistic of the stats page on a small board. It is served until
+// the datastore changes or the day ends; the requests compute their own
+// forecast meanwhile.
+func (s *Server) RefreshForecast(ctx context.Context) error {
+	ds := s.store.Data()
+	now := time.Now().UTC()
+	forecast, err := core.ComputeForecast(ctx, &ds, now)
+	if err != nil {
+		return err
+	}
+	s.forecast.Store(&cachedForecast{forecast: forecast, updatedAt: ds.UpdatedAt, day: now.Format("2006-01-02")})
+	return nil
+}
+
+// stockForecast returns the forecast of ds, the one computed by
+// RefreshForecast when ds has not changed since.
+func (s *Server) stockForecast(ctx context.Context, ds *core.DataStore, now time.Time) (core.StockForecast, error) {
+	if cached := s.forecast.Load(); cached != nil && cached.updatedAt.Equal(ds.UpdatedAt) && cached.day == now.Format("2006-01-02") {
+		return cached.forecast, nil
+	}
+	return core.ComputeForecast(ctx, ds, now)
+}
@@ -0,0 +1,122 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/jobs"
+)
+
+type stubJobStatuses []jobs.Status
+
+func (s stubJobStatuses) Statuses() []jobs.Status { return s }
+
+func TestServer_handleJobsAPI(t *testing.T) {
+	t.Parallel()
+
+	lastRun := time.Date(2026, time.January, 15, 3, 0, 0, 0, time.UTC)
+
+	type params struct {
+		method string
+		jobs   JobStatuses
+	}
+	type want struct {
+		statusCode int
+		body       string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "lists no job without scheduler",
+			params: params{method: http.MethodGet},
+			want:   want{statusCode: http.StatusOK, body: `[]`},
+		},
+		{
+			name: "lists the jobs",
+			params: params{method: http.MethodGet, jobs: stubJobStatuses{
+				{Name: "backup", Schedule: "30 2 * * *", Runs: 2, Failures: 1, LastRun: &jobs.Run{StartedAt: lastRun, DurationMillis: 12.5, Error: "disk full"}},
+			}},
+			want: want{statusCode: http.StatusOK, body: `[{"name":"backup","schedule":"30 2 * * *","running":false,"runs":2,"failures":1,"last_run":{"started_at":"2026-01-15T03:00:00Z","duration_ms":12.5,"error":"disk full"}}]`},
+		},
+		{
+			name:   "is read-only",
+			params: params{method: http.MethodPost},
+			want:   want{statusCode: http.StatusMethodNotAllowed},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{}, Config{Jobs: tc.params.jobs})
+			req := httptest.NewRequest(tc.params.method, "/api/jobs", nil)
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			if tc.want.body != "" {
+				assert.JSONEq(t, tc.want.body, rec.Body.String(), tc.name)
+			}
+		})
+	}
+}
+
+func TestServer_RefreshForecast(t *testing.T) {
+	t.Parallel()
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	updatedAt := today.Add(-time.Hour)
+	brands := []core.Brand{{Meta: core.Meta{ID: "brand"}, Name: "Woodstock"}}
+	purchases := []core.Purchase{{Meta: core.Meta{ID: "p1"}, BrandID: "brand", PurchasedAt: today.AddDate(0, 0, -10), Bags: 12, BagWeightKg: 15, TotalWeightKg: 180}}
+
+	type params struct {
+		// updatedAt is when the datastore is updated after the refresh.
+		updatedAt time.Time
+	}
+	type want struct {
+		stockKg string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "serves the forecast refreshed", params: params{updatedAt: updatedAt}, want: want{stockKg: `"stock_kg":180`}},
+		{name: "computes it again once the datastore changed", params: params{updatedAt: updatedAt.Add(time.Minute)}, want: want{stockKg: `"stock_kg":150`}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: core.DataStore{Meta: core.Meta{UpdatedAt: updatedAt}, Brands: brands, Purchases: purchases}}
+			server := NewServer(store, Config{})
+			require.NoError(t, server.RefreshForecast(context.Background()), tc.name)
+			store.data.Consumptions = []core.Consumption{{Meta: core.Meta{ID: "c1"}, BrandID: "brand", ConsumedAt: today.AddDate(0, 0, -1), Bags: 2}}
+			store.data.UpdatedAt = tc.params.updatedAt
+
+			req := httptest.NewRequest(http.MethodGet, "/api/stats/forecast", nil)
+			rec := httptest.NewRecorder()
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code, tc.name)
+			assert.Contains(t, rec.Body.String(), tc.want.stockKg, tc.name)
+		})
+	}
+}
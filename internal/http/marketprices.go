@@ -0,0 +1,68 @@
+package http
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"pellets-tracker/internal/core"
+)
+
+type marketPricePayload struct {
+	// Month is "2024-10" or a timestamp within the month.
+	Month              string     `json:"month"`
+	PricePerTonneCents core.Money `json:"price_per_tonne_cents"`
+	Source             string     `json:"source"`
+}
+
+// handleMarketPricesAPI serves the market price index the purchases are
+// compared with, filled by the index integration or recorded by hand for an
+// index that cannot be fetched.
+func (s *Server) handleMarketPricesAPI(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ds := s.store.Data()
+		prices := ds.MarketPrices
+		if prices == nil {
+			prices = []core.MarketPrice{}
+		}
+		s.writeJSON(w, http.StatusOK, prices)
+	case http.MethodPost:
+		s.recordMarketPrices(w, r)
+	default:
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+// recordMarketPrices stores a batch of monthly market prices, replacing the
+// price of a month already known.
+func (s *Server) recordMarketPrices(w http.ResponseWriter, r *http.Request) {
+	var payload []marketPricePayload
+	if err := decodeJSON(r.Body, &payload); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	prices := make([]core.MarketPrice, len(payload))
+	for i, entry := range payload {
+		month, err := time.Parse("2006-01", entry.Month)
+		if err != nil {
+			if month, err = parseTime(entry.Month); err != nil {
+				s.writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		prices[i] = core.MarketPrice{Month: month, PricePerTonneCents: entry.PricePerTonneCents, Source: entry.Source}
+	}
+	ds := s.store.Data()
+	count, err := core.SetMarketPrices(&ds, prices)
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	if err := s.store.Replace(ds); err != nil {
+		s.handleStoreError(w, err)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"market_prices","count":%d}`, count)
+	s.writeJSON(w, http.StatusOK, map[string]int{"recorded": count})
+}
@@ -0,0 +1,84 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_handleMarketPricesAPI(t *testing.T) {
+	t.Parallel()
+
+	october := time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+	type params struct {
+		method string
+		body   string
+	}
+	type want struct {
+		statusCode   int
+		bodyContains string
+		replaced     bool
+		months       []time.Time
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "records a month given as year and month",
+			params: params{method: http.MethodPost, body: `[{"month":"2024-09","price_per_tonne_cents":40740,"source":"Propellet"}]`},
+			want:   want{statusCode: http.StatusOK, bodyContains: `"recorded":1`, replaced: true, months: []time.Time{october.AddDate(0, -1, 0), october}},
+		},
+		{
+			name:   "replaces a month given as a timestamp",
+			params: params{method: http.MethodPost, body: `[{"month":"2024-10-15T00:00:00Z","price_per_tonne_cents":41500}]`},
+			want:   want{statusCode: http.StatusOK, bodyContains: `"recorded":1`, replaced: true, months: []time.Time{october}},
+		},
+		{
+			name:   "rejects a price that is not positive",
+			params: params{method: http.MethodPost, body: `[{"month":"2024-09","price_per_tonne_cents":0}]`},
+			want:   want{statusCode: http.StatusBadRequest, months: []time.Time{october}},
+		},
+		{
+			name:   "rejects an invalid month",
+			params: params{method: http.MethodPost, body: `[{"month":"septembre","price_per_tonne_cents":40740}]`},
+			want:   want{statusCode: http.StatusBadRequest, months: []time.Time{october}},
+		},
+		{
+			name:   "lists the index",
+			params: params{method: http.MethodGet},
+			want:   want{statusCode: http.StatusOK, bodyContains: `"price_per_tonne_cents":41230`, months: []time.Time{october}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: core.DataStore{MarketPrices: []core.MarketPrice{{Month: october, PricePerTonneCents: 41230}}}}
+			server := NewServer(store, Config{})
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, httptest.NewRequest(tc.params.method, "/api/marche/prix", strings.NewReader(tc.params.body)))
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Contains(t, rec.Body.String(), tc.want.bodyContains, tc.name)
+			assert.Equal(t, tc.want.replaced, store.replaced, tc.name)
+			var months []time.Time
+			for _, price := range store.data.MarketPrices {
+				months = append(months, price.Month)
+			}
+			assert.Equal(t, tc.want.months, months, tc.name)
+		})
+	}
+}
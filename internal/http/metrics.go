@@ -0,0 +1,185 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/store"
+)
+
+// StoreStats reports the saves of the datastore, exported on /metrics.
+type StoreStats interface {
+	Stats() store.Stats
+}
+
+// requestKey identifies a counter of requestCounts. The route is the pattern
+// of the mux that served the request, so IDs in paths do not multiply the
+// series.
+type requestKey struct {
+	route  string
+	status int
+}
+
+// requestCounts counts the requests served per route and status.
+type requestCounts struct {
+	mu     sync.Mutex
+	counts map[requestKey]uint64
+}
+
+func (c *requestCounts) add(route string, status int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counts == nil {
+		c.counts = make(map[requestKey]uint64)
+	}
+	c.counts[requestKey{route: route, status: status}]++
+}
+
+// snapshot returns the counters sorted by route then status.
+func (c *requestCounts) snapshot() ([]requestKey, map[requestKey]uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]requestKey, 0, len(c.counts))
+	counts := make(map[requestKey]uint64, len(c.counts))
+	for key, count := range c.counts {
+		keys = append(keys, key)
+		counts[key] = count
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		return keys[i].status < keys[j].status
+	})
+	return keys, counts
+}
+
+func (s *Server) metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lrw := &loggingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(lrw, r)
+		_, route := s.mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		s.requests.add(route, lrw.status)
+	})
+}
+
+// handleMetrics writes the metrics in the Prometheus text format.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	var buf bytes.Buffer
+	writeMetricHeader(&buf, "pellets_http_requests_total", "counter", "HTTP requests served by route and status.")
+	keys, counts := s.requests.snapshot()
+	for _, key := range keys {
+		writeMetric(&buf, "pellets_http_requests_total", []string{"route", key.route, "status", strconv.Itoa(key.status)}, float64(counts[key]))
+	}
+
+	if s.connections != nil {
+		s.connections.writeMetrics(&buf)
+	}
+	writeMetricHeader(&buf, "pellets_http_slow_clients_total", "counter", "Clients disconnected for not reading an export.")
+	writeMetric(&buf, "pellets_http_slow_clients_total", nil, float64(s.slowClients.Load()))
+
+	if s.storeStats != nil {
+		stats := s.storeStats.Stats()
+		writeMetricHeader(&buf, "pellets_store_saves_total", "counter", "Saves of the datastore file.")
+		writeMetric(&buf, "pellets_store_saves_total", nil, float64(stats.Saves))
+		writeMetricHeader(&buf, "pellets_store_save_errors_total", "counter", "Saves of the datastore file that failed.")
+		writeMetric(&buf, "pellets_store_save_errors_total", nil, float64(stats.SaveErrors))
+		writeMetricHeader(&buf, "pellets_store_file_size_bytes", "gauge", "Size of the datastore file as last written.")
+		writeMetric(&buf, "pellets_store_file_size_bytes", nil, float64(stats.FileSizeBytes))
+		writeMetricHeader(&buf, "pellets_store_write_lock_waits_total", "counter", "Datastore writes that waited for another one to be saved.")
+		writeMetric(&buf, "pellets_store_write_lock_waits_total", nil, float64(stats.WriteLockWaits))
+		writeMetricHeader(&buf, "pellets_store_write_lock_wait_seconds_total", "counter", "Time the datastore writes spent waiting for the others.")
+		writeMetric(&buf, "pellets_store_write_lock_wait_seconds_total", nil, stats.WriteLockWaitMillis/1000)
+		writeMetricHeader(&buf, "pellets_store_queued_writes", "gauge", "Datastore writes waiting for a save in progress.")
+		writeMetric(&buf, "pellets_store_queued_writes", nil, float64(stats.QueuedWrites))
+	}
+
+	if s.jobs != nil {
+		statuses := s.jobs.Statuses()
+		writeMetricHeader(&buf, "pellets_job_runs_total", "counter", "Runs of the scheduled jobs.")
+		for _, status := range statuses {
+			writeMetric(&buf, "pellets_job_runs_total", []string{"job", status.Name}, float64(status.Runs))
+		}
+		writeMetricHeader(&buf, "pellets_job_failures_total", "counter", "Runs of the scheduled jobs that failed.")
+		for _, status := range statuses {
+			writeMetric(&buf, "pellets_job_failures_total", []string{"job", status.Name}, float64(status.Failures))
+		}
+		writeMetricHeader(&buf, "pellets_job_last_success_timestamp_seconds", "gauge", "Time the scheduled jobs last succeeded.")
+		for _, status := range statuses {
+			if status.LastSuccessAt != nil {
+				writeMetric(&buf, "pellets_job_last_success_timestamp_seconds", []string{"job", status.Name}, float64(status.LastSuccessAt.Unix()))
+			}
+		}
+	}
+
+	ds := s.store.Data()
+	ctx, cancel := s.computeContext(r)
+	defer cancel()
+	inventory, err := core.ComputeInventaire(ctx, &ds, s.costing)
+	if err != nil {
+		// The other metrics stay useful while the history is inconsistent.
+		log.Printf("metrics: compute inventory: %v", err)
+	} else {
+		writeMetricHeader(&buf, "pellets_inventory_bags", "gauge", "Bags left in stock by brand.")
+		for _, brand := range inventory.Brands {
+			writeMetric(&buf, "pellets_inventory_bags", brandLabels(brand), float64(brand.Bags))
+		}
+		writeMetricHeader(&buf, "pellets_inventory_weight_kg", "gauge", "Weight left in stock by brand.")
+		for _, brand := range inventory.Brands {
+			writeMetric(&buf, "pellets_inventory_weight_kg", brandLabels(brand), brand.WeightKg)
+		}
+		writeMetricHeader(&buf, "pellets_inventory_cost_euros", "gauge", "Purchase cost of the stock left by brand.")
+		for _, brand := range inventory.Brands {
+			writeMetric(&buf, "pellets_inventory_cost_euros", brandLabels(brand), brand.TotalCost.Float64())
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = buf.WriteTo(w)
+}
+
+func brandLabels(brand core.BrandInventory) []string {
+	return []string{"brand_id", string(brand.BrandID), "brand", brand.BrandName}
+}
+
+func writeMetricHeader(buf *bytes.Buffer, name, kind, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeMetric writes one sample; labels alternates names and values.
+func writeMetric(buf *bytes.Buffer, name string, labels []string, value float64) {
+	buf.WriteString(name)
+	if len(labels) > 0 {
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(buf, "%s=\"%s\"", labels[i], metricLabelEscaper.Replace(labels[i+1]))
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	buf.WriteByte('\n')
+}
+
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,119 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/store"
+)
+
+type stubStoreStats struct {
+	stats store.Stats
+}
+
+func (s stubStoreStats) Stats() store.Stats {
+	return s.stats
+}
+
+func TestServer_handleMetrics(t *testing.T) {
+	t.Parallel()
+
+	lastSuccess := time.Date(2026, time.January, 15, 4, 0, 0, 0, time.UTC)
+
+	type params struct {
+		storeStats StoreStats
+		jobs       JobStatuses
+		requests   []string
+	}
+	type want struct {
+		bodyContains []string
+		bodyExcludes []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "counts requests by route and status",
+			params: params{requests: []string{"/api/achats", "/api/achats/missing", "/api/achats/other", "/healthz"}},
+			want: want{bodyContains: []string{
+				`pellets_http_requests_total{route="/api/achats",status="200"} 1`,
+				`pellets_http_requests_total{route="/api/achats/",status="404"} 2`,
+				`pellets_http_requests_total{route="/healthz",status="200"} 1`,
+			}},
+		},
+		{
+			name: "reports the inventory by brand",
+			want: want{
+				bodyContains: []string{
+					"# TYPE pellets_inventory_bags gauge",
+					`pellets_inventory_bags{brand_id="brand-w",brand="Woodstock"} 6`,
+					`pellets_inventory_weight_kg{brand_id="brand-w",brand="Woodstock"} 90`,
+					`pellets_inventory_cost_euros{brand_id="brand-w",brand="Woodstock"} 36`,
+				},
+				bodyExcludes: []string{"pellets_store_", "pellets_job_"},
+			},
+		},
+		{
+			name:   "reports the datastore saves",
+			params: params{storeStats: stubStoreStats{stats: store.Stats{Saves: 12, SaveErrors: 2, FileSizeBytes: 4096, WriteLockWaits: 3, WriteLockWaitMillis: 1500, QueuedWrites: 1}}},
+			want: want{bodyContains: []string{
+				"pellets_store_saves_total 12",
+				"# TYPE pellets_store_save_errors_total counter",
+				"pellets_store_save_errors_total 2",
+				"pellets_store_file_size_bytes 4096",
+				"pellets_store_write_lock_waits_total 3",
+				"pellets_store_write_lock_wait_seconds_total 1.5",
+				"pellets_store_queued_writes 1",
+			}},
+		},
+		{
+			name: "reports the scheduled jobs",
+			params: params{jobs: stubJobStatuses{
+				{Name: "backup", Runs: 3, Failures: 1, LastSuccessAt: &lastSuccess},
+				{Name: "integrity"},
+			}},
+			want: want{
+				bodyContains: []string{
+					`pellets_job_runs_total{job="backup"} 3`,
+					`pellets_job_failures_total{job="backup"} 1`,
+					`pellets_job_runs_total{job="integrity"} 0`,
+					`pellets_job_last_success_timestamp_seconds{job="backup"} 1.7684496e+09`,
+				},
+				bodyExcludes: []string{`pellets_job_last_success_timestamp_seconds{job="integrity"}`},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{data: alertsDataStore()}, Config{StoreStats: tc.params.storeStats, Jobs: tc.params.jobs})
+			handler := server.Handler()
+			for _, path := range tc.params.requests {
+				handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+			assert.Equal(t, http.StatusOK, rec.Code, tc.name)
+			assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain", tc.name)
+			body := rec.Body.String()
+			for _, fragment := range tc.want.bodyContains {
+				assert.Contains(t, body, fragment, tc.name)
+			}
+			for _, fragment := range tc.want.bodyExcludes {
+				assert.NotContains(t, body, fragment, tc.name)
+			}
+		})
+	}
+}
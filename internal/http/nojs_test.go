@@ -0,0 +1,248 @@
+package http
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+
+	"pellets-tracker/internal/core"
+)
+
+func noJSDataStore() core.DataStore {
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	return core.DataStore{
+		Brands: []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}},
+		Purchases: []core.Purchase{
+			{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: at(2023, time.September, 1), Bags: 20, BagWeightKg: 15, TotalWeightKg: 300, UnitPriceCents: 600, TotalPriceCents: 12000},
+			{Meta: core.Meta{ID: "p2"}, BrandID: "brand-w", PurchasedAt: at(2024, time.September, 1), Bags: 20, BagWeightKg: 15, TotalWeightKg: 300, UnitPriceCents: 650, TotalPriceCents: 13000},
+		},
+		Consumptions: []core.Consumption{
+			{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: at(2024, time.January, 10), Bags: 3},
+			{Meta: core.Meta{ID: "c2"}, BrandID: "brand-w", ConsumedAt: time.Now().UTC().AddDate(0, 0, -2), Bags: 1},
+		},
+		Silos: []core.Silo{{Meta: core.Meta{ID: "silo"}, Name: "Silo", CapacityKg: 4000}},
+		SiloReadings: []core.SiloReading{
+			{SiloID: "silo", ReadAt: at(2024, time.October, 1), LevelKg: 3000},
+			{SiloID: "silo", ReadAt: at(2024, time.October, 8), LevelKg: 2800},
+		},
+	}
+}
+
+// TestServer_pagesWithoutJavaScript renders the pages the way a browser
+// without JavaScript uses them: every link must lead somewhere, every form
+// must be accepted by a route, and nothing may depend on a script.
+func TestServer_pagesWithoutJavaScript(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		path string
+	}
+	type want struct {
+		charts int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "purchases", params: params{path: "/"}},
+		{name: "purchase edit page", params: params{path: "/achats/p1"}},
+		{name: "consumptions", params: params{path: "/consommations"}},
+		{name: "consumption edit page", params: params{path: "/consommations/c1"}},
+		{name: "statistics", params: params{path: "/stats"}, want: want{charts: 2}},
+		{name: "silos", params: params{path: "/silos"}, want: want{charts: 1}},
+		{name: "seasons", params: params{path: "/saisons"}},
+		{name: "season", params: params{path: "/saisons/2023-2024"}, want: want{charts: 1}},
+		{name: "calendar", params: params{path: "/calendrier?month=2024-01"}},
+		{name: "brands", params: params{path: "/marques"}, want: want{charts: 1}},
+		{name: "data", params: params{path: "/donnees"}},
+		{name: "actions", params: params{path: "/actions"}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{data: noJSDataStore()}, Config{})
+			rec := httptest.NewRecorder()
+			server.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.params.path, nil))
+			require.Equal(t, http.StatusOK, rec.Code, tc.name)
+			doc, err := html.Parse(rec.Body)
+			require.NoError(t, err, tc.name)
+
+			charts := 0
+			walkHTML(doc, func(n *html.Node) {
+				for _, a := range n.Attr {
+					assert.False(t, strings.HasPrefix(a.Key, "on"), "%s: inline %s handler on <%s>", tc.name, a.Key, n.Data)
+				}
+				switch {
+				case n.Data == "a":
+					href, _ := htmlAttr(n, "href")
+					if !strings.HasPrefix(href, "/") || strings.HasPrefix(href, "//") {
+						return
+					}
+					path, _, _ := strings.Cut(href, "#")
+					rec := httptest.NewRecorder()
+					server.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+					assert.Less(t, rec.Code, http.StatusBadRequest, "%s: link to %s", tc.name, href)
+				case n.Data == "form":
+					status := submitForm(t, n, tc.params.path)
+					assert.NotContains(t, []int{http.StatusNotFound, http.StatusMethodNotAllowed}, status, "%s: form posting to %s", tc.name, formAction(n, tc.params.path))
+					assert.Less(t, status, http.StatusInternalServerError, "%s: form posting to %s", tc.name, formAction(n, tc.params.path))
+				case n.Data == "button":
+					if kind, _ := htmlAttr(n, "type"); kind == "button" {
+						_, hidden := htmlAttr(n, "hidden")
+						assert.True(t, hidden, "%s: scripted button %q must be hidden without JavaScript", tc.name, htmlText(n))
+					}
+				case n.Data == "input":
+					if kind, _ := htmlAttr(n, "type"); kind == "date" {
+						value, _ := htmlAttr(n, "value")
+						assert.NotEmpty(t, value, "%s: date input without a default value", tc.name)
+					}
+				case hasHTMLClass(n, "chart-bar"):
+					charts++
+					next := n.NextSibling
+					for next != nil && next.Type != html.ElementNode {
+						next = next.NextSibling
+					}
+					if assert.NotNil(t, next, "%s: chart without its data", tc.name) {
+						assert.True(t, hasHTMLClass(next, "chart-data"), "%s: chart followed by <%s>", tc.name, next.Data)
+						assert.NotNil(t, findHTML(next, "table"), "%s: chart data without a table", tc.name)
+					}
+				}
+			})
+			assert.Equal(t, tc.want.charts, charts, tc.name)
+		})
+	}
+}
+
+// submitForm posts the values a form is rendered with to a server of its
+// own, so a form deleting the entry shown does not affect the other checks.
+func submitForm(t *testing.T, form *html.Node, page string) int {
+	t.Helper()
+
+	values := url.Values{}
+	walkHTML(form, func(n *html.Node) {
+		name, ok := htmlAttr(n, "name")
+		if !ok {
+			return
+		}
+		switch n.Data {
+		case "input":
+			kind, _ := htmlAttr(n, "type")
+			_, checked := htmlAttr(n, "checked")
+			if kind == "file" || ((kind == "checkbox" || kind == "radio") && !checked) {
+				return
+			}
+			value, _ := htmlAttr(n, "value")
+			values.Add(name, value)
+		case "textarea":
+			values.Add(name, htmlText(n))
+		case "select":
+			value := ""
+			walkHTML(n, func(option *html.Node) {
+				if option.Data != "option" {
+					return
+				}
+				if _, selected := htmlAttr(option, "selected"); selected || value == "" {
+					value, _ = htmlAttr(option, "value")
+				}
+			})
+			values.Add(name, value)
+		}
+	})
+
+	method, _ := htmlAttr(form, "method")
+	action := formAction(form, page)
+	var req *http.Request
+	switch enctype, _ := htmlAttr(form, "enctype"); {
+	case !strings.EqualFold(method, http.MethodPost):
+		req = httptest.NewRequest(http.MethodGet, action+"?"+values.Encode(), nil)
+	case enctype == "multipart/form-data":
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		for name, list := range values {
+			for _, value := range list {
+				require.NoError(t, writer.WriteField(name, value))
+			}
+		}
+		require.NoError(t, writer.Close())
+		req = httptest.NewRequest(http.MethodPost, action, &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+	default:
+		req = httptest.NewRequest(http.MethodPost, action, strings.NewReader(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	server := NewServer(&stubDataStore{data: noJSDataStore()}, Config{})
+	rec := httptest.NewRecorder()
+	server.mux.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func formAction(form *html.Node, page string) string {
+	if action, ok := htmlAttr(form, "action"); ok && action != "" {
+		return action
+	}
+	return page
+}
+
+func walkHTML(n *html.Node, visit func(*html.Node)) {
+	if n.Type == html.ElementNode {
+		visit(n)
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		walkHTML(child, visit)
+	}
+}
+
+func findHTML(n *html.Node, tag string) *html.Node {
+	var found *html.Node
+	walkHTML(n, func(child *html.Node) {
+		if found == nil && child.Data == tag {
+			found = child
+		}
+	})
+	return found
+}
+
+func htmlAttr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func hasHTMLClass(n *html.Node, class string) bool {
+	classes, _ := htmlAttr(n, "class")
+	for _, name := range strings.Fields(classes) {
+		if name == class {
+			return true
+		}
+	}
+	return false
+}
+
+func htmlText(n *html.Node) string {
+	var text strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.TextNode {
+			text.WriteString(child.Data)
+		}
+	}
+	return strings.TrimSpace(text.String())
+}
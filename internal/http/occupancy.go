@@ -0,0 +1,210 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"pellets-tracker/internal/core"
+)
+
+// maxCalendarBytes bounds an imported calendar.
+const maxCalendarBytes = 4 << 20
+
+// maxCalendarEventDays bounds the days a single calendar event marks, so a
+// recurring or mistyped event cannot flood the datastore.
+const maxCalendarEventDays = 366
+
+type occupancyPayload struct {
+	Date   string `json:"date"`
+	Status string `json:"status"`
+}
+
+func (s *Server) handleOccupancyAPI(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ds := s.store.Data()
+		occupancy := ds.Occupancy
+		if occupancy == nil {
+			occupancy = []core.DailyOccupancy{}
+		}
+		s.writeJSON(w, http.StatusOK, occupancy)
+	case http.MethodPost:
+		s.recordOccupancy(w, r)
+	default:
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+// recordOccupancy stores a batch of days with whether the house was
+// occupied; sending home for a day cancels an absence.
+func (s *Server) recordOccupancy(w http.ResponseWriter, r *http.Request) {
+	var payload []occupancyPayload
+	if err := decodeJSON(r.Body, &payload); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	days := make([]core.DailyOccupancy, len(payload))
+	for i, entry := range payload {
+		date, err := parseTime(entry.Date)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		days[i] = core.DailyOccupancy{Date: date, Status: entry.Status}
+	}
+	s.saveOccupancy(w, days)
+}
+
+// handleOccupancyCalendarAPI marks the days covered by the events of an
+// iCalendar file, such as the export of a holidays calendar, with the status
+// query parameter, vacation by default.
+func (s *Server) handleOccupancyCalendarAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = core.OccupancyVacation
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCalendarBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			s.writeError(w, http.StatusRequestEntityTooLarge, errors.New("file too large"))
+			return
+		}
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	dates, err := parseCalendarDays(body)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	days := make([]core.DailyOccupancy, len(dates))
+	for i, date := range dates {
+		days[i] = core.DailyOccupancy{Date: date, Status: status}
+	}
+	s.saveOccupancy(w, days)
+}
+
+func (s *Server) saveOccupancy(w http.ResponseWriter, days []core.DailyOccupancy) {
+	ds := s.store.Data()
+	count, err := core.SetOccupancy(&ds, days)
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	if err := s.store.Replace(ds); err != nil {
+		s.handleStoreError(w, err)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"occupancy","count":%d}`, count)
+	s.writeJSON(w, http.StatusOK, map[string]int{"recorded": count})
+}
+
+// parseCalendarDays lists the days covered by the VEVENT entries of an
+// iCalendar file, in file order. An all-day event ends the day before its
+// DTEND, as the format defines it; a timed event covers every day it
+// touches. Time zones are ignored, only the calendar dates are kept.
+func parseCalendarDays(data []byte) ([]time.Time, error) {
+	var (
+		days       []time.Time
+		inEvent    bool
+		start, end string
+		line       int
+	)
+	for _, content := range unfoldCalendarLines(data) {
+		line++
+		name, value, ok := strings.Cut(content, ":")
+		if !ok {
+			continue
+		}
+		// Parameters such as VALUE=DATE or TZID follow the name.
+		name, _, _ = strings.Cut(strings.ToUpper(name), ";")
+		value = strings.TrimSpace(value)
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			inEvent, start, end = true, "", ""
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			inEvent = false
+			eventDays, err := calendarEventDays(start, end)
+			if err != nil {
+				return nil, fmt.Errorf("event ending on line %d: %w", line, err)
+			}
+			days = append(days, eventDays...)
+		case inEvent && name == "DTSTART":
+			start = value
+		case inEvent && name == "DTEND":
+			end = value
+		}
+	}
+	return days, nil
+}
+
+// unfoldCalendarLines joins the continuation lines, which start with a space
+// or a tab, to the line they extend.
+func unfoldCalendarLines(data []byte) []string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxCalendarBytes)
+	for scanner.Scan() {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")) {
+			lines[len(lines)-1] += text[1:]
+			continue
+		}
+		lines = append(lines, text)
+	}
+	return lines
+}
+
+func calendarEventDays(start, end string) ([]time.Time, error) {
+	if start == "" {
+		return nil, errors.New("DTSTART is required")
+	}
+	first, err := parseCalendarDate(start)
+	if err != nil {
+		return nil, err
+	}
+	last := first
+	if end != "" {
+		if last, err = parseCalendarDate(end); err != nil {
+			return nil, err
+		}
+		// DTEND is exclusive for dates and for a time at midnight.
+		if len(end) == len("20060102") || strings.HasPrefix(end[len("20060102"):], "T000000") {
+			last = last.AddDate(0, 0, -1)
+		}
+		if last.Before(first) {
+			last = first
+		}
+	}
+	if last.Sub(first) >= maxCalendarEventDays*24*time.Hour {
+		return nil, fmt.Errorf("event longer than %d days", maxCalendarEventDays)
+	}
+	var days []time.Time
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+func parseCalendarDate(value string) (time.Time, error) {
+	if len(value) < len("20060102") {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	date, err := time.Parse("20060102", value[:len("20060102")])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	return date, nil
+}
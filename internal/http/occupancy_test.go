@@ -0,0 +1,147 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_handleOccupancyAPI(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		method string
+		body   string
+	}
+	type want struct {
+		statusCode int
+		replaced   bool
+		occupancy  int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "records occupancy",
+			params: params{method: http.MethodPost, body: `[{"date":"2024-01-01T00:00:00Z","status":"away"},{"date":"2024-01-02T00:00:00Z","status":"vacation"}]`},
+			want:   want{statusCode: http.StatusOK, replaced: true, occupancy: 2},
+		},
+		{
+			name:   "rejects unknown status",
+			params: params{method: http.MethodPost, body: `[{"date":"2024-01-01T00:00:00Z","status":"abroad"}]`},
+			want:   want{statusCode: http.StatusBadRequest},
+		},
+		{
+			name:   "rejects invalid date",
+			params: params{method: http.MethodPost, body: `[{"date":"01/01/2024","status":"away"}]`},
+			want:   want{statusCode: http.StatusBadRequest},
+		},
+		{
+			name:   "lists occupancy",
+			params: params{method: http.MethodGet},
+			want:   want{statusCode: http.StatusOK},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{}
+			server := NewServer(store, Config{})
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, httptest.NewRequest(tc.params.method, "/api/occupation", strings.NewReader(tc.params.body)))
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.replaced, store.replaced, tc.name)
+			assert.Len(t, store.data.Occupancy, tc.want.occupancy, tc.name)
+		})
+	}
+}
+
+func TestServer_handleOccupancyCalendarAPI(t *testing.T) {
+	t.Parallel()
+
+	day := func(d int) time.Time { return time.Date(2024, time.February, d, 0, 0, 0, 0, time.UTC) }
+	calendar := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"SUMMARY:Vacances d'hiver à la mont",
+		" agne",
+		"DTSTART;VALUE=DATE:20240210",
+		"DTEND;VALUE=DATE:20240212",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART;TZID=Europe/Paris:20240215T090000",
+		"DTEND;TZID=Europe/Paris:20240215T180000",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	type params struct {
+		query string
+		body  string
+	}
+	type want struct {
+		statusCode int
+		occupancy  []core.DailyOccupancy
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "marks the days of the events as vacation",
+			params: params{body: calendar},
+			want: want{statusCode: http.StatusOK, occupancy: []core.DailyOccupancy{
+				{Date: day(10), Status: core.OccupancyVacation},
+				{Date: day(11), Status: core.OccupancyVacation},
+				{Date: day(15), Status: core.OccupancyVacation},
+			}},
+		},
+		{
+			name:   "uses the requested status",
+			params: params{query: "?status=away", body: "BEGIN:VEVENT\nDTSTART:20240203T080000Z\nEND:VEVENT\n"},
+			want:   want{statusCode: http.StatusOK, occupancy: []core.DailyOccupancy{{Date: day(3), Status: core.OccupancyAway}}},
+		},
+		{
+			name:   "rejects an unknown status",
+			params: params{query: "?status=abroad", body: calendar},
+			want:   want{statusCode: http.StatusBadRequest},
+		},
+		{
+			name:   "rejects an event without start",
+			params: params{body: "BEGIN:VEVENT\nDTEND;VALUE=DATE:20240212\nEND:VEVENT\n"},
+			want:   want{statusCode: http.StatusBadRequest},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{}
+			server := NewServer(store, Config{})
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/occupation/ics"+tc.params.query, strings.NewReader(tc.params.body)))
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.occupancy, store.data.Occupancy, tc.name)
+		})
+	}
+}
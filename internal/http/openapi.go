@@ -0,0 +1,82 @@
+package http
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"pellets-tracker/internal/version"
+)
+
+// openAPISpec describes the routes of the API. TestOpenAPISpec checks it
+// against the routes registered and the payloads they decode.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// openAPIDocument is openAPISpec carrying the version of the build.
+var openAPIDocument = sync.OnceValues(func() ([]byte, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		return nil, fmt.Errorf("decode openapi spec: %w", err)
+	}
+	info, ok := doc["info"].(map[string]any)
+	if !ok {
+		return nil, errors.New("openapi spec without info")
+	}
+	info["version"] = version.Version
+	return json.Marshal(doc)
+})
+
+// swaggerUIPage loads Swagger UI from a CDN, the document itself being served
+// by the application.
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="fr">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>API · Suivi des granulés</title>
+  <link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <noscript><p>La documentation interactive demande JavaScript : le document brut est servi sur <a href="/api/openapi.json">/api/openapi.json</a>.</p></noscript>
+  <div id="swagger-ui"></div>
+  <script src="https://cdn.jsdelivr.net/npm/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: "/api/openapi.json", dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	doc, err := openAPIDocument()
+	if err != nil {
+		log.Printf("openapi: %v", err)
+		s.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(doc); err != nil {
+		log.Printf("write openapi: %v", err)
+	}
+}
+
+func (s *Server) handleAPIDocs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := w.Write([]byte(swaggerUIPage)); err != nil {
+		log.Printf("write api docs: %v", err)
+	}
+}
@@ -0,0 +1,392 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"pellets-tracker/internal/auth"
+	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/jobs"
+)
+
+// openAPIDoc is the part of the OpenAPI document the tests check.
+type openAPIDoc struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadOpenAPIDoc(t *testing.T) openAPIDoc {
+	t.Helper()
+	var doc openAPIDoc
+	require.NoError(t, json.Unmarshal(openAPISpec, &doc))
+	return doc
+}
+
+func TestServer_handleOpenAPI(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		method string
+		path   string
+	}
+	type want struct {
+		statusCode   int
+		contentType  string
+		bodyContains []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "serves the document",
+			params: params{method: http.MethodGet, path: "/api/openapi.json"},
+			want:   want{statusCode: http.StatusOK, contentType: "application/json", bodyContains: []string{`"openapi":"3.0.3"`, `"version":"dev"`, `"/api/marques/{id}"`}},
+		},
+		{
+			name:   "serves Swagger UI",
+			params: params{method: http.MethodGet, path: "/api/docs"},
+			want:   want{statusCode: http.StatusOK, contentType: "text/html; charset=utf-8", bodyContains: []string{`url: "/api/openapi.json"`, "swagger-ui-bundle.js"}},
+		},
+		{
+			name:   "is read-only",
+			params: params{method: http.MethodPost, path: "/api/openapi.json"},
+			want:   want{statusCode: http.StatusMethodNotAllowed, contentType: "application/json"},
+		},
+	}
+
+	server := NewServer(&stubDataStore{}, Config{})
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(tc.params.method, tc.params.path, nil)
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.contentType, rec.Header().Get("Content-Type"), tc.name)
+			for _, fragment := range tc.want.bodyContains {
+				assert.Contains(t, rec.Body.String(), fragment, tc.name)
+			}
+		})
+	}
+}
+
+// TestOpenAPISpec_routes checks that every route registered under /api is
+// documented, and that every operation documented is served.
+func TestOpenAPISpec_routes(t *testing.T) {
+	t.Parallel()
+
+	doc := loadOpenAPIDoc(t)
+	documented := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		documented = append(documented, path)
+	}
+	sort.Strings(documented)
+
+	sources, err := filepath.Glob("*.go")
+	require.NoError(t, err)
+	registration := regexp.MustCompile(`HandleFunc\("(/api[^"]*)"`)
+	var registered []string
+	for _, source := range sources {
+		if strings.HasSuffix(source, "_test.go") {
+			continue
+		}
+		content, err := os.ReadFile(source)
+		require.NoError(t, err)
+		for _, match := range registration.FindAllStringSubmatch(string(content), -1) {
+			registered = append(registered, match[1])
+		}
+	}
+	require.NotEmpty(t, registered)
+
+	type params struct {
+		// pattern is a route registered, checked when method is empty;
+		// otherwise path and method are a documented operation.
+		pattern string
+		path    string
+		method  string
+	}
+	type want struct {
+		served bool
+	}
+
+	var tcs []struct {
+		name   string
+		params params
+		want   want
+	}
+	for _, pattern := range registered {
+		tcs = append(tcs, struct {
+			name   string
+			params params
+			want   want
+		}{name: "documents " + pattern, params: params{pattern: pattern}, want: want{served: true}})
+	}
+	for _, path := range documented {
+		for method := range doc.Paths[path] {
+			if method == "parameters" {
+				continue
+			}
+			tcs = append(tcs, struct {
+				name   string
+				params params
+				want   want
+			}{name: "serves " + strings.ToUpper(method) + " " + path, params: params{path: path, method: strings.ToUpper(method)}, want: want{served: true}})
+		}
+	}
+
+	manager, err := auth.New(auth.Config{BcryptCost: bcrypt.MinCost})
+	require.NoError(t, err)
+	// Every entity is named "id" so the documented paths resolve with
+	// their parameters replaced by their names.
+	newData := func() core.DataStore {
+		photo := core.Photo{ID: "photo", ImageBase64: "aW1n"}
+		return core.DataStore{
+			Brands:           []core.Brand{{Meta: core.Meta{ID: "id"}, Name: "Woodstock", Gallery: []core.Photo{photo}}},
+			Purchases:        []core.Purchase{{Meta: core.Meta{ID: "id"}, BrandID: "id", Bags: 10, BagWeightKg: 15, Photos: []core.Photo{photo}}},
+			Consumptions:     []core.Consumption{{Meta: core.Meta{ID: "id"}, BrandID: "id", Bags: 1}},
+			Users:            []core.User{{Meta: core.Meta{ID: "id"}, Username: "alice"}},
+			APITokens:        []core.APIToken{{Meta: core.Meta{ID: "id"}, UserID: "id", Name: "Téléphone"}},
+			Silos:            []core.Silo{{Meta: core.Meta{ID: "id"}, Name: "Silo", CapacityKg: 3000}},
+			StorageLocations: []core.StorageLocation{{Meta: core.Meta{ID: "id"}, Name: "Garage"}},
+		}
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.params.method == "" {
+				served := false
+				for _, path := range documented {
+					if path == tc.params.pattern || (strings.HasSuffix(tc.params.pattern, "/") && strings.HasPrefix(path, tc.params.pattern)) {
+						served = true
+					}
+				}
+				assert.Equal(t, tc.want.served, served, tc.name)
+				return
+			}
+
+			server := NewServer(&stubDataStore{data: newData()}, Config{Auth: manager, AdminToken: "secret", Receipts: stubReceiptReader{}})
+			path := strings.NewReplacer("{id}", "id", "{photo}", "photo").Replace(tc.params.path)
+			req := httptest.NewRequest(tc.params.method, path, nil)
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			routeMissing := rec.Code == http.StatusNotFound && strings.Contains(rec.Body.String(), `"error":"not found"`)
+			served := !routeMissing && rec.Code != http.StatusMethodNotAllowed
+			assert.Equal(t, tc.want.served, served, "%s: %d %s", tc.name, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+// TestOpenAPISpec_queryParameters checks that the query parameters documented
+// are read by a handler under that name.
+func TestOpenAPISpec_queryParameters(t *testing.T) {
+	t.Parallel()
+
+	var doc struct {
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Parameters map[string]openAPIParameter `json:"parameters"`
+		} `json:"components"`
+	}
+	require.NoError(t, json.Unmarshal(openAPISpec, &doc))
+
+	sources, err := filepath.Glob("*.go")
+	require.NoError(t, err)
+	read := regexp.MustCompile(`(?:Get|FormValue)\("([a-z_]+)"\)`)
+	names := map[string]bool{}
+	for _, source := range sources {
+		if strings.HasSuffix(source, "_test.go") {
+			continue
+		}
+		content, err := os.ReadFile(source)
+		require.NoError(t, err)
+		for _, match := range read.FindAllStringSubmatch(string(content), -1) {
+			names[match[1]] = true
+		}
+	}
+
+	type params struct {
+		parameter string
+	}
+	type want struct {
+		read bool
+	}
+
+	var tcs []struct {
+		name   string
+		params params
+		want   want
+	}
+	for path, item := range doc.Paths {
+		for method, raw := range item {
+			var parameters []openAPIParameter
+			if method == "parameters" {
+				require.NoError(t, json.Unmarshal(raw, &parameters))
+			} else {
+				var operation struct {
+					Parameters []openAPIParameter `json:"parameters"`
+				}
+				require.NoError(t, json.Unmarshal(raw, &operation))
+				parameters = operation.Parameters
+			}
+			for _, parameter := range parameters {
+				if parameter.Ref != "" {
+					parameter = doc.Components.Parameters[strings.TrimPrefix(parameter.Ref, "#/components/parameters/")]
+				}
+				if parameter.In != "query" {
+					continue
+				}
+				tcs = append(tcs, struct {
+					name   string
+					params params
+					want   want
+				}{name: strings.ToUpper(method) + " " + path + " ?" + parameter.Name, params: params{parameter: parameter.Name}, want: want{read: true}})
+			}
+		}
+	}
+	require.NotEmpty(t, tcs)
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.want.read, names[tc.params.parameter], tc.name)
+		})
+	}
+}
+
+// openAPIParameter is a parameter of an operation, or a reference to one.
+type openAPIParameter struct {
+	Ref  string `json:"$ref"`
+	Name string `json:"name"`
+	In   string `json:"in"`
+}
+
+// TestOpenAPISpec_schemas checks that the schemas document the JSON fields of
+// the types the handlers encode and decode.
+func TestOpenAPISpec_schemas(t *testing.T) {
+	t.Parallel()
+
+	doc := loadOpenAPIDoc(t)
+
+	type params struct {
+		schema string
+		value  any
+	}
+	type want struct {
+		// extra lists the properties written by a MarshalJSON method.
+		extra []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "brand", params: params{schema: "Brand", value: core.Brand{}}},
+		{name: "brand creation", params: params{schema: "BrandCreate", value: brandPayload{}}},
+		{name: "brand replacement", params: params{schema: "BrandReplace", value: brandReplacePayload{}}},
+		{name: "brand patch", params: params{schema: "BrandPatch", value: brandUpdatePayload{}}},
+		{name: "purchase", params: params{schema: "Purchase", value: core.Purchase{}}, want: want{extra: []string{"weight_kg"}}},
+		{name: "purchase input", params: params{schema: "PurchaseInput", value: purchasePayload{}}},
+		{name: "consumption", params: params{schema: "Consumption", value: core.Consumption{}}},
+		{name: "consumption input", params: params{schema: "ConsumptionInput", value: consumptionPayload{}}},
+		{name: "photo", params: params{schema: "Photo", value: core.Photo{}}},
+		{name: "photo view", params: params{schema: "PhotoView", value: photoView{}}},
+		{name: "transfer", params: params{schema: "Transfer", value: core.Transfer{}}},
+		{name: "transfer input", params: params{schema: "TransferInput", value: transferPayload{}}},
+		{name: "alerts input", params: params{schema: "AlertsInput", value: alertsPayload{}}},
+		{name: "storage location input", params: params{schema: "StorageLocationInput", value: storageLocationPayload{}}},
+		{name: "silo input", params: params{schema: "SiloInput", value: siloPayload{}}},
+		{name: "silo level input", params: params{schema: "SiloLevelInput", value: siloLevelPayload{}}},
+		{name: "temperature input", params: params{schema: "TemperatureInput", value: temperaturePayload{}}},
+		{name: "occupancy input", params: params{schema: "OccupancyInput", value: occupancyPayload{}}},
+		{name: "market price", params: params{schema: "MarketPrice", value: core.MarketPrice{}}},
+		{name: "market price input", params: params{schema: "MarketPriceInput", value: marketPricePayload{}}},
+		{name: "job status", params: params{schema: "JobStatus", value: jobs.Status{}}},
+		{name: "job run", params: params{schema: "JobRun", value: jobs.Run{}}},
+		{name: "batch", params: params{schema: "BatchRequest", value: batchRequest{}}},
+		{name: "credentials", params: params{schema: "Credentials", value: credentialsPayload{}}},
+		{name: "password", params: params{schema: "PasswordInput", value: passwordPayload{}}},
+		{name: "session", params: params{schema: "Session", value: sessionResponse{}}},
+		{name: "user", params: params{schema: "UserInput", value: userPayload{}}},
+		{name: "role", params: params{schema: "RoleInput", value: rolePayload{}}},
+		{name: "API token input", params: params{schema: "APITokenInput", value: apiTokenPayload{}}},
+		{name: "forced brand deletion", params: params{schema: "ForceDeleteInput", value: forceDeleteBrandPayload{}}},
+		{name: "settings", params: params{schema: "Settings", value: core.Settings{}}},
+		{name: "brand settings", params: params{schema: "BrandSettings", value: core.BrandSettings{}}},
+		{name: "storage location settings", params: params{schema: "StorageLocationSettings", value: core.StorageLocationSettings{}}},
+		{name: "silo settings", params: params{schema: "SiloSettings", value: core.SiloSettings{}}},
+		{name: "settings import result", params: params{schema: "SettingsImportResult", value: settingsImportResponse{}}},
+		{name: "brand move input", params: params{schema: "BrandMoveInput", value: brandMovePayload{}}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			schema, ok := doc.Components.Schemas[tc.params.schema]
+			require.True(t, ok, tc.name)
+			var documented []string
+			for property := range schema.Properties {
+				documented = append(documented, property)
+			}
+			sort.Strings(documented)
+
+			fields := append(jsonFields(reflect.TypeOf(tc.params.value)), tc.want.extra...)
+			sort.Strings(fields)
+			assert.Equal(t, fields, documented, tc.name)
+		})
+	}
+}
+
+// jsonFields lists the properties encoding/json reads and writes for typ.
+func jsonFields(typ reflect.Type) []string {
+	var fields []string
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && name == "" {
+			fields = append(fields, jsonFields(field.Type)...)
+			continue
+		}
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, name)
+	}
+	return fields
+}
@@ -0,0 +1,138 @@
+package http
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/pdf"
+)
+
+var forecastBasisLabels = map[string]string{
+	core.ForecastPreviousSeason: "même période la saison dernière",
+	core.ForecastRecentRate:     "rythme des 30 derniers jours",
+	core.ForecastNone:           "aucune consommation enregistrée",
+	core.ForecastMonthlyAverage: "moyenne de chaque mois",
+	core.ForecastDegreeDays:     "degrés-jours de chaque mois",
+}
+
+// handleOrderPlanPDF serves the one-page order plan used to prepare the next
+// order with the supplier.
+func (s *Server) handleOrderPlanPDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	ds := s.store.Data()
+	now := time.Now().UTC()
+	ctx, cancel := s.computeContext(r)
+	defer cancel()
+	plan, err := core.ComputePlanDeCommande(ctx, &ds, now)
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="plan-de-commande-%s.pdf"`, now.Format("2006-01-02")))
+	w.WriteHeader(http.StatusOK)
+	if _, err := renderOrderPlan(plan).WriteTo(w); err != nil {
+		log.Printf("write order plan: %v", err)
+	}
+}
+
+func renderOrderPlan(plan core.OrderPlan) *pdf.Document {
+	const left = 50.0
+	doc := pdf.New("Plan de commande")
+
+	y := 780.0
+	doc.Text(left, y, 20, pdf.Bold, "Plan de commande de granulés")
+	y -= 18
+	doc.Text(left, y, 10, pdf.Regular, fmt.Sprintf("Établi le %s · prévision jusqu'à la fin de la saison de chauffe (%s)", plan.GeneratedAt.Format("02/01/2006"), plan.SeasonEnd.Format("02/01/2006")))
+
+	y -= 22
+	doc.FillRect(left, y-78, pdf.PageWidth-2*left, 88, 0.93)
+	y -= 8
+	doc.Text(left+10, y, 11, pdf.Regular, fmt.Sprintf("Stock actuel : %d sacs", plan.StockBags))
+	y -= 18
+	doc.Text(left+10, y, 11, pdf.Regular, fmt.Sprintf("Consommation prévue d'ici la fin de saison : %d sacs (%s)", plan.ForecastBags, forecastBasisLabels[plan.ForecastBasis]))
+	y -= 18
+	stockout := "le stock couvre toute la saison"
+	if !plan.StockoutAt.IsZero() {
+		stockout = plan.StockoutAt.Format("02/01/2006")
+	}
+	doc.Text(left+10, y, 11, pdf.Regular, "Rupture estimée : "+stockout)
+	y -= 22
+	doc.Text(left+10, y, 13, pdf.Bold, fmt.Sprintf("Quantité recommandée : %d sacs", plan.RecommendedBags))
+
+	y -= 40
+	doc.Text(left, y, 13, pdf.Bold, "Conditions par marque")
+	y -= 20
+	columns := []struct {
+		title string
+		x     float64
+	}{
+		{"Marque", left},
+		{"Prix actuel", 175},
+		{"Dernier achat", 245},
+		{"Délai", 320},
+		{"Stock", 365},
+		{"Commander avant", 410},
+		{"Coût estimé", 490},
+	}
+	for _, column := range columns {
+		doc.Text(column.x, y, 9, pdf.Bold, column.title)
+	}
+	y -= 6
+	doc.Line(left, y, pdf.PageWidth-left, y, 0.5)
+	if len(plan.Brands) == 0 {
+		y -= 14
+		doc.Text(left, y, 9, pdf.Regular, "Aucun achat enregistré : les prix et délais apparaîtront après le premier achat.")
+	}
+	today := plan.GeneratedAt.Truncate(24 * time.Hour)
+	for _, brand := range plan.Brands {
+		y -= 16
+		if y < 90 {
+			break
+		}
+		leadTime := "–"
+		if brand.LeadTimeDays > 0 {
+			leadTime = fmt.Sprintf("%d j", brand.LeadTimeDays)
+		}
+		orderBy := "–"
+		switch {
+		case brand.OrderBy.IsZero():
+		case !brand.OrderBy.After(today):
+			orderBy = "dès maintenant"
+		default:
+			orderBy = brand.OrderBy.Format("02/01/2006")
+		}
+		values := []string{
+			truncate(brand.BrandName, 24),
+			core.FormatMoney(brand.UnitPrice),
+			brand.LastPurchasedAt.Format("02/01/2006"),
+			leadTime,
+			fmt.Sprintf("%d", brand.StockBags),
+			orderBy,
+			core.FormatMoney(brand.EstimatedCost),
+		}
+		for i, value := range values {
+			doc.Text(columns[i].x, y, 9, pdf.Regular, value)
+		}
+	}
+
+	doc.Line(left, 70, pdf.PageWidth-left, 70, 0.5)
+	doc.Text(left, 56, 8, pdf.Regular, "Prévision indicative : prix du dernier achat de chaque marque, délai de livraison renseigné sur la fiche marque.")
+	return doc
+}
+
+func truncate(text string, limit int) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:limit-1]) + "…"
+}
@@ -0,0 +1,88 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_handleOrderPlanPDF(t *testing.T) {
+	t.Parallel()
+
+	brandID := core.NewID()
+	data := core.DataStore{
+		Brands: []core.Brand{{
+			Meta:         core.Meta{ID: brandID, CreatedAt: time.Now(), UpdatedAt: time.Now()},
+			Name:         "Granules (premium)",
+			LeadTimeDays: 10,
+		}},
+		Purchases: []core.Purchase{{
+			Meta:           core.Meta{ID: core.NewID(), CreatedAt: time.Now(), UpdatedAt: time.Now()},
+			BrandID:        brandID,
+			PurchasedAt:    time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC),
+			Bags:           5,
+			BagWeightKg:    15,
+			TotalWeightKg:  75,
+			UnitPriceCents: 549,
+		}},
+	}
+
+	type params struct {
+		method string
+	}
+	type want struct {
+		statusCode   int
+		contentType  string
+		bodyContains []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "renders the order plan",
+			params: params{method: http.MethodGet},
+			want: want{
+				statusCode:   http.StatusOK,
+				contentType:  "application/pdf",
+				bodyContains: []string{"%PDF-1.4", "Quantit\xe9 recommand\xe9e", `(Granules \(premium\))`, "(5,49 \x80)", "(10 j)"},
+			},
+		},
+		{
+			name:   "rejects other methods",
+			params: params{method: http.MethodPost},
+			want:   want{statusCode: http.StatusMethodNotAllowed},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{data: data}, Config{})
+			req := httptest.NewRequest(tc.params.method, "/stats/plan-de-commande.pdf", nil)
+			rec := httptest.NewRecorder()
+
+			server.handleOrderPlanPDF(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			if tc.want.contentType != "" {
+				assert.Equal(t, tc.want.contentType, rec.Header().Get("Content-Type"), tc.name)
+				assert.True(t, strings.HasPrefix(rec.Header().Get("Content-Disposition"), "attachment;"), tc.name)
+			}
+			body := rec.Body.String()
+			for _, fragment := range tc.want.bodyContains {
+				assert.Contains(t, body, fragment, tc.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// pageSizes are the page sizes offered on the HTML tables.
+var pageSizes = []int{25, 50, 100, 200}
+
+// pageQuery is the page of a list requested with the page query parameter,
+// counted from 1, holding per_page entries.
+type pageQuery struct {
+	Page    int
+	PerPage int
+}
+
+// parsePageQuery reads the page and per_page query parameters, defaulting to
+// the first page of defaultPageSize entries.
+func parsePageQuery(r *http.Request) (pageQuery, error) {
+	query := r.URL.Query()
+	page := pageQuery{Page: 1, PerPage: defaultPageSize}
+	if value := query.Get("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return pageQuery{}, fmt.Errorf("invalid page %q, must be a number from 1", value)
+		}
+		page.Page = parsed
+	}
+	if value := query.Get("per_page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			return pageQuery{}, fmt.Errorf("invalid per_page %q, must be between 1 and %d", value, maxPageSize)
+		}
+		page.PerPage = parsed
+	}
+	return page, nil
+}
+
+// paged reports whether the request asks for a page; the JSON API lists
+// every entry otherwise.
+func paged(r *http.Request) bool {
+	query := r.URL.Query()
+	return query.Has("page") || query.Has("per_page")
+}
+
+// bounds returns the indexes of the entries of the page in a list of total
+// entries. Pages past the end are empty, without multiplying the page by its
+// size, which would overflow on large pages.
+func (q pageQuery) bounds(total int) (int, int) {
+	start := total
+	if q.Page-1 <= total/q.PerPage {
+		start = min((q.Page-1)*q.PerPage, total)
+	}
+	return start, min(start+q.PerPage, total)
+}
+
+// pageOf returns the entries of the requested page.
+func pageOf[T any](items []T, q pageQuery) []T {
+	start, end := q.bounds(len(items))
+	return items[start:end]
+}
+
+// pagesThrough returns the entries of every page up to the requested one,
+// the HTML tables showing them all when loaded without JavaScript.
+func pagesThrough[T any](items []T, q pageQuery) []T {
+	_, end := q.bounds(len(items))
+	return items[:end]
+}
+
+// pageInfo describes the page shown out of a list, to link the next one.
+type pageInfo struct {
+	pageQuery
+	Total int
+}
+
+// HasNext reports whether entries are left after the page.
+func (p pageInfo) HasNext() bool {
+	_, end := p.bounds(p.Total)
+	return end < p.Total
+}
+
+// NextURL links the next page at path.
+func (p pageInfo) NextURL(path string) string {
+	return fmt.Sprintf("%s?page=%d&per_page=%d", path, p.Page+1, p.PerPage)
+}
+
+// PageSizes lists the page sizes offered, with the current one.
+func (p pageInfo) PageSizes() []int {
+	for _, size := range pageSizes {
+		if size == p.PerPage {
+			return pageSizes
+		}
+	}
+	return append(append([]int(nil), pageSizes...), p.PerPage)
+}
+
+// writePageHeaders sets X-Total-Count and a Link to the next page, as GitHub
+// does, on a page of the JSON API.
+func writePageHeaders(w http.ResponseWriter, r *http.Request, page pageInfo) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	if page.HasNext() {
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, page.NextURL(r.URL.Path)))
+	}
+}
@@ -0,0 +1,182 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestParsePageQuery(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		query string
+	}
+	type want struct {
+		page      pageQuery
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "first page by default", want: want{page: pageQuery{Page: 1, PerPage: defaultPageSize}}},
+		{name: "reads the page and its size", params: params{query: "page=3&per_page=20"}, want: want{page: pageQuery{Page: 3, PerPage: 20}}},
+		{name: "rejects page zero", params: params{query: "page=0"}, want: want{expectErr: true}},
+		{name: "rejects pages too large", params: params{query: "per_page=501"}, want: want{expectErr: true}},
+		{name: "rejects non numeric sizes", params: params{query: "per_page=all"}, want: want{expectErr: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			page, err := parsePageQuery(httptest.NewRequest(http.MethodGet, "/api/achats?"+tc.params.query, nil))
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.page, page, tc.name)
+		})
+	}
+}
+
+func TestServer_paginatedLists(t *testing.T) {
+	t.Parallel()
+
+	data := core.DataStore{Brands: []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}}}
+	for i := 0; i < 5; i++ {
+		day := time.Date(2024, time.January, 1+i, 0, 0, 0, 0, time.UTC)
+		data.Purchases = append(data.Purchases, core.Purchase{
+			Meta: core.Meta{ID: core.ID(fmt.Sprintf("p%d", i+1))}, BrandID: "brand-w", PurchasedAt: day,
+			Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 500, TotalPriceCents: 5000,
+		})
+		data.Consumptions = append(data.Consumptions, core.Consumption{
+			Meta: core.Meta{ID: core.ID(fmt.Sprintf("c%d", i+1))}, BrandID: "brand-w", ConsumedAt: day.Add(time.Hour), Bags: 1,
+		})
+	}
+
+	type params struct {
+		path string
+	}
+	type want struct {
+		statusCode  int
+		ids         []core.ID
+		total       string
+		link        string
+		contains    []string
+		notContains []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "lists every purchase without a page",
+			params: params{path: "/api/achats"},
+			want:   want{statusCode: http.StatusOK, ids: []core.ID{"p1", "p2", "p3", "p4", "p5"}},
+		},
+		{
+			name:   "answers a page of purchases",
+			params: params{path: "/api/achats?page=2&per_page=2"},
+			want:   want{statusCode: http.StatusOK, ids: []core.ID{"p3", "p4"}, total: "5", link: `</api/achats?page=3&per_page=2>; rel="next"`},
+		},
+		{
+			name:   "answers the last page of consumptions",
+			params: params{path: "/api/consommations?page=3&per_page=2"},
+			want:   want{statusCode: http.StatusOK, ids: []core.ID{"c5"}, total: "5"},
+		},
+		{
+			name:   "answers an empty page past the end",
+			params: params{path: "/api/achats?page=9223372036854775807&per_page=500"},
+			want:   want{statusCode: http.StatusOK, total: "5", contains: []string{"[]"}},
+		},
+		{
+			name:   "rejects an invalid page",
+			params: params{path: "/api/consommations?page=-1"},
+			want:   want{statusCode: http.StatusBadRequest},
+		},
+		{
+			name:   "shows the first page of consumptions",
+			params: params{path: "/consommations?per_page=2"},
+			want: want{
+				statusCode:  http.StatusOK,
+				contains:    []string{"/consommations/c5", "/consommations/c4", `hx-get="/consommations/lignes?page=2&amp;per_page=2"`, `<option value="2" selected>2</option>`},
+				notContains: []string{"/consommations/c3"},
+			},
+		},
+		{
+			name:   "shows the pages up to the requested one",
+			params: params{path: "/consommations?page=2&per_page=2"},
+			want:   want{statusCode: http.StatusOK, contains: []string{"/consommations/c5", "/consommations/c2", `href="/consommations?page=3&amp;per_page=2"`}},
+		},
+		{
+			name:   "loads the rows of the next page",
+			params: params{path: "/consommations/lignes?page=2&per_page=2"},
+			want: want{
+				statusCode:  http.StatusOK,
+				contains:    []string{"/consommations/c3", "/consommations/c2", "/consommations/lignes?page=3&amp;per_page=2"},
+				notContains: []string{"/consommations/c4", "<html"},
+			},
+		},
+		{
+			name:   "loads the last rows of purchases",
+			params: params{path: "/achats/lignes?page=3&per_page=2"},
+			want:   want{statusCode: http.StatusOK, contains: []string{"/achats/p1"}, notContains: []string{"/achats/p2", "load-more"}},
+		},
+		{
+			name:   "loads no rows past the end",
+			params: params{path: "/consommations/lignes?page=9223372036854775807&per_page=500"},
+			want:   want{statusCode: http.StatusOK, notContains: []string{"/consommations/c", "load-more"}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{data: data}, Config{})
+			req := httptest.NewRequest(http.MethodGet, tc.params.path, nil)
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.total, rec.Header().Get("X-Total-Count"), tc.name)
+			assert.Equal(t, tc.want.link, rec.Header().Get("Link"), tc.name)
+			if tc.want.ids != nil {
+				var entries []struct {
+					ID core.ID `json:"id"`
+				}
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries), tc.name)
+				var ids []core.ID
+				for _, entry := range entries {
+					ids = append(ids, entry.ID)
+				}
+				assert.Equal(t, tc.want.ids, ids, tc.name)
+			}
+			body := rec.Body.String()
+			for _, fragment := range tc.want.contains {
+				assert.Contains(t, body, fragment, tc.name)
+			}
+			for _, fragment := range tc.want.notContains {
+				assert.NotContains(t, body, fragment, tc.name)
+			}
+		})
+	}
+}
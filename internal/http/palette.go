@@ -0,0 +1,67 @@
+package http
+
+import (
+	"net/http"
+
+	"pellets-tracker/internal/core"
+)
+
+// paletteAction is an entry of the command palette opened with Ctrl+K.
+type paletteAction struct {
+	ID       string   `json:"id"`
+	Label    string   `json:"label"`
+	URL      string   `json:"url"`
+	Shortcut string   `json:"shortcut,omitempty"`
+	Keywords []string `json:"keywords,omitempty"`
+}
+
+var paletteActions = []paletteAction{
+	{ID: "new-consumption", Label: "Nouvelle consommation", URL: "/consommations#nouvelle-consommation", Shortcut: "n", Keywords: []string{"brûler", "poêle", "sac"}},
+	{ID: "new-purchase", Label: "Nouvel achat", URL: "/#nouvel-achat", Shortcut: "a", Keywords: []string{"acheter", "livraison", "prix"}},
+	{ID: "stats", Label: "Statistiques", URL: "/stats", Shortcut: "s", Keywords: []string{"fifo", "inventaire", "graphique"}},
+	{ID: "silos", Label: "Silos", URL: "/silos", Keywords: []string{"vrac", "niveau", "capteur"}},
+	{ID: "seasons", Label: "Saisons", URL: "/saisons", Keywords: []string{"archives", "historique", "imprimer"}},
+	{ID: "calendar", Label: "Calendrier", URL: "/calendrier", Keywords: []string{"jour", "mois", "consommation"}},
+	{ID: "new-brand", Label: "Nouvelle marque", URL: "/marques#nouvelle-marque", Keywords: []string{"fabricant"}},
+	{ID: "purchases", Label: "Achats", URL: "/", Keywords: []string{"accueil", "historique"}},
+	{ID: "consumptions", Label: "Consommations", URL: "/consommations", Keywords: []string{"historique"}},
+	{ID: "export-json", Label: "Exporter en JSON", URL: "/api/export/json", Keywords: []string{"sauvegarde", "télécharger"}},
+	{ID: "import-json", Label: "Importer un export JSON", URL: "/donnees", Keywords: []string{"restaurer", "sauvegarde", "données"}},
+	{ID: "export-csv", Label: "Exporter en CSV", URL: "/api/export/csv", Keywords: []string{"tableur", "télécharger"}},
+	{ID: "export-brands-comparison", Label: "Comparatif des marques (CSV)", URL: "/api/export/brands-comparison", Keywords: []string{"tableur", "prix", "commande"}},
+}
+
+// handleActionsAPI lists the command palette actions.
+func (s *Server) handleActionsAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, s.actions())
+}
+
+// handleActionsPage lists the palette actions as links, the page the
+// palette falls back to without JavaScript.
+func (s *Server) handleActionsPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	s.renderPage(w, http.StatusOK, "actions", "Actions", "", s.actions(), nil)
+}
+
+// actions returns the palette actions. Brands, archived ones aside, are
+// appended so typing a brand name jumps to the brands page.
+func (s *Server) actions() []paletteAction {
+	ds := s.store.Data()
+	actions := make([]paletteAction, 0, len(paletteActions)+len(ds.Brands))
+	actions = append(actions, paletteActions...)
+	for _, brand := range core.ActiveBrands(ds.Brands) {
+		action := paletteAction{ID: "brand-" + string(brand.ID), Label: "Marque : " + brand.Name, URL: "/marques"}
+		if brand.Description != "" {
+			action.Keywords = []string{brand.Description}
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
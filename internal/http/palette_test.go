@@ -0,0 +1,71 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_handleActionsAPI(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		method string
+		brands []core.Brand
+	}
+	type want struct {
+		statusCode int
+		count      int
+		lastLabel  string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "lists static actions",
+			params: params{method: http.MethodGet},
+			want:   want{statusCode: http.StatusOK, count: len(paletteActions), lastLabel: "Comparatif des marques (CSV)"},
+		},
+		{
+			name:   "appends brands",
+			params: params{method: http.MethodGet, brands: []core.Brand{{Meta: core.Meta{ID: core.NewID()}, Name: "Granules"}}},
+			want:   want{statusCode: http.StatusOK, count: len(paletteActions) + 1, lastLabel: "Marque : Granules"},
+		},
+		{
+			name:   "rejects other methods",
+			params: params{method: http.MethodPost},
+			want:   want{statusCode: http.StatusMethodNotAllowed},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{data: core.DataStore{Brands: tc.params.brands}}, Config{})
+			req := httptest.NewRequest(tc.params.method, "/api/actions", nil)
+			rec := httptest.NewRecorder()
+
+			server.handleActionsAPI(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			if tc.want.statusCode != http.StatusOK {
+				return
+			}
+			var actions []paletteAction
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &actions), tc.name)
+			assert.Len(t, actions, tc.want.count, tc.name)
+			assert.Equal(t, tc.want.lastLabel, actions[len(actions)-1].Label, tc.name)
+		})
+	}
+}
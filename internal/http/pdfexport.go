@@ -0,0 +1,351 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/pdf"
+)
+
+// maxChartMonths bounds the monthly chart of the statistics report, the
+// most recent months being kept.
+const maxChartMonths = 24
+
+// statsReport holds the figures of the statistics page printed by
+// renderStatsReport.
+type statsReport struct {
+	From, To    time.Time
+	Costing     core.CostingMethod
+	Invested    core.Money
+	Consumed    core.Money
+	AverageBag  core.Money
+	Monthly     []core.MonthlyBags
+	Inventory   core.InventorySummary
+	GeneratedAt time.Time
+}
+
+// pdfColumn is a column of a table drawn by drawPDFTable.
+type pdfColumn struct {
+	title string
+	x     float64
+}
+
+// exportPDF serves GET /api/export/pdf: the statistics page, over the from
+// and to range, or with report=season the report of the season starting in
+// year, as a one-page printable document.
+func (s *Server) exportPDF(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	now := time.Now().UTC()
+	var doc *pdf.Document
+	var filename string
+	switch query.Get("report") {
+	case "", "stats":
+		from, to, err := parseRangeQuery(r)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid range: %w", err))
+			return
+		}
+		method, err := s.costingMethod(r)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		ds := s.store.Data()
+		ctx, cancel := s.computeContext(r)
+		defer cancel()
+		report, err := computeStatsReport(ctx, &ds, method, from, to)
+		if err != nil {
+			s.handleCoreError(w, err)
+			return
+		}
+		report.GeneratedAt = now
+		doc = renderStatsReport(report)
+		filename = "pellets-stats-" + now.Format("2006-01-02") + ".pdf"
+	case "season":
+		year, err := parseSeasonYear(query.Get("year"))
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		ds := s.store.Data()
+		ctx, cancel := s.computeContext(r)
+		defer cancel()
+		report, err := core.ComputeRapportSaison(ctx, &ds, year)
+		if err != nil {
+			s.handleCoreError(w, err)
+			return
+		}
+		doc = renderSeasonReport(report, now)
+		filename = "pellets-saison-" + report.Label + ".pdf"
+	default:
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("unknown report %q, use stats or season", query.Get("report")))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.WriteHeader(http.StatusOK)
+	if _, err := doc.WriteTo(w); err != nil {
+		log.Printf("write pdf report: %v", err)
+	}
+}
+
+func computeStatsReport(ctx context.Context, ds *core.DataStore, method core.CostingMethod, from, to time.Time) (statsReport, error) {
+	report := statsReport{From: from, To: to, Costing: method, Invested: core.ComputeInvesti(ds, from, to)}
+	var err error
+	if report.Consumed, _, err = core.ComputeConsoValue(ctx, ds, method, from, to); err != nil {
+		return statsReport{}, err
+	}
+	if report.AverageBag, err = core.ComputeCoutMoyenParSac(ctx, ds, method, from, to); err != nil {
+		return statsReport{}, err
+	}
+	if report.Monthly, err = core.ComputeSacsParMois(ctx, ds, from, to); err != nil {
+		return statsReport{}, err
+	}
+	if report.Inventory, err = core.ComputeInventaireAu(ctx, ds, method, to); err != nil {
+		return statsReport{}, err
+	}
+	return report, nil
+}
+
+// parseSeasonYear reads the start year of a season, such as 2024.
+func parseSeasonYear(value string) (int, error) {
+	year, err := strconv.Atoi(value)
+	if err != nil || year < 1000 || year > 9999 {
+		return 0, errors.New("year must be the start year of a season, such as 2024")
+	}
+	return year, nil
+}
+
+func renderStatsReport(report statsReport) *pdf.Document {
+	const left = 50.0
+	doc := pdf.New("Statistiques")
+
+	y := 780.0
+	doc.Text(left, y, 20, pdf.Bold, "Statistiques de chauffage")
+	y -= 18
+	period := "toute la période"
+	switch {
+	case !report.From.IsZero() && !report.To.IsZero():
+		period = fmt.Sprintf("du %s au %s", report.From.Format("02/01/2006"), report.To.Format("02/01/2006"))
+	case !report.From.IsZero():
+		period = "depuis le " + report.From.Format("02/01/2006")
+	case !report.To.IsZero():
+		period = "jusqu'au " + report.To.Format("02/01/2006")
+	}
+	doc.Text(left, y, 10, pdf.Regular, fmt.Sprintf("Établi le %s · %s · valorisation %s", report.GeneratedAt.Format("02/01/2006"), period, costingLabel(report.Costing)))
+
+	y -= 22
+	doc.FillRect(left, y-60, pdf.PageWidth-2*left, 70, 0.93)
+	y -= 8
+	doc.Text(left+10, y, 11, pdf.Regular, "Investi : "+core.FormatMoney(report.Invested))
+	doc.Text(300, y, 11, pdf.Regular, "Consommé : "+core.FormatMoney(report.Consumed))
+	y -= 18
+	doc.Text(left+10, y, 11, pdf.Regular, "Coût moyen par sac : "+core.FormatMoney(report.AverageBag))
+	doc.Text(300, y, 11, pdf.Regular, "Stock : "+plural(report.Inventory.TotalBags, "sac", "sacs"))
+	y -= 18
+	doc.Text(left+10, y, 11, pdf.Regular, "Valeur du stock : "+core.FormatMoney(report.Inventory.TotalCost))
+
+	y -= 40
+	doc.Text(left, y, 13, pdf.Bold, "Sacs brûlés par mois")
+	monthly := report.Monthly
+	if len(monthly) > maxChartMonths {
+		monthly = monthly[len(monthly)-maxChartMonths:]
+	}
+	bars := make([]core.SeasonMonth, 0, len(monthly))
+	for _, month := range monthly {
+		bars = append(bars, core.SeasonMonth{Month: month.Month, Bags: month.Bags})
+	}
+	y = drawMonthlyChart(doc, left, y-12, pdf.PageWidth-2*left, 150, bars)
+
+	y -= 30
+	doc.Text(left, y, 13, pdf.Bold, "Stock par marque")
+	columns := []pdfColumn{{"Marque", left}, {"Sacs", 260}, {"Poids", 330}, {"Valeur", 430}}
+	rows := make([][]string, 0, len(report.Inventory.Brands)+1)
+	for _, brand := range report.Inventory.Brands {
+		rows = append(rows, []string{
+			truncate(brand.BrandName, 36),
+			strconv.Itoa(brand.Bags),
+			core.FormatWeight(brand.WeightKg, defaultWeightDecimals) + " kg",
+			core.FormatMoney(brand.TotalCost),
+		})
+	}
+	if len(rows) > 0 {
+		rows = append(rows, []string{
+			"Total",
+			strconv.Itoa(report.Inventory.TotalBags),
+			core.FormatWeight(report.Inventory.TotalWeightKg, defaultWeightDecimals) + " kg",
+			core.FormatMoney(report.Inventory.TotalCost),
+		})
+	}
+	drawPDFTable(doc, y-20, columns, rows, "Aucun sac en stock.")
+
+	drawPDFFooter(doc, "Valeurs calculées par l'application de suivi des granulés, d'après les achats et consommations saisis.")
+	return doc
+}
+
+func renderSeasonReport(report core.SeasonReport, now time.Time) *pdf.Document {
+	const left = 50.0
+	doc := pdf.New("Saison " + report.Label)
+
+	y := 780.0
+	doc.Text(left, y, 20, pdf.Bold, "Saison de chauffe "+report.Label)
+	y -= 18
+	doc.Text(left, y, 10, pdf.Regular, fmt.Sprintf("Du %s au %s · établi le %s", report.Start.Format("02/01/2006"), report.End.Format("02/01/2006"), now.Format("02/01/2006")))
+
+	y -= 22
+	doc.FillRect(left, y-78, pdf.PageWidth-2*left, 88, 0.93)
+	y -= 8
+	doc.Text(left+10, y, 11, pdf.Regular, "Sacs brûlés : "+formatBags(report.BagsConsumed))
+	doc.Text(300, y, 11, pdf.Regular, fmt.Sprintf("Jours de chauffe : %d", report.HeatingDays))
+	y -= 18
+	doc.Text(left+10, y, 11, pdf.Regular, "Coût consommé : "+core.FormatMoney(report.ConsumedValue))
+	doc.Text(300, y, 11, pdf.Regular, "Coût moyen par sac : "+core.FormatMoney(report.AverageBagCost))
+	y -= 18
+	doc.Text(left+10, y, 11, pdf.Regular, "Énergie estimée : "+formatKWh(report.EnergyKWh))
+	doc.Text(300, y, 11, pdf.Regular, "Coût de l'énergie : "+pdfKWhPrice(report.CostPerMWh))
+	y -= 18
+	doc.Text(left+10, y, 11, pdf.Regular, fmt.Sprintf("Sacs achetés : %d", report.BagsBought))
+	doc.Text(300, y, 11, pdf.Regular, "Dépense : "+core.FormatMoney(report.Spent))
+
+	y -= 40
+	doc.Text(left, y, 13, pdf.Bold, "Sacs brûlés par mois")
+	y = drawMonthlyChart(doc, left, y-12, pdf.PageWidth-2*left, 130, report.Months)
+
+	y -= 30
+	doc.Text(left, y, 13, pdf.Bold, "Par marque")
+	columns := []pdfColumn{{"Marque", left}, {"Sacs achetés", 220}, {"Dépense", 290}, {"Sacs brûlés", 370}, {"Coût consommé", 450}}
+	rows := make([][]string, 0, len(report.Brands))
+	for _, brand := range report.Brands {
+		rows = append(rows, []string{
+			truncate(brand.BrandName, 30),
+			strconv.Itoa(brand.BagsBought),
+			core.FormatMoney(brand.Spent),
+			formatBags(brand.BagsConsumed),
+			core.FormatMoney(brand.ConsumedValue),
+		})
+	}
+	y = drawPDFTable(doc, y-20, columns, rows, "Aucun achat ni consommation cette saison.")
+
+	if len(report.Previous) > 0 && y > 160 {
+		y -= 30
+		doc.Text(left, y, 13, pdf.Bold, "Comparaison avec les saisons précédentes")
+		columns := []pdfColumn{{"Saison", left}, {"Sacs brûlés", 130}, {"Écart", 200}, {"Coût consommé", 260}, {"Écart", 345}, {"Dépense", 405}, {"Écart", 485}}
+		rows := make([][]string, 0, len(report.Previous))
+		for _, previous := range report.Previous {
+			rows = append(rows, []string{
+				previous.Label,
+				formatBags(previous.BagsConsumed),
+				pdfChange(previous.BagsChangePercent),
+				core.FormatMoney(previous.ConsumedValue),
+				pdfChange(previous.ConsumedValueChangePercent),
+				core.FormatMoney(previous.Spent),
+				pdfChange(previous.SpentChangePercent),
+			})
+		}
+		y = drawPDFTable(doc, y-20, columns, rows, "")
+	}
+
+	if len(report.Previous) > 0 && y > 160 {
+		y -= 30
+		doc.Text(left, y, 13, pdf.Bold, "Évolution des prix")
+		columns := []pdfColumn{{"Saison", left}, {"Coût moyen par sac", 130}, {"Écart", 250}, {"Coût de l'énergie", 310}, {"Écart", 430}}
+		rows := make([][]string, 0, len(report.Previous))
+		for _, previous := range report.Previous {
+			rows = append(rows, []string{
+				previous.Label,
+				core.FormatMoney(previous.AverageBagCost),
+				pdfChange(previous.AverageBagCostChangePercent),
+				pdfKWhPrice(previous.CostPerMWh),
+				pdfChange(previous.CostPerMWhChangePercent),
+			})
+		}
+		drawPDFTable(doc, y-20, columns, rows, "")
+	}
+
+	drawPDFFooter(doc, "Écarts de la saison "+report.Label+" par rapport à chaque saison précédente ; coûts valorisés en FIFO.")
+	return doc
+}
+
+// drawMonthlyChart draws a bar per month with its bags under top, within
+// width and height, and returns the y below the month labels.
+func drawMonthlyChart(doc *pdf.Document, x, top, width, height float64, months []core.SeasonMonth) float64 {
+	base := top - height
+	doc.Line(x, base, x+width, base, 0.5)
+	if len(months) == 0 {
+		doc.Text(x, base+8, 9, pdf.Regular, "Aucune consommation enregistrée.")
+		return base - 14
+	}
+	maxBags := 0.0
+	for _, month := range months {
+		maxBags = max(maxBags, month.Bags)
+	}
+	slot := width / float64(len(months))
+	// Month labels are about 38 points wide at 7 points.
+	labelEvery := int(math.Ceil(38 / slot))
+	for i, month := range months {
+		barX := x + float64(i)*slot + slot*0.15
+		if maxBags > 0 && month.Bags > 0 {
+			barHeight := (height - 14) * month.Bags / maxBags
+			doc.FillRect(barX, base, slot*0.7, barHeight, 0.55)
+			doc.Text(barX, base+barHeight+3, 7, pdf.Regular, formatBags(month.Bags))
+		}
+		if i%labelEvery == 0 {
+			doc.Text(barX, base-10, 7, pdf.Regular, formatMonthLabel(month.Month))
+		}
+	}
+	return base - 14
+}
+
+// drawPDFTable draws the column titles at y then a line per row, stopping at
+// the footer, and returns the y of the last line. empty is written when there
+// is no row.
+func drawPDFTable(doc *pdf.Document, y float64, columns []pdfColumn, rows [][]string, empty string) float64 {
+	const left = 50.0
+	for _, column := range columns {
+		doc.Text(column.x, y, 9, pdf.Bold, column.title)
+	}
+	y -= 6
+	doc.Line(left, y, pdf.PageWidth-left, y, 0.5)
+	if len(rows) == 0 && empty != "" {
+		y -= 14
+		doc.Text(left, y, 9, pdf.Regular, empty)
+	}
+	for _, row := range rows {
+		if y-16 < 90 {
+			break
+		}
+		y -= 16
+		for i, value := range row {
+			doc.Text(columns[i].x, y, 9, pdf.Regular, value)
+		}
+	}
+	return y
+}
+
+func drawPDFFooter(doc *pdf.Document, text string) {
+	doc.Line(50, 70, pdf.PageWidth-50, 70, 0.5)
+	doc.Text(50, 56, 8, pdf.Regular, text)
+}
+
+// pdfKWhPrice is formatKWhPrice, with a dash for a season without energy.
+func pdfKWhPrice(perMWh core.Money) string {
+	if perMWh == 0 {
+		return "–"
+	}
+	return formatKWhPrice(perMWh)
+}
+
+func pdfChange(percent *float64) string {
+	if percent == nil {
+		return "–"
+	}
+	return formatPercentChange(percent)
+}
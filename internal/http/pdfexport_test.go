@@ -0,0 +1,109 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_exportPDF(t *testing.T) {
+	t.Parallel()
+
+	store := &stubDataStore{data: core.DataStore{
+		Brands: []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock (15 kg)"}},
+		Purchases: []core.Purchase{
+			{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: time.Date(2023, time.September, 1, 0, 0, 0, 0, time.UTC), Bags: 20, BagWeightKg: 15, TotalWeightKg: 300, UnitPriceCents: 600, TotalPriceCents: 12000},
+		},
+		Consumptions: []core.Consumption{
+			{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC), Bags: 3},
+			{Meta: core.Meta{ID: "c2"}, BrandID: "brand-w", ConsumedAt: time.Date(2024, time.November, 10, 0, 0, 0, 0, time.UTC), Bags: 1},
+		},
+	}}
+
+	type params struct {
+		path string
+	}
+	type want struct {
+		statusCode  int
+		contains    []string
+		disposition string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "prints the statistics",
+			params: params{path: "/api/export/pdf"},
+			want: want{
+				statusCode: http.StatusOK,
+				contains:   []string{"%PDF-1.4", "(Statistiques de chauffage)", `(Woodstock \(15 kg\))`, "(Stock : 16 sacs)", "(Jan. 2024)", "(Total)"},
+			},
+		},
+		{
+			name:   "prints the statistics with another costing",
+			params: params{path: "/api/export/pdf?costing=lifo"},
+			want:   want{statusCode: http.StatusOK, contains: []string{"valorisation LIFO"}},
+		},
+		{
+			name:   "prints a season report",
+			params: params{path: "/api/export/pdf?report=season&year=2024"},
+			want: want{
+				statusCode:  http.StatusOK,
+				contains:    []string{"(Saison de chauffe 2024-2025)", "(Sacs br\xfbl\xe9s : 1)", "(Nov. 2024)", "(2023-2024)", "(-66,7 %)"},
+				disposition: `attachment; filename="pellets-saison-2024-2025.pdf"`,
+			},
+		},
+		{
+			name:   "reports an unknown season",
+			params: params{path: "/api/export/pdf?report=season&year=2030"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "rejects a missing season year",
+			params: params{path: "/api/export/pdf?report=season"},
+			want:   want{statusCode: http.StatusBadRequest},
+		},
+		{
+			name:   "rejects an unknown report",
+			params: params{path: "/api/export/pdf?report=inventory"},
+			want:   want{statusCode: http.StatusBadRequest},
+		},
+		{
+			name:   "rejects an invalid range",
+			params: params{path: "/api/export/pdf?from=2024"},
+			want:   want{statusCode: http.StatusBadRequest},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(store, Config{})
+			req := httptest.NewRequest(http.MethodGet, tc.params.path, nil)
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			if tc.want.statusCode == http.StatusOK {
+				assert.Equal(t, "application/pdf", rec.Header().Get("Content-Type"), tc.name)
+			}
+			if tc.want.disposition != "" {
+				assert.Equal(t, tc.want.disposition, rec.Header().Get("Content-Disposition"), tc.name)
+			}
+			for _, fragment := range tc.want.contains {
+				assert.Contains(t, rec.Body.String(), fragment, tc.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,375 @@
+package http
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"pellets-tracker/internal/core"
+)
+
+const (
+	// photoWidth keeps the photos of receipts legible while bounding their
+	// size in the datastore file.
+	photoWidth = 1600
+	// thumbnailWidth is the width of the photos shown in the lists.
+	thumbnailWidth = 240
+)
+
+// photoOwner reaches the photos of a brand gallery or of a purchase, so the
+// same handlers serve both.
+type photoOwner struct {
+	// entity names the owner in the logs.
+	entity string
+	// apiPrefix is the path the photos are listed under, followed by the ID
+	// of the owner.
+	apiPrefix string
+	photos    func(ds *core.DataStore, id core.ID) ([]core.Photo, error)
+	add       func(ds *core.DataStore, id core.ID, params core.AddPhotoParams) (core.Photo, error)
+	remove    func(ds *core.DataStore, id, photoID core.ID) error
+}
+
+var (
+	brandPhotos = photoOwner{
+		entity:    "brand_photo",
+		apiPrefix: "/api/marques/",
+		photos: func(ds *core.DataStore, id core.ID) ([]core.Photo, error) {
+			for _, brand := range ds.Brands {
+				if brand.ID == id {
+					return brand.Gallery, nil
+				}
+			}
+			return nil, core.ErrBrandNotFound
+		},
+		add:    core.AddBrandPhoto,
+		remove: core.DeleteBrandPhoto,
+	}
+	purchasePhotos = photoOwner{
+		entity:    "purchase_photo",
+		apiPrefix: "/api/achats/",
+		photos: func(ds *core.DataStore, id core.ID) ([]core.Photo, error) {
+			purchase, ok := findPurchase(ds.Purchases, id)
+			if !ok {
+				return nil, core.ErrPurchaseNotFound
+			}
+			return purchase.Photos, nil
+		},
+		add:    core.AddPurchasePhoto,
+		remove: core.DeletePurchasePhoto,
+	}
+)
+
+// photoView is a photo as listed by the API and the pages, its image being
+// served apart.
+type photoView struct {
+	ID           core.ID   `json:"id"`
+	AddedAt      time.Time `json:"added_at"`
+	Caption      string    `json:"caption,omitempty"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+}
+
+func newPhotoViews(owner photoOwner, ownerID core.ID, photos []core.Photo) []photoView {
+	views := make([]photoView, len(photos))
+	for i, photo := range photos {
+		url := owner.apiPrefix + string(ownerID) + "/photos/" + string(photo.ID)
+		views[i] = photoView{ID: photo.ID, AddedAt: photo.AddedAt, Caption: photo.Caption, URL: url, ThumbnailURL: url + "/miniature"}
+	}
+	return views
+}
+
+// photoGallery backs the photoGallery template: the photos of a brand or of
+// a purchase, the path their forms post to and the anchor of the section
+// showing them.
+type photoGallery struct {
+	Photos []photoView
+	Action string
+	Anchor string
+	// Full hides the upload form once MaxPhotos are kept.
+	Full bool
+}
+
+func newPhotoGallery(owner photoOwner, ownerID core.ID, photos []core.Photo, action, anchor string) photoGallery {
+	return photoGallery{
+		Photos: newPhotoViews(owner, ownerID, photos),
+		Action: action,
+		Anchor: anchor,
+		Full:   len(photos) >= core.MaxPhotos,
+	}
+}
+
+// photoTarget is a path below the photos of an owner: the list, a photo or
+// its thumbnail, or the deletion of a photo on the pages.
+type photoTarget struct {
+	OwnerID   core.ID
+	PhotoID   core.ID
+	Action    string
+	Thumbnail bool
+}
+
+// parsePhotoPath splits {prefix}{id}/photos, {prefix}{id}/photos/{photoID}
+// and {prefix}{id}/photos/{photoID}/{action}; ok is false for any other
+// path.
+func parsePhotoPath(path, prefix string) (photoTarget, bool) {
+	parts := strings.Split(strings.TrimPrefix(path, prefix), "/")
+	if len(parts) < 2 || len(parts) > 4 || parts[0] == "" || parts[1] != "photos" {
+		return photoTarget{}, false
+	}
+	target := photoTarget{OwnerID: core.ID(parts[0])}
+	if len(parts) > 2 {
+		if parts[2] == "" {
+			return photoTarget{}, false
+		}
+		target.PhotoID = core.ID(parts[2])
+	}
+	if len(parts) == 4 {
+		target.Action = parts[3]
+		target.Thumbnail = parts[3] == "miniature"
+	}
+	return target, true
+}
+
+// handlePhotosAPI serves /api/{owner}/{id}/photos: GET lists the photos and
+// POST adds the image_file of a multipart form; /photos/{photoID} serves the
+// image or deletes it and /photos/{photoID}/miniature serves its thumbnail.
+func (s *Server) handlePhotosAPI(w http.ResponseWriter, r *http.Request, owner photoOwner, target photoTarget) {
+	switch {
+	case target.PhotoID == "":
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			ds := s.store.Data()
+			photos, err := owner.photos(&ds, target.OwnerID)
+			if err != nil {
+				s.handleCoreError(w, err)
+				return
+			}
+			s.writeJSON(w, http.StatusOK, newPhotoViews(owner, target.OwnerID, photos))
+		case http.MethodPost:
+			s.createPhoto(w, r, owner, target.OwnerID)
+		default:
+			s.methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+		}
+	case target.Action == "":
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			s.servePhoto(w, r, owner, target)
+		case http.MethodDelete:
+			ds := s.store.Data()
+			if err := owner.remove(&ds, target.OwnerID, target.PhotoID); err != nil {
+				s.handleCoreError(w, err)
+				return
+			}
+			if err := s.store.Replace(ds); err != nil {
+				s.handleStoreError(w, err)
+				return
+			}
+			log.Printf(`{"type":"delete","entity":"%s","id":"%s"}`, owner.entity, target.PhotoID)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			s.methodNotAllowed(w, r, http.MethodGet, http.MethodDelete)
+		}
+	case target.Thumbnail:
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			s.methodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+		s.servePhoto(w, r, owner, target)
+	default:
+		s.notFound(w, r)
+	}
+}
+
+func (s *Server) createPhoto(w http.ResponseWriter, r *http.Request, owner photoOwner, ownerID core.ID) {
+	params, err := s.photoFromRequest(w, r)
+	if err != nil {
+		switch {
+		case errors.Is(err, errBrandImageTooLarge):
+			s.writeError(w, http.StatusRequestEntityTooLarge, err)
+		default:
+			s.writeError(w, http.StatusBadRequest, err)
+		}
+		return
+	}
+	ds := s.store.Data()
+	photo, err := owner.add(&ds, ownerID, params)
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	if err := s.store.Replace(ds); err != nil {
+		s.handleStoreError(w, err)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"%s","id":"%s"}`, owner.entity, photo.ID)
+	s.writeJSON(w, http.StatusCreated, newPhotoViews(owner, ownerID, []core.Photo{photo})[0])
+}
+
+// photoFromRequest reads the image_file and the caption of a multipart form
+// and encodes the photo with its thumbnail.
+func (s *Server) photoFromRequest(w http.ResponseWriter, r *http.Request) (core.AddPhotoParams, error) {
+	maxBytes := s.effectiveMaxBrandImageBytes()
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+brandImageRequestOverhead)
+	if err := r.ParseMultipartForm(maxBytes); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return core.AddPhotoParams{}, errBrandImageTooLarge
+		}
+		return core.AddPhotoParams{}, fmt.Errorf("invalid multipart form: %w", err)
+	}
+	file, _, err := r.FormFile("image_file")
+	if err != nil {
+		return core.AddPhotoParams{}, fmt.Errorf("image_file: %w", err)
+	}
+	defer file.Close()
+	image, thumbnail, err := s.encodePhoto(file)
+	if err != nil {
+		return core.AddPhotoParams{}, err
+	}
+	return core.AddPhotoParams{Caption: r.FormValue("caption"), ImageBase64: image, ThumbnailBase64: thumbnail}, nil
+}
+
+// encodePhoto scales an uploaded photo down to photoWidth and makes its
+// thumbnail.
+func (s *Server) encodePhoto(r io.Reader) (string, string, error) {
+	image, err := s.encodeImage(r, photoWidth)
+	if err != nil {
+		return "", "", err
+	}
+	raw, err := base64.StdEncoding.DecodeString(image)
+	if err != nil {
+		return "", "", fmt.Errorf("decode photo: %w", err)
+	}
+	thumbnail, err := s.encodeImage(bytes.NewReader(raw), thumbnailWidth)
+	if err != nil {
+		return "", "", err
+	}
+	return image, thumbnail, nil
+}
+
+// servePhoto writes the image of a photo, or its thumbnail. A photo never
+// changes once added, so browsers may keep it.
+func (s *Server) servePhoto(w http.ResponseWriter, r *http.Request, owner photoOwner, target photoTarget) {
+	ds := s.store.Data()
+	photos, err := owner.photos(&ds, target.OwnerID)
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	photo, ok := core.FindPhoto(photos, target.PhotoID)
+	if !ok {
+		s.handleCoreError(w, core.ErrPhotoNotFound)
+		return
+	}
+	encoded := photo.ImageBase64
+	if target.Thumbnail && photo.ThumbnailBase64 != "" {
+		encoded = photo.ThumbnailBase64
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		log.Printf("photo %s: %v", photo.ID, err)
+		s.writeError(w, http.StatusInternalServerError, errors.New("invalid photo"))
+		return
+	}
+	w.Header().Set("Content-Type", imageContentType(encoded))
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	http.ServeContent(w, r, "", photo.AddedAt, bytes.NewReader(raw))
+}
+
+// photoFormErrors are the messages of the photo forms, passed back to the
+// page with ?photo_error=<code>.
+var photoFormErrors = map[string]string{
+	"size":    "Photo trop volumineuse",
+	"format":  "Format d'image non reconnu",
+	"missing": "Choisissez une photo à ajouter",
+	"limit":   fmt.Sprintf("Pas plus de %d photos", core.MaxPhotos),
+	"invalid": "Impossible de traiter la photo",
+}
+
+// handlePhotoForm adds a photo on POST {page}/{id}/photos and deletes one on
+// POST {page}/{id}/photos/{photoID}/supprimer, then goes back to the page
+// the form was sent from, at anchor.
+func (s *Server) handlePhotoForm(w http.ResponseWriter, r *http.Request, owner photoOwner, target photoTarget, back, anchor string) {
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	ds := s.store.Data()
+	switch {
+	case target.PhotoID == "":
+		params, err := s.photoFromRequest(w, r)
+		if err != nil {
+			code := "invalid"
+			switch {
+			case errors.Is(err, errBrandImageTooLarge):
+				code = "size"
+			case errors.Is(err, errBrandImageInvalid):
+				code = "format"
+			case errors.Is(err, http.ErrMissingFile):
+				code = "missing"
+			}
+			http.Redirect(w, r, back+"?photo_error="+code+"#"+anchor, http.StatusSeeOther)
+			return
+		}
+		photo, err := owner.add(&ds, target.OwnerID, params)
+		if err != nil {
+			if isValidationError(err) {
+				http.Redirect(w, r, back+"?photo_error=limit#"+anchor, http.StatusSeeOther)
+				return
+			}
+			s.notFound(w, r)
+			return
+		}
+		if err := s.store.Replace(ds); err != nil {
+			log.Printf("persist photo form: %v", err)
+			s.renderErrorPage(w, http.StatusInternalServerError)
+			return
+		}
+		log.Printf(`{"type":"save","entity":"%s","id":"%s"}`, owner.entity, photo.ID)
+		http.Redirect(w, r, back+"?added=photo#"+anchor, http.StatusSeeOther)
+	case target.Action == "supprimer":
+		if err := owner.remove(&ds, target.OwnerID, target.PhotoID); err != nil {
+			s.notFound(w, r)
+			return
+		}
+		if err := s.store.Replace(ds); err != nil {
+			log.Printf("persist photo deletion: %v", err)
+			s.renderErrorPage(w, http.StatusInternalServerError)
+			return
+		}
+		log.Printf(`{"type":"delete","entity":"%s","id":"%s"}`, owner.entity, target.PhotoID)
+		http.Redirect(w, r, back+"?deleted=photo#"+anchor, http.StatusSeeOther)
+	default:
+		s.notFound(w, r)
+	}
+}
+
+// photoFlash reports the outcome of the photo forms redirected to a page.
+func photoFlash(r *http.Request) *flashMessage {
+	if message, ok := photoFormErrors[r.URL.Query().Get("photo_error")]; ok {
+		return &flashMessage{Kind: "error", Message: message}
+	}
+	if flash := deletedFlash(r, "photo", "Photo supprimée"); flash != nil {
+		return flash
+	}
+	if r.URL.Query().Get("added") == "photo" {
+		return &flashMessage{Kind: "success", Message: "Photo ajoutée"}
+	}
+	return nil
+}
+
+// handleBrandPhotosPage serves the photo forms of the brand galleries under
+// /marques/{id}/photos.
+func (s *Server) handleBrandPhotosPage(w http.ResponseWriter, r *http.Request) {
+	target, ok := parsePhotoPath(r.URL.Path, "/marques/")
+	if !ok {
+		s.notFound(w, r)
+		return
+	}
+	s.handlePhotoForm(w, r, brandPhotos, target, "/marques", "marque-"+string(target.OwnerID))
+}
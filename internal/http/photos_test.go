@@ -0,0 +1,258 @@
+package http
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_photosAPI(t *testing.T) {
+	t.Parallel()
+
+	photo := func(width, height int) []byte {
+		img := imaging.New(width, height, color.NRGBA{R: 200, G: 180, B: 150, A: 255})
+		var buf bytes.Buffer
+		require.NoError(t, jpeg.Encode(&buf, img, nil))
+		return buf.Bytes()
+	}
+	stored := photo(300, 200)
+	thumbnail := photo(24, 16)
+	// Each case gets its own datastore since deleting a photo changes the
+	// brands and purchases in place.
+	newData := func() core.DataStore {
+		return core.DataStore{
+			Brands: []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock", Gallery: []core.Photo{{ID: "ph-b", ImageBase64: base64.StdEncoding.EncodeToString(stored)}}}},
+			Purchases: []core.Purchase{{
+				Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC), Bags: 10, BagWeightKg: 15, TotalWeightKg: 150,
+				Photos: []core.Photo{{ID: "ph-p", Caption: "Ticket", ImageBase64: base64.StdEncoding.EncodeToString(stored), ThumbnailBase64: base64.StdEncoding.EncodeToString(thumbnail)}},
+			}},
+		}
+	}
+
+	type params struct {
+		method string
+		path   string
+		upload []byte
+	}
+	type want struct {
+		statusCode   int
+		bodyContains string
+		contentType  string
+		// width is that of the image served, when one is.
+		width int
+		// purchasePhotos is the number of photos of the purchase afterwards.
+		purchasePhotos int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "lists the photos of a purchase",
+			params: params{method: http.MethodGet, path: "/api/achats/p1/photos"},
+			want:   want{statusCode: http.StatusOK, bodyContains: `"thumbnail_url":"/api/achats/p1/photos/ph-p/miniature"`, purchasePhotos: 1},
+		},
+		{
+			name:   "serves a photo",
+			params: params{method: http.MethodGet, path: "/api/achats/p1/photos/ph-p"},
+			want:   want{statusCode: http.StatusOK, contentType: "image/jpeg", width: 300, purchasePhotos: 1},
+		},
+		{
+			name:   "serves a thumbnail",
+			params: params{method: http.MethodGet, path: "/api/achats/p1/photos/ph-p/miniature"},
+			want:   want{statusCode: http.StatusOK, contentType: "image/jpeg", width: 24, purchasePhotos: 1},
+		},
+		{
+			name:   "serves the gallery of a brand",
+			params: params{method: http.MethodGet, path: "/api/marques/brand-w/photos/ph-b/miniature"},
+			want:   want{statusCode: http.StatusOK, contentType: "image/jpeg", width: 300, purchasePhotos: 1},
+		},
+		{
+			name:   "adds a photo scaled down with its thumbnail",
+			params: params{method: http.MethodPost, path: "/api/achats/p1/photos", upload: photo(2400, 1200)},
+			want:   want{statusCode: http.StatusCreated, bodyContains: `"caption":"Bon de livraison"`, purchasePhotos: 2},
+		},
+		{
+			name:   "rejects a file that is not an image",
+			params: params{method: http.MethodPost, path: "/api/achats/p1/photos", upload: []byte("not-an-image")},
+			want:   want{statusCode: http.StatusBadRequest, bodyContains: "invalid brand image", purchasePhotos: 1},
+		},
+		{
+			name:   "deletes a photo",
+			params: params{method: http.MethodDelete, path: "/api/achats/p1/photos/ph-p"},
+			want:   want{statusCode: http.StatusNoContent},
+		},
+		{
+			name:   "answers 404 for an unknown photo",
+			params: params{method: http.MethodGet, path: "/api/achats/p1/photos/missing"},
+			want:   want{statusCode: http.StatusNotFound, bodyContains: "photo not found", purchasePhotos: 1},
+		},
+		{
+			name:   "answers 404 for an unknown purchase",
+			params: params{method: http.MethodGet, path: "/api/achats/missing/photos"},
+			want:   want{statusCode: http.StatusNotFound, bodyContains: "purchase not found", purchasePhotos: 1},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: newData()}
+			server := NewServer(store, Config{})
+
+			var req *http.Request
+			if tc.params.upload != nil {
+				body := &bytes.Buffer{}
+				writer := multipart.NewWriter(body)
+				require.NoError(t, writer.WriteField("caption", "Bon de livraison"), tc.name)
+				part, err := writer.CreateFormFile("image_file", "ticket.jpg")
+				require.NoError(t, err, tc.name)
+				_, err = part.Write(tc.params.upload)
+				require.NoError(t, err, tc.name)
+				require.NoError(t, writer.Close(), tc.name)
+				req = httptest.NewRequest(tc.params.method, tc.params.path, body)
+				req.Header.Set("Content-Type", writer.FormDataContentType())
+			} else {
+				req = httptest.NewRequest(tc.params.method, tc.params.path, nil)
+			}
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Contains(t, rec.Body.String(), tc.want.bodyContains, tc.name)
+			if tc.want.contentType != "" {
+				assert.Equal(t, tc.want.contentType, rec.Header().Get("Content-Type"), tc.name)
+				img, _, err := image.Decode(rec.Body)
+				require.NoError(t, err, tc.name)
+				assert.Equal(t, tc.want.width, img.Bounds().Dx(), tc.name)
+			}
+			photos := store.Data().Purchases[0].Photos
+			require.Len(t, photos, tc.want.purchasePhotos, tc.name)
+			if tc.want.statusCode == http.StatusCreated {
+				var created photoView
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created), tc.name)
+				added, ok := core.FindPhoto(photos, created.ID)
+				require.True(t, ok, tc.name)
+				for encoded, width := range map[string]int{added.ImageBase64: photoWidth, added.ThumbnailBase64: thumbnailWidth} {
+					raw, err := base64.StdEncoding.DecodeString(encoded)
+					require.NoError(t, err, tc.name)
+					img, _, err := image.Decode(bytes.NewReader(raw))
+					require.NoError(t, err, tc.name)
+					assert.Equal(t, width, img.Bounds().Dx(), tc.name)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_photoForms(t *testing.T) {
+	t.Parallel()
+
+	newData := func() core.DataStore {
+		return core.DataStore{
+			Brands: []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock", Gallery: []core.Photo{{ID: "ph-b", Caption: "Sac de 15 kg", ImageBase64: "QUJD"}}}},
+			Purchases: []core.Purchase{{
+				Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC), Bags: 10, BagWeightKg: 15, TotalWeightKg: 150,
+				Photos: []core.Photo{{ID: "ph-p", Caption: "Ticket", ImageBase64: "QUJD"}},
+			}},
+		}
+	}
+
+	type params struct {
+		method string
+		path   string
+	}
+	type want struct {
+		statusCode   int
+		location     string
+		bodyContains []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "shows the photos of a purchase",
+			params: params{method: http.MethodGet, path: "/achats/p1"},
+			want: want{statusCode: http.StatusOK, bodyContains: []string{
+				`<a href="#photo-ph-p"><img src="/api/achats/p1/photos/ph-p/miniature" alt="Ticket" loading="lazy"></a>`,
+				`action="/achats/p1/photos/ph-p/supprimer"`,
+				`action="/achats/p1/photos" enctype="multipart/form-data"`,
+			}},
+		},
+		{
+			name:   "shows the gallery of a brand",
+			params: params{method: http.MethodGet, path: "/marques"},
+			want: want{statusCode: http.StatusOK, bodyContains: []string{
+				`id="marque-brand-w"`,
+				`<summary>Photos (1)</summary>`,
+				`action="/marques/brand-w/photos/ph-b/supprimer"`,
+			}},
+		},
+		{
+			name:   "deletes a photo of a purchase",
+			params: params{method: http.MethodPost, path: "/achats/p1/photos/ph-p/supprimer"},
+			want:   want{statusCode: http.StatusSeeOther, location: "/achats/p1?deleted=photo#photos"},
+		},
+		{
+			name:   "deletes a photo of a brand",
+			params: params{method: http.MethodPost, path: "/marques/brand-w/photos/ph-b/supprimer"},
+			want:   want{statusCode: http.StatusSeeOther, location: "/marques?deleted=photo#marque-brand-w"},
+		},
+		{
+			name:   "reports a missing file",
+			params: params{method: http.MethodPost, path: "/achats/p1/photos"},
+			want:   want{statusCode: http.StatusSeeOther, location: "/achats/p1?photo_error=invalid#photos"},
+		},
+		{
+			name:   "shows the outcome",
+			params: params{method: http.MethodGet, path: "/achats/p1?photo_error=limit"},
+			want:   want{statusCode: http.StatusOK, bodyContains: []string{"Pas plus de 12 photos"}},
+		},
+		{
+			name:   "answers 404 for an unknown photo",
+			params: params{method: http.MethodPost, path: "/marques/brand-w/photos/missing/supprimer"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{data: newData()}, Config{})
+			req := httptest.NewRequest(tc.params.method, tc.params.path, nil)
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.location, rec.Header().Get("Location"), tc.name)
+			for _, fragment := range tc.want.bodyContains {
+				assert.Contains(t, rec.Body.String(), fragment, tc.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/store"
+)
+
+// readOnlyDataStore serves a backup and refuses every write, as a JSONStore
+// whose data file cannot be read.
+type readOnlyDataStore struct {
+	stubDataStore
+	backup string
+}
+
+func (s *readOnlyDataStore) Replace(core.DataStore) error {
+	return store.ErrReadOnly
+}
+
+func (s *readOnlyDataStore) ReadOnly() (string, bool) {
+	return s.backup, s.backup != ""
+}
+
+func TestServer_readOnly(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		backup string
+		method string
+		path   string
+		body   string
+	}
+	type want struct {
+		statusCode   int
+		bodyContains string
+		bodyExcludes string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "pages show the degraded mode banner",
+			params: params{backup: "/data/backups/pellets.json-20240110T000000Z.bak", method: http.MethodGet, path: "/marques"},
+			want:   want{statusCode: http.StatusOK, bodyContains: "Mode dégradé, lecture seule.</strong> Le fichier de données est illisible : les données affichées proviennent de la dernière sauvegarde (pellets.json-20240110T000000Z.bak)"},
+		},
+		{
+			name:   "pages without banner when the data file is read",
+			params: params{method: http.MethodGet, path: "/marques"},
+			want:   want{statusCode: http.StatusOK, bodyExcludes: "Mode dégradé"},
+		},
+		{
+			name:   "health check reports degraded",
+			params: params{backup: "pellets.json-20240110T000000Z.bak", method: http.MethodGet, path: "/healthz"},
+			want:   want{statusCode: http.StatusOK, bodyContains: `{"status":"degraded","read_only":true}`},
+		},
+		{
+			name:   "health check reports ok",
+			params: params{method: http.MethodGet, path: "/healthz"},
+			want:   want{statusCode: http.StatusOK, bodyContains: `{"status":"ok"}`},
+		},
+		{
+			name:   "api writes are unavailable",
+			params: params{backup: "pellets.json-20240110T000000Z.bak", method: http.MethodPost, path: "/api/marques", body: `{"name":"Bois Énergie"}`},
+			want:   want{statusCode: http.StatusServiceUnavailable, bodyContains: "read-only"},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ds := &readOnlyDataStore{backup: tc.params.backup}
+			server := NewServer(ds, Config{ReadOnly: ds})
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.params.method, tc.params.path, strings.NewReader(tc.params.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			server.mux.ServeHTTP(rec, req)
+
+			require.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Contains(t, rec.Body.String(), tc.want.bodyContains, tc.name)
+			if tc.want.bodyExcludes != "" {
+				assert.NotContains(t, rec.Body.String(), tc.want.bodyExcludes, tc.name)
+			}
+		})
+	}
+}
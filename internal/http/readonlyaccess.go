@@ -0,0 +1,105 @@
+package http
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var errReadOnlyAccess = errors.New("read-only access, changes are not allowed")
+
+// sharePath followed by Config.ShareToken is the share link of a
+// Config.ReadOnlyAccess server.
+const sharePath = "/partage/"
+
+// shareCookieName keeps the share token in the browsers which opened the
+// share link, so the pages and the requests they make carry it without
+// the token in every URL.
+const shareCookieName = "pellets_share"
+
+// readOnlyAccessPaths are the only paths a Config.ReadOnlyAccess server
+// answers: the statistics, their exports and the assets of the pages. The
+// entries, the photos, the reports, the audit log and the other exports stay
+// on the private listeners.
+var readOnlyAccessPaths = []string{
+	"/healthz",
+	"/static/",
+	"/stats",
+	"/stats/plan-de-commande.pdf",
+	"/api/stats",
+	"/api/stats/forecast",
+	"/api/export/pdf",
+}
+
+// readOnlyAccessMiddleware restricts a Config.ReadOnlyAccess server to the
+// statistics, for the holders of the share link: the other clients only
+// reach /healthz and the assets. With the link, the home page leads to the
+// statistics, the other paths are not found and the requests that would
+// modify the data are refused with a 403.
+func (s *Server) readOnlyAccessMiddleware(next http.Handler) http.Handler {
+	if !s.readOnlyAccess {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, sharePath) {
+			s.openShareLink(w, r)
+			return
+		}
+		if !matchesPath(r.URL.Path, publicReadPaths) && !s.validShareToken(shareCookie(r)) {
+			s.notFound(w, r)
+			return
+		}
+		if !isSafeMethod(r.Method) {
+			if wantsJSON(r) {
+				s.writeError(w, http.StatusForbidden, errReadOnlyAccess)
+				return
+			}
+			s.renderErrorPage(w, http.StatusForbidden)
+			return
+		}
+		switch {
+		case r.URL.Path == "/":
+			http.Redirect(w, r, "/stats", http.StatusFound)
+		case matchesPath(r.URL.Path, readOnlyAccessPaths):
+			next.ServeHTTP(w, r)
+		default:
+			s.notFound(w, r)
+		}
+	})
+}
+
+// openShareLink serves /partage/{token}: a valid token is kept in a cookie
+// and the browser sent on to the statistics, leaving the token out of the
+// address bar and of the Referer of the next pages.
+func (s *Server) openShareLink(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, sharePath)
+	if !isSafeMethod(r.Method) || !s.validShareToken(token) {
+		s.notFound(w, r)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     shareCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	http.Redirect(w, r, "/stats", http.StatusFound)
+}
+
+// validShareToken reports whether token is the share token, compared in
+// constant time. No token is valid while none is configured.
+func (s *Server) validShareToken(token string) bool {
+	return s.shareToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.shareToken)) == 1
+}
+
+func shareCookie(r *http.Request) string {
+	cookie, err := r.Cookie(shareCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
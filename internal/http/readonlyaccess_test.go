@@ -0,0 +1,219 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_readOnlyAccess(t *testing.T) {
+	t.Parallel()
+
+	const shareToken = "Xk3_9fQ-2mZpR7vLw8YtN4bD"
+	brandID := core.NewID()
+	purchaseID := core.NewID()
+	baseData := core.DataStore{
+		Brands:    []core.Brand{{Meta: core.Meta{ID: brandID}, Name: "Granules"}},
+		Purchases: []core.Purchase{{Meta: core.Meta{ID: purchaseID}, BrandID: brandID, Bags: 10, BagWeightKg: 15, TotalWeightKg: 150}},
+	}
+
+	type params struct {
+		readOnly bool
+		// cookie is the share token sent back by the browser, none when
+		// empty.
+		cookie string
+		method string
+		path   string
+		body   string
+		accept string
+	}
+	type want struct {
+		statusCode int
+		replaced   bool
+		// location is where the client is redirected.
+		location string
+		// shareCookie is the share token the response stores, none when
+		// empty.
+		shareCookie     string
+		bodyContains    []string
+		bodyNotContains []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "serves the pages with a banner",
+			params: params{readOnly: true, cookie: shareToken, method: http.MethodGet, path: "/stats"},
+			want: want{
+				statusCode:   http.StatusOK,
+				bodyContains: []string{`class="app-shell read-only"`, "Accès en lecture seule"},
+			},
+		},
+		{
+			name:   "serves the api",
+			params: params{readOnly: true, cookie: shareToken, method: http.MethodGet, path: "/api/stats", accept: "application/json"},
+			want:   want{statusCode: http.StatusOK},
+		},
+		{
+			name:   "opens the share link",
+			params: params{readOnly: true, method: http.MethodGet, path: "/partage/" + shareToken},
+			want:   want{statusCode: http.StatusFound, location: "/stats", shareCookie: shareToken},
+		},
+		{
+			name:   "hides a wrong share link",
+			params: params{readOnly: true, method: http.MethodGet, path: "/partage/" + shareToken[1:]},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "hides the statistics without the share link",
+			params: params{readOnly: true, method: http.MethodGet, path: "/stats"},
+			want:   want{statusCode: http.StatusNotFound, bodyNotContains: []string{"Granules"}},
+		},
+		{
+			name:   "hides the api once the share link is revoked",
+			params: params{readOnly: true, cookie: "revoked-Xk3_9fQ-2mZpR7vLw8", method: http.MethodGet, path: "/api/stats", accept: "application/json"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "hides the changes without the share link",
+			params: params{readOnly: true, method: http.MethodDelete, path: "/api/marques/" + string(brandID), accept: "application/json"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "serves the health check without the share link",
+			params: params{readOnly: true, method: http.MethodGet, path: "/healthz"},
+			want:   want{statusCode: http.StatusOK},
+		},
+		{
+			name:   "leads the home page to the statistics",
+			params: params{readOnly: true, cookie: shareToken, method: http.MethodGet, path: "/"},
+			want:   want{statusCode: http.StatusFound, location: "/stats"},
+		},
+		{
+			name:   "hides the other pages",
+			params: params{readOnly: true, cookie: shareToken, method: http.MethodGet, path: "/consommations"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "hides the json export",
+			params: params{readOnly: true, cookie: shareToken, method: http.MethodGet, path: "/api/export/json", accept: "application/json"},
+			want:   want{statusCode: http.StatusNotFound, bodyNotContains: []string{"Granules"}},
+		},
+		{
+			name:   "hides the csv export",
+			params: params{readOnly: true, cookie: shareToken, method: http.MethodGet, path: "/api/export/csv"},
+			want:   want{statusCode: http.StatusNotFound, bodyNotContains: []string{"Granules"}},
+		},
+		{
+			name:   "hides the images export",
+			params: params{readOnly: true, cookie: shareToken, method: http.MethodGet, path: "/api/export/images"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "hides the occupancy calendar",
+			params: params{readOnly: true, cookie: shareToken, method: http.MethodGet, path: "/api/occupation/ics"},
+			want:   want{statusCode: http.StatusNotFound, bodyNotContains: []string{"BEGIN:VCALENDAR"}},
+		},
+		{
+			name:   "hides the jobs",
+			params: params{readOnly: true, cookie: shareToken, method: http.MethodGet, path: "/api/jobs", accept: "application/json"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "hides the receipt photos",
+			params: params{readOnly: true, cookie: shareToken, method: http.MethodGet, path: "/api/achats/" + string(purchaseID) + "/photos"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "hides the settings export",
+			params: params{readOnly: true, cookie: shareToken, method: http.MethodGet, path: "/api/export/settings", accept: "application/json"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "hides the audit log",
+			params: params{readOnly: true, cookie: shareToken, method: http.MethodGet, path: "/api/audit", accept: "application/json"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "hides the photos",
+			params: params{readOnly: true, cookie: shareToken, method: http.MethodGet, path: "/api/marques/" + string(brandID) + "/photos"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "hides the reports",
+			params: params{readOnly: true, cookie: shareToken, method: http.MethodGet, path: "/rapports/2023-2024.html"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "refuses a form",
+			params: params{readOnly: true, cookie: shareToken, method: http.MethodPost, path: "/marques/" + string(brandID) + "/archiver"},
+			want:   want{statusCode: http.StatusForbidden, bodyContains: []string{"Action non autorisée", "Accès en lecture seule"}},
+		},
+		{
+			name:   "refuses an api change",
+			params: params{readOnly: true, cookie: shareToken, method: http.MethodDelete, path: "/api/marques/" + string(brandID), accept: "application/json"},
+			want:   want{statusCode: http.StatusForbidden, bodyContains: []string{errReadOnlyAccess.Error()}},
+		},
+		{
+			name:   "leaves a regular server alone",
+			params: params{method: http.MethodPost, path: "/marques/" + string(brandID) + "/archiver"},
+			want:   want{statusCode: http.StatusSeeOther, replaced: true, location: "/marques?archived=true#marque-" + string(brandID)},
+		},
+		{
+			name:   "exports on a regular server",
+			params: params{method: http.MethodGet, path: "/api/export/json", accept: "application/json"},
+			want:   want{statusCode: http.StatusOK, bodyContains: []string{"Granules"}},
+		},
+		{
+			name:   "no banner on a regular server",
+			params: params{method: http.MethodGet, path: "/stats"},
+			want:   want{statusCode: http.StatusOK, bodyNotContains: []string{"read-only", "Accès en lecture seule"}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: baseData}
+			server := NewServer(store, Config{ReadOnlyAccess: tc.params.readOnly, ShareToken: shareToken})
+
+			req := httptest.NewRequest(tc.params.method, tc.params.path, strings.NewReader(tc.params.body))
+			if tc.params.accept != "" {
+				req.Header.Set("Accept", tc.params.accept)
+			}
+			if tc.params.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: shareCookieName, Value: tc.params.cookie})
+			}
+			rec := httptest.NewRecorder()
+
+			server.Handler().ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.replaced, store.replaced, tc.name)
+			assert.Equal(t, tc.want.location, rec.Header().Get("Location"), tc.name)
+			var shareCookie string
+			for _, cookie := range rec.Result().Cookies() {
+				if cookie.Name == shareCookieName {
+					shareCookie = cookie.Value
+				}
+			}
+			assert.Equal(t, tc.want.shareCookie, shareCookie, tc.name)
+			for _, expected := range tc.want.bodyContains {
+				assert.Contains(t, rec.Body.String(), expected, tc.name)
+			}
+			for _, unexpected := range tc.want.bodyNotContains {
+				assert.NotContains(t, rec.Body.String(), unexpected, tc.name)
+			}
+		})
+	}
+}
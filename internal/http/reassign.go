@@ -0,0 +1,79 @@
+package http
+
+import (
+	"log"
+	"net/http"
+
+	"pellets-tracker/internal/core"
+)
+
+// brandMovePayload names the brand of PUT /api/achats/{id}/marque and
+// /api/consommations/{id}/marque.
+type brandMovePayload struct {
+	BrandID core.ID `json:"brand_id"`
+	// Revision is the revision of the entry the move is based on; the move
+	// is rejected with a 409 when it changed since.
+	Revision *int64 `json:"revision"`
+}
+
+func (s *Server) movePurchaseToBrand(w http.ResponseWriter, r *http.Request, id core.ID) {
+	var payload brandMovePayload
+	if err := decodeJSON(r.Body, &payload); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var from core.ID
+	var purchase core.Purchase
+	err := s.update(func(ds *core.DataStore) error {
+		from = brandOfPurchase(ds.Purchases, id)
+		var err error
+		purchase, err = core.MovePurchaseToBrand(ds, id, core.MoveToBrandParams{BrandID: payload.BrandID, ExpectedRevision: payload.Revision})
+		return err
+	})
+	if err != nil {
+		s.handleUpdateError(w, err)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"purchase","id":"%s","action":"reassign","from":"%s","to":"%s"}`, purchase.ID, from, purchase.BrandID)
+	s.writeJSON(w, http.StatusOK, purchase)
+}
+
+func (s *Server) moveConsumptionToBrand(w http.ResponseWriter, r *http.Request, id core.ID) {
+	var payload brandMovePayload
+	if err := decodeJSON(r.Body, &payload); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var from core.ID
+	var consumption core.Consumption
+	err := s.update(func(ds *core.DataStore) error {
+		from = brandOfConsumption(ds.Consumptions, id)
+		var err error
+		consumption, err = core.MoveConsumptionToBrand(ds, id, core.MoveToBrandParams{BrandID: payload.BrandID, ExpectedRevision: payload.Revision})
+		return err
+	})
+	if err != nil {
+		s.handleUpdateError(w, err)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"consumption","id":"%s","action":"reassign","from":"%s","to":"%s"}`, consumption.ID, from, consumption.BrandID)
+	s.writeJSON(w, http.StatusOK, consumption)
+}
+
+func brandOfPurchase(purchases []core.Purchase, id core.ID) core.ID {
+	for _, purchase := range purchases {
+		if purchase.ID == id {
+			return purchase.BrandID
+		}
+	}
+	return ""
+}
+
+func brandOfConsumption(consumptions []core.Consumption, id core.ID) core.ID {
+	for _, consumption := range consumptions {
+		if consumption.ID == id {
+			return consumption.BrandID
+		}
+	}
+	return ""
+}
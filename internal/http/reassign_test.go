@@ -0,0 +1,141 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_moveToBrand(t *testing.T) {
+	t.Parallel()
+
+	granules := core.NewID()
+	woodstock := core.NewID()
+	purchase := func(brandID core.ID, day, bags int) core.Purchase {
+		return core.Purchase{
+			Meta:            core.Meta{ID: core.NewID(), Revision: 1},
+			BrandID:         brandID,
+			PurchasedAt:     time.Date(2024, time.January, day, 0, 0, 0, 0, time.UTC),
+			Bags:            bags,
+			BagWeightKg:     15,
+			TotalWeightKg:   float64(15 * bags),
+			UnitPriceCents:  500,
+			TotalPriceCents: core.Money(500).MulInt(bags),
+		}
+	}
+	consumption := func(bags int) core.Consumption {
+		return core.Consumption{
+			Meta:       core.Meta{ID: core.NewID()},
+			BrandID:    granules,
+			ConsumedAt: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+			Bags:       bags,
+		}
+	}
+	baseData := core.DataStore{
+		Brands: []core.Brand{
+			{Meta: core.Meta{ID: granules}, Name: "Granules"},
+			{Meta: core.Meta{ID: woodstock}, Name: "Woodstock"},
+		},
+		Purchases:    []core.Purchase{purchase(granules, 20, 3), purchase(granules, 10, 5), purchase(woodstock, 5, 2)},
+		Consumptions: []core.Consumption{consumption(3), consumption(1)},
+	}
+	purchaseID := baseData.Purchases[0].ID
+	largeID := baseData.Consumptions[0].ID
+	smallID := baseData.Consumptions[1].ID
+
+	type params struct {
+		method string
+		path   string
+		body   string
+	}
+	type want struct {
+		statusCode int
+		replaced   bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "moves a purchase",
+			params: params{method: http.MethodPut, path: "/api/achats/" + string(purchaseID) + "/marque", body: `{"brand_id":"` + string(woodstock) + `","revision":1}`},
+			want:   want{statusCode: http.StatusOK, replaced: true},
+		},
+		{
+			name:   "moves a consumption",
+			params: params{method: http.MethodPut, path: "/api/consommations/" + string(smallID) + "/marque", body: `{"brand_id":"` + string(woodstock) + `"}`},
+			want:   want{statusCode: http.StatusOK, replaced: true},
+		},
+		{
+			name:   "rejects a consumption the brand has no bags for",
+			params: params{method: http.MethodPut, path: "/api/consommations/" + string(largeID) + "/marque", body: `{"brand_id":"` + string(woodstock) + `"}`},
+			want:   want{statusCode: http.StatusConflict},
+		},
+		{
+			name:   "rejects a stale revision",
+			params: params{method: http.MethodPut, path: "/api/achats/" + string(purchaseID) + "/marque", body: `{"brand_id":"` + string(woodstock) + `","revision":0}`},
+			want:   want{statusCode: http.StatusConflict},
+		},
+		{
+			name:   "rejects an unknown brand",
+			params: params{method: http.MethodPut, path: "/api/achats/" + string(purchaseID) + "/marque", body: `{"brand_id":"missing"}`},
+			want:   want{statusCode: http.StatusBadRequest},
+		},
+		{
+			name:   "rejects invalid json",
+			params: params{method: http.MethodPut, path: "/api/achats/" + string(purchaseID) + "/marque", body: `{`},
+			want:   want{statusCode: http.StatusBadRequest},
+		},
+		{
+			name:   "unknown purchase",
+			params: params{method: http.MethodPut, path: "/api/achats/missing/marque", body: `{"brand_id":"` + string(woodstock) + `"}`},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "rejects other methods",
+			params: params{method: http.MethodGet, path: "/api/consommations/" + string(smallID) + "/marque"},
+			want:   want{statusCode: http.StatusMethodNotAllowed},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: baseData}
+			server := NewServer(store, Config{})
+
+			req := httptest.NewRequest(tc.params.method, tc.params.path, strings.NewReader(tc.params.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.replaced, store.replaced, tc.name)
+			if !tc.want.replaced {
+				return
+			}
+			var moved struct {
+				ID      core.ID `json:"id"`
+				BrandID core.ID `json:"brand_id"`
+			}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &moved), tc.name)
+			assert.Equal(t, woodstock, moved.BrandID, tc.name)
+			require.Len(t, store.replacedWith.Audit, 1, tc.name)
+			assert.Equal(t, core.AuditActionReassign, store.replacedWith.Audit[0].Action, tc.name)
+			assert.Equal(t, moved.ID, store.replacedWith.Audit[0].EntityID, tc.name)
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/ocr"
+)
+
+// maxReceiptBytes bounds the photo of a delivery receipt, phones taking
+// pictures of several megabytes.
+const maxReceiptBytes = 16 << 20
+
+// ReceiptReader extracts the purchase fields from the photo of a delivery
+// receipt, see ocr.Reader.
+type ReceiptReader interface {
+	ReadReceipt(ctx context.Context, image []byte) (ocr.Receipt, error)
+}
+
+// handleReceiptAPI reads the delivery receipt sent as the request body, or
+// as the photo field of a multipart form, and answers the fields found
+// without recording anything. It answers 404 when no OCR engine is set.
+func (s *Server) handleReceiptAPI(w http.ResponseWriter, r *http.Request) {
+	if s.receipts == nil {
+		s.notFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	image, err := receiptPhoto(w, r)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			s.writeError(w, http.StatusRequestEntityTooLarge, errors.New("photo too large"))
+			return
+		}
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	receipt, err := s.receipts.ReadReceipt(r.Context(), image)
+	if err != nil {
+		if errors.Is(err, ocr.ErrNoText) {
+			s.writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		log.Printf("read receipt: %v", err)
+		s.writeError(w, http.StatusBadGateway, errors.New("ocr engine failed"))
+		return
+	}
+	s.writeJSON(w, http.StatusOK, receipt)
+}
+
+// handleReceiptPage reads the receipt uploaded from the purchases page and
+// shows the purchase form pre-filled with what was found, to be checked and
+// submitted as usual.
+func (s *Server) handleReceiptPage(w http.ResponseWriter, r *http.Request) {
+	if s.receipts == nil {
+		s.notFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	image, err := receiptPhoto(w, r)
+	if err != nil {
+		message := "Photo du bon de livraison invalide"
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			message = "Photo trop volumineuse"
+		}
+		s.renderHomePage(w, r, http.StatusBadRequest, &flashMessage{Kind: "error", Message: message}, formState{})
+		return
+	}
+	receipt, err := s.receipts.ReadReceipt(r.Context(), image)
+	if err != nil {
+		message := "Aucun texte lu sur la photo, saisissez l'achat à la main"
+		if !errors.Is(err, ocr.ErrNoText) {
+			log.Printf("read receipt: %v", err)
+			message = "La lecture du bon de livraison a échoué, saisissez l'achat à la main"
+		}
+		s.renderHomePage(w, r, http.StatusOK, &flashMessage{Kind: "error", Message: message}, formState{})
+		return
+	}
+	ds := s.store.Data()
+	flash := &flashMessage{Kind: "warning", Message: "Formulaire pré-rempli d'après le bon de livraison : vérifiez les valeurs avant d'enregistrer"}
+	s.renderHomePage(w, r, http.StatusOK, flash, receiptFormState(receipt, ds.Brands))
+}
+
+// receiptPhoto reads the photo field of a multipart form or, for any other
+// content type, the whole body.
+func receiptPhoto(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxReceiptBytes)
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		image, err := io.ReadAll(r.Body)
+		if err == nil && len(image) == 0 {
+			err = errors.New("empty photo")
+		}
+		return image, err
+	}
+	file, _, err := r.FormFile("photo")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// receiptFormState fills the purchase form, or the bulk delivery form, with
+// the fields read on receipt. The brand is picked when its name appears on
+// the receipt.
+func receiptFormState(receipt ocr.Receipt, brands []core.Brand) formState {
+	values := map[string]string{}
+	if receipt.PurchasedAt != nil {
+		values["purchased_at"] = receipt.PurchasedAt.Format("2006-01-02")
+	}
+	text := strings.ToLower(receipt.Text)
+	for _, brand := range brands {
+		if name := strings.ToLower(strings.TrimSpace(brand.Name)); name != "" && strings.Contains(text, name) {
+			values["brand_id"] = string(brand.ID)
+			break
+		}
+	}
+	if receipt.Bulk() {
+		values["kind"] = purchaseKindBulk
+		values["weight_kg"] = formInputNumber(receipt.WeightKg)
+		if receipt.PricePerTonne > 0 {
+			values["price_per_tonne_eur"] = formInputMoney(receipt.PricePerTonne)
+		}
+		return formState{Values: values}
+	}
+	if receipt.Bags > 0 {
+		values["bags"] = itoaInt(receipt.Bags)
+	}
+	if receipt.BagWeightKg > 0 {
+		values["bag_weight_kg"] = formInputNumber(receipt.BagWeightKg)
+	}
+	if receipt.UnitPrice > 0 {
+		values["unit_price_eur"] = formInputMoney(receipt.UnitPrice)
+	}
+	return formState{Values: values}
+}
@@ -0,0 +1,186 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/ocr"
+)
+
+// stubReceiptReader reads every photo as receipt, or fails with err.
+type stubReceiptReader struct {
+	receipt ocr.Receipt
+	err     error
+}
+
+func (s stubReceiptReader) ReadReceipt(context.Context, []byte) (ocr.Receipt, error) {
+	return s.receipt, s.err
+}
+
+func TestServer_handleReceiptAPI(t *testing.T) {
+	t.Parallel()
+
+	delivered := time.Date(2024, time.September, 5, 0, 0, 0, 0, time.UTC)
+	receipt := ocr.Receipt{Text: "66 sacs de 15 kg", PurchasedAt: &delivered, Bags: 66, BagWeightKg: 15, UnitPrice: 549}
+
+	type params struct {
+		reader ReceiptReader
+		method string
+		body   string
+	}
+	type want struct {
+		statusCode int
+		bags       int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "answers the fields read on the photo",
+			params: params{reader: stubReceiptReader{receipt: receipt}, method: http.MethodPost, body: "photo"},
+			want:   want{statusCode: http.StatusOK, bags: 66},
+		},
+		{
+			name:   "rejects an empty photo",
+			params: params{reader: stubReceiptReader{receipt: receipt}, method: http.MethodPost},
+			want:   want{statusCode: http.StatusBadRequest},
+		},
+		{
+			name:   "reports a photo without text",
+			params: params{reader: stubReceiptReader{err: ocr.ErrNoText}, method: http.MethodPost, body: "photo"},
+			want:   want{statusCode: http.StatusUnprocessableEntity},
+		},
+		{
+			name:   "reports engine failures",
+			params: params{reader: stubReceiptReader{err: errors.New("tesseract: not found")}, method: http.MethodPost, body: "photo"},
+			want:   want{statusCode: http.StatusBadGateway},
+		},
+		{
+			name:   "is disabled without reader",
+			params: params{method: http.MethodPost, body: "photo"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "rejects other methods",
+			params: params{reader: stubReceiptReader{receipt: receipt}, method: http.MethodGet},
+			want:   want{statusCode: http.StatusMethodNotAllowed},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{}
+			server := NewServer(store, Config{Receipts: tc.params.reader})
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, httptest.NewRequest(tc.params.method, "/api/achats/ocr", strings.NewReader(tc.params.body)))
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.False(t, store.replaced, tc.name)
+			if tc.want.statusCode != http.StatusOK {
+				return
+			}
+			var got ocr.Receipt
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got), tc.name)
+			assert.Equal(t, tc.want.bags, got.Bags, tc.name)
+		})
+	}
+}
+
+func TestServer_handleReceiptPage(t *testing.T) {
+	t.Parallel()
+
+	delivered := time.Date(2024, time.March, 18, 0, 0, 0, 0, time.UTC)
+	data := core.DataStore{Brands: []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}}}
+
+	type params struct {
+		reader ReceiptReader
+	}
+	type want struct {
+		statusCode int
+		contains   []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "pre-fills the purchase form",
+			params: params{reader: stubReceiptReader{receipt: ocr.Receipt{
+				Text: "Granulés WOODSTOCK", PurchasedAt: &delivered, Bags: 66, BagWeightKg: 15, UnitPrice: 549,
+			}}},
+			want: want{statusCode: http.StatusOK, contains: []string{
+				"vérifiez les valeurs avant d&#39;enregistrer",
+				`name="bags" value="66"`,
+				`name="bag_weight_kg" value="15"`,
+				`name="unit_price_eur" value="5,49"`,
+				`value="2024-03-18"`,
+				`value="brand-w" selected`,
+			}},
+		},
+		{
+			name: "pre-fills the bulk delivery form",
+			params: params{reader: stubReceiptReader{receipt: ocr.Receipt{
+				Text: "Vrac", WeightKg: 3000, PricePerTonne: 39000,
+			}}},
+			want: want{statusCode: http.StatusOK, contains: []string{
+				`name="weight_kg" value="3000"`,
+				`name="price_per_tonne_eur" value="390,00"`,
+			}},
+		},
+		{
+			name:   "asks for a manual entry when nothing is read",
+			params: params{reader: stubReceiptReader{err: ocr.ErrNoText}},
+			want:   want{statusCode: http.StatusOK, contains: []string{"saisissez l&#39;achat à la main"}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var body bytes.Buffer
+			form := multipart.NewWriter(&body)
+			part, err := form.CreateFormFile("photo", "bon.jpg")
+			require.NoError(t, err, tc.name)
+			_, err = part.Write([]byte("photo"))
+			require.NoError(t, err, tc.name)
+			require.NoError(t, form.Close(), tc.name)
+
+			store := &stubDataStore{data: data}
+			server := NewServer(store, Config{Receipts: tc.params.reader})
+			req := httptest.NewRequest(http.MethodPost, "/achats/ocr", &body)
+			req.Header.Set("Content-Type", form.FormDataContentType())
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			for _, fragment := range tc.want.contains {
+				assert.Contains(t, rec.Body.String(), fragment, tc.name)
+			}
+			assert.False(t, store.replaced, tc.name)
+		})
+	}
+}
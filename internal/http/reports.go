@@ -0,0 +1,213 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/mail"
+)
+
+// seasonReportName matches the files written by WriteSeasonReport, the
+// label of the season captured.
+var seasonReportName = regexp.MustCompile(`^pellets-saison-(\d{4}-\d{4})\.pdf$`)
+
+// reportsView lists the season reports archived, most recent season first.
+type reportsView struct {
+	Reports []reportFile
+}
+
+type reportFile struct {
+	Name      string
+	Label     string
+	WrittenAt time.Time
+	SizeKB    int64
+}
+
+// seasonReportFile names the PDF report of the season labelled label.
+func seasonReportFile(label string) string {
+	return "pellets-saison-" + label + ".pdf"
+}
+
+// handleReportsPage lists the season reports archived in the report dir.
+func (s *Server) handleReportsPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	reports, err := s.seasonReports()
+	if err != nil {
+		log.Printf("list season reports: %v", err)
+		s.renderErrorPage(w, http.StatusInternalServerError)
+		return
+	}
+	s.renderPage(w, http.StatusOK, "reports", "Rapports", "seasons", reportsView{Reports: reports}, nil)
+}
+
+// handleReportFile serves /rapports/{file}, a report listed by
+// handleReportsPage.
+func (s *Server) handleReportFile(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/rapports/")
+	if s.reportDir == "" || !seasonReportName.MatchString(name) {
+		s.notFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	file, err := os.Open(filepath.Join(s.reportDir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		s.notFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("open season report %s: %v", name, err)
+		s.renderErrorPage(w, http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		log.Printf("open season report %s: %v", name, err)
+		s.renderErrorPage(w, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	// The report of the current season is replaced until the season ends.
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
+
+// seasonReports lists the reports of the report dir, none when it does not
+// exist yet.
+func (s *Server) seasonReports() ([]reportFile, error) {
+	reports := []reportFile{}
+	if s.reportDir == "" {
+		return reports, nil
+	}
+	entries, err := os.ReadDir(s.reportDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return reports, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		match := seasonReportName.FindStringSubmatch(entry.Name())
+		if match == nil || !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, reportFile{
+			Name:      entry.Name(),
+			Label:     match[1],
+			WrittenAt: info.ModTime(),
+			SizeKB:    (info.Size() + 1023) / 1024,
+		})
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Label > reports[j].Label })
+	return reports, nil
+}
+
+// WriteSeasonReport writes the PDF report of the season starting in
+// startYear to the report dir, the document of the season export, and
+// returns its path. The report of a season is replaced until the season
+// ends; nothing is written for a season without purchase nor consumption.
+func (s *Server) WriteSeasonReport(ctx context.Context, startYear int) (string, error) {
+	if s.reportDir == "" {
+		return "", errors.New("no report dir")
+	}
+	ds := s.store.Data()
+	report, err := core.ComputeRapportSaison(ctx, &ds, startYear)
+	if errors.Is(err, core.ErrSeasonNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if _, err := renderSeasonReport(report, time.Now().UTC()).WriteTo(&buf); err != nil {
+		return "", fmt.Errorf("render season report: %w", err)
+	}
+	if err := os.MkdirAll(s.reportDir, 0o755); err != nil {
+		return "", fmt.Errorf("ensure report dir: %w", err)
+	}
+	path := filepath.Join(s.reportDir, seasonReportFile(report.Label))
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		return "", fmt.Errorf("write season report: %w", err)
+	}
+	return path, nil
+}
+
+// SeasonReportEmail builds the email presenting the season starting in
+// startYear once it ended: its spend, consumption and cost of energy
+// compared with the earlier seasons, the PDF written by WriteSeasonReport
+// attached.
+func (s *Server) SeasonReportEmail(ctx context.Context, startYear int) (mail.Message, error) {
+	ds := s.store.Data()
+	report, err := core.ComputeRapportSaison(ctx, &ds, startYear)
+	if err != nil {
+		return mail.Message{}, err
+	}
+	name := seasonReportFile(report.Label)
+	attachment, err := os.ReadFile(filepath.Join(s.reportDir, name))
+	if err != nil {
+		return mail.Message{}, fmt.Errorf("read season report: %w", err)
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "Bonjour,\n\nLa saison de chauffe %s est terminée, voici son bilan.\n\n", report.Label)
+	fmt.Fprintf(&text, "Dépense : %s pour %s\n", core.FormatMoney(report.Spent), plural(report.BagsBought, "sac acheté", "sacs achetés"))
+	fmt.Fprintf(&text, "Consommation : %s en %s de chauffe\n", plural(report.BagsConsumed, "sac brûlé", "sacs brûlés"), plural(report.HeatingDays, "jour", "jours"))
+	fmt.Fprintf(&text, "Coût consommé : %s, soit %s par sac\n", core.FormatMoney(report.ConsumedValue), core.FormatMoney(report.AverageBagCost))
+	if report.EnergyKWh > 0 {
+		fmt.Fprintf(&text, "Énergie : %s estimés, soit %s\n", formatKWh(report.EnergyKWh), formatKWhPrice(report.CostPerMWh))
+	}
+
+	if len(report.Previous) == 0 {
+		text.WriteString("\nAucune saison précédente à comparer.\n")
+	} else {
+		fmt.Fprintf(&text, "\nPar rapport aux saisons précédentes (évolution de la saison %s entre parenthèses) :\n", report.Label)
+		for _, previous := range report.Previous {
+			figures := []string{
+				withChange(plural(previous.BagsConsumed, "sac", "sacs"), previous.BagsChangePercent),
+				withChange(core.FormatMoney(previous.ConsumedValue)+" consommés", previous.ConsumedValueChangePercent),
+				withChange(core.FormatMoney(previous.AverageBagCost)+" par sac", previous.AverageBagCostChangePercent),
+			}
+			if previous.CostPerMWh > 0 {
+				figures = append(figures, withChange(formatKWhPrice(previous.CostPerMWh), previous.CostPerMWhChangePercent))
+			}
+			figures = append(figures, withChange(core.FormatMoney(previous.Spent)+" dépensés", previous.SpentChangePercent))
+			fmt.Fprintf(&text, "- %s : %s\n", previous.Label, strings.Join(figures, ", "))
+		}
+	}
+	text.WriteString("\nLe rapport PDF est joint et reste consultable sur la page Rapports (/rapports).\n")
+
+	return mail.Message{
+		Subject:     "Bilan de la saison de chauffe " + report.Label,
+		Text:        text.String(),
+		Attachments: []mail.Attachment{{Name: name, ContentType: "application/pdf", Data: attachment}},
+	}, nil
+}
+
+// withChange follows value with the percent change, if any.
+func withChange(value string, percent *float64) string {
+	if percent == nil {
+		return value
+	}
+	return value + " (" + formatPercentChange(percent) + ")"
+}
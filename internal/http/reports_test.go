@@ -0,0 +1,262 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+// reportsDataStore holds the seasons 2024-2025 and 2025-2026.
+func reportsDataStore() core.DataStore {
+	return core.DataStore{
+		Brands: []core.Brand{{Meta: core.Meta{ID: "brand"}, Name: "Woodstock"}},
+		Purchases: []core.Purchase{
+			{Meta: core.Meta{ID: "p1"}, BrandID: "brand", PurchasedAt: time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC), Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 600, TotalPriceCents: 6000},
+			{Meta: core.Meta{ID: "p2"}, BrandID: "brand", PurchasedAt: time.Date(2025, time.September, 1, 0, 0, 0, 0, time.UTC), Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 650, TotalPriceCents: 6500},
+		},
+		Consumptions: []core.Consumption{
+			{Meta: core.Meta{ID: "c1"}, BrandID: "brand", ConsumedAt: time.Date(2024, time.November, 10, 0, 0, 0, 0, time.UTC), Bags: 4},
+			{Meta: core.Meta{ID: "c2"}, BrandID: "brand", ConsumedAt: time.Date(2025, time.November, 10, 0, 0, 0, 0, time.UTC), Bags: 5},
+		},
+	}
+}
+
+func TestServer_WriteSeasonReport(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		startYear int
+	}
+	type want struct {
+		file string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "writes the report of a season", params: params{startYear: 2025}, want: want{file: "pellets-saison-2025-2026.pdf"}},
+		{name: "writes nothing for an empty season", params: params{startYear: 2020}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := filepath.Join(t.TempDir(), "reports")
+			server := NewServer(&stubDataStore{data: reportsDataStore()}, Config{ReportDir: dir})
+
+			path, err := server.WriteSeasonReport(context.Background(), tc.params.startYear)
+
+			require.NoError(t, err, tc.name)
+			if tc.want.file == "" {
+				assert.Empty(t, path, tc.name)
+				return
+			}
+			assert.Equal(t, filepath.Join(dir, tc.want.file), path, tc.name)
+			content, err := os.ReadFile(path)
+			require.NoError(t, err, tc.name)
+			assert.Contains(t, string(content), "%PDF-1.4", tc.name)
+		})
+	}
+}
+
+func TestServer_SeasonReportEmail(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		startYear int
+		// archived writes the PDF of the season before building the email.
+		archived bool
+	}
+	type want struct {
+		subject    string
+		text       string
+		attachment string
+		expectErr  bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "compares the season with the earlier ones",
+			params: params{startYear: 2025, archived: true},
+			want: want{
+				subject: "Bilan de la saison de chauffe 2025-2026",
+				text: `Bonjour,
+
+La saison de chauffe 2025-2026 est terminée, voici son bilan.
+
+Dépense : 65,00 € pour 10 sacs achetés
+Consommation : 5 sacs brûlés en 1 jour de chauffe
+Coût consommé : 30,00 €, soit 6,00 € par sac
+Énergie : 360 kWh estimés, soit 0,083 €/kWh
+
+Par rapport aux saisons précédentes (évolution de la saison 2025-2026 entre parenthèses) :
+- 2024-2025 : 4 sacs (+25,0 %), 24,00 € consommés (+25,0 %), 6,00 € par sac (+0,0 %), 0,083 €/kWh (+0,0 %), 60,00 € dépensés (+8,3 %)
+
+Le rapport PDF est joint et reste consultable sur la page Rapports (/rapports).
+`,
+				attachment: "pellets-saison-2025-2026.pdf",
+			},
+		},
+		{
+			name:   "presents the first season alone",
+			params: params{startYear: 2024, archived: true},
+			want: want{
+				subject: "Bilan de la saison de chauffe 2024-2025",
+				text: `Bonjour,
+
+La saison de chauffe 2024-2025 est terminée, voici son bilan.
+
+Dépense : 60,00 € pour 10 sacs achetés
+Consommation : 4 sacs brûlés en 1 jour de chauffe
+Coût consommé : 24,00 €, soit 6,00 € par sac
+Énergie : 288 kWh estimés, soit 0,083 €/kWh
+
+Aucune saison précédente à comparer.
+
+Le rapport PDF est joint et reste consultable sur la page Rapports (/rapports).
+`,
+				attachment: "pellets-saison-2024-2025.pdf",
+			},
+		},
+		{
+			name:   "fails without the archived report",
+			params: params{startYear: 2025},
+			want:   want{expectErr: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{data: reportsDataStore()}, Config{ReportDir: t.TempDir()})
+			if tc.params.archived {
+				_, err := server.WriteSeasonReport(context.Background(), tc.params.startYear)
+				require.NoError(t, err, tc.name)
+			}
+
+			message, err := server.SeasonReportEmail(context.Background(), tc.params.startYear)
+
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.subject, message.Subject, tc.name)
+			assert.Equal(t, tc.want.text, message.Text, tc.name)
+			require.Len(t, message.Attachments, 1, tc.name)
+			assert.Equal(t, tc.want.attachment, message.Attachments[0].Name, tc.name)
+			assert.Contains(t, string(message.Attachments[0].Data), "%PDF-1.4", tc.name)
+		})
+	}
+}
+
+func TestServer_handleReports(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pellets-saison-2024-2025.pdf"), []byte("%PDF-1.4 2024"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pellets-saison-2025-2026.pdf"), []byte("%PDF-1.4 2025"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0o644))
+
+	type params struct {
+		method    string
+		path      string
+		reportDir string
+	}
+	type want struct {
+		statusCode  int
+		contains    []string
+		notContains []string
+		// ordered expects contains in that order.
+		ordered bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "lists the reports, most recent season first",
+			params: params{method: http.MethodGet, path: "/rapports", reportDir: dir},
+			want: want{
+				statusCode:  http.StatusOK,
+				contains:    []string{`href="/rapports/pellets-saison-2025-2026.pdf"`, `href="/rapports/pellets-saison-2024-2025.pdf"`},
+				notContains: []string{"notes.txt"},
+				ordered:     true,
+			},
+		},
+		{
+			name:   "lists no report without report dir",
+			params: params{method: http.MethodGet, path: "/rapports"},
+			want:   want{statusCode: http.StatusOK, contains: []string{"Aucun rapport archivé"}},
+		},
+		{
+			name:   "serves a report",
+			params: params{method: http.MethodGet, path: "/rapports/pellets-saison-2024-2025.pdf", reportDir: dir},
+			want:   want{statusCode: http.StatusOK, contains: []string{"%PDF-1.4 2024"}},
+		},
+		{
+			name:   "does not serve the other files",
+			params: params{method: http.MethodGet, path: "/rapports/notes.txt", reportDir: dir},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "does not serve a missing report",
+			params: params{method: http.MethodGet, path: "/rapports/pellets-saison-2020-2021.pdf", reportDir: dir},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "is read-only",
+			params: params{method: http.MethodPost, path: "/rapports/pellets-saison-2024-2025.pdf", reportDir: dir},
+			want:   want{statusCode: http.StatusMethodNotAllowed},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{}, Config{ReportDir: tc.params.reportDir})
+			req := httptest.NewRequest(tc.params.method, tc.params.path, nil)
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			body := rec.Body.String()
+			last := -1
+			for _, fragment := range tc.want.contains {
+				assert.Contains(t, body, fragment, tc.name)
+				if tc.want.ordered {
+					assert.Greater(t, strings.Index(body, fragment), last, tc.name)
+					last = strings.Index(body, fragment)
+				}
+			}
+			for _, fragment := range tc.want.notContains {
+				assert.NotContains(t, body, fragment, tc.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/store"
+)
+
+func TestServer_updateRevision(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		method string
+		path   string
+		body   string
+		// concurrent, when set, sends that many copies of the request at
+		// once to a server saving to a JSON store.
+		concurrent int
+	}
+	type want struct {
+		statusCode   int
+		bodyContains string
+		replaced     bool
+		// conflicts counts the concurrent requests rejected, the others
+		// answering statusCode.
+		conflicts int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "updates a purchase without revision",
+			params: params{method: http.MethodPut, path: "/api/achats/p1", body: `{"bags":12,"bag_weight_kg":15,"unit_price_cents":549}`},
+			want:   want{statusCode: http.StatusOK, bodyContains: `"revision":1`, replaced: true},
+		},
+		{
+			name:   "updates the current revision of a purchase",
+			params: params{method: http.MethodPut, path: "/api/achats/p1", body: `{"bags":12,"bag_weight_kg":15,"unit_price_cents":549,"revision":0}`},
+			want:   want{statusCode: http.StatusOK, bodyContains: `"revision":1`, replaced: true},
+		},
+		{
+			name:   "rejects a stale purchase",
+			params: params{method: http.MethodPut, path: "/api/achats/p1", body: `{"bags":12,"bag_weight_kg":15,"unit_price_cents":549,"revision":2}`},
+			want:   want{statusCode: http.StatusConflict, bodyContains: `"conflict":{"entity":"purchase","id":"p1","expected_revision":2,"current_revision":0,`},
+		},
+		{
+			name:   "rejects a stale consumption",
+			params: params{method: http.MethodPut, path: "/api/consommations/c1", body: `{"consumed_at":"2024-10-01T00:00:00Z","bags":3,"revision":1}`},
+			want:   want{statusCode: http.StatusConflict, bodyContains: `"conflict":{"entity":"consumption","id":"c1","expected_revision":1,"current_revision":0,`},
+		},
+		{
+			name:   "rejects a stale brand in a batch",
+			params: params{method: http.MethodPost, path: "/api/batch", body: `{"operations":[{"op":"update_brand","id":"brand-w","data":{"min_stock_bags":3,"revision":4}}]}`},
+			want:   want{statusCode: http.StatusConflict, bodyContains: "entry was modified since it was read"},
+		},
+		{
+			name:   "accepts a single one of concurrent updates of a revision",
+			params: params{method: http.MethodPut, path: "/api/achats/p1", body: `{"bags":12,"bag_weight_kg":15,"unit_price_cents":549,"revision":0}`, concurrent: 16},
+			want:   want{statusCode: http.StatusOK, conflicts: 15},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.params.concurrent > 0 {
+				dir := t.TempDir()
+				jsonStore, err := store.NewJSONStore(filepath.Join(dir, "pellets.json"), dir, store.FormatCompact)
+				require.NoError(t, err, tc.name)
+				require.NoError(t, jsonStore.Replace(editPagesDataStore()), tc.name)
+				server := NewServer(slowReadStore{jsonStore}, Config{})
+
+				codes := make([]int, tc.params.concurrent)
+				start := make(chan struct{})
+				var wg sync.WaitGroup
+				for i := range codes {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						req := httptest.NewRequest(tc.params.method, tc.params.path, strings.NewReader(tc.params.body))
+						req.Header.Set("Content-Type", "application/json")
+						rec := httptest.NewRecorder()
+						<-start
+						server.mux.ServeHTTP(rec, req)
+						codes[i] = rec.Code
+					}()
+				}
+				close(start)
+				wg.Wait()
+
+				want := make(map[int]int)
+				want[tc.want.statusCode] = tc.params.concurrent - tc.want.conflicts
+				want[http.StatusConflict] += tc.want.conflicts
+				got := make(map[int]int)
+				for _, code := range codes {
+					got[code]++
+				}
+				assert.Equal(t, want, got, tc.name)
+				assert.Equal(t, int64(1), jsonStore.Data().Purchases[0].Revision, tc.name)
+				return
+			}
+
+			store := &stubDataStore{data: editPagesDataStore()}
+			server := NewServer(store, Config{})
+			req := httptest.NewRequest(tc.params.method, tc.params.path, strings.NewReader(tc.params.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			require.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Contains(t, rec.Body.String(), tc.want.bodyContains, tc.name)
+			assert.Equal(t, tc.want.replaced, store.replaced, tc.name)
+		})
+	}
+}
+
+// slowReadStore lingers on the reads, so concurrent requests all read the
+// datastore before any of them saves it unless the store serializes them.
+type slowReadStore struct {
+	*store.JSONStore
+}
+
+func (s slowReadStore) Data() core.DataStore {
+	data := s.JSONStore.Data()
+	time.Sleep(5 * time.Millisecond)
+	return data
+}
@@ -0,0 +1,83 @@
+package http
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"pellets-tracker/internal/core"
+)
+
+var errRoleForbidden = errors.New("your role does not allow this change")
+
+// adminPaths are the changes reserved to admins besides the deletions: the
+// imports, which can replace the data, the undo, which removes entries, and
+// the accounts.
+var adminPaths = []string{"/donnees", "/api/import/", "/api/undo", "/api/utilisateurs", "/api/utilisateurs/"}
+
+// accountPaths are the changes every signed-in user may make to its own
+// account.
+var accountPaths = []string{"/api/tokens", "/api/tokens/"}
+
+type rolePayload struct {
+	Role core.Role `json:"role"`
+}
+
+// requiredRole returns the role r needs from userID: viewers read and manage
+// their own account, editors record and edit entries, admins delete, import
+// and manage the other accounts.
+func requiredRole(r *http.Request, userID core.ID) core.Role {
+	path := r.URL.Path
+	switch {
+	case isRead(r), matchesPath(path, accountPaths),
+		r.Method == http.MethodPut && path == "/api/utilisateurs/"+string(userID):
+		return core.RoleViewer
+	case r.Method == http.MethodDelete, strings.HasSuffix(path, "/supprimer"), matchesPath(path, adminPaths):
+		return core.RoleAdmin
+	default:
+		return core.RoleEditor
+	}
+}
+
+// userRole returns the role of a user, read at each request so that a new
+// role applies to the open sessions. Unknown users have none.
+func (s *Server) userRole(id core.ID) core.Role {
+	user, ok := core.FindUser(s.store.Data().Users, id)
+	if !ok {
+		return ""
+	}
+	return user.AccessRole()
+}
+
+func (s *Server) writeRoleForbidden(w http.ResponseWriter, r *http.Request, userID core.ID) {
+	log.Printf(`{"type":"auth","action":"forbidden","user":"%s","method":%q,"path":%q}`, userID, r.Method, r.URL.Path)
+	if wantsJSON(r) {
+		s.writeError(w, http.StatusForbidden, errRoleForbidden)
+		return
+	}
+	s.renderErrorPage(w, http.StatusForbidden)
+}
+
+// updateUserRole changes the role of an account, PUT
+// /api/utilisateurs/{id}/role.
+func (s *Server) updateUserRole(w http.ResponseWriter, r *http.Request, id core.ID) {
+	var payload rolePayload
+	if err := decodeJSON(r.Body, &payload); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ds := s.store.Data()
+	user, err := core.SetUserRole(&ds, id, payload.Role)
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	if err := s.store.Replace(ds); err != nil {
+		s.handleStoreError(w, err)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"user","id":"%s","action":"role","role":%q}`, id, user.Role)
+	s.writeJSON(w, http.StatusOK, newUserView(user))
+}
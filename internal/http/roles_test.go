@@ -0,0 +1,217 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"pellets-tracker/internal/auth"
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_roles(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		// user is the username of the session, none when empty.
+		user         string
+		privateReads bool
+		method       string
+		path         string
+		body         string
+		accept       string
+	}
+	type want struct {
+		statusCode int
+		replaced   bool
+		contains   string
+	}
+
+	const grafanaQueryBody = `{"range":{"from":"2024-01-01T00:00:00Z","to":"2024-02-01T00:00:00Z"},"targets":[{"target":"stock","refId":"A"}]}`
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "viewers read",
+			params: params{user: "viewer", method: http.MethodGet, path: "/api/marques", accept: "application/json"},
+			want:   want{statusCode: http.StatusOK},
+		},
+		{
+			name:   "anonymous clients read while the reads are open",
+			params: params{method: http.MethodGet, path: "/api/marques", accept: "application/json"},
+			want:   want{statusCode: http.StatusOK},
+		},
+		{
+			name:   "viewers read private reads",
+			params: params{user: "viewer", privateReads: true, method: http.MethodGet, path: "/api/marques", accept: "application/json"},
+			want:   want{statusCode: http.StatusOK},
+		},
+		{
+			name:   "anonymous clients cannot read private reads",
+			params: params{privateReads: true, method: http.MethodGet, path: "/api/marques", accept: "application/json"},
+			want:   want{statusCode: http.StatusUnauthorized, contains: errAuthRequired.Error()},
+		},
+		{
+			name:   "anonymous browsers sign in before private reads",
+			params: params{privateReads: true, method: http.MethodGet, path: "/stats"},
+			want:   want{statusCode: http.StatusSeeOther},
+		},
+		{
+			name:   "anonymous clients reach the health check with private reads",
+			params: params{privateReads: true, method: http.MethodGet, path: "/healthz"},
+			want:   want{statusCode: http.StatusOK},
+		},
+		{
+			name:   "anonymous clients cannot create api tokens",
+			params: params{method: http.MethodPost, path: "/api/tokens", body: `{"name":"Grafana"}`, accept: "application/json"},
+			want:   want{statusCode: http.StatusUnauthorized},
+		},
+		{
+			name:   "viewers query grafana",
+			params: params{user: "viewer", privateReads: true, method: http.MethodPost, path: "/api/grafana/query", body: grafanaQueryBody, accept: "application/json"},
+			want:   want{statusCode: http.StatusOK, contains: `"target":"stock"`},
+		},
+		{
+			name:   "viewers list the grafana metrics",
+			params: params{user: "viewer", method: http.MethodPost, path: "/api/grafana/metrics", accept: "application/json"},
+			want:   want{statusCode: http.StatusOK, contains: `"value":"stock"`},
+		},
+		{
+			name:   "viewers search the grafana metrics",
+			params: params{user: "viewer", method: http.MethodPost, path: "/api/grafana/search/", accept: "application/json"},
+			want:   want{statusCode: http.StatusOK, contains: `"stock"`},
+		},
+		{
+			name:   "anonymous clients query grafana while the reads are open",
+			params: params{method: http.MethodPost, path: "/api/grafana/query", body: grafanaQueryBody, accept: "application/json"},
+			want:   want{statusCode: http.StatusOK, contains: `"target":"stock"`},
+		},
+		{
+			name:   "anonymous clients cannot query grafana with private reads",
+			params: params{privateReads: true, method: http.MethodPost, path: "/api/grafana/query", body: grafanaQueryBody, accept: "application/json"},
+			want:   want{statusCode: http.StatusUnauthorized, contains: errAuthRequired.Error()},
+		},
+		{
+			name:   "viewers cannot add entries",
+			params: params{user: "viewer", method: http.MethodPost, path: "/api/marques", body: `{"name":"Woodstock"}`, accept: "application/json"},
+			want:   want{statusCode: http.StatusForbidden, contains: errRoleForbidden.Error()},
+		},
+		{
+			name:   "viewers create their own api tokens",
+			params: params{user: "viewer", method: http.MethodPost, path: "/api/tokens", body: `{"name":"Grafana"}`, accept: "application/json"},
+			want:   want{statusCode: http.StatusCreated, replaced: true},
+		},
+		{
+			name:   "editors add entries",
+			params: params{user: "editor", method: http.MethodPost, path: "/api/marques", body: `{"name":"Woodstock"}`, accept: "application/json"},
+			want:   want{statusCode: http.StatusCreated, replaced: true},
+		},
+		{
+			name:   "editors cannot delete",
+			params: params{user: "editor", method: http.MethodDelete, path: "/api/marques/brand-b", accept: "application/json"},
+			want:   want{statusCode: http.StatusForbidden},
+		},
+		{
+			name:   "editors cannot delete through the forms",
+			params: params{user: "editor", method: http.MethodPost, path: "/achats/purchase-a/supprimer"},
+			want:   want{statusCode: http.StatusForbidden, contains: "Action non autorisée"},
+		},
+		{
+			name:   "editors cannot import",
+			params: params{user: "editor", method: http.MethodPost, path: "/api/import/csv", body: "type,brand_name,timestamp,bags\n", accept: "application/json"},
+			want:   want{statusCode: http.StatusForbidden},
+		},
+		{
+			name:   "editors cannot undo",
+			params: params{user: "editor", method: http.MethodPost, path: "/api/undo", accept: "application/json"},
+			want:   want{statusCode: http.StatusForbidden},
+		},
+		{
+			name:   "editors change their own password",
+			params: params{user: "editor", method: http.MethodPut, path: "/api/utilisateurs/user-e", body: `{"password":"poêle-à-bois"}`, accept: "application/json"},
+			want:   want{statusCode: http.StatusOK, replaced: true},
+		},
+		{
+			name:   "editors cannot change the password of others",
+			params: params{user: "editor", method: http.MethodPut, path: "/api/utilisateurs/user-a", body: `{"password":"poêle-à-bois"}`, accept: "application/json"},
+			want:   want{statusCode: http.StatusForbidden},
+		},
+		{
+			name:   "editors cannot promote themselves",
+			params: params{user: "editor", method: http.MethodPut, path: "/api/utilisateurs/user-e/role", body: `{"role":"admin"}`, accept: "application/json"},
+			want:   want{statusCode: http.StatusForbidden},
+		},
+		{
+			name:   "admins delete",
+			params: params{user: "admin", method: http.MethodDelete, path: "/api/marques/brand-b", accept: "application/json"},
+			want:   want{statusCode: http.StatusNoContent, replaced: true},
+		},
+		{
+			name:   "admins create accounts with a role",
+			params: params{user: "admin", method: http.MethodPost, path: "/api/utilisateurs", body: `{"username":"zoe","password":"poêle-à-bois","role":"viewer"}`, accept: "application/json"},
+			want:   want{statusCode: http.StatusCreated, replaced: true, contains: `"role":"viewer"`},
+		},
+		{
+			name:   "admins change roles",
+			params: params{user: "admin", method: http.MethodPut, path: "/api/utilisateurs/user-v/role", body: `{"role":"editor"}`, accept: "application/json"},
+			want:   want{statusCode: http.StatusOK, replaced: true, contains: `"role":"editor"`},
+		},
+		{
+			name:   "keeps the last admin",
+			params: params{user: "admin", method: http.MethodPut, path: "/api/utilisateurs/user-a/role", body: `{"role":"viewer"}`, accept: "application/json"},
+			want:   want{statusCode: http.StatusConflict},
+		},
+		{
+			name:   "rejects unknown roles",
+			params: params{user: "admin", method: http.MethodPut, path: "/api/utilisateurs/user-v/role", body: `{"role":"owner"}`, accept: "application/json"},
+			want:   want{statusCode: http.StatusBadRequest},
+		},
+	}
+
+	users := []core.User{
+		{Meta: core.Meta{ID: "user-a"}, Username: "admin", Role: core.RoleAdmin},
+		{Meta: core.Meta{ID: "user-e"}, Username: "editor", Role: core.RoleEditor},
+		{Meta: core.Meta{ID: "user-v"}, Username: "viewer", Role: core.RoleViewer},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			manager, err := auth.New(auth.Config{BcryptCost: bcrypt.MinCost})
+			require.NoError(t, err, tc.name)
+			store := &stubDataStore{data: core.DataStore{
+				Brands:    []core.Brand{{Meta: core.Meta{ID: "brand-a"}, Name: "Granules"}, {Meta: core.Meta{ID: "brand-b"}, Name: "Bois Énergie"}},
+				Purchases: []core.Purchase{{Meta: core.Meta{ID: "purchase-a"}, BrandID: "brand-a", Bags: 1, BagWeightKg: 15, TotalWeightKg: 15}},
+				Users:     append([]core.User(nil), users...),
+			}}
+			server := NewServer(store, Config{Auth: manager, PrivateReads: tc.params.privateReads})
+			req := httptest.NewRequest(tc.params.method, tc.params.path, strings.NewReader(tc.params.body))
+			if tc.params.accept != "" {
+				req.Header.Set("Accept", tc.params.accept)
+				req.Header.Set("Content-Type", "application/json")
+			}
+			if user, ok := core.FindUserByName(users, tc.params.user); ok {
+				session, err := manager.Login(user)
+				require.NoError(t, err, tc.name)
+				req.AddCookie(auth.Cookie(session, false))
+			}
+			rec := httptest.NewRecorder()
+
+			server.Handler().ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.replaced, store.replaced, tc.name)
+			assert.Contains(t, rec.Body.String(), tc.want.contains, tc.name)
+		})
+	}
+}
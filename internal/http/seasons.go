@@ -0,0 +1,137 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pellets-tracker/internal/core"
+)
+
+type seasonsView struct {
+	Seasons []core.SeasonSummary
+}
+
+// seasonView is the printable report page of a season.
+type seasonView struct {
+	core.SeasonSummary
+	Months    []seasonMonthPoint
+	Brands    []core.SeasonBrand
+	Purchases []purchaseView
+	Previous  []core.SeasonComparison
+}
+
+// seasonMonthPoint is a bar of the monthly chart of a season, with the value
+// of the bags burnt that month.
+type seasonMonthPoint struct {
+	monthlyPoint
+	ConsumedValue core.Money
+}
+
+// handleSeasonsPage lists the heating seasons, most recent first.
+func (s *Server) handleSeasonsPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	ds := s.store.Data()
+	ctx, cancel := s.computeContext(r)
+	defer cancel()
+	seasons, err := core.ComputeSaisons(ctx, &ds)
+	if err != nil {
+		s.seasonPageError(w, r, err)
+		return
+	}
+	s.renderPage(w, http.StatusOK, "seasons", "Saisons", "seasons", seasonsView{Seasons: seasons}, nil)
+}
+
+// handleSeasonPage serves /saisons/{label}, label being such as 2023-2024.
+func (s *Server) handleSeasonPage(w http.ResponseWriter, r *http.Request) {
+	startYear, ok := core.ParseSeasonLabel(strings.TrimPrefix(r.URL.Path, "/saisons/"))
+	if !ok {
+		s.notFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	ds := s.store.Data()
+	ctx, cancel := s.computeContext(r)
+	defer cancel()
+	report, err := core.ComputeRapportSaison(ctx, &ds, startYear)
+	if err != nil {
+		s.seasonPageError(w, r, err)
+		return
+	}
+	s.renderPage(w, http.StatusOK, "season", "Saison "+report.Label, "seasons", newSeasonView(&ds, report), nil)
+}
+
+// handleSeasonReportAPI serves GET /api/rapports/saison?year=2024, the report
+// of the season starting that year. With download=1 the report is sent as a
+// file attachment.
+func (s *Server) handleSeasonReportAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	query := r.URL.Query()
+	year, err := parseSeasonYear(query.Get("year"))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	ds := s.store.Data()
+	ctx, cancel := s.computeContext(r)
+	defer cancel()
+	report, err := core.ComputeRapportSaison(ctx, &ds, year)
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	if download, _ := strconv.ParseBool(query.Get("download")); download {
+		w.Header().Set("Content-Disposition", "attachment; filename=pellets-saison-"+report.Label+".json")
+	}
+	s.writeJSON(w, http.StatusOK, report)
+}
+
+func (s *Server) seasonPageError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, core.ErrSeasonNotFound):
+		s.notFound(w, r)
+	case errors.Is(err, core.ErrInsufficientInventory):
+		// As on /stats, entries consuming more than was bought are reported
+		// for the user to fix them.
+		s.renderPage(w, http.StatusOK, "seasons", "Saisons", "seasons", seasonsView{}, &flashMessage{Kind: "error", Message: s.friendlyError(err)})
+	case errors.Is(err, context.Canceled):
+		// The client went away, nobody is left to read the page.
+	case errors.Is(err, context.DeadlineExceeded):
+		s.renderErrorPage(w, http.StatusServiceUnavailable)
+	default:
+		log.Printf("compute seasons: %v", err)
+		s.renderErrorPage(w, http.StatusInternalServerError)
+	}
+}
+
+func newSeasonView(ds *core.DataStore, report core.SeasonReport) seasonView {
+	detail := report.SeasonDetail
+	view := seasonView{SeasonSummary: detail.SeasonSummary, Brands: detail.Brands, Previous: report.Previous}
+	maxBags := 0.0
+	for _, month := range detail.Months {
+		maxBags = max(maxBags, month.Bags)
+	}
+	for _, month := range detail.Months {
+		view.Months = append(view.Months, seasonMonthPoint{
+			monthlyPoint:  monthlyPoint{Label: formatMonthLabel(month.Month), Bags: month.Bags, HeightPercent: barHeight(month.Bags, maxBags)},
+			ConsumedValue: month.ConsumedValue,
+		})
+	}
+	lookup := brandLookup(ds.Brands)
+	for _, purchase := range detail.Purchases {
+		view.Purchases = append(view.Purchases, purchaseView{Purchase: purchase, BrandName: lookup[purchase.BrandID]})
+	}
+	return view
+}
@@ -0,0 +1,133 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_seasonPages(t *testing.T) {
+	t.Parallel()
+
+	store := &stubDataStore{data: core.DataStore{
+		Brands: []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}},
+		Purchases: []core.Purchase{
+			{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: time.Date(2023, time.September, 1, 0, 0, 0, 0, time.UTC), Bags: 20, BagWeightKg: 15, TotalWeightKg: 300, UnitPriceCents: 600, TotalPriceCents: 12000},
+		},
+		Consumptions: []core.Consumption{
+			{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC), Bags: 3},
+			{Meta: core.Meta{ID: "c2"}, BrandID: "brand-w", ConsumedAt: time.Date(2024, time.November, 10, 0, 0, 0, 0, time.UTC), Bags: 1},
+		},
+	}}
+
+	type params struct {
+		method string
+		path   string
+		// oversold adds a consumption of more bags than were bought.
+		oversold bool
+	}
+	type want struct {
+		statusCode  int
+		contains    []string
+		disposition string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "lists the seasons",
+			params: params{method: http.MethodGet, path: "/saisons"},
+			want:   want{statusCode: http.StatusOK, contains: []string{`href="/saisons/2023-2024"`, "18,00 €"}},
+		},
+		{
+			name:   "details a season",
+			params: params{method: http.MethodGet, path: "/saisons/2023-2024"},
+			want:   want{statusCode: http.StatusOK, contains: []string{"Saison 2023-2024", "3 sacs", "Woodstock", `data-action="print" hidden`}},
+		},
+		{
+			name:   "compares a season with the earlier ones",
+			params: params{method: http.MethodGet, path: "/saisons/2024-2025"},
+			want:   want{statusCode: http.StatusOK, contains: []string{`<a href="/saisons/2023-2024">2023-2024</a>`, "(-66,7 %)", "/api/rapports/saison?year=2024"}},
+		},
+		{
+			name:   "reports a season as JSON",
+			params: params{method: http.MethodGet, path: "/api/rapports/saison?year=2024"},
+			want:   want{statusCode: http.StatusOK, contains: []string{`"label":"2024-2025"`, `"consumed_value_cents":600`, `"bags_change_percent":-66.7`}},
+		},
+		{
+			name:   "downloads the report",
+			params: params{method: http.MethodGet, path: "/api/rapports/saison?year=2023&download=1"},
+			want:   want{statusCode: http.StatusOK, contains: []string{`"previous":[]`}, disposition: "attachment; filename=pellets-saison-2023-2024.json"},
+		},
+		{
+			name:   "requires the start year of the report",
+			params: params{method: http.MethodGet, path: "/api/rapports/saison?year=2023-2024"},
+			want:   want{statusCode: http.StatusBadRequest},
+		},
+		{
+			name:   "reports a missing report",
+			params: params{method: http.MethodGet, path: "/api/rapports/saison?year=2020"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "reports seasons without data",
+			params: params{method: http.MethodGet, path: "/saisons/2020-2021"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "rejects malformed labels",
+			params: params{method: http.MethodGet, path: "/saisons/2023"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "reports the seasons of oversold stock",
+			params: params{method: http.MethodGet, path: "/saisons", oversold: true},
+			want:   want{statusCode: http.StatusOK, contains: []string{"Inventaire insuffisant pour cette opération"}},
+		},
+		{
+			name:   "reports a season of oversold stock",
+			params: params{method: http.MethodGet, path: "/saisons/2023-2024", oversold: true},
+			want:   want{statusCode: http.StatusOK, contains: []string{"Inventaire insuffisant pour cette opération"}},
+		},
+		{
+			name:   "is read-only",
+			params: params{method: http.MethodPost, path: "/saisons/2023-2024"},
+			want:   want{statusCode: http.StatusMethodNotAllowed},
+		},
+	}
+
+	oversold := store.data
+	oversold.Consumptions = append([]core.Consumption{{Meta: core.Meta{ID: "c3"}, BrandID: "brand-w", ConsumedAt: time.Date(2024, time.February, 10, 0, 0, 0, 0, time.UTC), Bags: 40}}, store.data.Consumptions...)
+
+	server := NewServer(store, Config{})
+	oversoldServer := NewServer(&stubDataStore{data: oversold}, Config{})
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := server
+			if tc.params.oversold {
+				server = oversoldServer
+			}
+			req := httptest.NewRequest(tc.params.method, tc.params.path, nil)
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			for _, fragment := range tc.want.contains {
+				assert.Contains(t, rec.Body.String(), fragment, tc.name)
+			}
+			assert.Equal(t, tc.want.disposition, rec.Header().Get("Content-Disposition"), tc.name)
+		})
+	}
+}
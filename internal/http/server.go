@@ -4,30 +4,38 @@ package http
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/base64"
-	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
 	"image"
+	"image/color"
 	"image/jpeg"
+	"image/png"
 	"io"
 	"log"
 	"math"
 	"net/http"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	// Register additional decoders for brand image uploads.
 	_ "image/gif"
-	_ "image/png"
 
 	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
 
+	"pellets-tracker/internal/auth"
 	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/numparse"
+	"pellets-tracker/internal/store"
+	"pellets-tracker/internal/version"
 )
 
 // DataStore defines the persistence contract required by the HTTP server.
@@ -36,22 +44,152 @@ type DataStore interface {
 	Replace(core.DataStore) error
 }
 
+// ReadOnlyReporter reports the backup served read-only while the datastore
+// file cannot be read, see store.JSONStore.
+type ReadOnlyReporter interface {
+	ReadOnly() (string, bool)
+}
+
 // Server exposes the HTTP API for the pellets tracker application.
 type Server struct {
 	store              DataStore
+	changes            *changeLog
 	mux                *http.ServeMux
+	adminMux           *http.ServeMux
 	templates          map[string]*template.Template
 	maxBrandImageBytes int64
+	brandImageWidth    int
+	brandImageQuality  int
+	brandImageFormat   string
+	adminToken         string
+	computeTimeout     time.Duration
+	updates            UpdateNotifier
+	logExclude         []string
+	logSampleEvery     uint64
+	logSkipped         atomic.Uint64
+	errorPages         map[int][]byte
+	auth               *auth.Manager
+	privateReads       bool
+	costing            core.CostingMethod
+	csvFormat          string
+	chartMonths        int
+	chartRollup        core.ChartRollup
+	storeStats         StoreStats
+	receipts           ReceiptReader
+	readOnly           ReadOnlyReporter
+	jobs               JobStatuses
+	reportDir          string
+	forecast           atomic.Pointer[cachedForecast]
+	requests           requestCounts
+	connections        *ConnTracker
+	exportStallTimeout time.Duration
+	slowClients        atomic.Uint64
+	readOnlyAccess     bool
+	shareToken         string
 }
 
 // Config holds customization knobs for the HTTP server.
 type Config struct {
 	MaxBrandImageBytes int64
+	// BrandImageWidth is the width uploaded brand images are scaled down to;
+	// nil keeps the default of 800 pixels and zero their own size.
+	BrandImageWidth *int
+	// BrandImageQuality is the JPEG quality brand images are encoded with,
+	// zero for the default of 85.
+	BrandImageQuality int
+	// BrandImageFormat is the format brand images are stored in, one of the
+	// BrandImageFormat constants; empty means BrandImageFormatAuto.
+	BrandImageFormat string
+	// AdminToken guards the /api/admin endpoints; they are disabled when empty.
+	AdminToken string
+	// WeightDecimals sets how many decimals weights are displayed with in the
+	// HTML pages; nil keeps the default of two.
+	WeightDecimals *int
+	// ComputeTimeout bounds the FIFO based statistics of a single request,
+	// which then fails with 503; zero only stops them when the client leaves.
+	ComputeTimeout time.Duration
+	// Updates, when set, reports newer releases in the pages and /api/version.
+	Updates UpdateNotifier
+	// LogExclude lists the paths whose successful requests are not logged; an
+	// entry ending with "/" matches every path below it. Failed requests are
+	// always logged.
+	LogExclude []string
+	// LogSampleEvery still logs one in that many excluded requests; zero logs
+	// none of them.
+	LogSampleEvery int
+	// ErrorPages replaces the built-in error page of a status on the HTML
+	// routes, see LoadErrorPages.
+	ErrorPages map[int][]byte
+	// Auth, when set, requires a signed-in user for every request that
+	// modifies the data; nil leaves the server open.
+	Auth *auth.Manager
+	// PrivateReads, with Auth, also requires a signed-in user for the reads
+	// once an account exists, which is what sets viewers apart from anonymous
+	// clients.
+	PrivateReads bool
+	// CostingMethod values the consumptions and the stock when a request does
+	// not pick a method with the costing query parameter; empty means FIFO.
+	CostingMethod core.CostingMethod
+	// StoreStats, when set, adds the saves of the datastore to /metrics.
+	StoreStats StoreStats
+	// CSVFormat is the preset of the CSV exports when a request does not pick
+	// one with the format query parameter; empty means CSVFormatStandard.
+	CSVFormat string
+	// ChartMonths is the number of months the monthly chart of the stats
+	// shows before falling back on ChartRollup; nil keeps the default of 24
+	// and zero shows every month.
+	ChartMonths *int
+	// ChartRollup is how a longer history is shortened; empty means
+	// core.ChartRollupQuarter.
+	ChartRollup core.ChartRollup
+	// Receipts, when set, reads the photos of delivery receipts to pre-fill
+	// the purchase form; the upload is not offered without it.
+	Receipts ReceiptReader
+	// SeparateAdmin leaves the management endpoints out of Handler, for them
+	// to be served by AdminHandler on a listener of their own.
+	SeparateAdmin bool
+	// ReadOnly, when set, shows a degraded mode banner on every page and in
+	// /healthz while the datastore is served from a backup.
+	ReadOnly ReadOnlyReporter
+	// Jobs, when set, reports the scheduled jobs on /api/jobs and /metrics.
+	Jobs JobStatuses
+	// ReportDir holds the season reports written by WriteSeasonReport, listed
+	// on /rapports; empty leaves the page empty.
+	ReportDir string
+	// Connections, when set, adds the connections of the listeners it wraps
+	// to /metrics.
+	Connections *ConnTracker
+	// ExportStallTimeout disconnects the clients that stop reading an export
+	// for that long, the exports then escaping the write timeout of the HTTP
+	// server while they progress; zero leaves them to that timeout.
+	ExportStallTimeout time.Duration
+	// ReadOnlyAccess serves the statistics only, without letting anyone
+	// change the data, for a link shared outside the household: the other
+	// paths are not found, the forms are hidden and the requests that would
+	// modify something get a 403.
+	ReadOnlyAccess bool
+	// ShareToken is the secret of the share link of a ReadOnlyAccess
+	// server, /partage/{ShareToken}. Only the browsers which opened it are
+	// served, besides /healthz and the assets; changing it revokes the
+	// link. Empty serves no one.
+	ShareToken string
 }
 
 const (
 	defaultMaxBrandImageBytes = 5 * 1024 * 1024
-	brandImageTargetWidth     = 800
+	defaultWeightDecimals     = 2
+	defaultBrandImageWidth    = 800
+	defaultBrandImageQuality  = 85
+	defaultChartMonths        = 24
+
+	// BrandImageFormatAuto stores PNG uploads and images with transparency
+	// as PNG, the other images as JPEG.
+	BrandImageFormatAuto = "auto"
+	// BrandImageFormatJPEG stores every brand image as JPEG, transparent
+	// areas filled in white.
+	BrandImageFormatJPEG = "jpeg"
+	// BrandImageFormatPNG stores every brand image as PNG, lossless.
+	BrandImageFormatPNG = "png"
 	// brandImageRequestOverhead compensates for multipart boundaries and additional form fields.
 	// Without it a request containing an image close to the byte limit would be rejected before
 	// we have a chance to validate or resize it.
@@ -71,19 +209,73 @@ func NewServer(store DataStore, cfg Config) *Server {
 	if cfg.MaxBrandImageBytes <= 0 {
 		cfg.MaxBrandImageBytes = defaultMaxBrandImageBytes
 	}
+	changes := &changeLog{DataStore: store}
 	s := &Server{
-		store:              store,
+		store:              changes,
+		changes:            changes,
 		mux:                http.NewServeMux(),
+		adminMux:           http.NewServeMux(),
 		templates:          newTemplateSet(),
 		maxBrandImageBytes: cfg.MaxBrandImageBytes,
+		brandImageWidth:    defaultBrandImageWidth,
+		brandImageQuality:  cfg.BrandImageQuality,
+		brandImageFormat:   cfg.BrandImageFormat,
+		adminToken:         cfg.AdminToken,
+		computeTimeout:     cfg.ComputeTimeout,
+		updates:            cfg.Updates,
+		logExclude:         cfg.LogExclude,
+		errorPages:         cfg.ErrorPages,
+		auth:               cfg.Auth,
+		privateReads:       cfg.PrivateReads,
+		costing:            cfg.CostingMethod,
+		storeStats:         cfg.StoreStats,
+		csvFormat:          cfg.CSVFormat,
+		chartMonths:        defaultChartMonths,
+		chartRollup:        cfg.ChartRollup,
+		receipts:           cfg.Receipts,
+		readOnly:           cfg.ReadOnly,
+		jobs:               cfg.Jobs,
+		reportDir:          cfg.ReportDir,
+		connections:        cfg.Connections,
+		exportStallTimeout: cfg.ExportStallTimeout,
+		readOnlyAccess:     cfg.ReadOnlyAccess,
+		shareToken:         cfg.ShareToken,
+	}
+	if s.costing == "" {
+		s.costing = core.CostingFIFO
+	}
+	if cfg.BrandImageWidth != nil {
+		s.brandImageWidth = *cfg.BrandImageWidth
+	}
+	if s.brandImageQuality <= 0 {
+		s.brandImageQuality = defaultBrandImageQuality
+	}
+	if s.brandImageFormat == "" {
+		s.brandImageFormat = BrandImageFormatAuto
+	}
+	if s.csvFormat == "" {
+		s.csvFormat = CSVFormatStandard
+	}
+	if cfg.ChartMonths != nil {
+		s.chartMonths = *cfg.ChartMonths
+	}
+	if s.chartRollup == "" {
+		s.chartRollup = core.ChartRollupQuarter
+	}
+	if cfg.LogSampleEvery > 0 {
+		s.logSampleEvery = uint64(cfg.LogSampleEvery)
+	}
+	if cfg.WeightDecimals != nil && *cfg.WeightDecimals != defaultWeightDecimals {
+		s.templates = withWeightDecimals(s.templates, *cfg.WeightDecimals)
 	}
 	s.registerRoutes()
+	s.registerAdminRoutes(cfg.SeparateAdmin)
 	return s
 }
 
 // Handler returns the root HTTP handler with middleware attached.
 func (s *Server) Handler() http.Handler {
-	return s.loggingMiddleware(s.gzipMiddleware(s.mux))
+	return s.loggingMiddleware(s.metricsMiddleware(s.gzipMiddleware(s.authMiddleware(s.readOnlyAccessMiddleware(s.mux)))))
 }
 
 func (s *Server) registerRoutes() {
@@ -91,130 +283,268 @@ func (s *Server) registerRoutes() {
 	s.mux.Handle("/static/", http.StripPrefix("/static/", staticFileServer()))
 	s.mux.HandleFunc("/", s.handleHome)
 	s.mux.HandleFunc("/marques", s.handleBrandsPage)
+	s.mux.HandleFunc("/marques/", s.handleBrandPage)
 	s.mux.HandleFunc("/consommations", s.handleConsumptionsPage)
+	s.mux.HandleFunc("/consommations/dupliquer", s.handleConsumptionDuplicatePage)
+	s.mux.HandleFunc("/consommations/", s.handleConsumptionPage)
+	s.mux.HandleFunc("/consommations/lignes", s.handleConsumptionRows)
+	s.mux.HandleFunc("/achats/", s.handlePurchasePage)
+	s.mux.HandleFunc("/achats/lignes", s.handlePurchaseRows)
+	s.mux.HandleFunc("/achats/ocr", s.handleReceiptPage)
 	s.mux.HandleFunc("/stats", s.handleStatsPage)
+	s.mux.HandleFunc("/stats/plan-de-commande.pdf", s.handleOrderPlanPDF)
+	s.mux.HandleFunc("/saisons", s.handleSeasonsPage)
+	s.mux.HandleFunc("/saisons/", s.handleSeasonPage)
+	s.mux.HandleFunc("/rapports", s.handleReportsPage)
+	s.mux.HandleFunc("/rapports/", s.handleReportFile)
+	s.mux.HandleFunc("/calendrier", s.handleCalendarPage)
+	s.mux.HandleFunc("/silos", s.handleSilosPage)
+	s.mux.HandleFunc("/transferts", s.handleTransfersPage)
+	s.mux.HandleFunc("/emplacements", s.handleStorageLocationsPage)
+	s.mux.HandleFunc("/donnees", s.handleDataPage)
+	s.mux.HandleFunc("/alertes", s.handleAlertsForm)
+	s.mux.HandleFunc("/actions", s.handleActionsPage)
 
 	s.mux.HandleFunc("/api/marques", s.handleBrandsAPI)
+	s.mux.HandleFunc("/api/marques/", s.handleBrandByIDAPI)
 	s.mux.HandleFunc("/api/achats", s.handlePurchasesAPI)
 	s.mux.HandleFunc("/api/achats/", s.handlePurchaseByIDAPI)
+	s.mux.HandleFunc("/api/achats/ocr", s.handleReceiptAPI)
 	s.mux.HandleFunc("/api/consommations", s.handleConsumptionsAPI)
 	s.mux.HandleFunc("/api/consommations/", s.handleConsumptionByIDAPI)
 	s.mux.HandleFunc("/api/stats", s.handleStatsAPI)
+	s.mux.HandleFunc("/api/stats/forecast", s.handleForecastAPI)
+	s.mux.HandleFunc("/api/rapports/saison", s.handleSeasonReportAPI)
+	s.mux.HandleFunc("/api/calendrier", s.handleCalendarAPI)
+	s.mux.HandleFunc("/api/alertes", s.handleAlertsAPI)
+	s.mux.HandleFunc("/api/transferts", s.handleTransfersAPI)
+	s.mux.HandleFunc("/api/emplacements", s.handleStorageLocationsAPI)
+	s.mux.HandleFunc("/api/emplacements/", s.handleStorageLocationByIDAPI)
+	s.mux.HandleFunc("/api/silos", s.handleSilosAPI)
+	s.mux.HandleFunc("/api/silos/", s.handleSiloByIDAPI)
+	s.mux.HandleFunc("/api/temperatures", s.handleTemperaturesAPI)
+	s.mux.HandleFunc("/api/occupation", s.handleOccupancyAPI)
+	s.mux.HandleFunc("/api/occupation/ics", s.handleOccupancyCalendarAPI)
+	s.mux.HandleFunc("/api/model", s.handleModelAPI)
+	s.mux.HandleFunc("/api/marche/prix", s.handleMarketPricesAPI)
+	s.mux.HandleFunc("/api/jobs", s.handleJobsAPI)
+	s.mux.HandleFunc("/api/audit", s.handleAuditAPI)
 	s.mux.HandleFunc("/api/export/", s.handleExport)
-}
-
-func (s *Server) renderPage(w http.ResponseWriter, templateName, title, active string, data any, flash *flashMessage) {
-	if s.templates == nil {
-		http.Error(w, "templates not initialized", http.StatusInternalServerError)
-		return
-	}
+	s.mux.HandleFunc("/api/import/images", s.handleImportImages)
+	s.mux.HandleFunc("/api/import/json", s.handleImportJSON)
+	s.mux.HandleFunc("/api/import/settings", s.handleImportSettings)
+	s.mux.HandleFunc("/api/schema", s.handleSchemaAPI)
+	s.mux.HandleFunc("/api/import/csv", s.handleImportCSV)
+	s.mux.HandleFunc("/api/actions", s.handleActionsAPI)
+	s.mux.HandleFunc("/api/batch", s.handleBatchAPI)
+	s.mux.HandleFunc("/api/undo", s.handleUndoAPI)
+	s.mux.HandleFunc("/api/grafana", s.handleGrafanaAPI)
+	s.mux.HandleFunc("/api/grafana/", s.handleGrafanaAPI)
+	s.mux.HandleFunc("/api/version", s.handleVersionAPI)
+	s.mux.HandleFunc("/api/openapi.json", s.handleOpenAPI)
+	s.mux.HandleFunc("/api/docs", s.handleAPIDocs)
+
+	if s.auth != nil {
+		s.mux.HandleFunc("/connexion", s.handleLoginPage)
+		s.mux.HandleFunc("/deconnexion", s.handleLogout)
+		s.mux.HandleFunc("/api/session", s.handleSessionAPI)
+		s.mux.HandleFunc("/api/utilisateurs", s.handleUsersAPI)
+		s.mux.HandleFunc("/api/utilisateurs/", s.handleUserByIDAPI)
+		s.mux.HandleFunc("/api/tokens", s.handleAPITokensAPI)
+		s.mux.HandleFunc("/api/tokens/", s.handleAPITokenByIDAPI)
+	}
+}
+
+func (s *Server) renderPage(w http.ResponseWriter, status int, templateName, title, active string, data any, flash *flashMessage) {
 	tmpl, ok := s.templates[templateName]
 	if !ok {
-		http.Error(w, "template not found", http.StatusInternalServerError)
+		log.Printf("render template %s: template not found", templateName)
+		s.renderErrorPage(w, http.StatusInternalServerError)
 		return
 	}
 	payload := pageData{
-		Title:     title,
-		ActiveNav: active,
-		Flash:     flash,
-		Data:      data,
+		Title:          title,
+		ActiveNav:      active,
+		Flash:          flash,
+		Data:           data,
+		Version:        version.Version,
+		Auth:           s.auth != nil,
+		ReadOnlyAccess: s.readOnlyAccess,
 	}
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := tmpl.ExecuteTemplate(w, templateName, payload); err != nil {
+	if release, ok := s.availableUpdate(); ok {
+		payload.Update = &release
+	}
+	if backup, ok := s.servingBackup(); ok {
+		payload.ReadOnlyBackup = filepath.Base(backup)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, templateName, payload); err != nil {
 		log.Printf("render template %s: %v", templateName, err)
-		http.Error(w, "template rendering error", http.StatusInternalServerError)
+		s.renderErrorPage(w, http.StatusInternalServerError)
+		return
 	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = buf.WriteTo(w)
+}
+
+// renderFragment renders the fragment template of the templateName page
+// alone, for htmx to swap it in.
+func (s *Server) renderFragment(w http.ResponseWriter, templateName, fragment string, data any) {
+	tmpl, ok := s.templates[templateName]
+	if !ok {
+		log.Printf("render template %s: template not found", templateName)
+		s.renderErrorPage(w, http.StatusInternalServerError)
+		return
+	}
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, fragment, data); err != nil {
+		log.Printf("render fragment %s: %v", fragment, err)
+		s.renderErrorPage(w, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = buf.WriteTo(w)
 }
 
 func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		s.methodNotAllowed(w, http.MethodGet)
+		s.methodNotAllowed(w, r, http.MethodGet)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	// The process still serves the data: a restart would not bring the
+	// datastore file back, monitoring can alert on the status instead.
+	if _, ok := s.servingBackup(); ok {
+		_, _ = io.WriteString(w, `{"status":"degraded","read_only":true}`)
+		return
+	}
 	_, _ = io.WriteString(w, `{"status":"ok"}`)
 }
 
+// servingBackup returns the backup served while the datastore file cannot be
+// read.
+func (s *Server) servingBackup() (string, bool) {
+	if s.readOnly == nil {
+		return "", false
+	}
+	return s.readOnly.ReadOnly()
+}
+
 func (s *Server) handleHome(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/" {
-		http.NotFound(w, r)
+		s.notFound(w, r)
 		return
 	}
 	switch r.Method {
 	case http.MethodGet:
-		s.renderHomePage(w, s.successFlash(r, "purchase", "Achat enregistré avec succès"))
+		flash := s.successFlash(r, "purchase", "Achat enregistré avec succès")
+		if flash == nil {
+			flash = deletedFlash(r, "purchase", "Achat supprimé")
+		}
+		s.renderHomePage(w, r, http.StatusOK, flash, formState{})
 	case http.MethodPost:
 		if err := r.ParseForm(); err != nil {
-			s.renderHomePage(w, &flashMessage{Kind: "error", Message: "Formulaire invalide"})
+			s.renderHomePage(w, r, http.StatusBadRequest, &flashMessage{Kind: "error", Message: "Formulaire invalide"}, formState{})
 			return
 		}
-		ds := s.store.Data()
-		purchasedAt, err := parseDateOnly(r.FormValue("purchased_at"))
-		if err != nil {
-			s.renderHomePage(w, &flashMessage{Kind: "error", Message: "Date d'achat invalide"})
-			return
-		}
-		bags, err := parseIntField(r.FormValue("bags"))
-		if err != nil {
-			s.renderHomePage(w, &flashMessage{Kind: "error", Message: "Nombre de sacs invalide"})
-			return
-		}
-		bagWeightKg, err := parseFloatField(r.FormValue("bag_weight_kg"))
-		if err != nil {
-			s.renderHomePage(w, &flashMessage{Kind: "error", Message: "Poids par sac invalide"})
-			return
-		}
-		unitPrice, err := parseMoneyField(r.FormValue("unit_price_eur"))
-		if err != nil {
-			s.renderHomePage(w, &flashMessage{Kind: "error", Message: err.Error()})
+		form := newFormState(r, purchaseFormFields...)
+		params := purchaseFormParams(&form)
+		if form.HasErrors() {
+			s.renderHomePage(w, r, http.StatusBadRequest, invalidFormFlash(), form)
 			return
 		}
 
-		purchase, err := core.AddPurchase(&ds, core.CreatePurchaseParams{
-			BrandID:     core.ID(strings.TrimSpace(r.FormValue("brand_id"))),
-			PurchasedAt: purchasedAt,
-			Bags:        bags,
-			BagWeightKg: bagWeightKg,
-			UnitPrice:   unitPrice,
-			Notes:       strings.TrimSpace(r.FormValue("notes")),
-		})
+		ds := s.store.Data()
+		purchase, err := core.AddPurchase(&ds, params)
 		if err != nil {
-			s.renderHomePage(w, &flashMessage{Kind: "error", Message: s.friendlyError(err)})
+			if form.addValidationErrors(err, purchaseFormAliases) {
+				s.renderHomePage(w, r, http.StatusBadRequest, invalidFormFlash(), form)
+				return
+			}
+			s.renderHomePage(w, r, http.StatusBadRequest, &flashMessage{Kind: "error", Message: s.friendlyError(err)}, form)
 			return
 		}
 		if err := s.store.Replace(ds); err != nil {
 			log.Printf("persist purchase form: %v", err)
-			s.renderHomePage(w, &flashMessage{Kind: "error", Message: "Impossible d'enregistrer l'achat"})
+			s.renderHomePage(w, r, http.StatusInternalServerError, &flashMessage{Kind: "error", Message: "Impossible d'enregistrer l'achat"}, form)
 			return
 		}
 		log.Printf(`{"type":"save","entity":"purchase","id":"%s"}`, purchase.ID)
 		http.Redirect(w, r, "/?added=purchase", http.StatusSeeOther)
 	default:
-		s.methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+// purchaseFormParams reads the purchase and bulk delivery forms, flagging
+// the fields it cannot parse on form.
+func purchaseFormParams(form *formState) core.CreatePurchaseParams {
+	params := core.CreatePurchaseParams{
+		BrandID:  core.ID(form.Value("brand_id")),
+		Location: form.Value("location"),
+		Notes:    form.Value("notes"),
+	}
+	var err error
+	params.PurchasedAt, err = parseDateOnly(form.Value("purchased_at"))
+	if err != nil {
+		form.addError("purchased_at", "Date d'achat invalide")
 	}
+	if form.Value("kind") == purchaseKindBulk {
+		if params.WeightKg, err = parseFloatField(form.Value("weight_kg")); err != nil {
+			form.addError("weight_kg", "Poids livré invalide")
+		} else if params.WeightKg <= 0 {
+			form.addError("weight_kg", "Le poids livré doit être supérieur à zéro")
+		}
+		if params.PricePerTonne, err = numparse.Money(form.Value("price_per_tonne_eur")); err != nil {
+			form.addError("price_per_tonne_eur", "Prix à la tonne invalide")
+		}
+	} else {
+		if params.Bags, err = parseIntField(form.Value("bags")); err != nil {
+			form.addError("bags", "Nombre de sacs invalide")
+		}
+		if params.BagWeightKg, err = parseFloatField(form.Value("bag_weight_kg")); err != nil {
+			form.addError("bag_weight_kg", "Poids par sac invalide")
+		}
+		if params.UnitPrice, err = parseMoneyField(form.Value("unit_price_eur")); err != nil {
+			form.addError("unit_price_eur", upperFirst(err.Error()))
+		}
+	}
+	return params
 }
 
 func (s *Server) handleBrandsPage(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		s.renderBrandsPage(w, s.successFlash(r, "brand", "Marque enregistrée"))
+		flash := s.successFlash(r, "brand", "Marque enregistrée")
+		if flash == nil {
+			flash = s.successFlash(r, "alerts", "Seuil d'alerte enregistré")
+		}
+		if flash == nil {
+			flash = photoFlash(r)
+		}
+		if flash == nil {
+			flash = archivedFlash(r)
+		}
+		s.renderBrandsPage(w, http.StatusOK, flash, formState{})
 	case http.MethodPost:
 		maxBytes := s.effectiveMaxBrandImageBytes()
 		r.Body = http.MaxBytesReader(w, r.Body, maxBytes+brandImageRequestOverhead)
 		if err := r.ParseMultipartForm(maxBytes); err != nil {
 			if errors.Is(err, http.ErrNotMultipart) {
 				if err := r.ParseForm(); err != nil {
-					s.renderBrandsPage(w, &flashMessage{Kind: "error", Message: "Formulaire invalide"})
+					s.renderBrandsPage(w, http.StatusBadRequest, &flashMessage{Kind: "error", Message: "Formulaire invalide"}, formState{})
 					return
 				}
 			} else {
-				w.WriteHeader(http.StatusBadRequest)
-				s.renderBrandsPage(w, &flashMessage{Kind: "error", Message: "Fichier trop volumineux ou invalide"})
+				s.renderBrandsPage(w, http.StatusBadRequest, &flashMessage{Kind: "error", Message: "Fichier trop volumineux ou invalide"}, formState{})
 				return
 			}
 		}
 
+		form := newFormState(r, brandFormFields...)
 		imageBase64, err := s.brandImageFromRequest(r)
 		if err != nil {
 			message := "Impossible de traiter l'image"
@@ -226,34 +556,115 @@ func (s *Server) handleBrandsPage(w http.ResponseWriter, r *http.Request) {
 			case errors.Is(err, http.ErrMissingFile):
 				message = "Téléversement de fichier invalide"
 			}
-			w.WriteHeader(http.StatusBadRequest)
-			s.renderBrandsPage(w, &flashMessage{Kind: "error", Message: message})
+			form.addError("image_file", message)
+			s.renderBrandsPage(w, http.StatusBadRequest, &flashMessage{Kind: "error", Message: message}, form)
 			return
 		}
 
+		leadTimeDays := 0
+		if value := form.Value("lead_time_days"); value != "" {
+			if leadTimeDays, err = parseIntField(value); err != nil {
+				form.addError("lead_time_days", "Délai de livraison invalide")
+				s.renderBrandsPage(w, http.StatusBadRequest, invalidFormFlash(), form)
+				return
+			}
+		}
+		energy := 0.0
+		if value := form.Value("energy_kwh_per_kg"); value != "" {
+			if energy, err = parseFloatField(value); err != nil {
+				form.addError("energy_kwh_per_kg", "Pouvoir calorifique invalide")
+				s.renderBrandsPage(w, http.StatusBadRequest, invalidFormFlash(), form)
+				return
+			}
+		}
+		minStockBags := 0
+		if value := form.Value("min_stock_bags"); value != "" {
+			if minStockBags, err = parseIntField(value); err != nil {
+				form.addError("min_stock_bags", "Stock minimum invalide")
+				s.renderBrandsPage(w, http.StatusBadRequest, invalidFormFlash(), form)
+				return
+			}
+		}
+
 		ds := s.store.Data()
 		brand, err := core.AddBrand(&ds, core.CreateBrandParams{
-			Name:        r.FormValue("name"),
-			Description: r.FormValue("description"),
-			ImageBase64: imageBase64,
+			Name:           form.Value("name"),
+			Description:    form.Value("description"),
+			ImageBase64:    imageBase64,
+			LeadTimeDays:   leadTimeDays,
+			EnergyKWhPerKg: energy,
+			MinStockBags:   minStockBags,
 		})
 		if err != nil {
-			s.renderBrandsPage(w, &flashMessage{Kind: "error", Message: s.friendlyError(err)})
+			if form.addValidationErrors(err, nil) {
+				s.renderBrandsPage(w, http.StatusBadRequest, invalidFormFlash(), form)
+				return
+			}
+			s.renderBrandsPage(w, http.StatusBadRequest, &flashMessage{Kind: "error", Message: s.friendlyError(err)}, form)
 			return
 		}
 		if err := s.store.Replace(ds); err != nil {
 			log.Printf("persist brand form: %v", err)
-			s.renderBrandsPage(w, &flashMessage{Kind: "error", Message: "Impossible d'enregistrer la marque"})
+			s.renderBrandsPage(w, http.StatusInternalServerError, &flashMessage{Kind: "error", Message: "Impossible d'enregistrer la marque"}, form)
 			return
 		}
 		log.Printf(`{"type":"save","entity":"brand","id":"%s"}`, brand.ID)
 		http.Redirect(w, r, "/marques?added=brand", http.StatusSeeOther)
 	default:
-		s.methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
 	}
 }
 
+// handleBrandPage serves the forms of a brand card: POST
+// /marques/{id}/archiver and /desarchiver, and the photos of its gallery.
+func (s *Server) handleBrandPage(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/marques/"), "/")
+	if id == "" || (action != "archiver" && action != "desarchiver") {
+		s.handleBrandPhotosPage(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	archived := action == "archiver"
+	ds := s.store.Data()
+	brand, err := core.SetBrandArchived(&ds, core.ID(id), archived)
+	if errors.Is(err, core.ErrBrandNotFound) {
+		s.notFound(w, r)
+		return
+	}
+	if err == nil {
+		err = s.store.Replace(ds)
+	}
+	if err != nil {
+		log.Printf("archive brand form: %v", err)
+		s.renderBrandsPage(w, http.StatusInternalServerError, &flashMessage{Kind: "error", Message: s.friendlyError(err)}, formState{})
+		return
+	}
+	log.Printf(`{"type":"save","entity":"brand","id":"%s","action":"archive","archived":%t}`, brand.ID, archived)
+	http.Redirect(w, r, "/marques?archived="+strconv.FormatBool(archived)+"#marque-"+string(brand.ID), http.StatusSeeOther)
+}
+
+// archivedFlash confirms the archive forms of the brands page, which redirect
+// with ?archived=true or false.
+func archivedFlash(r *http.Request) *flashMessage {
+	switch r.URL.Query().Get("archived") {
+	case "true":
+		return &flashMessage{Kind: "success", Message: "Marque archivée : elle n'est plus proposée dans les formulaires"}
+	case "false":
+		return &flashMessage{Kind: "success", Message: "Marque réactivée"}
+	}
+	return nil
+}
+
 func (s *Server) encodeBrandImage(r io.Reader) (string, error) {
+	return s.encodeImage(r, s.brandImageWidth)
+}
+
+// encodeImage validates an uploaded image and scales it down to width, zero
+// keeping its size, in the format picked by brandImageOutput.
+func (s *Server) encodeImage(r io.Reader, width int) (string, error) {
 	maxBytes := s.effectiveMaxBrandImageBytes()
 
 	limit := maxBytes + 1
@@ -265,31 +676,79 @@ func (s *Server) encodeBrandImage(r io.Reader) (string, error) {
 		return "", errBrandImageTooLarge
 	}
 
-	img, _, err := image.Decode(bytes.NewReader(data))
+	img, format, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
 		return "", fmt.Errorf("%w: %v", errBrandImageInvalid, err)
 	}
 
+	resized := false
 	bounds := img.Bounds()
-	if bounds.Dx() > brandImageTargetWidth {
+	if width > 0 && bounds.Dx() > width {
 		ratio := float64(bounds.Dy()) / float64(bounds.Dx())
-		targetHeight := int(math.Round(float64(brandImageTargetWidth) * ratio))
+		targetHeight := int(math.Round(float64(width) * ratio))
 		if targetHeight < 1 {
 			targetHeight = 1
 		}
-		dst := image.NewRGBA(image.Rect(0, 0, brandImageTargetWidth, targetHeight))
+		dst := image.NewRGBA(image.Rect(0, 0, width, targetHeight))
 		draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
 		img = dst
+		resized = true
 	}
 
 	var buf bytes.Buffer
-	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
-		return "", fmt.Errorf("encode brand image: %w", err)
+	switch s.brandImageOutput(img, format) {
+	case BrandImageFormatPNG:
+		if format == "png" && !resized {
+			// The upload is kept as is: re-encoding would only lose its
+			// compression settings.
+			return base64.StdEncoding.EncodeToString(data), nil
+		}
+		if err := png.Encode(&buf, img); err != nil {
+			return "", fmt.Errorf("encode brand image: %w", err)
+		}
+	default:
+		if !isOpaque(img) {
+			img = flatten(img)
+		}
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: s.brandImageQuality}); err != nil {
+			return "", fmt.Errorf("encode brand image: %w", err)
+		}
 	}
 
 	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
 }
 
+// brandImageOutput picks the format a decoded brand image is stored in. In
+// auto mode logos, PNG uploads and images with transparency, stay PNG and
+// photos go to JPEG.
+func (s *Server) brandImageOutput(img image.Image, format string) string {
+	if s.brandImageFormat != BrandImageFormatAuto && s.brandImageFormat != "" {
+		return s.brandImageFormat
+	}
+	if format == "png" || !isOpaque(img) {
+		return BrandImageFormatPNG
+	}
+	return BrandImageFormatJPEG
+}
+
+// isOpaque reports whether img has no transparent pixel.
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// flatten draws img over a white background, JPEG having no alpha channel:
+// the transparent areas of a logo would otherwise turn black.
+func flatten(img image.Image) image.Image {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Over)
+	return dst
+}
+
 func (s *Server) brandImageFromRequest(r *http.Request) (string, error) {
 	file, _, err := r.FormFile("image_file")
 	switch {
@@ -313,97 +772,346 @@ func (s *Server) effectiveMaxBrandImageBytes() int64 {
 func (s *Server) handleConsumptionsPage(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		s.renderConsumptionsPage(w, s.successFlash(r, "consumption", "Consommation enregistrée"))
+		flash := s.successFlash(r, "consumption", "Consommation enregistrée")
+		if flash == nil {
+			flash = deletedFlash(r, "consumption", "Consommation supprimée")
+		}
+		s.renderConsumptionsPage(w, r, http.StatusOK, flash, formState{})
 	case http.MethodPost:
 		if err := r.ParseForm(); err != nil {
-			s.renderConsumptionsPage(w, &flashMessage{Kind: "error", Message: "Formulaire invalide"})
-			return
-		}
-		ds := s.store.Data()
-		consumedAt, err := parseDateOnly(r.FormValue("consumed_at"))
-		if err != nil {
-			s.renderConsumptionsPage(w, &flashMessage{Kind: "error", Message: "Date invalide"})
+			s.renderConsumptionsPage(w, r, http.StatusBadRequest, &flashMessage{Kind: "error", Message: "Formulaire invalide"}, formState{})
 			return
 		}
-		bags, err := parseIntField(r.FormValue("bags"))
-		if err != nil {
-			s.renderConsumptionsPage(w, &flashMessage{Kind: "error", Message: "Nombre de sacs invalide"})
+		form := newFormState(r, consumptionFormFields...)
+		params := consumptionFormParams(&form)
+		if form.HasErrors() {
+			s.renderConsumptionsPage(w, r, http.StatusBadRequest, invalidFormFlash(), form)
 			return
 		}
-		consumption, err := core.AddConsumption(&ds, core.CreateConsumptionParams{
-			BrandID:    core.ID(strings.TrimSpace(r.FormValue("brand_id"))),
-			ConsumedAt: consumedAt,
-			Bags:       bags,
-			Notes:      strings.TrimSpace(r.FormValue("notes")),
-		})
+
+		ds := s.store.Data()
+		consumption, err := core.AddConsumption(&ds, params)
 		if err != nil {
-			s.renderConsumptionsPage(w, &flashMessage{Kind: "error", Message: s.friendlyError(err)})
+			if form.addValidationErrors(err, nil) {
+				s.renderConsumptionsPage(w, r, http.StatusBadRequest, invalidFormFlash(), form)
+				return
+			}
+			s.renderConsumptionsPage(w, r, http.StatusBadRequest, &flashMessage{Kind: "error", Message: s.friendlyError(err)}, form)
 			return
 		}
 		if err := s.store.Replace(ds); err != nil {
 			log.Printf("persist consumption form: %v", err)
-			s.renderConsumptionsPage(w, &flashMessage{Kind: "error", Message: "Impossible d'enregistrer la consommation"})
+			s.renderConsumptionsPage(w, r, http.StatusInternalServerError, &flashMessage{Kind: "error", Message: "Impossible d'enregistrer la consommation"}, form)
 			return
 		}
 		log.Printf(`{"type":"save","entity":"consumption","id":"%s"}`, consumption.ID)
 		http.Redirect(w, r, "/consommations?added=consumption", http.StatusSeeOther)
 	default:
-		s.methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
 	}
 }
 
+// consumptionFormParams reads the consumption form, flagging the fields it
+// cannot parse on form.
+func consumptionFormParams(form *formState) core.CreateConsumptionParams {
+	params := core.CreateConsumptionParams{
+		BrandID: core.ID(form.Value("brand_id")),
+		Notes:   form.Value("notes"),
+	}
+	var err error
+	params.ConsumedAt, err = parseDateOnly(form.Value("consumed_at"))
+	if err != nil {
+		form.addError("consumed_at", "Date invalide")
+	}
+	if value := form.Value("weight_kg"); value != "" {
+		params.WeightKg, err = parseFloatField(value)
+		if err != nil {
+			form.addError("weight_kg", "Poids invalide")
+		}
+	}
+	// A consumption taken from a bulk delivery or from opened bags only has
+	// a weight; a bag and a half is typed 1,5.
+	if value := form.Value("bags"); value != "" || params.WeightKg <= 0 {
+		bags, err := parseFloatField(value)
+		if err != nil {
+			form.addError("bags", "Nombre de sacs invalide")
+		}
+		params.Bags, params.BagsFraction = core.SplitBags(bags)
+	}
+	if value := form.Value("power_level"); value != "" {
+		params.PowerLevel, err = parseIntField(value)
+		if err != nil {
+			form.addError("power_level", "Puissance invalide")
+		}
+	}
+	return params
+}
+
+func (s *Server) handleConsumptionDuplicatePage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.renderConsumptionsPage(w, r, http.StatusBadRequest, &flashMessage{Kind: "error", Message: "Formulaire invalide"}, formState{})
+		return
+	}
+	ds := s.store.Data()
+	consumption, err := core.DuplicateConsumption(&ds, core.ID(strings.TrimSpace(r.PostFormValue("id"))), today())
+	if err != nil {
+		s.renderConsumptionsPage(w, r, http.StatusBadRequest, &flashMessage{Kind: "error", Message: s.friendlyError(err)}, formState{})
+		return
+	}
+	if err := s.store.Replace(ds); err != nil {
+		log.Printf("persist consumption duplicate: %v", err)
+		s.renderConsumptionsPage(w, r, http.StatusInternalServerError, &flashMessage{Kind: "error", Message: "Impossible d'enregistrer la consommation"}, formState{})
+		return
+	}
+	log.Printf(`{"type":"save","entity":"consumption","id":"%s","action":"duplicate"}`, consumption.ID)
+	http.Redirect(w, r, "/consommations?added=consumption", http.StatusSeeOther)
+}
+
 func (s *Server) handleStatsPage(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		s.methodNotAllowed(w, http.MethodGet)
+		s.methodNotAllowed(w, r, http.MethodGet)
 		return
 	}
+	flash := s.successFlash(r, "transfer", "Transfert enregistré")
+	if flash == nil {
+		flash = s.successFlash(r, "location", "Emplacement enregistré")
+	}
+	s.renderStatsPage(w, r, http.StatusOK, flash, formState{})
+}
+
+func (s *Server) renderStatsPage(w http.ResponseWriter, r *http.Request, status int, flash *flashMessage, form formState) {
 	ds := s.store.Data()
 	from, to, err := parseRangeQuery(r)
 	if err != nil {
-		s.renderPage(w, "stats", "Statistiques", "stats", statsView{}, &flashMessage{Kind: "error", Message: err.Error()})
+		s.renderPage(w, http.StatusOK, "stats", "Statistiques", "stats", statsView{}, &flashMessage{Kind: "error", Message: err.Error()})
 		return
 	}
+	method, err := s.costingMethod(r)
+	if err != nil {
+		s.renderPage(w, http.StatusOK, "stats", "Statistiques", "stats", statsView{}, &flashMessage{Kind: "error", Message: "Méthode de valorisation inconnue"})
+		return
+	}
+	ctx, cancel := s.computeContext(r)
+	defer cancel()
+	fail := func(err error) {
+		switch {
+		case errors.Is(err, context.Canceled):
+			// The client went away, nobody is left to read the page.
+		case errors.Is(err, context.DeadlineExceeded):
+			s.renderPage(w, http.StatusServiceUnavailable, "stats", "Statistiques", "stats", statsView{}, &flashMessage{Kind: "error", Message: s.friendlyError(err)})
+		default:
+			s.renderPage(w, http.StatusOK, "stats", "Statistiques", "stats", statsView{}, &flashMessage{Kind: "error", Message: s.friendlyError(err)})
+		}
+	}
 	invested := core.ComputeInvesti(&ds, from, to)
-	consumed, details, err := core.ComputeConsoValue(&ds, from, to)
+	consumed, details, err := core.ComputeConsoValue(ctx, &ds, method, from, to)
+	if err != nil {
+		fail(err)
+		return
+	}
+	inventory, err := core.ComputeInventaireAu(ctx, &ds, method, to)
+	if err != nil {
+		fail(err)
+		return
+	}
+	chartMonths, rollup, err := s.chartLimit(r)
+	if err != nil {
+		s.renderPage(w, http.StatusOK, "stats", "Statistiques", "stats", statsView{}, &flashMessage{Kind: "error", Message: "Regroupement du graphique inconnu"})
+		return
+	}
+	monthly, err := core.ComputeSacsParMois(ctx, &ds, from, to)
+	if err != nil {
+		fail(err)
+		return
+	}
+	avg, err := core.ComputeCoutMoyenParSac(ctx, &ds, method, from, to)
+	if err != nil {
+		fail(err)
+		return
+	}
+	avgPerTonne, err := core.ComputeCoutMoyenParTonne(ctx, &ds, method, from, to)
+	if err != nil {
+		fail(err)
+		return
+	}
+	stock, err := core.ComputeStockKgParMois(ctx, &ds, from, to)
 	if err != nil {
-		s.renderPage(w, "stats", "Statistiques", "stats", statsView{}, &flashMessage{Kind: "error", Message: s.friendlyError(err)})
+		fail(err)
 		return
 	}
-	inventory, err := core.ComputeInventaire(&ds)
+	energy, err := core.ComputeEnergie(ctx, &ds, method, from, to)
 	if err != nil {
-		s.renderPage(w, "stats", "Statistiques", "stats", statsView{}, &flashMessage{Kind: "error", Message: s.friendlyError(err)})
+		fail(err)
 		return
 	}
-	monthly, err := core.ComputeSacsParMois(&ds, from, to)
+	energyMonths, err := core.ComputeKWhParMois(ctx, &ds, from, to)
 	if err != nil {
-		s.renderPage(w, "stats", "Statistiques", "stats", statsView{}, &flashMessage{Kind: "error", Message: s.friendlyError(err)})
+		fail(err)
 		return
 	}
-	avg, err := core.ComputeCoutMoyenParSac(&ds, from, to)
+	view := newStatsView(&ds, invested, consumed, avg, core.LimitSacsParMois(monthly, chartMonths, rollup), inventory, details)
+	view.ChartNote = chartNote(monthly, chartMonths, rollup)
+	view.AveragePerTonne = avgPerTonne
+	view.StockMonths = newStockPoints(stock, chartMonths)
+	view.Costing = method
+	view.InventoryAt = to
+	view.Energy = energy
+	view.EnergyMonths = energyMonths
+	view.PowerLevels = core.ComputeSacsParPuissance(&ds, from, to)
+	view.PriceCalendar = newPriceCalendarRows(core.ComputeBrandPriceCalendars(&ds))
+	if view.Occupancy, err = core.ComputeConsoParOccupation(ctx, &ds, method, from, to); err != nil {
+		fail(err)
+		return
+	}
+	view.Model = core.ComputeConsumptionModel(&ds, time.Now().UTC())
+	forecast, err := s.stockForecast(ctx, &ds, time.Now().UTC())
 	if err != nil {
-		s.renderPage(w, "stats", "Statistiques", "stats", statsView{}, &flashMessage{Kind: "error", Message: s.friendlyError(err)})
+		fail(err)
 		return
 	}
-	view := newStatsView(&ds, invested, consumed, avg, monthly, inventory, details)
-	s.renderPage(w, "stats", "Statistiques", "stats", view, nil)
+	view.Forecast = newForecastView(forecast)
+	// Purchases or consumptions edited after a transfer can make the location
+	// history inconsistent; the rest of the statistics stay meaningful then.
+	if view.StockByLocation, err = core.ComputeInventaireParEmplacementAu(ctx, &ds, to); err != nil {
+		if ctx.Err() != nil {
+			fail(err)
+			return
+		}
+		log.Printf("compute inventory by location: %v", err)
+	}
+	view.TransferForm = form
+	view.Warnings = newStatsWarningViews(&ds, checkStats(&ds, inventory, avg, from, to))
+	s.renderPage(w, status, "stats", "Statistiques", "stats", view, flash)
+}
+
+// computeContext derives the context of the FIFO computations run for r:
+// it is cancelled when the client disconnects and, when configured, after
+// the compute timeout.
+func (s *Server) computeContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if s.computeTimeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), s.computeTimeout)
 }
 
-func (s *Server) renderHomePage(w http.ResponseWriter, flash *flashMessage) {
+// consumptionCosts indexes the valuation of every consumption by ID. A
+// history that cannot be replayed is logged and values nothing, so listings
+// still show; only context errors are returned.
+func consumptionCosts(ctx context.Context, ds *core.DataStore, method core.CostingMethod) (map[core.ID]core.ConsumptionCost, error) {
+	_, details, err := core.ComputeConsoValue(ctx, ds, method, time.Time{}, time.Time{})
+	if err != nil {
+		if isContextError(err) {
+			return nil, err
+		}
+		log.Printf("value consumptions: %v", err)
+		return nil, nil
+	}
+	costs := make(map[core.ID]core.ConsumptionCost, len(details))
+	for _, detail := range details {
+		costs[detail.Consumption.ID] = detail
+	}
+	return costs, nil
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func (s *Server) renderHomePage(w http.ResponseWriter, r *http.Request, status int, flash *flashMessage, form formState) {
 	ds := s.store.Data()
 	view := newHomeView(&ds)
-	s.renderPage(w, "home", "Achats", "purchases", view, flash)
+	view.Form = form
+	// Without JavaScript, "load more" reloads the page with one more page.
+	page, err := parsePageQuery(r)
+	if err != nil {
+		page = pageQuery{Page: 1, PerPage: defaultPageSize}
+	}
+	view.Page = pageInfo{pageQuery: page, Total: len(view.Purchases)}
+	view.Purchases = pagesThrough(view.Purchases, page)
+	view.Receipts = s.receipts != nil
+	ctx, cancel := s.computeContext(r)
+	defer cancel()
+	// The purchases stay listed when the stock cannot be computed, only the
+	// alerts banner is left out.
+	alerts, err := core.ComputeAlertes(ctx, &ds)
+	if err != nil && !isContextError(err) {
+		log.Printf("compute stock alerts: %v", err)
+	}
+	view.Alerts = alerts
+	s.renderPage(w, status, "home", "Achats", "purchases", view, flash)
 }
 
-func (s *Server) renderBrandsPage(w http.ResponseWriter, flash *flashMessage) {
+func (s *Server) renderBrandsPage(w http.ResponseWriter, status int, flash *flashMessage, form formState) {
 	ds := s.store.Data()
 	view := newBrandsView(&ds)
-	s.renderPage(w, "brands", "Marques", "brands", view, flash)
+	view.Form = form
+	s.renderPage(w, status, "brands", "Marques", "brands", view, flash)
+}
+
+func (s *Server) renderConsumptionsPage(w http.ResponseWriter, r *http.Request, status int, flash *flashMessage, form formState) {
+	ds := s.store.Data()
+	ctx, cancel := s.computeContext(r)
+	defer cancel()
+	// The listing stays usable without prices when valuing it times out.
+	costs, _ := consumptionCosts(ctx, &ds, s.costing)
+	view := newConsumptionsView(&ds, costs)
+	view.Form = form
+	page, err := parsePageQuery(r)
+	if err != nil {
+		page = pageQuery{Page: 1, PerPage: defaultPageSize}
+	}
+	view.Page = pageInfo{pageQuery: page, Total: len(view.Consumptions)}
+	view.Consumptions = pagesThrough(view.Consumptions, page)
+	s.renderPage(w, status, "consumptions", "Consommations", "consumptions", view, flash)
+}
+
+// handlePurchaseRows serves GET /achats/lignes, the rows of a page of the
+// purchases table loaded by its "load more" row.
+func (s *Server) handlePurchaseRows(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	page, err := parsePageQuery(r)
+	if err != nil {
+		s.renderErrorPage(w, http.StatusBadRequest)
+		return
+	}
+	ds := s.store.Data()
+	view := newHomeView(&ds)
+	view.Page = pageInfo{pageQuery: page, Total: len(view.Purchases)}
+	view.Purchases = pageOf(view.Purchases, page)
+	s.renderFragment(w, "home", "purchaseRows", view)
 }
 
-func (s *Server) renderConsumptionsPage(w http.ResponseWriter, flash *flashMessage) {
+// handleConsumptionRows serves GET /consommations/lignes, the rows of a page
+// of the consumptions table loaded by its "load more" row.
+func (s *Server) handleConsumptionRows(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	page, err := parsePageQuery(r)
+	if err != nil {
+		s.renderErrorPage(w, http.StatusBadRequest)
+		return
+	}
 	ds := s.store.Data()
-	view := newConsumptionsView(&ds)
-	s.renderPage(w, "consumptions", "Consommations", "consumptions", view, flash)
+	ctx, cancel := s.computeContext(r)
+	defer cancel()
+	costs, _ := consumptionCosts(ctx, &ds, s.costing)
+	view := newConsumptionsView(&ds, costs)
+	view.Page = pageInfo{pageQuery: page, Total: len(view.Consumptions)}
+	view.Consumptions = pageOf(view.Consumptions, page)
+	s.renderFragment(w, "consumptions", "consumptionRows", view)
+}
+
+func invalidFormFlash() *flashMessage {
+	return &flashMessage{Kind: "error", Message: "Le formulaire contient des erreurs, vérifiez les champs signalés"}
 }
 
 func (s *Server) successFlash(r *http.Request, expected, message string) *flashMessage {
@@ -413,6 +1121,15 @@ func (s *Server) successFlash(r *http.Request, expected, message string) *flashM
 	return nil
 }
 
+// deletedFlash confirms the deletions of the edit pages, which redirect with
+// ?deleted=<entity>.
+func deletedFlash(r *http.Request, expected, message string) *flashMessage {
+	if r.URL.Query().Get("deleted") == expected {
+		return &flashMessage{Kind: "success", Message: message}
+	}
+	return nil
+}
+
 func (s *Server) friendlyError(err error) string {
 	if err == nil {
 		return ""
@@ -420,10 +1137,22 @@ func (s *Server) friendlyError(err error) string {
 	switch {
 	case errors.Is(err, core.ErrBrandNotFound):
 		return "Marque introuvable"
+	case errors.Is(err, core.ErrConsumptionNotFound):
+		return "Consommation introuvable"
+	case errors.Is(err, core.ErrSiloNotFound):
+		return "Silo introuvable"
+	case errors.Is(err, core.ErrStorageLocationNotFound):
+		return "Emplacement introuvable"
+	case errors.Is(err, core.ErrPhotoNotFound):
+		return "Photo introuvable"
 	case errors.Is(err, core.ErrBrandInUse):
 		return "La marque est référencée, impossible de la supprimer"
 	case errors.Is(err, core.ErrInsufficientInventory):
 		return "Inventaire insuffisant pour cette opération"
+	case errors.Is(err, core.ErrConflict):
+		return "Cette entrée a été modifiée entre-temps, dans un autre onglet ou par un autre appareil : rechargez la page pour repartir de la version enregistrée"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "Le calcul des statistiques a pris trop de temps, réessayez dans un instant"
 	default:
 		var vErr core.ValidationErrors
 		if errors.As(err, &vErr) {
@@ -440,7 +1169,7 @@ func (s *Server) handleBrandsAPI(w http.ResponseWriter, r *http.Request) {
 	case http.MethodPost:
 		s.createBrand(w, r)
 	default:
-		s.methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
 	}
 }
 
@@ -451,23 +1180,42 @@ func (s *Server) handlePurchasesAPI(w http.ResponseWriter, r *http.Request) {
 	case http.MethodPost:
 		s.createPurchase(w, r)
 	default:
-		s.methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
 	}
 }
 
 func (s *Server) handlePurchaseByIDAPI(w http.ResponseWriter, r *http.Request) {
-	id := core.ID(strings.TrimPrefix(r.URL.Path, "/api/achats/"))
+	if target, ok := parsePhotoPath(r.URL.Path, purchasePhotos.apiPrefix); ok {
+		s.handlePhotosAPI(w, r, purchasePhotos, target)
+		return
+	}
+	rest := strings.TrimPrefix(r.URL.Path, "/api/achats/")
+	if target, ok := strings.CutSuffix(rest, "/marque"); ok {
+		if target == "" || strings.ContainsRune(target, '/') {
+			s.notFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPut {
+			s.methodNotAllowed(w, r, http.MethodPut)
+			return
+		}
+		s.movePurchaseToBrand(w, r, core.ID(target))
+		return
+	}
+	id := core.ID(rest)
 	if id == "" || strings.ContainsRune(string(id), '/') {
-		http.NotFound(w, r)
+		s.notFound(w, r)
 		return
 	}
 	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		s.getPurchase(w, r, id)
 	case http.MethodPut:
 		s.updatePurchase(w, r, id)
 	case http.MethodDelete:
 		s.deletePurchase(w, r, id)
 	default:
-		s.methodNotAllowed(w, http.MethodPut, http.MethodDelete)
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPut, http.MethodDelete)
 	}
 }
 
@@ -478,29 +1226,64 @@ func (s *Server) handleConsumptionsAPI(w http.ResponseWriter, r *http.Request) {
 	case http.MethodPost:
 		s.createConsumption(w, r)
 	default:
-		s.methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
 	}
 }
 
 func (s *Server) handleConsumptionByIDAPI(w http.ResponseWriter, r *http.Request) {
-	id := core.ID(strings.TrimPrefix(r.URL.Path, "/api/consommations/"))
+	rest := strings.TrimPrefix(r.URL.Path, "/api/consommations/")
+	if rest == "bulk" {
+		if r.Method != http.MethodPost {
+			s.methodNotAllowed(w, r, http.MethodPost)
+			return
+		}
+		s.createConsumptions(w, r)
+		return
+	}
+	if source, ok := strings.CutSuffix(rest, "/duplicate"); ok {
+		if source == "" || strings.ContainsRune(source, '/') {
+			s.notFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			s.methodNotAllowed(w, r, http.MethodPost)
+			return
+		}
+		s.duplicateConsumption(w, r, core.ID(source))
+		return
+	}
+	if target, ok := strings.CutSuffix(rest, "/marque"); ok {
+		if target == "" || strings.ContainsRune(target, '/') {
+			s.notFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPut {
+			s.methodNotAllowed(w, r, http.MethodPut)
+			return
+		}
+		s.moveConsumptionToBrand(w, r, core.ID(target))
+		return
+	}
+	id := core.ID(rest)
 	if id == "" || strings.ContainsRune(string(id), '/') {
-		http.NotFound(w, r)
+		s.notFound(w, r)
 		return
 	}
 	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		s.getConsumption(w, r, id)
 	case http.MethodPut:
 		s.updateConsumption(w, r, id)
 	case http.MethodDelete:
 		s.deleteConsumption(w, r, id)
 	default:
-		s.methodNotAllowed(w, http.MethodPut, http.MethodDelete)
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPut, http.MethodDelete)
 	}
 }
 
 func (s *Server) handleStatsAPI(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		s.methodNotAllowed(w, http.MethodGet)
+		s.methodNotAllowed(w, r, http.MethodGet)
 		return
 	}
 	ds := s.store.Data()
@@ -509,59 +1292,159 @@ func (s *Server) handleStatsAPI(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, http.StatusBadRequest, err)
 		return
 	}
+	method, err := s.costingMethod(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	chartMonths, rollup, err := s.chartLimit(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
 
+	ctx, cancel := s.computeContext(r)
+	defer cancel()
 	invested := core.ComputeInvesti(&ds, from, to)
-	consumed, details, err := core.ComputeConsoValue(&ds, from, to)
+	consumed, details, err := core.ComputeConsoValue(ctx, &ds, method, from, to)
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	inventory, err := core.ComputeInventaireAu(ctx, &ds, method, to)
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	monthly, err := core.ComputeSacsParMois(ctx, &ds, from, to)
 	if err != nil {
 		s.handleCoreError(w, err)
 		return
 	}
-	inventory, err := core.ComputeInventaire(&ds)
+	monthly = core.LimitSacsParMois(monthly, chartMonths, rollup)
+	avg, err := core.ComputeCoutMoyenParSac(ctx, &ds, method, from, to)
 	if err != nil {
 		s.handleCoreError(w, err)
 		return
 	}
-	monthly, err := core.ComputeSacsParMois(&ds, from, to)
+	avgPerTonne, err := core.ComputeCoutMoyenParTonne(ctx, &ds, method, from, to)
 	if err != nil {
 		s.handleCoreError(w, err)
 		return
 	}
-	avg, err := core.ComputeCoutMoyenParSac(&ds, from, to)
+	stock, err := core.ComputeStockKgParMois(ctx, &ds, from, to)
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	byLocation, err := core.ComputeInventaireParEmplacementAu(ctx, &ds, to)
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	energy, err := core.ComputeEnergie(ctx, &ds, method, from, to)
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	energyMonths, err := core.ComputeKWhParMois(ctx, &ds, from, to)
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	occupancy, err := core.ComputeConsoParOccupation(ctx, &ds, method, from, to)
 	if err != nil {
 		s.handleCoreError(w, err)
 		return
 	}
 
 	response := map[string]any{
-		"investi_cents":            invested,
-		"consomme_cents":           consumed,
-		"consommations_detail":     details,
-		"inventaire":               inventory,
-		"sacs_par_mois":            monthly,
-		"cout_moyen_par_sac_cents": avg,
+		"methode_valorisation":       method,
+		"investi_cents":              invested,
+		"consomme_cents":             consumed,
+		"consommations_detail":       details,
+		"inventaire":                 inventory,
+		"sacs_par_mois":              monthly,
+		"cout_moyen_par_sac_cents":   avg,
+		"cout_moyen_par_tonne_cents": avgPerTonne,
+		"stock_kg_par_mois":          stock,
+		"sacs_par_puissance":         core.ComputeSacsParPuissance(&ds, from, to),
+		"conso_par_occupation":       occupancy,
+		"inventaire_par_emplacement": byLocation,
+		"energie":                    energy,
+		"kwh_par_mois":               energyMonths,
+		"portee":                     newStatsScope(from, to),
+		"avertissements":             checkStats(&ds, inventory, avg, from, to),
 	}
 	s.writeJSON(w, http.StatusOK, response)
 }
 
+// statsScope tells the clients of /api/stats which figures cover the
+// requested range and which ones are a snapshot taken at its end.
+type statsScope struct {
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+	// Range lists the figures restricted to the consumptions and purchases
+	// made between from and to.
+	Range []string `json:"sur_la_periode"`
+	// AsOf lists the figures computed from the whole history up to to, the
+	// current ones without it.
+	AsOf []string `json:"a_la_fin_de_periode"`
+}
+
+func newStatsScope(from, to time.Time) statsScope {
+	scope := statsScope{
+		Range: []string{
+			"investi_cents", "consomme_cents", "consommations_detail", "sacs_par_mois",
+			"cout_moyen_par_sac_cents", "cout_moyen_par_tonne_cents", "stock_kg_par_mois", "sacs_par_puissance", "conso_par_occupation", "energie", "kwh_par_mois",
+		},
+		AsOf: []string{"inventaire", "inventaire_par_emplacement"},
+	}
+	if !from.IsZero() {
+		scope.From = &from
+	}
+	if !to.IsZero() {
+		scope.To = &to
+	}
+	return scope
+}
+
 func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		s.methodNotAllowed(w, http.MethodGet)
+		s.methodNotAllowed(w, r, http.MethodGet)
 		return
 	}
+	s.protectSlowClients(w, r, s.serveExport)
+}
+
+func (s *Server) serveExport(w http.ResponseWriter, r *http.Request) {
 	format := strings.TrimPrefix(r.URL.Path, "/api/export/")
 	switch format {
 	case "json":
 		s.exportJSON(w, r)
 	case "csv":
 		s.exportCSV(w, r)
+	case "images":
+		s.exportImages(w, r)
+	case "brands-comparison":
+		s.exportBrandComparison(w, r)
+	case "pdf":
+		s.exportPDF(w, r)
+	case "settings":
+		s.exportSettings(w, r)
 	default:
-		http.NotFound(w, r)
+		s.notFound(w, r)
 	}
 }
 
-func (s *Server) listBrands(w http.ResponseWriter, _ *http.Request) {
+// listBrands answers the brands that are not archived, every brand with
+// ?include_archived=true.
+func (s *Server) listBrands(w http.ResponseWriter, r *http.Request) {
 	ds := s.store.Data()
-	brands := ds.Brands
+	brands := core.ActiveBrands(ds.Brands)
+	if all, _ := strconv.ParseBool(r.URL.Query().Get("include_archived")); all {
+		brands = append([]core.Brand(nil), ds.Brands...)
+	}
 	sort.Slice(brands, func(i, j int) bool {
 		return strings.ToLower(brands[i].Name) < strings.ToLower(brands[j].Name)
 	})
@@ -569,9 +1452,12 @@ func (s *Server) listBrands(w http.ResponseWriter, _ *http.Request) {
 }
 
 type brandPayload struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	ImageBase64 string `json:"image_base64"`
+	Name           string  `json:"name"`
+	Description    string  `json:"description"`
+	ImageBase64    string  `json:"image_base64"`
+	LeadTimeDays   int     `json:"lead_time_days"`
+	EnergyKWhPerKg float64 `json:"energy_kwh_per_kg"`
+	MinStockBags   int     `json:"min_stock_bags"`
 }
 
 func (s *Server) createBrand(w http.ResponseWriter, r *http.Request) {
@@ -582,9 +1468,12 @@ func (s *Server) createBrand(w http.ResponseWriter, r *http.Request) {
 	}
 	ds := s.store.Data()
 	brand, err := core.AddBrand(&ds, core.CreateBrandParams{
-		Name:        payload.Name,
-		Description: payload.Description,
-		ImageBase64: payload.ImageBase64,
+		Name:           payload.Name,
+		Description:    payload.Description,
+		ImageBase64:    payload.ImageBase64,
+		LeadTimeDays:   payload.LeadTimeDays,
+		EnergyKWhPerKg: payload.EnergyKWhPerKg,
+		MinStockBags:   payload.MinStockBags,
 	})
 	if err != nil {
 		s.handleCoreError(w, err)
@@ -598,9 +1487,133 @@ func (s *Server) createBrand(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, http.StatusCreated, brand)
 }
 
-func (s *Server) listPurchases(w http.ResponseWriter, _ *http.Request) {
+// brandByID serves /api/marques/{id}: PUT replaces the brand, PATCH changes
+// only the fields sent.
+func (s *Server) brandByID(w http.ResponseWriter, r *http.Request, id core.ID) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		s.getBrand(w, r, id)
+	case http.MethodPut:
+		s.replaceBrand(w, r, id)
+	case http.MethodPatch:
+		s.patchBrand(w, r, id)
+	case http.MethodDelete:
+		s.deleteBrand(w, r, id)
+	default:
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete)
+	}
+}
+
+func (s *Server) getBrand(w http.ResponseWriter, r *http.Request, id core.ID) {
+	ds := s.store.Data()
+	brand, ok := findBrand(ds.Brands, id)
+	if !ok {
+		s.handleCoreError(w, core.ErrBrandNotFound)
+		return
+	}
+	s.writeCachedJSON(w, r, brand.UpdatedAt, brand)
+}
+
+// brandReplacePayload is the whole brand sent by PUT /api/marques/{id}. The
+// image, uploaded apart, is kept when image_base64 is left out.
+type brandReplacePayload struct {
+	Name           string  `json:"name"`
+	Description    string  `json:"description"`
+	ImageBase64    *string `json:"image_base64"`
+	LeadTimeDays   int     `json:"lead_time_days"`
+	EnergyKWhPerKg float64 `json:"energy_kwh_per_kg"`
+	MinStockBags   int     `json:"min_stock_bags"`
+	Archived       bool    `json:"archived"`
+	// Revision rejects the update when the brand changed since it was read.
+	Revision *int64 `json:"revision"`
+}
+
+func (s *Server) replaceBrand(w http.ResponseWriter, r *http.Request, id core.ID) {
+	var payload brandReplacePayload
+	if err := decodeJSON(r.Body, &payload); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var brand core.Brand
+	err := s.update(func(ds *core.DataStore) error {
+		current, ok := findBrand(ds.Brands, id)
+		if !ok {
+			return core.ErrBrandNotFound
+		}
+		image := current.ImageBase64
+		if payload.ImageBase64 != nil {
+			image = *payload.ImageBase64
+		}
+		var err error
+		brand, err = core.UpdateBrand(ds, id, core.UpdateBrandParams{
+			Name:             payload.Name,
+			Description:      payload.Description,
+			ImageBase64:      image,
+			LeadTimeDays:     payload.LeadTimeDays,
+			EnergyKWhPerKg:   payload.EnergyKWhPerKg,
+			MinStockBags:     payload.MinStockBags,
+			Archived:         payload.Archived,
+			ExpectedRevision: payload.Revision,
+		})
+		return err
+	})
+	if err != nil {
+		s.handleUpdateError(w, err)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"brand","id":"%s"}`, brand.ID)
+	s.writeJSON(w, http.StatusOK, brand)
+}
+
+func (s *Server) patchBrand(w http.ResponseWriter, r *http.Request, id core.ID) {
+	var payload brandUpdatePayload
+	if err := decodeJSON(r.Body, &payload); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var brand core.Brand
+	err := s.update(func(ds *core.DataStore) error {
+		var err error
+		brand, err = updateBrand(ds, id, payload)
+		return err
+	})
+	if err != nil {
+		s.handleUpdateError(w, err)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"brand","id":"%s"}`, brand.ID)
+	s.writeJSON(w, http.StatusOK, brand)
+}
+
+func (s *Server) deleteBrand(w http.ResponseWriter, _ *http.Request, id core.ID) {
 	ds := s.store.Data()
-	s.writeJSON(w, http.StatusOK, ds.Purchases)
+	if err := core.DeleteBrand(&ds, id); err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	if err := s.store.Replace(ds); err != nil {
+		s.handleStoreError(w, err)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"brand","id":"%s","action":"delete"}`, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listPurchases answers every purchase or, with page or per_page, a page of
+// them.
+func (s *Server) listPurchases(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePageQuery(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	ds := s.store.Data()
+	purchases := ds.Purchases
+	if paged(r) {
+		writePageHeaders(w, r, pageInfo{pageQuery: page, Total: len(purchases)})
+		purchases = pageOf(purchases, page)
+	}
+	s.writeJSON(w, http.StatusOK, purchases)
 }
 
 type purchasePayload struct {
@@ -609,8 +1622,93 @@ type purchasePayload struct {
 	Bags        int     `json:"bags"`
 	BagWeightKg float64 `json:"bag_weight_kg"`
 	WeightKg    float64 `json:"weight_kg"`
-	UnitPrice   int64   `json:"unit_price_cents"`
-	Notes       string  `json:"notes"`
+	UnitPrice   *int64  `json:"unit_price_cents"`
+	// UnitPriceEUR is an alternative to UnitPrice expressed in euros, either
+	// as a JSON number (5.49) or a string ("5,49 €").
+	UnitPriceEUR json.RawMessage `json:"unit_price_eur"`
+	// PricePerTonne and PricePerTonneEUR price a bulk delivery, sent with
+	// weight_kg and no bags.
+	PricePerTonne    *int64          `json:"price_per_tonne_cents"`
+	PricePerTonneEUR json.RawMessage `json:"price_per_tonne_eur"`
+	Location         string          `json:"location"`
+	Notes            string          `json:"notes"`
+	// Revision, on an update, is the revision of the purchase it is based
+	// on; the update is rejected with a 409 when the purchase changed since.
+	Revision *int64 `json:"revision"`
+}
+
+// unitPrice resolves the price from whichever of unit_price_cents or
+// unit_price_eur was provided; sending both is rejected.
+func (p purchasePayload) unitPrice() (core.Money, error) {
+	return payloadAmount(p.UnitPrice, p.UnitPriceEUR, "unit_price_cents", "unit_price_eur")
+}
+
+// pricePerTonne resolves the price of a bulk delivery the same way.
+func (p purchasePayload) pricePerTonne() (core.Money, error) {
+	return payloadAmount(p.PricePerTonne, p.PricePerTonneEUR, "price_per_tonne_cents", "price_per_tonne_eur")
+}
+
+// bulkWeight is the weight of a bulk delivery, zero for bags.
+func (p purchasePayload) bulkWeight() float64 {
+	if p.Bags == 0 {
+		return p.WeightKg
+	}
+	return 0
+}
+
+// payloadAmount reads an amount sent either in cents or in euros, the euros
+// being a JSON number (5.49) or a string ("5,49 €").
+func payloadAmount(cents *int64, eur json.RawMessage, centsField, eurField string) (core.Money, error) {
+	hasEUR := len(eur) > 0 && string(eur) != "null"
+	switch {
+	case hasEUR && cents != nil:
+		return 0, core.ValidationErrors{}.AppendIf(true, eurField, centsField+" and "+eurField+" are mutually exclusive")
+	case hasEUR:
+		var text string
+		if err := json.Unmarshal(eur, &text); err == nil {
+			amount, err := numparse.Money(text)
+			if err != nil {
+				return 0, core.ValidationErrors{}.AppendIf(true, eurField, "invalid euro amount")
+			}
+			return amount, nil
+		}
+		var amount float64
+		if err := json.Unmarshal(eur, &amount); err != nil {
+			return 0, core.ValidationErrors{}.AppendIf(true, eurField, "invalid euro amount")
+		}
+		return core.ParseMoney(amount), nil
+	case cents != nil:
+		return core.Money(*cents), nil
+	default:
+		return 0, nil
+	}
+}
+
+// params converts the payload into the arguments of core.AddPurchase.
+func (p purchasePayload) params() (core.CreatePurchaseParams, error) {
+	purchasedAt, err := parseTime(p.PurchasedAt)
+	if err != nil {
+		return core.CreatePurchaseParams{}, err
+	}
+	unitPrice, err := p.unitPrice()
+	if err != nil {
+		return core.CreatePurchaseParams{}, err
+	}
+	pricePerTonne, err := p.pricePerTonne()
+	if err != nil {
+		return core.CreatePurchaseParams{}, err
+	}
+	return core.CreatePurchaseParams{
+		BrandID:       p.BrandID,
+		PurchasedAt:   purchasedAt,
+		Bags:          p.Bags,
+		BagWeightKg:   p.effectiveBagWeight(),
+		UnitPrice:     unitPrice,
+		WeightKg:      p.bulkWeight(),
+		PricePerTonne: pricePerTonne,
+		Location:      p.Location,
+		Notes:         p.Notes,
+	}, nil
 }
 
 func (p purchasePayload) effectiveBagWeight() float64 {
@@ -624,39 +1722,61 @@ func (p purchasePayload) effectiveBagWeight() float64 {
 }
 
 func parseIntField(value string) (int, error) {
-	return strconv.Atoi(strings.TrimSpace(value))
+	return numparse.Int(value)
 }
 
 func parseFloatField(value string) (float64, error) {
-	cleaned := strings.ReplaceAll(strings.TrimSpace(value), ",", ".")
-	return strconv.ParseFloat(cleaned, 64)
+	return numparse.Float(value)
 }
 
 func parseMoneyField(value string) (core.Money, error) {
-	cleaned := strings.ReplaceAll(strings.TrimSpace(value), ",", ".")
-	if cleaned == "" {
-		return 0, fmt.Errorf("prix unitaire requis")
-	}
-	amount, err := strconv.ParseFloat(cleaned, 64)
-	if err != nil {
-		return 0, fmt.Errorf("prix invalide: %w", err)
+	amount, err := numparse.Money(value)
+	switch {
+	case errors.Is(err, numparse.ErrEmpty):
+		return 0, errors.New("prix unitaire requis")
+	case err != nil:
+		return 0, errors.New("prix unitaire invalide")
 	}
 	if amount < 0 {
 		return 0, errors.New("le prix ne peut pas être négatif")
 	}
-	return core.ParseMoney(amount), nil
+	return amount, nil
 }
 
+// formDateLayouts are the dates the forms accept: the value of a date input,
+// and the day typed by hand in browsers that render it as a text field.
+var formDateLayouts = []string{"2006-01-02", "02/01/2006"}
+
 func parseDateOnly(value string) (time.Time, error) {
 	v := strings.TrimSpace(value)
 	if v == "" {
 		return time.Time{}, fmt.Errorf("date requise")
 	}
-	t, err := time.ParseInLocation("2006-01-02", v, time.UTC)
-	if err != nil {
-		return time.Time{}, err
+	var err error
+	for _, layout := range formDateLayouts {
+		var t time.Time
+		if t, err = time.ParseInLocation(layout, v, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// parseDuplicateDate reads the date query parameter of the duplicate endpoint:
+// empty or "today" means the current day, otherwise a YYYY-MM-DD date.
+func parseDuplicateDate(value string) (time.Time, error) {
+	v := strings.TrimSpace(value)
+	if v == "" || v == "today" {
+		return today(), nil
 	}
-	return t, nil
+	return parseDateOnly(v)
+}
+
+// today returns the current day at midnight UTC, matching dates entered
+// through the HTML forms.
+func today() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
 }
 
 func parseTime(value string) (time.Time, error) {
@@ -672,20 +1792,13 @@ func (s *Server) createPurchase(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, http.StatusBadRequest, err)
 		return
 	}
-	purchasedAt, err := parseTime(payload.PurchasedAt)
+	params, err := payload.params()
 	if err != nil {
-		s.writeError(w, http.StatusBadRequest, err)
+		s.writeValidationError(w, err)
 		return
 	}
 	ds := s.store.Data()
-	purchase, err := core.AddPurchase(&ds, core.CreatePurchaseParams{
-		BrandID:     payload.BrandID,
-		PurchasedAt: purchasedAt,
-		Bags:        payload.Bags,
-		BagWeightKg: payload.effectiveBagWeight(),
-		UnitPrice:   core.Money(payload.UnitPrice),
-		Notes:       payload.Notes,
-	})
+	purchase, err := core.AddPurchase(&ds, params)
 	if err != nil {
 		s.handleCoreError(w, err)
 		return
@@ -709,20 +1822,34 @@ func (s *Server) updatePurchase(w http.ResponseWriter, r *http.Request, id core.
 		s.writeError(w, http.StatusBadRequest, err)
 		return
 	}
-	ds := s.store.Data()
-	purchase, err := core.UpdatePurchase(&ds, id, core.UpdatePurchaseParams{
-		PurchasedAt: purchasedAt,
-		Bags:        payload.Bags,
-		BagWeightKg: payload.effectiveBagWeight(),
-		UnitPrice:   core.Money(payload.UnitPrice),
-		Notes:       payload.Notes,
-	})
+	unitPrice, err := payload.unitPrice()
 	if err != nil {
-		s.handleCoreError(w, err)
+		s.writeValidationError(w, err)
 		return
 	}
-	if err := s.store.Replace(ds); err != nil {
-		s.handleStoreError(w, err)
+	pricePerTonne, err := payload.pricePerTonne()
+	if err != nil {
+		s.writeValidationError(w, err)
+		return
+	}
+	var purchase core.Purchase
+	err = s.update(func(ds *core.DataStore) error {
+		var err error
+		purchase, err = core.UpdatePurchase(ds, id, core.UpdatePurchaseParams{
+			PurchasedAt:      purchasedAt,
+			Bags:             payload.Bags,
+			BagWeightKg:      payload.effectiveBagWeight(),
+			UnitPrice:        unitPrice,
+			WeightKg:         payload.bulkWeight(),
+			PricePerTonne:    pricePerTonne,
+			Location:         payload.Location,
+			Notes:            payload.Notes,
+			ExpectedRevision: payload.Revision,
+		})
+		return err
+	})
+	if err != nil {
+		s.handleUpdateError(w, err)
 		return
 	}
 	log.Printf(`{"type":"save","entity":"purchase","id":"%s"}`, purchase.ID)
@@ -743,16 +1870,77 @@ func (s *Server) deletePurchase(w http.ResponseWriter, _ *http.Request, id core.
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// consumptionPayload accepts a part of a bag either in bags, as 1.5, or in
+// bags_fraction as the consumptions are returned.
 type consumptionPayload struct {
-	BrandID    core.ID `json:"brand_id"`
-	ConsumedAt string  `json:"consumed_at"`
-	Bags       int     `json:"bags"`
-	Notes      string  `json:"notes"`
-}
-
-func (s *Server) listConsumptions(w http.ResponseWriter, _ *http.Request) {
+	BrandID      core.ID `json:"brand_id"`
+	ConsumedAt   string  `json:"consumed_at"`
+	Bags         float64 `json:"bags"`
+	BagsFraction float64 `json:"bags_fraction"`
+	WeightKg     float64 `json:"weight_kg"`
+	PowerLevel   int     `json:"power_level"`
+	Notes        string  `json:"notes"`
+	// Revision, on an update, is the revision of the consumption it is
+	// based on; the update is rejected with a 409 when it changed since.
+	Revision *int64 `json:"revision"`
+}
+
+// params converts the payload into the arguments of core.AddConsumption.
+func (p consumptionPayload) params() (core.CreateConsumptionParams, error) {
+	consumedAt, err := parseTime(p.ConsumedAt)
+	if err != nil {
+		return core.CreateConsumptionParams{}, err
+	}
+	bags, fraction := core.SplitBags(p.Bags + p.BagsFraction)
+	return core.CreateConsumptionParams{
+		BrandID:      p.BrandID,
+		ConsumedAt:   consumedAt,
+		Bags:         bags,
+		BagsFraction: fraction,
+		WeightKg:     p.WeightKg,
+		PowerLevel:   p.PowerLevel,
+		Notes:        p.Notes,
+	}, nil
+}
+
+// consumptionResponse is a consumption with the FIFO cost of its bags, left
+// out when the history cannot be valued.
+type consumptionResponse struct {
+	core.Consumption
+	TotalPrice      *core.Money `json:"total_price_cents,omitempty"`
+	BlendedBagPrice *core.Money `json:"blended_bag_price_cents,omitempty"`
+}
+
+// listConsumptions answers every consumption with its price or, with page
+// or per_page, a page of them.
+func (s *Server) listConsumptions(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePageQuery(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
 	ds := s.store.Data()
-	s.writeJSON(w, http.StatusOK, ds.Consumptions)
+	ctx, cancel := s.computeContext(r)
+	defer cancel()
+	costs, err := consumptionCosts(ctx, &ds, s.costing)
+	if isContextError(err) {
+		s.handleCoreError(w, err)
+		return
+	}
+	consumptions := ds.Consumptions
+	if paged(r) {
+		writePageHeaders(w, r, pageInfo{pageQuery: page, Total: len(consumptions)})
+		consumptions = pageOf(consumptions, page)
+	}
+	resp := make([]consumptionResponse, len(consumptions))
+	for i, consumption := range consumptions {
+		resp[i] = consumptionResponse{Consumption: consumption}
+		if cost, ok := costs[consumption.ID]; ok {
+			resp[i].TotalPrice = &cost.TotalPrice
+			resp[i].BlendedBagPrice = &cost.BlendedBagPrice
+		}
+	}
+	s.writeJSON(w, http.StatusOK, resp)
 }
 
 func (s *Server) createConsumption(w http.ResponseWriter, r *http.Request) {
@@ -761,18 +1949,13 @@ func (s *Server) createConsumption(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, http.StatusBadRequest, err)
 		return
 	}
-	consumedAt, err := parseTime(payload.ConsumedAt)
+	params, err := payload.params()
 	if err != nil {
 		s.writeError(w, http.StatusBadRequest, err)
 		return
 	}
 	ds := s.store.Data()
-	consumption, err := core.AddConsumption(&ds, core.CreateConsumptionParams{
-		BrandID:    payload.BrandID,
-		ConsumedAt: consumedAt,
-		Bags:       payload.Bags,
-		Notes:      payload.Notes,
-	})
+	consumption, err := core.AddConsumption(&ds, params)
 	if err != nil {
 		s.handleCoreError(w, err)
 		return
@@ -791,17 +1974,41 @@ func (s *Server) updateConsumption(w http.ResponseWriter, r *http.Request, id co
 		s.writeError(w, http.StatusBadRequest, err)
 		return
 	}
-	consumedAt, err := parseTime(payload.ConsumedAt)
+	params, err := payload.params()
 	if err != nil {
 		s.writeError(w, http.StatusBadRequest, err)
 		return
 	}
-	ds := s.store.Data()
-	consumption, err := core.UpdateConsumption(&ds, id, core.UpdateConsumptionParams{
-		ConsumedAt: consumedAt,
-		Bags:       payload.Bags,
-		Notes:      payload.Notes,
+	var consumption core.Consumption
+	err = s.update(func(ds *core.DataStore) error {
+		var err error
+		consumption, err = core.UpdateConsumption(ds, id, core.UpdateConsumptionParams{
+			ConsumedAt:       params.ConsumedAt,
+			Bags:             params.Bags,
+			BagsFraction:     params.BagsFraction,
+			WeightKg:         params.WeightKg,
+			PowerLevel:       params.PowerLevel,
+			Notes:            params.Notes,
+			ExpectedRevision: payload.Revision,
+		})
+		return err
 	})
+	if err != nil {
+		s.handleUpdateError(w, err)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"consumption","id":"%s"}`, consumption.ID)
+	s.writeJSON(w, http.StatusOK, consumption)
+}
+
+func (s *Server) duplicateConsumption(w http.ResponseWriter, r *http.Request, id core.ID) {
+	consumedAt, err := parseDuplicateDate(r.URL.Query().Get("date"))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	ds := s.store.Data()
+	consumption, err := core.DuplicateConsumption(&ds, id, consumedAt)
 	if err != nil {
 		s.handleCoreError(w, err)
 		return
@@ -810,8 +2017,8 @@ func (s *Server) updateConsumption(w http.ResponseWriter, r *http.Request, id co
 		s.handleStoreError(w, err)
 		return
 	}
-	log.Printf(`{"type":"save","entity":"consumption","id":"%s"}`, consumption.ID)
-	s.writeJSON(w, http.StatusOK, consumption)
+	log.Printf(`{"type":"save","entity":"consumption","id":"%s","action":"duplicate","source":"%s"}`, consumption.ID, id)
+	s.writeJSON(w, http.StatusCreated, consumption)
 }
 
 func (s *Server) deleteConsumption(w http.ResponseWriter, _ *http.Request, id core.ID) {
@@ -830,19 +2037,39 @@ func (s *Server) deleteConsumption(w http.ResponseWriter, _ *http.Request, id co
 
 func (s *Server) exportJSON(w http.ResponseWriter, _ *http.Request) {
 	ds := s.store.Data()
+	// The export can be downloaded without signing in: password and token
+	// hashes stay on the server.
+	ds.Users = nil
+	ds.APITokens = nil
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Content-Disposition", "attachment; filename=pellets-datastore.json")
-	if err := json.NewEncoder(w).Encode(ds); err != nil {
+	// The export is meant to be read and archived by people, so it stays
+	// pretty-printed whatever the storage format.
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(ds); err != nil {
 		log.Printf("export json: %v", err)
 	}
 }
 
-func (s *Server) exportCSV(w http.ResponseWriter, _ *http.Request) {
+func (s *Server) exportCSV(w http.ResponseWriter, r *http.Request) {
+	format, err := s.csvExportFormat(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
 	ds := s.store.Data()
+	ctx, cancel := s.computeContext(r)
+	defer cancel()
+	costs, err := consumptionCosts(ctx, &ds, s.costing)
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
 	w.Header().Set("Content-Type", "text/csv")
 	w.Header().Set("Content-Disposition", "attachment; filename=pellets-export.csv")
 
-	writer := csv.NewWriter(w)
+	writer := format.writer(w)
 	header := []string{"type", "id", "brand_id", "brand_name", "timestamp", "bags", "weight_kg", "unit_price_cents", "total_price_cents", "notes"}
 	if err := writer.Write(header); err != nil {
 		log.Printf("export csv header: %v", err)
@@ -860,9 +2087,9 @@ func (s *Server) exportCSV(w http.ResponseWriter, _ *http.Request) {
 			string(purchase.ID),
 			string(purchase.BrandID),
 			brandNames[purchase.BrandID],
-			purchase.PurchasedAt.Format(time.RFC3339),
+			format.date(purchase.PurchasedAt),
 			itoaInt(purchase.Bags),
-			formatFloat(purchase.TotalWeightKg),
+			format.number(formatFloat(purchase.TotalWeightKg)),
 			itoaMoney(purchase.UnitPriceCents),
 			itoaMoney(purchase.TotalPriceCents),
 			purchase.Notes,
@@ -874,16 +2101,25 @@ func (s *Server) exportCSV(w http.ResponseWriter, _ *http.Request) {
 	}
 
 	for _, consumption := range ds.Consumptions {
+		weight := ""
+		if consumption.WeightKg > 0 {
+			weight = format.number(formatFloat(consumption.WeightKg))
+		}
+		unitPrice, totalPrice := "", ""
+		if cost, ok := costs[consumption.ID]; ok {
+			unitPrice = itoaMoney(cost.BlendedBagPrice)
+			totalPrice = itoaMoney(cost.TotalPrice)
+		}
 		record := []string{
 			"consumption",
 			string(consumption.ID),
 			string(consumption.BrandID),
 			brandNames[consumption.BrandID],
-			consumption.ConsumedAt.Format(time.RFC3339),
-			itoaInt(consumption.Bags),
-			"",
-			"",
-			"",
+			format.date(consumption.ConsumedAt),
+			format.number(formatFloat(consumption.TotalBags())),
+			weight,
+			unitPrice,
+			totalPrice,
 			consumption.Notes,
 		}
 		if err := writer.Write(record); err != nil {
@@ -904,10 +2140,38 @@ func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 		start := time.Now()
 		next.ServeHTTP(lrw, r)
 		duration := time.Since(start)
+		if !s.shouldLog(r.URL.Path, lrw.status) {
+			return
+		}
 		log.Printf("%s %s %d %s", r.Method, r.URL.Path, lrw.status, duration)
 	})
 }
 
+// shouldLog reports whether a request is worth a log line: failures always
+// are, excluded paths only once every logSampleEvery requests.
+func (s *Server) shouldLog(path string, status int) bool {
+	if status >= http.StatusBadRequest || !s.logExcluded(path) {
+		return true
+	}
+	if s.logSampleEvery == 0 {
+		return false
+	}
+	return s.logSkipped.Add(1)%s.logSampleEvery == 0
+}
+
+func (s *Server) logExcluded(path string) bool {
+	for _, excluded := range s.logExclude {
+		if strings.HasSuffix(excluded, "/") {
+			if strings.HasPrefix(path, excluded) {
+				return true
+			}
+		} else if path == excluded {
+			return true
+		}
+	}
+	return false
+}
+
 type loggingResponseWriter struct {
 	http.ResponseWriter
 	status int
@@ -925,6 +2189,10 @@ func (w *loggingResponseWriter) Write(b []byte) (int, error) {
 	return w.ResponseWriter.Write(b)
 }
 
+func (w *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 func (s *Server) gzipMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
@@ -956,6 +2224,10 @@ func (w *gzipResponseWriter) WriteHeader(status int) {
 	w.ResponseWriter.WriteHeader(status)
 }
 
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 func decodeJSON(r io.Reader, dst any) error {
 	decoder := json.NewDecoder(r)
 	decoder.DisallowUnknownFields()
@@ -971,6 +2243,12 @@ func decodeJSON(r io.Reader, dst any) error {
 	return nil
 }
 
+// decodeJSONLenient decodes a single JSON document while ignoring unknown
+// fields, for payloads produced by third-party tools.
+func decodeJSONLenient(r io.Reader, dst any) error {
+	return json.NewDecoder(r).Decode(dst)
+}
+
 func (s *Server) writeJSON(w http.ResponseWriter, status int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -983,26 +2261,50 @@ func (s *Server) writeError(w http.ResponseWriter, status int, err error) {
 	s.writeJSON(w, status, map[string]any{"error": err.Error()})
 }
 
-func (s *Server) methodNotAllowed(w http.ResponseWriter, allowed ...string) {
-	if len(allowed) > 0 {
-		w.Header().Set("Allow", strings.Join(allowed, ","))
-	}
-	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-}
-
 func (s *Server) handleStoreError(w http.ResponseWriter, err error) {
 	log.Printf("store error: %v", err)
+	if errors.Is(err, store.ErrReadOnly) {
+		s.writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
 	s.writeError(w, http.StatusInternalServerError, errors.New("failed to persist datastore"))
 }
 
-func (s *Server) handleCoreError(w http.ResponseWriter, err error) {
+// coreErrorStatus maps the business errors of core to an HTTP status.
+func coreErrorStatus(err error) (int, bool) {
 	switch {
-	case errors.Is(err, core.ErrBrandNotFound), errors.Is(err, core.ErrPurchaseNotFound), errors.Is(err, core.ErrConsumptionNotFound):
-		s.writeError(w, http.StatusNotFound, err)
-	case errors.Is(err, core.ErrBrandInUse), errors.Is(err, core.ErrInsufficientInventory):
-		s.writeError(w, http.StatusConflict, err)
+	case errors.Is(err, core.ErrBrandNotFound), errors.Is(err, core.ErrPurchaseNotFound), errors.Is(err, core.ErrConsumptionNotFound), errors.Is(err, core.ErrUserNotFound), errors.Is(err, core.ErrAPITokenNotFound), errors.Is(err, core.ErrSiloNotFound),
+		errors.Is(err, core.ErrStorageLocationNotFound), errors.Is(err, core.ErrSeasonNotFound), errors.Is(err, core.ErrPhotoNotFound):
+		return http.StatusNotFound, true
+	case errors.Is(err, core.ErrBrandInUse), errors.Is(err, core.ErrInsufficientInventory), errors.Is(err, core.ErrLastUser), errors.Is(err, core.ErrLastAdmin), errors.Is(err, core.ErrConflict):
+		return http.StatusConflict, true
 	case isValidationError(err):
-		s.writeValidationError(w, err)
+		return http.StatusBadRequest, true
+	default:
+		return 0, false
+	}
+}
+
+func (s *Server) handleCoreError(w http.ResponseWriter, err error) {
+	// A stale update tells the client which revision to reload.
+	var conflict *core.ConflictError
+	if errors.As(err, &conflict) {
+		s.writeJSON(w, http.StatusConflict, map[string]any{"error": err.Error(), "conflict": conflict})
+		return
+	}
+	if status, ok := coreErrorStatus(err); ok {
+		if status == http.StatusBadRequest {
+			s.writeValidationError(w, err)
+			return
+		}
+		s.writeError(w, status, err)
+		return
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		s.writeError(w, http.StatusServiceUnavailable, errors.New("computation timed out"))
+	case errors.Is(err, context.Canceled):
+		// The client disconnected before the computation finished.
 	default:
 		log.Printf("core error: %v", err)
 		s.writeError(w, http.StatusInternalServerError, errors.New("internal error"))
@@ -1045,6 +2347,37 @@ func parseRangeQuery(r *http.Request) (time.Time, time.Time, error) {
 	return from, to, nil
 }
 
+// costingMethod returns the costing method picked by the costing query
+// parameter, the configured one without it.
+func (s *Server) costingMethod(r *http.Request) (core.CostingMethod, error) {
+	value := r.URL.Query().Get("costing")
+	if value == "" {
+		return s.costing, nil
+	}
+	return core.ParseCostingMethod(value)
+}
+
+// chartLimit reads how the monthly chart is shortened from the months and
+// rollup query parameters, the server defaults without them.
+func (s *Server) chartLimit(r *http.Request) (int, core.ChartRollup, error) {
+	months, rollup := s.chartMonths, s.chartRollup
+	if value := r.URL.Query().Get("months"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return 0, "", fmt.Errorf("invalid months %q: must be a positive number or 0", value)
+		}
+		months = parsed
+	}
+	if value := r.URL.Query().Get("rollup"); value != "" {
+		parsed, err := core.ParseChartRollup(value)
+		if err != nil {
+			return 0, "", err
+		}
+		rollup = parsed
+	}
+	return months, rollup, nil
+}
+
 func itoaInt(value int) string {
 	return strconv.FormatInt(int64(value), 10)
 }
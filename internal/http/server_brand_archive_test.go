@@ -0,0 +1,108 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_brandArchive(t *testing.T) {
+	t.Parallel()
+
+	newData := func() core.DataStore {
+		return core.DataStore{Brands: []core.Brand{
+			{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"},
+			{Meta: core.Meta{ID: "brand-o"}, Name: "Ancienne", Archived: true},
+		}}
+	}
+
+	type params struct {
+		method string
+		path   string
+	}
+	type want struct {
+		statusCode   int
+		location     string
+		bodyContains []string
+		bodyExcludes []string
+		// archived is the archived flag of brand-w afterwards.
+		archived bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "lists the active brands",
+			params: params{method: http.MethodGet, path: "/api/marques"},
+			want:   want{statusCode: http.StatusOK, bodyContains: []string{`"name":"Woodstock"`}, bodyExcludes: []string{"Ancienne"}},
+		},
+		{
+			name:   "lists the archived brands on request",
+			params: params{method: http.MethodGet, path: "/api/marques?include_archived=true"},
+			want:   want{statusCode: http.StatusOK, bodyContains: []string{`"name":"Ancienne","archived":true`, `"name":"Woodstock"`}},
+		},
+		{
+			name:   "archives a brand",
+			params: params{method: http.MethodPost, path: "/api/marques/brand-w/archiver"},
+			want:   want{statusCode: http.StatusOK, bodyContains: []string{`"archived":true`}, archived: true},
+		},
+		{
+			name:   "reports unknown brands",
+			params: params{method: http.MethodPost, path: "/api/marques/missing/archiver"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+		{
+			name:   "archives from the brands page",
+			params: params{method: http.MethodPost, path: "/marques/brand-w/archiver"},
+			want:   want{statusCode: http.StatusSeeOther, location: "/marques?archived=true#marque-brand-w", archived: true},
+		},
+		{
+			name:   "keeps archived brands out of the forms",
+			params: params{method: http.MethodGet, path: "/consommations"},
+			want:   want{statusCode: http.StatusOK, bodyContains: []string{`<option value="brand-w"`}, bodyExcludes: []string{`<option value="brand-o"`}},
+		},
+		{
+			name:   "shows archived brands on the brands page",
+			params: params{method: http.MethodGet, path: "/marques"},
+			want: want{statusCode: http.StatusOK, bodyContains: []string{
+				`class="brand-card archived" id="marque-brand-o"`,
+				`action="/marques/brand-o/desarchiver"`,
+				"2 marques enregistrées · 1 active",
+			}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: newData()}
+			server := NewServer(store, Config{})
+			req := httptest.NewRequest(tc.params.method, tc.params.path, nil)
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.location, rec.Header().Get("Location"), tc.name)
+			for _, fragment := range tc.want.bodyContains {
+				assert.Contains(t, rec.Body.String(), fragment, tc.name)
+			}
+			for _, fragment := range tc.want.bodyExcludes {
+				assert.NotContains(t, rec.Body.String(), fragment, tc.name)
+			}
+			brands := store.Data().Brands
+			require.NotEmpty(t, brands, tc.name)
+			assert.Equal(t, tc.want.archived, brands[0].Archived, tc.name)
+		})
+	}
+}
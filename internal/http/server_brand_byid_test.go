@@ -0,0 +1,119 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_brandByID(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, time.October, 1, 8, 0, 0, 0, time.UTC)
+	newData := func() core.DataStore {
+		return core.DataStore{
+			Brands: []core.Brand{
+				{Meta: core.Meta{ID: "brand-w", CreatedAt: now, UpdatedAt: now, Revision: 2}, Name: "Woodstock", Description: "Résineux", ImageBase64: "aW1n", MinStockBags: 5},
+				{Meta: core.Meta{ID: "brand-p", CreatedAt: now, UpdatedAt: now}, Name: "Piveteau"},
+			},
+			Purchases: []core.Purchase{
+				{Meta: core.Meta{ID: "purchase-1", CreatedAt: now, UpdatedAt: now}, BrandID: "brand-w", PurchasedAt: now, Bags: 10, BagWeightKg: 15},
+			},
+		}
+	}
+
+	type params struct {
+		method string
+		path   string
+		body   string
+	}
+	type want struct {
+		statusCode   int
+		bodyContains []string
+		// brands lists the name, description and image of each brand left.
+		brands []string
+	}
+
+	unchanged := []string{"Woodstock/Résineux/aW1n", "Piveteau//"}
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "returns a brand",
+			params: params{method: http.MethodGet, path: "/api/marques/brand-w"},
+			want:   want{statusCode: http.StatusOK, bodyContains: []string{`"name":"Woodstock"`, `"min_stock_bags":5`}, brands: unchanged},
+		},
+		{
+			name:   "reports an unknown brand",
+			params: params{method: http.MethodGet, path: "/api/marques/missing"},
+			want:   want{statusCode: http.StatusNotFound, brands: unchanged},
+		},
+		{
+			name:   "replaces a brand and keeps its image",
+			params: params{method: http.MethodPut, path: "/api/marques/brand-w", body: `{"name":"Woodstock Premium","min_stock_bags":8}`},
+			want:   want{statusCode: http.StatusOK, bodyContains: []string{`"name":"Woodstock Premium"`, `"min_stock_bags":8`}, brands: []string{"Woodstock Premium//aW1n", "Piveteau//"}},
+		},
+		{
+			name:   "patches the fields sent only",
+			params: params{method: http.MethodPatch, path: "/api/marques/brand-w", body: `{"description":"Feuillus","revision":2}`},
+			want:   want{statusCode: http.StatusOK, bodyContains: []string{`"description":"Feuillus"`, `"min_stock_bags":5`}, brands: []string{"Woodstock/Feuillus/aW1n", "Piveteau//"}},
+		},
+		{
+			name:   "rejects a stale revision",
+			params: params{method: http.MethodPatch, path: "/api/marques/brand-w", body: `{"description":"Feuillus","revision":1}`},
+			want:   want{statusCode: http.StatusConflict, brands: unchanged},
+		},
+		{
+			name:   "rejects an invalid brand",
+			params: params{method: http.MethodPut, path: "/api/marques/brand-w", body: `{"name":"Piveteau"}`},
+			want:   want{statusCode: http.StatusBadRequest, bodyContains: []string{"brand name already exists"}, brands: unchanged},
+		},
+		{
+			name:   "deletes an unused brand",
+			params: params{method: http.MethodDelete, path: "/api/marques/brand-p"},
+			want:   want{statusCode: http.StatusNoContent, brands: []string{"Woodstock/Résineux/aW1n"}},
+		},
+		{
+			name:   "refuses to delete a brand in use",
+			params: params{method: http.MethodDelete, path: "/api/marques/brand-w"},
+			want:   want{statusCode: http.StatusConflict, brands: unchanged},
+		},
+		{
+			name:   "rejects other methods",
+			params: params{method: http.MethodPost, path: "/api/marques/brand-w"},
+			want:   want{statusCode: http.StatusMethodNotAllowed, brands: unchanged},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: newData()}
+			server := NewServer(store, Config{})
+			req := httptest.NewRequest(tc.params.method, tc.params.path, strings.NewReader(tc.params.body))
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			for _, fragment := range tc.want.bodyContains {
+				assert.Contains(t, rec.Body.String(), fragment, tc.name)
+			}
+			var brands []string
+			for _, brand := range store.Data().Brands {
+				brands = append(brands, brand.Name+"/"+brand.Description+"/"+brand.ImageBase64)
+			}
+			assert.Equal(t, tc.want.brands, brands, tc.name)
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"image"
 	"image/color"
+	"image/jpeg"
 	"image/png"
 	"testing"
 
@@ -22,14 +23,41 @@ func TestServer_encodeBrandImage(t *testing.T) {
 		require.NoError(t, png.Encode(&buf, img))
 		return buf.Bytes()
 	}
+	makeJPEG := func(width, height int) []byte {
+		img := imaging.New(width, height, color.NRGBA{R: 100, G: 150, B: 200, A: 255})
+		var buf bytes.Buffer
+		require.NoError(t, jpeg.Encode(&buf, img, nil))
+		return buf.Bytes()
+	}
+	// makeLogo draws an opaque square in the middle of a transparent image.
+	makeLogo := func(width, height int) []byte {
+		img := imaging.New(width, height, color.NRGBA{})
+		for x := width / 4; x < width*3/4; x++ {
+			for y := height / 4; y < height*3/4; y++ {
+				img.Set(x, y, color.NRGBA{R: 200, A: 255})
+			}
+		}
+		var buf bytes.Buffer
+		require.NoError(t, png.Encode(&buf, img))
+		return buf.Bytes()
+	}
 
 	type params struct {
 		data     []byte
 		maxBytes int64
+		width    int
+		quality  int
+		format   string
 	}
 	type want struct {
 		expectErr   error
 		expectWidth int
+		// expectFormat is the format the stored image decodes as, when set.
+		expectFormat string
+		// expectUnchanged requires the upload to be stored as is.
+		expectUnchanged bool
+		// expectCorner is the color of the top left pixel, when set.
+		expectCorner color.Color
 	}
 
 	tcs := []struct {
@@ -39,12 +67,35 @@ func TestServer_encodeBrandImage(t *testing.T) {
 	}{
 		{
 			name: "resizes wider images to target width",
+			params: params{
+				data:     makeImage(1200, 600),
+				maxBytes: 5 * 1024 * 1024,
+				width:    defaultBrandImageWidth,
+			},
+			want: want{
+				expectWidth: defaultBrandImageWidth,
+			},
+		},
+		{
+			name: "resizes to a configured width",
+			params: params{
+				data:     makeImage(1200, 600),
+				maxBytes: 5 * 1024 * 1024,
+				width:    1000,
+				quality:  95,
+			},
+			want: want{
+				expectWidth: 1000,
+			},
+		},
+		{
+			name: "keeps original width when resizing is disabled",
 			params: params{
 				data:     makeImage(1200, 600),
 				maxBytes: 5 * 1024 * 1024,
 			},
 			want: want{
-				expectWidth: brandImageTargetWidth,
+				expectWidth: 1200,
 			},
 		},
 		{
@@ -52,11 +103,76 @@ func TestServer_encodeBrandImage(t *testing.T) {
 			params: params{
 				data:     makeImage(600, 400),
 				maxBytes: 5 * 1024 * 1024,
+				width:    defaultBrandImageWidth,
 			},
 			want: want{
 				expectWidth: 600,
 			},
 		},
+		{
+			name: "stores photos as JPEG",
+			params: params{
+				data:     makeJPEG(400, 300),
+				maxBytes: 5 * 1024 * 1024,
+				width:    defaultBrandImageWidth,
+			},
+			want: want{
+				expectWidth:  400,
+				expectFormat: "jpeg",
+			},
+		},
+		{
+			name: "keeps a PNG upload as is",
+			params: params{
+				data:     makeLogo(200, 100),
+				maxBytes: 5 * 1024 * 1024,
+				width:    defaultBrandImageWidth,
+			},
+			want: want{
+				expectWidth:     200,
+				expectFormat:    "png",
+				expectUnchanged: true,
+				expectCorner:    color.NRGBA{},
+			},
+		},
+		{
+			name: "keeps the transparency of a resized logo",
+			params: params{
+				data:     makeLogo(1200, 600),
+				maxBytes: 5 * 1024 * 1024,
+				width:    defaultBrandImageWidth,
+			},
+			want: want{
+				expectWidth:  defaultBrandImageWidth,
+				expectFormat: "png",
+				expectCorner: color.NRGBA{},
+			},
+		},
+		{
+			name: "fills transparent areas in white as JPEG",
+			params: params{
+				data:     makeLogo(200, 100),
+				maxBytes: 5 * 1024 * 1024,
+				format:   BrandImageFormatJPEG,
+			},
+			want: want{
+				expectWidth:  200,
+				expectFormat: "jpeg",
+				expectCorner: color.NRGBA{R: 255, G: 255, B: 255, A: 255},
+			},
+		},
+		{
+			name: "stores photos as PNG when configured",
+			params: params{
+				data:     makeJPEG(400, 300),
+				maxBytes: 5 * 1024 * 1024,
+				format:   BrandImageFormatPNG,
+			},
+			want: want{
+				expectWidth:  400,
+				expectFormat: "png",
+			},
+		},
 		{
 			name: "fails when exceeding max size",
 			params: params{
@@ -84,7 +200,12 @@ func TestServer_encodeBrandImage(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
 
-			server := &Server{maxBrandImageBytes: tc.params.maxBytes}
+			server := &Server{
+				maxBrandImageBytes: tc.params.maxBytes,
+				brandImageWidth:    tc.params.width,
+				brandImageQuality:  tc.params.quality,
+				brandImageFormat:   tc.params.format,
+			}
 
 			got, err := server.encodeBrandImage(bytes.NewReader(tc.params.data))
 			if tc.want.expectErr != nil {
@@ -98,9 +219,18 @@ func TestServer_encodeBrandImage(t *testing.T) {
 
 			raw, err := base64.StdEncoding.DecodeString(got)
 			require.NoError(t, err, tc.name)
-			img, _, err := image.Decode(bytes.NewReader(raw))
+			img, format, err := image.Decode(bytes.NewReader(raw))
 			require.NoError(t, err, tc.name)
 			assert.Equal(t, tc.want.expectWidth, img.Bounds().Dx(), tc.name)
+			if tc.want.expectFormat != "" {
+				assert.Equal(t, tc.want.expectFormat, format, tc.name)
+			}
+			if tc.want.expectUnchanged {
+				assert.Equal(t, tc.params.data, raw, tc.name)
+			}
+			if tc.want.expectCorner != nil {
+				assert.Equal(t, tc.want.expectCorner, color.NRGBAModel.Convert(img.At(0, 0)), tc.name)
+			}
 		})
 	}
 }
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/disintegration/imaging"
 	"github.com/stretchr/testify/assert"
@@ -53,7 +54,7 @@ func TestServer_handleBrandsPagePost(t *testing.T) {
 			want: want{
 				statusCode:     http.StatusSeeOther,
 				expectRedirect: true,
-				expectedWidth:  brandImageTargetWidth,
+				expectedWidth:  defaultBrandImageWidth,
 			},
 		},
 		{
@@ -128,10 +129,12 @@ func TestServer_handleBrandsPageGet(t *testing.T) {
 
 	type params struct {
 		existingBrand *core.Brand
+		purchases     []core.Purchase
+		marketPrices  []core.MarketPrice
 	}
 	type want struct {
-		statusCode      int
-		expectImageHTML string
+		statusCode int
+		expectHTML []string
 	}
 
 	tcs := []struct {
@@ -149,8 +152,40 @@ func TestServer_handleBrandsPageGet(t *testing.T) {
 				},
 			},
 			want: want{
-				statusCode:      http.StatusOK,
-				expectImageHTML: `src="data:image/jpeg;base64,QUJD"`,
+				statusCode: http.StatusOK,
+				expectHTML: []string{`src="data:image/jpeg;base64,QUJD"`},
+			},
+		},
+		{
+			name: "draws the yearly bag price",
+			params: params{
+				existingBrand: &core.Brand{Meta: core.Meta{ID: "brand-a"}, Name: "Alpha Pellets"},
+				purchases: []core.Purchase{
+					{Meta: core.Meta{ID: "p1"}, BrandID: "brand-a", PurchasedAt: time.Date(2023, time.October, 1, 0, 0, 0, 0, time.UTC), Bags: 10, UnitPriceCents: 600, TotalPriceCents: 6000},
+					{Meta: core.Meta{ID: "p2"}, BrandID: "brand-a", PurchasedAt: time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC), Bags: 10, UnitPriceCents: 660, TotalPriceCents: 6600},
+				},
+			},
+			want: want{
+				statusCode: http.StatusOK,
+				expectHTML: []string{"&#43;10,0 % depuis 2023", `title="2024 : 6,60 € (&#43;10,0 %)"`, `height: 100%`},
+			},
+		},
+		{
+			name: "compares the prices paid with the market index",
+			params: params{
+				existingBrand: &core.Brand{Meta: core.Meta{ID: "brand-a"}, Name: "Alpha Pellets"},
+				purchases: []core.Purchase{
+					{Meta: core.Meta{ID: "p1"}, BrandID: "brand-a", PurchasedAt: time.Date(2023, time.October, 1, 0, 0, 0, 0, time.UTC), Bags: 10, BagWeightKg: 15, UnitPriceCents: 600, TotalPriceCents: 6000},
+					{Meta: core.Meta{ID: "p2"}, BrandID: "brand-a", PurchasedAt: time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC), Bags: 10, BagWeightKg: 15, UnitPriceCents: 660, TotalPriceCents: 6600},
+				},
+				marketPrices: []core.MarketPrice{
+					{Month: time.Date(2023, time.October, 1, 0, 0, 0, 0, time.UTC), PricePerTonneCents: 40000},
+					{Month: time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC), PricePerTonneCents: 40000},
+				},
+			},
+			want: want{
+				statusCode: http.StatusOK,
+				expectHTML: []string{"Prix payé &#43;5,0 % par rapport à l"},
 			},
 		},
 	}
@@ -164,6 +199,8 @@ func TestServer_handleBrandsPageGet(t *testing.T) {
 			if tc.params.existingBrand != nil {
 				store.data.Brands = append(store.data.Brands, *tc.params.existingBrand)
 			}
+			store.data.Purchases = tc.params.purchases
+			store.data.MarketPrices = tc.params.marketPrices
 
 			server := NewServer(store, Config{})
 
@@ -178,7 +215,9 @@ func TestServer_handleBrandsPageGet(t *testing.T) {
 			assert.Equal(t, tc.want.statusCode, res.StatusCode, tc.name)
 
 			responseBody := rec.Body.String()
-			assert.Contains(t, responseBody, tc.want.expectImageHTML, tc.name)
+			for _, fragment := range tc.want.expectHTML {
+				assert.Contains(t, responseBody, fragment, tc.name)
+			}
 		})
 	}
 }
@@ -0,0 +1,236 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_duplicateConsumption(t *testing.T) {
+	t.Parallel()
+
+	brandID := core.NewID()
+	sourceID := core.NewID()
+	baseData := core.DataStore{
+		Brands: []core.Brand{{Meta: core.Meta{ID: brandID}, Name: "Granules"}},
+		Consumptions: []core.Consumption{{
+			Meta:       core.Meta{ID: sourceID},
+			BrandID:    brandID,
+			ConsumedAt: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+			Bags:       2,
+			Notes:      "Hiver",
+		}},
+	}
+
+	type params struct {
+		path string
+	}
+	type want struct {
+		statusCode int
+		replaced   bool
+		consumedAt time.Time
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "duplicates on explicit date",
+			params: params{path: "/api/consommations/" + string(sourceID) + "/duplicate?date=2024-02-02"},
+			want: want{
+				statusCode: http.StatusCreated,
+				replaced:   true,
+				consumedAt: time.Date(2024, time.February, 2, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:   "defaults to today",
+			params: params{path: "/api/consommations/" + string(sourceID) + "/duplicate?date=today"},
+			want:   want{statusCode: http.StatusCreated, replaced: true, consumedAt: today()},
+		},
+		{
+			name:   "rejects invalid date",
+			params: params{path: "/api/consommations/" + string(sourceID) + "/duplicate?date=hier"},
+			want:   want{statusCode: http.StatusBadRequest},
+		},
+		{
+			name:   "unknown consumption",
+			params: params{path: "/api/consommations/missing/duplicate"},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			data := baseData
+			data.Consumptions = append([]core.Consumption(nil), baseData.Consumptions...)
+			store := &stubDataStore{data: data}
+			server := NewServer(store, Config{})
+
+			req := httptest.NewRequest(http.MethodPost, tc.params.path, nil)
+			rec := httptest.NewRecorder()
+
+			server.handleConsumptionByIDAPI(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.replaced, store.replaced, tc.name)
+			if !tc.want.replaced {
+				return
+			}
+			var created core.Consumption
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created), tc.name)
+			assert.Equal(t, 2, created.Bags, tc.name)
+			assert.Equal(t, "Hiver", created.Notes, tc.name)
+			assert.True(t, tc.want.consumedAt.Equal(created.ConsumedAt), tc.name)
+			assert.Len(t, store.replacedWith.Consumptions, 2, tc.name)
+		})
+	}
+}
+
+func TestServer_consumptionBlendedPrice(t *testing.T) {
+	t.Parallel()
+
+	brandID := core.NewID()
+	consumptionID := core.NewID()
+	purchase := func(day, bags int, price core.Money) core.Purchase {
+		return core.Purchase{
+			Meta:            core.Meta{ID: core.NewID()},
+			BrandID:         brandID,
+			PurchasedAt:     time.Date(2024, time.January, day, 0, 0, 0, 0, time.UTC),
+			Bags:            bags,
+			BagWeightKg:     15,
+			TotalWeightKg:   float64(15 * bags),
+			UnitPriceCents:  price,
+			TotalPriceCents: price.MulInt(bags),
+		}
+	}
+	data := core.DataStore{
+		Brands:    []core.Brand{{Meta: core.Meta{ID: brandID}, Name: "Granules"}},
+		Purchases: []core.Purchase{purchase(5, 1, 500), purchase(10, 5, 600)},
+		Consumptions: []core.Consumption{{
+			Meta:       core.Meta{ID: consumptionID},
+			BrandID:    brandID,
+			ConsumedAt: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+			Bags:       2,
+		}},
+	}
+
+	type params struct {
+		path string
+	}
+	type want struct {
+		bodyContains []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "api",
+			params: params{path: "/api/consommations"},
+			want:   want{bodyContains: []string{`"total_price_cents":1100`, `"blended_bag_price_cents":550`}},
+		},
+		{
+			name:   "listing",
+			params: params{path: "/consommations"},
+			want:   want{bodyContains: []string{"Prix/sac", "5,50", "11,00"}},
+		},
+		{
+			name:   "csv export",
+			params: params{path: "/api/export/csv"},
+			want:   want{bodyContains: []string{"consumption," + string(consumptionID) + "," + string(brandID) + ",Granules,2024-02-01T00:00:00Z,2,,550,1100,"}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{data: data}, Config{})
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.params.path, nil))
+
+			require.Equal(t, http.StatusOK, rec.Code, tc.name)
+			for _, fragment := range tc.want.bodyContains {
+				assert.Contains(t, rec.Body.String(), fragment, tc.name)
+			}
+		})
+	}
+}
+
+func TestServer_createConsumptionPartialBags(t *testing.T) {
+	t.Parallel()
+
+	brandID := core.NewID()
+	data := core.DataStore{
+		Brands: []core.Brand{{Meta: core.Meta{ID: brandID}, Name: "Granules"}},
+	}
+
+	type params struct {
+		bags string
+	}
+	type want struct {
+		statusCode int
+		bags       int
+		fraction   float64
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "splits a decimal number of bags",
+			params: params{bags: "1.5"},
+			want:   want{statusCode: http.StatusCreated, bags: 1, fraction: 0.5},
+		},
+		{
+			name:   "records part of a bag alone",
+			params: params{bags: "0.25"},
+			want:   want{statusCode: http.StatusCreated, fraction: 0.25},
+		},
+		{
+			name:   "keeps whole bags",
+			params: params{bags: "2"},
+			want:   want{statusCode: http.StatusCreated, bags: 2},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: data}
+			server := NewServer(store, Config{})
+			body := `{"brand_id":"` + string(brandID) + `","consumed_at":"2024-02-01T00:00:00Z","bags":` + tc.params.bags + `}`
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/consommations", strings.NewReader(body)))
+
+			require.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			var created core.Consumption
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created), tc.name)
+			assert.Equal(t, tc.want.bags, created.Bags, tc.name)
+			assert.Equal(t, tc.want.fraction, created.BagsFraction, tc.name)
+		})
+	}
+}
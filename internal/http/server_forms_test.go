@@ -0,0 +1,175 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_handleHomePost(t *testing.T) {
+	t.Parallel()
+
+	brandID := core.NewID()
+	baseData := core.DataStore{
+		Brands: []core.Brand{{
+			Meta: core.Meta{ID: brandID, CreatedAt: time.Now(), UpdatedAt: time.Now()},
+			Name: "Granules",
+		}},
+	}
+
+	type params struct {
+		form url.Values
+	}
+	type want struct {
+		statusCode     int
+		replaced       bool
+		bodyContains   []string
+		bodyExcludes   []string
+		redirectTarget string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "accepts french formatted amounts",
+			params: params{form: url.Values{
+				"brand_id":       {string(brandID)},
+				"purchased_at":   {"2024-01-10"},
+				"bags":           {"2"},
+				"bag_weight_kg":  {"14,5"},
+				"unit_price_eur": {"1 234,56 €"},
+			}},
+			want: want{
+				statusCode:     http.StatusSeeOther,
+				replaced:       true,
+				redirectTarget: "/?added=purchase",
+			},
+		},
+		{
+			name: "accepts a date typed as day/month/year",
+			params: params{form: url.Values{
+				"brand_id":       {string(brandID)},
+				"purchased_at":   {"10/01/2024"},
+				"bags":           {"2"},
+				"bag_weight_kg":  {"15"},
+				"unit_price_eur": {"5,49"},
+			}},
+			want: want{
+				statusCode:     http.StatusSeeOther,
+				replaced:       true,
+				redirectTarget: "/?added=purchase",
+			},
+		},
+		{
+			name: "keeps typed values and flags parse errors",
+			params: params{form: url.Values{
+				"brand_id":       {string(brandID)},
+				"purchased_at":   {"2024-01-10"},
+				"bags":           {"deux"},
+				"bag_weight_kg":  {"15"},
+				"unit_price_eur": {"abc"},
+				"notes":          {"Livraison du mardi"},
+			}},
+			want: want{
+				statusCode: http.StatusBadRequest,
+				bodyContains: []string{
+					`value="deux"`,
+					`value="abc"`,
+					"Livraison du mardi",
+					"Nombre de sacs invalide",
+					"Prix unitaire invalide",
+					`<option value="` + string(brandID) + `" selected>`,
+				},
+				bodyExcludes: []string{"Poids par sac invalide"},
+			},
+		},
+		{
+			name: "maps core validation errors onto fields",
+			params: params{form: url.Values{
+				"brand_id":       {"unknown"},
+				"purchased_at":   {"2024-01-10"},
+				"bags":           {"0"},
+				"bag_weight_kg":  {"15"},
+				"unit_price_eur": {"5"},
+			}},
+			want: want{
+				statusCode: http.StatusBadRequest,
+				bodyContains: []string{
+					"Marque inconnue",
+					"Le nombre de sacs doit être supérieur à zéro",
+					`aria-invalid="true"`,
+				},
+			},
+		},
+		{
+			name: "records a bulk delivery",
+			params: params{form: url.Values{
+				"kind":                {"bulk"},
+				"brand_id":            {string(brandID)},
+				"purchased_at":        {"2024-09-02"},
+				"weight_kg":           {"2 850"},
+				"price_per_tonne_eur": {"390,00"},
+			}},
+			want: want{
+				statusCode:     http.StatusSeeOther,
+				replaced:       true,
+				redirectTarget: "/?added=purchase",
+			},
+		},
+		{
+			name: "requires the weight of a bulk delivery",
+			params: params{form: url.Values{
+				"kind":                {"bulk"},
+				"brand_id":            {string(brandID)},
+				"purchased_at":        {"2024-09-02"},
+				"weight_kg":           {"0"},
+				"price_per_tonne_eur": {"390"},
+			}},
+			want: want{
+				statusCode:   http.StatusBadRequest,
+				bodyContains: []string{"Le poids livré doit être supérieur à zéro"},
+				bodyExcludes: []string{"Nombre de sacs invalide"},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: baseData}
+			server := NewServer(store, Config{})
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.params.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+
+			server.handleHome(rec, req)
+
+			res := rec.Result()
+			defer res.Body.Close()
+
+			assert.Equal(t, tc.want.statusCode, res.StatusCode, tc.name)
+			assert.Equal(t, tc.want.replaced, store.replaced, tc.name)
+			assert.Equal(t, tc.want.redirectTarget, res.Header.Get("Location"), tc.name)
+			body := rec.Body.String()
+			for _, fragment := range tc.want.bodyContains {
+				assert.Contains(t, body, fragment, tc.name)
+			}
+			for _, fragment := range tc.want.bodyExcludes {
+				assert.NotContains(t, body, fragment, tc.name)
+			}
+		})
+	}
+}
@@ -59,7 +59,7 @@ func TestServerAPIIntegration(t *testing.T) {
 			dataFile := filepath.Join(tmpDir, "data.json")
 			backupDir := filepath.Join(tmpDir, "backups")
 
-			jsonStore, err := store.NewJSONStore(dataFile, backupDir)
+			jsonStore, err := store.NewJSONStore(dataFile, backupDir, store.FormatPretty)
 			require.NoError(t, err, tc.name)
 
 			server := httpserver.NewServer(jsonStore, httpserver.Config{})
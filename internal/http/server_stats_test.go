@@ -0,0 +1,599 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_statsComputeTimeout(t *testing.T) {
+	t.Parallel()
+
+	brandID := core.NewID()
+	data := core.DataStore{
+		Brands: []core.Brand{{
+			Meta: core.Meta{ID: brandID, CreatedAt: time.Now(), UpdatedAt: time.Now()},
+			Name: "Granules",
+		}},
+		Purchases: []core.Purchase{{
+			Meta:           core.Meta{ID: core.NewID(), CreatedAt: time.Now(), UpdatedAt: time.Now()},
+			BrandID:        brandID,
+			PurchasedAt:    time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC),
+			Bags:           5,
+			BagWeightKg:    15,
+			TotalWeightKg:  75,
+			UnitPriceCents: 549,
+		}},
+	}
+
+	type params struct {
+		path    string
+		expired bool
+	}
+	type want struct {
+		statusCode   int
+		bodyContains string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "api within deadline",
+			params: params{path: "/api/stats"},
+			want:   want{statusCode: http.StatusOK, bodyContains: `"inventaire"`},
+		},
+		{
+			name:   "api past deadline",
+			params: params{path: "/api/stats", expired: true},
+			want:   want{statusCode: http.StatusServiceUnavailable, bodyContains: "computation timed out"},
+		},
+		{
+			name:   "page past deadline",
+			params: params{path: "/stats", expired: true},
+			want:   want{statusCode: http.StatusServiceUnavailable, bodyContains: "Le calcul des statistiques a pris trop de temps"},
+		},
+		{
+			name:   "order plan past deadline",
+			params: params{path: "/stats/plan-de-commande.pdf", expired: true},
+			want:   want{statusCode: http.StatusServiceUnavailable, bodyContains: "computation timed out"},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{data: data}, Config{ComputeTimeout: time.Minute})
+			req := httptest.NewRequest(http.MethodGet, tc.params.path, nil)
+			if tc.params.expired {
+				ctx, cancel := context.WithDeadline(req.Context(), time.Now().Add(-time.Second))
+				defer cancel()
+				req = req.WithContext(ctx)
+			}
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Contains(t, rec.Body.String(), tc.want.bodyContains, tc.name)
+		})
+	}
+}
+
+func TestServer_costingMethod(t *testing.T) {
+	t.Parallel()
+
+	brandID := core.ID("brand-g")
+	data := core.DataStore{
+		Brands: []core.Brand{{Meta: core.Meta{ID: brandID}, Name: "Granules"}},
+		Purchases: []core.Purchase{
+			{Meta: core.Meta{ID: "p1"}, BrandID: brandID, PurchasedAt: time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC), Bags: 5, BagWeightKg: 15, TotalWeightKg: 75, UnitPriceCents: 550, TotalPriceCents: 2750},
+			{Meta: core.Meta{ID: "p2"}, BrandID: brandID, PurchasedAt: time.Date(2024, time.February, 5, 0, 0, 0, 0, time.UTC), Bags: 3, BagWeightKg: 15, TotalWeightKg: 45, UnitPriceCents: 600, TotalPriceCents: 1800},
+		},
+		Consumptions: []core.Consumption{
+			{Meta: core.Meta{ID: "c1"}, BrandID: brandID, ConsumedAt: time.Date(2024, time.February, 20, 0, 0, 0, 0, time.UTC), Bags: 2},
+		},
+	}
+
+	type params struct {
+		configured core.CostingMethod
+		path       string
+	}
+	type want struct {
+		statusCode   int
+		bodyContains string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "defaults to FIFO",
+			params: params{path: "/api/stats"},
+			want:   want{statusCode: http.StatusOK, bodyContains: `"consomme_cents":1100`},
+		},
+		{
+			name:   "uses the configured method",
+			params: params{configured: core.CostingLIFO, path: "/api/stats"},
+			want:   want{statusCode: http.StatusOK, bodyContains: `"consomme_cents":1200`},
+		},
+		{
+			name:   "lets the request pick the method",
+			params: params{configured: core.CostingLIFO, path: "/api/stats?costing=average"},
+			want:   want{statusCode: http.StatusOK, bodyContains: `"consomme_cents":1138`},
+		},
+		{
+			name:   "rejects unknown methods",
+			params: params{path: "/api/stats?costing=cmup"},
+			want:   want{statusCode: http.StatusBadRequest, bodyContains: "unknown costing method"},
+		},
+		{
+			name:   "labels the page",
+			params: params{path: "/stats?costing=average"},
+			want:   want{statusCode: http.StatusOK, bodyContains: "Coût consommé (coût moyen pondéré)"},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{data: data}, Config{CostingMethod: tc.params.configured})
+			req := httptest.NewRequest(http.MethodGet, tc.params.path, nil)
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Contains(t, rec.Body.String(), tc.want.bodyContains, tc.name)
+		})
+	}
+}
+
+func TestServer_monthlyChartLimit(t *testing.T) {
+	t.Parallel()
+
+	brandID := core.ID("brand-g")
+	data := core.DataStore{
+		Brands: []core.Brand{{Meta: core.Meta{ID: brandID}, Name: "Granules"}},
+		Purchases: []core.Purchase{
+			{Meta: core.Meta{ID: "p1"}, BrandID: brandID, PurchasedAt: time.Date(2022, time.October, 1, 0, 0, 0, 0, time.UTC), Bags: 50, BagWeightKg: 15, TotalWeightKg: 750, UnitPriceCents: 550, TotalPriceCents: 27500},
+		},
+		Consumptions: []core.Consumption{
+			{Meta: core.Meta{ID: "c1"}, BrandID: brandID, ConsumedAt: time.Date(2022, time.November, 20, 0, 0, 0, 0, time.UTC), Bags: 4},
+			{Meta: core.Meta{ID: "c2"}, BrandID: brandID, ConsumedAt: time.Date(2022, time.December, 20, 0, 0, 0, 0, time.UTC), Bags: 5},
+			{Meta: core.Meta{ID: "c3"}, BrandID: brandID, ConsumedAt: time.Date(2025, time.January, 20, 0, 0, 0, 0, time.UTC), Bags: 6},
+		},
+	}
+	months := 0
+
+	type params struct {
+		months *int
+		rollup core.ChartRollup
+		path   string
+	}
+	type want struct {
+		statusCode   int
+		bodyContains []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "adds up a long history by quarter",
+			params: params{path: "/api/stats"},
+			want:   want{statusCode: http.StatusOK, bodyContains: []string{`"month":"2022-10-01T00:00:00Z","bags":9,"weight_kg":135,"period":"quarter"`}},
+		},
+		{
+			name:   "uses the configured rollup",
+			params: params{rollup: core.ChartRollupNone, path: "/api/stats"},
+			want:   want{statusCode: http.StatusOK, bodyContains: []string{`"sacs_par_mois":[{"month":"2025-01-01T00:00:00Z","bags":6`}},
+		},
+		{
+			name:   "keeps every month when configured",
+			params: params{months: &months, path: "/api/stats"},
+			want:   want{statusCode: http.StatusOK, bodyContains: []string{`"sacs_par_mois":[{"month":"2022-11-01T00:00:00Z","bags":4,"weight_kg":60}`}},
+		},
+		{
+			name:   "lets the request pick the limit",
+			params: params{path: "/api/stats?months=36&rollup=season"},
+			want:   want{statusCode: http.StatusOK, bodyContains: []string{`"sacs_par_mois":[{"month":"2022-11-01T00:00:00Z","bags":4,"weight_kg":60}`}},
+		},
+		{
+			name:   "rejects unknown rollups",
+			params: params{path: "/api/stats?rollup=year"},
+			want:   want{statusCode: http.StatusBadRequest, bodyContains: []string{"unknown chart rollup"}},
+		},
+		{
+			name:   "labels the seasons on the page",
+			params: params{path: "/stats?rollup=season"},
+			want:   want{statusCode: http.StatusOK, bodyContains: []string{"regroupée par saison de chauffe", "<th>Saison</th>", "2022-2023"}},
+		},
+		{
+			name:   "labels the quarters on the page",
+			params: params{path: "/stats"},
+			want:   want{statusCode: http.StatusOK, bodyContains: []string{"<th>Trimestre</th>", "T4 2022", "T1 2025"}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{data: data}, Config{ChartMonths: tc.params.months, ChartRollup: tc.params.rollup})
+			req := httptest.NewRequest(http.MethodGet, tc.params.path, nil)
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			for _, fragment := range tc.want.bodyContains {
+				assert.Contains(t, rec.Body.String(), fragment, tc.name)
+			}
+		})
+	}
+}
+
+func TestServer_energyStats(t *testing.T) {
+	t.Parallel()
+
+	data := core.DataStore{
+		Brands: []core.Brand{
+			{Meta: core.Meta{ID: "brand-g"}, Name: "Granules"},
+			{Meta: core.Meta{ID: "brand-p"}, Name: "Premium", EnergyKWhPerKg: 5.2},
+		},
+		Purchases: []core.Purchase{
+			{Meta: core.Meta{ID: "p1"}, BrandID: "brand-g", PurchasedAt: time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC), Bags: 5, BagWeightKg: 15, TotalWeightKg: 75, UnitPriceCents: 550, TotalPriceCents: 2750},
+			{Meta: core.Meta{ID: "p2"}, BrandID: "brand-p", PurchasedAt: time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC), Bags: 5, BagWeightKg: 10, TotalWeightKg: 50, UnitPriceCents: 520, TotalPriceCents: 2600},
+		},
+		Consumptions: []core.Consumption{
+			{Meta: core.Meta{ID: "c1"}, BrandID: "brand-g", ConsumedAt: time.Date(2024, time.January, 20, 0, 0, 0, 0, time.UTC), Bags: 2},
+			{Meta: core.Meta{ID: "c2"}, BrandID: "brand-p", ConsumedAt: time.Date(2024, time.February, 3, 0, 0, 0, 0, time.UTC), Bags: 1},
+		},
+	}
+
+	type params struct {
+		path string
+	}
+	type want struct {
+		contains []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "adds the energy to the api",
+			params: params{path: "/api/stats"},
+			want: want{contains: []string{
+				`"energie":{"weight_kg":40,"energy_kwh":196,"cost_cents":1620,"cost_per_mwh_cents":8265}`,
+				`"kwh_par_mois":[{"month":"2024-01-01T00:00:00Z","weight_kg":30,"energy_kwh":144},{"month":"2024-02-01T00:00:00Z","weight_kg":10,"energy_kwh":52}]`,
+			}},
+		},
+		{
+			name:   "follows the range",
+			params: params{path: "/api/stats?from=2024-02-01T00:00:00Z"},
+			want:   want{contains: []string{`"energie":{"weight_kg":10,"energy_kwh":52,"cost_cents":520,"cost_per_mwh_cents":10000}`}},
+		},
+		{
+			name:   "shows the cost per kWh on the page",
+			params: params{path: "/stats"},
+			want:   want{contains: []string{"0,083 €/kWh", "196,00 kWh estimés", "<td>144,00</td>"}},
+		},
+	}
+
+	server := NewServer(&stubDataStore{data: data}, Config{})
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, tc.params.path, nil)
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code, tc.name)
+			for _, fragment := range tc.want.contains {
+				assert.Contains(t, rec.Body.String(), fragment, tc.name)
+			}
+		})
+	}
+}
+
+func TestServer_inventoryAsOf(t *testing.T) {
+	t.Parallel()
+
+	data := core.DataStore{
+		Brands: []core.Brand{{Meta: core.Meta{ID: "brand-g"}, Name: "Granules"}},
+		Purchases: []core.Purchase{
+			{Meta: core.Meta{ID: "p1"}, BrandID: "brand-g", PurchasedAt: time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC), Bags: 5, BagWeightKg: 15, TotalWeightKg: 75, UnitPriceCents: 550, TotalPriceCents: 2750, Location: "Garage"},
+			{Meta: core.Meta{ID: "p2"}, BrandID: "brand-g", PurchasedAt: time.Date(2024, time.February, 5, 0, 0, 0, 0, time.UTC), Bags: 3, BagWeightKg: 15, TotalWeightKg: 45, UnitPriceCents: 600, TotalPriceCents: 1800, Location: "Garage"},
+		},
+		Consumptions: []core.Consumption{
+			{Meta: core.Meta{ID: "c1"}, BrandID: "brand-g", ConsumedAt: time.Date(2024, time.January, 20, 0, 0, 0, 0, time.UTC), Bags: 2},
+		},
+	}
+
+	type params struct {
+		path string
+	}
+	type want struct {
+		contains []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "reports the current inventory without range",
+			params: params{path: "/api/stats"},
+			want: want{contains: []string{
+				`"inventaire":{"total_bags":6,`,
+				`"portee":{"sur_la_periode":["investi_cents",`,
+				`"a_la_fin_de_periode":["inventaire","inventaire_par_emplacement"]}`,
+			}},
+		},
+		{
+			name:   "reports the inventory at the end of the range",
+			params: params{path: "/api/stats?to=2024-01-31T00:00:00Z"},
+			want: want{contains: []string{
+				`"inventaire":{"total_bags":3,"total_weight_kg":45,"total_cost_cents":1650,`,
+				`"inventaire_par_emplacement":[{"location":"Garage","bags":3,`,
+				`"portee":{"to":"2024-01-31T00:00:00Z",`,
+			}},
+		},
+		{
+			name:   "labels the inventory date on the page",
+			params: params{path: "/stats?to=2024-01-31T00:00:00Z"},
+			want:   want{contains: []string{"Inventaire restant au 31/01/2024", "3 sacs · 45,00 kg"}},
+		},
+	}
+
+	server := NewServer(&stubDataStore{data: data}, Config{})
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, tc.params.path, nil)
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code, tc.name)
+			for _, fragment := range tc.want.contains {
+				assert.Contains(t, rec.Body.String(), fragment, tc.name)
+			}
+		})
+	}
+}
+
+func TestServer_forecast(t *testing.T) {
+	t.Parallel()
+
+	today := time.Now().UTC()
+	brands := []core.Brand{{Meta: core.Meta{ID: "brand-g"}, Name: "Granules"}}
+	purchase := func(at time.Time, bags int) core.Purchase {
+		return core.Purchase{Meta: core.Meta{ID: "p1"}, BrandID: "brand-g", PurchasedAt: at, Bags: bags, BagWeightKg: 15, TotalWeightKg: float64(bags) * 15, UnitPriceCents: 550}
+	}
+	consumption := func(at time.Time, bags int) core.Consumption {
+		return core.Consumption{Meta: core.Meta{ID: "c1"}, BrandID: "brand-g", ConsumedAt: at, Bags: bags}
+	}
+
+	type params struct {
+		data core.DataStore
+		path string
+	}
+	type want struct {
+		contains []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "serves the forecast",
+			params: params{
+				data: core.DataStore{Brands: brands, Purchases: []core.Purchase{purchase(today.AddDate(0, 0, -10), 12)}, Consumptions: []core.Consumption{consumption(today.AddDate(0, 0, -1), 10)}},
+				path: "/api/stats/forecast",
+			},
+			want: want{contains: []string{`"stock_kg":30`, `"basis":"monthly_average"`, `"stockout_at":"` + today.Format("2006-01-02") + `T00:00:00Z"`}},
+		},
+		{
+			name: "shows the stockout day on the page",
+			params: params{
+				data: core.DataStore{Brands: brands, Purchases: []core.Purchase{purchase(today.AddDate(0, 0, -10), 12)}, Consumptions: []core.Consumption{consumption(today.AddDate(0, 0, -1), 10)}},
+				path: "/stats",
+			},
+			want: want{contains: []string{"Stock épuisé vers le " + formatDayLabel(today), "prévision : moyenne de chaque mois"}},
+		},
+		{
+			name: "shows a stock lasting past the horizon",
+			params: params{
+				data: core.DataStore{Brands: brands, Purchases: []core.Purchase{purchase(today.AddDate(-3, 0, 0), 100)}, Consumptions: []core.Consumption{consumption(today.AddDate(-3, 0, 0), 1)}},
+				path: "/stats",
+			},
+			want: want{contains: []string{"Plus d'un an", "1485,00 kg en stock"}},
+		},
+		{
+			name: "waits for consumptions",
+			params: params{
+				data: core.DataStore{Brands: brands, Purchases: []core.Purchase{purchase(today.AddDate(0, 0, -10), 12)}},
+				path: "/stats",
+			},
+			want: want{contains: []string{"aucune consommation enregistrée"}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{data: tc.params.data}, Config{})
+			req := httptest.NewRequest(http.MethodGet, tc.params.path, nil)
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code, tc.name)
+			for _, fragment := range tc.want.contains {
+				assert.Contains(t, rec.Body.String(), fragment, tc.name)
+			}
+		})
+	}
+}
+
+func TestServer_priceCalendar(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		data core.DataStore
+	}
+	type want struct {
+		contains []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "shades the monthly prices of each brand",
+			params: params{data: core.DataStore{
+				Brands: []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}},
+				Purchases: []core.Purchase{
+					{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: time.Date(2023, time.May, 2, 0, 0, 0, 0, time.UTC), Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 500, TotalPriceCents: 5000},
+					{Meta: core.Meta{ID: "p2"}, BrandID: "brand-w", PurchasedAt: time.Date(2023, time.August, 2, 0, 0, 0, 0, time.UTC), Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 550, TotalPriceCents: 5500},
+					{Meta: core.Meta{ID: "p3"}, BrandID: "brand-w", PurchasedAt: time.Date(2023, time.November, 2, 0, 0, 0, 0, time.UTC), Bags: 10, BagWeightKg: 15, TotalWeightKg: 150, UnitPriceCents: 600, TotalPriceCents: 6000},
+				},
+			}},
+			want: want{contains: []string{
+				"<th>Jan.</th>", "<th>Déc.</th>",
+				`<td class="heat-1" title="1 achat · 10 sacs"><strong>5,00 €</strong></td>`,
+				`<td class="heat-3" title="1 achat · 10 sacs">5,50 €</td>`,
+				`<td class="heat-5" title="1 achat · 10 sacs">6,00 €</td>`,
+				"<td>Mai</td>",
+			}},
+		},
+		{
+			name:   "explains the calendar without purchases",
+			params: params{data: core.DataStore{}},
+			want:   want{contains: []string{"Enregistrez des achats en sacs"}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{data: tc.params.data}, Config{})
+			req := httptest.NewRequest(http.MethodGet, "/stats", nil)
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code, tc.name)
+			for _, fragment := range tc.want.contains {
+				assert.Contains(t, rec.Body.String(), fragment, tc.name)
+			}
+		})
+	}
+}
+
+func TestServer_statsWarnings(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC)
+	consistent := core.DataStore{
+		Brands:    []core.Brand{{Meta: core.Meta{ID: "brand-g"}, Name: "Granules"}},
+		Purchases: []core.Purchase{{Meta: core.Meta{ID: "p1"}, BrandID: "brand-g", PurchasedAt: at, Bags: 5, BagWeightKg: 15, TotalWeightKg: 75, UnitPriceCents: 550, TotalPriceCents: 2750}},
+	}
+	corrupted := core.DataStore{
+		Brands:    []core.Brand{{Meta: core.Meta{ID: "brand-g"}, Name: "Granules"}},
+		Purchases: []core.Purchase{{Meta: core.Meta{ID: "p1"}, BrandID: "brand-g", PurchasedAt: at, Bags: 5, BagWeightKg: 15, TotalWeightKg: 750, UnitPriceCents: 550, TotalPriceCents: 2750}},
+	}
+
+	type params struct {
+		data core.DataStore
+		path string
+	}
+	type want struct {
+		contains    []string
+		notContains []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "lists no warning for consistent entries",
+			params: params{data: consistent, path: "/api/stats"},
+			want:   want{contains: []string{`"avertissements":[]`}},
+		},
+		{
+			name:   "lists the warnings in the api",
+			params: params{data: corrupted, path: "/api/stats"},
+			want:   want{contains: []string{`"avertissements":[{"code":"weight_mismatch","brand_id":"brand-g","purchase_id":"p1","message":"purchase of 5 bags of 15.000 kg weighs 750.000 kg in total"}]`}},
+		},
+		{
+			name:   "shows a banner on the page",
+			params: params{data: corrupted, path: "/stats"},
+			want:   want{contains: []string{"Chiffres incohérents", "Le poids total d&#39;un achat de Granules ne correspond pas à ses sacs.", `href="/achats/p1"`}},
+		},
+		{
+			name:   "shows no banner for consistent entries",
+			params: params{data: consistent, path: "/stats"},
+			want:   want{notContains: []string{"Chiffres incohérents"}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{data: tc.params.data}, Config{})
+			req := httptest.NewRequest(http.MethodGet, tc.params.path, nil)
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code, tc.name)
+			for _, fragment := range tc.want.contains {
+				assert.Contains(t, rec.Body.String(), fragment, tc.name)
+			}
+			for _, fragment := range tc.want.notContains {
+				assert.NotContains(t, rec.Body.String(), fragment, tc.name)
+			}
+		})
+	}
+}
@@ -66,6 +66,22 @@ func TestServer_createPurchase(t *testing.T) {
 				expectBagWeight: 14.5,
 			},
 		},
+		{
+			name: "creates a bulk delivery priced per tonne",
+			params: params{
+				payload: map[string]any{
+					"brand_id":            string(brandID),
+					"purchased_at":        time.Now().Format(time.RFC3339),
+					"weight_kg":           3000,
+					"price_per_tonne_eur": "390",
+				},
+				dataReturn: baseData,
+			},
+			want: want{
+				statusCode:    http.StatusCreated,
+				expectTotalKg: 3000,
+			},
+		},
 		{
 			name: "handles persistence failures",
 			params: params{
@@ -138,3 +154,96 @@ func TestServer_createPurchase(t *testing.T) {
 		})
 	}
 }
+
+func TestPurchasePayload_unitPrice(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		body string
+	}
+	type want struct {
+		amount core.Money
+		err    bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "cents", params: params{body: `{"unit_price_cents":549}`}, want: want{amount: core.Money(549)}},
+		{name: "euro number", params: params{body: `{"unit_price_eur":5.49}`}, want: want{amount: core.Money(549)}},
+		{name: "euro string with french notation", params: params{body: `{"unit_price_eur":"5,49 €"}`}, want: want{amount: core.Money(549)}},
+		{name: "euro null is ignored", params: params{body: `{"unit_price_eur":null,"unit_price_cents":12}`}, want: want{amount: core.Money(12)}},
+		{name: "missing price", params: params{body: `{}`}, want: want{amount: core.Money(0)}},
+		{name: "both fields", params: params{body: `{"unit_price_cents":549,"unit_price_eur":5.49}`}, want: want{err: true}},
+		{name: "invalid euro string", params: params{body: `{"unit_price_eur":"cinq"}`}, want: want{err: true}},
+		{name: "invalid euro type", params: params{body: `{"unit_price_eur":true}`}, want: want{err: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var payload purchasePayload
+			require.NoError(t, json.Unmarshal([]byte(tc.params.body), &payload), tc.name)
+
+			amount, err := payload.unitPrice()
+			if tc.want.err {
+				var vErr core.ValidationErrors
+				assert.True(t, errors.As(err, &vErr), tc.name)
+				assert.True(t, vErr.Has("unit_price_eur"), tc.name)
+				return
+			}
+			assert.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.amount, amount, tc.name)
+		})
+	}
+}
+
+func TestServer_shouldLog(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		sampleEvery int
+		path        string
+		status      int
+		requests    int
+	}
+	type want struct {
+		logged int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "logs regular requests", params: params{path: "/stats", status: http.StatusOK, requests: 3}, want: want{logged: 3}},
+		{name: "skips exact excluded path", params: params{path: "/healthz", status: http.StatusOK, requests: 3}},
+		{name: "skips excluded prefix", params: params{path: "/static/app.css", status: http.StatusOK, requests: 3}},
+		{name: "exact entry is not a prefix", params: params{path: "/healthz/deep", status: http.StatusOK, requests: 3}, want: want{logged: 3}},
+		{name: "logs excluded failures", params: params{path: "/healthz", status: http.StatusServiceUnavailable, requests: 3}, want: want{logged: 3}},
+		{name: "samples excluded requests", params: params{sampleEvery: 5, path: "/static/app.js", status: http.StatusOK, requests: 12}, want: want{logged: 2}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{}, Config{
+				LogExclude:     []string{"/healthz", "/static/"},
+				LogSampleEvery: tc.params.sampleEvery,
+			})
+			logged := 0
+			for i := 0; i < tc.params.requests; i++ {
+				if server.shouldLog(tc.params.path, tc.params.status) {
+					logged++
+				}
+			}
+			assert.Equal(t, tc.want.logged, logged, tc.name)
+		})
+	}
+}
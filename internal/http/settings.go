@@ -0,0 +1,73 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"pellets-tracker/internal/core"
+)
+
+// maxImportSettingsBytes bounds imported settings, which hold no image.
+const maxImportSettingsBytes = 1 << 20
+
+type settingsImportResponse struct {
+	core.SettingsImportSummary
+	// Backup is the copy of the datastore taken before the import.
+	Backup string `json:"backup,omitempty"`
+}
+
+// exportSettings downloads the settings of the datastore, without its
+// entries, for /api/import/settings.
+func (s *Server) exportSettings(w http.ResponseWriter, _ *http.Request) {
+	ds := s.store.Data()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename=pellets-settings.json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(core.ExportSettings(&ds)); err != nil {
+		log.Printf("export settings: %v", err)
+	}
+}
+
+// handleImportSettings applies settings exported by /api/export/settings,
+// leaving the purchases, consumptions and other entries untouched.
+func (s *Server) handleImportSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	var settings core.Settings
+	if err := decodeJSON(http.MaxBytesReader(w, r.Body, maxImportSettingsBytes), &settings); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			s.writeError(w, http.StatusRequestEntityTooLarge, errors.New("settings too large"))
+			return
+		}
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ds := s.store.Data()
+	summary, err := core.ImportSettings(&ds, settings)
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	resp := settingsImportResponse{SettingsImportSummary: summary}
+	if snap, ok := s.changes.DataStore.(snapshotter); ok {
+		if resp.Backup, err = snap.Snapshot("settings"); err != nil {
+			s.handleStoreError(w, fmt.Errorf("backup before import: %w", err))
+			return
+		}
+	}
+	if err := s.store.Replace(ds); err != nil {
+		s.handleStoreError(w, err)
+		return
+	}
+	log.Printf(`{"type":"import","entity":"settings","brands":%d,"storage_locations":%d,"silos":%d,"backup":%q}`,
+		summary.BrandsCreated+summary.BrandsUpdated, summary.StorageLocationsCreated+summary.StorageLocationsUpdated, summary.SilosCreated+summary.SilosUpdated, resp.Backup)
+	s.writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,161 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func settingsDataStore() core.DataStore {
+	return core.DataStore{
+		MinStockBags: 10,
+		Brands:       []core.Brand{{Meta: core.Meta{ID: "brand-a"}, Name: "Granules", LeadTimeDays: 3}},
+		Purchases:    []core.Purchase{{Meta: core.Meta{ID: "purchase-1"}, BrandID: "brand-a", Bags: 10, BagWeightKg: 15}},
+		Silos:        []core.Silo{{Meta: core.Meta{ID: "silo"}, Name: "Silo", CapacityKg: 3000}},
+	}
+}
+
+func TestServer_exportSettings(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		method string
+		data   core.DataStore
+	}
+	type want struct {
+		statusCode int
+		settings   *core.Settings
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "exports the settings without the entries",
+			params: params{method: http.MethodGet, data: settingsDataStore()},
+			want: want{statusCode: http.StatusOK, settings: &core.Settings{
+				Version:          core.SettingsVersion,
+				MinStockBags:     10,
+				Brands:           []core.BrandSettings{{Name: "Granules", LeadTimeDays: 3}},
+				StorageLocations: []core.StorageLocationSettings{},
+				Silos:            []core.SiloSettings{{Name: "Silo", CapacityKg: 3000}},
+			}},
+		},
+		{
+			name:   "exports empty lists without settings",
+			params: params{method: http.MethodGet},
+			want: want{statusCode: http.StatusOK, settings: &core.Settings{
+				Version:          core.SettingsVersion,
+				Brands:           []core.BrandSettings{},
+				StorageLocations: []core.StorageLocationSettings{},
+				Silos:            []core.SiloSettings{},
+			}},
+		},
+		{
+			name:   "rejects writes",
+			params: params{method: http.MethodPost, data: settingsDataStore()},
+			want:   want{statusCode: http.StatusMethodNotAllowed},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{data: tc.params.data}, Config{})
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, httptest.NewRequest(tc.params.method, "/api/export/settings", nil))
+
+			require.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			if tc.want.settings == nil {
+				return
+			}
+			assert.Equal(t, "attachment; filename=pellets-settings.json", rec.Header().Get("Content-Disposition"), tc.name)
+			var settings core.Settings
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &settings), tc.name)
+			assert.Equal(t, *tc.want.settings, settings, tc.name)
+			assert.NotContains(t, rec.Body.String(), "purchase-1", tc.name)
+		})
+	}
+}
+
+func TestServer_handleImportSettings(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		method string
+		body   string
+	}
+	type want struct {
+		statusCode   int
+		replaced     bool
+		snapshots    int
+		minStockBags int
+		brands       int
+		contains     string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "applies the settings",
+			params: params{method: http.MethodPost, body: `{"version":1,"min_stock_bags":20,"brands":[{"name":"granules","lead_time_days":5},{"name":"Bois Énergie"}],"silos":[{"name":"Silo","capacity_kg":4000}]}`},
+			want:   want{statusCode: http.StatusOK, replaced: true, snapshots: 1, minStockBags: 20, brands: 2, contains: `"brands_created":1,"brands_updated":1`},
+		},
+		{
+			name:   "points at the invalid setting",
+			params: params{method: http.MethodPost, body: `{"version":1,"brands":[{"name":"Granules","lead_time_days":400}]}`},
+			want:   want{statusCode: http.StatusBadRequest, minStockBags: 10, brands: 1, contains: `"Field":"brands[0].lead_time_days"`},
+		},
+		{
+			name:   "rejects unknown fields",
+			params: params{method: http.MethodPost, body: `{"version":1,"purchases":[]}`},
+			want:   want{statusCode: http.StatusBadRequest, minStockBags: 10, brands: 1},
+		},
+		{
+			name:   "rejects large files",
+			params: params{method: http.MethodPost, body: `{"version":1,"brands":[{"name":"` + strings.Repeat("a", maxImportSettingsBytes) + `"}]}`},
+			want:   want{statusCode: http.StatusRequestEntityTooLarge, minStockBags: 10, brands: 1},
+		},
+		{
+			name:   "rejects reads",
+			params: params{method: http.MethodGet},
+			want:   want{statusCode: http.StatusMethodNotAllowed, minStockBags: 10, brands: 1},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &snapshotStore{stubDataStore: stubDataStore{data: settingsDataStore()}}
+			server := NewServer(store, Config{})
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, httptest.NewRequest(tc.params.method, "/api/import/settings", strings.NewReader(tc.params.body)))
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.replaced, store.replaced, tc.name)
+			assert.Equal(t, tc.want.snapshots, store.snapshots, tc.name)
+			assert.Equal(t, tc.want.minStockBags, store.data.MinStockBags, tc.name)
+			assert.Len(t, store.data.Brands, tc.want.brands, tc.name)
+			assert.Len(t, store.data.Purchases, 1, tc.name)
+			assert.Contains(t, rec.Body.String(), tc.want.contains, tc.name)
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"pellets-tracker/internal/core"
+)
+
+type siloPayload struct {
+	Name       string  `json:"name"`
+	CapacityKg float64 `json:"capacity_kg"`
+}
+
+// siloLevelPayload is a reading sent by hand or by a level sensor, either in
+// kg or as a percentage of the capacity.
+type siloLevelPayload struct {
+	LevelKg      *float64 `json:"level_kg"`
+	LevelPercent *float64 `json:"level_percent"`
+	ReadAt       string   `json:"read_at"`
+	// Source defaults to sensor, readings typed in being sent by the form.
+	Source string `json:"source"`
+}
+
+// levelKg resolves the level from whichever of level_kg or level_percent was
+// provided; sending both or none is rejected.
+func (p siloLevelPayload) levelKg(capacityKg float64) (float64, error) {
+	switch {
+	case p.LevelKg != nil && p.LevelPercent != nil:
+		return 0, core.ValidationErrors{}.AppendIf(true, "level_percent", "level_kg and level_percent are mutually exclusive")
+	case p.LevelKg != nil:
+		return *p.LevelKg, nil
+	case p.LevelPercent != nil:
+		errs := core.ValidationErrors{}.AppendIf(*p.LevelPercent < 0 || *p.LevelPercent > 100, "level_percent", "level must be between 0 and 100 %")
+		if len(errs) > 0 {
+			return 0, errs
+		}
+		return core.RoundKg(capacityKg * *p.LevelPercent / 100), nil
+	default:
+		return 0, core.ValidationErrors{}.AppendIf(true, "level_kg", "level is required")
+	}
+}
+
+// silosView is the silos page: every silo with its level history.
+type silosView struct {
+	Silos []siloCard
+	Form  formState
+}
+
+// siloCard is a silo drawn with one bar per reading, scaled on its capacity.
+type siloCard struct {
+	core.SiloStatus
+	Bars []siloBar
+}
+
+type siloBar struct {
+	core.SiloLevelPoint
+	Label           string
+	HeightPercent   int
+	ExpectedPercent int
+}
+
+// maxSiloBars bounds the readings drawn on a silo card.
+const maxSiloBars = 60
+
+func (s *Server) handleSilosAPI(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ds := s.store.Data()
+		ctx, cancel := s.computeContext(r)
+		defer cancel()
+		statuses, err := core.ComputeSilos(ctx, &ds)
+		if err != nil {
+			s.handleCoreError(w, err)
+			return
+		}
+		if statuses == nil {
+			statuses = []core.SiloStatus{}
+		}
+		s.writeJSON(w, http.StatusOK, statuses)
+	case http.MethodPost:
+		var payload siloPayload
+		if err := decodeJSON(r.Body, &payload); err != nil {
+			s.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		ds := s.store.Data()
+		silo, err := core.AddSilo(&ds, core.CreateSiloParams{Name: payload.Name, CapacityKg: payload.CapacityKg})
+		if err != nil {
+			s.handleCoreError(w, err)
+			return
+		}
+		if err := s.store.Replace(ds); err != nil {
+			s.handleStoreError(w, err)
+			return
+		}
+		log.Printf(`{"type":"save","entity":"silo","id":"%s"}`, silo.ID)
+		s.writeJSON(w, http.StatusCreated, silo)
+	default:
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleSiloByIDAPI serves /api/silos/{id} and /api/silos/{id}/niveau, the
+// endpoint level sensors post their readings to.
+func (s *Server) handleSiloByIDAPI(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/silos/")
+	if id, ok := strings.CutSuffix(rest, "/niveau"); ok {
+		if id == "" || strings.ContainsRune(id, '/') {
+			s.notFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			s.methodNotAllowed(w, r, http.MethodPost)
+			return
+		}
+		s.recordSiloLevel(w, r, core.ID(id))
+		return
+	}
+	if rest == "" || strings.ContainsRune(rest, '/') {
+		s.notFound(w, r)
+		return
+	}
+	id := core.ID(rest)
+
+	ds := s.store.Data()
+	switch r.Method {
+	case http.MethodPut:
+		var payload siloPayload
+		if err := decodeJSON(r.Body, &payload); err != nil {
+			s.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		silo, err := core.UpdateSilo(&ds, id, core.UpdateSiloParams{Name: payload.Name, CapacityKg: payload.CapacityKg})
+		if err != nil {
+			s.handleCoreError(w, err)
+			return
+		}
+		if err := s.store.Replace(ds); err != nil {
+			s.handleStoreError(w, err)
+			return
+		}
+		log.Printf(`{"type":"save","entity":"silo","id":"%s"}`, silo.ID)
+		s.writeJSON(w, http.StatusOK, silo)
+	case http.MethodDelete:
+		if err := core.DeleteSilo(&ds, id); err != nil {
+			s.handleCoreError(w, err)
+			return
+		}
+		if err := s.store.Replace(ds); err != nil {
+			s.handleStoreError(w, err)
+			return
+		}
+		log.Printf(`{"type":"save","entity":"silo","id":"%s","action":"delete"}`, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.methodNotAllowed(w, r, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func (s *Server) recordSiloLevel(w http.ResponseWriter, r *http.Request, id core.ID) {
+	var payload siloLevelPayload
+	if err := decodeJSON(r.Body, &payload); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	readAt, err := parseTime(payload.ReadAt)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	ds := s.store.Data()
+	var capacityKg float64
+	for _, silo := range ds.Silos {
+		if silo.ID == id {
+			capacityKg = silo.CapacityKg
+		}
+	}
+	levelKg, err := payload.levelKg(capacityKg)
+	if err != nil {
+		s.writeValidationError(w, err)
+		return
+	}
+	source := payload.Source
+	if source == "" {
+		source = core.SiloSourceSensor
+	}
+	reading, err := core.RecordSiloLevel(&ds, core.RecordSiloLevelParams{SiloID: id, ReadAt: readAt, LevelKg: levelKg, Source: source})
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	if err := s.store.Replace(ds); err != nil {
+		s.handleStoreError(w, err)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"silo_reading","silo_id":"%s"}`, id)
+	s.writeJSON(w, http.StatusCreated, reading)
+}
+
+// handleSilosPage lists the silos and receives the forms declaring a silo
+// and typing in a level.
+func (s *Server) handleSilosPage(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		flash := s.successFlash(r, "silo", "Silo enregistré")
+		if flash == nil {
+			flash = s.successFlash(r, "level", "Niveau enregistré")
+		}
+		s.renderSilosPage(w, r, http.StatusOK, flash, formState{})
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			s.renderSilosPage(w, r, http.StatusBadRequest, &flashMessage{Kind: "error", Message: "Formulaire invalide"}, formState{})
+			return
+		}
+		form := newFormState(r, siloFormFields...)
+		ds := s.store.Data()
+		var entity, added string
+		var err error
+		if form.Value("kind") == "level" {
+			entity, added = "silo_reading", "level"
+			params := core.RecordSiloLevelParams{SiloID: core.ID(form.Value("silo_id")), Source: core.SiloSourceManual}
+			if params.ReadAt, err = parseDateOnly(form.Value("read_at")); err != nil {
+				form.addError("read_at", "Date du relevé invalide")
+			}
+			if params.LevelKg, err = parseFloatField(form.Value("level_kg")); err != nil {
+				form.addError("level_kg", "Niveau invalide")
+			}
+			if form.HasErrors() {
+				s.renderSilosPage(w, r, http.StatusBadRequest, invalidFormFlash(), form)
+				return
+			}
+			_, err = core.RecordSiloLevel(&ds, params)
+		} else {
+			entity, added = "silo", "silo"
+			params := core.CreateSiloParams{Name: form.Value("name")}
+			if params.CapacityKg, err = parseFloatField(form.Value("capacity_kg")); err != nil {
+				form.addError("capacity_kg", "Capacité invalide")
+				s.renderSilosPage(w, r, http.StatusBadRequest, invalidFormFlash(), form)
+				return
+			}
+			_, err = core.AddSilo(&ds, params)
+		}
+		if err != nil {
+			if form.addValidationErrors(err, nil) {
+				s.renderSilosPage(w, r, http.StatusBadRequest, invalidFormFlash(), form)
+				return
+			}
+			s.renderSilosPage(w, r, http.StatusBadRequest, &flashMessage{Kind: "error", Message: s.friendlyError(err)}, form)
+			return
+		}
+		if err := s.store.Replace(ds); err != nil {
+			log.Printf("persist silo form: %v", err)
+			s.renderSilosPage(w, r, http.StatusInternalServerError, &flashMessage{Kind: "error", Message: "Impossible d'enregistrer le silo"}, form)
+			return
+		}
+		log.Printf(`{"type":"save","entity":"%s"}`, entity)
+		http.Redirect(w, r, "/silos?added="+added, http.StatusSeeOther)
+	default:
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (s *Server) renderSilosPage(w http.ResponseWriter, r *http.Request, status int, flash *flashMessage, form formState) {
+	ds := s.store.Data()
+	ctx, cancel := s.computeContext(r)
+	defer cancel()
+	statuses, err := core.ComputeSilos(ctx, &ds)
+	switch {
+	case errors.Is(err, context.Canceled):
+		return
+	case err != nil:
+		status = http.StatusOK
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusServiceUnavailable
+		}
+		s.renderPage(w, status, "silos", "Silos", "silos", silosView{Form: form}, &flashMessage{Kind: "error", Message: s.friendlyError(err)})
+		return
+	}
+	view := silosView{Form: form, Silos: make([]siloCard, len(statuses))}
+	for i, status := range statuses {
+		view.Silos[i] = newSiloCard(status)
+	}
+	s.renderPage(w, status, "silos", "Silos", "silos", view, flash)
+}
+
+func newSiloCard(status core.SiloStatus) siloCard {
+	card := siloCard{SiloStatus: status}
+	history := status.History
+	if len(history) > maxSiloBars {
+		history = history[len(history)-maxSiloBars:]
+	}
+	percent := func(kg float64) int {
+		if status.CapacityKg <= 0 {
+			return 0
+		}
+		return min(100, max(0, int(kg*100/status.CapacityKg+0.5)))
+	}
+	for _, point := range history {
+		card.Bars = append(card.Bars, siloBar{
+			SiloLevelPoint:  point,
+			Label:           point.ReadAt.Format("02/01"),
+			HeightPercent:   percent(point.LevelKg),
+			ExpectedPercent: percent(point.ExpectedKg),
+		})
+	}
+	return card
+}
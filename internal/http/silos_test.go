@@ -0,0 +1,174 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func silosDataStore() core.DataStore {
+	return core.DataStore{
+		Brands: []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}},
+		Purchases: []core.Purchase{{
+			Meta:               core.Meta{ID: "p1"},
+			BrandID:            "brand-w",
+			PurchasedAt:        time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC),
+			TotalWeightKg:      3000,
+			PricePerTonneCents: 39000,
+			TotalPriceCents:    117000,
+			Location:           "Silo",
+		}},
+		Silos: []core.Silo{{Meta: core.Meta{ID: "silo"}, Name: "Silo", CapacityKg: 4000}},
+	}
+}
+
+func TestServer_handleSiloByIDAPI(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		method string
+		path   string
+		body   string
+	}
+	type want struct {
+		statusCode int
+		replaced   bool
+		levelKg    float64
+		source     string
+		silos      int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "records a sensor reading in kg",
+			params: params{method: http.MethodPost, path: "/api/silos/silo/niveau", body: `{"level_kg":2512.5,"read_at":"2024-10-01T06:00:00Z"}`},
+			want:   want{statusCode: http.StatusCreated, replaced: true, levelKg: 2512.5, source: core.SiloSourceSensor, silos: 1},
+		},
+		{
+			name:   "converts a percentage of the capacity",
+			params: params{method: http.MethodPost, path: "/api/silos/silo/niveau", body: `{"level_percent":62.5,"read_at":"2024-10-01T06:00:00Z","source":"manual"}`},
+			want:   want{statusCode: http.StatusCreated, replaced: true, levelKg: 2500, source: core.SiloSourceManual, silos: 1},
+		},
+		{
+			name:   "rejects both a weight and a percentage",
+			params: params{method: http.MethodPost, path: "/api/silos/silo/niveau", body: `{"level_kg":100,"level_percent":10}`},
+			want:   want{statusCode: http.StatusBadRequest, silos: 1},
+		},
+		{
+			name:   "rejects a level above the capacity",
+			params: params{method: http.MethodPost, path: "/api/silos/silo/niveau", body: `{"level_kg":4500}`},
+			want:   want{statusCode: http.StatusBadRequest, silos: 1},
+		},
+		{
+			name:   "reports unknown silos",
+			params: params{method: http.MethodPost, path: "/api/silos/missing/niveau", body: `{"level_kg":100}`},
+			want:   want{statusCode: http.StatusNotFound, silos: 1},
+		},
+		{
+			name:   "deletes a silo",
+			params: params{method: http.MethodDelete, path: "/api/silos/silo"},
+			want:   want{statusCode: http.StatusNoContent, replaced: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: silosDataStore()}
+			server := NewServer(store, Config{})
+
+			req := httptest.NewRequest(tc.params.method, tc.params.path, strings.NewReader(tc.params.body))
+			rec := httptest.NewRecorder()
+			server.handleSiloByIDAPI(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.replaced, store.replaced, tc.name)
+			assert.Len(t, store.data.Silos, tc.want.silos, tc.name)
+			if tc.want.statusCode == http.StatusCreated {
+				var reading core.SiloReading
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &reading), tc.name)
+				assert.Equal(t, tc.want.levelKg, reading.LevelKg, tc.name)
+				assert.Equal(t, tc.want.source, reading.Source, tc.name)
+			}
+		})
+	}
+}
+
+func TestServer_handleSilosPage(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		form url.Values
+	}
+	type want struct {
+		statusCode     int
+		replaced       bool
+		bodyContains   []string
+		redirectTarget string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "declares a silo",
+			params: params{form: url.Values{"name": {"Cuve"}, "capacity_kg": {"2000"}}},
+			want:   want{statusCode: http.StatusSeeOther, replaced: true, redirectTarget: "/silos?added=silo"},
+		},
+		{
+			name:   "types in a level",
+			params: params{form: url.Values{"kind": {"level"}, "silo_id": {"silo"}, "read_at": {"2024-10-01"}, "level_kg": {"2450,5"}}},
+			want:   want{statusCode: http.StatusSeeOther, replaced: true, redirectTarget: "/silos?added=level"},
+		},
+		{
+			name:   "flags a duplicate silo",
+			params: params{form: url.Values{"name": {"silo"}, "capacity_kg": {"2000"}}},
+			want:   want{statusCode: http.StatusBadRequest, bodyContains: []string{"Ce silo existe déjà"}},
+		},
+		{
+			name:   "flags a level above the capacity",
+			params: params{form: url.Values{"kind": {"level"}, "silo_id": {"silo"}, "read_at": {"2024-10-01"}, "level_kg": {"5000"}}},
+			want:   want{statusCode: http.StatusBadRequest, bodyContains: []string{"Le niveau ne peut pas dépasser la capacité du silo", `value="5000"`}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: silosDataStore()}
+			server := NewServer(store, Config{})
+
+			req := httptest.NewRequest(http.MethodPost, "/silos", strings.NewReader(tc.params.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			server.handleSilosPage(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.replaced, store.replaced, tc.name)
+			assert.Equal(t, tc.want.redirectTarget, rec.Header().Get("Location"), tc.name)
+			body := rec.Body.String()
+			for _, fragment := range tc.want.bodyContains {
+				assert.Contains(t, body, fragment, tc.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package http
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// exportMaxDuration bounds an export that keeps progressing, however slowly.
+const exportMaxDuration = 10 * time.Minute
+
+// stallWriter disconnects a client that stops reading a response: each write
+// must reach the connection within timeout, the deadline moving forward as
+// long as the client reads. It replaces the write timeout of the server, so a
+// slow but steady download is not cut short.
+type stallWriter struct {
+	http.ResponseWriter
+	controller *http.ResponseController
+	timeout    time.Duration
+	end        time.Time
+	stalled    bool
+}
+
+func newStallWriter(w http.ResponseWriter, timeout time.Duration) *stallWriter {
+	return &stallWriter{
+		ResponseWriter: w,
+		controller:     http.NewResponseController(w),
+		timeout:        timeout,
+		end:            time.Now().Add(exportMaxDuration),
+	}
+}
+
+func (w *stallWriter) Write(p []byte) (int, error) {
+	w.extend()
+	n, err := w.ResponseWriter.Write(p)
+	if err != nil && errors.Is(err, os.ErrDeadlineExceeded) {
+		w.stalled = true
+	}
+	return n, err
+}
+
+func (w *stallWriter) WriteHeader(status int) {
+	w.extend()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *stallWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// extend moves the write deadline timeout from now, without passing
+// exportMaxDuration. Writers that cannot set a deadline keep the timeout of
+// the server.
+func (w *stallWriter) extend() {
+	deadline := time.Now().Add(w.timeout)
+	if deadline.After(w.end) {
+		deadline = w.end
+	}
+	_ = w.controller.SetWriteDeadline(deadline)
+}
+
+// protectSlowClients serves an export through a stallWriter when
+// Config.ExportStallTimeout is set, logging the clients it disconnects.
+func (s *Server) protectSlowClients(w http.ResponseWriter, r *http.Request, serve http.HandlerFunc) {
+	if s.exportStallTimeout <= 0 {
+		serve(w, r)
+		return
+	}
+	sw := newStallWriter(w, s.exportStallTimeout)
+	serve(sw, r)
+	if sw.stalled {
+		s.slowClients.Add(1)
+		log.Printf(`{"type":"slow_client","path":%q,"remote":%q,"timeout":%q}`, r.URL.Path, r.RemoteAddr, s.exportStallTimeout)
+	}
+}
@@ -0,0 +1,78 @@
+package http
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_protectSlowClients(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		timeout time.Duration
+		// read has the client read the export.
+		read bool
+	}
+	type want struct {
+		stalled bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "disconnects a client that stops reading", params: params{timeout: 100 * time.Millisecond}, want: want{stalled: true}},
+		{name: "serves a client that reads", params: params{timeout: 2 * time.Second, read: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{}, Config{ExportStallTimeout: tc.params.timeout})
+			chunk := make([]byte, 64<<10)
+			// The export is larger than the socket buffers a stalled client
+			// leaves the server to fill.
+			const chunks = 256
+			served := make(chan error, 1)
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				server.protectSlowClients(w, r, func(w http.ResponseWriter, _ *http.Request) {
+					for range chunks {
+						if _, err := w.Write(chunk); err != nil {
+							served <- err
+							return
+						}
+					}
+					served <- nil
+				})
+			}))
+			t.Cleanup(ts.Close)
+
+			client, err := net.Dial("tcp", ts.Listener.Addr().String())
+			require.NoError(t, err, tc.name)
+			t.Cleanup(func() { _ = client.Close() })
+			_, err = client.Write([]byte("GET /api/export/json HTTP/1.1\r\nHost: pellets\r\n\r\n"))
+			require.NoError(t, err, tc.name)
+			if tc.params.read {
+				go func() { _, _ = io.Copy(io.Discard, client) }()
+			}
+
+			select {
+			case err := <-served:
+				assert.Equal(t, tc.want.stalled, err != nil, tc.name)
+			case <-time.After(10 * time.Second):
+				t.Fatalf("%s: export still running", tc.name)
+			}
+			assert.Eventually(t, func() bool { return (server.slowClients.Load() == 1) == tc.want.stalled }, time.Second, 10*time.Millisecond, tc.name)
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package http
+
+import (
+	"log"
+	"time"
+
+	"pellets-tracker/internal/core"
+)
+
+// statsWarningView explains a warning of core.CheckStats on the stats page,
+// URL leading to the entry at fault when there is one.
+type statsWarningView struct {
+	Text string
+	URL  string
+}
+
+// checkStats logs and returns the warnings core.CheckStats raises on the
+// figures of a stats page or response, never nil.
+func checkStats(ds *core.DataStore, inventory core.InventorySummary, averageBagCost core.Money, from, to time.Time) []core.StatsWarning {
+	warnings := core.CheckStats(ds, inventory, averageBagCost, from, to)
+	for _, warning := range warnings {
+		log.Printf(`{"type":"stats_warning","code":%q,"brand":"%s","purchase":"%s","message":%q}`, warning.Code, warning.BrandID, warning.PurchaseID, warning.Message)
+	}
+	if warnings == nil {
+		return []core.StatsWarning{}
+	}
+	return warnings
+}
+
+func newStatsWarningViews(ds *core.DataStore, warnings []core.StatsWarning) []statsWarningView {
+	brandNames := brandLookup(ds.Brands)
+	views := make([]statsWarningView, 0, len(warnings))
+	for _, warning := range warnings {
+		var view statsWarningView
+		switch warning.Code {
+		case core.StatsWarningNegativeInventory:
+			view.Text = "Le stock a une valeur, un poids ou un nombre de sacs négatif."
+			if warning.BrandID != "" {
+				view.Text = "Le stock de " + brandNames[warning.BrandID] + " a une valeur, un poids ou un nombre de sacs négatif."
+			}
+		case core.StatsWarningAverageAbovePrices:
+			view.Text = "Le coût moyen d'un sac consommé dépasse le prix de tous les sacs achetés."
+		case core.StatsWarningWeightMismatch:
+			view.Text = "Le stock pèse plus lourd que tous les achats enregistrés."
+			if warning.PurchaseID != "" {
+				view.Text = "Le poids total d'un achat de " + brandNames[warning.BrandID] + " ne correspond pas à ses sacs."
+				view.URL = "/achats/" + string(warning.PurchaseID)
+			}
+		default:
+			view.Text = warning.Message
+		}
+		views = append(views, view)
+	}
+	return views
+}
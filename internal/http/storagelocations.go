@@ -0,0 +1,122 @@
+package http
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"pellets-tracker/internal/core"
+)
+
+type storageLocationPayload struct {
+	Name  string `json:"name"`
+	Notes string `json:"notes"`
+}
+
+func (s *Server) handleStorageLocationsAPI(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ds := s.store.Data()
+		locations := ds.StorageLocations
+		if locations == nil {
+			locations = []core.StorageLocation{}
+		}
+		s.writeJSON(w, http.StatusOK, locations)
+	case http.MethodPost:
+		var payload storageLocationPayload
+		if err := decodeJSON(r.Body, &payload); err != nil {
+			s.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		ds := s.store.Data()
+		location, err := core.AddStorageLocation(&ds, core.StorageLocationParams{Name: payload.Name, Notes: payload.Notes})
+		if err != nil {
+			s.handleCoreError(w, err)
+			return
+		}
+		if err := s.store.Replace(ds); err != nil {
+			s.handleStoreError(w, err)
+			return
+		}
+		log.Printf(`{"type":"save","entity":"storage_location","id":"%s"}`, location.ID)
+		s.writeJSON(w, http.StatusCreated, location)
+	default:
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleStorageLocationByIDAPI renames a storage location, together with the
+// purchases and transfers stored there, or removes its declaration.
+func (s *Server) handleStorageLocationByIDAPI(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/emplacements/")
+	if rest == "" || strings.ContainsRune(rest, '/') {
+		s.notFound(w, r)
+		return
+	}
+	id := core.ID(rest)
+
+	ds := s.store.Data()
+	switch r.Method {
+	case http.MethodPut:
+		var payload storageLocationPayload
+		if err := decodeJSON(r.Body, &payload); err != nil {
+			s.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		location, err := core.UpdateStorageLocation(&ds, id, core.StorageLocationParams{Name: payload.Name, Notes: payload.Notes})
+		if err != nil {
+			s.handleCoreError(w, err)
+			return
+		}
+		if err := s.store.Replace(ds); err != nil {
+			s.handleStoreError(w, err)
+			return
+		}
+		log.Printf(`{"type":"save","entity":"storage_location","id":"%s"}`, location.ID)
+		s.writeJSON(w, http.StatusOK, location)
+	case http.MethodDelete:
+		if err := core.DeleteStorageLocation(&ds, id); err != nil {
+			s.handleCoreError(w, err)
+			return
+		}
+		if err := s.store.Replace(ds); err != nil {
+			s.handleStoreError(w, err)
+			return
+		}
+		log.Printf(`{"type":"save","entity":"storage_location","id":"%s","action":"delete"}`, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.methodNotAllowed(w, r, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// handleStorageLocationsPage declares a storage location from the stats
+// page, where the stock by location is shown.
+func (s *Server) handleStorageLocationsPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.renderStatsPage(w, r, http.StatusBadRequest, &flashMessage{Kind: "error", Message: "Formulaire invalide"}, formState{})
+		return
+	}
+	form := newFormState(r, storageLocationFormFields...)
+	ds := s.store.Data()
+	location, err := core.AddStorageLocation(&ds, core.StorageLocationParams{Name: form.Value("location_name"), Notes: form.Value("location_notes")})
+	if err != nil {
+		if form.addValidationErrors(err, storageLocationFormAliases) {
+			s.renderStatsPage(w, r, http.StatusBadRequest, invalidFormFlash(), form)
+			return
+		}
+		s.renderStatsPage(w, r, http.StatusBadRequest, &flashMessage{Kind: "error", Message: s.friendlyError(err)}, form)
+		return
+	}
+	if err := s.store.Replace(ds); err != nil {
+		log.Printf("persist storage location form: %v", err)
+		s.renderStatsPage(w, r, http.StatusInternalServerError, &flashMessage{Kind: "error", Message: "Impossible d'enregistrer l'emplacement"}, form)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"storage_location","id":"%s"}`, location.ID)
+	http.Redirect(w, r, "/stats?added=location", http.StatusSeeOther)
+}
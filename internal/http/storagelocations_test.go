@@ -0,0 +1,179 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func storageLocationDataStore() core.DataStore {
+	return core.DataStore{
+		Brands: []core.Brand{{Meta: core.Meta{ID: "brand-a"}, Name: "Granules"}},
+		Purchases: []core.Purchase{{
+			Meta:           core.Meta{ID: "purchase-a"},
+			BrandID:        "brand-a",
+			PurchasedAt:    time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC),
+			Bags:           5,
+			BagWeightKg:    15,
+			TotalWeightKg:  75,
+			UnitPriceCents: 500,
+			Location:       "Garage",
+		}},
+		StorageLocations: []core.StorageLocation{{Meta: core.Meta{ID: "loc-garage"}, Name: "Garage"}},
+	}
+}
+
+func TestServer_handleStorageLocationsAPI(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		method string
+		path   string
+		body   string
+	}
+	type want struct {
+		statusCode int
+		replaced   bool
+		locations  []string
+		purchaseAt string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "lists the declared locations",
+			params: params{method: http.MethodGet, path: "/api/emplacements"},
+			want:   want{statusCode: http.StatusOK, locations: []string{"Garage"}, purchaseAt: "Garage"},
+		},
+		{
+			name:   "declares a location",
+			params: params{method: http.MethodPost, path: "/api/emplacements", body: `{"name":"Abri","notes":"Au fond du jardin"}`},
+			want:   want{statusCode: http.StatusCreated, replaced: true, locations: []string{"Garage", "Abri"}, purchaseAt: "Garage"},
+		},
+		{
+			name:   "rejects a location declared twice",
+			params: params{method: http.MethodPost, path: "/api/emplacements", body: `{"name":"garage"}`},
+			want:   want{statusCode: http.StatusBadRequest},
+		},
+		{
+			name:   "renames the location of the purchases",
+			params: params{method: http.MethodPut, path: "/api/emplacements/loc-garage", body: `{"name":"Cellier"}`},
+			want:   want{statusCode: http.StatusOK, replaced: true, locations: []string{"Cellier"}, purchaseAt: "Cellier"},
+		},
+		{
+			name:   "removes the declaration only",
+			params: params{method: http.MethodDelete, path: "/api/emplacements/loc-garage"},
+			want:   want{statusCode: http.StatusNoContent, replaced: true, locations: []string{}, purchaseAt: "Garage"},
+		},
+		{
+			name:   "reports an unknown location",
+			params: params{method: http.MethodPut, path: "/api/emplacements/missing", body: `{"name":"Cellier"}`},
+			want:   want{statusCode: http.StatusNotFound},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: storageLocationDataStore()}
+			server := NewServer(store, Config{})
+			req := httptest.NewRequest(tc.params.method, tc.params.path, strings.NewReader(tc.params.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.replaced, store.replaced, tc.name)
+			if tc.want.locations == nil {
+				return
+			}
+			ds := store.Data()
+			names := []string{}
+			for _, location := range ds.StorageLocations {
+				names = append(names, location.Name)
+			}
+			assert.Equal(t, tc.want.locations, names, tc.name)
+			assert.Equal(t, tc.want.purchaseAt, ds.Purchases[0].Location, tc.name)
+			if tc.params.method == http.MethodGet {
+				var got []core.StorageLocation
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got), tc.name)
+				assert.Len(t, got, len(tc.want.locations), tc.name)
+			}
+		})
+	}
+}
+
+func TestServer_handleStorageLocationsPage(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		form url.Values
+	}
+	type want struct {
+		statusCode     int
+		replaced       bool
+		bodyContains   []string
+		redirectTarget string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "declares the location",
+			params: params{form: url.Values{"location_name": {"Abri"}, "location_notes": {"Au fond du jardin"}}},
+			want:   want{statusCode: http.StatusSeeOther, replaced: true, redirectTarget: "/stats?added=location"},
+		},
+		{
+			name:   "rejects a location declared twice",
+			params: params{form: url.Values{"location_name": {"garage"}}},
+			want:   want{statusCode: http.StatusBadRequest, bodyContains: []string{"Cet emplacement existe déjà", `name="location_name" value="garage"`}},
+		},
+		{
+			name:   "requires a name",
+			params: params{form: url.Values{"location_notes": {"Au fond du jardin"}}},
+			want:   want{statusCode: http.StatusBadRequest, bodyContains: []string{`value="Au fond du jardin"`}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: storageLocationDataStore()}
+			server := NewServer(store, Config{})
+			req := httptest.NewRequest(http.MethodPost, "/emplacements", strings.NewReader(tc.params.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Equal(t, tc.want.replaced, store.replaced, tc.name)
+			if tc.want.redirectTarget != "" {
+				assert.Equal(t, tc.want.redirectTarget, rec.Header().Get("Location"), tc.name)
+			}
+			for _, fragment := range tc.want.bodyContains {
+				assert.Contains(t, rec.Body.String(), fragment, tc.name)
+			}
+		})
+	}
+}
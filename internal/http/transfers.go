@@ -0,0 +1,132 @@
+package http
+
+import (
+	"log"
+	"net/http"
+
+	"pellets-tracker/internal/core"
+)
+
+type transferPayload struct {
+	BrandID       core.ID `json:"brand_id"`
+	ToBrandID     core.ID `json:"to_brand_id"`
+	FromLocation  string  `json:"from_location"`
+	ToLocation    string  `json:"to_location"`
+	Bags          int     `json:"bags"`
+	TransferredAt string  `json:"transferred_at"`
+	Notes         string  `json:"notes"`
+}
+
+func (s *Server) handleTransfersAPI(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ds := s.store.Data()
+		transfers := ds.Transfers
+		if transfers == nil {
+			transfers = []core.Transfer{}
+		}
+		s.writeJSON(w, http.StatusOK, transfers)
+	case http.MethodPost:
+		s.createTransfer(w, r)
+	default:
+		s.methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (s *Server) createTransfer(w http.ResponseWriter, r *http.Request) {
+	var payload transferPayload
+	if err := decodeJSON(r.Body, &payload); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	transferredAt, err := parseTime(payload.TransferredAt)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	ds := s.store.Data()
+	transfer, err := core.AddTransfer(&ds, core.CreateTransferParams{
+		BrandID:       payload.BrandID,
+		ToBrandID:     payload.ToBrandID,
+		FromLocation:  payload.FromLocation,
+		ToLocation:    payload.ToLocation,
+		Bags:          payload.Bags,
+		TransferredAt: transferredAt,
+		Notes:         payload.Notes,
+	})
+	if err != nil {
+		s.handleCoreError(w, err)
+		return
+	}
+	if err := s.store.Replace(ds); err != nil {
+		s.handleStoreError(w, err)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"transfer","id":"%s"}`, transfer.ID)
+	s.writeJSON(w, http.StatusCreated, transfer)
+}
+
+// handleAuditAPI lists the audit trail, newest first.
+func (s *Server) handleAuditAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	ds := s.store.Data()
+	entries := ds.Audit
+	if entries == nil {
+		entries = []core.AuditEntry{}
+	}
+	s.writeJSON(w, http.StatusOK, entries)
+}
+
+// handleTransfersPage receives the transfer form of the statistics page.
+func (s *Server) handleTransfersPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.renderStatsPage(w, r, http.StatusBadRequest, &flashMessage{Kind: "error", Message: "Formulaire invalide"}, formState{})
+		return
+	}
+	form := newFormState(r, transferFormFields...)
+	transferredAt, err := parseDateOnly(form.Value("transferred_at"))
+	if err != nil {
+		form.addError("transferred_at", "Date du transfert invalide")
+	}
+	bags, err := parseIntField(form.Value("bags"))
+	if err != nil {
+		form.addError("bags", "Nombre de sacs invalide")
+	}
+	if form.HasErrors() {
+		s.renderStatsPage(w, r, http.StatusBadRequest, invalidFormFlash(), form)
+		return
+	}
+
+	ds := s.store.Data()
+	transfer, err := core.AddTransfer(&ds, core.CreateTransferParams{
+		BrandID:       core.ID(form.Value("brand_id")),
+		ToBrandID:     core.ID(form.Value("to_brand_id")),
+		FromLocation:  form.Value("from_location"),
+		ToLocation:    form.Value("to_location"),
+		Bags:          bags,
+		TransferredAt: transferredAt,
+		Notes:         form.Value("notes"),
+	})
+	if err != nil {
+		if form.addValidationErrors(err, nil) {
+			s.renderStatsPage(w, r, http.StatusBadRequest, invalidFormFlash(), form)
+			return
+		}
+		s.renderStatsPage(w, r, http.StatusBadRequest, &flashMessage{Kind: "error", Message: s.friendlyError(err)}, form)
+		return
+	}
+	if err := s.store.Replace(ds); err != nil {
+		log.Printf("persist transfer form: %v", err)
+		s.renderStatsPage(w, r, http.StatusInternalServerError, &flashMessage{Kind: "error", Message: "Impossible d'enregistrer le transfert"}, form)
+		return
+	}
+	log.Printf(`{"type":"save","entity":"transfer","id":"%s"}`, transfer.ID)
+	http.Redirect(w, r, "/stats?added=transfer", http.StatusSeeOther)
+}
@@ -0,0 +1,123 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestServer_handleTransfersPage(t *testing.T) {
+	t.Parallel()
+
+	brandID := core.NewID()
+	baseData := core.DataStore{
+		Brands: []core.Brand{{
+			Meta: core.Meta{ID: brandID, CreatedAt: time.Now(), UpdatedAt: time.Now()},
+			Name: "Granules",
+		}},
+		Purchases: []core.Purchase{{
+			Meta:           core.Meta{ID: core.NewID(), CreatedAt: time.Now(), UpdatedAt: time.Now()},
+			BrandID:        brandID,
+			PurchasedAt:    time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC),
+			Bags:           5,
+			BagWeightKg:    15,
+			TotalWeightKg:  75,
+			UnitPriceCents: 500,
+			Location:       "Garage",
+		}},
+	}
+
+	type params struct {
+		form url.Values
+	}
+	type want struct {
+		statusCode     int
+		replaced       bool
+		bodyContains   []string
+		redirectTarget string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "records the transfer",
+			params: params{form: url.Values{
+				"brand_id":       {string(brandID)},
+				"from_location":  {"garage"},
+				"to_location":    {"Cave"},
+				"bags":           {"2"},
+				"transferred_at": {"2024-01-12"},
+			}},
+			want: want{
+				statusCode:     http.StatusSeeOther,
+				replaced:       true,
+				redirectTarget: "/stats?added=transfer",
+			},
+		},
+		{
+			name: "rejects moving more bags than stored",
+			params: params{form: url.Values{
+				"brand_id":       {string(brandID)},
+				"from_location":  {"Garage"},
+				"to_location":    {"Cave"},
+				"bags":           {"6"},
+				"transferred_at": {"2024-01-12"},
+			}},
+			want: want{
+				statusCode:   http.StatusBadRequest,
+				bodyContains: []string{"Inventaire insuffisant pour cette opération", `value="6"`},
+			},
+		},
+		{
+			name: "flags identical locations",
+			params: params{form: url.Values{
+				"brand_id":       {string(brandID)},
+				"from_location":  {"Garage"},
+				"to_location":    {"Garage"},
+				"bags":           {"1"},
+				"transferred_at": {"2024-01-12"},
+			}},
+			want: want{
+				statusCode:   http.StatusBadRequest,
+				bodyContains: []string{"La destination doit être différente de l&#39;origine"},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubDataStore{data: baseData}
+			server := NewServer(store, Config{})
+
+			req := httptest.NewRequest(http.MethodPost, "/transferts", strings.NewReader(tc.params.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+
+			server.handleTransfersPage(rec, req)
+
+			res := rec.Result()
+			defer res.Body.Close()
+
+			assert.Equal(t, tc.want.statusCode, res.StatusCode, tc.name)
+			assert.Equal(t, tc.want.replaced, store.replaced, tc.name)
+			assert.Equal(t, tc.want.redirectTarget, res.Header.Get("Location"), tc.name)
+			body := rec.Body.String()
+			for _, fragment := range tc.want.bodyContains {
+				assert.Contains(t, body, fragment, tc.name)
+			}
+		})
+	}
+}
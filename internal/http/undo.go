@@ -0,0 +1,126 @@
+package http
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+
+	"pellets-tracker/internal/core"
+)
+
+// maxUndo bounds the modifications remembered for POST /api/undo.
+const maxUndo = 50
+
+// swapper is implemented by stores able to return the datastore a Replace
+// overwrote, which the undo log is built from.
+type swapper interface {
+	Swap(core.DataStore) (core.DataStore, error)
+}
+
+// changeLog wraps the datastore to remember the purchases and consumptions
+// changed by each Replace, so the last modification can be undone. The log
+// lives in memory and starts empty with every restart; it stays empty with
+// a store that is not a swapper.
+type changeLog struct {
+	DataStore
+
+	mu      sync.Mutex
+	entries [][]core.Change
+}
+
+// Replace saves ds and remembers what it changed.
+func (l *changeLog) Replace(ds core.DataStore) error {
+	store, ok := l.DataStore.(swapper)
+	if !ok {
+		return l.DataStore.Replace(ds)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	before, err := store.Swap(ds)
+	if err != nil {
+		return err
+	}
+	l.record(core.DiffChanges(&before, &ds))
+	return nil
+}
+
+// Update applies change under the writer lock of the store when it is an
+// updater and remembers what it changed. Other stores get the datastore
+// read and replaced as usual.
+func (l *changeLog) Update(change func(*core.DataStore) error) (core.DataStore, error) {
+	store, ok := l.DataStore.(updater)
+	if !ok {
+		before, ds := l.Data(), l.Data()
+		if err := change(&ds); err != nil {
+			return core.DataStore{}, err
+		}
+		return before, l.Replace(ds)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var after core.DataStore
+	before, err := store.Update(func(ds *core.DataStore) error {
+		if err := change(ds); err != nil {
+			return err
+		}
+		after = *ds
+		return nil
+	})
+	if err != nil {
+		return core.DataStore{}, err
+	}
+	l.record(core.DiffChanges(&before, &after))
+	return before, nil
+}
+
+// record remembers changes as the last modification, l.mu held.
+func (l *changeLog) record(changes []core.Change) {
+	if len(changes) == 0 {
+		return
+	}
+	l.entries = append(l.entries, changes)
+	if len(l.entries) > maxUndo {
+		l.entries = l.entries[len(l.entries)-maxUndo:]
+	}
+}
+
+type undoResponse struct {
+	Undone []core.Change `json:"undone"`
+}
+
+// handleUndoAPI reverts the last modification of the purchases and
+// consumptions, a single entry or a whole batch or import. Undoing again
+// goes one modification further back. An entry saved since by a writer
+// outside the log, such as an import or the retention purge, is not
+// overwritten: the undo answers 409 and stays in the log.
+func (s *Server) handleUndoAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+
+	s.changes.mu.Lock()
+	defer s.changes.mu.Unlock()
+	entries := s.changes.entries
+	if len(entries) == 0 {
+		s.writeError(w, http.StatusConflict, errors.New("nothing to undo"))
+		return
+	}
+	changes := entries[len(entries)-1]
+	// The inverse is saved past the log so that it is not undone in turn,
+	// under the writer lock of the store so that no other writer slips in
+	// between the check of the entries and the save.
+	err := updateStore(s.changes.DataStore, func(ds *core.DataStore) error {
+		return core.RevertChanges(ds, changes)
+	})
+	if err != nil {
+		s.handleUpdateError(w, err)
+		return
+	}
+	s.changes.entries = entries[:len(entries)-1]
+	for _, change := range changes {
+		log.Printf(`{"type":"undo","action":%q,"entity":%q,"id":"%s"}`, change.Action, change.Entity, change.EntityID)
+	}
+	s.writeJSON(w, http.StatusOK, undoResponse{Undone: changes})
+}
@@ -0,0 +1,210 @@
+package http_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	core "pellets-tracker/internal/core"
+	httpserver "pellets-tracker/internal/http"
+	"pellets-tracker/internal/store"
+)
+
+func TestServer_handleUndoAPI(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2024, time.November, 1, 0, 0, 0, 0, time.UTC)
+	seed := core.DataStore{
+		Brands:       []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}},
+		Purchases:    []core.Purchase{{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: at, Bags: 10, BagWeightKg: 15, TotalWeightKg: 150}},
+		Consumptions: []core.Consumption{{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: at, Bags: 1}},
+	}
+
+	type request struct {
+		method string
+		path   string
+		body   string
+	}
+	type params struct {
+		requests []request
+		// outside is saved to the store past the server before the undos,
+		// as an import or the retention purge would.
+		outside func(*core.DataStore)
+		undos   int
+		method  string
+	}
+	type want struct {
+		status       int
+		undone       []string
+		purchases    map[core.ID]int
+		consumptions map[core.ID]int
+		audited      []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "reports an empty history",
+			params: params{undos: 1},
+			want:   want{status: http.StatusConflict, purchases: map[core.ID]int{"p1": 10}, consumptions: map[core.ID]int{"c1": 1}},
+		},
+		{
+			name: "restores a mistyped update",
+			params: params{
+				requests: []request{{http.MethodPut, "/api/consommations/c1", `{"consumed_at":"2024-11-01T00:00:00Z","bags":12}`}},
+				undos:    1,
+			},
+			want: want{
+				status:       http.StatusOK,
+				undone:       []string{"update consumption c1"},
+				purchases:    map[core.ID]int{"p1": 10},
+				consumptions: map[core.ID]int{"c1": 1},
+				audited:      []string{"update of consumption of 2024-11-01 undone"},
+			},
+		},
+		{
+			name: "refuses to overwrite an entry saved since outside the log",
+			params: params{
+				requests: []request{{http.MethodPut, "/api/consommations/c1", `{"consumed_at":"2024-11-01T00:00:00Z","bags":12}`}},
+				outside:  func(ds *core.DataStore) { ds.Consumptions[0].Bags = 4 },
+				undos:    1,
+			},
+			want: want{status: http.StatusConflict, purchases: map[core.ID]int{"p1": 10}, consumptions: map[core.ID]int{"c1": 4}},
+		},
+		{
+			name: "refuses to recreate an entry purged since",
+			params: params{
+				requests: []request{{http.MethodPut, "/api/consommations/c1", `{"consumed_at":"2024-11-01T00:00:00Z","bags":12}`}},
+				outside:  func(ds *core.DataStore) { ds.Consumptions = nil },
+				undos:    1,
+			},
+			want: want{status: http.StatusConflict, purchases: map[core.ID]int{"p1": 10}, consumptions: map[core.ID]int{}},
+		},
+		{
+			name: "recreates a deleted entry with its id",
+			params: params{
+				requests: []request{{http.MethodDelete, "/api/achats/p1", ""}},
+				undos:    1,
+			},
+			want: want{
+				status:       http.StatusOK,
+				undone:       []string{"delete purchase p1"},
+				purchases:    map[core.ID]int{"p1": 10},
+				consumptions: map[core.ID]int{"c1": 1},
+				audited:      []string{"delete of purchase of 2024-11-01 undone"},
+			},
+		},
+		{
+			name: "goes one modification further back each time",
+			params: params{
+				requests: []request{
+					{http.MethodPut, "/api/consommations/c1", `{"consumed_at":"2024-11-01T00:00:00Z","bags":2}`},
+					{http.MethodPut, "/api/consommations/c1", `{"consumed_at":"2024-11-01T00:00:00Z","bags":3}`},
+					{http.MethodDelete, "/api/achats/p1", ""},
+				},
+				undos: 2,
+			},
+			want: want{
+				status:       http.StatusOK,
+				undone:       []string{"update consumption c1"},
+				purchases:    map[core.ID]int{"p1": 10},
+				consumptions: map[core.ID]int{"c1": 2},
+				audited:      []string{"update of consumption of 2024-11-01 undone", "delete of purchase of 2024-11-01 undone"},
+			},
+		},
+		{
+			name: "reverts a whole batch",
+			params: params{
+				requests: []request{{http.MethodPost, "/api/batch", `{"operations":[
+					{"op":"create_purchase","data":{"brand_id":"brand-w","purchased_at":"2024-11-02T00:00:00Z","bags":5,"bag_weight_kg":15}},
+					{"op":"create_consumption","data":{"brand_id":"brand-w","consumed_at":"2024-11-02T00:00:00Z","bags":1}}
+				]}`}},
+				undos: 1,
+			},
+			want: want{
+				status:       http.StatusOK,
+				purchases:    map[core.ID]int{"p1": 10},
+				consumptions: map[core.ID]int{"c1": 1},
+				audited:      []string{"create of consumption of 2024-11-02 undone", "create of purchase of 2024-11-02 undone"},
+			},
+		},
+		{
+			name:   "rejects other methods",
+			params: params{undos: 1, method: http.MethodGet},
+			want:   want{status: http.StatusMethodNotAllowed, purchases: map[core.ID]int{"p1": 10}, consumptions: map[core.ID]int{"c1": 1}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			jsonStore, err := store.NewJSONStore(filepath.Join(t.TempDir(), "data.json"), "", store.FormatCompact)
+			require.NoError(t, err, tc.name)
+			require.NoError(t, jsonStore.Replace(seed), tc.name)
+			server := httpserver.NewServer(jsonStore, httpserver.Config{})
+
+			for _, req := range tc.params.requests {
+				rec := httptest.NewRecorder()
+				server.Handler().ServeHTTP(rec, httptest.NewRequest(req.method, req.path, strings.NewReader(req.body)))
+				require.Less(t, rec.Code, http.StatusBadRequest, "%s: %s %s: %s", tc.name, req.method, req.path, rec.Body.String())
+			}
+			if tc.params.outside != nil {
+				ds := jsonStore.Data()
+				tc.params.outside(&ds)
+				require.NoError(t, jsonStore.Replace(ds), tc.name)
+			}
+			method := tc.params.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			var rec *httptest.ResponseRecorder
+			for range tc.params.undos {
+				rec = httptest.NewRecorder()
+				server.Handler().ServeHTTP(rec, httptest.NewRequest(method, "/api/undo", nil))
+			}
+
+			assert.Equal(t, tc.want.status, rec.Code, tc.name)
+			if tc.want.undone != nil {
+				var resp struct {
+					Undone []core.Change `json:"undone"`
+				}
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp), tc.name)
+				undone := make([]string, len(resp.Undone))
+				for i, change := range resp.Undone {
+					undone[i] = change.Action + " " + change.Entity + " " + string(change.EntityID)
+				}
+				assert.Equal(t, tc.want.undone, undone, tc.name)
+			}
+			ds := jsonStore.Data()
+			purchases := map[core.ID]int{}
+			for _, purchase := range ds.Purchases {
+				purchases[purchase.ID] = purchase.Bags
+			}
+			consumptions := map[core.ID]int{}
+			for _, consumption := range ds.Consumptions {
+				consumptions[consumption.ID] = consumption.Bags
+			}
+			assert.Equal(t, tc.want.purchases, purchases, tc.name)
+			assert.Equal(t, tc.want.consumptions, consumptions, tc.name)
+			var audited []string
+			for _, entry := range ds.Audit {
+				if entry.Action == core.AuditActionUndo {
+					audited = append(audited, entry.Summary)
+				}
+			}
+			assert.Equal(t, tc.want.audited, audited, tc.name)
+		})
+	}
+}
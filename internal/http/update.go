@@ -0,0 +1,66 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"pellets-tracker/internal/core"
+)
+
+// updater is implemented by stores able to apply a change while holding
+// their writer lock, see store.JSONStore.Update. It returns the datastore
+// the change replaced.
+type updater interface {
+	Update(change func(*core.DataStore) error) (core.DataStore, error)
+}
+
+// saveError wraps the error of the store in Server.update, to tell it from
+// the error of the change.
+type saveError struct {
+	err error
+}
+
+func (e *saveError) Error() string { return e.err.Error() }
+func (e *saveError) Unwrap() error { return e.err }
+
+// update applies change to the current datastore and saves the result. No
+// other writer saves in between, so the revision an update checks still
+// holds once saved. The error of change is returned as is, the one of the
+// store as a *saveError.
+func (s *Server) update(change func(*core.DataStore) error) error {
+	return updateStore(s.changes, change)
+}
+
+// updateStore applies change to store like Server.update, under the writer
+// lock of the store when it is an updater.
+func updateStore(store DataStore, change func(*core.DataStore) error) error {
+	var changeErr error
+	apply := func(ds *core.DataStore) error {
+		changeErr = change(ds)
+		return changeErr
+	}
+	var err error
+	if u, ok := store.(updater); ok {
+		_, err = u.Update(apply)
+	} else {
+		ds := store.Data()
+		if err = apply(&ds); err == nil {
+			err = store.Replace(ds)
+		}
+	}
+	if err != nil && changeErr == nil {
+		return &saveError{err: err}
+	}
+	return err
+}
+
+// handleUpdateError answers the error of Server.update like handleStoreError
+// or handleCoreError.
+func (s *Server) handleUpdateError(w http.ResponseWriter, err error) {
+	var save *saveError
+	if errors.As(err, &save) {
+		s.handleStoreError(w, save.err)
+		return
+	}
+	s.handleCoreError(w, err)
+}
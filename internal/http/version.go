@@ -0,0 +1,38 @@
+package http
+
+import (
+	"net/http"
+
+	"pellets-tracker/internal/version"
+)
+
+// UpdateNotifier reports a release newer than the running build.
+type UpdateNotifier interface {
+	Available() (version.Release, bool)
+}
+
+type versionResponse struct {
+	version.Info
+	UpdateAvailable bool             `json:"update_available"`
+	Latest          *version.Release `json:"latest,omitempty"`
+}
+
+func (s *Server) handleVersionAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	resp := versionResponse{Info: version.Current()}
+	if release, ok := s.availableUpdate(); ok {
+		resp.UpdateAvailable = true
+		resp.Latest = &release
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) availableUpdate() (version.Release, bool) {
+	if s.updates == nil {
+		return version.Release{}, false
+	}
+	return s.updates.Available()
+}
@@ -0,0 +1,99 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/version"
+)
+
+type staticUpdates struct {
+	release *version.Release
+}
+
+func (s staticUpdates) Available() (version.Release, bool) {
+	if s.release == nil {
+		return version.Release{}, false
+	}
+	return *s.release, true
+}
+
+func TestServer_version(t *testing.T) {
+	t.Parallel()
+
+	release := &version.Release{Version: "v9.0.0", URL: "https://github.com/kevynb/pellet-tracking/releases/tag/v9.0.0"}
+
+	type params struct {
+		updates UpdateNotifier
+		method  string
+		path    string
+	}
+	type want struct {
+		statusCode   int
+		available    bool
+		bodyContains string
+		bodyExcludes string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "reports build without checker",
+			params: params{method: http.MethodGet, path: "/api/version"},
+			want:   want{statusCode: http.StatusOK, bodyContains: `"go_version"`},
+		},
+		{
+			name:   "reports newer release",
+			params: params{updates: staticUpdates{release: release}, method: http.MethodGet, path: "/api/version"},
+			want:   want{statusCode: http.StatusOK, available: true, bodyContains: `"v9.0.0"`},
+		},
+		{
+			name:   "rejects writes",
+			params: params{method: http.MethodPost, path: "/api/version"},
+			want:   want{statusCode: http.StatusMethodNotAllowed},
+		},
+		{
+			name:   "pages show update notice",
+			params: params{updates: staticUpdates{release: release}, method: http.MethodGet, path: "/marques"},
+			want:   want{statusCode: http.StatusOK, bodyContains: "Une nouvelle version est disponible"},
+		},
+		{
+			name:   "pages without update",
+			params: params{updates: staticUpdates{}, method: http.MethodGet, path: "/marques"},
+			want:   want{statusCode: http.StatusOK, bodyContains: "Version " + version.Version, bodyExcludes: "Une nouvelle version est disponible"},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := NewServer(&stubDataStore{}, Config{Updates: tc.params.updates})
+			rec := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(rec, httptest.NewRequest(tc.params.method, tc.params.path, nil))
+
+			require.Equal(t, tc.want.statusCode, rec.Code, tc.name)
+			assert.Contains(t, rec.Body.String(), tc.want.bodyContains, tc.name)
+			if tc.want.bodyExcludes != "" {
+				assert.NotContains(t, rec.Body.String(), tc.want.bodyExcludes, tc.name)
+			}
+			if tc.params.path != "/api/version" || tc.want.statusCode != http.StatusOK {
+				return
+			}
+			var resp versionResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp), tc.name)
+			assert.Equal(t, version.Version, resp.Version, tc.name)
+			assert.Equal(t, tc.want.available, resp.UpdateAvailable, tc.name)
+		})
+	}
+}
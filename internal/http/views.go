@@ -1,6 +1,7 @@
 package http
 
 import (
+	"errors"
 	"fmt"
 	"html/template"
 	"io/fs"
@@ -10,8 +11,11 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/version"
 	"pellets-tracker/web"
 )
 
@@ -20,6 +24,15 @@ type pageData struct {
 	ActiveNav string
 	Flash     *flashMessage
 	Data      any
+	Version   string
+	Update    *version.Release
+	// Auth shows the account link when authentication is enabled.
+	Auth bool
+	// ReadOnlyBackup names the backup served read-only while the datastore
+	// file cannot be read.
+	ReadOnlyBackup string
+	// ReadOnlyAccess hides the forms of a Config.ReadOnlyAccess server.
+	ReadOnlyAccess bool
 }
 
 type flashMessage struct {
@@ -27,6 +40,135 @@ type flashMessage struct {
 	Message string
 }
 
+// formState keeps the values submitted through an HTML form together with the
+// per-field error messages so a rejected form can be rendered again as typed.
+type formState struct {
+	Values map[string]string
+	Errors map[string]string
+}
+
+func newFormState(r *http.Request, fields ...string) formState {
+	form := formState{Values: make(map[string]string, len(fields))}
+	for _, field := range fields {
+		form.Values[field] = strings.TrimSpace(r.FormValue(field))
+	}
+	return form
+}
+
+// Value returns the submitted value for the field.
+func (f formState) Value(field string) string {
+	return f.Values[field]
+}
+
+// Error returns the error message attached to the field, if any.
+func (f formState) Error(field string) string {
+	return f.Errors[field]
+}
+
+// HasErrors reports whether at least one field is invalid.
+func (f formState) HasErrors() bool {
+	return len(f.Errors) > 0
+}
+
+// addError records the first error message for a field.
+func (f *formState) addError(field, message string) {
+	if f.Errors == nil {
+		f.Errors = make(map[string]string)
+	}
+	if _, exists := f.Errors[field]; !exists {
+		f.Errors[field] = message
+	}
+}
+
+// addValidationErrors maps core validation errors onto form fields. aliases
+// translates core field names into form input names when they differ. It
+// reports whether err carried validation errors.
+func (f *formState) addValidationErrors(err error, aliases map[string]string) bool {
+	var ve core.ValidationErrors
+	if !errors.As(err, &ve) {
+		return false
+	}
+	for _, fieldErr := range ve {
+		field := fieldErr.Field
+		if alias, ok := aliases[field]; ok {
+			field = alias
+		}
+		f.addError(field, translateValidationMessage(fieldErr.Message))
+	}
+	return true
+}
+
+// validationMessagesFR translates the core validation messages shown next to
+// form fields.
+var validationMessagesFR = map[string]string{
+	"name is required":                               "Le nom est requis",
+	"brand name already exists":                      "Cette marque existe déjà",
+	"unknown brand":                                  "Marque inconnue",
+	"bags must be greater than zero":                 "Le nombre de sacs doit être supérieur à zéro",
+	"bag weight must be greater than zero":           "Le poids par sac doit être supérieur à zéro",
+	"unit price cannot be negative":                  "Le prix unitaire ne peut pas être négatif",
+	"price per tonne cannot be negative":             "Le prix à la tonne ne peut pas être négatif",
+	"price per tonne only applies to bulk purchases": "Le prix à la tonne est réservé aux livraisons en vrac",
+	"weight cannot be negative":                      "Le poids ne peut pas être négatif",
+	"silo name already exists":                       "Ce silo existe déjà",
+	"location already exists":                        "Cet emplacement existe déjà",
+	"location already in use":                        "Un autre emplacement porte déjà ce nom",
+	"capacity must be greater than zero":             "La capacité doit être supérieure à zéro",
+	"level cannot be negative":                       "Le niveau ne peut pas être négatif",
+	"level cannot exceed the capacity":               "Le niveau ne peut pas dépasser la capacité du silo",
+	"reading date cannot be in the far future":       "La date du relevé ne peut pas être dans le futur",
+	"purchase date cannot be in the far future":      "La date d'achat ne peut pas être dans le futur",
+	"consumption date cannot be in the far future":   "La date de consommation ne peut pas être dans le futur",
+	"power level must be between 1 and 5":            "La puissance doit être comprise entre 1 et 5",
+	"destination must differ from source":            "La destination doit être différente de l'origine",
+	"transfer date cannot be in the far future":      "La date du transfert ne peut pas être dans le futur",
+	"lead time must be between 0 and 365 days":       "Le délai de livraison doit être compris entre 0 et 365 jours",
+	"energy must be between 0 and 6 kWh/kg":          "Le pouvoir calorifique doit être compris entre 0 et 6 kWh/kg",
+	"minimum stock cannot be negative":               "Le stock minimum ne peut pas être négatif",
+	"username is required":                           "L'identifiant est requis",
+	"username already exists":                        "Cet identifiant est déjà utilisé",
+	"username cannot contain spaces":                 "L'identifiant ne peut pas contenir d'espaces",
+	"username is too long":                           "L'identifiant est trop long",
+}
+
+func translateValidationMessage(message string) string {
+	if translated, ok := validationMessagesFR[message]; ok {
+		return translated
+	}
+	return message
+}
+
+// upperFirst capitalizes the first letter of an error message for display.
+func upperFirst(message string) string {
+	for i, r := range message {
+		return string(unicode.ToUpper(r)) + message[i+utf8.RuneLen(r):]
+	}
+	return message
+}
+
+var (
+	// The revision field, only in the edit forms, carries the revision of
+	// the entry the form was filled with.
+	purchaseFormFields    = []string{"kind", "brand_id", "purchased_at", "bags", "bag_weight_kg", "unit_price_eur", "weight_kg", "price_per_tonne_eur", "location", "notes", "revision"}
+	consumptionFormFields = []string{"brand_id", "consumed_at", "bags", "weight_kg", "power_level", "notes", "revision"}
+	brandFormFields       = []string{"name", "description", "lead_time_days", "energy_kwh_per_kg", "min_stock_bags"}
+	// storageLocationFormFields are named apart from the transfer form shown
+	// next to them on the stats page.
+	storageLocationFormFields = []string{"location_name", "location_notes"}
+	siloFormFields            = []string{"kind", "name", "capacity_kg", "silo_id", "read_at", "level_kg"}
+	transferFormFields        = []string{"brand_id", "to_brand_id", "from_location", "to_location", "bags", "transferred_at", "notes"}
+
+	purchaseFormAliases = map[string]string{
+		"unit_price":      "unit_price_eur",
+		"price_per_tonne": "price_per_tonne_eur",
+	}
+	storageLocationFormAliases = map[string]string{"name": "location_name", "notes": "location_notes"}
+)
+
+// purchaseKindBulk is the kind field of the bulk delivery form, which
+// submits a weight and a price per tonne instead of bags.
+const purchaseKindBulk = "bulk"
+
 type purchaseView struct {
 	core.Purchase
 	BrandName string
@@ -36,25 +178,91 @@ type homeView struct {
 	Purchases     []purchaseView
 	Brands        []core.Brand
 	TotalInvested core.Money
+	// Locations lists the storage places already in use, offered as
+	// suggestions in the purchase form.
+	Locations []string
+	Form      formState
+	// Alerts are the stocks below their minimum, shown as a banner.
+	Alerts []core.StockAlert
+	// Receipts offers to pre-fill the form from the photo of a delivery
+	// receipt.
+	Receipts bool
+	// Page is the last page of Purchases listed.
+	Page pageInfo
 }
 
 type brandsView struct {
-	Brands []core.Brand
+	Brands []brandCard
+	// Active counts the brands that are not archived.
+	Active int
+	Form   formState
+	// MinStockBags is the minimum of the whole stock, edited on the page.
+	MinStockBags int
+}
+
+// brandCard is a brand with the yearly average bag price drawn on its card.
+type brandCard struct {
+	core.Brand
+	Prices []priceBar
+	// Trend is the price change between the first and the last year, empty
+	// with a single year of purchases.
+	Trend     string
+	TrendFrom int
+	// MarketGap compares the prices paid with the market price index, empty
+	// without index over the purchases.
+	MarketGap string
+	// Photos is the gallery of the brand.
+	Photos photoGallery
+}
+
+type priceBar struct {
+	Year          int
+	Price         core.Money
+	Change        string
+	HeightPercent int
 }
 
 type consumptionView struct {
 	core.Consumption
 	BrandName string
+	// Priced is false when the FIFO valuation of the history failed.
+	Priced          bool
+	TotalPrice      core.Money
+	BlendedBagPrice core.Money
 }
 
 type consumptionsView struct {
 	Consumptions []consumptionView
 	Brands       []core.Brand
+	Form         formState
+	// Latest is the most recent entry, offered for one-click duplication.
+	Latest      *consumptionView
+	PowerLevels []string
+	// Page is the last page of Consumptions listed.
+	Page pageInfo
 }
 
 type monthlyPoint struct {
 	Label         string
-	Bags          int
+	Bags          float64
+	WeightKg      float64
+	HeightPercent int
+	PriorYears    []monthlyBar
+}
+
+// monthlyBar is the bar of the same month in an earlier year, drawn next to
+// the current one.
+type monthlyBar struct {
+	Year          int
+	Bags          float64
+	WeightKg      float64
+	HeightPercent int
+}
+
+// stockPoint is the weight in stock at the end of a month, drawn as a bar.
+type stockPoint struct {
+	Label         string
+	WeightKg      float64
 	HeightPercent int
 }
 
@@ -64,12 +272,70 @@ type consumptionDetail struct {
 }
 
 type statsView struct {
-	Invested  core.Money
-	Consumed  core.Money
-	Average   core.Money
-	Inventory core.InventorySummary
-	Monthly   []monthlyPoint
-	Details   []consumptionDetail
+	Invested core.Money
+	Consumed core.Money
+	Average  core.Money
+	// AveragePerTonne is the average cost of the weight burnt, in cents per
+	// tonne.
+	AveragePerTonne core.Money
+	Inventory       core.InventorySummary
+	// InventoryAt is the end of the selected range the inventories are
+	// computed at, zero for the current stock.
+	InventoryAt time.Time
+	Monthly     []monthlyPoint
+	// ChartPeriod heads the periods of Monthly, "Mois" unless they were
+	// added up; ChartNote explains how a long history was shortened.
+	ChartPeriod string
+	ChartNote   string
+	// StockMonths follows the weight in stock at the end of each month.
+	StockMonths []stockPoint
+	Details     []consumptionDetail
+	// HasPriorYears reports whether any month is compared with earlier years.
+	HasPriorYears bool
+	PowerLevels   []core.PowerLevelUsage
+	// Occupancy splits the consumptions between the days at home and away.
+	Occupancy []core.OccupancyUsage
+	// Model compares the monthly consumption with the outside temperatures.
+	Model core.ConsumptionModel
+	// Forecast projects the current stock against the seasonal consumption.
+	Forecast forecastView
+	// Costing is the method the consumptions and the stock are valued with.
+	Costing core.CostingMethod
+	// PriceCalendar shades the average bag price of each brand by month of
+	// purchase, every year together.
+	PriceCalendar []priceCalendarRow
+	// Warnings lists the figures the entries cannot produce, the sign of a
+	// corrupted datastore.
+	Warnings []statsWarningView
+	// Energy and EnergyMonths estimate the heat released by the pellets burnt.
+	Energy       core.EnergySummary
+	EnergyMonths []core.MonthlyEnergy
+	// StockByLocation, Transfers, Brands, Locations and TransferForm back the
+	// storage locations section, its history and its transfer form.
+	StockByLocation []core.LocationInventory
+	Transfers       []transferView
+	Brands          []core.Brand
+	Locations       []string
+	TransferForm    formState
+}
+
+// priceCalendarRow is the price calendar of a brand on the stats page.
+type priceCalendarRow struct {
+	core.BrandPriceCalendar
+	Cells []priceCalendarCell
+}
+
+type priceCalendarCell struct {
+	core.BrandPriceMonth
+	// Heat grades the price from 1 for the cheapest month of the brand to 5
+	// for the dearest, 0 for the months without purchase.
+	Heat int
+}
+
+type transferView struct {
+	core.Transfer
+	BrandName   string
+	ToBrandName string
 }
 
 var (
@@ -86,6 +352,17 @@ func newTemplateSet() map[string]*template.Template {
 			"brands":       "templates/brands.tmpl",
 			"consumptions": "templates/consumptions.tmpl",
 			"stats":        "templates/stats.tmpl",
+			"seasons":      "templates/seasons.tmpl",
+			"silos":        "templates/silos.tmpl",
+			"season":       "templates/season.tmpl",
+			"reports":      "templates/reports.tmpl",
+			"calendar":     "templates/calendar.tmpl",
+			"data":         "templates/data.tmpl",
+			"error":        "templates/error.tmpl",
+			"login":        "templates/login.tmpl",
+			"purchase":     "templates/purchase.tmpl",
+			"consumption":  "templates/consumption.tmpl",
+			"actions":      "templates/actions.tmpl",
 		}
 		templates = make(map[string]*template.Template, len(pages))
 		for name, file := range pages {
@@ -96,6 +373,19 @@ func newTemplateSet() map[string]*template.Template {
 	return templates
 }
 
+// withWeightDecimals returns copies of the page templates whose formatWeight
+// helper renders the requested number of decimals.
+func withWeightDecimals(base map[string]*template.Template, decimals int) map[string]*template.Template {
+	funcs := template.FuncMap{
+		"formatWeight": func(v float64) string { return core.FormatWeight(v, decimals) },
+	}
+	cloned := make(map[string]*template.Template, len(base))
+	for name, tmpl := range base {
+		cloned[name] = template.Must(tmpl.Clone()).Funcs(funcs)
+	}
+	return cloned
+}
+
 func staticFileServer() http.Handler {
 	staticOnce.Do(func() {
 		fsys, err := fs.Sub(web.Assets, "static")
@@ -117,20 +407,46 @@ func templateFuncMap() template.FuncMap {
 			return t.Format("02/01/2006")
 		},
 		"formatWeight": func(v float64) string {
-			s := fmt.Sprintf("%.2f", v)
-			return strings.ReplaceAll(s, ".", ",")
+			return core.FormatWeight(v, defaultWeightDecimals)
+		},
+		"formatMonth":    formatMonthLabel,
+		"monthName":      monthName,
+		"formatDay":      formatDayLabel,
+		"costingLabel":   costingLabel,
+		"occupancyLabel": occupancyLabel,
+		"costingMethods": func() []core.CostingMethod {
+			return []core.CostingMethod{core.CostingFIFO, core.CostingLIFO, core.CostingAverage}
+		},
+		"formatDecimal": func(v float64) string {
+			return strings.ReplaceAll(fmt.Sprintf("%.2f", v), ".", ",")
 		},
+		"formatKWhPrice": formatKWhPrice,
+		"formatKgPrice":  formatKgPrice,
+		"formatBags":     formatBags,
+		"formatChange":   formatPercentChange,
+		"formatPercent":  formatPercent,
+		"plural":         plural,
+		"relativeDate":   func(t time.Time) string { return relativeDate(t, time.Now()) },
+		"locationLabel": func(location string) string {
+			if location == "" {
+				return "Non précisé"
+			}
+			return location
+		},
+		// today fills the date inputs on the server, browsers without
+		// JavaScript or date pickers showing it as typed text.
+		"today": func() string { return time.Now().Format("2006-01-02") },
 		"brandImageURL": func(data string) template.URL {
 			if strings.TrimSpace(data) == "" {
 				return ""
 			}
-			return template.URL("data:image/jpeg;base64," + data)
+			return template.URL("data:" + imageContentType(data) + ";base64," + data)
 		},
 	}
 }
 
 func newHomeView(ds *core.DataStore) homeView {
-	brands := append([]core.Brand(nil), ds.Brands...)
+	brands := core.ActiveBrands(ds.Brands)
 	sort.Slice(brands, func(i, j int) bool { return strings.ToLower(brands[i].Name) < strings.ToLower(brands[j].Name) })
 	purchases := append([]core.Purchase(nil), ds.Purchases...)
 	sort.Slice(purchases, func(i, j int) bool { return purchases[i].PurchasedAt.After(purchases[j].PurchasedAt) })
@@ -140,17 +456,70 @@ func newHomeView(ds *core.DataStore) homeView {
 		rows[i] = purchaseView{Purchase: p, BrandName: lookup[p.BrandID]}
 	}
 	total := core.ComputeInvesti(ds, time.Time{}, time.Time{})
-	return homeView{Purchases: rows, Brands: brands, TotalInvested: total}
+	return homeView{Purchases: rows, Brands: brands, TotalInvested: total, Locations: core.Locations(ds)}
 }
 
 func newBrandsView(ds *core.DataStore) brandsView {
 	brands := append([]core.Brand(nil), ds.Brands...)
-	sort.Slice(brands, func(i, j int) bool { return strings.ToLower(brands[i].Name) < strings.ToLower(brands[j].Name) })
-	return brandsView{Brands: brands}
+	// The archived brands come last, out of the way.
+	sort.Slice(brands, func(i, j int) bool {
+		if brands[i].Archived != brands[j].Archived {
+			return !brands[i].Archived
+		}
+		return strings.ToLower(brands[i].Name) < strings.ToLower(brands[j].Name)
+	})
+	cards := make([]brandCard, len(brands))
+	for i, brand := range brands {
+		cards[i] = brandCard{Brand: brand, Photos: newPhotoGallery(brandPhotos, brand.ID, brand.Gallery, "/marques/"+string(brand.ID)+"/photos", "marque-"+string(brand.ID))}
+		history, err := core.ComputeBrandPriceHistory(ds, brand.ID)
+		if err != nil || len(history.Years) == 0 {
+			continue
+		}
+		maxPrice := 0.0
+		for _, year := range history.Years {
+			maxPrice = max(maxPrice, year.AverageBagPrice.Float64())
+		}
+		for _, year := range history.Years {
+			cards[i].Prices = append(cards[i].Prices, priceBar{
+				Year:          year.Year,
+				Price:         year.AverageBagPrice,
+				Change:        formatPercentChange(year.ChangePercent),
+				HeightPercent: barHeight(year.AverageBagPrice.Float64(), maxPrice),
+			})
+		}
+		cards[i].Trend = formatPercentChange(history.TrendPercent)
+		cards[i].TrendFrom = history.Years[0].Year
+		cards[i].MarketGap = formatPercentChange(history.MarketGapPercent)
+	}
+	return brandsView{Brands: cards, Active: len(core.ActiveBrands(ds.Brands)), MinStockBags: ds.MinStockBags}
 }
 
-func newConsumptionsView(ds *core.DataStore) consumptionsView {
-	brands := append([]core.Brand(nil), ds.Brands...)
+// formatKgPrice renders a cost in cents per tonne as euros per kilogram.
+func formatKgPrice(perTonne core.Money) string {
+	return strings.ReplaceAll(fmt.Sprintf("%.3f €/kg", float64(perTonne)/100000), ".", ",")
+}
+
+// formatKWhPrice renders a cost in cents per MWh as euros per kWh.
+func formatKWhPrice(perMWh core.Money) string {
+	return strings.ReplaceAll(fmt.Sprintf("%.3f €/kWh", float64(perMWh)/100000), ".", ",")
+}
+
+// formatKWh renders an energy in whole kWh.
+func formatKWh(kwh float64) string {
+	return fmt.Sprintf("%.0f kWh", kwh)
+}
+
+// formatPercentChange renders a signed French percentage such as "+11,9 %",
+// or an empty string without value.
+func formatPercentChange(percent *float64) string {
+	if percent == nil {
+		return ""
+	}
+	return strings.ReplaceAll(fmt.Sprintf("%+.1f %%", *percent), ".", ",")
+}
+
+func newConsumptionsView(ds *core.DataStore, costs map[core.ID]core.ConsumptionCost) consumptionsView {
+	brands := core.ActiveBrands(ds.Brands)
 	sort.Slice(brands, func(i, j int) bool { return strings.ToLower(brands[i].Name) < strings.ToLower(brands[j].Name) })
 	consumptions := append([]core.Consumption(nil), ds.Consumptions...)
 	sort.Slice(consumptions, func(i, j int) bool { return consumptions[i].ConsumedAt.After(consumptions[j].ConsumedAt) })
@@ -158,8 +527,20 @@ func newConsumptionsView(ds *core.DataStore) consumptionsView {
 	rows := make([]consumptionView, len(consumptions))
 	for i, c := range consumptions {
 		rows[i] = consumptionView{Consumption: c, BrandName: lookup[c.BrandID]}
+		if cost, ok := costs[c.ID]; ok {
+			rows[i].Priced = true
+			rows[i].TotalPrice = cost.TotalPrice
+			rows[i].BlendedBagPrice = cost.BlendedBagPrice
+		}
+	}
+	view := consumptionsView{Consumptions: rows, Brands: brands}
+	for level := core.MinPowerLevel; level <= core.MaxPowerLevel; level++ {
+		view.PowerLevels = append(view.PowerLevels, itoaInt(level))
 	}
-	return consumptionsView{Consumptions: rows, Brands: brands}
+	if len(rows) > 0 {
+		view.Latest = &rows[0]
+	}
+	return view
 }
 
 func newStatsView(ds *core.DataStore, invested, consumed, average core.Money, monthly []core.MonthlyBags, inventory core.InventorySummary, details []core.ConsumptionCost) statsView {
@@ -169,33 +550,178 @@ func newStatsView(ds *core.DataStore, invested, consumed, average core.Money, mo
 		return strings.ToLower(inv.Brands[i].BrandName) < strings.ToLower(inv.Brands[j].BrandName)
 	})
 	points := make([]monthlyPoint, 0, len(monthly))
-	maxBags := 0
+	maxBags := 0.0
+	hasPriorYears := false
 	for _, m := range monthly {
 		if m.Bags > maxBags {
 			maxBags = m.Bags
 		}
+		for _, prior := range m.PriorYears {
+			if prior.Bags > maxBags {
+				maxBags = prior.Bags
+			}
+		}
 	}
+	chartPeriod := "Mois"
 	for _, m := range monthly {
-		height := 0
-		if maxBags > 0 {
-			height = int(math.Round(float64(m.Bags) / float64(maxBags) * 100))
-			if height < 12 && m.Bags > 0 {
-				height = 12
-			}
+		point := monthlyPoint{Label: formatMonthLabel(m.Month), Bags: m.Bags, WeightKg: m.WeightKg, HeightPercent: barHeight(m.Bags, maxBags)}
+		switch m.Period {
+		case core.PeriodQuarter:
+			point.Label = fmt.Sprintf("T%d %d", (int(m.Month.Month())-1)/3+1, m.Month.Year())
+			chartPeriod = "Trimestre"
+		case core.PeriodSeason:
+			point.Label = core.SeasonLabel(m.Month.Year())
+			chartPeriod = "Saison"
 		}
-		points = append(points, monthlyPoint{Label: formatMonthLabel(m.Month), Bags: m.Bags, HeightPercent: height})
+		for _, prior := range m.PriorYears {
+			point.PriorYears = append(point.PriorYears, monthlyBar{Year: prior.Year, Bags: prior.Bags, WeightKg: prior.WeightKg, HeightPercent: barHeight(prior.Bags, maxBags)})
+			hasPriorYears = true
+		}
+		points = append(points, point)
 	}
 	detailsView := make([]consumptionDetail, len(details))
 	for i, d := range details {
 		detailsView[i] = consumptionDetail{ConsumptionCost: d, BrandName: lookup[d.Consumption.BrandID]}
 	}
-	return statsView{Invested: invested, Consumed: consumed, Average: average, Inventory: inv, Monthly: points, Details: detailsView}
+	brands := core.ActiveBrands(ds.Brands)
+	sort.Slice(brands, func(i, j int) bool { return strings.ToLower(brands[i].Name) < strings.ToLower(brands[j].Name) })
+	transfers := make([]transferView, len(ds.Transfers))
+	for i, t := range ds.Transfers {
+		transfers[i] = transferView{Transfer: t, BrandName: lookup[t.BrandID], ToBrandName: lookup[t.ToBrandID]}
+	}
+	return statsView{
+		Invested:      invested,
+		Consumed:      consumed,
+		Average:       average,
+		Inventory:     inv,
+		Monthly:       points,
+		ChartPeriod:   chartPeriod,
+		Details:       detailsView,
+		HasPriorYears: hasPriorYears,
+		Transfers:     transfers,
+		Brands:        brands,
+		Locations:     core.Locations(ds),
+	}
+}
+
+// newStockPoints draws the last months of the weight in stock, every month
+// when months is zero or less.
+func newStockPoints(stock []core.MonthlyStock, months int) []stockPoint {
+	if months > 0 && len(stock) > months {
+		stock = stock[len(stock)-months:]
+	}
+	maxKg := 0.0
+	for _, m := range stock {
+		maxKg = max(maxKg, m.WeightKg)
+	}
+	points := make([]stockPoint, len(stock))
+	for i, m := range stock {
+		points[i] = stockPoint{Label: formatMonthLabel(m.Month), WeightKg: m.WeightKg, HeightPercent: barHeight(m.WeightKg, maxKg)}
+	}
+	return points
+}
+
+// chartNote explains how core.LimitSacsParMois shortened the monthly chart,
+// empty when it shows every month.
+func chartNote(monthly []core.MonthlyBags, months int, rollup core.ChartRollup) string {
+	if len(core.LimitSacsParMois(monthly, months, core.ChartRollupNone)) == len(monthly) {
+		return ""
+	}
+	switch rollup {
+	case core.ChartRollupQuarter:
+		return fmt.Sprintf("Plus de %d mois sur la période : la consommation est regroupée par trimestre.", months)
+	case core.ChartRollupSeason:
+		return fmt.Sprintf("Plus de %d mois sur la période : la consommation est regroupée par saison de chauffe.", months)
+	default:
+		return fmt.Sprintf("Seuls les %d derniers mois sont affichés.", months)
+	}
+}
+
+// newPriceCalendarRows grades the monthly prices of each brand between its
+// cheapest and its dearest month.
+func newPriceCalendarRows(calendars []core.BrandPriceCalendar) []priceCalendarRow {
+	rows := make([]priceCalendarRow, len(calendars))
+	for i, calendar := range calendars {
+		lowest := calendar.Months[calendar.CheapestMonth-1].AverageBagPrice
+		highest := lowest
+		for _, month := range calendar.Months {
+			if month.Bags > 0 {
+				highest = max(highest, month.AverageBagPrice)
+			}
+		}
+		rows[i] = priceCalendarRow{BrandPriceCalendar: calendar, Cells: make([]priceCalendarCell, len(calendar.Months))}
+		for j, month := range calendar.Months {
+			cell := priceCalendarCell{BrandPriceMonth: month}
+			switch {
+			case month.Bags == 0:
+			case highest == lowest:
+				cell.Heat = 1
+			default:
+				cell.Heat = 1 + int(math.Round(float64(month.AverageBagPrice-lowest)/float64(highest-lowest)*4))
+			}
+			rows[i].Cells[j] = cell
+		}
+	}
+	return rows
+}
+
+func barHeight(bags, maxBags float64) int {
+	if maxBags <= 0 {
+		return 0
+	}
+	height := int(math.Round(bags / maxBags * 100))
+	if height < 12 && bags > 0 {
+		height = 12
+	}
+	return height
+}
+
+// costingLabel names a costing method in the pages.
+func costingLabel(method core.CostingMethod) string {
+	switch method {
+	case core.CostingLIFO:
+		return "LIFO"
+	case core.CostingAverage:
+		return "coût moyen pondéré"
+	default:
+		return "FIFO"
+	}
+}
+
+// formatBags writes a count of bags that can include the part of a bag,
+// 1,5 for a bag and a half.
+func formatBags(bags float64) string {
+	return formInputNumber(math.Round(bags*100) / 100)
 }
 
+// occupancyLabel names an occupancy status in the pages.
+func occupancyLabel(status string) string {
+	switch status {
+	case core.OccupancyAway:
+		return "Absent"
+	case core.OccupancyVacation:
+		return "Vacances"
+	default:
+		return "À la maison"
+	}
+}
+
+// monthAbbreviations names the months from January in the charts and tables.
+var monthAbbreviations = []string{"Jan.", "Fév.", "Mars", "Avr.", "Mai", "Juin", "Juil.", "Août", "Sept.", "Oct.", "Nov.", "Déc."}
+
 func formatMonthLabel(t time.Time) string {
-	months := []string{"Jan.", "Fév.", "Mars", "Avr.", "Mai", "Juin", "Juil.", "Août", "Sept.", "Oct.", "Nov.", "Déc."}
-	month := months[int(t.Month())-1]
-	return fmt.Sprintf("%s %d", month, t.Year())
+	return fmt.Sprintf("%s %d", monthName(t.Month()), t.Year())
+}
+
+// monthName abbreviates a month of the year, "Fév." for February.
+func monthName(month time.Month) string {
+	return monthAbbreviations[int(month)-1]
+}
+
+// formatDayLabel renders a day as "14 févr.".
+func formatDayLabel(t time.Time) string {
+	months := []string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."}
+	return fmt.Sprintf("%d %s", t.Day(), months[int(t.Month())-1])
 }
 
 func brandLookup(brands []core.Brand) map[core.ID]string {
@@ -0,0 +1,189 @@
+// Package jobs runs the periodic tasks of the application, such as backups
+// and integrity checks, on cron schedules, so a single binary needs no cron
+// on the host. The state of each job is kept for /api/jobs.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Func is the work of a job; the error it returns is reported as the
+// outcome of the run.
+type Func func(ctx context.Context) error
+
+// Status is the state of a job.
+type Status struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	// NextRun is nil while the job runs, or when the schedule never
+	// matches again.
+	NextRun  *time.Time `json:"next_run,omitempty"`
+	Running  bool       `json:"running"`
+	Runs     int64      `json:"runs"`
+	Failures int64      `json:"failures"`
+	// LastRun is nil until the job first completes.
+	LastRun       *Run       `json:"last_run,omitempty"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+}
+
+// Run is the outcome of a completed run of a job.
+type Run struct {
+	StartedAt      time.Time `json:"started_at"`
+	DurationMillis float64   `json:"duration_ms"`
+	Error          string    `json:"error,omitempty"`
+}
+
+type job struct {
+	name     string
+	schedule Schedule
+	fn       Func
+	// status is guarded by Scheduler.mu.
+	status Status
+}
+
+// Scheduler runs jobs on their schedules. A job never overlaps itself: a run
+// that lasts past the next time of its schedule skips it.
+type Scheduler struct {
+	mu      sync.Mutex
+	jobs    []*job
+	started bool
+	now     func() time.Time
+}
+
+// NewScheduler builds an empty Scheduler; jobs are registered with Add.
+func NewScheduler() *Scheduler {
+	return &Scheduler{now: time.Now}
+}
+
+// Add registers fn to run at every time of schedule. Names are unique, and
+// jobs cannot be added once Run has started.
+func (s *Scheduler) Add(name string, schedule Schedule, fn Func) error {
+	switch {
+	case name == "":
+		return errors.New("job without name")
+	case schedule.IsZero():
+		return fmt.Errorf("job %s: no schedule", name)
+	case fn == nil:
+		return fmt.Errorf("job %s: no function", name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return fmt.Errorf("job %s: scheduler already running", name)
+	}
+	for _, j := range s.jobs {
+		if j.name == name {
+			return fmt.Errorf("job %s: already registered", name)
+		}
+	}
+	j := &job{name: name, schedule: schedule, fn: fn, status: Status{Name: name, Schedule: schedule.String()}}
+	j.status.NextRun = timePointer(schedule.Next(s.now()))
+	s.jobs = append(s.jobs, j)
+	return nil
+}
+
+// Run runs every job on its schedule until ctx is cancelled, then waits for
+// the runs in progress to return.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	s.started = true
+	jobs := append([]*job(nil), s.jobs...)
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loop(ctx, j)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	for {
+		next := j.schedule.Next(s.now())
+		s.mu.Lock()
+		j.status.NextRun = timePointer(next)
+		s.mu.Unlock()
+		if next.IsZero() {
+			log.Printf("job %s: schedule %q never runs", j.name, j.schedule)
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.run(ctx, j)
+	}
+}
+
+// run runs j once and records its outcome. A job that panics fails its run
+// rather than the application.
+func (s *Scheduler) run(ctx context.Context, j *job) {
+	s.mu.Lock()
+	j.status.Running = true
+	j.status.NextRun = nil
+	s.mu.Unlock()
+
+	started := s.now()
+	err := func() (err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = fmt.Errorf("panic: %v", recovered)
+			}
+		}()
+		return j.fn(ctx)
+	}()
+	elapsed := s.now().Sub(started)
+
+	outcome := Run{StartedAt: started.UTC(), DurationMillis: float64(elapsed.Microseconds()) / 1000}
+	if err != nil {
+		outcome.Error = err.Error()
+	}
+	s.mu.Lock()
+	j.status.Running = false
+	j.status.Runs++
+	j.status.LastRun = &outcome
+	if err != nil {
+		j.status.Failures++
+	} else {
+		j.status.LastSuccessAt = timePointer(outcome.StartedAt)
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		log.Printf(`{"type":"job","name":%q,"duration_ms":%.1f,"error":%q}`, j.name, outcome.DurationMillis, outcome.Error)
+		return
+	}
+	log.Printf(`{"type":"job","name":%q,"duration_ms":%.1f}`, j.name, outcome.DurationMillis)
+}
+
+// Statuses returns the state of every job, sorted by name.
+func (s *Scheduler) Statuses() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]Status, len(s.jobs))
+	for i, j := range s.jobs {
+		statuses[i] = j.status
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+func timePointer(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
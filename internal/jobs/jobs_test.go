@@ -0,0 +1,225 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustSchedule(t *testing.T, spec string) Schedule {
+	t.Helper()
+	schedule, err := ParseSchedule(spec)
+	require.NoError(t, err)
+	return schedule
+}
+
+func TestScheduler_Add(t *testing.T) {
+	t.Parallel()
+
+	noop := func(context.Context) error { return nil }
+
+	type params struct {
+		name     string
+		schedule string
+		fn       Func
+	}
+	type want struct {
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "registers a job", params: params{name: "integrity", schedule: "@daily", fn: noop}},
+		{name: "rejects a second job of the same name", params: params{name: "backup", schedule: "@daily", fn: noop}, want: want{expectErr: true}},
+		{name: "rejects a job without name", params: params{schedule: "@daily", fn: noop}, want: want{expectErr: true}},
+		{name: "rejects a job without schedule", params: params{name: "integrity", fn: noop}, want: want{expectErr: true}},
+		{name: "rejects a job without function", params: params{name: "integrity", schedule: "@daily"}, want: want{expectErr: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			scheduler := NewScheduler()
+			require.NoError(t, scheduler.Add("backup", mustSchedule(t, "0 3 * * *"), noop))
+			var schedule Schedule
+			if tc.params.schedule != "" {
+				schedule = mustSchedule(t, tc.params.schedule)
+			}
+
+			err := scheduler.Add(tc.params.name, schedule, tc.params.fn)
+
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				assert.Len(t, scheduler.Statuses(), 1, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.Len(t, scheduler.Statuses(), 2, tc.name)
+		})
+	}
+}
+
+func TestScheduler_run(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, time.January, 15, 3, 0, 0, 0, time.UTC)
+
+	type params struct {
+		fn   Func
+		runs int
+	}
+	type want struct {
+		runs        int64
+		failures    int64
+		err         string
+		lastSuccess bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "records a success",
+			params: params{fn: func(context.Context) error { return nil }, runs: 2},
+			want:   want{runs: 2, lastSuccess: true},
+		},
+		{
+			name:   "records a failure",
+			params: params{fn: func(context.Context) error { return errors.New("disk full") }, runs: 1},
+			want:   want{runs: 1, failures: 1, err: "disk full"},
+		},
+		{
+			name:   "recovers from a panic",
+			params: params{fn: func(context.Context) error { panic("boom") }, runs: 1},
+			want:   want{runs: 1, failures: 1, err: "panic: boom"},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			scheduler := NewScheduler()
+			scheduler.now = func() time.Time { return now }
+			require.NoError(t, scheduler.Add("backup", mustSchedule(t, "0 3 * * *"), tc.params.fn))
+			for i := 0; i < tc.params.runs; i++ {
+				scheduler.run(context.Background(), scheduler.jobs[0])
+			}
+
+			statuses := scheduler.Statuses()
+			require.Len(t, statuses, 1, tc.name)
+			status := statuses[0]
+			assert.Equal(t, "backup", status.Name, tc.name)
+			assert.Equal(t, "0 3 * * *", status.Schedule, tc.name)
+			assert.False(t, status.Running, tc.name)
+			assert.Equal(t, tc.want.runs, status.Runs, tc.name)
+			assert.Equal(t, tc.want.failures, status.Failures, tc.name)
+			require.NotNil(t, status.LastRun, tc.name)
+			assert.Equal(t, now, status.LastRun.StartedAt, tc.name)
+			assert.Equal(t, tc.want.err, status.LastRun.Error, tc.name)
+			if tc.want.lastSuccess {
+				require.NotNil(t, status.LastSuccessAt, tc.name)
+				assert.Equal(t, now, *status.LastSuccessAt, tc.name)
+			} else {
+				assert.Nil(t, status.LastSuccessAt, tc.name)
+			}
+		})
+	}
+}
+
+func TestScheduler_Run(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		// schedule is the schedule of the job, none when empty.
+		schedule string
+		// now, when set, replaces the clock of the scheduler, making the job
+		// due at once when it is in the past.
+		now time.Time
+		// cancel stops the scheduler, once the job ran when it is due.
+		cancel bool
+	}
+	type want struct {
+		// nextRun expects the job to be planned once added.
+		nextRun bool
+		ran     bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "stops once cancelled", params: params{schedule: "@daily", cancel: true}, want: want{nextRun: true}},
+		{name: "stops without jobs", params: params{cancel: true}},
+		{name: "returns when no job ever runs", params: params{schedule: "0 0 31 2 *"}},
+		{
+			name:   "runs a job once due",
+			params: params{schedule: "* * * * *", now: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC), cancel: true},
+			want:   want{nextRun: true, ran: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			scheduler := NewScheduler()
+			if !tc.params.now.IsZero() {
+				scheduler.now = func() time.Time { return tc.params.now }
+			}
+			ran := make(chan struct{}, 1)
+			if tc.params.schedule != "" {
+				require.NoError(t, scheduler.Add("integrity", mustSchedule(t, tc.params.schedule), func(context.Context) error {
+					select {
+					case ran <- struct{}{}:
+					default:
+					}
+					return nil
+				}), tc.name)
+				assert.Equal(t, tc.want.nextRun, scheduler.Statuses()[0].NextRun != nil, tc.name)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan struct{})
+			go func() {
+				scheduler.Run(ctx)
+				close(done)
+			}()
+			if tc.want.ran {
+				select {
+				case <-ran:
+				case <-time.After(time.Second):
+					t.Fatalf("%s: the job did not run", tc.name)
+				}
+			}
+			if tc.params.cancel {
+				cancel()
+			}
+
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatalf("%s: the scheduler did not stop", tc.name)
+			}
+			if !tc.want.ran {
+				assert.Empty(t, ran, tc.name)
+			}
+			assert.Error(t, scheduler.Add("backup", mustSchedule(t, "@daily"), func(context.Context) error { return nil }), tc.name)
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scheduleMacros are the cron shorthands accepted by ParseSchedule.
+var scheduleMacros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// scheduleFields bounds the five fields of a cron expression. Sunday is both
+// 0 and 7 in the day of the week.
+var scheduleFields = [5]struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// scheduleHorizon bounds the search of the next run, so an expression that
+// never matches, such as the 30th of February, does not loop forever.
+const scheduleHorizon = 5 * 366 * 24 * time.Hour
+
+// Schedule is a cron expression, "minute hour day-of-month month
+// day-of-week", evaluated in the local time of the server. As in cron, a day
+// matches either of the day fields when both are restricted.
+type Schedule struct {
+	spec string
+	// sets holds a bit per accepted value of each field.
+	sets [5]uint64
+	// anyDayOfMonth and anyDayOfWeek remember the fields given as *.
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+}
+
+// ParseSchedule reads a five-field cron expression or one of @hourly,
+// @daily, @weekly and @monthly. Each field is *, a value, a range a-b, a
+// step */n or a-b/n, or a comma-separated list of them.
+func ParseSchedule(spec string) (Schedule, error) {
+	expr := strings.TrimSpace(spec)
+	if macro, ok := scheduleMacros[expr]; ok {
+		expr = macro
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != len(scheduleFields) {
+		return Schedule{}, fmt.Errorf("invalid schedule %q: want 5 fields, got %d", spec, len(parts))
+	}
+	schedule := Schedule{spec: strings.TrimSpace(spec)}
+	for i, part := range parts {
+		set, err := parseScheduleField(part, scheduleFields[i].min, scheduleFields[i].max)
+		if err != nil {
+			return Schedule{}, fmt.Errorf("invalid schedule %q: %s: %w", spec, scheduleFields[i].name, err)
+		}
+		schedule.sets[i] = set
+	}
+	// Sunday is accepted as 7 as well as 0.
+	if schedule.sets[4]&(1<<7) != 0 {
+		schedule.sets[4] |= 1
+	}
+	schedule.anyDayOfMonth = strings.HasPrefix(parts[2], "*")
+	schedule.anyDayOfWeek = strings.HasPrefix(parts[4], "*")
+	return schedule, nil
+}
+
+func parseScheduleField(field string, low, high int) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			parsed, err := strconv.Atoi(stepPart)
+			// A step past the width of the field would overflow the loop
+			// below.
+			if err != nil || parsed < 1 || parsed > high-low {
+				return 0, fmt.Errorf("invalid step %q, must be between 1 and %d", stepPart, high-low)
+			}
+			step = parsed
+		}
+		from, to := low, high
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			first, last, _ := strings.Cut(rangePart, "-")
+			var err error
+			if from, err = scheduleValue(first, low, high); err != nil {
+				return 0, err
+			}
+			if to, err = scheduleValue(last, low, high); err != nil {
+				return 0, err
+			}
+			if from > to {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		default:
+			value, err := scheduleValue(rangePart, low, high)
+			if err != nil {
+				return 0, err
+			}
+			from = value
+			// A single value with a step runs up to the end, as in cron.
+			if !hasStep {
+				to = value
+			}
+		}
+		for value := from; value <= to; value += step {
+			set |= 1 << value
+		}
+	}
+	return set, nil
+}
+
+func scheduleValue(text string, low, high int) (int, error) {
+	value, err := strconv.Atoi(text)
+	if err != nil || value < low || value > high {
+		return 0, fmt.Errorf("invalid value %q, must be between %d and %d", text, low, high)
+	}
+	return value, nil
+}
+
+// String returns the expression the schedule was parsed from.
+func (s Schedule) String() string {
+	return s.spec
+}
+
+// IsZero reports whether the schedule was not parsed from an expression.
+func (s Schedule) IsZero() bool {
+	return s.spec == ""
+}
+
+// Next returns the first time strictly after after matching the schedule,
+// in the location of after, or the zero time when none comes within five
+// years.
+func (s Schedule) Next(after time.Time) time.Time {
+	if s.IsZero() {
+		return time.Time{}
+	}
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.Add(scheduleHorizon)
+	for t.Before(limit) {
+		switch {
+		case !s.matches(3, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !s.matches(1, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case !s.matches(0, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s Schedule) matches(field, value int) bool {
+	return s.sets[field]&(1<<value) != 0
+}
+
+func (s Schedule) matchesDay(t time.Time) bool {
+	dayOfMonth := s.matches(2, t.Day())
+	dayOfWeek := s.matches(4, int(t.Weekday()))
+	if s.anyDayOfMonth || s.anyDayOfWeek {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
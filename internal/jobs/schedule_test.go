@@ -0,0 +1,64 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedule_Next(t *testing.T) {
+	t.Parallel()
+
+	// 2024-03-15 is a Friday.
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	type params struct {
+		spec  string
+		after time.Time
+	}
+	type want struct {
+		next      time.Time
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "runs later the same day", params: params{spec: "0 3 * * *", after: at(time.March, 15, 1, 30)}, want: want{next: at(time.March, 15, 3, 0)}},
+		{name: "runs the next day once past", params: params{spec: "0 3 * * *", after: at(time.March, 15, 3, 0)}, want: want{next: at(time.March, 16, 3, 0)}},
+		{name: "reads the macros", params: params{spec: "@weekly", after: at(time.March, 15, 12, 0)}, want: want{next: at(time.March, 17, 0, 0)}},
+		{name: "reads sunday as 7", params: params{spec: "30 2 * * 7", after: at(time.March, 15, 12, 0)}, want: want{next: at(time.March, 17, 2, 30)}},
+		{name: "reads steps and lists", params: params{spec: "*/20 8,20 * * *", after: at(time.March, 15, 8, 45)}, want: want{next: at(time.March, 15, 20, 0)}},
+		{name: "reads ranges of days", params: params{spec: "0 4 * * 1-5", after: at(time.March, 15, 5, 0)}, want: want{next: at(time.March, 18, 4, 0)}},
+		{name: "matches either restricted day", params: params{spec: "0 0 1 * 0", after: at(time.March, 18, 0, 0)}, want: want{next: at(time.March, 24, 0, 0)}},
+		{name: "crosses the year", params: params{spec: "0 0 1 1 *", after: at(time.March, 15, 0, 0)}, want: want{next: time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)}},
+		{name: "never runs on impossible days", params: params{spec: "0 0 30 2 *", after: at(time.March, 15, 0, 0)}},
+		{name: "rejects missing fields", params: params{spec: "0 3 * *"}, want: want{expectErr: true}},
+		{name: "rejects out of range values", params: params{spec: "0 24 * * *"}, want: want{expectErr: true}},
+		{name: "rejects reversed ranges", params: params{spec: "0 3 * * 5-1"}, want: want{expectErr: true}},
+		{name: "rejects zero steps", params: params{spec: "*/0 3 * * *"}, want: want{expectErr: true}},
+		{name: "reads the widest step", params: params{spec: "1/59 * * * *", after: at(time.March, 15, 8, 45)}, want: want{next: at(time.March, 15, 9, 1)}},
+		{name: "rejects steps wider than the field", params: params{spec: "1/9223372036854775807 * * * *"}, want: want{expectErr: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			schedule, err := ParseSchedule(tc.params.spec)
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.next, schedule.Next(tc.params.after), tc.name)
+		})
+	}
+}
@@ -0,0 +1,312 @@
+// Package jsonschema validates JSON documents against the subset of JSON
+// Schema (draft 2020-12) the datastore schema is written with: type,
+// properties, required, additionalProperties, items, enum, minimum, maximum,
+// minLength, maxLength, the date-time format and local $ref to $defs.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxErrors bounds the errors reported for a document: past that, the file
+// is most likely not a datastore at all.
+const MaxErrors = 50
+
+// Schema is a compiled schema.
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Defs                 map[string]*Schema `json:"$defs"`
+	Type                 typeList           `json:"type"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	Enum                 []any              `json:"enum"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Format               string             `json:"format"`
+}
+
+// Error is a violation of the schema at Path, a JSON pointer such as
+// /purchases/3/bags; the path is empty for the document itself.
+type Error struct {
+	Path    string
+	Message string
+}
+
+func (e Error) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// typeList accepts both "type": "string" and "type": ["array", "null"].
+type typeList []string
+
+func (t *typeList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = typeList{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("type must be a string or an array of strings")
+	}
+	*t = many
+	return nil
+}
+
+// Compile parses a schema and checks that its references resolve.
+func Compile(data []byte) (*Schema, error) {
+	var schema Schema
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&schema); err != nil {
+		return nil, fmt.Errorf("parse schema: %w", err)
+	}
+	if err := schema.checkRefs(&schema, ""); err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+func (s *Schema) checkRefs(root *Schema, path string) error {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		if _, err := root.resolve(s.Ref); err != nil {
+			return fmt.Errorf("schema %s: %w", path, err)
+		}
+	}
+	for name, def := range s.Defs {
+		if err := def.checkRefs(root, path+"/$defs/"+name); err != nil {
+			return err
+		}
+	}
+	for name, property := range s.Properties {
+		if err := property.checkRefs(root, path+"/properties/"+name); err != nil {
+			return err
+		}
+	}
+	return s.Items.checkRefs(root, path+"/items")
+}
+
+func (s *Schema) resolve(ref string) (*Schema, error) {
+	name, ok := strings.CutPrefix(ref, "#/$defs/")
+	if !ok {
+		return nil, fmt.Errorf("unsupported $ref %q", ref)
+	}
+	def, ok := s.Defs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown $ref %q", ref)
+	}
+	return def, nil
+}
+
+// Validate checks doc against the schema. The error is set when doc is not
+// JSON at all, with the line and column of the mistake; otherwise the
+// violations are returned, properties in alphabetical order and items in
+// array order, at most MaxErrors of them.
+func (s *Schema) Validate(doc []byte) ([]Error, error) {
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.UseNumber()
+	var value any
+	err := decoder.Decode(&value)
+	if err == nil {
+		if _, extra := decoder.Token(); extra != io.EOF {
+			err = errors.New("unexpected data after the JSON document")
+		}
+	}
+	if err != nil {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			line, column := position(doc, syntax.Offset)
+			return nil, fmt.Errorf("invalid JSON at line %d, column %d: %w", line, column, err)
+		}
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	v := validator{root: s}
+	v.validate(s, value, "")
+	return v.errs, nil
+}
+
+// position returns the line and column of the byte a syntax error was
+// reported after.
+func position(doc []byte, offset int64) (int, int) {
+	before := doc[:max(0, min(int(offset)-1, len(doc)))]
+	line := bytes.Count(before, []byte("\n")) + 1
+	return line, len(before) - bytes.LastIndexByte(before, '\n')
+}
+
+type validator struct {
+	root *Schema
+	errs []Error
+}
+
+func (v *validator) fail(path, format string, args ...any) {
+	if len(v.errs) < MaxErrors {
+		v.errs = append(v.errs, Error{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+func (v *validator) validate(s *Schema, value any, path string) {
+	if len(v.errs) >= MaxErrors {
+		return
+	}
+	if s.Ref != "" {
+		// Compile checked the reference.
+		s, _ = v.root.resolve(s.Ref)
+	}
+	if len(s.Type) > 0 && !slices.ContainsFunc(s.Type, func(t string) bool { return hasType(value, t) }) {
+		v.fail(path, "expected %s, got %s", strings.Join(s.Type, " or "), typeName(value))
+		return
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(allowed any) bool { return equal(allowed, value) }) {
+		v.fail(path, "must be one of %s", enumList(s.Enum))
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		v.validateObject(s, value, path)
+	case []any:
+		if s.Items != nil {
+			for i, item := range value {
+				v.validate(s.Items, item, path+"/"+strconv.Itoa(i))
+			}
+		}
+	case string:
+		length := len([]rune(value))
+		if s.MinLength != nil && length < *s.MinLength {
+			v.fail(path, "must be at least %d characters long", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			v.fail(path, "must be at most %d characters long", *s.MaxLength)
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, value); err != nil {
+				v.fail(path, "expected an RFC 3339 date-time such as 2024-10-01T00:00:00Z, got %q", value)
+			}
+		}
+	case json.Number:
+		number, _ := value.Float64()
+		if s.Minimum != nil && number < *s.Minimum {
+			v.fail(path, "must be at least %s", formatNumber(*s.Minimum))
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			v.fail(path, "must be at most %s", formatNumber(*s.Maximum))
+		}
+	}
+}
+
+func (v *validator) validateObject(s *Schema, object map[string]any, path string) {
+	for _, name := range s.Required {
+		if _, ok := object[name]; !ok {
+			v.fail(path, "missing required property %q", name)
+		}
+	}
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		property, ok := s.Properties[name]
+		switch {
+		case ok:
+			v.validate(property, object[name], path+"/"+escape(name))
+		case s.AdditionalProperties != nil && !*s.AdditionalProperties:
+			v.fail(path+"/"+escape(name), "unknown property")
+		}
+	}
+}
+
+func hasType(value any, name string) bool {
+	switch name {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	case "integer":
+		number, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := number.Float64()
+		return err == nil && f == math.Trunc(f)
+	}
+	return false
+}
+
+func typeName(value any) string {
+	switch value := value.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	case json.Number:
+		if hasType(value, "integer") {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// equal compares enum values through their encoding, json.Number being
+// written as the number itself.
+func equal(a, b any) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(encodedA, encodedB)
+}
+
+func enumList(values []any) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		encoded, _ := json.Marshal(value)
+		parts[i] = string(encoded)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// escape encodes a property name as a JSON pointer token.
+func escape(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
@@ -0,0 +1,171 @@
+package jsonschema_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/jsonschema"
+)
+
+const testSchema = `{
+  "type": "object",
+  "additionalProperties": false,
+  "required": ["name"],
+  "properties": {
+    "name": { "type": "string", "minLength": 1, "maxLength": 5 },
+    "level": { "type": "integer", "minimum": 1, "maximum": 5 },
+    "source": { "enum": ["manual", "sensor"] },
+    "at": { "type": "string", "format": "date-time" },
+    "tags": { "type": ["array", "null"], "items": { "$ref": "#/$defs/tag" } },
+    "a/b": { "type": "boolean" }
+  },
+  "$defs": {
+    "tag": { "type": "string" }
+  }
+}`
+
+func TestCompile(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		schema string
+	}
+	type want struct {
+		err bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "compiles a schema",
+			params: params{schema: testSchema},
+		},
+		{
+			name:   "rejects an unknown reference",
+			params: params{schema: `{"properties":{"tag":{"$ref":"#/$defs/missing"}}}`},
+			want:   want{err: true},
+		},
+		{
+			name:   "rejects a remote reference",
+			params: params{schema: `{"items":{"$ref":"https://example.com/schema.json"}}`},
+			want:   want{err: true},
+		},
+		{
+			name:   "rejects an invalid type",
+			params: params{schema: `{"type":1}`},
+			want:   want{err: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := jsonschema.Compile([]byte(tc.params.schema))
+			if tc.want.err {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			assert.NoError(t, err, tc.name)
+		})
+	}
+}
+
+func TestSchema_Validate(t *testing.T) {
+	t.Parallel()
+
+	schema, err := jsonschema.Compile([]byte(testSchema))
+	require.NoError(t, err)
+
+	type params struct {
+		doc string
+	}
+	type want struct {
+		errs []jsonschema.Error
+		err  string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "accepts a valid document",
+			params: params{doc: `{"name":"silo","level":3,"source":"sensor","at":"2024-10-01T06:00:00Z","tags":["a"],"a/b":true}`},
+		},
+		{
+			name:   "accepts a null allowed by the type",
+			params: params{doc: `{"name":"silo","tags":null}`},
+		},
+		{
+			name:   "accepts an integer written with a fraction of zero",
+			params: params{doc: `{"name":"silo","level":3.0}`},
+		},
+		{
+			name:   "reports the type expected",
+			params: params{doc: `{"name":"silo","level":2.5,"tags":[1]}`},
+			want: want{errs: []jsonschema.Error{
+				{Path: "/level", Message: "expected integer, got number"},
+				{Path: "/tags/0", Message: "expected string, got integer"},
+			}},
+		},
+		{
+			name:   "reports the bounds",
+			params: params{doc: `{"name":"granulés","level":9}`},
+			want: want{errs: []jsonschema.Error{
+				{Path: "/level", Message: "must be at most 5"},
+				{Path: "/name", Message: "must be at most 5 characters long"},
+			}},
+		},
+		{
+			name:   "reports missing and unknown properties",
+			params: params{doc: `{"nom":"silo","a/b":"yes"}`},
+			want: want{errs: []jsonschema.Error{
+				{Path: "", Message: `missing required property "name"`},
+				{Path: "/a~1b", Message: "expected boolean, got string"},
+				{Path: "/nom", Message: "unknown property"},
+			}},
+		},
+		{
+			name:   "reports enums and formats",
+			params: params{doc: `{"name":"silo","source":"radio","at":"01/10/2024"}`},
+			want: want{errs: []jsonschema.Error{
+				{Path: "/at", Message: `expected an RFC 3339 date-time such as 2024-10-01T00:00:00Z, got "01/10/2024"`},
+				{Path: "/source", Message: `must be one of "manual", "sensor"`},
+			}},
+		},
+		{
+			name:   "locates a syntax error",
+			params: params{doc: "{\n  \"name\": \"silo\",\n  \"level\": ,\n}"},
+			want:   want{err: "invalid JSON at line 3, column 12"},
+		},
+		{
+			name:   "rejects trailing data",
+			params: params{doc: `{"name":"silo"} {}`},
+			want:   want{err: "unexpected data after the JSON document"},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			errs, err := schema.Validate([]byte(tc.params.doc))
+			if tc.want.err != "" {
+				require.Error(t, err, tc.name)
+				assert.Contains(t, err.Error(), tc.want.err, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.errs, errs, tc.name)
+		})
+	}
+}
@@ -0,0 +1,226 @@
+// Package mail sends emails through an SMTP relay, such as the report
+// compiled at the end of a heating season.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	// implicitTLSPort speaks TLS from the first byte, the other ports
+	// upgrade the connection with STARTTLS when the relay offers it.
+	implicitTLSPort = "465"
+)
+
+// Config describes the SMTP relay and the addresses of the emails.
+type Config struct {
+	// Addr is the host:port of the relay, such as "smtp.example.com:587".
+	Addr string
+	// Username and Password authenticate with AUTH PLAIN, which net/smtp
+	// only sends over TLS or to localhost. Empty sends without auth.
+	Username string
+	Password string
+	From     string
+	// To receive every email.
+	To []string
+	// Timeout bounds a delivery, 30 seconds by default.
+	Timeout time.Duration
+	// TLSConfig, optional, overrides the TLS settings of the relay.
+	TLSConfig *tls.Config
+}
+
+// Attachment is a file joined to a Message.
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Message is an email in plain text, with optional attachments.
+type Message struct {
+	Subject     string
+	Text        string
+	Attachments []Attachment
+}
+
+// Mailer sends the messages it is handed to the recipients of its Config.
+type Mailer struct {
+	cfg  Config
+	host string
+	// from and to are the parsed addresses: the bare address goes to the
+	// SMTP envelope, the display name only to the headers.
+	from *netmail.Address
+	to   []*netmail.Address
+	now  func() time.Time
+}
+
+// New validates cfg and builds a Mailer.
+func New(cfg Config) (*Mailer, error) {
+	host, port, err := net.SplitHostPort(cfg.Addr)
+	if err != nil || host == "" || port == "" {
+		return nil, fmt.Errorf("invalid smtp address %q", cfg.Addr)
+	}
+	from, err := netmail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender address %q", cfg.From)
+	}
+	if len(cfg.To) == 0 {
+		return nil, errors.New("no recipient address")
+	}
+	to := make([]*netmail.Address, 0, len(cfg.To))
+	for _, recipient := range cfg.To {
+		address, err := netmail.ParseAddress(recipient)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient address %q", recipient)
+		}
+		to = append(to, address)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	return &Mailer{cfg: cfg, host: host, from: from, to: to, now: time.Now}, nil
+}
+
+// Send delivers msg to the recipients.
+func (m *Mailer) Send(ctx context.Context, msg Message) error {
+	body, err := m.encode(msg)
+	if err != nil {
+		return fmt.Errorf("encode email: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.Timeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", m.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("dial smtp: %w", err)
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return fmt.Errorf("dial smtp: %w", err)
+	}
+	if _, port, _ := net.SplitHostPort(m.cfg.Addr); port == implicitTLSPort {
+		conn = tls.Client(conn, m.tlsConfig())
+	}
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		return fmt.Errorf("smtp greeting: %w", err)
+	}
+	defer client.Close()
+	if _, isTLS := conn.(*tls.Conn); !isTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(m.tlsConfig()); err != nil {
+				return fmt.Errorf("smtp starttls: %w", err)
+			}
+		}
+	}
+	if m.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.host)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	if err := client.Mail(m.from.Address); err != nil {
+		return fmt.Errorf("smtp sender: %w", err)
+	}
+	for _, to := range m.to {
+		if err := client.Rcpt(to.Address); err != nil {
+			return fmt.Errorf("smtp recipient %s: %w", to.Address, err)
+		}
+	}
+	data, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	if _, err := data.Write(body); err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	if err := data.Close(); err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	return client.Quit()
+}
+
+func (m *Mailer) tlsConfig() *tls.Config {
+	if m.cfg.TLSConfig != nil {
+		return m.cfg.TLSConfig
+	}
+	return &tls.Config{ServerName: m.host, MinVersion: tls.VersionTLS12}
+}
+
+// encode builds the MIME document of msg: the text in quoted-printable,
+// followed by the attachments in base64.
+func (m *Mailer) encode(msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	to := make([]string, len(m.to))
+	for i, address := range m.to {
+		to[i] = address.String()
+	}
+	header := []string{
+		"From: " + m.from.String(),
+		"To: " + strings.Join(to, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date: " + m.now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/mixed; boundary=" + writer.Boundary(),
+	}
+	buf.WriteString(strings.Join(header, "\r\n") + "\r\n\r\n")
+
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	text := quotedprintable.NewWriter(part)
+	if _, err := text.Write([]byte(strings.ReplaceAll(msg.Text, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := text.Close(); err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range msg.Attachments {
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+		// RFC 2045 caps the encoded lines at 76 characters.
+		for len(encoded) > 76 {
+			if _, err := part.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+				return nil, err
+			}
+			encoded = encoded[76:]
+		}
+		if _, err := part.Write([]byte(encoded + "\r\n")); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
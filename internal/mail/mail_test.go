@@ -0,0 +1,267 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	netmail "net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		cfg Config
+	}
+	type want struct {
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "accepts a relay and addresses", params: params{cfg: Config{Addr: "smtp.example.com:587", From: "Granulés <pellets@example.com>", To: []string{"me@example.com"}}}},
+		{name: "requires a port", params: params{cfg: Config{Addr: "smtp.example.com", From: "pellets@example.com", To: []string{"me@example.com"}}}, want: want{expectErr: true}},
+		{name: "rejects an invalid sender", params: params{cfg: Config{Addr: "smtp.example.com:587", From: "pellets", To: []string{"me@example.com"}}}, want: want{expectErr: true}},
+		{name: "requires a recipient", params: params{cfg: Config{Addr: "smtp.example.com:587", From: "pellets@example.com"}}, want: want{expectErr: true}},
+		{name: "rejects an invalid recipient", params: params{cfg: Config{Addr: "smtp.example.com:587", From: "pellets@example.com", To: []string{"me"}}}, want: want{expectErr: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := New(tc.params.cfg)
+
+			assert.Equal(t, tc.want.expectErr, err != nil, tc.name)
+		})
+	}
+}
+
+// smtpServer is a minimal SMTP server recording the sessions it serves. It
+// offers AUTH PLAIN, which net/smtp sends to localhost without TLS.
+type smtpServer struct {
+	listener net.Listener
+	// rejectRcpt fails the recipients.
+	rejectRcpt bool
+
+	mu       sync.Mutex
+	auth     string
+	mailFrom string
+	rcpts    []string
+	messages []string
+}
+
+func newSMTPServer(t *testing.T, rejectRcpt bool) *smtpServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &smtpServer{listener: listener, rejectRcpt: rejectRcpt}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = io.WriteString(conn, line+"\r\n") }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			s.mu.Lock()
+			s.auth = line
+			s.mu.Unlock()
+			reply("235 2.7.0 Authentication successful")
+		case "MAIL":
+			s.mu.Lock()
+			s.mailFrom = line
+			s.mu.Unlock()
+			reply("250 OK")
+		case "RCPT":
+			if s.rejectRcpt {
+				reply("550 5.1.1 No such user")
+				continue
+			}
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, line)
+			s.mu.Unlock()
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var message strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				message.WriteString(line)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, message.String())
+			s.mu.Unlock()
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func TestMailer_Send(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		username   string
+		from       string
+		to         []string
+		rejectRcpt bool
+	}
+	type want struct {
+		auth      string
+		mailFrom  string
+		rcpts     []string
+		from      netmail.Address
+		to        []*netmail.Address
+		expectErr bool
+	}
+
+	bare := want{
+		mailFrom: "MAIL FROM:<pellets@example.com>",
+		rcpts:    []string{"RCPT TO:<me@example.com>", "RCPT TO:<you@example.com>"},
+		from:     netmail.Address{Address: "pellets@example.com"},
+		to:       []*netmail.Address{{Address: "me@example.com"}, {Address: "you@example.com"}},
+	}
+	authenticated := bare
+	authenticated.auth = "AUTH PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00pellets\x00secret"))
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "sends without auth", want: bare},
+		{name: "authenticates with a username", params: params{username: "pellets"}, want: authenticated},
+		{
+			name:   "keeps the display names out of the envelope",
+			params: params{from: "Granulés <pellets@example.com>", to: []string{"Moi <me@example.com>"}},
+			want: want{
+				mailFrom: "MAIL FROM:<pellets@example.com>",
+				rcpts:    []string{"RCPT TO:<me@example.com>"},
+				from:     netmail.Address{Name: "Granulés", Address: "pellets@example.com"},
+				to:       []*netmail.Address{{Name: "Moi", Address: "me@example.com"}},
+			},
+		},
+		{name: "fails when a recipient is rejected", params: params{rejectRcpt: true}, want: want{expectErr: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			from := tc.params.from
+			if from == "" {
+				from = "pellets@example.com"
+			}
+			to := tc.params.to
+			if to == nil {
+				to = []string{"me@example.com", "you@example.com"}
+			}
+			server := newSMTPServer(t, tc.params.rejectRcpt)
+			mailer, err := New(Config{
+				Addr:     server.listener.Addr().String(),
+				Username: tc.params.username,
+				Password: "secret",
+				From:     from,
+				To:       to,
+				Timeout:  5 * time.Second,
+			})
+			require.NoError(t, err, tc.name)
+
+			err = mailer.Send(context.Background(), Message{
+				Subject:     "Rapport de la saison 2025-2026",
+				Text:        "Dépense : 1 234,00 €\n",
+				Attachments: []Attachment{{Name: "pellets-saison-2025-2026.pdf", ContentType: "application/pdf", Data: []byte("%PDF-1.4")}},
+			})
+
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			server.mu.Lock()
+			defer server.mu.Unlock()
+			assert.Equal(t, tc.want.auth, server.auth, tc.name)
+			assert.Equal(t, tc.want.mailFrom, server.mailFrom, tc.name)
+			assert.Equal(t, tc.want.rcpts, server.rcpts, tc.name)
+			require.Len(t, server.messages, 1, tc.name)
+
+			message, err := netmail.ReadMessage(strings.NewReader(server.messages[0]))
+			require.NoError(t, err, tc.name)
+			assert.NotContains(t, message.Header.Get("From"), "é", tc.name)
+			sender, err := message.Header.AddressList("From")
+			require.NoError(t, err, tc.name)
+			require.Len(t, sender, 1, tc.name)
+			assert.Equal(t, tc.want.from, *sender[0], tc.name)
+			recipients, err := message.Header.AddressList("To")
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.to, recipients, tc.name)
+			subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, "Rapport de la saison 2025-2026", subject, tc.name)
+			_, mediaParams, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+			require.NoError(t, err, tc.name)
+			parts := multipart.NewReader(message.Body, mediaParams["boundary"])
+			text, err := parts.NextPart()
+			require.NoError(t, err, tc.name)
+			content, err := io.ReadAll(text)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, "Dépense : 1 234,00 €\r\n", string(content), tc.name)
+			attachment, err := parts.NextPart()
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, "pellets-saison-2025-2026.pdf", attachment.FileName(), tc.name)
+			content, err = io.ReadAll(base64.NewDecoder(base64.StdEncoding, attachment))
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, "%PDF-1.4", string(content), tc.name)
+		})
+	}
+}
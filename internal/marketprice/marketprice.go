@@ -0,0 +1,321 @@
+// Package marketprice pulls a public pellet price index, such as a national
+// average price per tonne, and stores it one price per month so the prices
+// paid can be compared with the market.
+package marketprice
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/numparse"
+)
+
+// Formats of the index.
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+const (
+	defaultInterval = 24 * time.Hour
+	// maxIndexBytes bounds the document read, an index being a few
+	// kilobytes.
+	maxIndexBytes = 4 << 20
+)
+
+// monthLayouts are the layouts the month of a record is read with.
+var monthLayouts = []string{"2006-01", "2006-01-02", time.RFC3339, "01/2006", "02/01/2006", "2006/01"}
+
+// Config describes where the index is published and how to read it.
+type Config struct {
+	// URL is fetched with a GET request.
+	URL string
+	// Format is FormatJSON, an array of objects, or FormatCSV, a header
+	// line followed by one line per record, separated by commas or
+	// semicolons.
+	Format string
+	// Records is the dotted path of the array of records in a JSON
+	// document, such as "data.prices"; empty when the document is the array.
+	Records string
+	// MonthField and PriceField name the properties or columns holding the
+	// month and the price of a tonne in euros.
+	MonthField string
+	PriceField string
+	// Interval is the time between two fetches, a day by default.
+	Interval time.Duration
+	Client   *http.Client
+}
+
+// Store is the datastore the prices are written to, see store.JSONStore.
+type Store interface {
+	Data() core.DataStore
+	Replace(core.DataStore) error
+}
+
+// Fetcher refreshes the market prices of a datastore from the index.
+type Fetcher struct {
+	cfg Config
+}
+
+// New validates cfg and builds a Fetcher. Nothing is fetched until Run is
+// started.
+func New(cfg Config) (*Fetcher, error) {
+	parsed, err := url.Parse(cfg.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid index url %q", cfg.URL)
+	}
+	switch {
+	case cfg.Format != FormatJSON && cfg.Format != FormatCSV:
+		return nil, fmt.Errorf("unknown index format %q", cfg.Format)
+	case cfg.Records != "" && cfg.Format != FormatJSON:
+		return nil, errors.New("a records path only applies to json")
+	case cfg.MonthField == "" || cfg.PriceField == "":
+		return nil, errors.New("month and price fields are required")
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultInterval
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Fetcher{cfg: cfg}, nil
+}
+
+// Run refreshes store every Interval until ctx is cancelled. Failures are
+// logged and retried on the next tick, the prices already stored being kept.
+func (f *Fetcher) Run(ctx context.Context, store Store) {
+	ticker := time.NewTicker(f.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := f.Refresh(ctx, store); err != nil && ctx.Err() == nil {
+			log.Printf("market price: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh fetches the index and stores the months that are new or whose
+// price changed, returning their number. Nothing is written when the index
+// brings nothing new.
+func (f *Fetcher) Refresh(ctx context.Context, store Store) (int, error) {
+	prices, err := f.Fetch(ctx)
+	if err != nil {
+		return 0, err
+	}
+	ds := store.Data()
+	known := make(map[time.Time]core.MarketPrice, len(ds.MarketPrices))
+	for _, price := range ds.MarketPrices {
+		known[price.Month] = price
+	}
+	changed := make([]core.MarketPrice, 0, len(prices))
+	for _, price := range prices {
+		if known[price.Month] != price {
+			changed = append(changed, price)
+		}
+	}
+	if len(changed) == 0 {
+		return 0, nil
+	}
+	count, err := core.SetMarketPrices(&ds, changed)
+	if err != nil {
+		return 0, err
+	}
+	if err := store.Replace(ds); err != nil {
+		return 0, fmt.Errorf("save market prices: %w", err)
+	}
+	log.Printf(`{"type":"save","entity":"market_prices","count":%d}`, count)
+	return count, nil
+}
+
+// Fetch downloads and parses the index, averaging the records of a month
+// into its price. The months come oldest first.
+func (f *Fetcher) Fetch(ctx context.Context) ([]core.MarketPrice, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.cfg.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch index: %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxIndexBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("read index: %w", err)
+	}
+	if len(body) > maxIndexBytes {
+		return nil, fmt.Errorf("index larger than %d bytes", maxIndexBytes)
+	}
+
+	var records []record
+	if f.cfg.Format == FormatCSV {
+		records, err = f.csvRecords(body)
+	} else {
+		records, err = f.jsonRecords(body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f.monthlyPrices(records)
+}
+
+// record is the raw month and price of an entry of the index.
+type record struct {
+	month string
+	price string
+}
+
+func (f *Fetcher) jsonRecords(body []byte) ([]record, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decode index: %w", err)
+	}
+	if f.cfg.Records != "" {
+		for _, key := range strings.Split(f.cfg.Records, ".") {
+			object, ok := doc.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("no %q object in the index", key)
+			}
+			doc = object[key]
+		}
+	}
+	items, ok := doc.([]any)
+	if !ok {
+		return nil, errors.New("the index holds no array of records")
+	}
+	records := make([]record, 0, len(items))
+	for i, item := range items {
+		object, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("record %d is not an object", i)
+		}
+		records = append(records, record{month: jsonText(object[f.cfg.MonthField]), price: jsonText(object[f.cfg.PriceField])})
+	}
+	return records, nil
+}
+
+// jsonText renders a string or number property as text, empty otherwise.
+func jsonText(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		return ""
+	}
+}
+
+func (f *Fetcher) csvRecords(body []byte) ([]record, error) {
+	body = bytes.TrimPrefix(body, []byte("\ufeff"))
+	reader := csv.NewReader(bytes.NewReader(body))
+	// French exports separate their columns with semicolons, the comma
+	// being the decimal separator.
+	header, _, _ := bytes.Cut(body, []byte("\n"))
+	if bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+		reader.Comma = ';'
+	}
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("decode index: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("empty index")
+	}
+	monthColumn, priceColumn := -1, -1
+	for i, name := range rows[0] {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case strings.ToLower(f.cfg.MonthField):
+			monthColumn = i
+		case strings.ToLower(f.cfg.PriceField):
+			priceColumn = i
+		}
+	}
+	if monthColumn < 0 || priceColumn < 0 {
+		return nil, fmt.Errorf("no %q and %q columns in the index", f.cfg.MonthField, f.cfg.PriceField)
+	}
+	records := make([]record, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		if monthColumn >= len(row) || priceColumn >= len(row) {
+			continue
+		}
+		records = append(records, record{month: row[monthColumn], price: row[priceColumn]})
+	}
+	return records, nil
+}
+
+// monthlyPrices averages the records of each month. Records without a price,
+// such as the months not published yet, are left out; a month or a price
+// that cannot be read fails the whole index, its layout having changed.
+func (f *Fetcher) monthlyPrices(records []record) ([]core.MarketPrice, error) {
+	type total struct {
+		sum   float64
+		count int
+	}
+	totals := map[time.Time]*total{}
+	for i, rec := range records {
+		if strings.TrimSpace(rec.price) == "" {
+			continue
+		}
+		month, err := parseMonth(rec.month)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", i, err)
+		}
+		price, err := numparse.Float(rec.price)
+		if err != nil || price <= 0 {
+			return nil, fmt.Errorf("record %d: invalid price %q", i, rec.price)
+		}
+		if totals[month] == nil {
+			totals[month] = &total{}
+		}
+		totals[month].sum += price
+		totals[month].count++
+	}
+	if len(totals) == 0 {
+		return nil, errors.New("no price in the index")
+	}
+	prices := make([]core.MarketPrice, 0, len(totals))
+	for month, total := range totals {
+		prices = append(prices, core.MarketPrice{
+			Month:              month,
+			PricePerTonneCents: core.ParseMoney(total.sum / float64(total.count)),
+			Source:             f.cfg.URL,
+		})
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i].Month.Before(prices[j].Month) })
+	return prices, nil
+}
+
+// parseMonth returns the first day of the month value falls in.
+func parseMonth(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range monthLayouts {
+		if ts, err := time.Parse(layout, value); err == nil {
+			// The month is read in the zone of the index.
+			return time.Date(ts.Year(), ts.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid month %q", value)
+}
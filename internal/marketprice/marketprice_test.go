@@ -0,0 +1,223 @@
+package marketprice
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+type stubStore struct {
+	data     core.DataStore
+	replaced bool
+}
+
+func (s *stubStore) Data() core.DataStore { return s.data }
+
+func (s *stubStore) Replace(data core.DataStore) error {
+	s.data = data
+	s.replaced = true
+	return nil
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		cfg Config
+	}
+	type want struct {
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "accepts a JSON index",
+			params: params{cfg: Config{URL: "https://example.com/index.json", Format: FormatJSON, Records: "data", MonthField: "month", PriceField: "price"}},
+		},
+		{
+			name:   "rejects a URL that is not http",
+			params: params{cfg: Config{URL: "ftp://example.com/index.csv", Format: FormatCSV, MonthField: "month", PriceField: "price"}},
+			want:   want{expectErr: true},
+		},
+		{
+			name:   "rejects an unknown format",
+			params: params{cfg: Config{URL: "https://example.com/index.xml", Format: "xml", MonthField: "month", PriceField: "price"}},
+			want:   want{expectErr: true},
+		},
+		{
+			name:   "rejects a records path on a CSV index",
+			params: params{cfg: Config{URL: "https://example.com/index.csv", Format: FormatCSV, Records: "data", MonthField: "month", PriceField: "price"}},
+			want:   want{expectErr: true},
+		},
+		{
+			name:   "requires the fields",
+			params: params{cfg: Config{URL: "https://example.com/index.json", Format: FormatJSON, MonthField: "month"}},
+			want:   want{expectErr: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := New(tc.params.cfg)
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			assert.NoError(t, err, tc.name)
+		})
+	}
+}
+
+func TestFetcher_Refresh(t *testing.T) {
+	t.Parallel()
+
+	month := func(year int, m time.Month) time.Time { return time.Date(year, m, 1, 0, 0, 0, 0, time.UTC) }
+
+	type params struct {
+		format  string
+		records string
+		fields  [2]string
+		status  int
+		body    string
+		stored  []core.MarketPrice
+	}
+	type want struct {
+		err      bool
+		count    int
+		replaced bool
+		// prices holds the price per tonne of each month stored.
+		prices map[time.Time]core.Money
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "averages the records of a month in a JSON index",
+			params: params{
+				format:  FormatJSON,
+				records: "data.prices",
+				fields:  [2]string{"date", "eur_t"},
+				status:  http.StatusOK,
+				body:    `{"data":{"prices":[{"date":"2024-09-02","eur_t":380},{"date":"2024-09-16","eur_t":"390,50"},{"date":"2024-10-01","eur_t":401.2},{"date":"2024-11-01","eur_t":null}]}}`,
+			},
+			want: want{count: 2, replaced: true, prices: map[time.Time]core.Money{month(2024, time.September): 38525, month(2024, time.October): 40120}},
+		},
+		{
+			name: "reads a French CSV index",
+			params: params{
+				format: FormatCSV,
+				fields: [2]string{"Mois", "Prix"},
+				status: http.StatusOK,
+				body:   "\ufeffMois;Prix;Variation\n10/2024;412,30;+1,2 %\n09/2024;407,40;\n",
+			},
+			want: want{count: 2, replaced: true, prices: map[time.Time]core.Money{month(2024, time.September): 40740, month(2024, time.October): 41230}},
+		},
+		{
+			name: "stores only the months that changed",
+			params: params{
+				format: FormatJSON,
+				fields: [2]string{"month", "price"},
+				status: http.StatusOK,
+				body:   `[{"month":"2024-09","price":380},{"month":"2024-10","price":395}]`,
+				stored: []core.MarketPrice{{Month: month(2024, time.September), PricePerTonneCents: 38000}, {Month: month(2024, time.October), PricePerTonneCents: 39000}},
+			},
+			want: want{count: 1, replaced: true, prices: map[time.Time]core.Money{month(2024, time.September): 38000, month(2024, time.October): 39500}},
+		},
+		{
+			name: "writes nothing when the index is unchanged",
+			params: params{
+				format: FormatJSON,
+				fields: [2]string{"month", "price"},
+				status: http.StatusOK,
+				body:   `[{"month":"2024-09","price":380}]`,
+				stored: []core.MarketPrice{{Month: month(2024, time.September), PricePerTonneCents: 38000}},
+			},
+			want: want{prices: map[time.Time]core.Money{month(2024, time.September): 38000}},
+		},
+		{
+			name: "fails on a month it cannot read",
+			params: params{
+				format: FormatJSON,
+				fields: [2]string{"month", "price"},
+				status: http.StatusOK,
+				body:   `[{"month":"septembre","price":380}]`,
+			},
+			want: want{err: true, prices: map[time.Time]core.Money{}},
+		},
+		{
+			name: "fails when the columns are missing",
+			params: params{
+				format: FormatCSV,
+				fields: [2]string{"month", "price"},
+				status: http.StatusOK,
+				body:   "date,value\n2024-09,380\n",
+			},
+			want: want{err: true, prices: map[time.Time]core.Money{}},
+		},
+		{
+			name: "keeps the stored prices when the index is unavailable",
+			params: params{
+				format: FormatJSON,
+				fields: [2]string{"month", "price"},
+				status: http.StatusServiceUnavailable,
+				stored: []core.MarketPrice{{Month: month(2024, time.September), PricePerTonneCents: 38000}},
+			},
+			want: want{err: true, prices: map[time.Time]core.Money{month(2024, time.September): 38000}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.params.status)
+				_, _ = w.Write([]byte(tc.params.body))
+			}))
+			defer server.Close()
+
+			fetcher, err := New(Config{URL: server.URL, Format: tc.params.format, Records: tc.params.records, MonthField: tc.params.fields[0], PriceField: tc.params.fields[1]})
+			require.NoError(t, err, tc.name)
+			// Stored prices name the index they come from.
+			stored := append([]core.MarketPrice(nil), tc.params.stored...)
+			for i := range stored {
+				stored[i].Source = server.URL
+			}
+			store := &stubStore{data: core.DataStore{MarketPrices: stored}}
+
+			count, err := fetcher.Refresh(context.Background(), store)
+
+			if tc.want.err {
+				assert.Error(t, err, tc.name)
+			} else {
+				assert.NoError(t, err, tc.name)
+			}
+			assert.Equal(t, tc.want.count, count, tc.name)
+			assert.Equal(t, tc.want.replaced, store.replaced, tc.name)
+			prices := map[time.Time]core.Money{}
+			for _, price := range store.data.MarketPrices {
+				prices[price.Month] = price.PricePerTonneCents
+				assert.Equal(t, server.URL, price.Source, tc.name)
+			}
+			assert.Equal(t, tc.want.prices, prices, tc.name)
+		})
+	}
+}
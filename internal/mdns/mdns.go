@@ -0,0 +1,403 @@
+// Package mdns advertises the pellets tracker on the local network through
+// multicast DNS (Bonjour) so phones and tablets can reach it as
+// <hostname>.local and discover it by browsing for its DNS-SD service.
+package mdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ErrUnavailable is returned by Run when the multicast socket cannot be
+// opened, typically on networks or containers without multicast support.
+var ErrUnavailable = errors.New("mdns unavailable")
+
+const (
+	mdnsPort = 5353
+	// TTLs follow RFC 6762: 120 seconds for records tied to a host name,
+	// 75 minutes for the others.
+	hostTTL    = 120
+	serviceTTL = 4500
+	// cacheFlush marks unique records so resolvers replace stale entries.
+	cacheFlush = 1 << 15
+	// unicastResponse is the QU bit of a question class.
+	unicastResponse = 1 << 15
+
+	defaultHostname = "pellets"
+	defaultInstance = "Pellets Tracker"
+	defaultService  = "_http._tcp"
+)
+
+var (
+	mdnsGroup       = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: mdnsPort}
+	servicesEnumAll = mustName("_services._dns-sd._udp.local.")
+)
+
+// Config describes the advertised service.
+type Config struct {
+	// Hostname is the single label published as <Hostname>.local.
+	Hostname string
+	// Instance is the human readable service name shown by browsers.
+	Instance string
+	// Service is the DNS-SD service type, _http._tcp by default.
+	Service string
+	Port    int
+	// Path is published in the TXT record so clients open the right page.
+	Path string
+}
+
+// Responder answers mDNS queries for the configured host and service.
+type Responder struct {
+	cfg      Config
+	host     dnsmessage.Name
+	service  dnsmessage.Name
+	instance dnsmessage.Name
+	// addrs lists the addresses published for the host, replaced in tests.
+	addrs func() []netip.Addr
+}
+
+// New validates cfg and builds a Responder.
+func New(cfg Config) (*Responder, error) {
+	if cfg.Hostname == "" {
+		cfg.Hostname = defaultHostname
+	}
+	if cfg.Instance == "" {
+		cfg.Instance = defaultInstance
+	}
+	if cfg.Service == "" {
+		cfg.Service = defaultService
+	}
+	if cfg.Path == "" {
+		cfg.Path = "/"
+	}
+	if strings.Contains(cfg.Hostname, ".") || len(cfg.Hostname) > 63 {
+		return nil, fmt.Errorf("invalid mdns hostname %q: must be a single label", cfg.Hostname)
+	}
+	if strings.Contains(cfg.Instance, ".") || len(cfg.Instance) > 63 {
+		return nil, fmt.Errorf("invalid mdns instance name %q", cfg.Instance)
+	}
+	if cfg.Port <= 0 || cfg.Port > 65535 {
+		return nil, fmt.Errorf("invalid mdns port %d", cfg.Port)
+	}
+
+	host, err := dnsmessage.NewName(cfg.Hostname + ".local.")
+	if err != nil {
+		return nil, fmt.Errorf("invalid mdns hostname: %w", err)
+	}
+	service, err := dnsmessage.NewName(cfg.Service + ".local.")
+	if err != nil {
+		return nil, fmt.Errorf("invalid mdns service: %w", err)
+	}
+	instance, err := dnsmessage.NewName(cfg.Instance + "." + cfg.Service + ".local.")
+	if err != nil {
+		return nil, fmt.Errorf("invalid mdns instance name: %w", err)
+	}
+	return &Responder{
+		cfg:      cfg,
+		host:     host,
+		service:  service,
+		instance: instance,
+		addrs:    interfaceAddrs,
+	}, nil
+}
+
+// Host returns the advertised host name without the trailing dot.
+func (r *Responder) Host() string {
+	return strings.TrimSuffix(r.host.String(), ".")
+}
+
+// Run announces the service and answers queries until ctx is cancelled, at
+// which point a goodbye packet withdraws the records from client caches.
+// Failing to join the multicast group yields ErrUnavailable; send failures
+// are logged once and otherwise ignored so a filtered network never stops
+// the application.
+func (r *Responder) Run(ctx context.Context) error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsGroup)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer conn.Close()
+
+	sender := &sender{conn: conn}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		// RFC 6762 asks for at least two announcements one second apart.
+		timer := time.NewTimer(time.Second)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			sender.send(r.announcement(false), mdnsGroup)
+		case <-done:
+		case <-ctx.Done():
+		}
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			sender.send(r.announcement(true), mdnsGroup)
+			conn.Close()
+		case <-done:
+		}
+	}()
+	sender.send(r.announcement(false), mdnsGroup)
+
+	buf := make([]byte, 9000)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("mdns read: %w", err)
+		}
+		resp, unicast := r.respond(buf[:n], src.Port != mdnsPort)
+		if resp == nil {
+			continue
+		}
+		dst := mdnsGroup
+		if unicast {
+			dst = src
+		}
+		sender.send(resp, dst)
+	}
+}
+
+type sender struct {
+	conn *net.UDPConn
+	warn sync.Once
+}
+
+func (s *sender) send(packet []byte, dst *net.UDPAddr) {
+	if packet == nil {
+		return
+	}
+	if _, err := s.conn.WriteToUDP(packet, dst); err != nil {
+		s.warn.Do(func() {
+			log.Printf("mdns send failed, multicast may be filtered on this network: %v", err)
+		})
+	}
+}
+
+// respond builds the answer to a query packet. legacy is set for one-shot
+// queries sent from a port other than 5353, which expect a unicast reply
+// echoing the query ID and questions. It returns nil when nothing matches.
+func (r *Responder) respond(packet []byte, legacy bool) ([]byte, bool) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(packet)
+	if err != nil || header.Response || header.OpCode != 0 {
+		return nil, false
+	}
+	questions, err := parser.AllQuestions()
+	if err != nil {
+		return nil, false
+	}
+
+	var answers, extras []dnsmessage.Resource
+	unicast := legacy
+	for _, q := range questions {
+		if uint16(q.Class)&unicastResponse != 0 {
+			unicast = true
+		}
+		a, e := r.answer(q)
+		answers = append(answers, a...)
+		extras = append(extras, e...)
+	}
+	if len(answers) == 0 {
+		return nil, false
+	}
+
+	msg := dnsmessage.Message{
+		Header:      dnsmessage.Header{Response: true, Authoritative: true},
+		Answers:     answers,
+		Additionals: dedupe(extras, answers),
+	}
+	if legacy {
+		msg.Header.ID = header.ID
+		msg.Questions = questions
+		for i := range msg.Questions {
+			msg.Questions[i].Class = dnsmessage.ClassINET
+		}
+		// Legacy resolvers do not understand the cache-flush bit and
+		// should not cache the answers for long.
+		for _, section := range [][]dnsmessage.Resource{msg.Answers, msg.Additionals} {
+			for i := range section {
+				section[i].Header.Class = dnsmessage.ClassINET
+				section[i].Header.TTL = min(section[i].Header.TTL, 10)
+			}
+		}
+	}
+	out, err := msg.Pack()
+	if err != nil {
+		return nil, false
+	}
+	return out, unicast
+}
+
+// answer returns the records answering q and the additional records that
+// save the client a round trip.
+func (r *Responder) answer(q dnsmessage.Question) (answers, extras []dnsmessage.Resource) {
+	all := q.Type == dnsmessage.TypeALL
+	switch {
+	case sameName(q.Name, r.host):
+		if all || q.Type == dnsmessage.TypeA || q.Type == dnsmessage.TypeAAAA {
+			for _, rec := range r.addressRecords(hostTTL) {
+				if all || rec.Header.Type == q.Type {
+					answers = append(answers, rec)
+				}
+			}
+		}
+	case sameName(q.Name, r.service):
+		if all || q.Type == dnsmessage.TypePTR {
+			answers = append(answers, r.pointerRecord(serviceTTL))
+			extras = append(extras, r.serviceRecord(hostTTL), r.textRecord(serviceTTL))
+			extras = append(extras, r.addressRecords(hostTTL)...)
+		}
+	case sameName(q.Name, r.instance):
+		if all || q.Type == dnsmessage.TypeSRV {
+			answers = append(answers, r.serviceRecord(hostTTL))
+		}
+		if all || q.Type == dnsmessage.TypeTXT {
+			answers = append(answers, r.textRecord(serviceTTL))
+		}
+		if len(answers) > 0 {
+			extras = append(extras, r.addressRecords(hostTTL)...)
+		}
+	case sameName(q.Name, servicesEnumAll):
+		if all || q.Type == dnsmessage.TypePTR {
+			answers = append(answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: servicesEnumAll, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET, TTL: serviceTTL},
+				Body:   &dnsmessage.PTRResource{PTR: r.service},
+			})
+		}
+	}
+	return answers, extras
+}
+
+// announcement lists every record unsolicited, with a zero TTL when goodbye
+// is set so clients drop them immediately.
+func (r *Responder) announcement(goodbye bool) []byte {
+	records := []dnsmessage.Resource{r.pointerRecord(serviceTTL), r.serviceRecord(hostTTL), r.textRecord(serviceTTL)}
+	records = append(records, r.addressRecords(hostTTL)...)
+	if goodbye {
+		for i := range records {
+			records[i].Header.TTL = 0
+		}
+	}
+	msg := dnsmessage.Message{
+		Header:  dnsmessage.Header{Response: true, Authoritative: true},
+		Answers: records,
+	}
+	out, err := msg.Pack()
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+func (r *Responder) pointerRecord(ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: r.service, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.PTRResource{PTR: r.instance},
+	}
+}
+
+func (r *Responder) serviceRecord(ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: r.instance, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET | cacheFlush, TTL: ttl},
+		Body:   &dnsmessage.SRVResource{Port: uint16(r.cfg.Port), Target: r.host},
+	}
+}
+
+func (r *Responder) textRecord(ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: r.instance, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET | cacheFlush, TTL: ttl},
+		Body:   &dnsmessage.TXTResource{TXT: []string{"path=" + r.cfg.Path}},
+	}
+}
+
+func (r *Responder) addressRecords(ttl uint32) []dnsmessage.Resource {
+	var records []dnsmessage.Resource
+	for _, addr := range r.addrs() {
+		header := dnsmessage.ResourceHeader{Name: r.host, Class: dnsmessage.ClassINET | cacheFlush, TTL: ttl}
+		if addr.Is4() {
+			header.Type = dnsmessage.TypeA
+			records = append(records, dnsmessage.Resource{Header: header, Body: &dnsmessage.AResource{A: addr.As4()}})
+			continue
+		}
+		header.Type = dnsmessage.TypeAAAA
+		records = append(records, dnsmessage.Resource{Header: header, Body: &dnsmessage.AAAAResource{AAAA: addr.As16()}})
+	}
+	return records
+}
+
+// interfaceAddrs returns the unicast addresses of the running, multicast
+// capable interfaces, skipping loopback and link-local IPv6 addresses that
+// would need a zone to be usable.
+func interfaceAddrs() []netip.Addr {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var out []netip.Addr
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			prefix, err := netip.ParsePrefix(a.String())
+			if err != nil {
+				continue
+			}
+			addr := prefix.Addr()
+			if addr.IsLoopback() || (addr.Is6() && addr.IsLinkLocalUnicast()) {
+				continue
+			}
+			out = append(out, addr)
+		}
+	}
+	return out
+}
+
+func dedupe(extras, answers []dnsmessage.Resource) []dnsmessage.Resource {
+	seen := make(map[string]bool, len(answers))
+	key := func(rec dnsmessage.Resource) string {
+		return strings.ToLower(rec.Header.Name.String()) + "|" + rec.Header.Type.String() + "|" + rec.Body.GoString()
+	}
+	for _, rec := range answers {
+		seen[key(rec)] = true
+	}
+	var out []dnsmessage.Resource
+	for _, rec := range extras {
+		if k := key(rec); !seen[k] {
+			seen[k] = true
+			out = append(out, rec)
+		}
+	}
+	return out
+}
+
+func sameName(a, b dnsmessage.Name) bool {
+	return strings.EqualFold(a.String(), b.String())
+}
+
+func mustName(name string) dnsmessage.Name {
+	n, err := dnsmessage.NewName(name)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
@@ -0,0 +1,231 @@
+package mdns
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		cfg Config
+	}
+	type want struct {
+		host      string
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "defaults", params: params{cfg: Config{Port: 8080}}, want: want{host: "pellets.local"}},
+		{name: "custom hostname", params: params{cfg: Config{Hostname: "granules", Port: 80}}, want: want{host: "granules.local"}},
+		{name: "rejects dotted hostname", params: params{cfg: Config{Hostname: "pellets.home", Port: 80}}, want: want{expectErr: true}},
+		{name: "rejects missing port", params: params{cfg: Config{}}, want: want{expectErr: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			responder, err := New(tc.params.cfg)
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.host, responder.Host(), tc.name)
+		})
+	}
+}
+
+func TestResponder_respond(t *testing.T) {
+	t.Parallel()
+
+	responder, err := New(Config{Port: 8080})
+	require.NoError(t, err)
+	responder.addrs = func() []netip.Addr {
+		return []netip.Addr{netip.MustParseAddr("192.168.1.20")}
+	}
+
+	type params struct {
+		id       uint16
+		name     string
+		qtype    dnsmessage.Type
+		qu       bool
+		response bool
+		legacy   bool
+	}
+	type want struct {
+		answered  bool
+		unicast   bool
+		id        uint16
+		questions int
+		answers   []dnsmessage.Type
+		extras    []dnsmessage.Type
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "answers host address",
+			params: params{name: "pellets.local.", qtype: dnsmessage.TypeA},
+			want:   want{answered: true, answers: []dnsmessage.Type{dnsmessage.TypeA}},
+		},
+		{
+			name:   "matches host case insensitively",
+			params: params{name: "Pellets.LOCAL.", qtype: dnsmessage.TypeA},
+			want:   want{answered: true, answers: []dnsmessage.Type{dnsmessage.TypeA}},
+		},
+		{
+			name:   "no ipv6 address to publish",
+			params: params{name: "pellets.local.", qtype: dnsmessage.TypeAAAA},
+		},
+		{
+			name:   "browses the service",
+			params: params{name: "_http._tcp.local.", qtype: dnsmessage.TypePTR},
+			want: want{
+				answered: true,
+				answers:  []dnsmessage.Type{dnsmessage.TypePTR},
+				extras:   []dnsmessage.Type{dnsmessage.TypeSRV, dnsmessage.TypeTXT, dnsmessage.TypeA},
+			},
+		},
+		{
+			name:   "resolves the instance",
+			params: params{name: "Pellets Tracker._http._tcp.local.", qtype: dnsmessage.TypeALL},
+			want: want{
+				answered: true,
+				answers:  []dnsmessage.Type{dnsmessage.TypeSRV, dnsmessage.TypeTXT},
+				extras:   []dnsmessage.Type{dnsmessage.TypeA},
+			},
+		},
+		{
+			name:   "enumerates service types",
+			params: params{name: "_services._dns-sd._udp.local.", qtype: dnsmessage.TypePTR},
+			want:   want{answered: true, answers: []dnsmessage.Type{dnsmessage.TypePTR}},
+		},
+		{
+			name:   "honours unicast response bit",
+			params: params{name: "pellets.local.", qtype: dnsmessage.TypeA, qu: true},
+			want:   want{answered: true, unicast: true, answers: []dnsmessage.Type{dnsmessage.TypeA}},
+		},
+		{
+			name:   "echoes legacy queries",
+			params: params{id: 42, name: "pellets.local.", qtype: dnsmessage.TypeA, legacy: true},
+			want:   want{answered: true, unicast: true, id: 42, questions: 1, answers: []dnsmessage.Type{dnsmessage.TypeA}},
+		},
+		{
+			name:   "ignores other names",
+			params: params{name: "printer.local.", qtype: dnsmessage.TypeA},
+		},
+		{
+			name:   "ignores responses",
+			params: params{name: "pellets.local.", qtype: dnsmessage.TypeA, response: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			class := dnsmessage.ClassINET
+			if tc.params.qu {
+				class |= unicastResponse
+			}
+			query := dnsmessage.Message{
+				Header: dnsmessage.Header{ID: tc.params.id, Response: tc.params.response},
+				Questions: []dnsmessage.Question{{
+					Name:  dnsmessage.MustNewName(tc.params.name),
+					Type:  tc.params.qtype,
+					Class: class,
+				}},
+			}
+			packet, err := query.Pack()
+			require.NoError(t, err, tc.name)
+
+			resp, unicast := responder.respond(packet, tc.params.legacy)
+			if !tc.want.answered {
+				assert.Nil(t, resp, tc.name)
+				return
+			}
+			require.NotNil(t, resp, tc.name)
+			assert.Equal(t, tc.want.unicast, unicast, tc.name)
+
+			var msg dnsmessage.Message
+			require.NoError(t, msg.Unpack(resp), tc.name)
+			assert.True(t, msg.Header.Response, tc.name)
+			assert.True(t, msg.Header.Authoritative, tc.name)
+			assert.Equal(t, tc.want.id, msg.Header.ID, tc.name)
+			assert.Len(t, msg.Questions, tc.want.questions, tc.name)
+			assert.Equal(t, tc.want.answers, recordTypes(msg.Answers), tc.name)
+			assert.Equal(t, tc.want.extras, recordTypes(msg.Additionals), tc.name)
+			for _, rec := range msg.Answers {
+				if srv, ok := rec.Body.(*dnsmessage.SRVResource); ok {
+					assert.Equal(t, uint16(8080), srv.Port, tc.name)
+					assert.Equal(t, "pellets.local.", srv.Target.String(), tc.name)
+				}
+				if a, ok := rec.Body.(*dnsmessage.AResource); ok {
+					assert.Equal(t, [4]byte{192, 168, 1, 20}, a.A, tc.name)
+				}
+			}
+		})
+	}
+}
+
+func TestResponder_announcement(t *testing.T) {
+	t.Parallel()
+
+	responder, err := New(Config{Port: 8080})
+	require.NoError(t, err)
+	responder.addrs = func() []netip.Addr {
+		return []netip.Addr{netip.MustParseAddr("192.168.1.20")}
+	}
+
+	type params struct {
+		goodbye bool
+	}
+	type want struct {
+		ttl uint32
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "announce", want: want{ttl: hostTTL}},
+		{name: "goodbye", params: params{goodbye: true}, want: want{ttl: 0}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var msg dnsmessage.Message
+			require.NoError(t, msg.Unpack(responder.announcement(tc.params.goodbye)), tc.name)
+			assert.Equal(t, []dnsmessage.Type{dnsmessage.TypePTR, dnsmessage.TypeSRV, dnsmessage.TypeTXT, dnsmessage.TypeA}, recordTypes(msg.Answers), tc.name)
+			assert.Equal(t, tc.want.ttl, msg.Answers[1].Header.TTL, tc.name)
+		})
+	}
+}
+
+func recordTypes(records []dnsmessage.Resource) []dnsmessage.Type {
+	var types []dnsmessage.Type
+	for _, rec := range records {
+		types = append(types, rec.Header.Type)
+	}
+	return types
+}
@@ -0,0 +1,297 @@
+// Package notify posts the domain events to webhooks so home automation
+// systems can react to new entries and to a stock running low.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/core/events"
+)
+
+// Event types posted to the webhooks, named after the domain events.
+const (
+	EventPurchaseCreated    = events.NamePurchaseCreated
+	EventConsumptionCreated = events.NameConsumptionCreated
+	EventLowInventory       = events.NameLowStock
+	EventConsumptionAnomaly = events.NameConsumptionAnomaly
+	EventSaveFailed         = events.NameSaveFailed
+	EventBackupCompleted    = events.NameBackupCompleted
+	// EventDigest batches the events held back in digest mode.
+	EventDigest = "digest"
+)
+
+// Digest modes of Config.Digest.
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+const (
+	defaultMaxAttempts    = 5
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = time.Minute
+	// queueSize bounds the events waiting for delivery; a burst larger than
+	// this, such as a big CSV import, drops the overflow.
+	queueSize = 256
+	// maxDigestEvents bounds the events held for the next digest.
+	maxDigestEvents = 1000
+)
+
+// Event is the JSON body posted to the webhooks. Only the field matching
+// Type is set.
+type Event struct {
+	Type        string            `json:"type"`
+	At          time.Time         `json:"at"`
+	Purchase    *core.Purchase    `json:"purchase,omitempty"`
+	Consumption *core.Consumption `json:"consumption,omitempty"`
+	// Alert is the stock that fell below its minimum, the whole stock when
+	// it has no brand.
+	Alert   *core.StockAlert `json:"alert,omitempty"`
+	Anomaly *core.ModelMonth `json:"anomaly,omitempty"`
+	Error   string           `json:"error,omitempty"`
+	Backup  *Backup          `json:"backup,omitempty"`
+	// Events are the events of a digest, oldest first.
+	Events []Event `json:"events,omitempty"`
+}
+
+// Backup is the snapshot pushed by a remote backup.
+type Backup struct {
+	Target string `json:"target"`
+	File   string `json:"file"`
+	Bytes  int    `json:"bytes"`
+}
+
+// critical reports whether event is delivered at once in digest mode: the
+// datastore failing to save, and a stock that is exhausted.
+func (e Event) critical() bool {
+	switch e.Type {
+	case EventSaveFailed:
+		return true
+	case EventLowInventory:
+		return e.Alert != nil && e.Alert.Bags <= 0
+	default:
+		return false
+	}
+}
+
+// Config describes the webhooks and how deliveries are retried.
+type Config struct {
+	// URLs receive every event.
+	URLs []string
+	// MaxAttempts is the number of tries per URL and event, 5 by default.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, doubled after each
+	// failure up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Client         *http.Client
+	// Digest holds back the events that are not critical and posts them as
+	// a single EventDigest, every day or every Monday at DigestHour (local
+	// time). Empty posts every event at once.
+	Digest     string
+	DigestHour int
+}
+
+// Notifier posts the domain events it is handed to the webhooks, in the
+// background and in order.
+type Notifier struct {
+	cfg   Config
+	queue chan Event
+	now   func() time.Time
+
+	mu      sync.Mutex
+	pending []Event
+}
+
+// New validates cfg and builds a Notifier. Events are only delivered once
+// Run is started.
+func New(cfg Config) (*Notifier, error) {
+	if len(cfg.URLs) == 0 {
+		return nil, errors.New("no webhook url")
+	}
+	for _, raw := range cfg.URLs {
+		parsed, err := url.Parse(raw)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid webhook url %q", raw)
+		}
+	}
+	switch cfg.Digest {
+	case "", DigestDaily, DigestWeekly:
+	default:
+		return nil, fmt.Errorf("invalid digest mode %q", cfg.Digest)
+	}
+	if cfg.DigestHour < 0 || cfg.DigestHour > 23 {
+		return nil, fmt.Errorf("invalid digest hour %d", cfg.DigestHour)
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = defaultInitialBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultMaxBackoff
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Notifier{cfg: cfg, queue: make(chan Event, queueSize), now: time.Now}, nil
+}
+
+// Handle queues the webhook event of a domain event. It is meant to be
+// subscribed to an events.Bus.
+func (n *Notifier) Handle(event events.Event) {
+	webhook := Event{Type: event.Name(), At: event.OccurredAt()}
+	switch event := event.(type) {
+	case events.PurchaseCreated:
+		webhook.Purchase = &event.Purchase
+	case events.ConsumptionCreated:
+		webhook.Consumption = &event.Consumption
+	case events.LowStock:
+		webhook.Alert = &event.Alert
+	case events.ConsumptionAnomaly:
+		webhook.Anomaly = &event.Month
+	case events.SaveFailed:
+		webhook.Error = event.Err
+	case events.BackupCompleted:
+		webhook.Backup = &Backup{Target: event.Target, File: event.File, Bytes: event.Bytes}
+	default:
+		return
+	}
+	n.enqueue(webhook)
+}
+
+// enqueue queues event for delivery, or holds it for the next digest when it
+// is not critical.
+func (n *Notifier) enqueue(event Event) {
+	if n.cfg.Digest != "" && !event.critical() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		if len(n.pending) >= maxDigestEvents {
+			log.Printf("notify: digest full, dropping %s event", event.Type)
+			return
+		}
+		n.pending = append(n.pending, event)
+		return
+	}
+	select {
+	case n.queue <- event:
+	default:
+		log.Printf("notify: queue full, dropping %s event", event.Type)
+	}
+}
+
+// flushDigest queues the events held back as a single digest, if any.
+func (n *Notifier) flushDigest() {
+	n.mu.Lock()
+	events := n.pending
+	n.pending = nil
+	n.mu.Unlock()
+	if len(events) == 0 {
+		return
+	}
+	select {
+	case n.queue <- Event{Type: EventDigest, At: n.now().UTC(), Events: events}:
+	default:
+		log.Printf("notify: queue full, dropping a digest of %d events", len(events))
+	}
+}
+
+// nextDigest returns the time of the digest following now.
+func (n *Notifier) nextDigest(now time.Time) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), n.cfg.DigestHour, 0, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	if n.cfg.Digest == DigestWeekly {
+		next = next.AddDate(0, 0, (int(time.Monday)-int(next.Weekday())+7)%7)
+	}
+	return next
+}
+
+// Run delivers the queued events until ctx is cancelled, and the digests
+// when enabled. The events held back are lost when ctx is cancelled before
+// the next digest.
+func (n *Notifier) Run(ctx context.Context) {
+	var timer *time.Timer
+	var digest <-chan time.Time
+	if n.cfg.Digest != "" {
+		now := n.now()
+		timer = time.NewTimer(n.nextDigest(now).Sub(now))
+		defer timer.Stop()
+		digest = timer.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-digest:
+			n.flushDigest()
+			now := n.now()
+			timer.Reset(n.nextDigest(now).Sub(now))
+		case event := <-n.queue:
+			for _, target := range n.cfg.URLs {
+				if err := n.deliver(ctx, target, event); err != nil && ctx.Err() == nil {
+					log.Printf("notify: %s event to %s: %v", event.Type, target, err)
+				}
+			}
+		}
+	}
+}
+
+// deliver posts event to target, retrying with an exponential backoff on
+// network errors, 429 and 5xx responses.
+func (n *Notifier) deliver(ctx context.Context, target string, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	backoff := n.cfg.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		retry, err := n.post(ctx, target, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= n.cfg.MaxAttempts {
+			return fmt.Errorf("attempt %d: %w", attempt, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, n.cfg.MaxBackoff)
+	}
+}
+
+// post sends body once and reports whether a failure is worth retrying.
+func (n *Notifier) post(ctx context.Context, target string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.cfg.Client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("webhook: %s", resp.Status)
+	default:
+		return false, fmt.Errorf("webhook: %s", resp.Status)
+	}
+}
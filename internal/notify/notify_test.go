@@ -0,0 +1,301 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/core/events"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		urls []string
+	}
+	type want struct {
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "accepts http and https urls", params: params{urls: []string{"http://ha.local:8123/api/webhook/pellets", "https://example.com/hook"}}},
+		{name: "requires a url", want: want{expectErr: true}},
+		{name: "rejects other schemes", params: params{urls: []string{"ftp://example.com"}}, want: want{expectErr: true}},
+		{name: "rejects urls without host", params: params{urls: []string{"http:///hook"}}, want: want{expectErr: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := New(Config{URLs: tc.params.urls})
+
+			assert.Equal(t, tc.want.expectErr, err != nil, tc.name)
+		})
+	}
+}
+
+func TestNotifier_Run(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		statuses []int
+	}
+	type want struct {
+		attempts int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "delivers at once", params: params{statuses: []int{http.StatusNoContent}}, want: want{attempts: 1}},
+		{name: "retries server errors", params: params{statuses: []int{http.StatusBadGateway, http.StatusTooManyRequests, http.StatusOK}}, want: want{attempts: 3}},
+		{name: "gives up after the last attempt", params: params{statuses: []int{http.StatusInternalServerError}}, want: want{attempts: 3}},
+		{name: "does not retry client errors", params: params{statuses: []int{http.StatusNotFound}}, want: want{attempts: 1}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var mu sync.Mutex
+			var received []Event
+			done := make(chan struct{})
+			webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var event Event
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&event), tc.name)
+				mu.Lock()
+				defer mu.Unlock()
+				received = append(received, event)
+				status := tc.params.statuses[min(len(received), len(tc.params.statuses))-1]
+				if len(received) == tc.want.attempts {
+					close(done)
+				}
+				w.WriteHeader(status)
+			}))
+			defer webhook.Close()
+
+			notifier, err := New(Config{URLs: []string{webhook.URL}, MaxAttempts: 3, InitialBackoff: time.Millisecond})
+			require.NoError(t, err, tc.name)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go notifier.Run(ctx)
+
+			notifier.enqueue(Event{Type: EventConsumptionCreated, Consumption: &core.Consumption{Meta: core.Meta{ID: "c1"}, Bags: 1}})
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				require.FailNow(t, "webhook not called", tc.name)
+			}
+			// Leave time for an unexpected extra attempt to show up.
+			time.Sleep(20 * time.Millisecond)
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Len(t, received, tc.want.attempts, tc.name)
+			assert.Equal(t, EventConsumptionCreated, received[0].Type, tc.name)
+		})
+	}
+}
+
+func TestNotifier_enqueue(t *testing.T) {
+	t.Parallel()
+
+	consumption := Event{Type: EventConsumptionCreated, Consumption: &core.Consumption{Meta: core.Meta{ID: "c1"}, Bags: 1}}
+	low := Event{Type: EventLowInventory, Alert: &core.StockAlert{Bags: 2, MinBags: 5}}
+	exhausted := Event{Type: EventLowInventory, Alert: &core.StockAlert{Bags: 0, MinBags: 5}}
+	saveFailed := Event{Type: EventSaveFailed, Error: "disk full"}
+
+	type params struct {
+		digest string
+		events []Event
+	}
+	type want struct {
+		immediate []Event
+		digest    []Event
+	}
+
+	at := time.Date(2024, time.November, 10, 8, 0, 0, 0, time.UTC)
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "posts every event without digest",
+			params: params{events: []Event{consumption, low}},
+			want:   want{immediate: []Event{consumption, low}},
+		},
+		{
+			name:   "holds back the events that are not critical",
+			params: params{digest: DigestDaily, events: []Event{consumption, low, exhausted, saveFailed}},
+			want: want{
+				immediate: []Event{exhausted, saveFailed},
+				digest:    []Event{{Type: EventDigest, At: at, Events: []Event{consumption, low}}},
+			},
+		},
+		{
+			name:   "skips empty digests",
+			params: params{digest: DigestWeekly, events: []Event{saveFailed}},
+			want:   want{immediate: []Event{saveFailed}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			notifier, err := New(Config{URLs: []string{"http://ha.local/hook"}, Digest: tc.params.digest})
+			require.NoError(t, err, tc.name)
+			notifier.now = func() time.Time { return at }
+
+			for _, event := range tc.params.events {
+				notifier.enqueue(event)
+			}
+			var immediate []Event
+			for len(notifier.queue) > 0 {
+				immediate = append(immediate, <-notifier.queue)
+			}
+			notifier.flushDigest()
+			var digest []Event
+			for len(notifier.queue) > 0 {
+				digest = append(digest, <-notifier.queue)
+			}
+
+			assert.Equal(t, tc.want.immediate, immediate, tc.name)
+			assert.Equal(t, tc.want.digest, digest, tc.name)
+		})
+	}
+}
+
+func TestNotifier_nextDigest(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		digest string
+		hour   int
+		now    time.Time
+	}
+	type want struct {
+		next time.Time
+	}
+
+	// 2024-11-13 is a Wednesday.
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "sends later the same day",
+			params: params{digest: DigestDaily, hour: 8, now: time.Date(2024, time.November, 13, 6, 30, 0, 0, time.UTC)},
+			want:   want{next: time.Date(2024, time.November, 13, 8, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:   "waits for the next day once the hour is past",
+			params: params{digest: DigestDaily, hour: 8, now: time.Date(2024, time.November, 13, 8, 0, 0, 0, time.UTC)},
+			want:   want{next: time.Date(2024, time.November, 14, 8, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:   "sends weekly digests on Monday",
+			params: params{digest: DigestWeekly, hour: 19, now: time.Date(2024, time.November, 13, 20, 0, 0, 0, time.UTC)},
+			want:   want{next: time.Date(2024, time.November, 18, 19, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:   "sends a weekly digest later on Monday",
+			params: params{digest: DigestWeekly, hour: 19, now: time.Date(2024, time.November, 18, 7, 0, 0, 0, time.UTC)},
+			want:   want{next: time.Date(2024, time.November, 18, 19, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			notifier, err := New(Config{URLs: []string{"http://ha.local/hook"}, Digest: tc.params.digest, DigestHour: tc.params.hour})
+			require.NoError(t, err, tc.name)
+
+			assert.Equal(t, tc.want.next, notifier.nextDigest(tc.params.now), tc.name)
+		})
+	}
+}
+
+func TestNotifier_Handle(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2024, time.November, 10, 8, 0, 0, 0, time.UTC)
+	purchase := core.Purchase{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", Bags: 10}
+	alert := core.StockAlert{Bags: 4, MinBags: 5}
+
+	type params struct {
+		event events.Event
+	}
+	type want struct {
+		event Event
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "posts new purchases",
+			params: params{event: events.PurchaseCreated{At: at, Purchase: purchase}},
+			want:   want{event: Event{Type: EventPurchaseCreated, At: at, Purchase: &purchase}},
+		},
+		{
+			name:   "posts stock alerts",
+			params: params{event: events.LowStock{At: at, Alert: alert}},
+			want:   want{event: Event{Type: EventLowInventory, At: at, Alert: &alert}},
+		},
+		{
+			name:   "posts save failures",
+			params: params{event: events.SaveFailed{At: at, Err: "write datastore: disk full"}},
+			want:   want{event: Event{Type: EventSaveFailed, At: at, Error: "write datastore: disk full"}},
+		},
+		{
+			name:   "posts remote backups",
+			params: params{event: events.BackupCompleted{At: at, Target: "/mnt/nas", File: "pellets.json-20241110T080000Z.json.gz", Bytes: 512}},
+			want: want{event: Event{Type: EventBackupCompleted, At: at, Backup: &Backup{
+				Target: "/mnt/nas",
+				File:   "pellets.json-20241110T080000Z.json.gz",
+				Bytes:  512,
+			}}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			notifier, err := New(Config{URLs: []string{"http://ha.local/hook"}})
+			require.NoError(t, err, tc.name)
+
+			notifier.Handle(tc.params.event)
+
+			require.Len(t, notifier.queue, 1, tc.name)
+			assert.Equal(t, tc.want.event, <-notifier.queue, tc.name)
+		})
+	}
+}
@@ -0,0 +1,167 @@
+// Package numparse normalizes human-entered numbers (French or English
+// notation, pasted currency amounts) before converting them to Go values.
+package numparse
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"pellets-tracker/internal/core"
+)
+
+// Errors returned when an input cannot be interpreted as a number.
+var (
+	ErrEmpty   = errors.New("empty number")
+	ErrInvalid = errors.New("invalid number")
+)
+
+// currencyTokens lists the currency markers stripped from the start or the
+// end of amounts. Longer tokens come first so "euros" is not left as a stray
+// "s".
+var currencyTokens = []string{"euros", "euro", "EUR", "Eur", "eur", "€"}
+
+// Normalize converts a human-entered number into the canonical form accepted
+// by strconv: no grouping separators, a dot as decimal separator and no
+// currency markers. Ordinary, no-break (U+00A0), narrow no-break (U+202F) and
+// thin (U+2009) spaces as well as apostrophes are treated as thousands
+// separators. When both a dot and a comma are present the right-most one is
+// the decimal separator; a single separator repeated several times is a
+// thousands separator. A euro sign between digits, as in "12€50", is the
+// decimal separator; any other currency marker inside the number is invalid,
+// as are the underscores strconv would otherwise accept between digits.
+func Normalize(value string) (string, error) {
+	v := trimCurrency(strings.TrimSpace(value))
+	if before, after, found := strings.Cut(v, "€"); found && !strings.ContainsAny(v, ".,") && endsWithDigit(before) && startsWithDigit(after) {
+		v = before + "," + after
+	}
+	for _, token := range currencyTokens {
+		if strings.Contains(v, token) {
+			return "", fmt.Errorf("%w: %q", ErrInvalid, value)
+		}
+	}
+	if strings.Contains(v, "_") {
+		return "", fmt.Errorf("%w: %q", ErrInvalid, value)
+	}
+
+	var builder strings.Builder
+	for _, r := range v {
+		switch {
+		case unicode.IsSpace(r), r == '\'', r == '\u2019':
+			continue
+		case r == '\u2212':
+			builder.WriteRune('-')
+		default:
+			builder.WriteRune(r)
+		}
+	}
+	v = builder.String()
+	if v == "" {
+		return "", ErrEmpty
+	}
+
+	lastDot := strings.LastIndex(v, ".")
+	lastComma := strings.LastIndex(v, ",")
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		if lastComma > lastDot {
+			v = strings.ReplaceAll(v, ".", "")
+			v = strings.Replace(v, ",", ".", 1)
+		} else {
+			v = strings.ReplaceAll(v, ",", "")
+		}
+	case lastComma >= 0:
+		if strings.Count(v, ",") > 1 {
+			v = strings.ReplaceAll(v, ",", "")
+		} else {
+			v = strings.Replace(v, ",", ".", 1)
+		}
+	case lastDot >= 0:
+		if strings.Count(v, ".") > 1 {
+			v = strings.ReplaceAll(v, ".", "")
+		}
+	}
+
+	if strings.Count(v, ".") > 1 || strings.Count(v, ",") > 0 {
+		return "", fmt.Errorf("%w: %q", ErrInvalid, value)
+	}
+	return v, nil
+}
+
+// trimCurrency strips a currency marker from the start and from the end of
+// v, with the spaces around it.
+func trimCurrency(v string) string {
+	for _, token := range currencyTokens {
+		if strings.HasPrefix(v, token) {
+			v = strings.TrimSpace(strings.TrimPrefix(v, token))
+			break
+		}
+	}
+	for _, token := range currencyTokens {
+		if strings.HasSuffix(v, token) {
+			v = strings.TrimSpace(strings.TrimSuffix(v, token))
+			break
+		}
+	}
+	return v
+}
+
+func endsWithDigit(v string) bool {
+	v = strings.TrimRightFunc(v, unicode.IsSpace)
+	return v != "" && unicode.IsDigit(rune(v[len(v)-1]))
+}
+
+func startsWithDigit(v string) bool {
+	v = strings.TrimLeftFunc(v, unicode.IsSpace)
+	return v != "" && unicode.IsDigit(rune(v[0]))
+}
+
+// Float parses a human-entered decimal number. Infinities and NaN, which
+// strconv accepts spelled out, are invalid: no quantity or amount can hold
+// them and the datastore could not be encoded with one.
+func Float(value string) (float64, error) {
+	normalized, err := Normalize(value)
+	if err != nil {
+		return 0, err
+	}
+	parsed, err := strconv.ParseFloat(normalized, 64)
+	if err != nil || math.IsInf(parsed, 0) || math.IsNaN(parsed) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalid, value)
+	}
+	return parsed, nil
+}
+
+// Int parses a human-entered whole number, accepting grouping separators.
+func Int(value string) (int, error) {
+	normalized, err := Normalize(value)
+	if err != nil {
+		return 0, err
+	}
+	if strings.Contains(normalized, ".") {
+		// "12,0" is a legitimate way to type twelve; anything with a
+		// non-zero fractional part is not.
+		parsed, err := strconv.ParseFloat(normalized, 64)
+		if err != nil || parsed != float64(int(parsed)) {
+			return 0, fmt.Errorf("%w: %q", ErrInvalid, value)
+		}
+		return int(parsed), nil
+	}
+	parsed, err := strconv.Atoi(normalized)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalid, value)
+	}
+	return parsed, nil
+}
+
+// Money parses a human-entered euro amount, with or without currency symbol,
+// into cents using bankers rounding.
+func Money(value string) (core.Money, error) {
+	amount, err := Float(value)
+	if err != nil {
+		return 0, err
+	}
+	return core.ParseMoney(amount), nil
+}
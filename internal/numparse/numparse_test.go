@@ -0,0 +1,196 @@
+package numparse_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/numparse"
+)
+
+func TestNormalize(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		value string
+	}
+	type want struct {
+		normalized string
+		err        error
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "plain integer", params: params{value: "42"}, want: want{normalized: "42"}},
+		{name: "dot decimal", params: params{value: "5.49"}, want: want{normalized: "5.49"}},
+		{name: "comma decimal", params: params{value: "5,49"}, want: want{normalized: "5.49"}},
+		{name: "surrounding whitespace", params: params{value: "  5,49\t"}, want: want{normalized: "5.49"}},
+		{name: "space thousands with comma decimal", params: params{value: "1 234,56"}, want: want{normalized: "1234.56"}},
+		{name: "no-break space thousands", params: params{value: "1\u00a0234,56"}, want: want{normalized: "1234.56"}},
+		{name: "narrow no-break space thousands", params: params{value: "1\u202f234,56"}, want: want{normalized: "1234.56"}},
+		{name: "thin space thousands", params: params{value: "1\u2009234,56"}, want: want{normalized: "1234.56"}},
+		{name: "apostrophe thousands", params: params{value: "1'234.56"}, want: want{normalized: "1234.56"}},
+		{name: "dot thousands with comma decimal", params: params{value: "1.234,56"}, want: want{normalized: "1234.56"}},
+		{name: "comma thousands with dot decimal", params: params{value: "1,234.56"}, want: want{normalized: "1234.56"}},
+		{name: "repeated dot thousands", params: params{value: "1.234.567"}, want: want{normalized: "1234567"}},
+		{name: "repeated comma thousands", params: params{value: "1,234,567"}, want: want{normalized: "1234567"}},
+		{name: "euro symbol suffix", params: params{value: "5,49 €"}, want: want{normalized: "5.49"}},
+		{name: "euro symbol prefix", params: params{value: "€5.49"}, want: want{normalized: "5.49"}},
+		{name: "EUR code", params: params{value: "EUR 1 234,56"}, want: want{normalized: "1234.56"}},
+		{name: "euros word", params: params{value: "12 euros"}, want: want{normalized: "12"}},
+		{name: "euro symbol as decimal separator", params: params{value: "12€50"}, want: want{normalized: "12.50"}},
+		{name: "euro symbol as decimal separator with thousands", params: params{value: "1 234 € 56"}, want: want{normalized: "1234.56"}},
+		{name: "euro symbol prefix with space", params: params{value: "€ 12,50"}, want: want{normalized: "12.50"}},
+		{name: "negative amount with euro suffix", params: params{value: "-12,50€"}, want: want{normalized: "-12.50"}},
+		{name: "unicode minus", params: params{value: "\u22122,50"}, want: want{normalized: "-2.50"}},
+		{name: "empty", params: params{value: "   "}, want: want{err: numparse.ErrEmpty}},
+		{name: "only currency", params: params{value: "€"}, want: want{err: numparse.ErrEmpty}},
+		{name: "mixed separators out of order", params: params{value: "1.2,3,4"}, want: want{err: numparse.ErrInvalid}},
+		{name: "euro symbol after a decimal separator", params: params{value: "1,2€50"}, want: want{err: numparse.ErrInvalid}},
+		{name: "currency word inside the number", params: params{value: "12 euros 50"}, want: want{err: numparse.ErrInvalid}},
+		{name: "underscore digit separator", params: params{value: "1_000"}, want: want{err: numparse.ErrInvalid}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			normalized, err := numparse.Normalize(tc.params.value)
+			if tc.want.err != nil {
+				assert.ErrorIs(t, err, tc.want.err, tc.name)
+				return
+			}
+			assert.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.normalized, normalized, tc.name)
+		})
+	}
+}
+
+func TestFloat(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		value string
+	}
+	type want struct {
+		value float64
+		err   error
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "comma decimal", params: params{value: "14,5"}, want: want{value: 14.5}},
+		{name: "dot decimal", params: params{value: "14.5"}, want: want{value: 14.5}},
+		{name: "grouped thousands", params: params{value: "1 234,56"}, want: want{value: 1234.56}},
+		{name: "negative", params: params{value: "-0,5"}, want: want{value: -0.5}},
+		{name: "letters", params: params{value: "abc"}, want: want{err: numparse.ErrInvalid}},
+		{name: "infinity", params: params{value: "inf"}, want: want{err: numparse.ErrInvalid}},
+		{name: "spelled out infinity", params: params{value: "-Infinity"}, want: want{err: numparse.ErrInvalid}},
+		{name: "not a number", params: params{value: "NaN"}, want: want{err: numparse.ErrInvalid}},
+		{name: "overflow", params: params{value: "1e400"}, want: want{err: numparse.ErrInvalid}},
+		{name: "underscore digit separator", params: params{value: "1_000,5"}, want: want{err: numparse.ErrInvalid}},
+		{name: "empty", params: params{value: ""}, want: want{err: numparse.ErrEmpty}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			value, err := numparse.Float(tc.params.value)
+			if tc.want.err != nil {
+				assert.ErrorIs(t, err, tc.want.err, tc.name)
+				return
+			}
+			assert.NoError(t, err, tc.name)
+			assert.InDelta(t, tc.want.value, value, 1e-9, tc.name)
+		})
+	}
+}
+
+func TestInt(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		value string
+	}
+	type want struct {
+		value int
+		err   error
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "plain", params: params{value: "3"}, want: want{value: 3}},
+		{name: "grouped thousands", params: params{value: "1 200"}, want: want{value: 1200}},
+		{name: "zero fraction", params: params{value: "12,0"}, want: want{value: 12}},
+		{name: "fractional value", params: params{value: "1,5"}, want: want{err: numparse.ErrInvalid}},
+		{name: "letters", params: params{value: "deux"}, want: want{err: numparse.ErrInvalid}},
+		{name: "empty", params: params{value: " "}, want: want{err: numparse.ErrEmpty}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			value, err := numparse.Int(tc.params.value)
+			if tc.want.err != nil {
+				assert.ErrorIs(t, err, tc.want.err, tc.name)
+				return
+			}
+			assert.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.value, value, tc.name)
+		})
+	}
+}
+
+func TestMoney(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		value string
+	}
+	type want struct {
+		amount core.Money
+		err    error
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "french amount with symbol", params: params{value: "1 234,56 €"}, want: want{amount: core.Money(123456)}},
+		{name: "english amount", params: params{value: "5.49"}, want: want{amount: core.Money(549)}},
+		{name: "whole euros", params: params{value: "7"}, want: want{amount: core.Money(700)}},
+		{name: "euro symbol between euros and cents", params: params{value: "12€50"}, want: want{amount: core.Money(1250)}},
+		{name: "bankers rounding", params: params{value: "0,125"}, want: want{amount: core.Money(12)}},
+		{name: "invalid", params: params{value: "cinq euros"}, want: want{err: numparse.ErrInvalid}},
+		{name: "infinity", params: params{value: "inf €"}, want: want{err: numparse.ErrInvalid}},
+		{name: "not a number", params: params{value: "NaN"}, want: want{err: numparse.ErrInvalid}},
+		{name: "underscore digit separator", params: params{value: "1_000 €"}, want: want{err: numparse.ErrInvalid}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			amount, err := numparse.Money(tc.params.value)
+			if tc.want.err != nil {
+				assert.ErrorIs(t, err, tc.want.err, tc.name)
+				return
+			}
+			assert.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.amount, amount, tc.name)
+		})
+	}
+}
@@ -0,0 +1,327 @@
+// Package ocr reads the date, quantity and price of a pellet delivery
+// receipt from its photo, through an external OCR service or a local
+// command such as tesseract, so the purchase form can be pre-filled and
+// confirmed instead of typed.
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"pellets-tracker/internal/core"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	// maxTextBytes bounds the text accepted from the OCR engine.
+	maxTextBytes = 1 << 20
+)
+
+// ErrNoText is returned when the engine recognized nothing on the photo.
+var ErrNoText = errors.New("no text recognized")
+
+// Config selects the OCR engine: either URL or Command.
+type Config struct {
+	// URL receives the photo as the body of a POST request and answers the
+	// recognized text, as plain text or as {"text": "..."}.
+	URL string
+	// Command is run with the photo on its standard input and prints the
+	// recognized text, e.g. "tesseract stdin stdout -l fra". Arguments are
+	// split on spaces.
+	Command string
+	// Timeout bounds the recognition of one photo, 30 seconds by default.
+	Timeout time.Duration
+	Client  *http.Client
+}
+
+// Receipt holds what was read on a delivery receipt. The fields not found
+// are left empty; Text keeps the raw recognized text for review.
+type Receipt struct {
+	Text        string     `json:"text"`
+	PurchasedAt *time.Time `json:"purchased_at,omitempty"`
+	Bags        int        `json:"bags,omitempty"`
+	BagWeightKg float64    `json:"bag_weight_kg,omitempty"`
+	// WeightKg is the delivered weight of a bulk delivery.
+	WeightKg      float64    `json:"weight_kg,omitempty"`
+	UnitPrice     core.Money `json:"unit_price_cents,omitempty"`
+	PricePerTonne core.Money `json:"price_per_tonne_cents,omitempty"`
+	TotalPrice    core.Money `json:"total_price_cents,omitempty"`
+}
+
+// Bulk reports whether the receipt reads as a bulk delivery, a weight
+// without bags.
+func (r Receipt) Bulk() bool {
+	return r.Bags == 0 && r.WeightKg > 0
+}
+
+// Reader recognizes receipts with the configured engine.
+type Reader struct {
+	cfg  Config
+	args []string
+}
+
+// New validates cfg and builds a Reader.
+func New(cfg Config) (*Reader, error) {
+	reader := &Reader{}
+	switch {
+	case cfg.URL != "" && cfg.Command != "":
+		return nil, errors.New("set either an ocr url or an ocr command, not both")
+	case cfg.URL != "":
+		parsed, err := url.Parse(cfg.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid ocr url %q", cfg.URL)
+		}
+	case cfg.Command != "":
+		reader.args = strings.Fields(cfg.Command)
+	default:
+		return nil, errors.New("no ocr url nor ocr command")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{}
+	}
+	reader.cfg = cfg
+	return reader, nil
+}
+
+// ReadReceipt recognizes the text of the photo and extracts the purchase
+// fields it mentions.
+func (r *Reader) ReadReceipt(ctx context.Context, image []byte) (Receipt, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.Timeout)
+	defer cancel()
+	var (
+		text string
+		err  error
+	)
+	if r.args != nil {
+		text, err = r.runCommand(ctx, image)
+	} else {
+		text, err = r.post(ctx, image)
+	}
+	if err != nil {
+		return Receipt{}, err
+	}
+	if strings.TrimSpace(text) == "" {
+		return Receipt{}, ErrNoText
+	}
+	return ParseReceipt(text), nil
+}
+
+func (r *Reader) runCommand(ctx context.Context, image []byte) (string, error) {
+	cmd := exec.CommandContext(ctx, r.args[0], r.args[1:]...)
+	cmd.Stdin = bytes.NewReader(image)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("ocr command: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if stdout.Len() > maxTextBytes {
+		return "", errors.New("ocr command: text too long")
+	}
+	return stdout.String(), nil
+}
+
+func (r *Reader) post(ctx context.Context, image []byte) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.cfg.URL, bytes.NewReader(image))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", http.DetectContentType(image))
+	resp, err := r.cfg.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("ocr service: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxTextBytes))
+	if err != nil {
+		return "", fmt.Errorf("ocr service: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("ocr service: %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == "application/json" {
+		var decoded struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(body, &decoded); err != nil {
+			return "", fmt.Errorf("ocr service: %w", err)
+		}
+		return decoded.Text, nil
+	}
+	return string(body), nil
+}
+
+var (
+	dateFR  = regexp.MustCompile(`\b(\d{1,2})[/.-](\d{1,2})[/.-](\d{4}|\d{2})\b`)
+	dateISO = regexp.MustCompile(`\b(\d{4})-(\d{2})-(\d{2})\b`)
+	// bagsOf matches "66 sacs de 15 kg", "66 sacs x 15 kg" or "66 x 15kg".
+	bagsOf = regexp.MustCompile(`\b(\d+)\s*(?:sacs?\s*(?:de|x)?|x)\s*(\d+(?:[.,]\d+)?)\s*kg\b`)
+	bags   = regexp.MustCompile(`\b(\d+)\s*sacs?\b`)
+	weight = regexp.MustCompile(`\b(\d{1,3}(?: \d{3})+|\d+)(?:[.,](\d+))?\s*(kg|t|tonnes?)\b`)
+	amount = regexp.MustCompile(amountPattern)
+	// perTonne and perBag match a price followed by its unit, "390,00 €/t"
+	// or "5,49 € le sac"; unitLabel a line labelled with the unit price.
+	perTonne  = regexp.MustCompile(amountPattern + `\s*(?:€|eur)?\s*(?:/\s*t\b|/\s*tonne|la tonne|par tonne|ht/t\b|ttc/t\b)`)
+	perBag    = regexp.MustCompile(amountPattern + `\s*(?:€|eur)?\s*(?:/\s*sac\b|par sac|le sac)`)
+	unitLabel = regexp.MustCompile(`(?:prix unitaire|\bp\.\s?u\.?)`)
+	total     = regexp.MustCompile(`(?:\btotal\b|net à payer|montant ttc)`)
+	totalTTC  = regexp.MustCompile(`(?:\bttc\b|net à payer)`)
+)
+
+// amountPattern matches an amount with cents, its thousands optionally
+// separated by spaces.
+const amountPattern = `\b(\d{1,3}(?: \d{3})+|\d+)[.,](\d{2})\b`
+
+// ParseReceipt extracts the purchase fields from the text of a French
+// delivery receipt: the delivery date, the bags and their weight or the
+// delivered weight, and the unit, per tonne and total prices. Prices missing
+// from the receipt are derived from the total when possible.
+func ParseReceipt(text string) Receipt {
+	receipt := Receipt{Text: text}
+	var (
+		firstDate, deliveryDate *time.Time
+		totalLine, ttcLine      core.Money
+		maxWeight               float64
+	)
+	for _, line := range strings.Split(text, "\n") {
+		line = normalizeLine(line)
+		if line == "" {
+			continue
+		}
+		if date, ok := parseDate(line); ok {
+			if firstDate == nil {
+				firstDate = &date
+			}
+			if deliveryDate == nil && strings.Contains(line, "livr") {
+				deliveryDate = &date
+			}
+		}
+		if receipt.Bags == 0 {
+			if match := bagsOf.FindStringSubmatch(line); match != nil {
+				receipt.Bags, _ = strconv.Atoi(match[1])
+				receipt.BagWeightKg, _ = strconv.ParseFloat(strings.Replace(match[2], ",", ".", 1), 64)
+			} else if match := bags.FindStringSubmatch(line); match != nil {
+				receipt.Bags, _ = strconv.Atoi(match[1])
+			}
+		}
+		for _, match := range weight.FindAllStringSubmatch(line, -1) {
+			kg := parseNumber(match[1], match[2])
+			if match[3] != "kg" {
+				kg *= 1000
+			}
+			if kg > maxWeight {
+				maxWeight = kg
+			}
+		}
+
+		// Dates such as 12.03.2024 would otherwise read as 12,03.
+		line = dateFR.ReplaceAllString(line, "")
+		if match := perTonne.FindStringSubmatch(line); match != nil {
+			receipt.PricePerTonne = parseAmount(match)
+			continue
+		}
+		if match := perBag.FindStringSubmatch(line); match != nil {
+			receipt.UnitPrice = parseAmount(match)
+			continue
+		}
+		if loc := unitLabel.FindStringIndex(line); loc != nil {
+			if match := amount.FindStringSubmatch(line[loc[1]:]); match != nil {
+				receipt.UnitPrice = parseAmount(match)
+			}
+			continue
+		}
+		matches := amount.FindAllStringSubmatch(line, -1)
+		if matches == nil {
+			continue
+		}
+		// The amounts of a total line end with the total itself.
+		price := parseAmount(matches[len(matches)-1])
+		switch {
+		case totalTTC.MatchString(line):
+			ttcLine = price
+		case total.MatchString(line):
+			totalLine = price
+		}
+	}
+
+	receipt.PurchasedAt = firstDate
+	if deliveryDate != nil {
+		receipt.PurchasedAt = deliveryDate
+	}
+	receipt.TotalPrice = totalLine
+	if ttcLine > 0 {
+		receipt.TotalPrice = ttcLine
+	}
+	if receipt.Bags > 0 {
+		if receipt.UnitPrice == 0 && receipt.TotalPrice > 0 {
+			receipt.UnitPrice = receipt.TotalPrice.DivInt(receipt.Bags)
+		}
+		return receipt
+	}
+	receipt.WeightKg = maxWeight
+	if receipt.PricePerTonne == 0 && receipt.TotalPrice > 0 && maxWeight > 0 {
+		receipt.PricePerTonne = core.ParseMoney(float64(receipt.TotalPrice) / 100 * 1000 / maxWeight)
+	}
+	return receipt
+}
+
+// normalizeLine lowercases line and turns the no-break spaces OCR engines
+// and receipts use as thousands separators into plain spaces.
+func normalizeLine(line string) string {
+	line = strings.NewReplacer(" ", " ", " ", " ", "\t", " ").Replace(line)
+	return strings.ToLower(strings.TrimSpace(line))
+}
+
+func parseDate(line string) (time.Time, bool) {
+	if match := dateISO.FindStringSubmatch(line); match != nil {
+		date, err := time.Parse("2006-01-02", match[0])
+		return date, err == nil
+	}
+	match := dateFR.FindStringSubmatch(line)
+	if match == nil {
+		return time.Time{}, false
+	}
+	day, _ := strconv.Atoi(match[1])
+	month, _ := strconv.Atoi(match[2])
+	year, _ := strconv.Atoi(match[3])
+	if year < 100 {
+		year += 2000
+	}
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	// time.Date normalizes out of range values, 31/02 becoming March 2.
+	if date.Day() != day || int(date.Month()) != month {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// parseAmount converts an amount matched by amountPattern.
+func parseAmount(match []string) core.Money {
+	return core.ParseMoney(parseNumber(match[1], match[2]))
+}
+
+// parseNumber joins the integer part of a number, with its thousands
+// separated by spaces, and its decimals.
+func parseNumber(integer, fraction string) float64 {
+	number := strings.ReplaceAll(integer, " ", "")
+	if fraction != "" {
+		number += "." + fraction
+	}
+	value, _ := strconv.ParseFloat(number, 64)
+	return value
+}
@@ -0,0 +1,200 @@
+package ocr
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		cfg Config
+	}
+	type want struct {
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "accepts a service", params: params{cfg: Config{URL: "https://ocr.example.com/read"}}},
+		{name: "accepts a command", params: params{cfg: Config{Command: "tesseract stdin stdout -l fra"}}},
+		{name: "requires an engine", params: params{cfg: Config{}}, want: want{expectErr: true}},
+		{name: "rejects both engines", params: params{cfg: Config{URL: "https://ocr.example.com/read", Command: "tesseract"}}, want: want{expectErr: true}},
+		{name: "rejects other schemes", params: params{cfg: Config{URL: "ftp://ocr.example.com/read"}}, want: want{expectErr: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := New(tc.params.cfg)
+
+			assert.Equal(t, tc.want.expectErr, err != nil, tc.name)
+		})
+	}
+}
+
+func TestParseReceipt(t *testing.T) {
+	t.Parallel()
+
+	date := func(month time.Month, day int) *time.Time {
+		d := time.Date(2024, month, day, 0, 0, 0, 0, time.UTC)
+		return &d
+	}
+
+	type params struct {
+		text string
+	}
+	type want struct {
+		receipt Receipt
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "reads a pallet of bags",
+			params: params{text: "BOIS ÉNERGIE DU SUD\nFacture n° 2024-118 du 02/09/2024\nLivré le 05/09/2024\n" +
+				"Palette 66 sacs de 15 kg   5,49 €/sac   362,34\nTotal HT 301,95\nTotal TTC 362,34 €\n"},
+			want: want{receipt: Receipt{PurchasedAt: date(time.September, 5), Bags: 66, BagWeightKg: 15, UnitPrice: 549, TotalPrice: 36234}},
+		},
+		{
+			name:   "derives the unit price from the total",
+			params: params{text: "Date : 12.10.2024\n70 sacs x 15kg\nMontant TTC 392,00 EUR\n"},
+			want:   want{receipt: Receipt{PurchasedAt: date(time.October, 12), Bags: 70, BagWeightKg: 15, UnitPrice: 560, TotalPrice: 39200}},
+		},
+		{
+			name:   "reads a bulk delivery",
+			params: params{text: "Bon de livraison 2024-03-18\nGranulés vrac : 3 000 kg\nPrix : 390,00 € / t\nTotal TTC 1 170,00 €\n"},
+			want:   want{receipt: Receipt{PurchasedAt: date(time.March, 18), WeightKg: 3000, PricePerTonne: 39000, TotalPrice: 117000}},
+		},
+		{
+			name:   "derives the price per tonne from the total",
+			params: params{text: "Livraison du 18/03/24\nQuantité 2,5 t\nTOTAL 975,00\n"},
+			want:   want{receipt: Receipt{PurchasedAt: date(time.March, 18), WeightKg: 2500, PricePerTonne: 39000, TotalPrice: 97500}},
+		},
+		{
+			name:   "leaves what it cannot read empty",
+			params: params{text: "Merci de votre visite\n31/02/2024\n"},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			receipt := ParseReceipt(tc.params.text)
+
+			tc.want.receipt.Text = tc.params.text
+			assert.Equal(t, tc.want.receipt, receipt, tc.name)
+		})
+	}
+}
+
+func TestReader_ReadReceipt(t *testing.T) {
+	t.Parallel()
+
+	const text = "Livré le 05/09/2024\n10 sacs de 15 kg\nTotal TTC 55,00\n"
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		image, _ := io.ReadAll(r.Body)
+		switch string(image) {
+		case "json":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, `{"text":"10 sacs\nTotal TTC 55,00"}`)
+		case "blank":
+			_, _ = io.WriteString(w, " \n")
+		case "broken":
+			http.Error(w, "engine down", http.StatusBadGateway)
+		default:
+			_, _ = io.WriteString(w, text)
+		}
+	}))
+	t.Cleanup(service.Close)
+
+	type params struct {
+		cfg   Config
+		image string
+	}
+	type want struct {
+		err        error
+		expectErr  bool
+		bags       int
+		totalPrice core.Money
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "reads the text answered by the service",
+			params: params{cfg: Config{URL: service.URL}, image: "photo"},
+			want:   want{bags: 10, totalPrice: 5500},
+		},
+		{
+			name:   "reads a JSON answer",
+			params: params{cfg: Config{URL: service.URL}, image: "json"},
+			want:   want{bags: 10, totalPrice: 5500},
+		},
+		{
+			name:   "reports an empty text",
+			params: params{cfg: Config{URL: service.URL}, image: "blank"},
+			want:   want{err: ErrNoText, expectErr: true},
+		},
+		{
+			name:   "reports service failures",
+			params: params{cfg: Config{URL: service.URL}, image: "broken"},
+			want:   want{expectErr: true},
+		},
+		{
+			name:   "reads the output of the command",
+			params: params{cfg: Config{Command: "cat"}, image: text},
+			want:   want{bags: 10, totalPrice: 5500},
+		},
+		{
+			name:   "reports command failures",
+			params: params{cfg: Config{Command: "false"}, image: text},
+			want:   want{expectErr: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			reader, err := New(tc.params.cfg)
+			require.NoError(t, err, tc.name)
+
+			receipt, err := reader.ReadReceipt(context.Background(), []byte(tc.params.image))
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				if tc.want.err != nil {
+					assert.ErrorIs(t, err, tc.want.err, tc.name)
+				}
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.bags, receipt.Bags, tc.name)
+			assert.Equal(t, tc.want.totalPrice, receipt.TotalPrice, tc.name)
+		})
+	}
+}
@@ -0,0 +1,139 @@
+// Package pdf writes single-page PDF documents using the standard Helvetica
+// fonts. It covers the printable reports of the application without pulling
+// a PDF library: text, lines and filled rectangles on an A4 page.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A4 page size in points.
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+// Font selects one of the built-in fonts.
+type Font int
+
+// Available fonts.
+const (
+	Regular Font = iota
+	Bold
+)
+
+func (f Font) resource() string {
+	if f == Bold {
+		return "F2"
+	}
+	return "F1"
+}
+
+// Document is a single A4 page under construction. Coordinates are in points
+// from the bottom-left corner of the page.
+type Document struct {
+	title   string
+	content bytes.Buffer
+}
+
+// New returns an empty page titled title in the document properties.
+func New(title string) *Document {
+	return &Document{title: title}
+}
+
+// Text draws text with its baseline starting at (x, y).
+func (d *Document) Text(x, y, size float64, font Font, text string) {
+	fmt.Fprintf(&d.content, "BT /%s %s Tf %s %s Td (%s) Tj ET\n", font.resource(), num(size), num(x), num(y), escape(encode(text)))
+}
+
+// Line draws a black line of the given width.
+func (d *Document) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&d.content, "%s w %s %s m %s %s l S\n", num(width), num(x1), num(y1), num(x2), num(y2))
+}
+
+// FillRect paints a rectangle in a shade of gray, 0 being black and 1 white.
+func (d *Document) FillRect(x, y, w, h, gray float64) {
+	fmt.Fprintf(&d.content, "q %s g %s %s %s %s re f Q\n", num(gray), num(x), num(y), num(w), num(h))
+}
+
+// WriteTo serializes the document.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 4 0 R /F2 5 0 R >> >> /Contents 6 0 R >>", num(PageWidth), num(PageHeight)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", d.content.Len(), d.content.String()),
+		fmt.Sprintf("<< /Title (%s) /Producer (pellets-tracker) >>", escape(encode(d.title))),
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, len(objects), xref)
+	return buf.WriteTo(w)
+}
+
+// Bytes returns the serialized document.
+func (d *Document) Bytes() []byte {
+	var buf bytes.Buffer
+	_, _ = d.WriteTo(&buf)
+	return buf.Bytes()
+}
+
+// winAnsiExtras maps the characters of the 0x80-0x9F range of WinAnsiEncoding
+// that French texts need.
+var winAnsiExtras = map[rune]byte{
+	'€':      0x80,
+	'‚':      0x82,
+	'…':      0x85,
+	'‘':      0x91,
+	'’':      0x92,
+	'“':      0x93,
+	'”':      0x94,
+	'•':      0x95,
+	'–':      0x96,
+	'—':      0x97,
+	'œ':      0x9C,
+	'Œ':      0x8C,
+	'\u202f': 0xA0, // narrow no-break space, rendered as a regular one
+}
+
+// encode converts UTF-8 text to WinAnsiEncoding, replacing unsupported
+// characters with a question mark.
+func encode(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r < 0x80 || (r >= 0xA0 && r <= 0xFF):
+			b.WriteByte(byte(r))
+		case winAnsiExtras[r] != 0:
+			b.WriteByte(winAnsiExtras[r])
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+func escape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`, "\r", `\r`, "\n", `\n`).Replace(text)
+}
+
+func num(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
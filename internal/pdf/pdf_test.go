@@ -0,0 +1,68 @@
+package pdf_test
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/pdf"
+)
+
+func TestDocument_WriteTo(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		text string
+	}
+	type want struct {
+		encoded string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "plain ascii", params: params{text: "Plan de commande"}, want: want{encoded: "(Plan de commande) Tj"}},
+		{name: "french accents and euro", params: params{text: "Délai : 5,49 €"}, want: want{encoded: "(D\xe9lai : 5,49 \x80) Tj"}},
+		{name: "escaped parentheses", params: params{text: "Stock (sacs)"}, want: want{encoded: `(Stock \(sacs\)) Tj`}},
+		{name: "unsupported characters", params: params{text: "→"}, want: want{encoded: "(?) Tj"}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			doc := pdf.New("Test")
+			doc.Text(50, 800, 12, pdf.Regular, tc.params.text)
+			doc.Line(50, 790, 545, 790, 0.5)
+			var buf bytes.Buffer
+			_, err := doc.WriteTo(&buf)
+			require.NoError(t, err, tc.name)
+			out := buf.Bytes()
+
+			assert.True(t, bytes.HasPrefix(out, []byte("%PDF-1.4\n")), tc.name)
+			assert.True(t, bytes.HasSuffix(out, []byte("%%EOF\n")), tc.name)
+			assert.Contains(t, string(out), tc.want.encoded, tc.name)
+
+			// Every cross-reference entry must point at the start of its object.
+			startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(out)
+			require.NotNil(t, startxref, tc.name)
+			xrefAt, err := strconv.Atoi(string(startxref[1]))
+			require.NoError(t, err, tc.name)
+			assert.True(t, bytes.HasPrefix(out[xrefAt:], []byte("xref\n")), tc.name)
+			entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(out[xrefAt:], -1)
+			require.Len(t, entries, 7, tc.name)
+			for i, entry := range entries {
+				offset, err := strconv.Atoi(string(entry[1]))
+				require.NoError(t, err, tc.name)
+				assert.True(t, bytes.HasPrefix(out[offset:], []byte(strconv.Itoa(i+1)+" 0 obj")), tc.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// Package retention purges the entries older than a retention policy on a
+// schedule, so the datastore stays bounded after years of use. Each purge is
+// preceded by a snapshot of the whole datastore.
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"pellets-tracker/internal/core"
+)
+
+const defaultInterval = 24 * time.Hour
+
+// Config describes what is purged and how often.
+type Config struct {
+	Policy core.RetentionPolicy
+	// Interval is the time between two purges, a day by default.
+	Interval time.Duration
+}
+
+// Store is the datastore purged, see store.JSONStore.
+type Store interface {
+	Data() core.DataStore
+	Replace(core.DataStore) error
+	// Snapshot keeps a copy of the datastore that is never rotated.
+	Snapshot(label string) (string, error)
+}
+
+// Purger removes the entries older than its policy.
+type Purger struct {
+	cfg Config
+	now func() time.Time
+}
+
+// New validates cfg and builds a Purger. Nothing is purged until Run is
+// started.
+func New(cfg Config) (*Purger, error) {
+	if !cfg.Policy.Enabled() {
+		return nil, errors.New("empty retention policy")
+	}
+	if cfg.Policy.Consumptions > 0 && cfg.Policy.Consumptions < core.MinConsumptionRetentionYears {
+		return nil, fmt.Errorf("consumptions must be kept at least %d years", core.MinConsumptionRetentionYears)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultInterval
+	}
+	return &Purger{cfg: cfg, now: time.Now}, nil
+}
+
+// Run purges store every Interval until ctx is cancelled.
+func (p *Purger) Run(ctx context.Context, store Store) {
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := p.Purge(ctx, store); err != nil && ctx.Err() == nil {
+			log.Printf("retention: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge removes the entries of store older than the policy. The datastore is
+// snapshotted first and left untouched when that fails; nothing is written
+// when there is nothing to purge.
+func (p *Purger) Purge(ctx context.Context, store Store) (core.PurgeSummary, error) {
+	ds := store.Data()
+	summary, err := core.PurgeDataStore(ctx, &ds, p.cfg.Policy, p.now())
+	if err != nil {
+		return core.PurgeSummary{}, err
+	}
+	if summary.Total() == 0 {
+		return summary, nil
+	}
+	snapshot, err := store.Snapshot("purge")
+	if err != nil {
+		return core.PurgeSummary{}, fmt.Errorf("export before purge: %w", err)
+	}
+	if err := store.Replace(ds); err != nil {
+		return core.PurgeSummary{}, fmt.Errorf("save purged datastore: %w", err)
+	}
+	removed, _ := json.Marshal(summary)
+	log.Printf(`{"type":"purge","snapshot":%q,"removed":%s}`, snapshot, removed)
+	return summary, nil
+}
@@ -0,0 +1,143 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+type stubStore struct {
+	data        core.DataStore
+	snapshotErr error
+	snapshots   []string
+	replaced    bool
+}
+
+func (s *stubStore) Data() core.DataStore { return s.data }
+
+func (s *stubStore) Replace(data core.DataStore) error {
+	s.data = data
+	s.replaced = true
+	return nil
+}
+
+func (s *stubStore) Snapshot(label string) (string, error) {
+	if s.snapshotErr != nil {
+		return "", s.snapshotErr
+	}
+	s.snapshots = append(s.snapshots, label)
+	return "data/backups/pellets.json-" + label + ".json", nil
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		cfg Config
+	}
+	type want struct {
+		interval  time.Duration
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "purges daily by default", params: params{cfg: Config{Policy: core.RetentionPolicy{Consumptions: 10}}}, want: want{interval: 24 * time.Hour}},
+		{name: "keeps the interval set", params: params{cfg: Config{Policy: core.RetentionPolicy{Audit: 1}, Interval: time.Hour}}, want: want{interval: time.Hour}},
+		{name: "compacts the seasons on their own", params: params{cfg: Config{Policy: core.RetentionPolicy{CompactSeasons: 1}}}, want: want{interval: 24 * time.Hour}},
+		{name: "rejects an empty policy", want: want{expectErr: true}},
+		{name: "keeps the consumptions of the forecast", params: params{cfg: Config{Policy: core.RetentionPolicy{Consumptions: 1}}}, want: want{expectErr: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			purger, err := New(tc.params.cfg)
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.interval, purger.cfg.Interval, tc.name)
+		})
+	}
+}
+
+func TestPurger_Purge(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, time.June, 1, 0, 0, 0, 0, time.UTC)
+	data := core.DataStore{Audit: []core.AuditEntry{
+		{ID: "a1", At: time.Date(2020, time.January, 2, 0, 0, 0, 0, time.UTC), Action: "create"},
+		{ID: "a2", At: time.Date(2026, time.January, 2, 0, 0, 0, 0, time.UTC), Action: "create"},
+	}}
+
+	type params struct {
+		policy      core.RetentionPolicy
+		snapshotErr error
+	}
+	type want struct {
+		removed   int
+		snapshots []string
+		replaced  bool
+		audit     int
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "exports then purges",
+			params: params{policy: core.RetentionPolicy{Audit: 2}},
+			want:   want{removed: 1, snapshots: []string{"purge"}, replaced: true, audit: 1},
+		},
+		{
+			name:   "writes nothing without entries to purge",
+			params: params{policy: core.RetentionPolicy{Audit: 10}},
+			want:   want{audit: 2},
+		},
+		{
+			name:   "keeps everything when the export fails",
+			params: params{policy: core.RetentionPolicy{Audit: 2}, snapshotErr: errors.New("disk full")},
+			want:   want{audit: 2, expectErr: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &stubStore{data: data, snapshotErr: tc.params.snapshotErr}
+			purger, err := New(Config{Policy: tc.params.policy})
+			require.NoError(t, err, tc.name)
+			purger.now = func() time.Time { return now }
+
+			summary, err := purger.Purge(context.Background(), store)
+
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+			} else {
+				require.NoError(t, err, tc.name)
+			}
+			assert.Equal(t, tc.want.removed, summary.Total(), tc.name)
+			assert.Equal(t, tc.want.snapshots, store.snapshots, tc.name)
+			assert.Equal(t, tc.want.replaced, store.replaced, tc.name)
+			assert.Len(t, store.data.Audit, tc.want.audit, tc.name)
+		})
+	}
+}
@@ -0,0 +1,445 @@
+// Package sheets appends the new purchases and consumptions to a remote
+// spreadsheet, a Google Sheet written with a service account or a webhook
+// receiving spreadsheet rows, so a sheet shared before the tracker existed
+// stays up to date.
+package sheets
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"pellets-tracker/internal/core"
+)
+
+// Tabs of the spreadsheet the rows are appended to.
+const (
+	SheetPurchases    = "Achats"
+	SheetConsumptions = "Consommations"
+)
+
+const (
+	defaultInterval = 15 * time.Minute
+	defaultEndpoint = "https://sheets.googleapis.com"
+	sheetsScope     = "https://www.googleapis.com/auth/spreadsheets"
+	// tokenLifetime is the longest lifetime Google grants to a service
+	// account assertion.
+	tokenLifetime = time.Hour
+)
+
+// Config describes the spreadsheet written to: either WebhookURL, or
+// SpreadsheetID with the Credentials of a service account it is shared with.
+type Config struct {
+	// WebhookURL receives {"sheet": "Achats", "rows": [[...]]} POST requests.
+	WebhookURL string
+	// SpreadsheetID is the Google Sheet written through the Sheets API,
+	// authenticated with Credentials, the JSON key of a service account.
+	SpreadsheetID string
+	Credentials   []byte
+	// Interval is the time between two exports, 15 minutes by default.
+	Interval time.Duration
+	// StateFile remembers the entries already exported across restarts.
+	StateFile string
+	Client    *http.Client
+	// Endpoint is the Sheets API, overridden in tests.
+	Endpoint string
+}
+
+// serviceAccount holds the fields of a service account key used to sign
+// the token requests.
+type serviceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+
+	key *rsa.PrivateKey
+}
+
+// state lists the IDs of the entries already exported, per tab.
+type state struct {
+	Purchases    []core.ID `json:"purchases"`
+	Consumptions []core.ID `json:"consumptions"`
+}
+
+// Exporter appends the purchases and consumptions added since its last run.
+type Exporter struct {
+	cfg     Config
+	account *serviceAccount
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+	now         func() time.Time
+}
+
+// New validates cfg and builds an Exporter. Nothing is exported until Run is
+// started.
+func New(cfg Config) (*Exporter, error) {
+	switch {
+	case cfg.WebhookURL != "" && cfg.SpreadsheetID != "":
+		return nil, errors.New("set either a webhook url or a spreadsheet id, not both")
+	case cfg.WebhookURL == "" && cfg.SpreadsheetID == "":
+		return nil, errors.New("no webhook url nor spreadsheet id")
+	case cfg.StateFile == "":
+		return nil, errors.New("no state file")
+	}
+	exporter := &Exporter{now: time.Now}
+	if cfg.WebhookURL != "" {
+		parsed, err := url.Parse(cfg.WebhookURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid webhook url %q", cfg.WebhookURL)
+		}
+	} else {
+		account, err := parseServiceAccount(cfg.Credentials)
+		if err != nil {
+			return nil, err
+		}
+		exporter.account = account
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultInterval
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = defaultEndpoint
+	}
+	exporter.cfg = cfg
+	return exporter, nil
+}
+
+func parseServiceAccount(data []byte) (*serviceAccount, error) {
+	var account serviceAccount
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("parse service account key: %w", err)
+	}
+	if account.ClientEmail == "" || account.TokenURI == "" {
+		return nil, errors.New("service account key without client_email or token_uri")
+	}
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return nil, errors.New("service account key without a PEM private_key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse service account private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("service account private key is not an RSA key")
+	}
+	account.key = key
+	return &account, nil
+}
+
+// Run exports the new entries of source every Interval until ctx is
+// cancelled. On the very first run, without a state file, the entries
+// already recorded are marked as exported rather than appended: only what is
+// added from then on reaches the spreadsheet.
+func (e *Exporter) Run(ctx context.Context, source interface{ Data() core.DataStore }) {
+	ticker := time.NewTicker(e.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if err := e.Export(ctx, source.Data()); err != nil && ctx.Err() == nil {
+			log.Printf("sheets: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Export appends the purchases and consumptions of data missing from the
+// state file, oldest first. A tab that fails is retried with the next
+// export; the other one is still written.
+func (e *Exporter) Export(ctx context.Context, data core.DataStore) error {
+	current, err := e.loadState()
+	if errors.Is(err, os.ErrNotExist) {
+		return e.saveState(state{Purchases: purchaseIDs(data.Purchases), Consumptions: consumptionIDs(data.Consumptions)})
+	}
+	if err != nil {
+		return err
+	}
+
+	brands := make(map[core.ID]string, len(data.Brands))
+	for _, brand := range data.Brands {
+		brands[brand.ID] = brand.Name
+	}
+
+	var errs []error
+	exported := make(map[core.ID]bool, len(current.Purchases))
+	for _, id := range current.Purchases {
+		exported[id] = true
+	}
+	var purchases []core.Purchase
+	for _, purchase := range data.Purchases {
+		if !exported[purchase.ID] {
+			purchases = append(purchases, purchase)
+		}
+	}
+	if len(purchases) > 0 {
+		slices.SortStableFunc(purchases, func(a, b core.Purchase) int { return a.PurchasedAt.Compare(b.PurchasedAt) })
+		rows := make([][]any, len(purchases))
+		for i, purchase := range purchases {
+			rows[i] = PurchaseRow(purchase, brands[purchase.BrandID])
+		}
+		if err := e.append(ctx, SheetPurchases, rows); err != nil {
+			errs = append(errs, fmt.Errorf("append %d purchases: %w", len(rows), err))
+		} else {
+			current.Purchases = append(current.Purchases, purchaseIDs(purchases)...)
+			if err := e.saveState(current); err != nil {
+				return err
+			}
+		}
+	}
+
+	exported = make(map[core.ID]bool, len(current.Consumptions))
+	for _, id := range current.Consumptions {
+		exported[id] = true
+	}
+	var consumptions []core.Consumption
+	for _, consumption := range data.Consumptions {
+		if !exported[consumption.ID] {
+			consumptions = append(consumptions, consumption)
+		}
+	}
+	if len(consumptions) > 0 {
+		slices.SortStableFunc(consumptions, func(a, b core.Consumption) int { return a.ConsumedAt.Compare(b.ConsumedAt) })
+		rows := make([][]any, len(consumptions))
+		for i, consumption := range consumptions {
+			rows[i] = ConsumptionRow(consumption, brands[consumption.BrandID])
+		}
+		if err := e.append(ctx, SheetConsumptions, rows); err != nil {
+			errs = append(errs, fmt.Errorf("append %d consumptions: %w", len(rows), err))
+		} else {
+			current.Consumptions = append(current.Consumptions, consumptionIDs(consumptions)...)
+			if err := e.saveState(current); err != nil {
+				return err
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PurchaseRow formats purchase as a row of the purchases tab, the amounts in
+// euros and the date as the French spreadsheets expect it.
+func PurchaseRow(purchase core.Purchase, brand string) []any {
+	return []any{
+		purchase.PurchasedAt.Format("02/01/2006"),
+		brand,
+		purchase.Bags,
+		purchase.TotalWeightKg,
+		euros(purchase.UnitPriceCents),
+		euros(purchase.TotalPriceCents),
+		purchase.Location,
+		purchase.Notes,
+		string(purchase.ID),
+	}
+}
+
+// ConsumptionRow formats consumption as a row of the consumptions tab. The
+// weight and power level are left empty when not recorded.
+func ConsumptionRow(consumption core.Consumption, brand string) []any {
+	var weight, power any = "", ""
+	if consumption.WeightKg > 0 {
+		weight = consumption.WeightKg
+	}
+	if consumption.PowerLevel > 0 {
+		power = consumption.PowerLevel
+	}
+	return []any{
+		consumption.ConsumedAt.Format("02/01/2006"),
+		brand,
+		consumption.TotalBags(),
+		weight,
+		power,
+		consumption.Notes,
+		string(consumption.ID),
+	}
+}
+
+func euros(amount core.Money) float64 {
+	return float64(amount) / 100
+}
+
+func purchaseIDs(purchases []core.Purchase) []core.ID {
+	ids := make([]core.ID, len(purchases))
+	for i, purchase := range purchases {
+		ids[i] = purchase.ID
+	}
+	return ids
+}
+
+func consumptionIDs(consumptions []core.Consumption) []core.ID {
+	ids := make([]core.ID, len(consumptions))
+	for i, consumption := range consumptions {
+		ids[i] = consumption.ID
+	}
+	return ids
+}
+
+func (e *Exporter) loadState() (state, error) {
+	data, err := os.ReadFile(e.cfg.StateFile)
+	if err != nil {
+		return state{}, err
+	}
+	var current state
+	if err := json.Unmarshal(data, &current); err != nil {
+		return state{}, fmt.Errorf("parse %s: %w", e.cfg.StateFile, err)
+	}
+	return current, nil
+}
+
+// saveState writes the state through a temporary file so a crash never
+// leaves it truncated, which would export everything again.
+func (e *Exporter) saveState(current state) error {
+	data, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	tmp := e.cfg.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write export state: %w", err)
+	}
+	if err := os.Rename(tmp, e.cfg.StateFile); err != nil {
+		return fmt.Errorf("write export state: %w", err)
+	}
+	return nil
+}
+
+// append adds rows at the end of sheet.
+func (e *Exporter) append(ctx context.Context, sheet string, rows [][]any) error {
+	if e.account == nil {
+		body, err := json.Marshal(map[string]any{"sheet": sheet, "rows": rows})
+		if err != nil {
+			return err
+		}
+		return e.post(ctx, e.cfg.WebhookURL, "", body)
+	}
+
+	token, err := e.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]any{"values": rows})
+	if err != nil {
+		return err
+	}
+	target := fmt.Sprintf("%s/v4/spreadsheets/%s/values/%s:append?valueInputOption=USER_ENTERED&insertDataOption=INSERT_ROWS",
+		strings.TrimSuffix(e.cfg.Endpoint, "/"), url.PathEscape(e.cfg.SpreadsheetID), url.PathEscape(sheet+"!A1"))
+	return e.post(ctx, target, token, body)
+}
+
+func (e *Exporter) post(ctx context.Context, target, token string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := e.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	return nil
+}
+
+// accessToken returns an OAuth token of the service account, exchanging a
+// signed assertion for a new one shortly before the previous one expires.
+func (e *Exporter) accessToken(ctx context.Context) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.now()
+	if e.token != "" && now.Add(time.Minute).Before(e.tokenExpiry) {
+		return e.token, nil
+	}
+
+	assertion, err := e.account.assertion(now)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := e.cfg.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request access token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("request access token: %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("decode access token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("decode access token: empty token")
+	}
+	e.token = token.AccessToken
+	e.tokenExpiry = now.Add(time.Duration(token.ExpiresIn) * time.Second)
+	return e.token, nil
+}
+
+// assertion signs the JWT exchanged for an access token (RFC 7523).
+func (a *serviceAccount) assertion(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iss":   a.ClientEmail,
+		"scope": sheetsScope,
+		"aud":   a.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(tokenLifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("sign token request: %w", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,252 @@
+package sheets
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+)
+
+func serviceAccountKey(t *testing.T, tokenURI string) []byte {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	credentials, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "pellets@example.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    tokenURI,
+	})
+	require.NoError(t, err)
+	return credentials
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	credentials := serviceAccountKey(t, "https://oauth2.googleapis.com/token")
+
+	type params struct {
+		cfg Config
+	}
+	type want struct {
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "accepts a webhook", params: params{cfg: Config{WebhookURL: "https://example.com/rows", StateFile: "state.json"}}},
+		{name: "accepts a spreadsheet", params: params{cfg: Config{SpreadsheetID: "sheet", Credentials: credentials, StateFile: "state.json"}}},
+		{name: "requires a target", params: params{cfg: Config{StateFile: "state.json"}}, want: want{expectErr: true}},
+		{
+			name:   "rejects both targets",
+			params: params{cfg: Config{WebhookURL: "https://example.com/rows", SpreadsheetID: "sheet", Credentials: credentials, StateFile: "state.json"}},
+			want:   want{expectErr: true},
+		},
+		{name: "requires a state file", params: params{cfg: Config{WebhookURL: "https://example.com/rows"}}, want: want{expectErr: true}},
+		{name: "rejects other schemes", params: params{cfg: Config{WebhookURL: "ftp://example.com/rows", StateFile: "state.json"}}, want: want{expectErr: true}},
+		{name: "requires credentials", params: params{cfg: Config{SpreadsheetID: "sheet", StateFile: "state.json"}}, want: want{expectErr: true}},
+		{
+			name:   "rejects a key without private key",
+			params: params{cfg: Config{SpreadsheetID: "sheet", Credentials: []byte(`{"client_email":"a@b","token_uri":"https://oauth2.googleapis.com/token"}`), StateFile: "state.json"}},
+			want:   want{expectErr: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := New(tc.params.cfg)
+
+			assert.Equal(t, tc.want.expectErr, err != nil, tc.name)
+		})
+	}
+}
+
+type webhookRequest struct {
+	Sheet string  `json:"sheet"`
+	Rows  [][]any `json:"rows"`
+}
+
+func TestExporter_Export(t *testing.T) {
+	t.Parallel()
+
+	day := func(d int) time.Time { return time.Date(2024, time.November, d, 0, 0, 0, 0, time.UTC) }
+	base := core.DataStore{
+		Brands:       []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}},
+		Purchases:    []core.Purchase{{Meta: core.Meta{ID: "p1"}, BrandID: "brand-w", PurchasedAt: day(1), Bags: 10, TotalWeightKg: 150, UnitPriceCents: 549, TotalPriceCents: 5490}},
+		Consumptions: []core.Consumption{{Meta: core.Meta{ID: "c1"}, BrandID: "brand-w", ConsumedAt: day(2), Bags: 1}},
+	}
+	added := base
+	added.Purchases = append(append([]core.Purchase(nil), base.Purchases...),
+		core.Purchase{Meta: core.Meta{ID: "p2"}, BrandID: "brand-w", PurchasedAt: day(5), Bags: 20, TotalWeightKg: 300, UnitPriceCents: 600, TotalPriceCents: 12000, Location: "Garage"})
+	added.Consumptions = append(append([]core.Consumption(nil), base.Consumptions...),
+		core.Consumption{Meta: core.Meta{ID: "c3"}, BrandID: "brand-w", ConsumedAt: day(4), Bags: 2, PowerLevel: 3, Notes: "Froid"},
+		core.Consumption{Meta: core.Meta{ID: "c2"}, BrandID: "brand-w", ConsumedAt: day(3), Bags: 1, WeightKg: 7.5})
+
+	type params struct {
+		exports []core.DataStore
+		// failing is the tab the target rejects.
+		failing string
+		// googleSheets appends to a spreadsheet through the Sheets API
+		// rather than posting to a webhook.
+		googleSheets bool
+	}
+	type want struct {
+		requests []webhookRequest
+		// tokens counts the access tokens requested to the Sheets API.
+		tokens int
+		err    bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "marks the history as exported on the first run",
+			params: params{exports: []core.DataStore{base}},
+		},
+		{
+			name:   "appends the entries added since, oldest first",
+			params: params{exports: []core.DataStore{base, added, added}},
+			want: want{requests: []webhookRequest{
+				{Sheet: SheetPurchases, Rows: [][]any{{"05/11/2024", "Woodstock", 20.0, 300.0, 6.0, 120.0, "Garage", "", "p2"}}},
+				{Sheet: SheetConsumptions, Rows: [][]any{
+					{"03/11/2024", "Woodstock", 1.0, 7.5, "", "", "c2"},
+					{"04/11/2024", "Woodstock", 2.0, "", 3.0, "Froid", "c3"},
+				}},
+			}},
+		},
+		{
+			name:   "appends to a spreadsheet, reusing the access token",
+			params: params{exports: []core.DataStore{base, added, added}, googleSheets: true},
+			want: want{
+				requests: []webhookRequest{
+					{Sheet: SheetPurchases, Rows: [][]any{{"05/11/2024", "Woodstock", 20.0, 300.0, 6.0, 120.0, "Garage", "", "p2"}}},
+					{Sheet: SheetConsumptions, Rows: [][]any{
+						{"03/11/2024", "Woodstock", 1.0, 7.5, "", "", "c2"},
+						{"04/11/2024", "Woodstock", 2.0, "", 3.0, "Froid", "c3"},
+					}},
+				},
+				tokens: 1,
+			},
+		},
+		{
+			name:   "retries a rejected tab with the next export",
+			params: params{exports: []core.DataStore{base, added}, failing: SheetPurchases},
+			want: want{
+				requests: []webhookRequest{
+					{Sheet: SheetConsumptions, Rows: [][]any{
+						{"03/11/2024", "Woodstock", 1.0, 7.5, "", "", "c2"},
+						{"04/11/2024", "Woodstock", 2.0, "", 3.0, "Froid", "c3"},
+					}},
+				},
+				err: true,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			const valuesPath = "/v4/spreadsheets/sheet-id/values/"
+			var mu sync.Mutex
+			var requests []webhookRequest
+			var tokens int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req webhookRequest
+				switch {
+				case r.URL.Path == "/token":
+					if !assert.NoError(t, r.ParseForm(), tc.name) {
+						w.WriteHeader(http.StatusBadRequest)
+						return
+					}
+					assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.PostForm.Get("grant_type"), tc.name)
+					assert.Len(t, strings.Split(r.PostForm.Get("assertion"), "."), 3, tc.name)
+					mu.Lock()
+					tokens++
+					mu.Unlock()
+					_, _ = io.WriteString(w, `{"access_token":"secret","expires_in":3600,"token_type":"Bearer"}`)
+					return
+				case strings.HasPrefix(r.URL.Path, valuesPath):
+					if r.Header.Get("Authorization") != "Bearer secret" {
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					assert.Equal(t, "USER_ENTERED", r.URL.Query().Get("valueInputOption"), tc.name)
+					var body struct {
+						Values [][]any `json:"values"`
+					}
+					if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+						w.WriteHeader(http.StatusBadRequest)
+						return
+					}
+					sheet := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, valuesPath), "!A1:append")
+					req = webhookRequest{Sheet: sheet, Rows: body.Values}
+				default:
+					if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+						w.WriteHeader(http.StatusBadRequest)
+						return
+					}
+				}
+				if req.Sheet == tc.params.failing {
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				mu.Lock()
+				requests = append(requests, req)
+				mu.Unlock()
+				_, _ = io.WriteString(w, `{}`)
+			}))
+			defer server.Close()
+
+			cfg := Config{WebhookURL: server.URL, StateFile: filepath.Join(t.TempDir(), "sheets.json")}
+			if tc.params.googleSheets {
+				cfg = Config{
+					SpreadsheetID: "sheet-id",
+					Credentials:   serviceAccountKey(t, server.URL+"/token"),
+					StateFile:     cfg.StateFile,
+					Endpoint:      server.URL,
+				}
+			}
+			exporter, err := New(cfg)
+			require.NoError(t, err, tc.name)
+
+			var lastErr error
+			for _, data := range tc.params.exports {
+				lastErr = exporter.Export(context.Background(), data)
+			}
+
+			assert.Equal(t, tc.want.err, lastErr != nil, tc.name)
+			assert.Equal(t, tc.want.requests, requests, tc.name)
+			assert.Equal(t, tc.want.tokens, tokens, tc.name)
+		})
+	}
+}
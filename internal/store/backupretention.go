@@ -0,0 +1,96 @@
+package store
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// backupTimeLayout timestamps the rotated backups, in UTC.
+const backupTimeLayout = "20060102T150405Z"
+
+// BackupRetention decides which rotated backups of the datastore are kept
+// after each save: the Last most recent ones, plus the most recent backup of
+// each of the Daily last days, Weekly last weeks and Monthly last months
+// that have one. Days, weeks and months are counted in UTC, like the names
+// of the backups. A backup kept by several tiers is kept once.
+type BackupRetention struct {
+	Last    int
+	Daily   int
+	Weekly  int
+	Monthly int
+}
+
+// DefaultBackupRetention covers a year of history in at most 26 copies.
+var DefaultBackupRetention = BackupRetention{Last: 3, Daily: 7, Weekly: 4, Monthly: 12}
+
+func (r BackupRetention) String() string {
+	return fmt.Sprintf("last %d, %d daily, %d weekly, %d monthly", r.Last, r.Daily, r.Weekly, r.Monthly)
+}
+
+// keep reports which of backups, sorted newest first, the policy keeps.
+// Backups whose name carries no timestamp are always kept.
+func (r BackupRetention) keep(backups []string) []bool {
+	kept := make([]bool, len(backups))
+	taken := make([]time.Time, len(backups))
+	recent := 0
+	for i, backup := range backups {
+		at, ok := backupTime(backup)
+		if !ok {
+			kept[i] = true
+			continue
+		}
+		taken[i] = at
+		if recent < r.Last {
+			kept[i] = true
+			recent++
+		}
+	}
+
+	tiers := []struct {
+		count  int
+		period func(time.Time) string
+	}{
+		{count: r.Daily, period: func(at time.Time) string { return at.Format("2006-01-02") }},
+		{count: r.Weekly, period: func(at time.Time) string {
+			year, week := at.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{count: r.Monthly, period: func(at time.Time) string { return at.Format("2006-01") }},
+	}
+	for _, tier := range tiers {
+		periods := 0
+		previous := ""
+		for i, at := range taken {
+			if periods == tier.count {
+				break
+			}
+			if at.IsZero() {
+				continue
+			}
+			// The backups being sorted newest first, the first one of a
+			// period is its most recent.
+			if period := tier.period(at); period != previous {
+				kept[i] = true
+				previous = period
+				periods++
+			}
+		}
+	}
+	return kept
+}
+
+// backupTime parses the timestamp in the name of a rotated backup.
+func backupTime(backup string) (time.Time, bool) {
+	name := strings.TrimSuffix(filepath.Base(backup), backupSuffix)
+	idx := strings.LastIndexByte(name, '-')
+	if idx < 0 {
+		return time.Time{}, false
+	}
+	at, err := time.Parse(backupTimeLayout, name[idx+1:])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return at, true
+}
@@ -0,0 +1,113 @@
+package store_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/store"
+)
+
+func TestBackup_retention(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		retention store.BackupRetention
+		backups   []string
+	}
+	type want struct {
+		kept []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "keeps the last copies",
+			params: params{
+				retention: store.BackupRetention{Last: 2},
+				backups:   []string{"20240110T100000Z", "20240110T090000Z", "20240110T080000Z"},
+			},
+			want: want{kept: []string{"20240110T100000Z"}},
+		},
+		{
+			name: "keeps the latest copy of each day",
+			params: params{
+				retention: store.BackupRetention{Daily: 3},
+				backups:   []string{"20240110T100000Z", "20240110T080000Z", "20240109T120000Z", "20240108T120000Z"},
+			},
+			want: want{kept: []string{"20240110T100000Z", "20240109T120000Z"}},
+		},
+		{
+			name: "keeps the latest copy of each week",
+			params: params{
+				retention: store.BackupRetention{Weekly: 3},
+				backups:   []string{"20240110T120000Z", "20240103T120000Z", "20240102T120000Z", "20231220T120000Z"},
+			},
+			want: want{kept: []string{"20240110T120000Z", "20240103T120000Z"}},
+		},
+		{
+			name: "keeps the latest copy of each month",
+			params: params{
+				retention: store.BackupRetention{Monthly: 3},
+				backups:   []string{"20240210T120000Z", "20240120T120000Z", "20240105T120000Z", "20231215T120000Z"},
+			},
+			want: want{kept: []string{"20240210T120000Z", "20240120T120000Z"}},
+		},
+		{
+			name: "combines the tiers",
+			params: params{
+				retention: store.BackupRetention{Last: 2, Daily: 2, Monthly: 3},
+				backups:   []string{"20240210T120000Z", "20240210T080000Z", "20240209T120000Z", "20240120T120000Z", "20240105T120000Z"},
+			},
+			want: want{kept: []string{"20240210T120000Z", "20240120T120000Z"}},
+		},
+		{
+			name: "keeps the copies without timestamp",
+			params: params{
+				retention: store.BackupRetention{Last: 1},
+				backups:   []string{"20240110T100000Z", "manual"},
+			},
+			want: want{kept: []string{"manual"}},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, "pellets.json")
+			require.NoError(t, os.WriteFile(path, []byte(`{"brands":[]}`), 0o600), tc.name)
+			for _, backup := range tc.params.backups {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "pellets.json-"+backup+".bak"), []byte(`{}`), 0o600), tc.name)
+			}
+
+			require.NoError(t, store.Backup(path, dir, tc.params.retention), tc.name)
+
+			matches, err := filepath.Glob(filepath.Join(dir, "pellets.json-*.bak"))
+			require.NoError(t, err, tc.name)
+			var kept []string
+			created := 0
+			for _, match := range matches {
+				name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(match), "pellets.json-"), ".bak")
+				// The copy just made is the newest and always kept.
+				if !slices.Contains(tc.params.backups, name) {
+					created++
+					continue
+				}
+				kept = append(kept, name)
+			}
+			assert.Equal(t, 1, created, tc.name)
+			assert.ElementsMatch(t, tc.want.kept, kept, tc.name)
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"pellets-tracker/internal/core"
+)
+
+// journalSuffix names the journal kept next to the datastore file.
+const journalSuffix = ".journal"
+
+// journalRecord is a line of the journal: the top-level sections of the
+// datastore changed by a Replace, with their new value. A null section was
+// removed.
+type journalRecord struct {
+	At       time.Time                  `json:"at"`
+	Sections map[string]json.RawMessage `json:"sections"`
+}
+
+// journal appends every change of the datastore to a file, synced, before
+// the datastore file is written. It is cleared once the file is safely on
+// disk, so it only ever holds the changes made since the last good snapshot:
+// replaying them recovers a save interrupted by a crash or a power loss.
+//
+// A record holds the whole value of each section it changes, so replaying
+// the journal over any snapshot taken since it was cleared gives the same
+// datastore.
+type journal struct {
+	path string
+	// sections are those of the datastore last recorded, to find the ones
+	// the next change touches.
+	sections map[string]json.RawMessage
+}
+
+func newJournal(path string, data *core.DataStore) (*journal, error) {
+	sections, err := encodeSections(data)
+	if err != nil {
+		return nil, err
+	}
+	return &journal{path: path, sections: sections}, nil
+}
+
+// append records the sections of data that differ from the datastore last
+// recorded.
+func (j *journal) append(data *core.DataStore) error {
+	sections, err := encodeSections(data)
+	if err != nil {
+		return err
+	}
+	record := journalRecord{At: time.Now().UTC(), Sections: make(map[string]json.RawMessage)}
+	for key, value := range sections {
+		if !bytes.Equal(value, j.sections[key]) {
+			record.Sections[key] = value
+		}
+	}
+	for key := range j.sections {
+		if _, ok := sections[key]; !ok {
+			record.Sections[key] = json.RawMessage("null")
+		}
+	}
+	if len(record.Sections) == 0 {
+		return nil
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("encode journal record: %w", err)
+	}
+
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, filePerms)
+	if err != nil {
+		return fmt.Errorf("open journal: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("write journal: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("sync journal: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close journal: %w", err)
+	}
+	j.sections = sections
+	return nil
+}
+
+// checkpoint clears the journal once the datastore file it was written for
+// is synced, its rename included.
+func (j *journal) checkpoint() error {
+	if err := syncDir(filepath.Dir(j.path)); err != nil {
+		return err
+	}
+	if err := os.Remove(j.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("clear journal: %w", err)
+	}
+	return nil
+}
+
+// replayJournal applies the records of the journal at path to data and
+// returns how many were applied. A record cut short by a crash is skipped.
+func replayJournal(path string, data *core.DataStore) (int, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read journal: %w", err)
+	}
+
+	var records []journalRecord
+	for _, line := range bytes.Split(raw, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var record journalRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			log.Printf("journal %s: skipping a record cut short: %v", path, err)
+			continue
+		}
+		records = append(records, record)
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	sections, err := encodeSections(data)
+	if err != nil {
+		return 0, err
+	}
+	for _, record := range records {
+		for key, value := range record.Sections {
+			if bytes.Equal(value, []byte("null")) {
+				delete(sections, key)
+				continue
+			}
+			sections[key] = value
+		}
+	}
+	encoded, err := json.Marshal(sections)
+	if err != nil {
+		return 0, fmt.Errorf("encode replayed datastore: %w", err)
+	}
+	var replayed core.DataStore
+	if err := json.Unmarshal(encoded, &replayed); err != nil {
+		return 0, fmt.Errorf("decode replayed datastore: %w", err)
+	}
+	*data = replayed
+	return len(records), nil
+}
+
+// encodeSections encodes each top-level member of the datastore apart.
+func encodeSections(data *core.DataStore) (map[string]json.RawMessage, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("encode datastore: %w", err)
+	}
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &sections); err != nil {
+		return nil, fmt.Errorf("split datastore sections: %w", err)
+	}
+	return sections, nil
+}
+
+// syncDir flushes the entries of dir, such as a file renamed into it.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open dir: %w", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("sync dir: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package store_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/store"
+)
+
+func TestJSONStore_journal(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		failSave bool
+		// journal, when set, is left next to the data file before reopening.
+		journal string
+	}
+	type want struct {
+		brands       []string
+		minStockBags int
+		journalLeft  bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "clears the journal once saved",
+			want: want{brands: []string{"Woodstock", "Piveteau"}},
+		},
+		{
+			name:   "replays the changes of a save that failed",
+			params: params{failSave: true},
+			want:   want{brands: []string{"Woodstock", "Piveteau"}, journalLeft: true},
+		},
+		{
+			name:   "skips a record cut short",
+			params: params{journal: `{"at":"2024-11-10T08:00:00Z","sections":{"min_stock_bags":7}}` + "\n" + `{"at":"2024-11-10T08:01:00Z","sect`},
+			want:   want{brands: []string{"Woodstock"}, minStockBags: 7, journalLeft: true},
+		},
+		{
+			name:   "removes the sections emptied",
+			params: params{journal: `{"at":"2024-11-10T08:00:00Z","sections":{"brands":null}}` + "\n"},
+			want:   want{journalLeft: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, "pellets.json")
+			backups := filepath.Join(dir, "backups")
+			s, err := store.NewJSONStore(path, backups, store.FormatCompact)
+			require.NoError(t, err, tc.name)
+			data := s.Data()
+			data.Brands = []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}}
+			require.NoError(t, s.Replace(data), tc.name)
+
+			if tc.params.failSave {
+				// A file in place of the backup directory makes the save
+				// fail after the change is journaled.
+				require.NoError(t, os.RemoveAll(backups), tc.name)
+				require.NoError(t, os.WriteFile(backups, nil, 0o600), tc.name)
+			}
+			if tc.params.journal == "" {
+				data.Brands = append(data.Brands, core.Brand{Meta: core.Meta{ID: "brand-p"}, Name: "Piveteau"})
+				err = s.Replace(data)
+				assert.Equal(t, tc.params.failSave, err != nil, tc.name)
+			} else {
+				require.NoError(t, os.WriteFile(path+".journal", []byte(tc.params.journal), 0o600), tc.name)
+			}
+			if tc.params.failSave {
+				require.NoError(t, os.Remove(backups), tc.name)
+			}
+
+			reopened, err := store.NewJSONStore(path, backups, store.FormatCompact)
+			require.NoError(t, err, tc.name)
+
+			var brands []string
+			for _, brand := range reopened.Data().Brands {
+				brands = append(brands, brand.Name)
+			}
+			assert.Equal(t, tc.want.brands, brands, tc.name)
+			assert.Equal(t, tc.want.minStockBags, reopened.Data().MinStockBags, tc.name)
+			_, err = os.Stat(path + ".journal")
+			assert.Equal(t, tc.want.journalLeft, err == nil, tc.name)
+
+			// The next save includes the changes recovered and clears the
+			// journal.
+			require.NoError(t, reopened.Replace(reopened.Data()), tc.name)
+			_, err = os.Stat(path + ".journal")
+			assert.True(t, os.IsNotExist(err), tc.name)
+			saved, err := store.Load(path)
+			require.NoError(t, err, tc.name)
+			assert.Len(t, saved.Brands, len(tc.want.brands), tc.name)
+		})
+	}
+}
@@ -2,74 +2,507 @@
 package store
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
+	"log"
 	"os"
 	"path/filepath"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"pellets-tracker/internal/core"
 )
 
 const (
-	backupSuffix   = ".bak"
-	maxBackupFiles = 3
-	filePerms      = 0o600
-	dirPerms       = 0o755
+	backupSuffix = ".bak"
+	filePerms    = 0o600
+	dirPerms     = 0o755
+	// loadAttempts and loadRetryDelay retry reading the datastore file for
+	// about 1.5s, the delay doubling after each failure, to ride out a
+	// network filesystem hiccup.
+	loadAttempts   = 5
+	loadRetryDelay = 100 * time.Millisecond
+)
+
+// ErrReadOnly is returned by Replace while the store serves a backup because
+// the datastore file could not be read.
+var ErrReadOnly = errors.New("datastore is read-only, a backup is served until the data file can be read again")
+
+// Format selects how the datastore file is encoded.
+type Format string
+
+const (
+	// FormatPretty indents the whole document, easiest to read by hand.
+	FormatPretty Format = "pretty"
+	// FormatCompact writes the document on a single line, roughly halving
+	// the bytes written on every save.
+	FormatCompact Format = "compact"
+	// FormatSections writes each top-level section compactly on its own
+	// line, keeping the file small while diffs stay readable per section.
+	FormatSections Format = "sections"
 )
 
 // JSONStore manages concurrent access to a JSON-backed datastore.
 type JSONStore struct {
 	path      string
 	backupDir string
+	format    Format
+	// slowSave is the save duration above which a warning is logged, zero
+	// disables the warning.
+	slowSave time.Duration
+	// retention selects the rotated backups kept after each save.
+	retention BackupRetention
+	// onReplace is called after every successful Replace.
+	onReplace func(before, after core.DataStore)
+	// onSaveError is called after every Replace that failed to save.
+	onSaveError func(err error)
+	// journal records each change before the datastore file is written.
+	journal *journal
+
+	// writeMu serializes the writers, queued while a save is in progress.
+	// The readers never take it: they load the current snapshot.
+	writeMu sync.Mutex
+	current atomic.Pointer[snapshot]
+	// queuedWrites counts the writers waiting for writeMu.
+	queuedWrites atomic.Int64
+	// repairs lists what a lenient load repaired when the store was opened.
+	repairs core.RepairReport
+
+	// statsMu guards stats apart from writeMu so reading them never waits for a
+	// save in progress.
+	statsMu sync.Mutex
+	stats   Stats
+}
 
-	mu   sync.RWMutex
+// snapshot is the state of a JSONStore seen by the readers, replaced as a
+// whole once a write is done and never modified afterwards.
+type snapshot struct {
 	data *core.DataStore
+	// fallback is the backup served read-only when the datastore file could
+	// not be read, empty otherwise.
+	fallback string
+}
+
+// Stats describes the saves of a JSONStore since it was opened. Slow saves
+// and growing durations are the first signs of a degrading SD card.
+type Stats struct {
+	Saves      int64 `json:"saves"`
+	SaveErrors int64 `json:"save_errors"`
+	SlowSaves  int64 `json:"slow_saves"`
+	// LastSaveAt is zero until the first save.
+	LastSaveAt     time.Time `json:"last_save_at"`
+	LastSaveMillis float64   `json:"last_save_ms"`
+	MaxSaveMillis  float64   `json:"max_save_ms"`
+	// FileSizeBytes is the size of the datastore file as last written.
+	FileSizeBytes  int64 `json:"file_size_bytes"`
+	BackupFiles    int   `json:"backup_files"`
+	BackupsCreated int64 `json:"backups_created"`
+	BackupsRemoved int64 `json:"backups_removed"`
+	// WriteLockWaits counts the writes that waited for another one to be
+	// saved, for WriteLockWaitMillis in all; QueuedWrites is the number of
+	// writes waiting right now.
+	WriteLockWaits         int64   `json:"write_lock_waits"`
+	WriteLockWaitMillis    float64 `json:"write_lock_wait_ms"`
+	MaxWriteLockWaitMillis float64 `json:"max_write_lock_wait_ms"`
+	QueuedWrites           int64   `json:"queued_writes"`
 }
 
 // NewJSONStore loads the datastore from disk or initializes a new one when the
-// file does not exist.
-func NewJSONStore(path, backupDir string) (*JSONStore, error) {
-	data, err := Load(path)
+// file does not exist. Every format is read back, format only applies to
+// the following saves. A file that cannot be read is retried briefly, then
+// the latest backup is served read-only, see ReadOnly. The changes left in
+// the journal by a save that did not complete are replayed on top of the
+// file, never of a backup.
+func NewJSONStore(path, backupDir string, format Format) (*JSONStore, error) {
+	return newJSONStore(path, backupDir, format, loadStrict)
+}
+
+// NewLenientJSONStore opens the datastore like NewJSONStore but reads it, and
+// the backups it falls back on, with LoadLenient. When records were
+// repaired the datastore is saved at once, the original kept as the rotated
+// backup, and the repair report is written next to the backups, see
+// Repairs.
+func NewLenientJSONStore(path, backupDir string, format Format) (*JSONStore, error) {
+	store, err := newJSONStore(path, backupDir, format, LoadLenient)
 	if err != nil {
 		return nil, err
 	}
+	if len(store.repairs.Issues) == 0 {
+		return store, nil
+	}
+	log.Printf("datastore %s: %d issues found, %d repaired", path, len(store.repairs.Issues), store.repairs.Fixed())
+	if reportPath, err := writeRepairReport(path, store.backupDir, store.repairs); err != nil {
+		log.Printf("datastore %s: %v", path, err)
+	} else {
+		log.Printf("datastore %s: repair report written to %s", path, reportPath)
+	}
+	if _, readOnly := store.ReadOnly(); store.repairs.Fixed() > 0 && !readOnly {
+		if err := store.Replace(store.Data()); err != nil {
+			return nil, fmt.Errorf("save repaired datastore: %w", err)
+		}
+	}
+	return store, nil
+}
+
+// loader reads the datastore at path, reporting what it had to repair.
+type loader func(path string) (*core.DataStore, core.RepairReport, error)
 
+// loadStrict is Load as a loader, it never repairs anything.
+func loadStrict(path string) (*core.DataStore, core.RepairReport, error) {
+	data, err := Load(path)
+	return data, core.RepairReport{}, err
+}
+
+func newJSONStore(path, backupDir string, format Format, load loader) (*JSONStore, error) {
 	if backupDir == "" {
 		backupDir = filepath.Dir(path)
 	}
 
+	data, repairs, err := loadWithRetry(path, load)
+	fallback := ""
+	if err != nil {
+		backup, backupData, backupRepairs, backupErr := loadLatestBackup(path, backupDir, load)
+		if backupErr != nil {
+			return nil, fmt.Errorf("%w (no backup to fall back on: %v)", err, backupErr)
+		}
+		log.Printf("datastore %s unreadable (%v), serving the backup %s read-only", path, err, backup)
+		data, repairs, fallback = backupData, backupRepairs, backup
+	}
+	if fallback == "" {
+		if err := recoverJournal(path, data); err != nil {
+			return nil, err
+		}
+	} else {
+		// The journal holds the changes made since the last save of the
+		// file: replayed over an older backup, it would mix sections of two
+		// snapshots. It is kept for RetryDataFile to replay over the file.
+		log.Printf("datastore %s: journal kept until the file can be read", path)
+	}
+	journal, err := newJournal(path+journalSuffix, data)
+	if err != nil {
+		return nil, err
+	}
+
 	if err := os.MkdirAll(backupDir, dirPerms); err != nil {
 		return nil, fmt.Errorf("ensure backup dir: %w", err)
 	}
 
-	return &JSONStore{path: path, backupDir: backupDir, data: data}, nil
+	store := &JSONStore{path: path, backupDir: backupDir, format: format, retention: DefaultBackupRetention, journal: journal, repairs: repairs}
+	store.current.Store(&snapshot{data: data, fallback: fallback})
+	if info, err := os.Stat(path); err == nil {
+		store.stats.FileSizeBytes = info.Size()
+	}
+	if backups, err := listBackups(path, backupDir); err == nil {
+		store.stats.BackupFiles = len(backups)
+	}
+	return store, nil
 }
 
-// Data returns a deep copy of the current datastore snapshot.
-func (s *JSONStore) Data() core.DataStore {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// SetSlowSaveThreshold logs every save lasting longer than threshold; zero
+// disables the warning. It must be called before the store is shared.
+func (s *JSONStore) SetSlowSaveThreshold(threshold time.Duration) {
+	s.slowSave = threshold
+}
+
+// SetBackupRetention replaces DefaultBackupRetention as the policy pruning
+// the rotated backups after each save. It must be called before the store is
+// shared.
+func (s *JSONStore) SetBackupRetention(retention BackupRetention) {
+	s.retention = retention
+}
+
+// SetOnReplace registers fn to be called, outside of the store lock, after
+// every successful Replace with the previous and the new datastore. Both share
+// their slices with the store and must not be modified. It must be called
+// before the store is shared.
+func (s *JSONStore) SetOnReplace(fn func(before, after core.DataStore)) {
+	s.onReplace = fn
+}
+
+// SetOnSaveError registers fn to be called, outside of the store lock, with
+// the error of every Replace that could not save the datastore or back it up.
+// It must be called before the store is shared.
+func (s *JSONStore) SetOnSaveError(fn func(err error)) {
+	s.onSaveError = fn
+}
+
+// ReadOnly returns the backup served when the datastore file could not be
+// read at startup. Replace fails with ErrReadOnly meanwhile, so the file is
+// never overwritten with older data.
+func (s *JSONStore) ReadOnly() (string, bool) {
+	fallback := s.current.Load().fallback
+	return fallback, fallback != ""
+}
+
+// RetryDataFile reads the datastore file again every interval while a backup
+// is served, switching back to it and to read-write mode once it can be
+// read. It returns then, or when ctx is cancelled.
+func (s *JSONStore) RetryDataFile(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, readOnly := s.ReadOnly(); !readOnly {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// A file gone missing must not be replaced by an empty datastore.
+		if _, err := os.Stat(s.path); err != nil {
+			continue
+		}
+		data, err := Load(s.path)
+		if err != nil {
+			continue
+		}
+		if err := recoverJournal(s.path, data); err != nil {
+			log.Printf("datastore %s readable again but %v", s.path, err)
+			continue
+		}
+		journal, err := newJournal(s.path+journalSuffix, data)
+		if err != nil {
+			log.Printf("datastore %s readable again but %v", s.path, err)
+			continue
+		}
+		s.lockWriter()
+		s.journal = journal
+		s.current.Store(&snapshot{data: data})
+		s.writeMu.Unlock()
+		log.Printf("datastore %s readable again, leaving read-only mode", s.path)
+	}
+}
+
+// Repairs returns what NewLenientJSONStore repaired or flagged when it
+// opened the datastore; it has no issues for a store opened strictly.
+func (s *JSONStore) Repairs() core.RepairReport {
+	return s.repairs
+}
+
+// Stats returns the save statistics collected so far.
+func (s *JSONStore) Stats() Stats {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
 
-	return cloneDataStore(s.data)
+	stats := s.stats
+	stats.QueuedWrites = s.queuedWrites.Load()
+	return stats
+}
+
+// Data returns a deep copy of the current datastore snapshot. It never waits
+// for a save in progress, returning the snapshot saved before it.
+func (s *JSONStore) Data() core.DataStore {
+	return cloneDataStore(s.current.Load().data)
 }
 
 // Replace swaps the in-memory datastore with the provided snapshot and persists it.
 func (s *JSONStore) Replace(data core.DataStore) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	_, err := s.Swap(data)
+	return err
+}
 
-	cloned := cloneDataStore(&data)
-	s.data = &cloned
-	return Save(s.path, s.backupDir, s.data)
+// Swap replaces the datastore like Replace and returns the snapshot it
+// replaced, which shares its slices with the store and must not be modified.
+// Writers are saved one at a time, in turn; meanwhile the readers keep
+// seeing the previous snapshot.
+func (s *JSONStore) Swap(data core.DataStore) (core.DataStore, error) {
+	s.lockWriter()
+	current := s.current.Load()
+	if current.fallback != "" {
+		s.writeMu.Unlock()
+		return core.DataStore{}, ErrReadOnly
+	}
+	return s.swapLocked(current.data, cloneDataStore(&data))
 }
 
-// Load reads a datastore from disk. When the file does not exist a new
-// datastore is returned with initialized metadata.
+// Update applies change to a copy of the current datastore and saves it like
+// Swap, holding the writer lock from the read to the save: no other writer
+// saves in between, so what change checked, such as the revision of an
+// entry, still holds once saved. Nothing is saved when change fails, its
+// error is returned as is. It returns the snapshot replaced.
+func (s *JSONStore) Update(change func(*core.DataStore) error) (core.DataStore, error) {
+	s.lockWriter()
+	current := s.current.Load()
+	if current.fallback != "" {
+		s.writeMu.Unlock()
+		return core.DataStore{}, ErrReadOnly
+	}
+	data := cloneDataStore(current.data)
+	if err := change(&data); err != nil {
+		s.writeMu.Unlock()
+		return core.DataStore{}, err
+	}
+	return s.swapLocked(current.data, data)
+}
+
+// swapLocked saves cloned, which the store owns from then on, in place of
+// before. It is called with writeMu held and releases it.
+func (s *JSONStore) swapLocked(before *core.DataStore, cloned core.DataStore) (core.DataStore, error) {
+	// The previous snapshot is never modified once replaced, so it can be
+	// handed to onReplace as is.
+	start := time.Now()
+	// A change the journal missed is still saved, only not recoverable if
+	// the save is interrupted.
+	if err := s.journal.append(&cloned); err != nil {
+		log.Printf("journal datastore change: %v", err)
+	}
+	result, err := save(s.path, s.backupDir, &cloned, s.format, s.retention)
+	if err == nil {
+		if err := s.journal.checkpoint(); err != nil {
+			log.Printf("clear datastore journal: %v", err)
+		}
+	}
+	// Like before, a change that could not be saved is kept in memory: the
+	// next save, or the journal, persists it.
+	s.current.Store(&snapshot{data: &cloned})
+	s.recordSave(time.Since(start), result, err)
+	s.writeMu.Unlock()
+
+	if err == nil && s.onReplace != nil {
+		s.onReplace(*before, cloned)
+	}
+	if err != nil && s.onSaveError != nil {
+		s.onSaveError(err)
+	}
+	return *before, err
+}
+
+// lockWriter takes writeMu, recording how long the writer waited for the
+// ones queued before it.
+func (s *JSONStore) lockWriter() {
+	if s.writeMu.TryLock() {
+		return
+	}
+	s.queuedWrites.Add(1)
+	start := time.Now()
+	s.writeMu.Lock()
+	s.queuedWrites.Add(-1)
+
+	millis := float64(time.Since(start).Microseconds()) / 1000
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	s.stats.WriteLockWaits++
+	s.stats.WriteLockWaitMillis += millis
+	s.stats.MaxWriteLockWaitMillis = max(s.stats.MaxWriteLockWaitMillis, millis)
+}
+
+func (s *JSONStore) recordSave(elapsed time.Duration, result saveResult, err error) {
+	millis := float64(elapsed.Microseconds()) / 1000
+	slow := s.slowSave > 0 && elapsed > s.slowSave
+	if slow {
+		log.Printf("slow datastore save: %s for %d bytes (threshold %s), check the storage health", elapsed.Round(time.Millisecond), result.size, s.slowSave)
+	}
+
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	s.stats.Saves++
+	if err != nil {
+		s.stats.SaveErrors++
+	}
+	if slow {
+		s.stats.SlowSaves++
+	}
+	s.stats.LastSaveAt = time.Now().UTC()
+	s.stats.LastSaveMillis = millis
+	s.stats.MaxSaveMillis = max(s.stats.MaxSaveMillis, millis)
+	if err == nil {
+		s.stats.FileSizeBytes = int64(result.size)
+	}
+	if result.backup.created {
+		s.stats.BackupsCreated++
+		s.stats.BackupFiles = result.backup.kept
+		s.stats.BackupsRemoved += int64(result.backup.removed)
+	}
+}
+
+// Snapshot writes the current datastore to the backup directory under a name
+// carrying label and returns its path. Unlike the backups taken on every
+// save, snapshots are never rotated: they stay until removed by hand.
+func (s *JSONStore) Snapshot(label string) (string, error) {
+	encoded, err := Encode(s.current.Load().data, FormatPretty)
+	if err != nil {
+		return "", fmt.Errorf("encode snapshot: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s-%s.json", filepath.Base(s.path), label, time.Now().UTC().Format("20060102T150405.000Z"))
+	snapshotPath := filepath.Join(s.backupDir, name)
+	if err := os.WriteFile(snapshotPath, encoded, filePerms); err != nil {
+		return "", fmt.Errorf("write snapshot: %w", err)
+	}
+	return snapshotPath, nil
+}
+
+// Backup copies the datastore file to a rotated backup, like the copy taken
+// before every save, so a datastore rarely written still gets fresh backups.
+// It waits for the save in progress and fails with ErrReadOnly while a
+// backup is served.
+func (s *JSONStore) Backup() error {
+	s.lockWriter()
+	defer s.writeMu.Unlock()
+	if s.current.Load().fallback != "" {
+		return ErrReadOnly
+	}
+	result, err := backupFile(s.path, s.backupDir, s.retention)
+	if result.created {
+		s.statsMu.Lock()
+		s.stats.BackupsCreated++
+		s.stats.BackupFiles = result.kept
+		s.stats.BackupsRemoved += int64(result.removed)
+		s.statsMu.Unlock()
+	}
+	return err
+}
+
+// CheckIntegrity reads the datastore file back and checks that it is valid
+// and holds the datastore served, to catch a file damaged by the storage or
+// changed by hand since it was written. A datastore never saved has no file
+// to check.
+func (s *JSONStore) CheckIntegrity() error {
+	s.lockWriter()
+	defer s.writeMu.Unlock()
+	current := s.current.Load()
+	if current.fallback != "" {
+		return ErrReadOnly
+	}
+	if _, err := os.Stat(s.path); errors.Is(err, fs.ErrNotExist) {
+		if s.Stats().Saves == 0 {
+			return nil
+		}
+		return errors.New("datastore file missing")
+	}
+	onDisk, err := Load(s.path)
+	if err != nil {
+		return err
+	}
+	if errs := core.ValidateDataStore(onDisk); len(errs) > 0 {
+		return fmt.Errorf("invalid datastore file: %w", errs)
+	}
+	// Load stamps the time it read the file.
+	onDisk.UpdatedAt = current.data.UpdatedAt
+	read, err := Encode(onDisk, FormatCompact)
+	if err != nil {
+		return err
+	}
+	served, err := Encode(current.data, FormatCompact)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(read, served) {
+		return errors.New("datastore file differs from the datastore served")
+	}
+	return nil
+}
+
+// Load reads a datastore from disk, upgrading it to the current schema. When
+// the file does not exist a new datastore is returned with initialized
+// metadata.
 func Load(path string) (*core.DataStore, error) {
 	if err := os.MkdirAll(filepath.Dir(path), dirPerms); err != nil {
 		return nil, fmt.Errorf("ensure data dir: %w", err)
@@ -79,7 +512,7 @@ func Load(path string) (*core.DataStore, error) {
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
 			now := time.Now().UTC()
-			return &core.DataStore{Meta: core.Meta{ID: core.NewID(), CreatedAt: now, UpdatedAt: now}}, nil
+			return &core.DataStore{Meta: core.Meta{ID: core.NewID(), CreatedAt: now, UpdatedAt: now}, SchemaVersion: core.CurrentSchemaVersion}, nil
 		}
 		return nil, fmt.Errorf("open datastore: %w", err)
 	}
@@ -99,61 +532,212 @@ func Load(path string) (*core.DataStore, error) {
 	}
 	ds.UpdatedAt = time.Now().UTC()
 
+	from := ds.SchemaVersion
+	if core.MigrateDataStore(&ds) {
+		log.Printf("migrated datastore from schema %d to %d", from, ds.SchemaVersion)
+	}
+
 	return &ds, nil
 }
 
-// Save persists the datastore to disk with pretty-printed JSON, creating a
-// rotated backup beforehand.
-func Save(path, backupDir string, data *core.DataStore) error {
+// recoverJournal replays on data the journal left next to the datastore at
+// path by saves that did not complete.
+func recoverJournal(path string, data *core.DataStore) error {
+	replayed, err := replayJournal(path+journalSuffix, data)
+	if err != nil {
+		return fmt.Errorf("replay journal: %w", err)
+	}
+	if replayed > 0 {
+		log.Printf("recovered %d unsaved changes from the journal of %s", replayed, path)
+	}
+	return nil
+}
+
+// loadWithRetry loads the datastore at path with load, retrying failed reads
+// with a growing delay.
+func loadWithRetry(path string, load loader) (*core.DataStore, core.RepairReport, error) {
+	delay := loadRetryDelay
+	for attempt := 1; ; attempt++ {
+		data, repairs, err := load(path)
+		if err == nil || attempt == loadAttempts {
+			return data, repairs, err
+		}
+		log.Printf("load datastore: %v, retrying in %s", err, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// loadLatestBackup loads with load the most recent rotated backup of the
+// datastore at path that can be read, and returns its path.
+func loadLatestBackup(path, backupDir string, load loader) (string, *core.DataStore, core.RepairReport, error) {
+	backups, err := listBackups(path, backupDir)
+	if err != nil {
+		return "", nil, core.RepairReport{}, err
+	}
+	for _, backup := range backups {
+		data, repairs, err := load(backup)
+		if err != nil {
+			log.Printf("load backup %s: %v", backup, err)
+			continue
+		}
+		return backup, data, repairs, nil
+	}
+	return "", nil, core.RepairReport{}, errors.New("no readable backup")
+}
+
+// Save persists the datastore to disk in the given format, creating a rotated
+// backup beforehand, pruned with DefaultBackupRetention.
+func Save(path, backupDir string, data *core.DataStore, format Format) error {
+	_, err := save(path, backupDir, data, format, DefaultBackupRetention)
+	return err
+}
+
+// saveResult reports what a save wrote, for the store statistics.
+type saveResult struct {
+	size   int
+	backup backupResult
+}
+
+func save(path, backupDir string, data *core.DataStore, format Format, retention BackupRetention) (saveResult, error) {
+	var result saveResult
 	if data == nil {
-		return fmt.Errorf("nil datastore")
+		return result, fmt.Errorf("nil datastore")
 	}
 
 	data.UpdatedAt = time.Now().UTC()
 
-	if err := Backup(path, backupDir); err != nil {
-		return fmt.Errorf("backup datastore: %w", err)
+	backup, err := backupFile(path, backupDir, retention)
+	result.backup = backup
+	if err != nil {
+		return result, fmt.Errorf("backup datastore: %w", err)
 	}
 
 	tmpFile, err := os.CreateTemp(filepath.Dir(path), "datastore-*.tmp")
 	if err != nil {
-		return fmt.Errorf("create temp file: %w", err)
+		return result, fmt.Errorf("create temp file: %w", err)
 	}
 	tmpPath := tmpFile.Name()
 
-	encoder := json.NewEncoder(tmpFile)
-	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(data); err != nil {
+	encoded, err := Encode(data, format)
+	result.size = len(encoded)
+	if err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return result, fmt.Errorf("encode datastore: %w", err)
+	}
+	if _, err := tmpFile.Write(encoded); err != nil {
 		tmpFile.Close()
 		os.Remove(tmpPath)
-		return fmt.Errorf("encode datastore: %w", err)
+		return result, fmt.Errorf("write temp file: %w", err)
+	}
+	// Without a sync, a power loss right after the rename can leave an empty
+	// datastore file behind.
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return result, fmt.Errorf("sync temp file: %w", err)
 	}
 
 	if err := tmpFile.Close(); err != nil {
 		os.Remove(tmpPath)
-		return fmt.Errorf("close temp file: %w", err)
+		return result, fmt.Errorf("close temp file: %w", err)
 	}
 
 	if err := os.Chmod(tmpPath, filePerms); err != nil {
 		os.Remove(tmpPath)
-		return fmt.Errorf("chmod temp file: %w", err)
+		return result, fmt.Errorf("chmod temp file: %w", err)
 	}
 
 	if err := os.Rename(tmpPath, path); err != nil {
 		os.Remove(tmpPath)
-		return fmt.Errorf("rename temp file: %w", err)
+		return result, fmt.Errorf("rename temp file: %w", err)
 	}
 
-	return nil
+	return result, nil
+}
+
+// Encode serializes the datastore in the given format, terminated by a
+// newline.
+func Encode(data *core.DataStore, format Format) ([]byte, error) {
+	switch format {
+	case "", FormatPretty:
+		encoded, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(encoded, '\n'), nil
+	case FormatCompact:
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		return append(encoded, '\n'), nil
+	case FormatSections:
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		return splitSections(encoded)
+	default:
+		return nil, fmt.Errorf("unknown datastore format %q", format)
+	}
+}
+
+// splitSections rewrites a compact JSON object with one member per line,
+// preserving the member order.
+func splitSections(compact []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(compact))
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("{\n")
+	for first := true; decoder.More(); first = false {
+		key, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		if !first {
+			buf.WriteString(",\n")
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteString("\n}\n")
+	return buf.Bytes(), nil
 }
 
 // Backup creates a backup of the datastore file before writing a new version,
-// keeping only the latest maxBackupFiles copies.
-func Backup(path, backupDir string) error {
+// then removes the older copies retention does not keep.
+func Backup(path, backupDir string, retention BackupRetention) error {
+	_, err := backupFile(path, backupDir, retention)
+	return err
+}
+
+// backupResult reports the rotation done by a backup: whether a copy was
+// made, and how many copies were kept and removed.
+type backupResult struct {
+	created bool
+	kept    int
+	removed int
+}
+
+func backupFile(path, backupDir string, retention BackupRetention) (backupResult, error) {
+	var result backupResult
 	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
-		return nil
+		return result, nil
 	} else if err != nil {
-		return fmt.Errorf("stat datastore: %w", err)
+		return result, fmt.Errorf("stat datastore: %w", err)
 	}
 
 	if backupDir == "" {
@@ -161,37 +745,54 @@ func Backup(path, backupDir string) error {
 	}
 
 	if err := os.MkdirAll(backupDir, dirPerms); err != nil {
-		return fmt.Errorf("ensure backup dir: %w", err)
+		return result, fmt.Errorf("ensure backup dir: %w", err)
 	}
 
-	base := filepath.Base(path)
-	name := fmt.Sprintf("%s-%s%s", base, time.Now().UTC().Format("20060102T150405Z"), backupSuffix)
+	name := fmt.Sprintf("%s-%s%s", filepath.Base(path), time.Now().UTC().Format(backupTimeLayout), backupSuffix)
 	backupPath := filepath.Join(backupDir, name)
 
 	if err := copyFile(path, backupPath); err != nil {
-		return fmt.Errorf("copy backup: %w", err)
+		return result, fmt.Errorf("copy backup: %w", err)
 	}
 
 	if err := os.Chmod(backupPath, filePerms); err != nil {
-		return fmt.Errorf("chmod backup: %w", err)
+		return result, fmt.Errorf("chmod backup: %w", err)
 	}
+	result.created = true
 
-	pattern := fmt.Sprintf("%s-%s%s", base, "*", backupSuffix)
-	matches, err := filepath.Glob(filepath.Join(backupDir, pattern))
+	matches, err := listBackups(path, backupDir)
 	if err != nil {
-		return fmt.Errorf("glob backups: %w", err)
+		return result, err
 	}
 
-	sort.Slice(matches, func(i, j int) bool { return matches[i] > matches[j] })
-
+	kept := retention.keep(matches)
 	for idx, file := range matches {
-		if idx < maxBackupFiles {
+		if kept[idx] {
+			result.kept++
 			continue
 		}
-		_ = os.Remove(file)
+		if os.Remove(file) == nil {
+			result.removed++
+		}
 	}
 
-	return nil
+	return result, nil
+}
+
+// listBackups returns the rotated backups of the datastore at path, newest
+// first.
+func listBackups(path, backupDir string) ([]string, error) {
+	if backupDir == "" {
+		backupDir = filepath.Dir(path)
+	}
+	pattern := fmt.Sprintf("%s-%s%s", filepath.Base(path), "*", backupSuffix)
+	matches, err := filepath.Glob(filepath.Join(backupDir, pattern))
+	if err != nil {
+		return nil, fmt.Errorf("glob backups: %w", err)
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i] > matches[j] })
+	return matches, nil
 }
 
 func copyFile(src, dst string) error {
@@ -210,5 +811,19 @@ func cloneDataStore(ds *core.DataStore) core.DataStore {
 	clone.Brands = append([]core.Brand(nil), ds.Brands...)
 	clone.Purchases = append([]core.Purchase(nil), ds.Purchases...)
 	clone.Consumptions = append([]core.Consumption(nil), ds.Consumptions...)
+	clone.Transfers = append([]core.Transfer(nil), ds.Transfers...)
+	for i := range clone.Transfers {
+		clone.Transfers[i].Lots = append([]core.TransferLot(nil), ds.Transfers[i].Lots...)
+	}
+	clone.Audit = append([]core.AuditEntry(nil), ds.Audit...)
+	clone.Temperatures = append([]core.DailyTemperature(nil), ds.Temperatures...)
+	clone.Occupancy = append([]core.DailyOccupancy(nil), ds.Occupancy...)
+	clone.MarketPrices = append([]core.MarketPrice(nil), ds.MarketPrices...)
+	clone.Silos = append([]core.Silo(nil), ds.Silos...)
+	clone.SiloReadings = append([]core.SiloReading(nil), ds.SiloReadings...)
+	clone.StorageLocations = append([]core.StorageLocation(nil), ds.StorageLocations...)
+	clone.SeasonArchives = append([]core.SeasonArchive(nil), ds.SeasonArchives...)
+	clone.Users = append([]core.User(nil), ds.Users...)
+	clone.APITokens = append([]core.APIToken(nil), ds.APITokens...)
 	return clone
 }
@@ -0,0 +1,630 @@
+package store_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/store"
+)
+
+func TestSave(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC)
+	brandID := core.NewID()
+	data := core.DataStore{
+		Meta: core.Meta{ID: core.NewID(), CreatedAt: now, UpdatedAt: now},
+		Brands: []core.Brand{{
+			Meta: core.Meta{ID: brandID, CreatedAt: now, UpdatedAt: now},
+			Name: "Granules",
+		}},
+		Purchases: []core.Purchase{{
+			Meta:            core.Meta{ID: core.NewID(), CreatedAt: now, UpdatedAt: now},
+			BrandID:         brandID,
+			PurchasedAt:     now,
+			Bags:            5,
+			BagWeightKg:     15,
+			TotalWeightKg:   75,
+			UnitPriceCents:  549,
+			TotalPriceCents: 2745,
+		}},
+	}
+
+	type params struct {
+		format store.Format
+	}
+	type want struct {
+		lines    int
+		indented bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "pretty", params: params{format: store.FormatPretty}, want: want{indented: true}},
+		{name: "default is pretty", params: params{format: ""}, want: want{indented: true}},
+		{name: "compact", params: params{format: store.FormatCompact}, want: want{lines: 1}},
+		{name: "sections", params: params{format: store.FormatSections}, want: want{lines: 8}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, "pellets.json")
+			input := data
+			require.NoError(t, store.Save(path, dir, &input, tc.params.format), tc.name)
+
+			raw, err := os.ReadFile(path)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.indented, bytes.Contains(raw, []byte("\n  ")), tc.name)
+			if tc.want.lines > 0 {
+				assert.Equal(t, tc.want.lines, bytes.Count(raw, []byte("\n")), tc.name)
+			}
+
+			loaded, err := store.Load(path)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, input.Brands, loaded.Brands, tc.name)
+			assert.Equal(t, input.Purchases, loaded.Purchases, tc.name)
+		})
+	}
+}
+
+func TestJSONStore_Snapshot(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		label string
+		saves int
+	}
+	type want struct {
+		prefix string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "copies the datastore", params: params{label: "import"}, want: want{prefix: "pellets.json-import-"}},
+		{name: "survives backup rotation", params: params{label: "import", saves: 5}, want: want{prefix: "pellets.json-import-"}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			backups := filepath.Join(dir, "backups")
+			s, err := store.NewJSONStore(filepath.Join(dir, "pellets.json"), backups, store.FormatCompact)
+			require.NoError(t, err, tc.name)
+			data := s.Data()
+			data.Brands = []core.Brand{{Meta: core.Meta{ID: core.NewID()}, Name: "Granules"}}
+			require.NoError(t, s.Replace(data), tc.name)
+
+			snapshot, err := s.Snapshot(tc.params.label)
+			require.NoError(t, err, tc.name)
+			for i := 0; i < tc.params.saves; i++ {
+				require.NoError(t, s.Replace(s.Data()), tc.name)
+			}
+
+			assert.Equal(t, backups, filepath.Dir(snapshot), tc.name)
+			assert.True(t, strings.HasPrefix(filepath.Base(snapshot), tc.want.prefix), tc.name)
+			loaded, err := store.Load(snapshot)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, data.Brands, loaded.Brands, tc.name)
+		})
+	}
+}
+
+func TestJSONStore_Backup(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		saves int
+	}
+	type want struct {
+		backups int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "copies nothing before the first save"},
+		{name: "copies the datastore file", params: params{saves: 1}, want: want{backups: 1}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			backups := filepath.Join(dir, "backups")
+			s, err := store.NewJSONStore(filepath.Join(dir, "pellets.json"), backups, store.FormatCompact)
+			require.NoError(t, err, tc.name)
+			data := s.Data()
+			data.Brands = []core.Brand{{Meta: core.Meta{ID: core.NewID()}, Name: "Granules"}}
+			for i := 0; i < tc.params.saves; i++ {
+				require.NoError(t, s.Replace(data), tc.name)
+			}
+
+			require.NoError(t, s.Backup(), tc.name)
+
+			files, err := filepath.Glob(filepath.Join(backups, "pellets.json-*.bak"))
+			require.NoError(t, err, tc.name)
+			require.Len(t, files, tc.want.backups, tc.name)
+			assert.Equal(t, int64(tc.want.backups), s.Stats().BackupsCreated, tc.name)
+			if tc.want.backups > 0 {
+				loaded, err := store.Load(files[0])
+				require.NoError(t, err, tc.name)
+				assert.Equal(t, data.Brands, loaded.Brands, tc.name)
+			}
+		})
+	}
+}
+
+func TestJSONStore_CheckIntegrity(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		// change rewrites the datastore file once saved.
+		change func(t *testing.T, path string)
+	}
+	type want struct {
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "accepts the file saved"},
+		{
+			name: "rejects a truncated file",
+			params: params{change: func(t *testing.T, path string) {
+				require.NoError(t, os.WriteFile(path, []byte(`{"brands":[`), 0o600))
+			}},
+			want: want{expectErr: true},
+		},
+		{
+			name: "rejects a file changed on disk",
+			params: params{change: func(t *testing.T, path string) {
+				content, err := os.ReadFile(path)
+				require.NoError(t, err)
+				require.NoError(t, os.WriteFile(path, bytes.Replace(content, []byte("Granules"), []byte("Woodstock"), 1), 0o600))
+			}},
+			want: want{expectErr: true},
+		},
+		{
+			name: "rejects a missing file",
+			params: params{change: func(t *testing.T, path string) {
+				require.NoError(t, os.Remove(path))
+			}},
+			want: want{expectErr: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, "pellets.json")
+			s, err := store.NewJSONStore(path, filepath.Join(dir, "backups"), store.FormatPretty)
+			require.NoError(t, err, tc.name)
+			require.NoError(t, s.CheckIntegrity(), tc.name)
+			data := s.Data()
+			data.Brands = []core.Brand{{Meta: core.Meta{ID: core.NewID(), CreatedAt: time.Now().UTC()}, Name: "Granules"}}
+			require.NoError(t, s.Replace(data), tc.name)
+			if tc.params.change != nil {
+				tc.params.change(t, path)
+			}
+
+			err = s.CheckIntegrity()
+
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			assert.NoError(t, err, tc.name)
+		})
+	}
+}
+
+func TestJSONStore_Stats(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		saves     int
+		threshold time.Duration
+		// concurrent runs the saves at once, each with a reader, so the
+		// writers queue up.
+		concurrent bool
+	}
+	type want struct {
+		saves          int64
+		slowSaves      int64
+		backupsCreated int64
+		backupFiles    int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "starts empty"},
+		{name: "counts saves and backups", params: params{saves: 2}, want: want{saves: 2, backupsCreated: 1, backupFiles: 1}},
+		{name: "counts slow saves", params: params{saves: 1, threshold: time.Nanosecond}, want: want{saves: 1, slowSaves: 1}},
+		{name: "queues concurrent saves", params: params{saves: 8, concurrent: true}, want: want{saves: 8, backupsCreated: 7, backupFiles: 1}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, "pellets.json")
+			s, err := store.NewJSONStore(path, filepath.Join(dir, "backups"), store.FormatCompact)
+			require.NoError(t, err, tc.name)
+			s.SetSlowSaveThreshold(tc.params.threshold)
+			var wg sync.WaitGroup
+			for i := 0; i < tc.params.saves; i++ {
+				if !tc.params.concurrent {
+					require.NoError(t, s.Replace(s.Data()), tc.name)
+					continue
+				}
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					assert.NoError(t, s.Replace(s.Data()), tc.name)
+				}()
+				// The readers load the snapshot while the writers queue up.
+				go func() {
+					defer wg.Done()
+					_ = s.Data()
+					_, _ = s.ReadOnly()
+				}()
+			}
+			wg.Wait()
+
+			stats := s.Stats()
+			assert.Equal(t, tc.want.saves, stats.Saves, tc.name)
+			assert.LessOrEqual(t, stats.WriteLockWaits, max(tc.want.saves-1, 0), tc.name)
+			assert.GreaterOrEqual(t, stats.WriteLockWaitMillis, stats.MaxWriteLockWaitMillis, tc.name)
+			assert.Zero(t, stats.QueuedWrites, tc.name)
+			assert.Zero(t, stats.SaveErrors, tc.name)
+			assert.Equal(t, tc.want.slowSaves, stats.SlowSaves, tc.name)
+			assert.Equal(t, tc.want.backupsCreated, stats.BackupsCreated, tc.name)
+			assert.Equal(t, tc.want.backupFiles, stats.BackupFiles, tc.name)
+			if tc.want.saves > 0 {
+				info, err := os.Stat(path)
+				require.NoError(t, err, tc.name)
+				assert.Equal(t, info.Size(), stats.FileSizeBytes, tc.name)
+				assert.False(t, stats.LastSaveAt.IsZero(), tc.name)
+			}
+		})
+	}
+}
+
+func TestJSONStore_SetOnReplace(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		failSave bool
+	}
+	type want struct {
+		calls  int
+		before []string
+		after  []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "passes both datastores", want: want{calls: 1, after: []string{"Woodstock"}}},
+		{name: "skips failed saves", params: params{failSave: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, "pellets.json")
+			s, err := store.NewJSONStore(path, filepath.Join(dir, "backups"), store.FormatCompact)
+			require.NoError(t, err, tc.name)
+			if tc.params.failSave {
+				// A directory in place of the data file makes the save fail.
+				require.NoError(t, os.Mkdir(path, 0o755), tc.name)
+			}
+
+			calls := 0
+			var before, after []string
+			s.SetOnReplace(func(previous, current core.DataStore) {
+				calls++
+				for _, brand := range previous.Brands {
+					before = append(before, brand.Name)
+				}
+				for _, brand := range current.Brands {
+					after = append(after, brand.Name)
+				}
+			})
+			ds := s.Data()
+			ds.Brands = append(ds.Brands, core.Brand{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"})
+			err = s.Replace(ds)
+
+			assert.Equal(t, tc.params.failSave, err != nil, tc.name)
+			assert.Equal(t, tc.want.calls, calls, tc.name)
+			assert.Equal(t, tc.want.before, before, tc.name)
+			assert.Equal(t, tc.want.after, after, tc.name)
+		})
+	}
+}
+
+func TestJSONStore_Swap(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		// readOnly leaves an unreadable data file so the store serves its
+		// backup.
+		readOnly bool
+	}
+	type want struct {
+		before string
+		name   string
+		err    error
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "saves the datastore and returns the one replaced", want: want{before: "Woodstock", name: "Woodstock Premium"}},
+		{name: "refuses to save over a served backup", params: params{readOnly: true}, want: want{name: "Woodstock", err: store.ErrReadOnly}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, "pellets.json")
+			backupDir := filepath.Join(dir, "backups")
+			content := `{"brands":[{"id":"brand-w","name":"Woodstock"}]}`
+			if tc.params.readOnly {
+				require.NoError(t, os.MkdirAll(backupDir, 0o755), tc.name)
+				require.NoError(t, os.WriteFile(filepath.Join(backupDir, "pellets.json-20240110T000000Z.bak"), []byte(content), 0o600), tc.name)
+				content = `{"brands": [`
+			}
+			require.NoError(t, os.WriteFile(path, []byte(content), 0o600), tc.name)
+			s, err := store.NewJSONStore(path, backupDir, store.FormatCompact)
+			require.NoError(t, err, tc.name)
+
+			second := s.Data()
+			second.Brands[0].Name = "Woodstock Premium"
+			before, err := s.Swap(second)
+
+			assert.ErrorIs(t, err, tc.want.err, tc.name)
+			if tc.want.err == nil {
+				assert.Equal(t, tc.want.before, before.Brands[0].Name, tc.name)
+			}
+			assert.Equal(t, tc.want.name, s.Data().Brands[0].Name, tc.name)
+		})
+	}
+}
+
+func TestJSONStore_Update(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		err error
+	}
+	type want struct {
+		name string
+		err  error
+	}
+
+	errRejected := errors.New("rejected")
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "saves the change", want: want{name: "Woodstock Premium"}},
+		{name: "saves nothing when the change fails", params: params{err: errRejected}, want: want{name: "Woodstock", err: errRejected}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, "pellets.json")
+			s, err := store.NewJSONStore(path, filepath.Join(dir, "backups"), store.FormatCompact)
+			require.NoError(t, err, tc.name)
+			require.NoError(t, s.Replace(core.DataStore{Brands: []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}}}), tc.name)
+
+			before, err := s.Update(func(ds *core.DataStore) error {
+				ds.Brands[0].Name = "Woodstock Premium"
+				return tc.params.err
+			})
+
+			assert.ErrorIs(t, err, tc.want.err, tc.name)
+			if tc.want.err == nil {
+				assert.Equal(t, "Woodstock", before.Brands[0].Name, tc.name)
+			}
+			assert.Equal(t, tc.want.name, s.Data().Brands[0].Name, tc.name)
+			saved, err := store.Load(path)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.name, saved.Brands[0].Name, tc.name)
+		})
+	}
+}
+
+func TestJSONStore_SetOnSaveError(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		failSave bool
+	}
+	type want struct {
+		errors int
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "stays quiet on success"},
+		{name: "reports failed saves", params: params{failSave: true}, want: want{errors: 1}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, "pellets.json")
+			s, err := store.NewJSONStore(path, filepath.Join(dir, "backups"), store.FormatCompact)
+			require.NoError(t, err, tc.name)
+			if tc.params.failSave {
+				// A directory in place of the data file makes the save fail.
+				require.NoError(t, os.Mkdir(path, 0o755), tc.name)
+			}
+
+			var reported []error
+			s.SetOnSaveError(func(err error) {
+				reported = append(reported, err)
+			})
+			err = s.Replace(s.Data())
+
+			assert.Len(t, reported, tc.want.errors, tc.name)
+			if tc.want.errors > 0 {
+				assert.Equal(t, err, reported[0], tc.name)
+			}
+		})
+	}
+}
+
+func TestNewJSONStore_readOnlyFallback(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		backup bool
+		// journal, when set, is left next to the unreadable data file.
+		journal string
+		// repaired, when set, replaces the data file once the store serves
+		// the backup, before retrying it.
+		repaired string
+	}
+	type want struct {
+		err      bool
+		readOnly bool
+		brand    string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "serves the latest backup read-only", params: params{backup: true}, want: want{readOnly: true, brand: "Woodstock"}},
+		{
+			name:   "keeps the journal off the backup",
+			params: params{backup: true, journal: `{"at":"2024-11-10T08:00:00Z","sections":{"min_stock_bags":7}}` + "\n"},
+			want:   want{readOnly: true, brand: "Woodstock"},
+		},
+		{
+			name:   "switches back to the data file once readable",
+			params: params{backup: true, repaired: `{"brands":[{"id":"brand-w","name":"Woodstock Premium"}]}`},
+			want:   want{brand: "Woodstock Premium"},
+		},
+		{name: "fails without a backup", want: want{err: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, "pellets.json")
+			backupDir := filepath.Join(dir, "backups")
+			require.NoError(t, os.WriteFile(path, []byte(`{"brands": [`), 0o600), tc.name)
+			backup := filepath.Join(backupDir, "pellets.json-20240110T000000Z.bak")
+			if tc.params.backup {
+				require.NoError(t, os.MkdirAll(backupDir, 0o755), tc.name)
+				require.NoError(t, os.WriteFile(filepath.Join(backupDir, "pellets.json-20240109T000000Z.bak"), []byte(`{"brands":[]}`), 0o600), tc.name)
+				require.NoError(t, os.WriteFile(backup, []byte(`{"brands":[{"id":"brand-w","name":"Woodstock"}]}`), 0o600), tc.name)
+			}
+			if tc.params.journal != "" {
+				require.NoError(t, os.WriteFile(path+".journal", []byte(tc.params.journal), 0o600), tc.name)
+			}
+
+			s, err := store.NewJSONStore(path, backupDir, store.FormatCompact)
+
+			if tc.want.err {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			if tc.params.repaired != "" {
+				require.NoError(t, os.WriteFile(path, []byte(tc.params.repaired), 0o600), tc.name)
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				s.RetryDataFile(ctx, 10*time.Millisecond)
+			}
+			served, readOnly := s.ReadOnly()
+			assert.Equal(t, tc.want.readOnly, readOnly, tc.name)
+			assert.Equal(t, tc.want.brand, s.Data().Brands[0].Name, tc.name)
+			if !tc.want.readOnly {
+				assert.Empty(t, served, tc.name)
+				assert.NoError(t, s.Replace(s.Data()), tc.name)
+				return
+			}
+			assert.Equal(t, backup, served, tc.name)
+			assert.Zero(t, s.Data().MinStockBags, tc.name)
+			assert.ErrorIs(t, s.Replace(s.Data()), store.ErrReadOnly, tc.name)
+			content, err := os.ReadFile(path)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, `{"brands": [`, string(content), tc.name)
+			journal, err := os.ReadFile(path + ".journal")
+			if tc.params.journal == "" {
+				assert.True(t, os.IsNotExist(err), tc.name)
+			} else {
+				assert.Equal(t, tc.params.journal, string(journal), tc.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/core/events"
+)
+
+const (
+	// remoteBackupTimeout bounds one upload, the snapshots weighing a few
+	// hundred kilobytes at most.
+	remoteBackupTimeout = 2 * time.Minute
+	// remoteBackupAttempts and remoteBackupRetryDelay retry a failed upload
+	// after 1, 2 then 4 minutes, so a short network outage does not cost a
+	// whole day of backups.
+	remoteBackupAttempts   = 4
+	remoteBackupRetryDelay = time.Minute
+)
+
+// RemoteBackupConfig describes where the datastore is pushed off the
+// machine.
+type RemoteBackupConfig struct {
+	Target RemoteTarget
+	// Name prefixes the files pushed, typically the base name of the
+	// datastore file.
+	Name string
+	// Events, optional, receives an events.BackupCompleted after each push.
+	Events events.Publisher
+}
+
+// RemoteBackup pushes a compressed snapshot of the datastore to a remote
+// target, run on a schedule by the job scheduler. Unlike the rotated .bak
+// files, the copies pushed are never removed: pruning them is left to the
+// target, such as a bucket lifecycle rule.
+type RemoteBackup struct {
+	cfg RemoteBackupConfig
+	now func() time.Time
+}
+
+// NewRemoteBackup validates cfg and builds a RemoteBackup.
+func NewRemoteBackup(cfg RemoteBackupConfig) (*RemoteBackup, error) {
+	switch {
+	case cfg.Target == nil:
+		return nil, errors.New("no remote backup target")
+	case cfg.Name == "":
+		return nil, errors.New("no remote backup name")
+	}
+	return &RemoteBackup{cfg: cfg, now: time.Now}, nil
+}
+
+// Backup pushes source like Push, retrying a failed upload, and returns the
+// error of the last attempt.
+func (b *RemoteBackup) Backup(ctx context.Context, source interface{ Data() core.DataStore }) error {
+	delay := remoteBackupRetryDelay
+	for attempt := 1; ; attempt++ {
+		_, err := b.Push(ctx, source)
+		if err == nil || ctx.Err() != nil || attempt == remoteBackupAttempts {
+			return err
+		}
+		log.Printf("remote backup to %s: %v, retrying in %s", b.cfg.Target, err, delay)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// Push uploads a compressed snapshot of source to the target now and
+// returns the name of the file written.
+func (b *RemoteBackup) Push(ctx context.Context, source interface{ Data() core.DataStore }) (string, error) {
+	ds := source.Data()
+	body, err := Compress(&ds)
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%s-%s.json.gz", b.cfg.Name, b.now().UTC().Format("20060102T150405Z"))
+	ctx, cancel := context.WithTimeout(ctx, remoteBackupTimeout)
+	defer cancel()
+	if err := b.cfg.Target.Put(ctx, name, body); err != nil {
+		return "", err
+	}
+	log.Printf(`{"type":"remote_backup","target":%q,"file":%q,"bytes":%d}`, b.cfg.Target, name, len(body))
+	if b.cfg.Events != nil {
+		b.cfg.Events.Publish(events.BackupCompleted{
+			At:     b.now().UTC(),
+			Target: b.cfg.Target.String(),
+			File:   name,
+			Bytes:  len(body),
+		})
+	}
+	return name, nil
+}
+
+// Compress encodes the datastore compactly and gzips it. Once decompressed,
+// the snapshot is a datastore file that can be restored as is.
+func Compress(data *core.DataStore) ([]byte, error) {
+	encoded, err := Encode(data, FormatCompact)
+	if err != nil {
+		return nil, fmt.Errorf("encode snapshot: %w", err)
+	}
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(encoded); err != nil {
+		return nil, fmt.Errorf("compress snapshot: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("compress snapshot: %w", err)
+	}
+	return buf.Bytes(), nil
+}
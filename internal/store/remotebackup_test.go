@@ -0,0 +1,386 @@
+package store_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"pellets-tracker/internal/core"
+	"pellets-tracker/internal/core/events"
+	"pellets-tracker/internal/store"
+)
+
+type dataSource struct {
+	data core.DataStore
+}
+
+func (s dataSource) Data() core.DataStore {
+	return s.data
+}
+
+func TestRemoteBackup_Push(t *testing.T) {
+	t.Parallel()
+
+	data := core.DataStore{
+		Meta:   core.Meta{ID: "ds"},
+		Brands: []core.Brand{{Meta: core.Meta{ID: "brand-w"}, Name: "Woodstock"}},
+	}
+	expected, err := store.Encode(&data, store.FormatCompact)
+	require.NoError(t, err)
+
+	type params struct {
+		target func(t *testing.T) (store.RemoteTargetConfig, func() map[string][]byte)
+	}
+	type want struct {
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name: "copies to a directory",
+			params: params{target: func(t *testing.T) (store.RemoteTargetConfig, func() map[string][]byte) {
+				dir := filepath.Join(t.TempDir(), "nas")
+				return store.RemoteTargetConfig{URL: dir}, func() map[string][]byte { return readDir(t, dir) }
+			}},
+		},
+		{
+			name: "uploads to an s3 bucket",
+			params: params{target: func(t *testing.T) (store.RemoteTargetConfig, func() map[string][]byte) {
+				bucket := newS3Server(t, http.StatusOK)
+				return store.RemoteTargetConfig{
+					URL:         "s3://backups/pellets",
+					S3Endpoint:  bucket.server.URL,
+					S3Region:    "fr-par",
+					S3AccessKey: "access",
+					S3SecretKey: "secret",
+				}, bucket.files
+			}},
+		},
+		{
+			name: "reports the errors of the bucket",
+			params: params{target: func(t *testing.T) (store.RemoteTargetConfig, func() map[string][]byte) {
+				bucket := newS3Server(t, http.StatusForbidden)
+				return store.RemoteTargetConfig{URL: "s3://backups", S3Endpoint: bucket.server.URL, S3AccessKey: "access", S3SecretKey: "secret"}, bucket.files
+			}},
+			want: want{expectErr: true},
+		},
+		{
+			name: "uploads to an sftp server",
+			params: params{target: func(t *testing.T) (store.RemoteTargetConfig, func() map[string][]byte) {
+				server := newSFTPServer(t, "s3cret")
+				return store.RemoteTargetConfig{URL: "sftp://backup:s3cret@" + server.addr + "/srv/pellets", SSHKnownHosts: server.knownHosts}, server.files
+			}},
+		},
+		{
+			name: "fails on a wrong sftp password",
+			params: params{target: func(t *testing.T) (store.RemoteTargetConfig, func() map[string][]byte) {
+				server := newSFTPServer(t, "s3cret")
+				return store.RemoteTargetConfig{URL: "sftp://backup:guess@" + server.addr + "/srv/pellets", SSHKnownHosts: server.knownHosts}, server.files
+			}},
+			want: want{expectErr: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg, files := tc.params.target(t)
+			target, err := store.NewRemoteTarget(cfg)
+			require.NoError(t, err, tc.name)
+			bus := events.NewBus()
+			var published []events.Event
+			bus.Subscribe(func(event events.Event) { published = append(published, event) })
+			backup, err := store.NewRemoteBackup(store.RemoteBackupConfig{Target: target, Name: "pellets.json", Events: bus})
+			require.NoError(t, err, tc.name)
+
+			name, err := backup.Push(context.Background(), dataSource{data: data})
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				assert.Empty(t, files(), tc.name)
+				assert.Empty(t, published, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			require.Len(t, published, 1, tc.name)
+			completed, ok := published[0].(events.BackupCompleted)
+			require.True(t, ok, tc.name)
+			assert.Equal(t, target.String(), completed.Target, tc.name)
+			assert.Equal(t, name, completed.File, tc.name)
+			assert.Regexp(t, regexp.MustCompile(`^pellets\.json-\d{8}T\d{6}Z\.json\.gz$`), name, tc.name)
+			pushed := files()
+			require.Contains(t, pushed, name, tc.name)
+			assert.Len(t, pushed, 1, tc.name)
+			reader, err := gzip.NewReader(bytes.NewReader(pushed[name]))
+			require.NoError(t, err, tc.name)
+			decompressed, err := io.ReadAll(reader)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, string(expected), string(decompressed), tc.name)
+			assert.Equal(t, len(pushed[name]), completed.Bytes, tc.name)
+		})
+	}
+}
+
+func TestNewRemoteTarget(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		cfg store.RemoteTargetConfig
+	}
+	type want struct {
+		target    string
+		expectErr bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "reads a directory", params: params{cfg: store.RemoteTargetConfig{URL: "/mnt/nas/pellets/"}}, want: want{target: "/mnt/nas/pellets"}},
+		{name: "reads a file url", params: params{cfg: store.RemoteTargetConfig{URL: "file:///mnt/nas"}}, want: want{target: "/mnt/nas"}},
+		{
+			name:   "defaults to aws",
+			params: params{cfg: store.RemoteTargetConfig{URL: "s3://bucket/pellets/", S3AccessKey: "a", S3SecretKey: "s"}},
+			want:   want{target: "s3://bucket/pellets on s3.us-east-1.amazonaws.com"},
+		},
+		{name: "requires s3 keys", params: params{cfg: store.RemoteTargetConfig{URL: "s3://bucket"}}, want: want{expectErr: true}},
+		{name: "requires sftp credentials", params: params{cfg: store.RemoteTargetConfig{URL: "sftp://backup@nas/srv", SSHKnownHosts: "known_hosts"}}, want: want{expectErr: true}},
+		{name: "requires known hosts", params: params{cfg: store.RemoteTargetConfig{URL: "sftp://backup:pw@nas/srv"}}, want: want{expectErr: true}},
+		{name: "rejects other schemes", params: params{cfg: store.RemoteTargetConfig{URL: "ftp://nas/srv"}}, want: want{expectErr: true}},
+		{name: "requires a url", want: want{expectErr: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			target, err := store.NewRemoteTarget(tc.params.cfg)
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.target, target.String(), tc.name)
+		})
+	}
+}
+
+func readDir(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	require.NoError(t, err)
+	files := map[string][]byte{}
+	for _, entry := range entries {
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		require.NoError(t, err)
+		files[entry.Name()] = content
+	}
+	return files
+}
+
+// s3Server stores the objects put in the backups bucket when they are
+// signed.
+type s3Server struct {
+	server  *httptest.Server
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newS3Server(t *testing.T, status int) *s3Server {
+	t.Helper()
+
+	bucket := &s3Server{objects: map[string][]byte{}}
+	bucket.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signed := strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") && r.Header.Get("X-Amz-Content-Sha256") != ""
+		if r.Method != http.MethodPut || !signed || status != http.StatusOK {
+			http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+			return
+		}
+		key, ok := strings.CutPrefix(r.URL.Path, "/backups/pellets/")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		bucket.mu.Lock()
+		bucket.objects[key] = body
+		bucket.mu.Unlock()
+	}))
+	t.Cleanup(bucket.server.Close)
+	return bucket
+}
+
+func (s *s3Server) files() map[string][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.objects
+}
+
+// sftpServer accepts the uploads of the client on an SSH server checking a
+// password, keeping the files renamed into /srv/pellets.
+type sftpServer struct {
+	addr       string
+	knownHosts string
+	mu         sync.Mutex
+	written    map[string][]byte
+}
+
+func newSFTPServer(t *testing.T, password string) *sftpServer {
+	t.Helper()
+
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	require.NoError(t, err)
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(_ ssh.ConnMetadata, given []byte) (*ssh.Permissions, error) {
+			if string(given) != password {
+				return nil, assert.AnError
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	server := &sftpServer{addr: listener.Addr().String(), written: map[string][]byte{}}
+	server.knownHosts = filepath.Join(t.TempDir(), "known_hosts")
+	require.NoError(t, os.WriteFile(server.knownHosts, []byte(knownhosts.Line([]string{server.addr}, signer.PublicKey())+"\n"), 0o600))
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn, config)
+		}
+	}()
+	return server
+}
+
+func (s *sftpServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				req.Reply(req.Type == "subsystem" && string(req.Payload[4:]) == "sftp", nil)
+			}
+		}()
+		s.handle(channel)
+		channel.Close()
+	}
+}
+
+// handle answers the requests sent by the client, one at a time.
+func (s *sftpServer) handle(channel io.ReadWriter) {
+	files := map[string][]byte{}
+	handles := map[string]string{}
+	status := func(id []byte, code uint32) []byte {
+		payload := append(append([]byte(nil), id...), binary.BigEndian.AppendUint32(nil, code)...)
+		return append(payload, 0, 0, 0, 0, 0, 0, 0, 0)
+	}
+	for {
+		var header [5]byte
+		if _, err := io.ReadFull(channel, header[:]); err != nil {
+			return
+		}
+		payload := make([]byte, binary.BigEndian.Uint32(header[:4])-1)
+		if _, err := io.ReadFull(channel, payload); err != nil {
+			return
+		}
+		var kind byte
+		var reply []byte
+		switch header[4] {
+		case 1:
+			kind, reply = 2, binary.BigEndian.AppendUint32(nil, 3)
+		case 3:
+			name, _ := readString(payload[4:])
+			handles["h"] = name
+			files[name] = nil
+			kind, reply = 102, append(append([]byte(nil), payload[:4]...), 0, 0, 0, 1, 'h')
+		case 6:
+			handle, rest := readString(payload[4:])
+			offset := binary.BigEndian.Uint64(rest)
+			data, _ := readString(rest[8:])
+			name := handles[handle]
+			files[name] = append(files[name][:offset], data...)
+			kind, reply = 101, status(payload[:4], 0)
+		case 4:
+			kind, reply = 101, status(payload[:4], 0)
+		case 18:
+			from, rest := readString(payload[4:])
+			to, _ := readString(rest)
+			s.mu.Lock()
+			s.written[to] = files[from]
+			s.mu.Unlock()
+			kind, reply = 101, status(payload[:4], 0)
+		default:
+			kind, reply = 101, status(payload[:4], 8)
+		}
+		packet := binary.BigEndian.AppendUint32(nil, uint32(len(reply)+1))
+		packet = append(append(packet, kind), reply...)
+		if _, err := channel.Write(packet); err != nil {
+			return
+		}
+	}
+}
+
+func (s *sftpServer) files() map[string][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files := map[string][]byte{}
+	for name, content := range s.written {
+		if base, ok := strings.CutPrefix(name, "/srv/pellets/"); ok {
+			files[base] = content
+		}
+	}
+	return files
+}
+
+func readString(data []byte) (string, []byte) {
+	length := binary.BigEndian.Uint32(data)
+	return string(data[4 : 4+length]), data[4+length:]
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"pellets-tracker/internal/core"
+)
+
+// LoadLenient reads a datastore like Load but repairs what it can instead of
+// refusing the whole file: a section or a record that does not decode is
+// dropped, then core.RepairDataStore fixes the records left. Everything
+// changed or flagged is listed in the returned report. Only a file that is
+// not a JSON object at all is refused.
+func LoadLenient(path string) (*core.DataStore, core.RepairReport, error) {
+	now := time.Now().UTC()
+	report := core.RepairReport{At: now}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			data, err := Load(path)
+			return data, report, err
+		}
+		return nil, report, fmt.Errorf("open datastore: %w", err)
+	}
+
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &sections); err != nil {
+		return nil, report, fmt.Errorf("decode datastore: %w", err)
+	}
+	keys := make([]string, 0, len(sections))
+	for key := range sections {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if decodesAs(key, sections[key]) {
+			continue
+		}
+		kept, ok := decodableRecords(key, sections[key], &report)
+		if !ok {
+			delete(sections, key)
+			report.Add("/"+key, true, "section that does not decode dropped")
+			continue
+		}
+		sections[key] = kept
+	}
+
+	repaired, err := json.Marshal(sections)
+	if err != nil {
+		return nil, report, fmt.Errorf("encode repaired datastore: %w", err)
+	}
+	var ds core.DataStore
+	if err := json.Unmarshal(repaired, &ds); err != nil {
+		return nil, report, fmt.Errorf("decode datastore: %w", err)
+	}
+
+	if ds.ID == "" {
+		ds.ID = core.NewID()
+	}
+	if ds.CreatedAt.IsZero() {
+		ds.CreatedAt = now
+	}
+	ds.UpdatedAt = now
+	core.RepairDataStore(&ds, now, &report)
+
+	from := ds.SchemaVersion
+	if core.MigrateDataStore(&ds) {
+		log.Printf("migrated datastore from schema %d to %d", from, ds.SchemaVersion)
+	}
+	return &ds, report, nil
+}
+
+// decodesAs reports whether value decodes as the section key of a datastore.
+func decodesAs(key string, value json.RawMessage) bool {
+	doc, err := json.Marshal(map[string]json.RawMessage{key: value})
+	if err != nil {
+		return false
+	}
+	var ds core.DataStore
+	return json.Unmarshal(doc, &ds) == nil
+}
+
+// decodableRecords keeps the records of the array section key that decode,
+// reporting the others. It returns false when the section is not an array.
+func decodableRecords(key string, value json.RawMessage, report *core.RepairReport) (json.RawMessage, bool) {
+	var records []json.RawMessage
+	if err := json.Unmarshal(value, &records); err != nil {
+		return nil, false
+	}
+	kept := make([]json.RawMessage, 0, len(records))
+	for i, record := range records {
+		if !decodesAs(key, json.RawMessage("["+string(record)+"]")) {
+			report.Add(fmt.Sprintf("/%s/%d", key, i), true, "record that does not decode dropped: %s", abbreviate(record))
+			continue
+		}
+		kept = append(kept, record)
+	}
+	encoded, err := json.Marshal(kept)
+	if err != nil {
+		return nil, false
+	}
+	return encoded, true
+}
+
+// abbreviate shortens record to keep the report readable.
+func abbreviate(record json.RawMessage) string {
+	const limit = 120
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, record); err != nil {
+		compact.Reset()
+		compact.Write(record)
+	}
+	if compact.Len() <= limit {
+		return compact.String()
+	}
+	return string(compact.Bytes()[:limit]) + "…"
+}
+
+// writeRepairReport saves report next to the backups of the datastore at
+// path and returns the file written.
+func writeRepairReport(path, backupDir string, report core.RepairReport) (string, error) {
+	encoded, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("encode repair report: %w", err)
+	}
+	name := fmt.Sprintf("%s.repair-%s.json", filepath.Base(path), report.At.Format("20060102T150405.000Z"))
+	reportPath := filepath.Join(backupDir, name)
+	if err := os.WriteFile(reportPath, encoded, filePerms); err != nil {
+		return "", fmt.Errorf("write repair report: %w", err)
+	}
+	return reportPath, nil
+}
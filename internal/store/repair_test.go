@@ -0,0 +1,111 @@
+package store_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/store"
+)
+
+func TestNewLenientJSONStore(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		file string
+	}
+	type want struct {
+		err          bool
+		brands       []string
+		purchases    int
+		paths        []string
+		reportFile   bool
+		strictFailed bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "opens a valid file untouched",
+			params: params{file: `{"id":"ds","brands":[{"id":"brand-w","name":"Woodstock","created_at":"2024-10-01T00:00:00Z","updated_at":"2024-10-01T00:00:00Z"}],"schema_version":1}`},
+			want:   want{brands: []string{"Woodstock"}},
+		},
+		{
+			name: "repairs legacy records",
+			params: params{file: `{"brands":[{"name":"Woodstock"}],` +
+				`"purchases":[{"id":"p1","brand_id":"brand-gone","purchased_at":"2023-10-01T00:00:00Z","bags":-3}]}`},
+			want: want{
+				brands:     []string{"Woodstock"},
+				purchases:  1,
+				paths:      []string{"/brands/0/id", "/brands/0/created_at", "/brands/0/updated_at", "/purchases/0/created_at", "/purchases/0/updated_at", "/purchases/0/bags", "/purchases/0/brand_id"},
+				reportFile: true,
+			},
+		},
+		{
+			name: "drops the records and sections that do not decode",
+			params: params{file: `{"brands":[{"id":"brand-w","name":"Woodstock","created_at":"2024-10-01T00:00:00Z","updated_at":"2024-10-01T00:00:00Z"},{"id":42}],` +
+				`"min_stock_bags":"many","schema_version":1}`},
+			want: want{
+				brands:       []string{"Woodstock"},
+				paths:        []string{"/brands/1", "/min_stock_bags"},
+				reportFile:   true,
+				strictFailed: true,
+			},
+		},
+		{
+			name:   "refuses a file that is not a JSON object",
+			params: params{file: `[1, 2, 3]`},
+			want:   want{err: true, strictFailed: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, "pellets.json")
+			backups := filepath.Join(dir, "backups")
+			require.NoError(t, os.WriteFile(path, []byte(tc.params.file), 0o600), tc.name)
+
+			_, err := store.Load(path)
+			assert.Equal(t, tc.want.strictFailed, err != nil, tc.name)
+
+			s, err := store.NewLenientJSONStore(path, backups, store.FormatCompact)
+			if tc.want.err {
+				require.Error(t, err, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+
+			var brands []string
+			for _, brand := range s.Data().Brands {
+				brands = append(brands, brand.Name)
+			}
+			assert.Equal(t, tc.want.brands, brands, tc.name)
+			assert.Len(t, s.Data().Purchases, tc.want.purchases, tc.name)
+
+			var paths []string
+			for _, issue := range s.Repairs().Issues {
+				paths = append(paths, issue.Path)
+			}
+			assert.Equal(t, tc.want.paths, paths, tc.name)
+
+			reports, err := filepath.Glob(filepath.Join(backups, "pellets.json.repair-*.json"))
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.reportFile, len(reports) == 1, tc.name)
+
+			// The repairs are saved, so the file now opens strictly.
+			saved, err := store.Load(path)
+			require.NoError(t, err, tc.name)
+			assert.Len(t, saved.Brands, len(tc.want.brands), tc.name)
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultS3Region = "us-east-1"
+
+// s3Target uploads the snapshots to an S3-compatible bucket with requests
+// signed with AWS Signature Version 4.
+type s3Target struct {
+	endpoint  *url.URL
+	bucket    string
+	prefix    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+	now       func() time.Time
+}
+
+func newS3Target(parsed *url.URL, cfg RemoteTargetConfig) (*s3Target, error) {
+	if parsed.Host == "" {
+		return nil, errors.New("no bucket in the s3 url")
+	}
+	if cfg.S3AccessKey == "" || cfg.S3SecretKey == "" {
+		return nil, errors.New("an s3 access key and secret key are required")
+	}
+	region := cfg.S3Region
+	if region == "" {
+		region = defaultS3Region
+	}
+	endpoint := cfg.S3Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil || (endpointURL.Scheme != "http" && endpointURL.Scheme != "https") || endpointURL.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", endpoint)
+	}
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &s3Target{
+		endpoint:  endpointURL,
+		bucket:    parsed.Host,
+		prefix:    strings.Trim(parsed.Path, "/"),
+		region:    region,
+		accessKey: cfg.S3AccessKey,
+		secretKey: cfg.S3SecretKey,
+		client:    client,
+		now:       time.Now,
+	}, nil
+}
+
+func (t *s3Target) Put(ctx context.Context, name string, body []byte) error {
+	key := name
+	if t.prefix != "" {
+		key = t.prefix + "/" + name
+	}
+	target := *t.endpoint
+	target.Path = strings.TrimSuffix(target.Path, "/") + "/" + t.bucket + "/" + key
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build s3 request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+	t.sign(req, body, t.now())
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("put s3 object: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("put s3 object: %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+func (t *s3Target) String() string {
+	return fmt.Sprintf("s3://%s on %s", path.Join(t.bucket, t.prefix), t.endpoint.Host)
+}
+
+// sign adds the Signature Version 4 headers of req, whose payload is body,
+// at now.
+func (t *s3Target) sign(req *http.Request, body []byte, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsEscapePath(req.URL.Path),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + t.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+t.secretKey), day)
+	key = hmacSHA256(key, t.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", t.accessKey, scope, signedHeaders, signature))
+}
+
+// awsEscapePath encodes every byte of path but the unreserved characters and
+// the slashes, as Signature Version 4 expects.
+func awsEscapePath(path string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', strings.IndexByte("-._~/", c) >= 0:
+			escaped.WriteByte(c)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		}
+	}
+	return escaped.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,302 @@
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"path"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Packets and flags of the SFTP version 3 protocol used to upload a file,
+// see draft-ietf-secsh-filexfer-02.
+const (
+	sftpVersion = 3
+
+	sftpInit          = 1
+	sftpVersionPacket = 2
+	sftpOpen          = 3
+	sftpClose         = 4
+	sftpWrite         = 6
+	sftpRename        = 18
+	sftpStatus        = 101
+	sftpHandle        = 102
+
+	sftpFlagWrite    = 0x02
+	sftpFlagCreate   = 0x08
+	sftpFlagTruncate = 0x10
+
+	sftpStatusOK = 0
+
+	// sftpChunkSize stays below the 34000 bytes every server must accept in
+	// a packet.
+	sftpChunkSize = 32 * 1024
+	// sftpMaxPacket bounds the replies read, which are all small.
+	sftpMaxPacket   = 256 * 1024
+	defaultSFTPPort = "22"
+)
+
+// sftpTarget uploads the snapshots to a directory of an SFTP server.
+type sftpTarget struct {
+	addr   string
+	dir    string
+	config *ssh.ClientConfig
+}
+
+func newSFTPTarget(parsed *url.URL, cfg RemoteTargetConfig) (*sftpTarget, error) {
+	if parsed.Hostname() == "" {
+		return nil, errors.New("no host in the sftp url")
+	}
+	user := parsed.User.Username()
+	if user == "" {
+		return nil, errors.New("no user in the sftp url")
+	}
+	var auth []ssh.AuthMethod
+	if len(cfg.SSHKey) > 0 {
+		signer, err := ssh.ParsePrivateKey(cfg.SSHKey)
+		if err != nil {
+			return nil, fmt.Errorf("parse ssh key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if password, ok := parsed.User.Password(); ok {
+		auth = append(auth, ssh.Password(password))
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("an ssh key or a password in the sftp url is required")
+	}
+	// The server key is always checked: an impostor would receive the
+	// whole history.
+	if cfg.SSHKnownHosts == "" {
+		return nil, errors.New("a known_hosts file is required to check the sftp server")
+	}
+	hostKeys, err := knownhosts.New(cfg.SSHKnownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("read known_hosts: %w", err)
+	}
+	port := parsed.Port()
+	if port == "" {
+		port = defaultSFTPPort
+	}
+	dir := parsed.Path
+	if dir == "" {
+		dir = "."
+	}
+	return &sftpTarget{
+		addr:   net.JoinHostPort(parsed.Hostname(), port),
+		dir:    dir,
+		config: &ssh.ClientConfig{User: user, Auth: auth, HostKeyCallback: hostKeys},
+	}, nil
+}
+
+func (t *sftpTarget) Put(ctx context.Context, name string, body []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return fmt.Errorf("connect to sftp server: %w", err)
+	}
+	// Closing the connection unblocks the handshake and the transfer when
+	// ctx ends first.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, t.addr, t.config)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("ssh handshake: %w", err)
+	}
+	client := ssh.NewClient(sshConn, chans, reqs)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("open ssh session: %w", err)
+	}
+	defer session.Close()
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("open sftp input: %w", err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("open sftp output: %w", err)
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		return fmt.Errorf("start sftp: %w", err)
+	}
+
+	sftp := &sftpConn{w: stdin, r: stdout}
+	if err := sftp.init(); err != nil {
+		return err
+	}
+	// The snapshot is renamed once complete, a broken transfer leaving a
+	// .part file behind rather than a truncated backup.
+	final := path.Join(t.dir, name)
+	partial := final + ".part"
+	if err := sftp.upload(partial, body); err != nil {
+		return err
+	}
+	if err := sftp.rename(partial, final); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (t *sftpTarget) String() string {
+	target := fmt.Sprintf("sftp://%s@%s", t.config.User, t.addr)
+	if t.dir != "." {
+		target += t.dir
+	}
+	return target
+}
+
+// sftpConn speaks the SFTP protocol, one request at a time.
+type sftpConn struct {
+	w      io.Writer
+	r      io.Reader
+	nextID uint32
+}
+
+func (c *sftpConn) init() error {
+	if err := c.send(sftpInit, binary.BigEndian.AppendUint32(nil, sftpVersion)); err != nil {
+		return err
+	}
+	kind, payload, err := c.receive()
+	if err != nil {
+		return err
+	}
+	if kind != sftpVersionPacket || len(payload) < 4 {
+		return fmt.Errorf("unexpected sftp packet %d instead of the version", kind)
+	}
+	if version := binary.BigEndian.Uint32(payload); version < sftpVersion {
+		return fmt.Errorf("unsupported sftp version %d", version)
+	}
+	return nil
+}
+
+func (c *sftpConn) upload(name string, body []byte) error {
+	open := appendSFTPString(nil, name)
+	open = binary.BigEndian.AppendUint32(open, sftpFlagWrite|sftpFlagCreate|sftpFlagTruncate)
+	// No attributes: the server applies its umask.
+	open = binary.BigEndian.AppendUint32(open, 0)
+	kind, payload, err := c.request(sftpOpen, open)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", name, err)
+	}
+	if kind != sftpHandle {
+		return fmt.Errorf("open %s: %w", name, sftpError(kind, payload))
+	}
+	handle, _, ok := readSFTPString(payload)
+	if !ok {
+		return fmt.Errorf("open %s: malformed handle", name)
+	}
+
+	for offset := 0; offset < len(body); offset += sftpChunkSize {
+		chunk := body[offset:min(offset+sftpChunkSize, len(body))]
+		write := appendSFTPString(nil, string(handle))
+		write = binary.BigEndian.AppendUint64(write, uint64(offset))
+		write = appendSFTPString(write, string(chunk))
+		if err := c.expectOK(sftpWrite, write); err != nil {
+			return fmt.Errorf("write %s: %w", name, err)
+		}
+	}
+	if err := c.expectOK(sftpClose, appendSFTPString(nil, string(handle))); err != nil {
+		return fmt.Errorf("close %s: %w", name, err)
+	}
+	return nil
+}
+
+func (c *sftpConn) rename(from, to string) error {
+	if err := c.expectOK(sftpRename, appendSFTPString(appendSFTPString(nil, from), to)); err != nil {
+		return fmt.Errorf("rename %s: %w", from, err)
+	}
+	return nil
+}
+
+// expectOK sends a request answered by a status and fails unless it is OK.
+func (c *sftpConn) expectOK(kind byte, payload []byte) error {
+	reply, data, err := c.request(kind, payload)
+	if err != nil {
+		return err
+	}
+	return sftpError(reply, data)
+}
+
+// request sends a packet with a new request ID and returns the reply,
+// without its ID.
+func (c *sftpConn) request(kind byte, payload []byte) (byte, []byte, error) {
+	c.nextID++
+	id := c.nextID
+	if err := c.send(kind, append(binary.BigEndian.AppendUint32(nil, id), payload...)); err != nil {
+		return 0, nil, err
+	}
+	reply, data, err := c.receive()
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(data) < 4 || binary.BigEndian.Uint32(data) != id {
+		return 0, nil, errors.New("sftp reply to another request")
+	}
+	return reply, data[4:], nil
+}
+
+func (c *sftpConn) send(kind byte, payload []byte) error {
+	packet := binary.BigEndian.AppendUint32(nil, uint32(len(payload)+1))
+	packet = append(packet, kind)
+	packet = append(packet, payload...)
+	if _, err := c.w.Write(packet); err != nil {
+		return fmt.Errorf("send sftp packet: %w", err)
+	}
+	return nil
+}
+
+func (c *sftpConn) receive() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return 0, nil, fmt.Errorf("read sftp packet: %w", err)
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length < 1 || length > sftpMaxPacket {
+		return 0, nil, fmt.Errorf("invalid sftp packet length %d", length)
+	}
+	payload := make([]byte, length-1)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, fmt.Errorf("read sftp packet: %w", err)
+	}
+	return header[4], payload, nil
+}
+
+// sftpError turns a status reply into an error, nil for OK.
+func sftpError(kind byte, payload []byte) error {
+	if kind != sftpStatus || len(payload) < 4 {
+		return fmt.Errorf("unexpected sftp packet %d", kind)
+	}
+	code := binary.BigEndian.Uint32(payload)
+	if code == sftpStatusOK {
+		return nil
+	}
+	message, _, _ := readSFTPString(payload[4:])
+	return fmt.Errorf("sftp status %d: %s", code, message)
+}
+
+func appendSFTPString(buf []byte, value string) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(value)))
+	return append(buf, value...)
+}
+
+func readSFTPString(data []byte) ([]byte, []byte, bool) {
+	if len(data) < 4 {
+		return nil, nil, false
+	}
+	length := binary.BigEndian.Uint32(data)
+	if uint64(len(data)-4) < uint64(length) {
+		return nil, nil, false
+	}
+	return data[4 : 4+length], data[4+length:], true
+}
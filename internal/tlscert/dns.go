@@ -0,0 +1,204 @@
+package tlscert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNSProvider publishes the TXT records answering ACME DNS-01 challenges.
+// fqdn is the challenge record name without the trailing dot, e.g.
+// "_acme-challenge.pellets.home.example.com".
+type DNSProvider interface {
+	Present(ctx context.Context, fqdn, value string) error
+	CleanUp(ctx context.Context, fqdn, value string) error
+}
+
+// Supported DNS provider names.
+const (
+	ProviderCloudflare = "cloudflare"
+	ProviderExec       = "exec"
+)
+
+// ExecProvider delegates record management to an external program called as
+// "<path> present|cleanup <fqdn.> <value>", the convention of the lego exec
+// provider, so existing hook scripts can be reused.
+type ExecProvider struct {
+	Path string
+}
+
+// Present implements DNSProvider.
+func (p ExecProvider) Present(ctx context.Context, fqdn, value string) error {
+	return p.run(ctx, "present", fqdn, value)
+}
+
+// CleanUp implements DNSProvider.
+func (p ExecProvider) CleanUp(ctx context.Context, fqdn, value string) error {
+	return p.run(ctx, "cleanup", fqdn, value)
+}
+
+func (p ExecProvider) run(ctx context.Context, action, fqdn, value string) error {
+	out, err := exec.CommandContext(ctx, p.Path, action, fqdn+".", value).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("dns hook %s %s: %w: %s", action, fqdn, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+const cloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+// CloudflareProvider manages challenge records through the Cloudflare API
+// with a token allowed to edit the DNS of the zone.
+type CloudflareProvider struct {
+	Token string
+	// BaseURL overrides the API endpoint, for tests.
+	BaseURL string
+	Client  *http.Client
+
+	mu      sync.Mutex
+	records map[string]cloudflareRecord
+}
+
+type cloudflareRecord struct {
+	zoneID   string
+	recordID string
+}
+
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+// Present implements DNSProvider.
+func (p *CloudflareProvider) Present(ctx context.Context, fqdn, value string) error {
+	zoneID, err := p.findZone(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	body := map[string]any{"type": "TXT", "name": fqdn, "content": value, "ttl": 120}
+	if err := p.call(ctx, http.MethodPost, "/zones/"+zoneID+"/dns_records", body, &created); err != nil {
+		return fmt.Errorf("create TXT record %s: %w", fqdn, err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.records == nil {
+		p.records = make(map[string]cloudflareRecord)
+	}
+	p.records[fqdn+" "+value] = cloudflareRecord{zoneID: zoneID, recordID: created.ID}
+	return nil
+}
+
+// CleanUp implements DNSProvider.
+func (p *CloudflareProvider) CleanUp(ctx context.Context, fqdn, value string) error {
+	p.mu.Lock()
+	record, ok := p.records[fqdn+" "+value]
+	delete(p.records, fqdn+" "+value)
+	p.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	if err := p.call(ctx, http.MethodDelete, "/zones/"+record.zoneID+"/dns_records/"+record.recordID, nil, nil); err != nil {
+		return fmt.Errorf("delete TXT record %s: %w", fqdn, err)
+	}
+	return nil
+}
+
+// findZone looks up the closest zone enclosing fqdn, trying every parent
+// domain from the shortest up.
+func (p *CloudflareProvider) findZone(ctx context.Context, fqdn string) (string, error) {
+	labels := strings.Split(fqdn, ".")
+	for i := len(labels) - 2; i >= 0; i-- {
+		name := strings.Join(labels[i:], ".")
+		var zones []struct {
+			ID string `json:"id"`
+		}
+		if err := p.call(ctx, http.MethodGet, "/zones?name="+url.QueryEscape(name), nil, &zones); err != nil {
+			return "", fmt.Errorf("look up zone %s: %w", name, err)
+		}
+		if len(zones) > 0 {
+			return zones[0].ID, nil
+		}
+	}
+	return "", fmt.Errorf("no cloudflare zone found for %s", fqdn)
+}
+
+func (p *CloudflareProvider) call(ctx context.Context, method, path string, body, result any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	base := p.BaseURL
+	if base == "" {
+		base = cloudflareAPI
+	}
+	req, err := http.NewRequestWithContext(ctx, method, base+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var decoded cloudflareResponse
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&decoded); err != nil {
+		return fmt.Errorf("decode response (status %d): %w", res.StatusCode, err)
+	}
+	if !decoded.Success {
+		messages := make([]string, len(decoded.Errors))
+		for i, e := range decoded.Errors {
+			messages[i] = e.Message
+		}
+		return fmt.Errorf("cloudflare api status %d: %s", res.StatusCode, strings.Join(messages, "; "))
+	}
+	if result != nil {
+		return json.Unmarshal(decoded.Result, result)
+	}
+	return nil
+}
+
+// NewDNSProvider builds the named provider from its settings: the API token
+// for cloudflare, the hook path for exec.
+func NewDNSProvider(name, cloudflareToken, execPath string) (DNSProvider, error) {
+	switch name {
+	case ProviderCloudflare:
+		if cloudflareToken == "" {
+			return nil, errors.New("cloudflare provider requires an API token")
+		}
+		return &CloudflareProvider{Token: cloudflareToken}, nil
+	case ProviderExec:
+		if execPath == "" {
+			return nil, errors.New("exec provider requires a hook path")
+		}
+		return ExecProvider{Path: execPath}, nil
+	default:
+		return nil, fmt.Errorf("unknown dns provider %q", name)
+	}
+}
@@ -0,0 +1,211 @@
+package tlscert_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/tlscert"
+)
+
+func TestCloudflareProvider(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		zone    string
+		failing bool
+	}
+	type want struct {
+		presentErr bool
+		calls      []string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "creates and deletes the record in the enclosing zone",
+			params: params{zone: "example.com"},
+			want: want{calls: []string{
+				"GET /zones?name=example.com",
+				"POST /zones/zone-1/dns_records _acme-challenge.pellets.home.example.com=token",
+				"DELETE /zones/zone-1/dns_records/record-1",
+			}},
+		},
+		{
+			name:   "prefers the closest delegated zone",
+			params: params{zone: "home.example.com"},
+			want: want{calls: []string{
+				"GET /zones?name=example.com",
+				"GET /zones?name=home.example.com",
+				"POST /zones/zone-1/dns_records _acme-challenge.pellets.home.example.com=token",
+				"DELETE /zones/zone-1/dns_records/record-1",
+			}},
+		},
+		{
+			name:   "reports api errors",
+			params: params{zone: "example.com", failing: true},
+			want: want{
+				presentErr: true,
+				calls: []string{
+					"GET /zones?name=example.com",
+					"POST /zones/zone-1/dns_records _acme-challenge.pellets.home.example.com=token",
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var mu sync.Mutex
+			var calls []string
+			api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"), tc.name)
+				call := r.Method + " " + r.URL.RequestURI()
+				result := any(nil)
+				switch {
+				case r.Method == http.MethodGet:
+					zones := []map[string]string{}
+					if r.URL.Query().Get("name") == tc.params.zone {
+						zones = append(zones, map[string]string{"id": "zone-1"})
+					}
+					result = zones
+				case r.Method == http.MethodPost:
+					var body map[string]any
+					require.NoError(t, json.NewDecoder(r.Body).Decode(&body), tc.name)
+					call += " " + body["name"].(string) + "=" + body["content"].(string)
+					if tc.params.failing {
+						mu.Lock()
+						calls = append(calls, call)
+						mu.Unlock()
+						w.WriteHeader(http.StatusForbidden)
+						_, _ = w.Write([]byte(`{"success":false,"errors":[{"message":"forbidden"}]}`))
+						return
+					}
+					result = map[string]string{"id": "record-1"}
+				}
+				mu.Lock()
+				calls = append(calls, call)
+				mu.Unlock()
+				_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "result": result})
+			}))
+			t.Cleanup(api.Close)
+
+			provider := &tlscert.CloudflareProvider{Token: "secret", BaseURL: api.URL}
+			ctx := context.Background()
+			err := provider.Present(ctx, "_acme-challenge.pellets.home.example.com", "token")
+			if tc.want.presentErr {
+				assert.Error(t, err, tc.name)
+			} else {
+				require.NoError(t, err, tc.name)
+				require.NoError(t, provider.CleanUp(ctx, "_acme-challenge.pellets.home.example.com", "token"), tc.name)
+			}
+			assert.Equal(t, tc.want.calls, calls, tc.name)
+		})
+	}
+}
+
+func TestExecProvider(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		exitCode string
+	}
+	type want struct {
+		err   bool
+		lines string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "calls the hook with lego arguments",
+			params: params{exitCode: "0"},
+			want:   want{lines: "present _acme-challenge.example.com. token\ncleanup _acme-challenge.example.com. token\n"},
+		},
+		{
+			name:   "reports hook failures",
+			params: params{exitCode: "3"},
+			want:   want{err: true, lines: "present _acme-challenge.example.com. token\n"},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			logFile := filepath.Join(dir, "calls.log")
+			hook := filepath.Join(dir, "hook.sh")
+			script := "#!/bin/sh\necho \"$1 $2 $3\" >> " + logFile + "\nexit " + tc.params.exitCode + "\n"
+			require.NoError(t, os.WriteFile(hook, []byte(script), 0o755), tc.name)
+
+			provider := tlscert.ExecProvider{Path: hook}
+			ctx := context.Background()
+			err := provider.Present(ctx, "_acme-challenge.example.com", "token")
+			if tc.want.err {
+				assert.Error(t, err, tc.name)
+			} else {
+				require.NoError(t, err, tc.name)
+				require.NoError(t, provider.CleanUp(ctx, "_acme-challenge.example.com", "token"), tc.name)
+			}
+			data, err := os.ReadFile(logFile)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.lines, string(data), tc.name)
+		})
+	}
+}
+
+func TestNewDNSProvider(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		name, token, path string
+	}
+	type want struct {
+		errContains string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "cloudflare with token", params: params{name: tlscert.ProviderCloudflare, token: "secret"}},
+		{name: "cloudflare without token", params: params{name: tlscert.ProviderCloudflare}, want: want{errContains: "API token"}},
+		{name: "exec with hook", params: params{name: tlscert.ProviderExec, path: "/usr/local/bin/hook"}},
+		{name: "exec without hook", params: params{name: tlscert.ProviderExec}, want: want{errContains: "hook path"}},
+		{name: "unknown provider", params: params{name: "route53"}, want: want{errContains: "unknown dns provider"}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			provider, err := tlscert.NewDNSProvider(tc.params.name, tc.params.token, tc.params.path)
+			if tc.want.errContains != "" {
+				assert.ErrorContains(t, err, tc.want.errContains, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.NotNil(t, provider, tc.name)
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package tlscert
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const fileCheckInterval = time.Minute
+
+// FileCertificate serves a certificate and key read from PEM files managed
+// outside the application (certbot, a reverse proxy's store…), reloading them
+// when they change on disk.
+type FileCertificate struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewFileCertificate loads the certificate from certFile and keyFile.
+func NewFileCertificate(certFile, keyFile string) (*FileCertificate, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("certificate and key files are required")
+	}
+	f := &FileCertificate{certFile: certFile, keyFile: keyFile}
+	if _, err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// TLSConfig returns a server configuration presenting the certificate.
+func (f *FileCertificate) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: f.GetCertificate,
+	}
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (f *FileCertificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.cert, nil
+}
+
+// Reload reads the files again when one of them changed since the last load
+// and reports whether the certificate was replaced. The current certificate
+// stays in use when the new files cannot be loaded, such as while they are
+// half written.
+func (f *FileCertificate) Reload() (bool, error) {
+	modTime, err := f.lastModified()
+	if err != nil {
+		return false, err
+	}
+	f.mu.RLock()
+	unchanged := f.cert != nil && modTime.Equal(f.modTime)
+	f.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	cert, err := tls.LoadX509KeyPair(f.certFile, f.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("load certificate: %w", err)
+	}
+	f.mu.Lock()
+	f.cert = &cert
+	f.modTime = modTime
+	f.mu.Unlock()
+	return true, nil
+}
+
+// Run reloads the certificate when its files change until ctx is cancelled.
+func (f *FileCertificate) Run(ctx context.Context) {
+	ticker := time.NewTicker(fileCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		reloaded, err := f.Reload()
+		if err != nil {
+			log.Printf("tls: reloading %s failed, keeping the current certificate: %v", f.certFile, err)
+			continue
+		}
+		if reloaded {
+			log.Printf("tls: reloaded %s, valid until %s", f.certFile, f.NotAfter().Format(time.RFC3339))
+		}
+	}
+}
+
+// NotAfter returns the expiry of the certificate served.
+func (f *FileCertificate) NotAfter() time.Time {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.cert == nil || f.cert.Leaf == nil {
+		return time.Time{}
+	}
+	return f.cert.Leaf.NotAfter
+}
+
+// lastModified returns the most recent modification time of the two files.
+func (f *FileCertificate) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{f.certFile, f.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("stat certificate: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
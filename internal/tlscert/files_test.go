@@ -0,0 +1,148 @@
+package tlscert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCertificate writes a self-signed certificate for name and its key.
+func writeCertificate(t *testing.T, certFile, keyFile, name string, modTime time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyPEM, err := encodeECKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644))
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+}
+
+func TestNewFileCertificate(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		// write names the certificate written, none when empty.
+		write   string
+		keyFile string
+	}
+	type want struct {
+		err bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "loads the certificate", params: params{write: "pellets.example.com"}},
+		{name: "requires the files", params: params{}, want: want{err: true}},
+		{name: "requires the key", params: params{write: "pellets.example.com", keyFile: "missing.key"}, want: want{err: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+			if tc.params.write != "" {
+				writeCertificate(t, certFile, keyFile, tc.params.write, time.Now())
+			}
+			if tc.params.keyFile != "" {
+				keyFile = filepath.Join(dir, tc.params.keyFile)
+			}
+
+			cert, err := NewFileCertificate(certFile, keyFile)
+
+			if tc.want.err {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			served, err := cert.GetCertificate(nil)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.params.write, served.Leaf.Subject.CommonName, tc.name)
+		})
+	}
+}
+
+func TestFileCertificate_Reload(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		// renew rewrites the files with a certificate for that name.
+		renew string
+		// corrupt overwrites the certificate file with invalid content.
+		corrupt bool
+	}
+	type want struct {
+		reloaded bool
+		err      bool
+		serves   string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "keeps unchanged files", want: want{serves: "old.example.com"}},
+		{name: "loads renewed files", params: params{renew: "new.example.com"}, want: want{reloaded: true, serves: "new.example.com"}},
+		{name: "keeps the certificate when the files are invalid", params: params{corrupt: true}, want: want{err: true, serves: "old.example.com"}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+			loadedAt := time.Now().Add(-time.Hour)
+			writeCertificate(t, certFile, keyFile, "old.example.com", loadedAt)
+			cert, err := NewFileCertificate(certFile, keyFile)
+			require.NoError(t, err, tc.name)
+			if tc.params.renew != "" {
+				writeCertificate(t, certFile, keyFile, tc.params.renew, time.Now())
+			}
+			if tc.params.corrupt {
+				require.NoError(t, os.WriteFile(certFile, []byte("not a certificate"), 0o644), tc.name)
+			}
+
+			reloaded, err := cert.Reload()
+
+			assert.Equal(t, tc.want.reloaded, reloaded, tc.name)
+			if tc.want.err {
+				assert.Error(t, err, tc.name)
+			} else {
+				assert.NoError(t, err, tc.name)
+			}
+			served, err := cert.GetCertificate(nil)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want.serves, served.Leaf.Subject.CommonName, tc.name)
+		})
+	}
+}
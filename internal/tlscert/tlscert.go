@@ -0,0 +1,356 @@
+// Package tlscert obtains and renews the HTTPS certificate of the instance
+// from an ACME certificate authority using DNS-01 challenges, so that a server
+// whose ports 80 and 443 are not reachable from the internet (or a wildcard
+// name) can still get a publicly trusted certificate. It also serves
+// certificates managed by another tool, reloading their files once renewed.
+package tlscert
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// LetsEncryptURL is the production directory of Let's Encrypt.
+const LetsEncryptURL = "https://acme-v02.api.letsencrypt.org/directory"
+
+const (
+	defaultRenewBefore        = 30 * 24 * time.Hour
+	defaultPropagationTimeout = 2 * time.Minute
+	renewCheckInterval        = 12 * time.Hour
+	renewRetryInterval        = time.Hour
+)
+
+// Config defines the certificate to obtain.
+type Config struct {
+	// Domain is the certificate name, possibly a wildcard like
+	// "*.home.example.com".
+	Domain string
+	Email  string
+	// DirectoryURL is the ACME directory, Let's Encrypt when empty.
+	DirectoryURL string
+	// CacheDir stores the account key, the certificate and its key.
+	CacheDir string
+	Provider DNSProvider
+	// RenewBefore is how long before expiry the certificate is renewed.
+	RenewBefore time.Duration
+	// PropagationTimeout bounds the wait for the TXT record to be visible in
+	// DNS before asking the CA to validate it.
+	PropagationTimeout time.Duration
+}
+
+// Manager serves the current certificate and renews it in the background.
+type Manager struct {
+	cfg Config
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// New constructs a Manager from the provided configuration.
+func New(cfg Config) (*Manager, error) {
+	if cfg.Domain == "" {
+		return nil, errors.New("tls domain is required")
+	}
+	if cfg.Provider == nil {
+		return nil, errors.New("dns provider is required")
+	}
+	if cfg.CacheDir == "" {
+		return nil, errors.New("certificate cache dir is required")
+	}
+	if cfg.DirectoryURL == "" {
+		cfg.DirectoryURL = LetsEncryptURL
+	}
+	if cfg.RenewBefore <= 0 {
+		cfg.RenewBefore = defaultRenewBefore
+	}
+	if cfg.PropagationTimeout <= 0 {
+		cfg.PropagationTimeout = defaultPropagationTimeout
+	}
+	return &Manager{cfg: cfg}, nil
+}
+
+// TLSConfig returns a server configuration presenting the managed certificate.
+func (m *Manager) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: m.GetCertificate,
+	}
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (m *Manager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.cert == nil {
+		return nil, errors.New("certificate not available yet")
+	}
+	return m.cert, nil
+}
+
+// Ensure loads the cached certificate and obtains a new one when it is
+// missing or due for renewal.
+func (m *Manager) Ensure(ctx context.Context) error {
+	cert, err := m.loadCached()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("tls: ignoring cached certificate: %v", err)
+	}
+	if cert != nil {
+		m.setCert(cert)
+		if !m.needsRenewal(cert.Leaf, time.Now()) {
+			return nil
+		}
+	}
+	return m.obtain(ctx)
+}
+
+// Run renews the certificate until ctx is cancelled. Failures are logged and
+// retried while the current certificate stays in use.
+func (m *Manager) Run(ctx context.Context) {
+	timer := time.NewTimer(renewCheckInterval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		next := renewCheckInterval
+		if err := m.Ensure(ctx); err != nil {
+			log.Printf("tls: certificate renewal for %s failed: %v", m.cfg.Domain, err)
+			next = renewRetryInterval
+		}
+		timer.Reset(next)
+	}
+}
+
+func (m *Manager) needsRenewal(leaf *x509.Certificate, now time.Time) bool {
+	return leaf == nil || now.Add(m.cfg.RenewBefore).After(leaf.NotAfter)
+}
+
+func (m *Manager) setCert(cert *tls.Certificate) {
+	m.mu.Lock()
+	m.cert = cert
+	m.mu.Unlock()
+}
+
+func (m *Manager) obtain(ctx context.Context) error {
+	accountKey, err := m.accountKey()
+	if err != nil {
+		return err
+	}
+	client := &acme.Client{Key: accountKey, DirectoryURL: m.cfg.DirectoryURL}
+	account := &acme.Account{}
+	if m.cfg.Email != "" {
+		account.Contact = []string{"mailto:" + m.cfg.Email}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return fmt.Errorf("register acme account: %w", err)
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(m.cfg.Domain))
+	if err != nil {
+		return fmt.Errorf("create order: %w", err)
+	}
+	for _, authzURL := range order.AuthzURLs {
+		if err := m.authorize(ctx, client, authzURL); err != nil {
+			return err
+		}
+	}
+	order, err = client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return fmt.Errorf("wait order: %w", err)
+	}
+
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("generate certificate key: %w", err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{m.cfg.Domain}}, certKey)
+	if err != nil {
+		return fmt.Errorf("create csr: %w", err)
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return fmt.Errorf("finalize order: %w", err)
+	}
+
+	cert, err := m.store(chain, certKey)
+	if err != nil {
+		return err
+	}
+	m.setCert(cert)
+	log.Printf("tls: obtained certificate for %s valid until %s", m.cfg.Domain, cert.Leaf.NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+func (m *Manager) authorize(ctx context.Context, client *acme.Client, authzURL string) error {
+	authz, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("get authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "dns-01" {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("no dns-01 challenge offered for %s", authz.Identifier.Value)
+	}
+	value, err := client.DNS01ChallengeRecord(challenge.Token)
+	if err != nil {
+		return fmt.Errorf("compute dns-01 record: %w", err)
+	}
+
+	fqdn := ChallengeRecordName(authz.Identifier.Value)
+	if err := m.cfg.Provider.Present(ctx, fqdn, value); err != nil {
+		return fmt.Errorf("publish %s: %w", fqdn, err)
+	}
+	defer func() {
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+		defer cancel()
+		if err := m.cfg.Provider.CleanUp(cleanupCtx, fqdn, value); err != nil {
+			log.Printf("tls: cleanup %s: %v", fqdn, err)
+		}
+	}()
+
+	if !waitForTXT(ctx, fqdn, value, m.cfg.PropagationTimeout) {
+		log.Printf("tls: %s not visible after %s, asking for validation anyway", fqdn, m.cfg.PropagationTimeout)
+	}
+	if _, err := client.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("accept challenge: %w", err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("validate %s: %w", authz.Identifier.Value, err)
+	}
+	return nil
+}
+
+// ChallengeRecordName returns the TXT record name validating domain; wildcard
+// names are validated on their base domain.
+func ChallengeRecordName(domain string) string {
+	return "_acme-challenge." + strings.TrimPrefix(strings.TrimSuffix(domain, "."), "*.")
+}
+
+// lookupTXT is replaced in tests.
+var lookupTXT = net.DefaultResolver.LookupTXT
+
+func waitForTXT(ctx context.Context, fqdn, value string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		records, _ := lookupTXT(ctx, fqdn)
+		for _, record := range records {
+			if record == value {
+				return true
+			}
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (m *Manager) fileBase() string {
+	return filepath.Join(m.cfg.CacheDir, strings.ReplaceAll(m.cfg.Domain, "*", "_wildcard"))
+}
+
+func (m *Manager) accountKey() (crypto.Signer, error) {
+	path := filepath.Join(m.cfg.CacheDir, "acme-account.key")
+	if data, err := os.ReadFile(path); err == nil {
+		return parseECKey(data)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("read account key: %w", err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate account key: %w", err)
+	}
+	data, err := encodeECKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return nil, fmt.Errorf("write account key: %w", err)
+	}
+	return key, nil
+}
+
+func (m *Manager) store(chain [][]byte, key *ecdsa.PrivateKey) (*tls.Certificate, error) {
+	var certPEM []byte
+	for _, der := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	keyPEM, err := encodeECKey(key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("load issued certificate: %w", err)
+	}
+	if err := os.WriteFile(m.fileBase()+".key", keyPEM, 0o600); err != nil {
+		return nil, fmt.Errorf("write certificate key: %w", err)
+	}
+	if err := os.WriteFile(m.fileBase()+".crt", certPEM, 0o644); err != nil {
+		return nil, fmt.Errorf("write certificate: %w", err)
+	}
+	return &cert, nil
+}
+
+func (m *Manager) loadCached() (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(m.fileBase()+".crt", m.fileBase()+".key")
+	if err != nil {
+		return nil, err
+	}
+	if err := cert.Leaf.VerifyHostname(strings.Replace(m.cfg.Domain, "*", "cached", 1)); err != nil {
+		return nil, fmt.Errorf("cached certificate does not match %s: %w", m.cfg.Domain, err)
+	}
+	return &cert, nil
+}
+
+func encodeECKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("encode key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+func parseECKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid account key: no PEM block")
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid account key: %w", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,146 @@
+package tlscert
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type noopProvider struct{}
+
+func (noopProvider) Present(context.Context, string, string) error { return nil }
+func (noopProvider) CleanUp(context.Context, string, string) error { return nil }
+
+func TestChallengeRecordName(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		domain string
+	}
+	type want struct {
+		record string
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "plain name", params: params{domain: "pellets.home.example.com"}, want: want{record: "_acme-challenge.pellets.home.example.com"}},
+		{name: "wildcard", params: params{domain: "*.home.example.com"}, want: want{record: "_acme-challenge.home.example.com"}},
+		{name: "trailing dot", params: params{domain: "pellets.example.com."}, want: want{record: "_acme-challenge.pellets.example.com"}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want.record, ChallengeRecordName(tc.params.domain), tc.name)
+		})
+	}
+}
+
+func TestManager_Ensure(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		domain   string
+		cacheFor string
+		validFor time.Duration
+	}
+	type want struct {
+		err        bool
+		servesCert bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "uses a fresh cached certificate",
+			params: params{domain: "pellets.home.example.com", cacheFor: "pellets.home.example.com", validFor: 60 * 24 * time.Hour},
+			want:   want{servesCert: true},
+		},
+		{
+			name:   "uses a cached wildcard certificate",
+			params: params{domain: "*.home.example.com", cacheFor: "*.home.example.com", validFor: 60 * 24 * time.Hour},
+			want:   want{servesCert: true},
+		},
+		{
+			name:   "keeps serving an expiring certificate when renewal fails",
+			params: params{domain: "pellets.home.example.com", cacheFor: "pellets.home.example.com", validFor: 10 * 24 * time.Hour},
+			want:   want{err: true, servesCert: true},
+		},
+		{
+			name:   "ignores a certificate for another name",
+			params: params{domain: "pellets.home.example.com", cacheFor: "other.example.com", validFor: 60 * 24 * time.Hour},
+			want:   want{err: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			// The directory always fails so that any issuance attempt errors
+			// out without reaching a real certificate authority.
+			ca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				http.Error(w, "unavailable", http.StatusBadRequest)
+			}))
+			t.Cleanup(ca.Close)
+
+			manager, err := New(Config{
+				Domain:       tc.params.domain,
+				DirectoryURL: ca.URL,
+				CacheDir:     t.TempDir(),
+				Provider:     noopProvider{},
+			})
+			require.NoError(t, err, tc.name)
+
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			require.NoError(t, err, tc.name)
+			template := &x509.Certificate{
+				SerialNumber: big.NewInt(1),
+				Subject:      pkix.Name{CommonName: tc.params.cacheFor},
+				DNSNames:     []string{tc.params.cacheFor},
+				NotBefore:    time.Now().Add(-time.Hour),
+				NotAfter:     time.Now().Add(tc.params.validFor),
+			}
+			der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+			require.NoError(t, err, tc.name)
+			_, err = manager.store([][]byte{der}, key)
+			require.NoError(t, err, tc.name)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			err = manager.Ensure(ctx)
+			if tc.want.err {
+				assert.Error(t, err, tc.name)
+			} else {
+				assert.NoError(t, err, tc.name)
+			}
+
+			cert, err := manager.GetCertificate(nil)
+			if !tc.want.servesCert {
+				assert.Error(t, err, tc.name)
+				return
+			}
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.params.cacheFor, cert.Leaf.Subject.CommonName, tc.name)
+		})
+	}
+}
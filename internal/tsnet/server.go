@@ -41,7 +41,8 @@ func New(cfg Config) (*Server, error) {
 	return &Server{cfg: cfg, server: ts}, nil
 }
 
-// Listen opens the configured TSnet listener for HTTPS traffic.
+// Listen opens the configured TSnet listener. Connections come over
+// WireGuard and are served as plain HTTP, without TLS.
 func (s *Server) Listen() (net.Listener, error) {
 	if s.server == nil {
 		return nil, fmt.Errorf("tsnet server not initialised")
@@ -49,6 +50,17 @@ func (s *Server) Listen() (net.Listener, error) {
 	return s.server.Listen("tcp", s.cfg.Listen)
 }
 
+// ListenFunnel opens a Tailscale Funnel listener on addr, reachable from the
+// internet only. The listener is already wrapped in TLS with the certificate
+// of the machine's ts.net name: Accept returns decrypted connections, to
+// serve as plain HTTP without a second TLS layer.
+func (s *Server) ListenFunnel(addr string) (net.Listener, error) {
+	if s.server == nil {
+		return nil, fmt.Errorf("tsnet server not initialised")
+	}
+	return s.server.ListenFunnel("tcp", addr, tsnet.FunnelOnly())
+}
+
 // Close releases the underlying TSnet server resources.
 func (s *Server) Close() error {
 	if s.server == nil {
@@ -0,0 +1,202 @@
+package version
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultGitHubAPI     = "https://api.github.com"
+	defaultCheckInterval = 24 * time.Hour
+)
+
+// Release is a published GitHub release.
+type Release struct {
+	Version string    `json:"version"`
+	URL     string    `json:"url"`
+	At      time.Time `json:"published_at"`
+}
+
+// UpdateChecker polls the latest GitHub release of a repository and remembers
+// it when it is newer than the running build.
+type UpdateChecker struct {
+	// Repo is the "owner/name" GitHub repository.
+	Repo     string
+	Current  string
+	Interval time.Duration
+	BaseURL  string
+	Client   *http.Client
+
+	mu     sync.RWMutex
+	latest *Release
+}
+
+// NewUpdateChecker builds a checker for repo comparing releases against
+// current, the running version.
+func NewUpdateChecker(repo, current string) (*UpdateChecker, error) {
+	if strings.Count(repo, "/") != 1 || strings.HasPrefix(repo, "/") || strings.HasSuffix(repo, "/") {
+		return nil, fmt.Errorf("invalid repository %q, expected owner/name", repo)
+	}
+	return &UpdateChecker{Repo: repo, Current: current}, nil
+}
+
+// Available returns the newer release found by the last successful check.
+func (c *UpdateChecker) Available() (Release, bool) {
+	if c == nil {
+		return Release{}, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.latest == nil {
+		return Release{}, false
+	}
+	return *c.latest, true
+}
+
+// Run checks for updates immediately and then on every interval until ctx is
+// cancelled. Failures are logged and retried on the next tick.
+func (c *UpdateChecker) Run(ctx context.Context) {
+	interval := c.Interval
+	if interval <= 0 {
+		interval = defaultCheckInterval
+	}
+	for {
+		if err := c.Check(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("update check: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Check fetches the latest release once.
+func (c *UpdateChecker) Check(ctx context.Context) error {
+	if _, ok := parseVersion(c.Current); !ok {
+		// Development builds cannot be compared with a release.
+		return nil
+	}
+	baseURL := c.BaseURL
+	if baseURL == "" {
+		baseURL = defaultGitHubAPI
+	}
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: 15 * time.Second}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(baseURL, "/")+"/repos/"+c.Repo+"/releases/latest", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		// The repository has no published release yet.
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("github releases: %s", resp.Status)
+	}
+
+	var payload struct {
+		TagName     string    `json:"tag_name"`
+		HTMLURL     string    `json:"html_url"`
+		PublishedAt time.Time `json:"published_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return fmt.Errorf("decode release: %w", err)
+	}
+	if payload.TagName == "" {
+		return errors.New("release without tag")
+	}
+
+	var latest *Release
+	if Newer(payload.TagName, c.Current) {
+		latest = &Release{Version: payload.TagName, URL: payload.HTMLURL, At: payload.PublishedAt}
+	}
+	c.mu.Lock()
+	c.latest = latest
+	c.mu.Unlock()
+	return nil
+}
+
+// Newer reports whether candidate is a later semantic version than current.
+// Unparseable versions are never newer.
+func Newer(candidate, current string) bool {
+	a, ok := parseVersion(candidate)
+	if !ok {
+		return false
+	}
+	b, ok := parseVersion(current)
+	if !ok {
+		return false
+	}
+	for i := 0; i < 3; i++ {
+		if a.parts[i] != b.parts[i] {
+			return a.parts[i] > b.parts[i]
+		}
+	}
+	// A release ranks above its pre-releases; pre-releases compare as text.
+	switch {
+	case a.pre == b.pre:
+		return false
+	case a.pre == "":
+		return true
+	case b.pre == "":
+		return false
+	default:
+		return a.pre > b.pre
+	}
+}
+
+var describeSuffix = regexp.MustCompile(`^[0-9]+-g[0-9a-f]+$`)
+
+type semver struct {
+	parts [3]int
+	pre   string
+}
+
+func parseVersion(value string) (semver, bool) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "v")
+	if i := strings.IndexByte(value, '+'); i >= 0 {
+		value = value[:i]
+	}
+	value = strings.TrimSuffix(value, "-dirty")
+	var v semver
+	if i := strings.IndexByte(value, '-'); i >= 0 {
+		v.pre = value[i+1:]
+		value = value[:i]
+	}
+	if describeSuffix.MatchString(v.pre) {
+		// "git describe" builds sit on top of their tag, not before it.
+		v.pre = ""
+	}
+	fields := strings.Split(value, ".")
+	if len(fields) == 0 || len(fields) > 3 {
+		return semver{}, false
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return semver{}, false
+		}
+		v.parts[i] = n
+	}
+	return v, true
+}
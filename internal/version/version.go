@@ -0,0 +1,57 @@
+// Package version reports the build the server runs and checks GitHub for
+// newer releases.
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Version and Commit are injected at build time:
+//
+//	go build -ldflags "-X pellets-tracker/internal/version.Version=v1.2.0 -X pellets-tracker/internal/version.Commit=abc1234"
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+// Info describes the running build.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	GoVersion string `json:"go_version"`
+}
+
+// Current returns the running build. Without an injected commit the VCS
+// revision recorded by the Go toolchain is used, when available.
+func Current() Info {
+	info := Info{Version: Version, Commit: Commit, GoVersion: runtime.Version()}
+	if info.Commit == "" {
+		info.Commit = vcsRevision()
+	}
+	return info
+}
+
+func vcsRevision() string {
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	var revision string
+	var modified bool
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if revision != "" && modified {
+		revision += "-dirty"
+	}
+	return revision
+}
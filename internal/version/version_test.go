@@ -0,0 +1,129 @@
+package version_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pellets-tracker/internal/version"
+)
+
+func TestNewer(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		candidate string
+		current   string
+	}
+	type want struct {
+		newer bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{name: "patch release", params: params{candidate: "v1.2.4", current: "v1.2.3"}, want: want{newer: true}},
+		{name: "minor beats patch", params: params{candidate: "v1.10.0", current: "v1.9.9"}, want: want{newer: true}},
+		{name: "same version", params: params{candidate: "v1.2.3", current: "1.2.3"}},
+		{name: "older release", params: params{candidate: "v1.2.0", current: "v1.2.3"}},
+		{name: "release beats its pre-release", params: params{candidate: "v2.0.0", current: "v2.0.0-rc.1"}, want: want{newer: true}},
+		{name: "pre-release below release", params: params{candidate: "v2.0.0-rc.1", current: "v2.0.0"}},
+		{name: "short version", params: params{candidate: "v2", current: "v1.9.0"}, want: want{newer: true}},
+		{name: "development build", params: params{candidate: "v1.0.0", current: "dev"}},
+		{name: "describe output is past its tag", params: params{candidate: "v1.0.0", current: "v1.0.0-3-gabc1234-dirty"}},
+		{name: "describe output behind next release", params: params{candidate: "v1.0.1", current: "v1.0.0-3-gabc1234"}, want: want{newer: true}},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want.newer, version.Newer(tc.params.candidate, tc.params.current), tc.name)
+		})
+	}
+}
+
+func TestUpdateChecker_Check(t *testing.T) {
+	t.Parallel()
+
+	type params struct {
+		current string
+		status  int
+		body    string
+	}
+	type want struct {
+		available bool
+		version   string
+		expectErr bool
+		requested bool
+	}
+
+	tcs := []struct {
+		name   string
+		params params
+		want   want
+	}{
+		{
+			name:   "reports newer release",
+			params: params{current: "v1.0.0", status: http.StatusOK, body: `{"tag_name":"v1.1.0","html_url":"https://github.com/kevynb/pellet-tracking/releases/tag/v1.1.0"}`},
+			want:   want{available: true, version: "v1.1.0", requested: true},
+		},
+		{
+			name:   "ignores current release",
+			params: params{current: "v1.1.0", status: http.StatusOK, body: `{"tag_name":"v1.1.0"}`},
+			want:   want{requested: true},
+		},
+		{
+			name:   "repository without release",
+			params: params{current: "v1.0.0", status: http.StatusNotFound, body: `{}`},
+			want:   want{requested: true},
+		},
+		{
+			name:   "rate limited",
+			params: params{current: "v1.0.0", status: http.StatusForbidden, body: `{}`},
+			want:   want{expectErr: true, requested: true},
+		},
+		{
+			name:   "development build skips the check",
+			params: params{current: "dev", status: http.StatusOK, body: `{"tag_name":"v9.0.0"}`},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var requested atomic.Bool
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requested.Store(true)
+				assert.Equal(t, "/repos/kevynb/pellet-tracking/releases/latest", r.URL.Path, tc.name)
+				w.WriteHeader(tc.params.status)
+				_, _ = w.Write([]byte(tc.params.body))
+			}))
+			defer srv.Close()
+
+			checker, err := version.NewUpdateChecker("kevynb/pellet-tracking", tc.params.current)
+			require.NoError(t, err, tc.name)
+			checker.BaseURL = srv.URL
+
+			err = checker.Check(context.Background())
+			if tc.want.expectErr {
+				assert.Error(t, err, tc.name)
+			} else {
+				assert.NoError(t, err, tc.name)
+			}
+			assert.Equal(t, tc.want.requested, requested.Load(), tc.name)
+			release, ok := checker.Available()
+			assert.Equal(t, tc.want.available, ok, tc.name)
+			assert.Equal(t, tc.want.version, release.Version, tc.name)
+		})
+	}
+}
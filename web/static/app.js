@@ -7,10 +7,27 @@
     return formatter.format(value);
   }
 
+  // parseNumber mirrors the server-side numparse rules: spaces and currency
+  // markers are ignored and the right-most separator is the decimal one.
+  function parseNumber(raw) {
+    let value = String(raw || '').replace(/euros?|eur|€|[\s'’]/gi, '');
+    const lastDot = value.lastIndexOf('.');
+    const lastComma = value.lastIndexOf(',');
+    if (lastDot >= 0 && lastComma >= 0) {
+      value = lastComma > lastDot ? value.replace(/\./g, '').replace(',', '.') : value.replace(/,/g, '');
+    } else if (lastComma >= 0) {
+      value = (value.match(/,/g).length > 1) ? value.replace(/,/g, '') : value.replace(',', '.');
+    } else if (lastDot >= 0 && value.match(/\./g).length > 1) {
+      value = value.replace(/\./g, '');
+    }
+    const parsed = parseFloat(value);
+    return isFinite(parsed) ? parsed : 0;
+  }
+
   function updatePurchaseTotal(form) {
-    const bags = parseFloat(form.querySelector('[name="bags"]').value || '0');
-    const bagWeight = parseFloat(form.querySelector('[name="bag_weight_kg"]').value || '0');
-    const unitPrice = parseFloat(form.querySelector('[name="unit_price_eur"]').value || '0');
+    const bags = parseNumber(form.querySelector('[name="bags"]').value);
+    const bagWeight = parseNumber(form.querySelector('[name="bag_weight_kg"]').value);
+    const unitPrice = parseNumber(form.querySelector('[name="unit_price_eur"]').value);
     const totalNode = form.querySelector('[data-role="purchase-total"]');
     const weightNode = form.querySelector('[data-role="purchase-weight-total"]');
     if (!totalNode) return;
@@ -31,15 +48,154 @@
     }
   });
 
-  document.addEventListener('DOMContentLoaded', function () {
-    document.querySelectorAll('input[type="date"][data-default-today="true"]').forEach(function (input) {
-      if (!input.value) {
-        const today = new Date();
-        const month = String(today.getMonth() + 1).padStart(2, '0');
-        const day = String(today.getDate()).padStart(2, '0');
-        input.value = `${today.getFullYear()}-${month}-${day}`;
+  // Rejected forms come back as 400 responses carrying the re-rendered page
+  // with field errors; htmx skips error responses unless told otherwise.
+  document.addEventListener('htmx:beforeSwap', function (event) {
+    if (event.detail.xhr.status === 400) {
+      event.detail.shouldSwap = true;
+      event.detail.isError = false;
+    }
+  });
+
+  // Command palette (Ctrl+K) and single-key shortcuts. Actions are served by
+  // /api/actions and fetched once per page load.
+  const shortcuts = { n: '/consommations#nouvelle-consommation', a: '/#nouvel-achat', s: '/stats' };
+  let paletteActions = null;
+  let paletteSelection = 0;
+
+  function normalizeSearch(value) {
+    return String(value || '').normalize('NFD').replace(/[\u0300-\u036f]/g, '').toLowerCase();
+  }
+
+  function isTyping(target) {
+    return target && (target.isContentEditable || /^(INPUT|TEXTAREA|SELECT)$/.test(target.tagName));
+  }
+
+  function loadPaletteActions() {
+    if (paletteActions) return Promise.resolve(paletteActions);
+    return fetch('/api/actions', { headers: { Accept: 'application/json' } })
+      .then(function (response) { return response.ok ? response.json() : []; })
+      .then(function (actions) {
+        paletteActions = actions;
+        return actions;
+      })
+      .catch(function () { return []; });
+  }
+
+  function renderPalette(dialog) {
+    const input = dialog.querySelector('[data-role="palette-input"]');
+    const list = dialog.querySelector('[data-role="palette-results"]');
+    const query = normalizeSearch(input.value);
+    const matches = (paletteActions || []).filter(function (action) {
+      const haystack = normalizeSearch([action.label].concat(action.keywords || []).join(' '));
+      return haystack.indexOf(query) !== -1;
+    });
+    paletteSelection = Math.min(paletteSelection, Math.max(matches.length - 1, 0));
+    list.replaceChildren();
+    matches.forEach(function (action, index) {
+      const item = document.createElement('li');
+      item.setAttribute('role', 'option');
+      item.setAttribute('aria-selected', index === paletteSelection ? 'true' : 'false');
+      item.dataset.url = action.url;
+      item.textContent = action.label;
+      if (action.shortcut) {
+        const key = document.createElement('kbd');
+        key.textContent = action.shortcut;
+        item.appendChild(key);
       }
+      list.appendChild(item);
     });
+  }
+
+  function openPalette() {
+    const dialog = document.getElementById('command-palette');
+    if (!dialog || dialog.open) return;
+    const input = dialog.querySelector('[data-role="palette-input"]');
+    input.value = '';
+    paletteSelection = 0;
+    dialog.showModal();
+    input.focus();
+    loadPaletteActions().then(function () { renderPalette(dialog); });
+  }
+
+  function navigate(url) {
+    window.location.assign(url);
+  }
+
+  document.addEventListener('keydown', function (event) {
+    if ((event.ctrlKey || event.metaKey) && event.key.toLowerCase() === 'k') {
+      event.preventDefault();
+      openPalette();
+      return;
+    }
+    if (event.ctrlKey || event.metaKey || event.altKey || isTyping(event.target)) return;
+    const target = shortcuts[event.key];
+    if (target) {
+      event.preventDefault();
+      navigate(target);
+    }
+  });
+
+  document.addEventListener('input', function (event) {
+    const dialog = event.target.closest('#command-palette');
+    if (!dialog) return;
+    paletteSelection = 0;
+    renderPalette(dialog);
+  });
+
+  document.addEventListener('keydown', function (event) {
+    const dialog = event.target.closest && event.target.closest('#command-palette');
+    if (!dialog) return;
+    const items = dialog.querySelectorAll('[role="option"]');
+    if (event.key === 'ArrowDown' || event.key === 'ArrowUp') {
+      event.preventDefault();
+      if (!items.length) return;
+      const step = event.key === 'ArrowDown' ? 1 : -1;
+      paletteSelection = (paletteSelection + step + items.length) % items.length;
+      renderPalette(dialog);
+    } else if (event.key === 'Enter' && items[paletteSelection]) {
+      event.preventDefault();
+      navigate(items[paletteSelection].dataset.url);
+    }
+  });
+
+  document.addEventListener('click', function (event) {
+    const dialog = document.getElementById('command-palette');
+    if (!dialog || !dialog.open) return;
+    const item = event.target.closest('#command-palette [role="option"]');
+    if (item) {
+      navigate(item.dataset.url);
+    } else if (event.target === dialog) {
+      dialog.close();
+    }
+  });
+
+  // Buttons that only work with JavaScript are rendered hidden, for browsers
+  // without it; boosted navigations swap them in after DOMContentLoaded.
+  function revealScriptedButtons(root) {
+    root.querySelectorAll('[data-action="print"]').forEach(function (button) {
+      button.hidden = false;
+    });
+  }
+
+  document.addEventListener('htmx:load', function (event) {
+    revealScriptedButtons(event.detail.elt);
+  });
+
+  document.addEventListener('click', function (event) {
+    if (event.target.closest('[data-action="print"]')) {
+      window.print();
+    }
+  });
+
+  document.addEventListener('DOMContentLoaded', function () {
+    if (window.location.hash) {
+      const form = document.getElementById(window.location.hash.slice(1));
+      const field = form && form.querySelector('input:not([type="hidden"]), select, textarea');
+      if (field) field.focus();
+    }
+
+    revealScriptedButtons(document);
 
     document.querySelectorAll('[data-controller="purchase-form"]').forEach(function (form) {
       updatePurchaseTotal(form);